@@ -0,0 +1,170 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// -----------------------------------------------------------------------------
+// Batch conversion
+// -----------------------------------------------------------------------------
+
+// OutputSink receives the HTML of each file converted by ConvertTree.  Write
+// is called from several goroutines at once.
+type OutputSink interface {
+	Write(path, html string) error
+}
+
+// DirSink writes each converted file below the directory it names, at its
+// path in the source tree with ".html" appended.
+type DirSink string
+
+// Write implements OutputSink.
+func (d DirSink) Write(path, html string) error {
+	p := filepath.Join(string(d), filepath.FromSlash(path)+".html")
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, []byte(html), 0o644)
+}
+
+// Result is the outcome of converting one file with ConvertTree.  Err is
+// set when the file could not be read, converted or written; unsupported
+// files have an Err wrapping ErrUnsupportedFormat, files over
+// Options.MaxSize a *LimitError, files whose conversion panicked a
+// *PanicError and files not converted because ctx ended the error of ctx.
+type Result struct {
+	Path   string
+	Format Format
+	Err    error
+}
+
+// ConvertTree converts every regular file of fsys for which match returns
+// true (all files when match is nil) and hands the output to out.  Files
+// are converted concurrently by opts.Workers goroutines.  The results are
+// in walk order.  The error is non-nil when walking fsys fails, in which
+// case the files found so far are still converted, or when ctx ends, in
+// which case no further file is started; a file being converted is
+// finished.
+func ConvertTree(ctx context.Context, fsys fs.FS, match func(path string) bool, out OutputSink, opts Options) ([]Result, error) {
+	var paths []string
+	walkErr := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.Type().IsRegular() && (match == nil || match(path)) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	results := make([]Result, len(paths))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(workers, len(paths)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if err := ctx.Err(); err != nil {
+					results[i] = Result{Path: paths[i], Err: err}
+					continue
+				}
+				results[i] = convertFile(fsys, paths[i], out, opts)
+			}
+		}()
+	}
+	sent := 0
+dispatch:
+	for ; sent < len(paths); sent++ {
+		select {
+		case next <- sent:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(next)
+	wg.Wait()
+	for i := sent; i < len(paths); i++ {
+		results[i] = Result{Path: paths[i], Err: ctx.Err()}
+	}
+	if walkErr == nil {
+		walkErr = ctx.Err()
+	}
+	return results, walkErr
+}
+
+// convertFile converts one file of ConvertTree.  A panic, in the conversion
+// or in out, fails the file rather than the program unless opts.FailFast is
+// set.
+func convertFile(fsys fs.FS, path string, out OutputSink, opts Options) (res Result) {
+	res.Path = path
+	if !opts.FailFast {
+		defer func() {
+			if v := recover(); v != nil {
+				res.Err = &PanicError{Value: v, Stack: debug.Stack()}
+			}
+		}()
+	}
+	data, err := readFile(fsys, path, opts.MaxSize)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	r := bytes.NewReader(data)
+	rep, err := detect(r, r.Size(), opts)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	res.Format = rep.Format
+	html, err := convertDetected(r, r.Size(), rep, opts)
+	if err == nil {
+		err = out.Write(path, html)
+	}
+	res.Err = err
+	return res
+}
+
+// readFile reads the file at path of fsys, failing with a *LimitError if it
+// is larger than max bytes, when that is set.  The size is checked before
+// reading, and the read stops past max should the file have grown since.
+func readFile(fsys fs.FS, path string, max int64) ([]byte, error) {
+	if max <= 0 {
+		return fs.ReadFile(fsys, path)
+	}
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() > max {
+		return nil, &LimitError{Limit: "MaxSize", Max: max}
+	}
+	data, err := io.ReadAll(io.LimitReader(f, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, &LimitError{Limit: "MaxSize", Max: max}
+	}
+	return data, nil
+}
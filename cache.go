@@ -0,0 +1,154 @@
+package convert
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// -----------------------------------------------------------------------------
+// Conversion cache
+// -----------------------------------------------------------------------------
+//
+// With Options.Cache set, a conversion is keyed by the SHA-256 of the input
+// and a hash of the options that affect the output, and the HTML of an
+// earlier conversion with the same key is returned without parsing the input
+// again.  Failed conversions are not cached.  The key cannot identify an
+// ImageHandler, a URLRewriter, a metafile rasterizer, a text normaliser,
+// render hooks or a Parts function, which may also have side effects, so
+// conversions with one set bypass the cache, as do conversions collecting
+// warnings, which a cached entry does not replay.
+
+// cacheKeyVersion is part of every key; bump it when a change to the
+// converters alters their output, so disk caches are not served stale HTML.
+const cacheKeyVersion = 3
+
+// Cache stores converted HTML by key.  Keys are lowercase hex strings.
+// Implementations must be safe for concurrent use; a Put may be dropped.
+type Cache interface {
+	Get(key string) (html string, ok bool)
+	Put(key, html string)
+}
+
+// cacheKey returns the key of converting r with opts.
+func cacheKey(r io.ReaderAt, size int64, opts Options) (string, error) {
+	content := sha256.New()
+	if _, err := io.Copy(content, io.NewSectionReader(r, 0, size)); err != nil {
+		return "", err
+	}
+	// The options are hashed from their printed form, which is stable for
+	// the strings, bools and enums they hold; the workbook backend and the
+	// legacy converter are identified by their type and value, which
+	// include the formatter of xlsx.WithNumberFormatter, the layout and
+	// location name of xlsx.WithDateLayout and the executable of
+	// docx.LibreOffice.  The functions among them are nil here, since
+	// conversions with one set bypass the cache.
+	options := sha256.New()
+	fmt.Fprintf(options, "%d\n%+v\n%+v\n%T%+v\n%T%+v\n%t\n%d\n%d\n%t\n%d\n%t\n%q", cacheKeyVersion, opts.Document, opts.Workbook,
+		opts.WorkbookBackend, opts.WorkbookBackend, opts.LegacyConverter, opts.LegacyConverter, opts.Sanitize, opts.MaxCells,
+		opts.MaxOutputBytes, opts.TruncateOutput, opts.MemoryBudget, opts.Strict, opts.AllowedURLs)
+	return hex.EncodeToString(content.Sum(nil)) + hex.EncodeToString(options.Sum(nil)[:8]), nil
+}
+
+// MemoryCache is a Cache holding entries in memory, evicting the least
+// recently used once their HTML exceeds a size limit.
+type MemoryCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	order    *list.List // front is most recently used
+	entries  map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key, html string
+}
+
+// NewMemoryCache returns a MemoryCache holding up to maxBytes of HTML.
+func NewMemoryCache(maxBytes int64) *MemoryCache {
+	return &MemoryCache{maxBytes: maxBytes, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+// Get implements Cache.
+func (c *MemoryCache) Get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(memoryEntry).html, true
+}
+
+// Put implements Cache.  HTML larger than the limit is not stored.
+func (c *MemoryCache) Put(key, html string) {
+	if int64(len(html)) > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.size -= int64(len(e.Value.(memoryEntry).html))
+		c.order.Remove(e)
+	}
+	c.entries[key] = c.order.PushFront(memoryEntry{key, html})
+	c.size += int64(len(html))
+	for c.size > c.maxBytes {
+		old := c.order.Remove(c.order.Back()).(memoryEntry)
+		delete(c.entries, old.key)
+		c.size -= int64(len(old.html))
+	}
+}
+
+// DiskCache is a Cache storing each entry as a file below the directory it
+// names, so it is shared by processes and survives restarts.  Nothing is
+// ever removed; expire entries by deleting old files.
+type DiskCache string
+
+func (d DiskCache) path(key string) string {
+	return filepath.Join(string(d), key[:2], key+".html")
+}
+
+// Get implements Cache.
+func (d DiskCache) Get(key string) (string, bool) {
+	if len(key) < 2 {
+		return "", false
+	}
+	b, err := os.ReadFile(d.path(key))
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+// Put implements Cache.  The file is written under a temporary name and
+// renamed, so concurrent readers never see a partial entry.
+func (d DiskCache) Put(key, html string) {
+	if len(key) < 2 {
+		return
+	}
+	p := d.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return
+	}
+	f, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return
+	}
+	_, err = io.WriteString(f, html)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), p)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
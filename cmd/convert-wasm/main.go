@@ -0,0 +1,62 @@
+//go:build js && wasm
+
+// Command convert-wasm exposes the converter to JavaScript, so documents
+// can be previewed in the browser without leaving the user's machine.
+// Build it with
+//
+//	GOOS=js GOARCH=wasm go build -ldflags="-s -w" -o convert.wasm ./cmd/convert-wasm
+//
+// and load it with the wasm_exec.js shipped with Go.  It defines one global
+// function:
+//
+//	convertToHTML(data: Uint8Array, options?: {
+//		standalone?: boolean, sanitize?: boolean,
+//		watermark?: string, banner?: string,
+//	}): {html?: string, error?: string}
+//
+// Conversion runs synchronously; call it from a Web Worker to keep the
+// page responsive.
+package main
+
+import (
+	"syscall/js"
+
+	"github.com/aerissecure/convert"
+)
+
+func main() {
+	js.Global().Set("convertToHTML", js.FuncOf(convertToHTML))
+	select {} // keep the functions callable
+}
+
+func convertToHTML(this js.Value, args []js.Value) any {
+	if len(args) == 0 || args[0].Type() != js.TypeObject {
+		return map[string]any{"error": "convertToHTML: expected a Uint8Array"}
+	}
+	data := make([]byte, args[0].Get("length").Int())
+	js.CopyBytesToGo(data, args[0])
+
+	var opts convert.Options
+	if len(args) > 1 && args[1].Type() == js.TypeObject {
+		o := args[1]
+		opts.Document.Standalone = o.Get("standalone").Truthy()
+		opts.Sanitize = o.Get("sanitize").Truthy()
+		opts.Strict = o.Get("strict").Truthy()
+		opts.Document.Watermark = str(o.Get("watermark"))
+		opts.Document.Banner = str(o.Get("banner"))
+		opts.Workbook.Watermark = opts.Document.Watermark
+		opts.Workbook.Banner = opts.Document.Banner
+	}
+	html, err := convert.BytesToHTML(data, opts)
+	if err != nil {
+		return map[string]any{"error": err.Error()}
+	}
+	return map[string]any{"html": html}
+}
+
+func str(v js.Value) string {
+	if v.Type() != js.TypeString {
+		return ""
+	}
+	return v.String()
+}
@@ -0,0 +1,260 @@
+package convert
+
+import (
+	"encoding/xml"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// -----------------------------------------------------------------------------
+// Data connections
+// -----------------------------------------------------------------------------
+//
+// A workbook refreshes external data through the connections of
+// xl/connections.xml (databases, web pages, text files, OLAP cubes and
+// Power Query), the query tables bound to them, and Office add-ins
+// (webextension parts) that run web content against the workbook.  Inspect
+// lists them as Inspection.Connections alongside their FindingExternalData
+// and FindingWebExtension findings.  Passwords in connection strings and
+// URLs are replaced by "***" before they are reported, and the connection
+// is flagged as carrying credentials.
+
+// DataConnection is an external data source of a workbook.
+type DataConnection struct {
+	Part        string // part declaring it, e.g. "xl/connections.xml"
+	Name        string
+	Kind        string // "odbc", "oledb", "web", "text", "olap", "powerQuery", "queryTable", "webExtension" …
+	Source      string // connection string, URL, file or add-in, with passwords redacted
+	Command     string // query or command text, if any
+	Credentials bool   // Source held a password or the connection saves one
+	Remote      bool   // Source names a host on the network rather than a local file
+}
+
+// xmlConnection is a connection of xl/connections.xml.
+type xmlConnection struct {
+	ID           string `xml:"id,attr"`
+	Name         string `xml:"name,attr"`
+	Type         int    `xml:"type,attr"`
+	SourceFile   string `xml:"sourceFile,attr"`
+	ODCFile      string `xml:"odcFile,attr"`
+	SavePassword bool   `xml:"savePassword,attr"`
+	DBPr         *struct {
+		Connection string `xml:"connection,attr"`
+		Command    string `xml:"command,attr"`
+	} `xml:"dbPr"`
+	WebPr *struct {
+		URL string `xml:"url,attr"`
+	} `xml:"webPr"`
+	TextPr *struct {
+		SourceFile string `xml:"sourceFile,attr"`
+	} `xml:"textPr"`
+	OLAPPr *struct{} `xml:"olapPr"`
+}
+
+// parseConnections returns the connections of an xl/connections.xml part.
+func parseConnections(data []byte) []xmlConnection {
+	var conns struct {
+		Connection []xmlConnection `xml:"connection"`
+	}
+	xml.Unmarshal(data, &conns)
+	return conns.Connection
+}
+
+// connectionKinds names the connection types of ECMA-376 §18.13.1.
+var connectionKinds = map[int]string{
+	1: "odbc", 2: "dao", 3: "file", 4: "web", 5: "oledb", 6: "text", 7: "ado", 8: "dsp",
+}
+
+// inspectConnections reports the data connections of xl/connections.xml.
+func (in *Inspection) inspectConnections(name string, conns []xmlConnection) {
+	for _, c := range conns {
+		dc := DataConnection{Part: name, Name: c.Name, Kind: connectionKinds[c.Type], Credentials: c.SavePassword}
+		switch {
+		case c.DBPr != nil:
+			dc.Source, dc.Command = c.DBPr.Connection, c.DBPr.Command
+			if strings.Contains(strings.ToLower(dc.Source), "microsoft.mashup.oledb") {
+				dc.Kind = "powerQuery"
+			}
+		case c.WebPr != nil:
+			dc.Source = c.WebPr.URL
+		case c.TextPr != nil:
+			dc.Source = c.TextPr.SourceFile
+		}
+		if c.OLAPPr != nil {
+			dc.Kind = "olap"
+		}
+		if dc.Source == "" {
+			dc.Source = c.SourceFile + c.ODCFile
+		}
+		in.addConnection(FindingExternalData, dc)
+	}
+}
+
+// inspectQueryTable reports a query table part, naming the connection of
+// conns it refreshes from.
+func (in *Inspection) inspectQueryTable(name string, data []byte, conns []xmlConnection) {
+	var qt struct {
+		Name         string `xml:"name,attr"`
+		ConnectionID string `xml:"connectionId,attr"`
+	}
+	xml.Unmarshal(data, &qt)
+	dc := DataConnection{Part: name, Name: qt.Name, Kind: "queryTable"}
+	for _, c := range conns {
+		if c.ID == qt.ConnectionID {
+			dc.Source = "connection " + c.Name
+		}
+	}
+	in.addConnection(FindingExternalData, dc)
+}
+
+// inspectWebExtension reports an Office add-in part.
+func (in *Inspection) inspectWebExtension(name string, data []byte) {
+	var we struct {
+		Reference struct {
+			ID        string `xml:"id,attr"`
+			Store     string `xml:"store,attr"`
+			StoreType string `xml:"storeType,attr"`
+		} `xml:"reference"`
+	}
+	xml.Unmarshal(data, &we)
+	ref := we.Reference
+	source := ref.ID
+	if ref.Store != "" {
+		source = ref.StoreType + " " + ref.Store + ": " + ref.ID
+	}
+	in.Connections = append(in.Connections, DataConnection{Part: name, Kind: "webExtension", Source: source, Remote: true})
+	in.add(FindingWebExtension, name, source)
+}
+
+// addConnection redacts dc and records it with a finding of kind.
+func (in *Inspection) addConnection(kind string, dc DataConnection) {
+	var redacted bool
+	dc.Source, redacted = redactCredentials(dc.Source)
+	dc.Credentials = dc.Credentials || redacted
+	if dc.Kind != "queryTable" {
+		dc.Remote = remoteSource(dc.Source)
+	}
+	in.Connections = append(in.Connections, dc)
+	detail := dc.Name
+	if dc.Kind == "queryTable" {
+		detail = "query table " + dc.Name
+	}
+	if dc.Source != "" {
+		detail += ": " + dc.Source
+	}
+	in.add(kind, dc.Part, detail)
+}
+
+// redactCredentials replaces the passwords of a connection string or URL
+// with "***", reporting whether there were any.
+func redactCredentials(s string) (string, bool) {
+	if u, err := url.Parse(s); err == nil && u.Scheme != "" && u.Host != "" {
+		if _, ok := u.User.Password(); ok {
+			user := url.User(u.User.Username()).String()
+			return strings.Replace(s, u.User.String()+"@", user+":***@", 1), true
+		}
+		return s, false
+	}
+	var b strings.Builder
+	redacted := false
+	for i, pair := range splitConnectionString(s) {
+		if i > 0 {
+			b.WriteByte(';')
+		}
+		key, _, ok := strings.Cut(pair, "=")
+		k := strings.ToLower(strings.TrimSpace(key))
+		if ok && (strings.Contains(k, "password") || k == "pwd") {
+			b.WriteString(key + "=***")
+			redacted = true
+			continue
+		}
+		b.WriteString(pair)
+	}
+	if !redacted {
+		return s, false
+	}
+	return b.String(), true
+}
+
+// splitConnectionString splits s at the semicolons outside quoted values.
+func splitConnectionString(s string) []string {
+	var parts []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ';':
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// remoteSource reports whether a connection's source names a network host:
+// a URL with a host, a UNC path, or a server other than the local machine.
+func remoteSource(s string) bool {
+	if u, err := url.Parse(s); err == nil && u.Scheme != "" && u.Host != "" {
+		return !localHost(u.Hostname())
+	}
+	if strings.HasPrefix(s, `\\`) || strings.HasPrefix(s, "//") {
+		return true
+	}
+	for _, pair := range splitConnectionString(s) {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "server", "host", "hostname", "address", "addr", "network address":
+			if !localHost(value) {
+				return true
+			}
+		case "data source", "dbq":
+			// A file (C:\data.mdb) or a workbook query ($Workbook$) is
+			// local; anything else names a server.
+			switch {
+			case strings.HasPrefix(value, `\\`), strings.Contains(value, "://"):
+				return true
+			case value == "", strings.HasPrefix(value, "$"), filePath(value):
+			case !localHost(value):
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dataFileExts are the extensions of the files a data source can name.
+var dataFileExts = map[string]bool{
+	".mdb": true, ".accdb": true, ".xls": true, ".xlsx": true, ".xlsm": true, ".xlsb": true,
+	".csv": true, ".txt": true, ".dbf": true, ".db": true, ".sqlite": true, ".cub": true,
+}
+
+// filePath reports whether a data source names a local file.
+func filePath(s string) bool {
+	if len(s) >= 2 && s[1] == ':' || strings.HasPrefix(s, ".") || strings.HasPrefix(s, "/") {
+		return true
+	}
+	return dataFileExts[strings.ToLower(path.Ext(s))]
+}
+
+// localHost reports whether host names the local machine.
+func localHost(host string) bool {
+	host = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(host)), "tcp:")
+	host, _, _ = strings.Cut(host, `\`) // SQL Server instance: (local)\SQLEXPRESS
+	host, _, _ = strings.Cut(host, ",") // port: host,1433
+	switch host {
+	case "localhost", "(local)", ".", "127.0.0.1", "::1", "(localdb)":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,338 @@
+// Package convert converts office documents to HTML without the caller
+// having to know their format: the input is identified from its content
+// (the OPC content types of ZIP packages, the streams of compound files
+// and the RTF signature) and handed to the docx, xlsx or rtf package.
+// File names and extensions are never consulted, since uploads routinely
+// carry wrong ones.
+//
+// Output is reproducible: the same input converted with the same options
+// yields byte-identical HTML in every run, so previews can be content
+// hashed for deduplication and cache invalidation.  Nothing rendered
+// depends on the clock, the time zone or map iteration order, generated
+// class names derive from the declarations they stand for, and numbers are
+// printed at a fixed precision.  Caller-supplied hooks, such as an
+// ImageHandler, must be deterministic too for this to hold.
+//
+// The package links unioffice, through package docx, whatever the build
+// tags: the nounioffice tag only frees package xlsx of it (see
+// xlsx.Backend), since documents have no native reader yet.  Programs that
+// must not link unioffice can use package xlsx on its own.
+package convert
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/aerissecure/convert/diag"
+	"github.com/aerissecure/convert/docx"
+	"github.com/aerissecure/convert/rtf"
+	"github.com/aerissecure/convert/xlsx"
+)
+
+// Format is a detected input format.
+type Format int
+
+const (
+	FormatUnknown Format = iota
+	FormatDOCX           // Word 2007+ document or template
+	FormatXLSX           // Excel 2007+ workbook or template
+	FormatDOC            // Word 97-2003 document
+	FormatXLS            // Excel 97-2003 workbook
+	FormatRTF            // Rich Text Format
+	FormatDOCM           // macro-enabled Word 2007+ document or template
+	FormatXLSM           // macro-enabled Excel 2007+ workbook or template
+	FormatODT            // OpenDocument text
+	FormatODS            // OpenDocument spreadsheet
+	FormatPPTX           // PowerPoint 2007+ presentation
+	FormatPPT            // PowerPoint 97-2003 presentation
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatDOCX:
+		return "DOCX"
+	case FormatXLSX:
+		return "XLSX"
+	case FormatDOC:
+		return "DOC"
+	case FormatXLS:
+		return "XLS"
+	case FormatRTF:
+		return "RTF"
+	case FormatDOCM:
+		return "DOCM"
+	case FormatXLSM:
+		return "XLSM"
+	case FormatODT:
+		return "ODT"
+	case FormatODS:
+		return "ODS"
+	case FormatPPTX:
+		return "PPTX"
+	case FormatPPT:
+		return "PPT"
+	}
+	return "unknown"
+}
+
+// Options controls conversion.  The zero value converts with each
+// package's defaults.
+type Options struct {
+	// Document is used for word-processing input (DOCX, DOC and RTF).
+	Document docx.RenderOptions
+	// Workbook is used for spreadsheet input (XLSX and XLS).
+	Workbook xlsx.RenderOptions
+	// WorkbookBackend parses spreadsheet input; nil means the default of
+	// package xlsx, xlsx.Unioffice unless built with the nounioffice tag.
+	// xlsx.WithNumberFormatter wraps either backend to format values with
+	// another number-format engine, and xlsx.WithDateLayout to show dates
+	// with a Go time layout in a given location.
+	// Word-processing input is always parsed with unioffice.
+	WorkbookBackend xlsx.Backend
+	// LegacyConverter, when set, converts Word 97-2003 (.doc) input to
+	// DOCX, e.g. docx.LibreOffice; without one such input is rejected with
+	// an error wrapping docx.ErrLegacyFormat.
+	LegacyConverter docx.ExternalConverter
+	// Workers is the number of files ConvertTree converts at once; zero
+	// means GOMAXPROCS.
+	Workers int
+	// Sanitize removes metadata, comments, tracked changes and hidden
+	// content before rendering (see docx.SanitizeDocument and
+	// xlsx.SanitizeWorkbook), for previews shared outside the organisation.
+	Sanitize bool
+	// MaxCells rejects workbooks with more non-blank cells with a
+	// *LimitError; zero means no limit.
+	MaxCells int
+	// MaxSize rejects input larger than this many bytes with a
+	// *LimitError.  Zero means no limit, except for ReaderToHTML and
+	// ConvertReader, which then read up to DefaultMaxSize.
+	MaxSize int64
+	// MaxOutputBytes limits the size of the HTML; zero means no limit.
+	// Output over it fails with a *LimitError unless TruncateOutput is set.
+	MaxOutputBytes int64
+	// TruncateOutput returns output over MaxOutputBytes or MemoryBudget
+	// cut short, with a notice that the rest was not converted, instead of
+	// failing.
+	TruncateOutput bool
+	// MemoryBudget rejects input estimated to need more memory to convert
+	// with a *LimitError, and limits the output to what the estimate leaves
+	// of it; zero means no limit.  The estimate is approximate.
+	MemoryBudget int64
+	// FailFast lets a panic in a parser or renderer crash the program
+	// instead of failing the conversion with a *PanicError, wrapped in a
+	// *CorruptError for a parser.
+	FailFast bool
+	// Warnings, if set, collects the problems the parsers and renderers
+	// worked around (see the diag package), whatever the format.
+	// Conversions reporting warnings bypass the Cache.
+	Warnings *diag.List
+	// Strict passes the output through a sanitizer that keeps only an
+	// allow-listed set of elements, attributes and CSS properties, so it
+	// can be embedded in another page as is; see WithStrict.
+	Strict bool
+	// AllowedURLs lists the prefixes of the absolute URLs links and
+	// images may keep under Strict, e.g. "https://intranet.example.com/".
+	// Other absolute URLs are removed; fragments, relative references and
+	// data: images are always kept.
+	AllowedURLs []string
+	// Cache, if set, returns the HTML of an earlier conversion of the same
+	// input with the same options instead of converting it again; see
+	// MemoryCache and DiskCache.
+	Cache Cache
+	// Parts, if set, is called with each part of OPC package input before
+	// it is parsed; see PartFunc.  Conversions with it set bypass the
+	// Cache.
+	Parts PartFunc
+}
+
+// ToHTML converts r to HTML with the converter for its format.  Input the
+// Report of DetectFormat marks as unsupported is rejected with its Err, and
+// input that turns out to be damaged while parsing with a *CorruptError.
+func ToHTML(r io.ReaderAt, size int64, opts Options) (string, error) {
+	if opts.MaxSize > 0 && size > opts.MaxSize {
+		return "", &LimitError{Limit: "MaxSize", Max: opts.MaxSize}
+	}
+	rep, err := detect(r, size, opts)
+	if err != nil {
+		return "", err
+	}
+	return convertDetected(r, size, rep, opts)
+}
+
+// BytesToHTML is ToHTML for a document held in memory, the usual case for
+// WebAssembly builds that receive files from JavaScript.
+func BytesToHTML(data []byte, opts Options) (string, error) {
+	return ToHTML(bytes.NewReader(data), int64(len(data)), opts)
+}
+
+// convertDetected converts input DetectFormat reported as rep, through
+// opts.Cache if set.
+func convertDetected(r io.ReaderAt, size int64, rep Report, opts Options) (string, error) {
+	if err := rep.Err(); err != nil {
+		return "", err
+	}
+	if opts.Cache == nil || opts.Document.ImageHandler != nil || opts.Document.URLRewriter != nil || !opts.Document.Renderers.Empty() ||
+		len(opts.Workbook.CellRenderers) > 0 || opts.Workbook.ImageHandler != nil || opts.Workbook.URLRewriter != nil ||
+		opts.Document.NormalizeText != nil || opts.Workbook.NormalizeText != nil || opts.Document.MetafileRasterizer != nil || opts.Workbook.MetafileRasterizer != nil ||
+		opts.Parts != nil || opts.Warnings != nil || opts.Document.Warnings != nil {
+		return convertFormat(r, size, rep, opts, nil)
+	}
+	key, err := cacheKey(r, size, opts)
+	if err != nil {
+		return "", err
+	}
+	if html, ok := opts.Cache.Get(key); ok {
+		return html, nil
+	}
+	html, err := convertFormat(r, size, rep, opts, nil)
+	if err == nil {
+		opts.Cache.Put(key, html)
+	}
+	return html, err
+}
+
+// convertFormat converts supported input DetectFormat reported as rep.  If
+// out is set, the plain text and the statistics of the Metadata counted from
+// the parsed model are stored in it too.
+func convertFormat(r io.ReaderAt, size int64, rep Report, opts Options, out *Output) (string, error) {
+	var mem int64
+	if opts.MemoryBudget > 0 {
+		if mem = estimateMemory(r, size); mem > opts.MemoryBudget {
+			return "", &LimitError{Limit: "MemoryBudget", Max: opts.MemoryBudget}
+		}
+	}
+	limit, name := outputLimit(opts, mem)
+	html, err := renderFormat(r, size, rep, opts, limit, name, out)
+	if err != nil || !opts.Strict {
+		return html, err
+	}
+	return strictOutput(html, opts, limit, name)
+}
+
+// renderFormat parses and renders input DetectFormat reported as rep,
+// applying the output limit named name of limit bytes if that is set.
+func renderFormat(r io.ReaderAt, size int64, rep Report, opts Options, limit int64, name string, out *Output) (string, error) {
+	h, err := parseFormat(r, size, rep, opts)
+	if err != nil {
+		return "", err
+	}
+	return h.render(opts, limit, name, out)
+}
+
+// parseFormat parses input DetectFormat reported as rep into a Handle,
+// applying Parts, MaxCells and Sanitize and adding the parser warnings to
+// opts.Warnings.
+func parseFormat(r io.ReaderAt, size int64, rep Report, opts Options) (*Handle, error) {
+	if opts.Parts != nil {
+		switch rep.Format {
+		case FormatDOCX, FormatDOCM, FormatXLSX, FormatXLSM:
+			if err := visitParts(rep.Format, r, size, opts.Parts); err != nil {
+				return nil, err
+			}
+		}
+	}
+	h := &Handle{format: rep.Format, sanitized: opts.Sanitize}
+	switch rep.Format {
+	case FormatXLSX, FormatXLSM, FormatXLS:
+		parseWorkbook := xlsx.ParseWorkbookModel
+		if opts.WorkbookBackend != nil {
+			parseWorkbook = opts.WorkbookBackend.ParseWorkbook
+		}
+		m, err := parse(rep.Format, opts, func() (xlsx.WorkbookModel, error) { return parseWorkbook(r, size) })
+		if err != nil {
+			return nil, err
+		}
+		if opts.MaxCells > 0 {
+			if err := checkCells(m, opts.MaxCells); err != nil {
+				return nil, err
+			}
+		}
+		h.warnings = m.Warnings
+		if opts.Sanitize {
+			xlsx.SanitizeWorkbook(&m)
+		}
+		h.book = &m
+	case FormatRTF:
+		m, err := parse(rep.Format, opts, func() (docx.DocumentModel, error) { return rtf.ParseDocumentModel(r, size) })
+		if err != nil {
+			return nil, err
+		}
+		h.doc = &m
+	default:
+		popts := docx.ParseOptions{LegacyConverter: opts.LegacyConverter}
+		m, err := parse(rep.Format, opts, func() (docx.DocumentModel, error) { return docx.ParseDocumentModelWith(r, size, popts) })
+		if err != nil {
+			return nil, err
+		}
+		h.doc = &m
+	}
+	if h.doc != nil {
+		h.warnings = h.doc.Warnings
+		if opts.Sanitize {
+			docx.SanitizeDocument(h.doc)
+		}
+	}
+	opts.Warnings.Add(h.warnings...)
+	return h, nil
+}
+
+// parse runs the parser fn for format f, classifying its error with
+// parseError and, unless opts.FailFast is set, recovering its panics.  With
+// FailFast, a panic the parser returned as an error is raised again.
+func parse[M any](f Format, opts Options, fn func() (M, error)) (m M, err error) {
+	if !opts.FailFast {
+		defer recoverParse(f, &err)
+	}
+	if m, err = fn(); err != nil {
+		var panicked *diag.PanicError
+		if opts.FailFast && errors.As(err, &panicked) {
+			panic(panicked)
+		}
+		err = parseError(f, err)
+	}
+	return m, err
+}
+
+// renderDocument renders m, stopping once the output exceeds limit bytes
+// if that is set, and stores its plain text in out if that is.
+func renderDocument(m docx.DocumentModel, opts Options, limit int64, name string, out *Output) (string, error) {
+	if opts.Warnings != nil {
+		opts.Document.Warnings = opts.Warnings
+	}
+	if out != nil {
+		out.Text = docx.DocumentText(m)
+	}
+	var b strings.Builder
+	var w io.Writer = &b
+	if limit > 0 {
+		w = &limitWriter{w: &b, max: limit}
+	}
+	err := docx.RenderDocumentHTMLTo(w, m, opts.Document)
+	if errors.Is(err, errOutputLimit) {
+		return limitOutput(b.String(), true, limit, name, opts)
+	}
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// checkCells returns a *LimitError if m has more than max non-blank cells.
+func checkCells(m xlsx.WorkbookModel, max int) error {
+	n := 0
+	for _, sheet := range m.Sheets {
+		for _, row := range sheet.Rows {
+			for _, cell := range row.Cells {
+				if cell != nil {
+					n++
+				}
+			}
+		}
+	}
+	if n > max {
+		return &LimitError{Limit: "MaxCells", Max: int64(max)}
+	}
+	return nil
+}
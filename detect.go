@@ -0,0 +1,253 @@
+package convert
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/aerissecure/convert/docx"
+	"github.com/aerissecure/convert/internal/cfb"
+	"github.com/aerissecure/convert/internal/safezip"
+)
+
+// -----------------------------------------------------------------------------
+// Format detection
+// -----------------------------------------------------------------------------
+
+// Report describes an input as far as it can be told without converting
+// it, so callers can explain up front why a file will not convert.
+type Report struct {
+	Format Format
+
+	// Supported reports whether ToHTML can convert the input.
+	Supported bool
+	// NeedsExternalConverter is set for formats only converted through an
+	// external program (Options.LegacyConverter for .doc).  DetectFormat
+	// does not know the options, so Supported is false for such input; the
+	// conversion functions accept it when a converter is configured.
+	NeedsExternalConverter bool
+	// Encrypted is set for password-protected and rights-managed files,
+	// which are never supported.
+	Encrypted bool
+	// RightsManaged is set for files encrypted with Information Rights
+	// Management rather than a password.
+	RightsManaged bool
+	// Corrupt is set when the ZIP package or compound file is damaged or
+	// fails the archive safety checks (see Err).
+	Corrupt bool
+	// Macros is set when the file carries a VBA or Basic macro project.
+	// Macros are never run; the flag is informational.
+	Macros bool
+
+	// Detail says what was found when the input is not supported, e.g.
+	// "PowerPoint presentation".
+	Detail string
+
+	cause error // why a Corrupt container could not be read
+}
+
+// Err returns nil for supported input, a *CorruptError for a damaged
+// container, a *LimitError for a ZIP archive over the size, ratio or part
+// count limits, and otherwise a *FormatError, wrapping ErrPasswordRequired or
+// docx.ErrLegacyFormat where they apply.
+func (r Report) Err() error {
+	switch {
+	case r.Supported:
+		return nil
+	case r.Corrupt:
+		if err := parseError(r.Format, r.cause); err != r.cause {
+			return err
+		}
+		return &CorruptError{Format: r.Format, Err: r.cause}
+	case r.Encrypted:
+		e := &FormatError{Format: r.Format, Detail: r.Detail, Encrypted: true}
+		if !r.RightsManaged {
+			e.Err = ErrPasswordRequired
+		}
+		return e
+	case r.NeedsExternalConverter:
+		return &FormatError{Format: r.Format, Detail: r.Detail, Err: docx.ErrLegacyFormat}
+	}
+	return &FormatError{Format: r.Format, Detail: r.Detail}
+}
+
+// detect is DetectFormat for a conversion with opts, which supports .doc
+// input if opts.LegacyConverter is set.
+func detect(r io.ReaderAt, size int64, opts Options) (Report, error) {
+	rep, err := DetectFormat(r, size)
+	if rep.NeedsExternalConverter && rep.Format == FormatDOC && !rep.Encrypted && opts.LegacyConverter != nil {
+		rep.Supported = true
+	}
+	return rep, err
+}
+
+// DetectFormat identifies the format of r from its content and reports
+// what converting it would involve.  The error is only non-nil when r
+// cannot be read; unrecognised input gives a Report with FormatUnknown.
+func DetectFormat(r io.ReaderAt, size int64) (Report, error) {
+	head := make([]byte, 8)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return Report{}, err
+	}
+	head = head[:n]
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		return detectPackage(r, size), nil
+	case cfb.IsCFB(head):
+		return detectCompound(r, size), nil
+	case bytes.HasPrefix(head, []byte(`{\rtf`)):
+		return Report{Format: FormatRTF, Supported: true}, nil
+	}
+	return Report{Detail: "unrecognized content"}, nil
+}
+
+// Main-part content types of the OPC packages, by format.
+var packageTypes = map[string]Format{
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml":   FormatDOCX,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.template.main+xml":   FormatDOCX,
+	"application/vnd.ms-word.document.macroEnabled.main+xml":                             FormatDOCM,
+	"application/vnd.ms-word.template.macroEnabledTemplate.main+xml":                     FormatDOCM,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml":         FormatXLSX,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.template.main+xml":      FormatXLSX,
+	"application/vnd.ms-excel.sheet.macroEnabled.main+xml":                               FormatXLSM,
+	"application/vnd.ms-excel.template.macroEnabled.main+xml":                            FormatXLSM,
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation.main+xml": FormatPPTX,
+	"application/vnd.ms-powerpoint.presentation.macroEnabled.main+xml":                   FormatPPTX,
+}
+
+// OpenDocument mimetype entries, by format.
+var odfTypes = map[string]Format{
+	"application/vnd.oasis.opendocument.text":         FormatODT,
+	"application/vnd.oasis.opendocument.spreadsheet":  FormatODS,
+	"application/vnd.oasis.opendocument.presentation": FormatUnknown,
+}
+
+// detectPackage identifies a ZIP package: OPC packages from the content
+// type of their main part in [Content_Types].xml, OpenDocument files from
+// their mimetype entry.
+func detectPackage(r io.ReaderAt, size int64) Report {
+	zr, err := safezip.NewReader(r, size)
+	if err != nil {
+		return Report{Corrupt: true, Detail: "damaged ZIP archive", cause: err}
+	}
+	var rep Report
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+		base := f.Name[strings.LastIndex(f.Name, "/")+1:]
+		switch {
+		case strings.EqualFold(base, "vbaProject.bin"):
+			rep.Macros = true
+		case strings.HasPrefix(f.Name, "Basic/") && base != "script-lc.xml" && base != "script-lb.xml":
+			rep.Macros = true
+		}
+	}
+
+	if f, ok := files["mimetype"]; ok {
+		mt := strings.TrimSpace(string(readEntry(f, 256)))
+		format, ok := odfTypes[mt]
+		if !ok {
+			rep.Detail = "ZIP archive"
+			return rep
+		}
+		rep.Format = format
+		if m, ok := files["META-INF/manifest.xml"]; ok && bytes.Contains(readEntry(m, 1<<20), []byte("encryption-data")) {
+			rep.Encrypted = true
+		}
+		rep.Detail = "OpenDocument " + strings.TrimPrefix(mt, "application/vnd.oasis.opendocument.")
+		return rep
+	}
+
+	f, ok := files["[Content_Types].xml"]
+	if !ok {
+		rep.Detail = "ZIP archive"
+		return rep
+	}
+	var types struct {
+		Override []struct {
+			ContentType string `xml:"ContentType,attr"`
+		}
+	}
+	xml.Unmarshal(readEntry(f, 1<<20), &types)
+	rep.Detail = "OPC package"
+	for _, o := range types.Override {
+		if format, ok := packageTypes[o.ContentType]; ok {
+			rep.Format = format
+			break
+		}
+		if strings.HasPrefix(o.ContentType, "application/vnd.ms-visio") {
+			rep.Detail = "Visio drawing"
+		}
+	}
+	switch rep.Format {
+	case FormatDOCX, FormatDOCM, FormatXLSX, FormatXLSM:
+		rep.Supported = true
+		rep.Detail = ""
+	case FormatPPTX:
+		rep.Detail = "PowerPoint presentation"
+	}
+	return rep
+}
+
+// readEntry returns up to limit bytes of a ZIP entry, or nil.
+func readEntry(f *zip.File, limit int64) []byte {
+	rc, err := f.Open()
+	if err != nil {
+		return nil
+	}
+	defer rc.Close()
+	b, _ := io.ReadAll(io.LimitReader(rc, limit))
+	return b
+}
+
+// detectCompound identifies a compound file from its streams.
+func detectCompound(r io.ReaderAt, size int64) Report {
+	f, err := cfb.Open(r, size)
+	if err != nil {
+		return Report{Corrupt: true, Detail: "damaged compound file", cause: err}
+	}
+	has := func(name string) bool {
+		_, ok := f.Stat(name)
+		return ok
+	}
+	switch {
+	case has("EncryptedPackage"):
+		// Encrypted OOXML: the package inside cannot be identified without
+		// the password.  IRM-protected packages name the DRM transform in
+		// their data spaces.
+		if has("\x06DataSpaces/TransformInfo/DRMEncryptedTransform") {
+			return Report{Encrypted: true, RightsManaged: true, Detail: "rights-managed Office document"}
+		}
+		return Report{Encrypted: true, Detail: "password-protected Office document"}
+	case has("WordDocument"):
+		rep := Report{
+			Format:                 FormatDOC,
+			NeedsExternalConverter: true,
+			Macros:                 has("Macros"),
+		}
+		// FIB flag fEncrypted, bit 8 of the word at offset 0x0A.
+		if fib, err := f.ReadStream("WordDocument"); err == nil && len(fib) >= 12 {
+			rep.Encrypted = binary.LittleEndian.Uint16(fib[0x0A:])&0x0100 != 0
+		}
+		return rep
+	case has("Workbook"):
+		rep := Report{Format: FormatXLS, Macros: has("_VBA_PROJECT_CUR")}
+		// A FILEPASS record directly follows the BOF of encrypted workbooks.
+		if wb, err := f.ReadStream("Workbook"); err == nil && len(wb) >= 8 {
+			next := 4 + int(binary.LittleEndian.Uint16(wb[2:]))
+			rep.Encrypted = len(wb) >= next+2 && binary.LittleEndian.Uint16(wb[next:]) == 0x002F
+		}
+		rep.Supported = !rep.Encrypted
+		return rep
+	case has("Book"):
+		return Report{Format: FormatXLS, Macros: has("_VBA_PROJECT_CUR"), Detail: "Excel 5.0/95 workbook"}
+	case has("PowerPoint Document"):
+		return Report{Format: FormatPPT, Detail: "PowerPoint 97-2003 presentation"}
+	}
+	return Report{Detail: "compound file"}
+}
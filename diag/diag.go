@@ -0,0 +1,134 @@
+// Package diag defines the warnings the DOCX and XLSX converters report for
+// input they convert despite problems: a reference that does not parse, a
+// part that is missing or cannot be decoded, an image that cannot be shown.
+// The parsers record them in the Warnings of their models and the renderers
+// add theirs to the List in their RenderOptions, so callers can tell a clean
+// conversion from one "converted with N warnings".
+package diag
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Code identifies the kind of a warning.
+type Code string
+
+const (
+	// BadReference is a cell or range reference that does not parse; the
+	// cell or range is left out.
+	BadReference Code = "bad-reference"
+	// MissingPart is a part the document refers to that is absent or
+	// cannot be read; its content is left out.
+	MissingPart Code = "missing-part"
+	// BadPart is a part that cannot be decoded; its content is left out.
+	BadPart Code = "bad-part"
+	// UnsupportedImage is an image in a format that cannot be shown; a
+	// placeholder is rendered instead.
+	UnsupportedImage Code = "unsupported-image"
+	// DangerousFormula is a DDE or external-command formula, or text that
+	// would act as one if exported; the cell is converted as usual and
+	// flagged.
+	DangerousFormula Code = "dangerous-formula"
+)
+
+// Location is where in the input a warning arose.  Fields that do not apply
+// or are not known are left zero.
+type Location struct {
+	Part  string // package part, e.g. "word/footnotes.xml"
+	Sheet string // worksheet name
+	Cell  string // cell or range reference within Sheet, e.g. "B7"
+	Block int    // 1-based index of the top-level block of a document
+}
+
+func (l Location) String() string {
+	var parts []string
+	if l.Part != "" {
+		parts = append(parts, l.Part)
+	}
+	switch {
+	case l.Sheet != "" && l.Cell != "":
+		parts = append(parts, l.Sheet+"!"+l.Cell)
+	case l.Sheet != "":
+		parts = append(parts, l.Sheet)
+	case l.Cell != "":
+		parts = append(parts, l.Cell)
+	}
+	if l.Block > 0 {
+		parts = append(parts, fmt.Sprintf("block %d", l.Block))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Warning is a problem in the input that did not stop its conversion.
+type Warning struct {
+	Code     Code
+	Location Location
+	Message  string
+}
+
+func (w Warning) String() string {
+	if loc := w.Location.String(); loc != "" {
+		return fmt.Sprintf("%s: %s: %s", loc, w.Code, w.Message)
+	}
+	return fmt.Sprintf("%s: %s", w.Code, w.Message)
+}
+
+// List collects warnings.  It is safe for concurrent use, and the methods
+// of a nil *List do nothing, so renderers report to it unconditionally.
+type List struct {
+	mu sync.Mutex
+	w  []Warning
+}
+
+// Add appends ws.
+func (l *List) Add(ws ...Warning) {
+	if l == nil || len(ws) == 0 {
+		return
+	}
+	l.mu.Lock()
+	l.w = append(l.w, ws...)
+	l.mu.Unlock()
+}
+
+// Warnings returns the warnings added so far, in order.
+func (l *List) Warnings() []Warning {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Warning(nil), l.w...)
+}
+
+// Len returns the number of warnings added so far.
+func (l *List) Len() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.w)
+}
+
+// PanicError is the error the parsers return for input that made them
+// panic: a bug, located where in the input it was triggered if that is
+// known.
+type PanicError struct {
+	Part  string // the package part or stream, empty if not known
+	Ref   string // the cell or block within Part, empty if not known
+	Value any    // the original panic value
+	Stack []byte // the stack where it was raised
+}
+
+func (e *PanicError) Error() string {
+	msg := fmt.Sprintf("panic: %v", e.Value)
+	if e.Part != "" {
+		msg += " in " + e.Part
+	}
+	if e.Ref != "" {
+		msg += " at " + e.Ref
+	}
+	return msg
+}
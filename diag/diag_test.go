@@ -0,0 +1,29 @@
+package diag
+
+import "testing"
+
+func TestList(t *testing.T) {
+	var nilList *List
+	nilList.Add(Warning{Code: BadPart})
+	if nilList.Len() != 0 || nilList.Warnings() != nil {
+		t.Error("nil List is not a no-op")
+	}
+
+	var l List
+	l.Add(Warning{Code: BadReference, Location: Location{Sheet: "Data", Cell: "B7"}, Message: "cell: bad"})
+	l.Add(Warning{Code: MissingPart, Location: Location{Part: "word/header1.xml"}, Message: "header: not found"},
+		Warning{Code: BadPart, Location: Location{Part: "word/document.xml", Block: 3}, Message: "x"})
+	ws := l.Warnings()
+	if l.Len() != 3 || len(ws) != 3 {
+		t.Fatalf("Warnings = %v", ws)
+	}
+	for i, want := range []string{
+		"Data!B7: bad-reference: cell: bad",
+		"word/header1.xml: missing-part: header: not found",
+		"word/document.xml block 3: bad-part: x",
+	} {
+		if got := ws[i].String(); got != want {
+			t.Errorf("%d: String = %q, want %q", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package docx
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aerissecure/convert/diag"
+	"github.com/unidoc/unioffice/schema/soo/wml"
+)
+
+// -----------------------------------------------------------------------------
+// altChunk import
+// -----------------------------------------------------------------------------
+//
+// w:altChunk pulls the content of another part (HTML, MHT, RTF, plain text or
+// a whole WordprocessingML document) into the body at that position.  Word
+// converts the part when the document is opened; unioffice keeps only the
+// relationship ID, so the content is converted here.  Nested documents are
+// parsed and spliced into the model; everything else becomes an AltChunk
+// block carrying sanitised HTML and/or plain text.  Documents nested more
+// than maxChunkDepth deep, as a document embedding itself would be, are left
+// out with a warning.
+
+// maxChunkDepth is the deepest nesting of altChunk documents imported.
+const maxChunkDepth = 4
+
+// walkAltChunk imports the content referenced by an altChunk.
+func (p *parser) walkAltChunk(ac *wml.CT_AltChunk) {
+	if ac.IdAttr == nil || p.pkg == nil {
+		return
+	}
+	rel, ok := p.docRels()[*ac.IdAttr]
+	if !ok || rel.External() {
+		return
+	}
+	part := resolveTarget(p.pkg.main, rel.Target)
+	data, err := p.pkg.readPart(part)
+	if err != nil {
+		p.warn(diag.MissingPart, diag.Location{Part: part, Block: p.blocks + 1}, "altChunk: "+err.Error())
+		return
+	}
+	chunk := &AltChunk{PartName: part, ContentType: p.pkg.contentType(part)}
+	ct, _, _ := mime.ParseMediaType(chunk.ContentType)
+	switch {
+	case ct == "text/html" || ct == "application/xhtml+xml":
+		chunk.HTML = sanitizeChunkHTML(string(data))
+	case ct == "message/rfc822" || ct == "multipart/related":
+		chunk.HTML = sanitizeChunkHTML(mhtHTML(data))
+	case ct == "application/rtf" || ct == "text/rtf":
+		chunk.Text = rtfText(data)
+	case ct == "text/plain":
+		chunk.Text = string(data)
+	case strings.HasPrefix(ct, "application/vnd.openxmlformats-officedocument.wordprocessingml."),
+		strings.HasPrefix(ct, "application/vnd.ms-word."):
+		if p.depth >= maxChunkDepth {
+			p.warn(diag.BadPart, diag.Location{Part: part, Block: p.blocks + 1}, "altChunk: documents nested too deeply")
+			return
+		}
+		if p.importDocument(data, "altChunk-"+*ac.IdAttr+"/") {
+			return
+		}
+	default:
+		return
+	}
+	if chunk.Text == "" {
+		chunk.Text = chunkHTMLText(chunk.HTML)
+	}
+	p.mdl.AltChunks = append(p.mdl.AltChunks, *chunk)
+	p.addBlock(DocumentBlock{AltChunk: chunk})
+}
+
+// importDocument splices the body of a nested DOCX into the model,
+// prefixing its source locations with prefix.
+func (p *parser) importDocument(data []byte, prefix string) bool {
+	sub, err := parseDocumentModel(bytes.NewReader(data), int64(len(data)), p.opts, p.depth+1)
+	if err != nil {
+		return false
+	}
+	prefixSources(&sub, prefix)
+	for _, blk := range sub.Blocks {
+		p.addBlock(blk)
+	}
+	p.mdl.ContentControls = append(p.mdl.ContentControls, sub.ContentControls...)
+	p.mdl.Objects = append(p.mdl.Objects, sub.Objects...)
+	p.mdl.AltChunks = append(p.mdl.AltChunks, sub.AltChunks...)
+	p.mdl.Warnings = append(p.mdl.Warnings, sub.Warnings...)
+	return true
+}
+
+// mhtHTML returns the HTML document of an MHT (MIME HTML) archive.
+func mhtHTML(data []byte) string {
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return ""
+	}
+	return mimeHTML(textproto.MIMEHeader(msg.Header), msg.Body)
+}
+
+// mimeHTML finds the first text/html entity in a MIME body.
+func mimeHTML(h textproto.MIMEHeader, body io.Reader) string {
+	ct, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	if strings.HasPrefix(ct, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err != nil {
+				return ""
+			}
+			if s := mimeHTML(part.Header, part); s != "" {
+				return s
+			}
+		}
+	}
+	if ct != "text/html" {
+		return ""
+	}
+	switch strings.ToLower(h.Get("Content-Transfer-Encoding")) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, &newlineStripper{bufio.NewReader(body)})
+	}
+	b, err := io.ReadAll(body)
+	if err != nil && len(b) == 0 {
+		return ""
+	}
+	return string(b)
+}
+
+// newlineStripper drops line breaks from wrapped base64 content.
+type newlineStripper struct{ r io.ByteReader }
+
+func (n *newlineStripper) Read(p []byte) (int, error) {
+	i := 0
+	for i < len(p) {
+		c, err := n.r.ReadByte()
+		if err != nil {
+			return i, err
+		}
+		if c != '\r' && c != '\n' {
+			p[i] = c
+			i++
+		}
+	}
+	return i, nil
+}
+
+var (
+	htmlTagRe     = regexp.MustCompile(`(?s)<!--.*?-->|<!\[CDATA\[.*?\]\]>|<[!?][^>]*>|<(/?)([a-zA-Z][a-zA-Z0-9]*)[^>]*>`)
+	htmlBodyRe    = regexp.MustCompile(`(?is)<body[^>]*>(.*)</body>`)
+	htmlBreakRe   = regexp.MustCompile(`(?i)<br>|</(p|div|li|tr|h[1-6])>`)
+	htmlDroppedRe = regexp.MustCompile(`(?is)<(script|style|head|title|object|iframe|noscript|template|svg|math)\b.*?</(script|style|head|title|object|iframe|noscript|template|svg|math)\s*>`)
+)
+
+// chunkAllowedTags are the elements kept when sanitising HTML chunks.  All
+// attributes are dropped.
+var chunkAllowedTags = map[string]bool{
+	"p": true, "br": true, "div": true, "span": true,
+	"b": true, "strong": true, "i": true, "em": true, "u": true, "s": true, "sub": true, "sup": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"ul": true, "ol": true, "li": true, "blockquote": true, "pre": true, "code": true,
+	"table": true, "thead": true, "tbody": true, "tr": true, "td": true, "th": true,
+}
+
+// sanitizeChunkHTML reduces an HTML document to the structural markup of its
+// body: a fixed set of attribute-free elements and text.  Scripts, styles and
+// every other element are removed.
+func sanitizeChunkHTML(s string) string {
+	if m := htmlBodyRe.FindStringSubmatch(s); m != nil {
+		s = m[1]
+	}
+	s = htmlDroppedRe.ReplaceAllString(s, "")
+	var b strings.Builder
+	last := 0
+	for _, m := range htmlTagRe.FindAllStringSubmatchIndex(s, -1) {
+		b.WriteString(escapeChunkText(s[last:m[0]]))
+		last = m[1]
+		if m[4] < 0 {
+			continue // comment, doctype, processing instruction
+		}
+		name := strings.ToLower(s[m[4]:m[5]])
+		if !chunkAllowedTags[name] {
+			continue
+		}
+		if m[3] > m[2] {
+			b.WriteString("</" + name + ">")
+		} else {
+			b.WriteString("<" + name + ">")
+		}
+	}
+	b.WriteString(escapeChunkText(s[last:]))
+	return strings.TrimSpace(b.String())
+}
+
+// escapeChunkText escapes markup characters left in a text segment while
+// keeping existing entity references intact.
+func escapeChunkText(s string) string {
+	return html.EscapeString(html.UnescapeString(s))
+}
+
+// chunkHTMLText extracts the text of sanitised chunk HTML.
+func chunkHTMLText(s string) string {
+	s = htmlBreakRe.ReplaceAllString(s, "\n")
+	s = htmlTagRe.ReplaceAllString(s, "")
+	return strings.TrimSpace(html.UnescapeString(s))
+}
+
+// rtfText extracts the plain text of an RTF document.  Destinations that do
+// not hold body text (font and colour tables, metadata, pictures, "\*"
+// destinations) are skipped; control words are otherwise ignored apart from
+// paragraph and line breaks, tabs and character escapes.
+func rtfText(data []byte) string {
+	var (
+		b     strings.Builder
+		depth int
+		skip  = -1 // depth of the destination being skipped, -1 if none
+	)
+	skipDest := map[string]bool{
+		"fonttbl": true, "colortbl": true, "stylesheet": true, "info": true, "pict": true,
+		"header": true, "footer": true, "listtable": true, "listoverridetable": true, "rsidtbl": true,
+		"generator": true, "xmlnstbl": true, "themedata": true, "datastore": true, "latentstyles": true,
+	}
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch c {
+		case '{':
+			depth++
+			continue
+		case '}':
+			if depth == skip {
+				skip = -1
+			}
+			depth--
+			continue
+		case '\r', '\n':
+			continue
+		}
+		if c != '\\' {
+			if skip < 0 {
+				b.WriteByte(c)
+			}
+			continue
+		}
+		if i+1 >= len(data) {
+			break
+		}
+		i++
+		c = data[i]
+		switch {
+		case c == '*':
+			if skip < 0 {
+				skip = depth
+			}
+		case c == '\'' && i+2 < len(data):
+			if skip < 0 {
+				var v byte
+				for _, h := range data[i+1 : i+3] {
+					v <<= 4
+					switch {
+					case h >= '0' && h <= '9':
+						v |= h - '0'
+					case h >= 'a' && h <= 'f':
+						v |= h - 'a' + 10
+					case h >= 'A' && h <= 'F':
+						v |= h - 'A' + 10
+					}
+				}
+				b.WriteRune(rune(v)) // Windows-1252 approximated as Latin-1
+			}
+			i += 2
+		case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			start := i
+			for i < len(data) && (data[i] >= 'a' && data[i] <= 'z' || data[i] >= 'A' && data[i] <= 'Z') {
+				i++
+			}
+			word := string(data[start:i])
+			numStart := i
+			for i < len(data) && (data[i] == '-' || data[i] >= '0' && data[i] <= '9') {
+				i++
+			}
+			param, _ := strconv.Atoi(string(data[numStart:i]))
+			if i < len(data) && data[i] != ' ' {
+				i-- // the delimiter is not part of the control word
+			}
+			if skip >= 0 {
+				continue
+			}
+			switch word {
+			case "u":
+				if param < 0 {
+					param += 65536
+				}
+				b.WriteRune(rune(param))
+				if i+1 < len(data) && data[i+1] != '\\' && data[i+1] != '{' && data[i+1] != '}' {
+					i++ // skip the single ANSI fallback character
+				}
+			case "par", "line", "row":
+				b.WriteByte('\n')
+			case "tab", "cell":
+				b.WriteByte('\t')
+			default:
+				if skipDest[word] {
+					skip = depth
+				}
+			}
+		default:
+			if skip < 0 && (c == '\\' || c == '{' || c == '}') {
+				b.WriteByte(c)
+			}
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
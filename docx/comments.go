@@ -0,0 +1,127 @@
+package docx
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aerissecure/convert/diag"
+	"github.com/unidoc/unioffice/schema/soo/wml"
+)
+
+// -----------------------------------------------------------------------------
+// Comments
+// -----------------------------------------------------------------------------
+//
+// A comment is anchored in the body by a range and a reference mark:
+//
+//	<w:commentRangeStart w:id="3"/> …commented runs… <w:commentRangeEnd w:id="3"/>
+//	<w:r><w:commentReference w:id="3"/></w:r>
+//
+// Ranges may overlap and span paragraphs, so the parser tracks the set of
+// open ranges and tags every run with the comments covering it.  The comment
+// bodies live in comments.xml, which unioffice does not expose; it also
+// drops w:date values, so those are read from the raw XML.
+
+const relComments = "/comments"
+
+// commentRange updates the open comment ranges for a range markup element.
+func (p *parser) commentRange(rm *wml.EG_RangeMarkupElements) {
+	if s := rm.CommentRangeStart; s != nil {
+		p.openComments = append(p.openComments, s.IdAttr)
+	}
+	if e := rm.CommentRangeEnd; e != nil {
+		for i, id := range p.openComments {
+			if id == e.IdAttr {
+				p.openComments = append(p.openComments[:i:i], p.openComments[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// activeComments returns the comments covering the current position.
+func (p *parser) activeComments() []int64 {
+	if len(p.openComments) == 0 {
+		return nil
+	}
+	return append([]int64(nil), p.openComments...)
+}
+
+// readComments converts the bodies of all comments in comments.xml.
+func (p *parser) readComments() {
+	if p.pkg == nil {
+		return
+	}
+	for _, rel := range sortedRels(p.docRels()) {
+		if rel.External() || !strings.HasSuffix(rel.Type, relComments) {
+			continue
+		}
+		part := resolveTarget(p.pkg.main, rel.Target)
+		data, err := p.pkg.readPart(part)
+		if err != nil {
+			p.warn(diag.MissingPart, diag.Location{Part: part}, "comments: "+err.Error())
+			continue
+		}
+		var x wml.Comments
+		if err := xml.Unmarshal(data, &x); err != nil {
+			p.warn(diag.BadPart, diag.Location{Part: part}, "comments: "+err.Error())
+			continue
+		}
+		dates := scanCommentDates(data)
+		p.scanTrackedChanges(data)
+		for _, c := range x.Comment {
+			p.src.add(fmt.Sprintf("comment%d/", c.IdAttr), c.EG_BlockLevelElts)
+			cm := Comment{ID: c.IdAttr, Author: c.AuthorAttr, Date: dates[c.IdAttr], Blocks: p.detachedBlocks(c.EG_BlockLevelElts)}
+			if c.InitialsAttr != nil {
+				cm.Initials = *c.InitialsAttr
+			}
+			p.mdl.Comments = append(p.mdl.Comments, cm)
+		}
+	}
+}
+
+// scanCommentDates maps comment IDs to their w:date.
+func scanCommentDates(data []byte) map[int64]time.Time {
+	out := make(map[int64]time.Time)
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			return out
+		}
+		if el, ok := tok.(xml.StartElement); ok && el.Name.Local == "comment" {
+			id, err := strconv.ParseInt(attrValue(el, "id"), 10, 64)
+			if err != nil {
+				continue
+			}
+			for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05"} {
+				if d, err := time.Parse(layout, attrValue(el, "date")); err == nil {
+					out[id] = d
+					break
+				}
+			}
+		}
+	}
+}
+
+// blocksText returns the plain text of blocks, one line per paragraph.
+func blocksText(blocks []DocumentBlock) string {
+	var lines []string
+	for _, blk := range blocks {
+		if blk.Paragraph == nil {
+			continue
+		}
+		var b strings.Builder
+		for _, r := range blk.Paragraph.Runs {
+			if _, ok := revisedRun(r, RevisionsAccept); ok {
+				b.WriteString(r.Text)
+			}
+		}
+		lines = append(lines, b.String())
+	}
+	return strings.Join(lines, "\n")
+}
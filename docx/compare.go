@@ -0,0 +1,519 @@
+package docx
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// -----------------------------------------------------------------------------
+// Document comparison
+// -----------------------------------------------------------------------------
+//
+// CompareDocuments aligns the blocks of two versions of a document by their
+// text, then compares each pair of changed paragraphs word by word.  The
+// result is an ordinary DocumentModel whose runs carry RenderRun.Change, so
+// it renders as a redline with any of the HTML renderers: inserted text in
+// <ins>, deleted text in <del>, like Word's track changes view.
+//
+// Tracked changes in either version are accepted first.
+//
+// Paragraphs and tables changed beyond recognition (fewer than half of
+// their words in common) are shown as a deletion followed by an insertion
+// rather than as a tangle of word changes.  So are versions too far apart
+// to align in bounded time (see maxDiffEdits), as a whole.
+
+// CompareDocuments returns a redline of the changes from old to new.  The
+// properties, sections, comments and notes of the result are those of new.
+func CompareDocuments(old, new DocumentModel) DocumentModel {
+	out := DocumentModel{
+		Properties: new.Properties,
+		Comments:   new.Comments,
+		Sections:   new.Sections,
+		Notes:      new.Notes,
+	}
+	a, b := revisedBlocks(old.Blocks, RevisionsAccept), revisedBlocks(new.Blocks, RevisionsAccept)
+	for _, blk := range compareBlocks(a, b) {
+		out.AppendBlock(blk)
+	}
+	return out
+}
+
+// compareBlocks merges two block sequences.  Unmatched blocks between two
+// matched ones are paired where they are similar enough.
+func compareBlocks(a, b []DocumentBlock) []DocumentBlock {
+	keyA, keyB := make([]string, len(a)), make([]string, len(b))
+	for i := range a {
+		keyA[i] = blockKey(a[i])
+	}
+	for i := range b {
+		keyB[i] = blockKey(b[i])
+	}
+	var out []DocumentBlock
+	var dels, ins []DocumentBlock
+	flush := func() {
+		// Pair each deleted block with the next similar inserted one; the
+		// insertions skipped over come first.
+		j := 0
+		pair := len(dels)*len(ins) <= maxBlockPairs
+		for _, d := range dels {
+			for k := j; pair && k < len(ins); k++ {
+				if merged, ok := compareBlock(d, ins[k]); ok {
+					for _, blk := range ins[j:k] {
+						out = append(out, markBlock(blk, revInsert))
+					}
+					out = append(out, merged)
+					j = k + 1
+					d = DocumentBlock{}
+					break
+				}
+			}
+			if d.Paragraph != nil || d.Table != nil || d.AltChunk != nil {
+				out = append(out, markBlock(d, revDelete))
+			}
+		}
+		for _, blk := range ins[j:] {
+			out = append(out, markBlock(blk, revInsert))
+		}
+		dels, ins = dels[:0], ins[:0]
+	}
+	for _, op := range diffKeys(keyA, keyB) {
+		switch {
+		case op.a >= 0 && op.b >= 0:
+			flush()
+			out = append(out, b[op.b])
+		case op.a >= 0:
+			dels = append(dels, a[op.a])
+		default:
+			ins = append(ins, b[op.b])
+		}
+	}
+	flush()
+	return out
+}
+
+// compareBlock compares two blocks of the same kind, reporting false when
+// they are too different to show as one.
+func compareBlock(a, b DocumentBlock) (DocumentBlock, bool) {
+	switch {
+	case a.Paragraph != nil && b.Paragraph != nil:
+		ta, tb := runTokens(a.Paragraph.Runs), runTokens(b.Paragraph.Runs)
+		if !similar(ta, tb) {
+			return DocumentBlock{}, false
+		}
+		p := *b.Paragraph
+		p.Runs = compareRuns(a.Paragraph.Runs, b.Paragraph.Runs, ta, tb)
+		return DocumentBlock{Paragraph: &p}, true
+	case a.Table != nil && b.Table != nil && sameShape(*a.Table, *b.Table):
+		var ta, tb []token
+		for _, row := range a.Table.Rows {
+			for _, c := range row.Cells {
+				for _, p := range c.Paragraphs {
+					ta = append(ta, runTokens(p.Runs)...)
+				}
+			}
+		}
+		for _, row := range b.Table.Rows {
+			for _, c := range row.Cells {
+				for _, p := range c.Paragraphs {
+					tb = append(tb, runTokens(p.Runs)...)
+				}
+			}
+		}
+		if !similar(ta, tb) {
+			return DocumentBlock{}, false
+		}
+		t := *b.Table
+		t.Rows = make([]RenderTableRow, len(b.Table.Rows))
+		for r, row := range b.Table.Rows {
+			t.Rows[r] = row
+			t.Rows[r].Cells = make([]RenderTableCell, len(row.Cells))
+			for c, cell := range row.Cells {
+				t.Rows[r].Cells[c] = cell
+				t.Rows[r].Cells[c].Paragraphs = compareParagraphs(a.Table.Rows[r].Cells[c].Paragraphs, cell.Paragraphs)
+			}
+		}
+		return DocumentBlock{Table: &t}, true
+	}
+	return DocumentBlock{}, false
+}
+
+// compareParagraphs compares the content of two table cells.
+func compareParagraphs(a, b []RenderParagraph) []RenderParagraph {
+	wrap := func(ps []RenderParagraph) []DocumentBlock {
+		blocks := make([]DocumentBlock, len(ps))
+		for i := range ps {
+			blocks[i] = DocumentBlock{Paragraph: &ps[i]}
+		}
+		return blocks
+	}
+	var out []RenderParagraph
+	for _, blk := range compareBlocks(wrap(a), wrap(b)) {
+		out = append(out, *blk.Paragraph)
+	}
+	return out
+}
+
+// sameShape reports whether two tables have the same rows and columns.
+func sameShape(a, b RenderTable) bool {
+	if len(a.Rows) != len(b.Rows) {
+		return false
+	}
+	for i := range a.Rows {
+		if len(a.Rows[i].Cells) != len(b.Rows[i].Cells) {
+			return false
+		}
+	}
+	return true
+}
+
+// markBlock returns a copy of blk with every run, or the altChunk, marked
+// as change.
+func markBlock(blk DocumentBlock, change string) DocumentBlock {
+	markRuns := func(p RenderParagraph) RenderParagraph {
+		runs := make([]RenderRun, len(p.Runs))
+		for i, r := range p.Runs {
+			r.Change = change
+			runs[i] = r
+		}
+		p.Runs = runs
+		return p
+	}
+	switch {
+	case blk.Paragraph != nil:
+		p := markRuns(*blk.Paragraph)
+		return DocumentBlock{Paragraph: &p}
+	case blk.Table != nil:
+		t := *blk.Table
+		t.Rows = make([]RenderTableRow, len(blk.Table.Rows))
+		for r, row := range blk.Table.Rows {
+			t.Rows[r] = row
+			t.Rows[r].Cells = make([]RenderTableCell, len(row.Cells))
+			for c, cell := range row.Cells {
+				cell.Paragraphs = append([]RenderParagraph(nil), cell.Paragraphs...)
+				for i := range cell.Paragraphs {
+					cell.Paragraphs[i] = markRuns(cell.Paragraphs[i])
+				}
+				t.Rows[r].Cells[c] = cell
+			}
+		}
+		return DocumentBlock{Table: &t}
+	case blk.AltChunk != nil:
+		a := *blk.AltChunk
+		a.Change = change
+		return DocumentBlock{AltChunk: &a}
+	}
+	return blk
+}
+
+// blockKey identifies a block's content for alignment: its style and text.
+func blockKey(blk DocumentBlock) string {
+	var b strings.Builder
+	switch {
+	case blk.Paragraph != nil:
+		b.WriteString("p\x00" + blk.Paragraph.StyleID + "\x00")
+		for _, t := range runTokens(blk.Paragraph.Runs) {
+			b.WriteString(t.key)
+		}
+	case blk.Table != nil:
+		b.WriteString("t\x00")
+		for _, row := range blk.Table.Rows {
+			for _, c := range row.Cells {
+				for _, p := range c.Paragraphs {
+					for _, t := range runTokens(p.Runs) {
+						b.WriteString(t.key)
+					}
+					b.WriteString("\x00")
+				}
+				b.WriteString("\x01")
+			}
+		}
+	case blk.AltChunk != nil:
+		b.WriteString("a\x00" + blk.AltChunk.HTML + "\x00" + blk.AltChunk.Text)
+	}
+	return b.String()
+}
+
+// -----------------------------------------------------------------------------
+// Word-level comparison
+// -----------------------------------------------------------------------------
+
+// token is a word, a run of spaces or a punctuation character of a run, or
+// a whole run that is not text (an object, note reference, bookmark …).
+type token struct {
+	key  string // compared text; includes formatting so format changes show
+	text string
+	run  int // index of the source run
+}
+
+// runTokens splits runs into tokens.
+func runTokens(runs []RenderRun) []token {
+	var out []token
+	for i, r := range runs {
+		if r.Object != nil || r.Image != nil || r.Note != nil || r.Bookmark != "" || r.CommentRef != nil || r.Ruby != nil {
+			out = append(out, token{key: "\x02" + opaqueKey(r), run: i})
+			continue
+		}
+		prefix := r.Style.String() + "\x00" + r.Href + "\x00"
+		s := []rune(r.Text)
+		for j := 0; j < len(s); {
+			k := j + 1
+			switch class := runeClass(s[j]); class {
+			case 'w', 's':
+				for k < len(s) && runeClass(s[k]) == class {
+					k++
+				}
+			}
+			text := string(s[j:k])
+			out = append(out, token{key: prefix + text, text: text, run: i})
+			j = k
+		}
+	}
+	return out
+}
+
+// opaqueKey identifies a non-text run.
+func opaqueKey(r RenderRun) string {
+	key := r.Text + "\x00" + r.Bookmark
+	switch {
+	case r.Object != nil:
+		key += "\x00" + r.Object.PartName
+	case r.Image != nil:
+		key += "\x00" + r.Image.PartName + r.Image.Source
+	case r.Note != nil:
+		key += "\x00" + r.Note.Kind + r.Note.Mark
+	case r.CommentRef != nil:
+		key += "\x00" + strconv.FormatInt(*r.CommentRef, 10)
+	case r.Ruby != nil:
+		for _, base := range r.Ruby.Base {
+			key += "\x00" + base.Text
+		}
+	}
+	return key
+}
+
+// runeClass groups runes into words ('w'), spaces ('s') and punctuation.
+func runeClass(r rune) byte {
+	switch {
+	case unicode.IsLetter(r), unicode.IsDigit(r), unicode.IsMark(r):
+		return 'w'
+	case unicode.IsSpace(r):
+		return 's'
+	}
+	return 'p'
+}
+
+// similar reports whether at least half of the words of two token lists
+// are common to both.  Spaces and punctuation are not counted.
+func similar(a, b []token) bool {
+	words := func(ts []token) []token {
+		var out []token
+		for _, t := range ts {
+			if t.text == "" || runeClass([]rune(t.text)[0]) == 'w' {
+				out = append(out, t)
+			}
+		}
+		return out
+	}
+	a, b = words(a), words(b)
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == len(b)
+	}
+	common := 0
+	for _, op := range diffTokens(a, b) {
+		if op.a >= 0 && op.b >= 0 {
+			common++
+		}
+	}
+	return 4*common >= len(a)+len(b)
+}
+
+// compareRuns merges the tokens of two versions of a paragraph into runs,
+// marking the tokens only in a as deleted and those only in b as inserted.
+// Adjacent tokens from the same run with the same mark are joined again.
+func compareRuns(ra, rb []RenderRun, ta, tb []token) []RenderRun {
+	var out []RenderRun
+	last := 0 // source of the last run of out: b's runs count up from 1, a's down from -1
+	for _, op := range diffTokens(ta, tb) {
+		var (
+			t      token
+			src    RenderRun
+			id     int
+			change string
+		)
+		if op.b >= 0 {
+			t, id = tb[op.b], tb[op.b].run+1
+			src = rb[t.run]
+			if op.a < 0 {
+				change = revInsert
+			}
+		} else {
+			t, id, change = ta[op.a], -ta[op.a].run-1, revDelete
+			src = ra[t.run]
+		}
+		if t.text == "" {
+			// A non-text run, kept whole.
+			src.Change = change
+			out = append(out, src)
+			last = 0
+			continue
+		}
+		if n := len(out); n > 0 && last == id && out[n-1].Change == change {
+			out[n-1].Text += t.text
+			continue
+		}
+		src.Text, src.Change = t.text, change
+		out = append(out, src)
+		last = id
+	}
+	return out
+}
+
+// diffOp is one step of an alignment: a pair of equal elements, an element
+// only in a (b < 0) or an element only in b (a < 0).
+type diffOp struct{ a, b int }
+
+// diffTokens aligns two token lists by key.
+func diffTokens(a, b []token) []diffOp {
+	ka, kb := make([]string, len(a)), make([]string, len(b))
+	for i := range a {
+		ka[i] = a[i].key
+	}
+	for i := range b {
+		kb[i] = b[i].key
+	}
+	return diffKeys(ka, kb)
+}
+
+// maxDiffEdits bounds the edits diffKeys searches for, which bounds its time
+// to O((n+m)·maxDiffEdits) and its memory to O(maxDiffEdits²).  Lists
+// further apart are aligned on their common prefix and suffix only.
+const maxDiffEdits = 1000
+
+// maxBlockPairs bounds the pairs of deleted and inserted blocks that
+// compareBlocks tries to match within a changed stretch; larger stretches
+// are shown as deleted and inserted whole.
+const maxBlockPairs = 1 << 14
+
+// diffKeys computes a shortest edit script between two string lists with
+// Myers' O(ND) algorithm, after trimming their common prefix and suffix.
+// Deletions come before insertions within each changed stretch.
+func diffKeys(a, b []string) []diffOp {
+	var ops []diffOp
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		ops = append(ops, diffOp{pre, pre})
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	ma, mb := a[pre:len(a)-suf], b[pre:len(b)-suf]
+
+	var dels, ins []diffOp
+	flush := func() {
+		ops = append(ops, dels...)
+		ops = append(ops, ins...)
+		dels, ins = dels[:0], ins[:0]
+	}
+	for _, op := range myers(ma, mb) {
+		switch {
+		case op.a >= 0 && op.b >= 0:
+			flush()
+			ops = append(ops, diffOp{pre + op.a, pre + op.b})
+		case op.a >= 0:
+			dels = append(dels, diffOp{pre + op.a, -1})
+		default:
+			ins = append(ins, diffOp{-1, pre + op.b})
+		}
+	}
+	flush()
+	for k := 0; k < suf; k++ {
+		ops = append(ops, diffOp{len(a) - suf + k, len(b) - suf + k})
+	}
+	return ops
+}
+
+// myers returns a shortest edit script from a to b, or one deleting all of
+// a and inserting all of b if that takes more than maxDiffEdits edits.
+//
+// v[k] holds the furthest x reached on diagonal k = x-y; trace keeps v
+// after each round d, for diagonals -d to d, to walk the path back.
+func myers(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	limit := min(n+m, maxDiffEdits)
+	off := limit + 1
+	v := make([]int, 2*off+1)
+	var trace [][]int
+	for d := 0; d <= limit; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[off+k-1] < v[off+k+1] {
+				x = v[off+k+1] // down: an insertion
+			} else {
+				x = v[off+k-1] + 1 // right: a deletion
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				trace = append(trace, v[off-d:off+d+1])
+				return myersPath(trace, n, m)
+			}
+		}
+		trace = append(trace, append([]int(nil), v[off-d:off+d+1]...))
+	}
+	ops := make([]diffOp, 0, n+m)
+	for i := range n {
+		ops = append(ops, diffOp{i, -1})
+	}
+	for j := range m {
+		ops = append(ops, diffOp{-1, j})
+	}
+	return ops
+}
+
+// myersPath walks the path found by myers back from (n, m) to (0, 0).
+func myersPath(trace [][]int, n, m int) []diffOp {
+	var ops []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1] // diagonals -(d-1) to d-1
+		at := func(k int) int { return prev[k+d-1] }
+		k := x - y
+		pk := k - 1
+		if k == -d || k != d && at(k-1) < at(k+1) {
+			pk = k + 1
+		}
+		px := at(pk)
+		py := px - pk
+		// The edit leads from (px, py) to (mx, x-k), the snake on to (x, y).
+		mx := px + 1
+		if pk == k+1 {
+			mx = px
+		}
+		for x > mx {
+			x--
+			y--
+			ops = append(ops, diffOp{x, y})
+		}
+		if pk == k+1 {
+			ops = append(ops, diffOp{-1, py})
+		} else {
+			ops = append(ops, diffOp{px, -1})
+		}
+		x, y = px, py
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		ops = append(ops, diffOp{x, y})
+	}
+	slices.Reverse(ops)
+	return ops
+}
@@ -1,8 +1,25 @@
 package docx
 
 import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+
+	"github.com/aerissecure/convert/diag"
+	"github.com/aerissecure/convert/fonts"
+	"github.com/aerissecure/convert/internal/cfb/cfbtest"
+	"github.com/aerissecure/convert/media"
+	"github.com/unidoc/unioffice/document"
+	"github.com/unidoc/unioffice/schema/soo/wml"
 )
 
 func TestDocxToHTML(t *testing.T) {
@@ -28,3 +45,1710 @@ func TestDocxToHTML(t *testing.T) {
 		t.Fatalf("failed to write test.html: %v", err)
 	}
 }
+
+func TestMapSymbol(t *testing.T) {
+	tests := []struct {
+		font, char string
+		want       string
+		mapped     bool
+	}{
+		{"Symbol", "F061", "α", true},
+		{"Symbol", "B3", "≥", true},
+		{"Wingdings", "F0FC", "✔", true},
+		{"wingdings", "F0A7", "▪", true},
+		{"Webdings", "F061", "\uf061", false},
+		{"Symbol", "zz", "", false},
+	}
+	for _, tt := range tests {
+		got, mapped := mapSymbol(tt.font, tt.char)
+		if got != tt.want || mapped != tt.mapped {
+			t.Errorf("mapSymbol(%q, %q) = %q, %t; want %q, %t", tt.font, tt.char, got, mapped, tt.want, tt.mapped)
+		}
+	}
+}
+
+// parseDoc round-trips a programmatically built document through the parser.
+func parseDoc(t *testing.T, d *document.Document) DocumentModel {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := d.Save(&buf); err != nil {
+		t.Fatalf("failed to save document: %v", err)
+	}
+	m, err := ParseDocumentModel(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("ParseDocumentModel failed: %v", err)
+	}
+	return m
+}
+
+func TestContentControls(t *testing.T) {
+	d := document.New()
+	d.AddParagraph().AddRun().AddText("before")
+
+	sdt := wml.NewCT_SdtBlock()
+	sdt.SdtPr = wml.NewCT_SdtPr()
+	sdt.SdtPr.Tag = &wml.CT_String{ValAttr: "client"}
+	sdt.SdtPr.Alias = &wml.CT_String{ValAttr: "Client Name"}
+	sdt.SdtContent = wml.NewCT_SdtContentBlock()
+	p := wml.NewCT_P()
+	r := wml.NewCT_R()
+	r.EG_RunInnerContent = []*wml.EG_RunInnerContent{{T: &wml.CT_Text{Content: "ACME"}}}
+	p.EG_PContent = []*wml.EG_PContent{{EG_ContentRunContent: []*wml.EG_ContentRunContent{{R: r}}}}
+	sdt.SdtContent.P = append(sdt.SdtContent.P, p)
+	d.X().Body.EG_BlockLevelElts = append(d.X().Body.EG_BlockLevelElts, &wml.EG_BlockLevelElts{
+		EG_ContentBlockContent: []*wml.EG_ContentBlockContent{{Sdt: sdt}},
+	})
+
+	m := parseDoc(t, d)
+	if len(m.Blocks) != 2 {
+		t.Fatalf("got %d blocks, want 2", len(m.Blocks))
+	}
+	par := m.Blocks[1].Paragraph
+	if par == nil || len(par.Runs) != 1 || par.Runs[0].Text != "ACME" {
+		t.Fatalf("content control paragraph not extracted: %+v", par)
+	}
+	if par.ContentControl == nil || par.ContentControl.Tag != "client" || par.ContentControl.Alias != "Client Name" {
+		t.Errorf("unexpected content control: %+v", par.ContentControl)
+	}
+	if len(m.ContentControls) != 1 {
+		t.Errorf("got %d content controls, want 1", len(m.ContentControls))
+	}
+	if out := RenderDocumentHTML(m); !strings.Contains(out, `data-sdt-tag="client"`) {
+		t.Errorf("rendered HTML lacks content control attributes: %s", out)
+	}
+
+	// Row- and cell-level controls are recorded too, their cells' paragraphs
+	// carrying the innermost.
+	body := `<w:tbl><w:sdt><w:sdtPr><w:tag w:val="row"/></w:sdtPr><w:sdtContent>
+<w:tr><w:tc><w:p><w:r><w:t>a</w:t></w:r></w:p></w:tc>
+<w:sdt><w:sdtPr><w:tag w:val="cell"/></w:sdtPr><w:sdtContent><w:tc><w:p><w:r><w:t>b</w:t></w:r></w:p></w:tc></w:sdtContent></w:sdt>
+</w:tr></w:sdtContent></w:sdt></w:tbl>`
+	data := minimalPackage(t, body, "", nil)
+	m, err := ParseDocumentModel(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.ContentControls) != 2 || m.ContentControls[0].Tag != "row" || m.ContentControls[1].Tag != "cell" {
+		t.Fatalf("content controls = %+v", m.ContentControls)
+	}
+	cells := m.Blocks[0].Table.Rows[0].Cells
+	if len(cells) != 2 || cells[0].Paragraphs[0].ContentControl.Tag != "row" || cells[1].Paragraphs[0].ContentControl.Tag != "cell" {
+		t.Errorf("cells = %+v", cells)
+	}
+}
+
+// minimalPackage builds a DOCX container from raw parts.  body is the inner
+// XML of <w:body>; rels are extra <Relationship> elements for the main
+// document part and extra holds any additional parts keyed by name.
+func minimalPackage(t *testing.T, body, rels string, extra map[string][]byte) []byte {
+	t.Helper()
+	parts := map[string][]byte{
+		"[Content_Types].xml": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Default Extension="png" ContentType="image/png"/>
+<Default Extension="xlsx" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"/>
+<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>
+</Types>`),
+		"_rels/.rels": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/>
+</Relationships>`),
+		"word/document.xml": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+ xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+ xmlns:v="urn:schemas-microsoft-com:vml" xmlns:o="urn:schemas-microsoft-com:office:office">
+<w:body>` + body + `</w:body></w:document>`),
+		"word/_rels/document.xml.rels": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` + rels + `</Relationships>`),
+	}
+	for name, data := range extra {
+		parts[name] = data
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestEmbeddedObjects(t *testing.T) {
+	body := `<w:p><w:r><w:t>See </w:t></w:r><w:r><w:object w:dxaOrig="1440" w:dyaOrig="720">
+<v:shape id="_x0000_i1025" style="width:72pt;height:36pt"><v:imagedata r:id="rId11" o:title=""/></v:shape>
+<o:OLEObject Type="Embed" ProgID="Excel.Sheet.12" ShapeID="_x0000_i1025" DrawAspect="Icon" ObjectID="_1" r:id="rId10"/>
+</w:object></w:r></w:p>`
+	rels := `<Relationship Id="rId10" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/package" Target="embeddings/Budget.xlsx"/>
+<Relationship Id="rId11" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/image" Target="media/image1.png"/>`
+	data := minimalPackage(t, body, rels, map[string][]byte{
+		"word/embeddings/Budget.xlsx": []byte("PK"),
+		"word/media/image1.png":       []byte("\x89PNG"),
+	})
+	m, err := ParseDocumentModel(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseDocumentModel failed: %v", err)
+	}
+	if len(m.Objects) != 1 {
+		t.Fatalf("got %d objects, want 1", len(m.Objects))
+	}
+	o := m.Objects[0]
+	if o.Type != "Excel worksheet" || o.FileName != "Budget.xlsx" || o.PartName != "word/embeddings/Budget.xlsx" {
+		t.Errorf("unexpected object: %s", o)
+	}
+	if o.PreviewType != "image/png" || o.WidthPt != 72 {
+		t.Errorf("unexpected preview/size: %s", o)
+	}
+	out := RenderDocumentHTML(m)
+	if !strings.Contains(out, `data-object-type="Excel worksheet"`) || !strings.Contains(out, "data:image/png;base64,") {
+		t.Errorf("object placeholder missing from HTML: %s", out)
+	}
+
+	var buf strings.Builder
+	if err := RenderDocumentHTMLTo(&buf, m, RenderOptions{RedactImages: true}); err != nil {
+		t.Fatal(err)
+	}
+	out = buf.String()
+	if strings.Contains(out, "<img") || !strings.Contains(out, "data-redacted") ||
+		!strings.Contains(out, "width:72pt;") || !strings.Contains(out, "[Excel worksheet: Budget.xlsx]") {
+		t.Errorf("image not redacted: %s", out)
+	}
+}
+
+func TestMainDocumentPart(t *testing.T) {
+	// The main document part is wherever the package relationship points,
+	// and the parts it refers to resolve against it.
+	rels := `<Relationship Id="rId10" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/package" Target="embeddings/Budget.xlsx"/>`
+	data := minimalPackage(t, "", "", map[string][]byte{
+		"[Content_Types].xml": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/doc/main.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>
+</Types>`),
+		"_rels/.rels": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="doc/main.xml"/>
+</Relationships>`),
+		"doc/main.xml": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+ xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+ xmlns:o="urn:schemas-microsoft-com:office:office">
+<w:body><w:p><w:r><w:object><o:OLEObject Type="Embed" ProgID="Excel.Sheet.12" r:id="rId10"/></w:object></w:r></w:p></w:body></w:document>`),
+		"doc/_rels/main.xml.rels": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` + rels + `</Relationships>`),
+		"doc/embeddings/Budget.xlsx": []byte("PK"),
+	})
+	m, err := ParseDocumentModel(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Objects) != 1 || m.Objects[0].PartName != "doc/embeddings/Budget.xlsx" {
+		t.Errorf("objects = %+v", m.Objects)
+	}
+}
+
+func TestHyperlinkStyle(t *testing.T) {
+	body := `<w:p><w:hyperlink r:id="rId5"><w:r><w:t>example</w:t></w:r></w:hyperlink></w:p>`
+	rels := `<Relationship Id="rId5" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink" Target="https://example.com/" TargetMode="External"/>`
+	data := minimalPackage(t, body, rels, nil)
+	m, err := ParseDocumentModel(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseDocumentModel failed: %v", err)
+	}
+	run := m.Paragraphs[0].Runs[0]
+	if run.Href != "https://example.com/" || run.Style.FontColor != "0563C1" || !run.Style.Underline {
+		t.Errorf("unexpected hyperlink run: href=%q style=%s", run.Href, run.Style)
+	}
+	out := RenderDocumentHTML(m)
+	if !strings.Contains(out, `<a href="https://example.com/">`) || !strings.Contains(out, "color:#0563C1;text-decoration:underline;") {
+		t.Errorf("hyperlink not rendered as link: %s", out)
+	}
+
+	var buf strings.Builder
+	proxy := func(u string) (string, bool) { return "https://proxy.test/?u=" + u, true }
+	if err := RenderDocumentHTMLTo(&buf, m, RenderOptions{URLRewriter: proxy}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `<a href="https://proxy.test/?u=https://example.com/">`) {
+		t.Errorf("hyperlink not rewritten: %s", buf.String())
+	}
+	buf.Reset()
+	drop := func(string) (string, bool) { return "", false }
+	if err := RenderDocumentHTMLTo(&buf, m, RenderOptions{URLRewriter: drop}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "<a ") || !strings.Contains(buf.String(), "example") {
+		t.Errorf("dropped hyperlink not rendered as text: %s", buf.String())
+	}
+}
+
+func TestRunFormatting(t *testing.T) {
+	body := `<w:p><w:r><w:rPr><w:rStyle w:val="Emphasis"/><w:b/><w:color w:val="ff0000"/><w:sz w:val="28"/></w:rPr><w:t>styled</w:t></w:r>
+<w:r><w:rPr><w:rStyle w:val="Emphasis"/><w:i w:val="0"/><w:rFonts w:ascii="Courier New"/><w:vertAlign w:val="superscript"/></w:rPr><w:t>plain</w:t></w:r></w:p>`
+	rels := `<Relationship Id="rId30" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`
+	data := minimalPackage(t, body, rels, map[string][]byte{
+		"word/styles.xml": []byte(`<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:style w:type="character" w:styleId="Emphasis"><w:name w:val="Emphasis"/><w:rPr><w:i/><w:u w:val="single"/><w:sz w:val="20"/></w:rPr></w:style>
+</w:styles>`),
+	})
+	m, err := ParseDocumentModel(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := m.Paragraphs[0].Runs
+	want := []RunStyle{
+		{FontSizePt: 14, FontColor: "FF0000", Bold: true, Italic: true, Underline: true},
+		{FontFamily: "Courier New", FontSizePt: 10, Underline: true, VerticalAlign: "superscript"},
+	}
+	for i, w := range want {
+		if runs[i].Style != w {
+			t.Errorf("run %d: style = %s, want %s", i, runs[i].Style, w)
+		}
+	}
+	out := RenderDocumentHTML(m)
+	if !strings.Contains(out, "font-weight:bold;") || !strings.Contains(out, "color:#FF0000;") {
+		t.Errorf("run formatting not rendered: %s", out)
+	}
+}
+
+func TestParagraphFormatting(t *testing.T) {
+	body := `<w:p><w:pPr><w:pStyle w:val="Heading2"/></w:pPr><w:r><w:t>builtin</w:t></w:r></w:p>
+<w:p><w:pPr><w:pStyle w:val="Finding"/><w:jc w:val="both"/><w:spacing w:before="240" w:line="360" w:lineRule="exact"/></w:pPr><w:r><w:t>custom</w:t></w:r></w:p>
+<w:p><w:pPr><w:pStyle w:val="Note"/><w:ind w:right="720"/></w:pPr><w:r><w:t>body</w:t></w:r></w:p>`
+	rels := `<Relationship Id="rId30" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`
+	data := minimalPackage(t, body, rels, map[string][]byte{
+		"word/styles.xml": []byte(`<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:style w:type="paragraph" w:styleId="Heading2"><w:name w:val="heading 2"/></w:style>
+<w:style w:type="paragraph" w:styleId="Base"><w:name w:val="Base"/><w:pPr><w:spacing w:after="120"/><w:ind w:left="1440"/><w:jc w:val="center"/></w:pPr></w:style>
+<w:style w:type="paragraph" w:styleId="Finding"><w:name w:val="Finding"/><w:basedOn w:val="Base"/><w:pPr><w:outlineLvl w:val="2"/></w:pPr></w:style>
+<w:style w:type="paragraph" w:styleId="Note"><w:name w:val="Note"/><w:basedOn w:val="Base"/></w:style>
+</w:styles>`),
+	})
+	m, err := ParseDocumentModel(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ParagraphStyle{
+		{HeadingLevel: 2},
+		{Alignment: "justify", LineSpacingPt: 18, SpaceBeforePt: 12, SpaceAfterPt: 6, IndentLeftPx: 96, HeadingLevel: 3},
+		{Alignment: "center", SpaceAfterPt: 6, IndentLeftPx: 96, IndentRightPx: 48},
+	}
+	for i, w := range want {
+		if got := m.Paragraphs[i].Style; got != w {
+			t.Errorf("paragraph %d: style = %s, want %s", i, got, w)
+		}
+	}
+	out := RenderDocumentHTML(m)
+	for _, want := range []string{"<h2", "<h3", "text-align:justify;margin-top:12pt;margin-bottom:6pt;line-height:18pt;padding-left:96px;", "padding-right:48px;"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %s:\n%s", want, out)
+		}
+	}
+}
+
+func TestStyleInheritance(t *testing.T) {
+	body := `<w:p><w:r><w:t>normal</w:t></w:r></w:p>
+<w:p><w:pPr><w:pStyle w:val="Quote"/></w:pPr><w:r><w:rPr><w:rStyle w:val="Strong"/><w:color w:val="auto"/></w:rPr><w:t>quoted</w:t></w:r></w:p>`
+	rels := `<Relationship Id="rId30" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`
+	data := minimalPackage(t, body, rels, map[string][]byte{
+		"word/styles.xml": []byte(`<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:docDefaults><w:rPrDefault><w:rPr><w:rFonts w:ascii="Calibri"/><w:sz w:val="22"/></w:rPr></w:rPrDefault><w:pPrDefault><w:pPr><w:spacing w:after="160"/></w:pPr></w:pPrDefault></w:docDefaults>
+<w:style w:type="paragraph" w:default="1" w:styleId="Normal"><w:name w:val="Normal"/><w:pPr><w:jc w:val="both"/></w:pPr><w:rPr><w:color w:val="333333"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="Quote"><w:name w:val="Quote"/><w:basedOn w:val="Normal"/><w:pPr><w:ind w:left="720"/></w:pPr><w:rPr><w:i/><w:rFonts w:ascii="Georgia"/></w:rPr></w:style>
+<w:style w:type="character" w:styleId="Strong"><w:name w:val="Strong"/><w:rPr><w:b/><w:sz w:val="24"/></w:rPr></w:style>
+</w:styles>`),
+	})
+	m, err := ParseDocumentModel(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []struct {
+		para ParagraphStyle
+		run  RunStyle
+	}{
+		{ParagraphStyle{Alignment: "justify", SpaceAfterPt: 8}, RunStyle{FontFamily: "Calibri", FontSizePt: 11, FontColor: "333333"}},
+		{ParagraphStyle{Alignment: "justify", SpaceAfterPt: 8, IndentLeftPx: 48}, RunStyle{FontFamily: "Georgia", FontSizePt: 12, Bold: true, Italic: true}},
+	} {
+		p := m.Paragraphs[i]
+		if p.Style != want.para || p.Runs[0].Style != want.run {
+			t.Errorf("paragraph %d: style = %s / %s, want %s / %s", i, p.Style, p.Runs[0].Style, want.para, want.run)
+		}
+	}
+}
+
+func TestListNumbering(t *testing.T) {
+	item := func(num, lvl int, text string) string {
+		return fmt.Sprintf(`<w:p><w:pPr><w:numPr><w:ilvl w:val="%d"/><w:numId w:val="%d"/></w:numPr></w:pPr><w:r><w:t>%s</w:t></w:r></w:p>`, lvl, num, text)
+	}
+	body := item(1, 0, "one") + item(1, 1, "one.a") + item(1, 1, "one.b") + item(1, 0, "two") + item(1, 1, "two.a") +
+		`<w:p><w:r><w:t>aside</w:t></w:r></w:p>` + item(1, 0, "three") + item(2, 0, "restarted") + item(3, 0, "bullet")
+	rels := `<Relationship Id="rId31" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/numbering" Target="numbering.xml"/>`
+	data := minimalPackage(t, body, rels, map[string][]byte{
+		"word/numbering.xml": []byte(`<w:numbering xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:abstractNum w:abstractNumId="0"><w:lvl w:ilvl="0"><w:start w:val="1"/><w:numFmt w:val="decimal"/></w:lvl><w:lvl w:ilvl="1"><w:start w:val="1"/><w:numFmt w:val="lowerLetter"/></w:lvl></w:abstractNum>
+<w:abstractNum w:abstractNumId="1"><w:lvl w:ilvl="0"><w:numFmt w:val="bullet"/><w:lvlText w:val="o"/></w:lvl></w:abstractNum>
+<w:num w:numId="1"><w:abstractNumId w:val="0"/></w:num>
+<w:num w:numId="2"><w:abstractNumId w:val="0"/><w:lvlOverride w:ilvl="0"><w:startOverride w:val="1"/></w:lvlOverride></w:num>
+<w:num w:numId="3"><w:abstractNumId w:val="1"/></w:num>
+</w:numbering>`),
+	})
+	m, err := ParseDocumentModel(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range m.Paragraphs {
+		st := p.Style
+		got = append(got, fmt.Sprintf("%s:%d:%d:%d:%s", st.ListType, st.ListID, st.ListLevel, st.ListNumber, st.ListMarker))
+	}
+	want := []string{
+		"ordered:1:0:1:decimal", "ordered:1:1:1:lower-alpha", "ordered:1:1:2:lower-alpha", "ordered:1:0:2:decimal", "ordered:1:1:1:lower-alpha",
+		":0:0:0:", "ordered:1:0:3:decimal", "ordered:2:0:1:decimal", "unordered:3:0:0:circle",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("list items = %q, want %q", got, want)
+	}
+	out := RenderDocumentHTML(m)
+	for _, want := range []string{`<ol style="list-style-type:lower-alpha;">`, `<ol start="3">`, `<ul style="list-style-type:circle;">`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %s:\n%s", want, out)
+		}
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	tests := []struct {
+		n    int64
+		f    wml.ST_NumberFormat
+		want string
+	}{
+		{4, wml.ST_NumberFormatDecimal, "4"},
+		{14, wml.ST_NumberFormatLowerRoman, "xiv"},
+		{1994, wml.ST_NumberFormatUpperRoman, "MCMXCIV"},
+		{28, wml.ST_NumberFormatUpperLetter, "BB"},
+		{2, wml.ST_NumberFormatChicago, "†"},
+		{6, wml.ST_NumberFormatChicago, "††"},
+		{12, wml.ST_NumberFormatOrdinal, "12th"},
+	}
+	for _, tt := range tests {
+		if got := formatNumber(tt.n, tt.f); got != tt.want {
+			t.Errorf("formatNumber(%d, %v) = %q, want %q", tt.n, tt.f, got, tt.want)
+		}
+	}
+}
+
+func TestNoteNumbering(t *testing.T) {
+	ref := func(id int) string {
+		return fmt.Sprintf(`<w:p><w:r><w:t>x</w:t></w:r><w:r><w:footnoteReference w:id="%d"/></w:r></w:p>`, id)
+	}
+	body := ref(1) + ref(2) +
+		`<w:p><w:pPr><w:sectPr><w:footnotePr><w:numFmt w:val="chicago"/></w:footnotePr></w:sectPr></w:pPr></w:p>` +
+		ref(3) + ref(4) +
+		`<w:sectPr><w:footnotePr><w:numFmt w:val="upperRoman"/><w:numRestart w:val="eachSect"/></w:footnotePr></w:sectPr>`
+	data := minimalPackage(t, body, "", nil)
+	m, err := ParseDocumentModel(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseDocumentModel failed: %v", err)
+	}
+	var marks []string
+	for _, p := range m.Paragraphs {
+		for _, r := range p.Runs {
+			if r.Note != nil {
+				marks = append(marks, r.Note.Mark)
+			}
+		}
+	}
+	if got := strings.Join(marks, ","); got != "*,†,I,II" {
+		t.Errorf("got marks %q, want %q", got, "*,†,I,II")
+	}
+	if out := RenderDocumentHTML(m); !strings.Contains(out, `data-note-id="2">†</sup>`) {
+		t.Errorf("note reference not rendered: %s", out)
+	}
+}
+
+func TestCrossReferences(t *testing.T) {
+	body := `<w:p><w:bookmarkStart w:id="0" w:name="_Ref1"/><w:r><w:t>Section 3.2</w:t></w:r><w:bookmarkEnd w:id="0"/></w:p>
+<w:p><w:r><w:t xml:space="preserve">see </w:t></w:r>
+<w:r><w:fldChar w:fldCharType="begin"/></w:r><w:r><w:instrText xml:space="preserve"> REF _Ref1 \h </w:instrText></w:r>
+<w:r><w:fldChar w:fldCharType="separate"/></w:r><w:r><w:t>Section 3.2</w:t></w:r><w:r><w:fldChar w:fldCharType="end"/></w:r>
+<w:r><w:t xml:space="preserve"> and </w:t></w:r><w:fldSimple w:instr=" PAGEREF _Ref1 "><w:r><w:t>4</w:t></w:r></w:fldSimple></w:p>`
+	data := minimalPackage(t, body, "", nil)
+	m, err := ParseDocumentModel(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseDocumentModel failed: %v", err)
+	}
+	out := RenderDocumentHTML(m)
+	for _, want := range []string{
+		`<a id="_Ref1"></a>`,
+		`<span>Section 3.2</span></a>`,
+		`<a href="#_Ref1"><span>4</span></a>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %s: %s", want, out)
+		}
+	}
+	if strings.Contains(out, "REF") {
+		t.Errorf("field instruction leaked into output: %s", out)
+	}
+}
+
+func TestDropCap(t *testing.T) {
+	body := `<w:p><w:pPr><w:framePr w:dropCap="drop" w:lines="2" w:wrap="around" w:vAnchor="text" w:hAnchor="text"/></w:pPr><w:r><w:t>O</w:t></w:r></w:p>
+<w:p><w:r><w:t>nce upon a time</w:t></w:r></w:p>`
+	data := minimalPackage(t, body, "", nil)
+	m, err := ParseDocumentModel(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseDocumentModel failed: %v", err)
+	}
+	if len(m.Paragraphs) != 1 || m.Paragraphs[0].DropCap == nil || m.Paragraphs[0].DropCap.Lines != 2 {
+		t.Fatalf("drop cap not folded into the following paragraph: %v", m.Paragraphs)
+	}
+	out := RenderDocumentHTML(m)
+	if !strings.Contains(out, `<p><span class="docx-dropcap" style="float:left;font-size:2.2em;line-height:1;margin-right:0.1em;"><span>O</span></span><span>nce upon a time</span></p>`) {
+		t.Errorf("unexpected drop cap rendering: %s", out)
+	}
+}
+
+func TestAltChunks(t *testing.T) {
+	body := `<w:p><w:r><w:t>before</w:t></w:r></w:p><w:altChunk r:id="rId20"/><w:altChunk r:id="rId21"/><w:p><w:r><w:t>after</w:t></w:r></w:p>`
+	rels := `<Relationship Id="rId20" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/aFChunk" Target="chunk1.html"/>
+<Relationship Id="rId21" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/aFChunk" Target="chunk2.rtf"/>`
+	data := minimalPackage(t, body, rels, map[string][]byte{
+		"word/chunk1.html": []byte(`<html><head><title>x</title></head><body><p style="color:red" onclick="evil()">Dear <b>Ann</b> &amp; co</p><script>alert(1)</script></body></html>`),
+		"word/chunk2.rtf":  []byte(`{\rtf1\ansi{\fonttbl{\f0 Arial;}}\f0 Caf\'e9 \b menu\b0\par Line two}`),
+		"[Content_Types].xml": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Default Extension="html" ContentType="text/html"/>
+<Default Extension="rtf" ContentType="application/rtf"/>
+<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>
+</Types>`),
+	})
+	m, err := ParseDocumentModel(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseDocumentModel failed: %v", err)
+	}
+	if len(m.Blocks) != 4 || m.Blocks[1].AltChunk == nil || m.Blocks[2].AltChunk == nil {
+		t.Fatalf("altChunks not placed between paragraphs: %v", m.Blocks)
+	}
+	if got := m.Blocks[1].AltChunk.HTML; got != "<p>Dear <b>Ann</b> &amp; co</p>" {
+		t.Errorf("unexpected sanitised HTML %q", got)
+	}
+	if got := m.Blocks[2].AltChunk.Text; got != "Café menu\nLine two" {
+		t.Errorf("unexpected RTF text %q", got)
+	}
+}
+
+func TestAltChunkNesting(t *testing.T) {
+	types := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Default Extension="docx" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document"/>
+<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>
+</Types>`)
+	rels := `<Relationship Id="rId20" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/aFChunk" Target="chunk.docx"/>`
+	data := minimalPackage(t, `<w:p><w:r><w:t>level 8</w:t></w:r></w:p>`, "", nil)
+	for level := 7; level >= 0; level-- {
+		body := fmt.Sprintf(`<w:p><w:r><w:t>level %d</w:t></w:r></w:p><w:altChunk r:id="rId20"/>`, level)
+		data = minimalPackage(t, body, rels, map[string][]byte{"word/chunk.docx": data, "[Content_Types].xml": types})
+	}
+	m, err := ParseDocumentModel(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseDocumentModel failed: %v", err)
+	}
+	if len(m.Paragraphs) != maxChunkDepth+1 {
+		t.Errorf("imported %d nested documents, want %d", len(m.Paragraphs)-1, maxChunkDepth)
+	}
+	warned := false
+	for _, w := range m.Warnings {
+		warned = warned || strings.Contains(w.Message, "nested too deeply")
+	}
+	if !warned {
+		t.Errorf("no warning for the documents left out: %v", m.Warnings)
+	}
+}
+
+func TestTableCaption(t *testing.T) {
+	body := `<w:tbl><w:tblPr><w:tblCaption w:val="Quarterly revenue"/><w:tblDescription w:val="Revenue by region &amp; quarter"/></w:tblPr>
+<w:tr><w:tc><w:p><w:r><w:t>EMEA</w:t></w:r></w:p></w:tc></w:tr></w:tbl>`
+	data := minimalPackage(t, body, "", nil)
+	m, err := ParseDocumentModel(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseDocumentModel failed: %v", err)
+	}
+	out := RenderDocumentHTML(m)
+	if !strings.Contains(out, `summary="Revenue by region &amp; quarter">`) || !strings.Contains(out, "<caption>Quarterly revenue</caption>") {
+		t.Errorf("caption/summary missing: %s", out)
+	}
+}
+
+func TestRuby(t *testing.T) {
+	body := `<w:p><w:r><w:ruby><w:rubyPr><w:rubyAlign w:val="distributeSpace"/><w:hps w:val="10"/><w:hpsRaise w:val="18"/><w:hpsBaseText w:val="21"/><w:lid w:val="ja-JP"/></w:rubyPr>
+<w:rt><w:r><w:t>かん</w:t></w:r></w:rt><w:rubyBase><w:r><w:t>漢</w:t></w:r></w:rubyBase></w:ruby></w:r></w:p>`
+	data := minimalPackage(t, body, "", nil)
+	m, err := ParseDocumentModel(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseDocumentModel failed: %v", err)
+	}
+	if out := RenderDocumentHTML(m); !strings.Contains(out, "<ruby><span>漢</span><rt><span>かん</span></rt></ruby>") {
+		t.Errorf("ruby not rendered: %s", out)
+	}
+}
+
+func TestFontStack(t *testing.T) {
+	rpr := wml.NewCT_RPr()
+	rpr.RFonts = wml.NewCT_Fonts()
+	ascii, ea := "Calibri", "MS Mincho"
+	rpr.RFonts.AsciiAttr, rpr.RFonts.EastAsiaAttr = &ascii, &ea
+	s := runPropsFromRPr(rpr).runStyle()
+	if got := runStyleToCSS(s, fonts.Substitutes{}); got != "font-family:'Calibri','MS Mincho';" {
+		t.Errorf("latin run: got %q", got)
+	}
+	s.Script = textScript("日本語")
+	if got := runStyleToCSS(s, fonts.Substitutes{}); got != "font-family:'MS Mincho','Calibri';" {
+		t.Errorf("east asian run: got %q", got)
+	}
+	want := "font-family:'MS Mincho','Yu Mincho','Hiragino Mincho ProN','Noto Serif CJK JP','Calibri','Carlito',serif;"
+	if got := runStyleToCSS(s, fonts.Default); got != want {
+		t.Errorf("substituted: got %q, want %q", got, want)
+	}
+}
+
+func TestRevisionInfo(t *testing.T) {
+	body := `<w:p w:rsidR="00A1" w:rsidP="00A1"><w:r w:rsidR="00A1"><w:t>The supplier shall </w:t></w:r>
+<w:ins w:id="1" w:author="Ann" w:date="2024-03-01T10:00:00Z"><w:r w:rsidR="00B2"><w:t>not </w:t></w:r></w:ins>
+<w:r w:rsidR="00A1"><w:t>terminate.</w:t></w:r></w:p>
+<w:p w:rsidR="00B2"><w:r w:rsidR="00B2"><w:t>Added later by the same session.</w:t></w:r></w:p>`
+	data := minimalPackage(t, body, "", nil)
+	m, err := ParseDocumentModel(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseDocumentModel failed: %v", err)
+	}
+	if len(m.Revisions) != 1 || m.Revisions[0].Type != "insert" || m.Revisions[0].Author != "Ann" {
+		t.Fatalf("unexpected revisions: %v", m.Revisions)
+	}
+	first := m.Paragraphs[0].Revision
+	if first == nil || first.Author != "Ann" || len(first.Revisions) != 1 {
+		t.Errorf("unexpected first paragraph revision info: %v", first)
+	}
+	second := m.Paragraphs[1].Revision
+	if second == nil || second.Author != "Ann" || second.Date.Year() != 2024 {
+		t.Errorf("rsid not attributed: %v", second)
+	}
+}
+
+func TestTrackedChanges(t *testing.T) {
+	body := `<w:p><w:r><w:t xml:space="preserve">The supplier </w:t></w:r>
+<w:del w:id="1" w:author="Bob" w:date="2024-03-02T09:30:00Z"><w:r><w:delText>may</w:delText></w:r></w:del>
+<w:ins w:id="2" w:author="Ann" w:date="2024-03-01T10:00:00Z"><w:r><w:t>shall</w:t></w:r></w:ins>
+<w:r><w:rPr><w:b/><w:rPrChange w:id="3" w:author="Ann"><w:rPr/></w:rPrChange></w:rPr><w:t xml:space="preserve"> pay</w:t></w:r></w:p>`
+	data := minimalPackage(t, body, "", nil)
+	m, err := ParseDocumentModel(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseDocumentModel failed: %v", err)
+	}
+	runs := m.Paragraphs[0].Runs
+	if len(runs) != 4 || runs[1].Change != "delete" || runs[1].Text != "may" || runs[2].Change != "insert" || runs[2].Revision.Author != "Ann" {
+		t.Fatalf("unexpected runs: %v", runs)
+	}
+	if runs[3].FormatChange == nil || runs[3].OriginalStyle == nil || runs[3].OriginalStyle.Bold {
+		t.Errorf("format change not parsed: %+v", runs[3])
+	}
+	render := func(mode RevisionsMode) string {
+		var b strings.Builder
+		_ = RenderDocumentHTMLTo(&b, m, RenderOptions{Revisions: mode})
+		return b.String()
+	}
+	if out := render(RevisionsAccept); !strings.Contains(out, "shall") || strings.Contains(out, "may") || strings.Contains(out, "<ins") {
+		t.Errorf("accepted output wrong: %s", out)
+	}
+	if out := render(RevisionsReject); strings.Contains(out, "shall") || !strings.Contains(out, "may") || strings.Contains(out, "font-weight:bold") {
+		t.Errorf("rejected output wrong: %s", out)
+	}
+	out := render(RevisionsShow)
+	for _, want := range []string{
+		`<del class="docx-del" style="color:#b5082e;" title="Deleted by Bob (2024-03-02 09:30)" datetime="2024-03-02T09:30:00Z"><span>may</span></del>`,
+		`<ins class="docx-ins" style="color:#1f4fd1;" title="Inserted by Ann (2024-03-01 10:00)" datetime="2024-03-01T10:00:00Z"><span>shall</span></ins>`,
+		`class="docx-format-change" style="border-bottom:1px dotted #1f4fd1;" title="Formatted by Ann"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("shown output lacks %s: %s", want, out)
+		}
+	}
+	if text := DocumentText(m); !strings.Contains(text, "The supplier shall pay") {
+		t.Errorf("text not accepted: %q", text)
+	}
+	ApplyRevisions(&m, RevisionsReject)
+	if runs := m.Paragraphs[0].Runs; len(runs) != 3 || runs[1].Text != "may" || runs[1].Revision != nil || runs[2].Style.Bold {
+		t.Errorf("revisions not rejected: %v", runs)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, os.ErrClosed }
+
+func TestRenderDocumentHTMLTo(t *testing.T) {
+	m := DocumentModel{Blocks: []DocumentBlock{
+		{Paragraph: &RenderParagraph{Runs: []RenderRun{{Text: "one"}}}},
+		{Paragraph: &RenderParagraph{Runs: []RenderRun{{Text: "two"}}}},
+	}}
+	var buf bytes.Buffer
+	if err := RenderDocumentHTMLTo(&buf, m, RenderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != RenderDocumentHTML(m) {
+		t.Errorf("streamed output differs: %q", buf.String())
+	}
+	if err := RenderDocumentHTMLTo(failingWriter{}, m, RenderOptions{}); err != os.ErrClosed {
+		t.Errorf("got error %v, want %v", err, os.ErrClosed)
+	}
+}
+
+func TestStandaloneOutput(t *testing.T) {
+	m := DocumentModel{Blocks: []DocumentBlock{{Paragraph: &RenderParagraph{Runs: []RenderRun{{Text: "hi"}}}}}}
+	if out := RenderDocumentHTML(m); strings.Contains(out, "<body") {
+		t.Errorf("fragment output contains a document wrapper: %s", out)
+	}
+	var buf bytes.Buffer
+	if err := RenderDocumentHTMLTo(&buf, m, RenderOptions{Standalone: true}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, "<!DOCTYPE html>") || !strings.Contains(out, DocumentCSS()) || !strings.Contains(out, "<body>\n<p><span>hi</span></p>\n</body>") {
+		t.Errorf("unexpected standalone output: %s", out)
+	}
+}
+
+func TestStandaloneHead(t *testing.T) {
+	data := minimalPackage(t, `<w:p><w:r><w:t>x</w:t></w:r></w:p>`, "", map[string][]byte{
+		"docProps/core.xml": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:title>Q3 &lt;Report&gt;</dc:title><dc:creator>Ann Lee</dc:creator><dc:description>Quarterly numbers</dc:description><dc:language>en-GB</dc:language>
+</cp:coreProperties>`),
+	})
+	m, err := ParseDocumentModel(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseDocumentModel failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := RenderDocumentHTMLTo(&buf, m, RenderOptions{Standalone: true}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{`<html lang="en-GB">`, "<title>Q3 &lt;Report&gt;</title>", `<meta name="author" content="Ann Lee">`, `<meta name="description" content="Quarterly numbers">`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("head missing %s: %s", want, out)
+		}
+	}
+}
+
+func TestNestedLists(t *testing.T) {
+	item := func(text, typ string, level, id, n int) DocumentBlock {
+		return DocumentBlock{Paragraph: &RenderParagraph{
+			Style: ParagraphStyle{ListType: typ, ListLevel: level, ListID: id, ListNumber: n},
+			Runs:  []RenderRun{{Text: text}},
+		}}
+	}
+	m := DocumentModel{Blocks: []DocumentBlock{
+		item("a", "ordered", 0, 1, 1),
+		item("a.i", "unordered", 1, 1, 0),
+		item("a.ii", "unordered", 1, 1, 0),
+		item("b", "ordered", 0, 1, 2),
+		item("b.x.y", "ordered", 2, 1, 1),
+		{Paragraph: &RenderParagraph{Runs: []RenderRun{{Text: "p"}}}},
+		item("c", "ordered", 0, 2, 5),
+	}}
+	got := RenderDocumentHTML(m)
+	want := "<ol>\n<li><span>a</span><ul>\n<li><span>a.i</span></li>\n<li><span>a.ii</span></li>\n</ul>\n</li>\n" +
+		"<li><span>b</span><ul>\n<li style=\"list-style-type:none;\"><ol>\n<li><span>b.x.y</span></li>\n</ol>\n</li>\n</ul>\n</li>\n</ol>\n" +
+		"<p><span>p</span></p>\n" +
+		"<ol start=\"5\">\n<li><span>c</span></li>\n</ol>\n"
+	if got != want {
+		t.Errorf("unexpected list HTML:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestPictures(t *testing.T) {
+	graphic := `<a:graphic xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main"><a:graphicData uri="http://schemas.openxmlformats.org/drawingml/2006/picture">
+<pic:pic xmlns:pic="http://schemas.openxmlformats.org/drawingml/2006/picture"><pic:nvPicPr><pic:cNvPr id="1" name="shot.png"/><pic:cNvPicPr/></pic:nvPicPr>
+<pic:blipFill><a:blip r:embed="rId40"/></pic:blipFill><pic:spPr/></pic:pic></a:graphicData></a:graphic>`
+	const wp = `xmlns:wp="http://schemas.openxmlformats.org/drawingml/2006/wordprocessingDrawing"`
+	body := `<w:p><w:r><w:drawing><wp:inline ` + wp + `><wp:extent cx="1270000" cy="635000"/><wp:docPr id="1" name="Picture 1" descr="Login page"/>` + graphic + `</wp:inline></w:drawing></w:r>
+<w:r><w:drawing><wp:anchor ` + wp + ` simplePos="0" relativeHeight="0" behindDoc="0" locked="0" layoutInCell="1" allowOverlap="1"><wp:simplePos x="0" y="0"/>
+<wp:positionH relativeFrom="column"><wp:align>right</wp:align></wp:positionH><wp:positionV relativeFrom="paragraph"><wp:posOffset>0</wp:posOffset></wp:positionV>
+<wp:extent cx="254000" cy="254000"/><wp:wrapSquare wrapText="bothSides"/><wp:docPr id="2" name="Logo"/>` + graphic + `</wp:anchor></w:drawing></w:r></w:p>`
+	rels := `<Relationship Id="rId40" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/image" Target="media/image1.png"/>`
+	data := minimalPackage(t, body, rels, map[string][]byte{"word/media/image1.png": []byte("\x89PNG")})
+	m, err := ParseDocumentModel(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var images []Image
+	for _, r := range m.Paragraphs[0].Runs {
+		if r.Image != nil {
+			images = append(images, *r.Image)
+		}
+	}
+	want := []Image{
+		{PartName: "word/media/image1.png", ContentType: "image/png", Data: []byte("\x89PNG"), WidthPt: 100, HeightPt: 50, AltText: "Login page", Title: "Picture 1"},
+		{PartName: "word/media/image1.png", ContentType: "image/png", Data: []byte("\x89PNG"), WidthPt: 20, HeightPt: 20, Title: "Logo", Anchored: true, Align: "right"},
+	}
+	if !reflect.DeepEqual(images, want) {
+		t.Fatalf("images = %+v, want %+v", images, want)
+	}
+
+	var (
+		names []string
+		buf   strings.Builder
+	)
+	err = RenderDocumentHTMLTo(&buf, m, RenderOptions{ImageHandler: func(img media.Image) (string, error) {
+		names = append(names, img.Name)
+		return "img/" + path.Base(img.Name), nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{`<img src="img/image1.png" alt="Login page" class="docx-image" style="width:100pt;height:50pt;">`, "float:right;"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %s:\n%s", want, out)
+		}
+	}
+	if len(names) != 2 {
+		t.Errorf("handler called for %q", names)
+	}
+	buf.Reset()
+	if err := RenderDocumentHTMLTo(&buf, m, RenderOptions{RedactImages: true}); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); strings.Contains(out, "<img") || !strings.Contains(out, "[Login page]") {
+		t.Errorf("pictures not redacted:\n%s", out)
+	}
+}
+
+func TestImageHandler(t *testing.T) {
+	m := DocumentModel{Paragraphs: []RenderParagraph{{Runs: []RenderRun{{Object: &EmbeddedObject{
+		Type: "Excel worksheet", Preview: []byte("\x89PNG"), PreviewType: "image/png", PreviewPart: "word/media/image1.png",
+	}}}}}}
+	var got media.Image
+	var buf bytes.Buffer
+	err := RenderDocumentHTMLTo(&buf, m, RenderOptions{ImageHandler: func(img media.Image) (string, error) {
+		got = img
+		return "https://cdn.example/a.png?x=1&y=2", nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "word/media/image1.png" || got.ContentType != "image/png" {
+		t.Errorf("unexpected image passed to handler: %+v", got)
+	}
+	if !strings.Contains(buf.String(), `<img src="https://cdn.example/a.png?x=1&amp;y=2"`) {
+		t.Errorf("handler src not used: %s", buf.String())
+	}
+
+	failed := errors.New("upload failed")
+	err = RenderDocumentHTMLTo(io.Discard, m, RenderOptions{ImageHandler: func(media.Image) (string, error) {
+		return "", failed
+	}})
+	if !errors.Is(err, failed) {
+		t.Errorf("got error %v, want %v", err, failed)
+	}
+}
+
+func TestNotesSection(t *testing.T) {
+	body := `<w:p><w:r><w:t>a</w:t></w:r><w:r><w:footnoteReference w:id="1"/></w:r></w:p>
+<w:p><w:pPr><w:sectPr/></w:pPr><w:r><w:t>b</w:t></w:r><w:r><w:endnoteReference w:id="1"/></w:r></w:p>
+<w:p><w:r><w:t>c</w:t></w:r><w:r><w:footnoteReference w:id="2"/></w:r></w:p>`
+	rels := `<Relationship Id="rId20" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/footnotes" Target="footnotes.xml"/>
+<Relationship Id="rId21" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/endnotes" Target="endnotes.xml"/>`
+	const ns = `xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"`
+	data := minimalPackage(t, body, rels, map[string][]byte{
+		"word/footnotes.xml": []byte(`<w:footnotes ` + ns + `>
+<w:footnote w:type="separator" w:id="-1"><w:p><w:r><w:separator/></w:r></w:p></w:footnote>
+<w:footnote w:id="1"><w:p><w:r><w:footnoteRef/></w:r><w:r><w:t>First note.</w:t></w:r></w:p></w:footnote>
+<w:footnote w:id="2"><w:p><w:r><w:t>Second note.</w:t></w:r></w:p></w:footnote>
+</w:footnotes>`),
+		"word/endnotes.xml": []byte(`<w:endnotes ` + ns + `><w:endnote w:id="1"><w:p><w:r><w:t>End note.</w:t></w:r></w:p></w:endnote></w:endnotes>`),
+	})
+	m, err := ParseDocumentModel(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseDocumentModel failed: %v", err)
+	}
+	if len(m.Notes) != 3 || m.Notes[0].Kind != noteFootnote || m.Notes[1].Section != 1 || m.Notes[2].Kind != noteEndnote {
+		t.Fatalf("unexpected notes: %v", m.Notes)
+	}
+	out := RenderDocumentHTML(m)
+	for _, want := range []string{
+		`<sup class="docx-noteref" data-note="footnote" data-note-id="1"><a id="docx-footnote-ref-1" href="#docx-footnote-1">1</a></sup>`,
+		`<li id="docx-footnote-1"><a class="docx-noteback" href="#docx-footnote-ref-1">1</a>`,
+		"<span>First note.</span></p>\n</li>",
+		`<li id="docx-endnote-1"><a class="docx-noteback" href="#docx-endnote-ref-1">i</a>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %s:\n%s", want, out)
+		}
+	}
+	if strings.Index(out, "docx-footnotes") < strings.Index(out, "<span>c</span>") || strings.Index(out, "docx-endnotes") < strings.Index(out, "docx-footnotes") {
+		t.Errorf("notes not placed after the body: %s", out)
+	}
+
+	var buf bytes.Buffer
+	if err := RenderDocumentHTMLTo(&buf, m, RenderOptions{FootnotesPerSection: true}); err != nil {
+		t.Fatal(err)
+	}
+	out = buf.String()
+	first, second := strings.Index(out, `id="docx-footnote-1"`), strings.Index(out, `id="docx-footnote-2"`)
+	if first < 0 || first > strings.Index(out, "<span>c</span>") || second < strings.Index(out, "<span>c</span>") {
+		t.Errorf("footnotes not placed per section: %s", out)
+	}
+}
+
+func TestStreamDocumentHTML(t *testing.T) {
+	body := `<w:p><w:pPr><w:numPr><w:ilvl w:val="0"/><w:numId w:val="1"/></w:numPr></w:pPr><w:r><w:t>one</w:t></w:r></w:p>
+<w:p><w:pPr><w:numPr><w:ilvl w:val="0"/><w:numId w:val="1"/></w:numPr></w:pPr><w:r><w:t>two</w:t></w:r></w:p>
+<w:p><w:r><w:t>a</w:t></w:r><w:r><w:footnoteReference w:id="1"/></w:r></w:p>
+<w:tbl><w:tr><w:tc><w:p><w:r><w:t>cell</w:t></w:r></w:p></w:tc></w:tr></w:tbl>`
+	rels := `<Relationship Id="rId20" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/footnotes" Target="footnotes.xml"/>`
+	data := minimalPackage(t, body, rels, map[string][]byte{
+		"word/footnotes.xml": []byte(`<w:footnotes xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:footnote w:id="1"><w:p><w:r><w:t>Note.</w:t></w:r></w:p></w:footnote>
+<w:footnote w:id="2"><w:p><w:r><w:t>Unused.</w:t></w:r></w:p></w:footnote>
+</w:footnotes>`),
+	})
+	m, err := ParseDocumentModel(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := RenderOptions{Standalone: true, Accessible: true}
+	var want, got bytes.Buffer
+	if err := RenderDocumentHTMLTo(&want, m, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := StreamDocumentHTML(&got, bytes.NewReader(data), int64(len(data)), opts); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("streamed output differs:\n%s\nwant:\n%s", got.String(), want.String())
+	}
+
+	var n int
+	sm, err := ParseDocumentBlocks(bytes.NewReader(data), int64(len(data)), func(DocumentBlock) error {
+		n++
+		return nil
+	})
+	if err != nil || n != len(m.Blocks) || len(sm.Blocks) != 0 || len(sm.Notes) != 1 {
+		t.Errorf("ParseDocumentBlocks: err %v, %d blocks, model %d blocks, %d notes", err, n, len(sm.Blocks), len(sm.Notes))
+	}
+	stop := errors.New("stop")
+	n = 0
+	_, err = ParseDocumentBlocks(bytes.NewReader(data), int64(len(data)), func(DocumentBlock) error {
+		n++
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Errorf("callback error not returned: %v after %d blocks", err, n)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	body := `<w:p><w:r><w:t>Call 555-0100</w:t></w:r><w:r><w:footnoteReference w:id="1"/></w:r></w:p>
+<w:tbl><w:tr><w:tc><w:p><w:r><w:t>555-0199</w:t></w:r></w:p></w:tc></w:tr></w:tbl>`
+	rels := `<Relationship Id="rId20" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/footnotes" Target="footnotes.xml"/>`
+	data := minimalPackage(t, body, rels, map[string][]byte{
+		"word/footnotes.xml": []byte(`<w:footnotes xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:footnote w:id="1"><w:p><w:r><w:t>Or 555-0142.</w:t></w:r></w:p></w:footnote>
+</w:footnotes>`),
+	})
+	m, err := ParseDocumentModel(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Walk(&m, Visitor{
+		Table: func(*RenderTable) error { return SkipChildren },
+		Run: func(r *RenderRun) error {
+			r.Text = strings.ReplaceAll(r.Text, "555-", "XXX-")
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := RenderDocumentHTML(m)
+	for _, want := range []string{"Call XXX-0100", "Or XXX-0142.", "555-0199"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if m.Paragraphs[0].Runs[0].Text != "Call XXX-0100" {
+		t.Errorf("Paragraphs not refreshed: %v", m.Paragraphs[0])
+	}
+
+	stop := errors.New("stop")
+	if err := Walk(&m, Visitor{Paragraph: func(*RenderParagraph) error { return stop }}); err != stop {
+		t.Errorf("Walk error = %v, want %v", err, stop)
+	}
+}
+
+func TestStyleClasses(t *testing.T) {
+	body := `<w:p><w:pPr><w:pStyle w:val="Quote"/></w:pPr><w:r><w:t>q</w:t></w:r></w:p>
+<w:p><w:pPr><w:pStyle w:val="My Style"/></w:pPr><w:r><w:t>c</w:t></w:r></w:p>
+<w:p><w:r><w:t>plain</w:t></w:r></w:p>`
+	rels := `<Relationship Id="rId30" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`
+	data := minimalPackage(t, body, rels, map[string][]byte{
+		"word/styles.xml": []byte(`<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:style w:type="paragraph" w:styleId="Quote"><w:name w:val="Quote"/></w:style>
+<w:style w:type="paragraph" w:styleId="My Style"><w:name w:val="Client Note"/></w:style>
+</w:styles>`),
+	})
+	m, err := ParseDocumentModel(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	classes := StyleClasses(m)
+	if len(classes) != 2 || classes["Quote"] != "docx-style-Quote" || classes["Client Note"] != "docx-style-My-Style" {
+		t.Errorf("unexpected classes: %v", classes)
+	}
+	out := RenderDocumentHTML(m)
+	for _, want := range []string{`<p class="docx-style-Quote">`, `<p class="docx-style-My-Style">`, "<p><span>plain"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %s:\n%s", want, out)
+		}
+	}
+}
+
+func TestSourceMap(t *testing.T) {
+	body := `<w:p><w:r><w:t>a</w:t></w:r><w:hyperlink w:anchor="x"><w:r><w:t>b</w:t></w:r></w:hyperlink><w:r><w:footnoteReference w:id="1"/></w:r></w:p>
+<w:tbl><w:tr><w:tc><w:tbl><w:tr><w:tc><w:p><w:r><w:t>nested</w:t></w:r></w:p></w:tc></w:tr></w:tbl><w:p/></w:tc>
+<w:tc><w:p><w:r><w:t>c</w:t></w:r></w:p></w:tc></w:tr></w:tbl>
+<w:p><w:r><w:t>d</w:t></w:r></w:p>`
+	rels := `<Relationship Id="rId20" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/footnotes" Target="footnotes.xml"/>`
+	data := minimalPackage(t, body, rels, map[string][]byte{
+		"word/footnotes.xml": []byte(`<w:footnotes xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:footnote w:id="1"><w:p><w:r><w:t>n</w:t></w:r></w:p></w:footnote>
+</w:footnotes>`),
+	})
+	m, err := ParseDocumentModel(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := RenderDocumentHTMLTo(&buf, m, RenderOptions{SourceMap: true}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`<p data-src="p0"><span data-src="p0/r0">a</span>`,
+		`data-src="p0/r1">b</span>`,
+		`<table style="border-collapse:collapse;" data-src="tbl0">`,
+		`data-src="tbl0/tr0/tc1"`,
+		`<p data-src="p3"><span data-src="p3/r0">c</span>`,
+		`<p data-src="p4"><span data-src="p4/r0">d</span>`,
+		`<p data-src="footnote1/p0"><span data-src="footnote1/p0/r0">n</span>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %s:\n%s", want, out)
+		}
+	}
+	if strings.Contains(RenderDocumentHTML(m), "data-src") {
+		t.Error("data-src emitted without SourceMap")
+	}
+}
+
+func TestBreakCharacters(t *testing.T) {
+	body := `<w:p><w:r><w:t>Hyper</w:t><w:softHyphen/><w:t>text e</w:t><w:noBreakHyphen/><w:t>mail</w:t><w:t xml:space="preserve">10` + "\u00a0" + `kg</w:t></w:r></w:p>`
+	data := minimalPackage(t, body, "", nil)
+	m, err := ParseDocumentModel(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "<span>Hyper&shy;text e&#8209;mail10&nbsp;kg</span>"
+	if out := RenderDocumentHTML(m); !strings.Contains(out, want) {
+		t.Errorf("output missing %s:\n%s", want, out)
+	}
+	if got := headingSlug("Hyper\u00adtext"); got != "hypertext" {
+		t.Errorf("headingSlug kept the soft hyphen: %q", got)
+	}
+}
+
+func TestPageLayout(t *testing.T) {
+	long := `<w:p><w:r><w:t>` + strings.Repeat("lorem ipsum ", 400) + `</w:t></w:r></w:p>`
+	body := `<w:p><w:r><w:t>one</w:t></w:r><w:r><w:br w:type="page"/></w:r></w:p>` +
+		`<w:p><w:r><w:t>two</w:t></w:r></w:p>` + long + long +
+		`<w:p><w:pPr><w:sectPr><w:pgSz w:w="16838" w:h="11906" w:orient="landscape"/><w:pgMar w:top="720" w:right="720" w:bottom="720" w:left="720"/></w:sectPr></w:pPr></w:p>` +
+		`<w:p><w:r><w:t>three</w:t></w:r></w:p><w:sectPr/>`
+	data := minimalPackage(t, body, "", nil)
+	m, err := ParseDocumentModel(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseDocumentModel failed: %v", err)
+	}
+	if len(m.Sections) != 2 || m.Sections[0].PageWidthPt != 841.9 || !m.Sections[0].Landscape || m.Sections[0].MarginLeftPt != 36 || m.Sections[1].PageWidthPt != 612 {
+		t.Fatalf("unexpected sections: %v", m.Sections)
+	}
+	var buf bytes.Buffer
+	if err := RenderDocumentHTMLTo(&buf, m, RenderOptions{PageLayout: true}); err != nil {
+		t.Fatal(err)
+	}
+	pages := strings.Split(buf.String(), `<div class="docx-page"`)[1:]
+	// "one" | "two" + long | long + section break | "three"
+	if len(pages) != 4 {
+		t.Fatalf("got %d pages, want 4:\n%s", len(pages), buf.String())
+	}
+	if !strings.Contains(pages[0], "one") || !strings.Contains(pages[1], "two") || !strings.Contains(pages[3], "three") {
+		t.Errorf("unexpected page contents:\n%s", buf.String())
+	}
+	if !strings.Contains(pages[0], "width:841.9pt;min-height:595.3pt;padding:36.0pt") || !strings.Contains(pages[3], "width:612.0pt;min-height:792.0pt;") {
+		t.Errorf("unexpected page geometry:\n%s", buf.String())
+	}
+	if strings.Contains(buf.String(), "overflow:hidden") {
+		t.Errorf("pages clip their content:\n%s", buf.String())
+	}
+}
+
+func TestPageNumberFields(t *testing.T) {
+	const rel = `http://schemas.openxmlformats.org/officeDocument/2006/relationships/`
+	body := `<w:p><w:r><w:t>one</w:t></w:r></w:p>
+<w:p><w:pPr><w:pageBreakBefore/></w:pPr><w:r><w:t>two</w:t></w:r></w:p>
+<w:p><w:pPr><w:sectPr><w:headerReference w:type="default" r:id="rId40"/><w:footerReference w:type="default" r:id="rId41"/><w:titlePg/></w:sectPr></w:pPr></w:p>
+<w:p><w:r><w:t>three</w:t></w:r><w:fldSimple w:instr="PAGE"><w:r><w:t>1</w:t></w:r><w:r><w:t>2</w:t></w:r></w:fldSimple></w:p>
+<w:sectPr><w:pgNumType w:start="1"/></w:sectPr>`
+	rels := `<Relationship Id="rId40" Type="` + rel + `header" Target="header1.xml"/>
+<Relationship Id="rId41" Type="` + rel + `footer" Target="footer1.xml"/>`
+	const ns = `xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"`
+	data := minimalPackage(t, body, rels, map[string][]byte{
+		"word/header1.xml": []byte(`<w:hdr ` + ns + `><w:p><w:r><w:t>Page </w:t></w:r><w:r><w:fldChar w:fldCharType="begin"/></w:r>
+<w:r><w:instrText> PAGE </w:instrText></w:r><w:r><w:fldChar w:fldCharType="separate"/></w:r><w:r><w:t>9</w:t></w:r><w:r><w:fldChar w:fldCharType="end"/></w:r></w:p></w:hdr>`),
+		"word/footer1.xml": []byte(`<w:ftr ` + ns + `><w:p><w:r><w:t>of </w:t></w:r><w:fldSimple w:instr="NUMPAGES"><w:r><w:t>9</w:t></w:r></w:fldSimple></w:p></w:ftr>`),
+	})
+	m, err := ParseDocumentModel(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Sections) != 2 || !m.Sections[0].TitlePage || len(m.Sections[1].Header) != 1 || m.Sections[1].PageStart != 1 {
+		t.Fatalf("unexpected sections: %v", m.Sections)
+	}
+	fields := 0
+	for _, b := range m.Blocks {
+		if b.Paragraph != nil {
+			for _, r := range b.Paragraph.Runs {
+				if r.Field == "PAGE" {
+					fields++
+				}
+			}
+		}
+	}
+	if fields != 1 {
+		t.Errorf("%d runs carry the simple PAGE field, want 1", fields)
+	}
+	var buf bytes.Buffer
+	if err := RenderDocumentHTMLTo(&buf, m, RenderOptions{PageLayout: true}); err != nil {
+		t.Fatal(err)
+	}
+	pages := strings.Split(buf.String(), `<div class="docx-page"`)[1:]
+	if len(pages) != 3 {
+		t.Fatalf("got %d pages, want 3:\n%s", len(pages), buf.String())
+	}
+	// The first page has no first-page header; the third restarts numbering.
+	if strings.Contains(pages[0], "docx-header") || strings.Contains(buf.String(), ">9<") ||
+		!strings.Contains(pages[1], "<span>2</span>") || !strings.Contains(pages[1], "<span>of </span><span>3</span>") ||
+		!strings.Contains(pages[2], "<span>1</span>") {
+		t.Errorf("unexpected headers and footers:\n%s", buf.String())
+	}
+	if strings.Contains(RenderDocumentHTML(m), "docx-header") {
+		t.Error("header rendered outside page layout")
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	m := DocumentModel{Blocks: []DocumentBlock{
+		{Paragraph: &RenderParagraph{Style: ParagraphStyle{HeadingLevel: 1, Alignment: "center"}, Runs: []RenderRun{{Text: "Report <draft>", Style: RunStyle{FontSizePt: 20}}}}},
+		{Paragraph: &RenderParagraph{Runs: []RenderRun{{Text: strings.Repeat("word ", 5000)}}}},
+		{Paragraph: &RenderParagraph{Runs: []RenderRun{{Text: "second page"}}}},
+	}}
+	var got []byte
+	png, err := ThumbnailPNG(m, 200, 260, func(svg []byte, w, h int) ([]byte, error) {
+		got = svg
+		return []byte("png"), nil
+	})
+	if err != nil || string(png) != "png" {
+		t.Fatalf("ThumbnailPNG = %q, %v", png, err)
+	}
+	svg := string(got)
+	if err := xml.Unmarshal(got, new(struct{})); err != nil {
+		t.Fatalf("thumbnail is not well-formed: %v\n%s", err, svg)
+	}
+	for _, want := range []string{
+		`width="200" height="260" viewBox="0 0 612.0 792.0"`,
+		`font-size="20.0" fill="#000" font-weight="bold" text-anchor="middle">Report &lt;draft&gt;</text>`,
+		">word word",
+	} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("thumbnail missing %s:\n%s", want, svg)
+		}
+	}
+	if strings.Contains(svg, "second page") {
+		t.Error("thumbnail drew past the first page")
+	}
+}
+
+func TestHeadingAnchors(t *testing.T) {
+	heading := func(level int, text string) DocumentBlock {
+		return DocumentBlock{Paragraph: &RenderParagraph{Style: ParagraphStyle{HeadingLevel: level}, Runs: []RenderRun{{Text: text}}}}
+	}
+	m := DocumentModel{Blocks: []DocumentBlock{
+		heading(1, "1. Scope"),
+		heading(2, "Access Control"),
+		{Paragraph: &RenderParagraph{Runs: []RenderRun{{Text: "body"}}}},
+		heading(3, "Access  Control"),
+		heading(1, "Définitions & <Terms>"),
+	}}
+	var buf bytes.Buffer
+	if err := RenderDocumentHTMLTo(&buf, m, RenderOptions{TableOfContents: true}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	wantTOC := "<nav class=\"docx-toc\">\n<ul>\n<li><a href=\"#1-scope\">1. Scope</a><ul>\n<li><a href=\"#access-control\">Access Control</a><ul>\n" +
+		"<li><a href=\"#access-control-2\">Access Control</a></li>\n</ul>\n</li>\n</ul>\n</li>\n" +
+		"<li><a href=\"#définitions-terms\">Définitions &amp; &lt;Terms&gt;</a></li>\n</ul>\n</nav>\n"
+	if !strings.HasPrefix(out, wantTOC) {
+		t.Errorf("unexpected TOC:\n%s\nwant prefix:\n%s", out, wantTOC)
+	}
+	for _, want := range []string{`<h1 id="1-scope">`, `<h2 id="access-control">`, `<h3 id="access-control-2">`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %s", want)
+		}
+	}
+	if plain := RenderDocumentHTML(m); strings.Contains(plain, "docx-toc") || !strings.Contains(plain, `<h1 id="1-scope">`) {
+		t.Errorf("default output should have anchors but no TOC: %s", plain)
+	}
+}
+
+func TestSemanticTags(t *testing.T) {
+	m := DocumentModel{Paragraphs: []RenderParagraph{{Runs: []RenderRun{
+		{Text: "plain "},
+		{Text: "bold", Style: RunStyle{Bold: true, Italic: true, FontColor: "FF0000"}},
+		{Text: "2", Style: RunStyle{VerticalAlign: "superscript", Strike: true}},
+	}}}}
+	var buf bytes.Buffer
+	if err := RenderDocumentHTMLTo(&buf, m, RenderOptions{SemanticTags: true}); err != nil {
+		t.Fatal(err)
+	}
+	want := `<p>plain <span style="color:#FF0000;"><strong><em>bold</em></strong></span><s><sup>2</sup></s></p>` + "\n"
+	if buf.String() != want {
+		t.Errorf("got %s, want %s", buf.String(), want)
+	}
+}
+
+func TestAccessibleOutput(t *testing.T) {
+	heading := func(level int, text string) DocumentBlock {
+		return DocumentBlock{Paragraph: &RenderParagraph{Style: ParagraphStyle{HeadingLevel: level}, Runs: []RenderRun{{Text: text}}}}
+	}
+	cell := func(text string) RenderTableCell {
+		return RenderTableCell{ColSpan: 1, RowSpan: 1, Paragraphs: []RenderParagraph{{Runs: []RenderRun{{Text: text}}}}}
+	}
+	m := DocumentModel{Blocks: []DocumentBlock{
+		heading(2, "Policy"),
+		heading(4, "Scope"),
+		heading(3, "Terms"),
+		{Table: &RenderTable{Rows: []RenderTableRow{
+			{Cells: []RenderTableCell{cell("Name"), cell("Value")}},
+			{Cells: []RenderTableCell{cell("a"), cell("1")}},
+		}}},
+	}}
+	var buf bytes.Buffer
+	if err := RenderDocumentHTMLTo(&buf, m, RenderOptions{Accessible: true, Standalone: true}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{`<html lang="en">`, `<title>Policy</title>`, `<h1 id="policy">`, `<h2 id="scope">`, `<h2 id="terms">`, `<th scope="col" style=`, `<td style=`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %s:\n%s", want, out)
+		}
+	}
+	if strings.Count(out, "<th ") != 2 {
+		t.Errorf("want only the first row as header:\n%s", out)
+	}
+	if out := RenderDocumentHTML(m); strings.Contains(out, "<th") || !strings.Contains(out, "<h4") {
+		t.Errorf("default output should be unchanged:\n%s", out)
+	}
+}
+
+func TestCommentPlacement(t *testing.T) {
+	body := `<w:p><w:r><w:t xml:space="preserve">before </w:t></w:r><w:commentRangeStart w:id="7"/><w:r><w:t>commented</w:t></w:r><w:commentRangeEnd w:id="7"/>` +
+		`<w:r><w:commentReference w:id="7"/></w:r><w:r><w:t xml:space="preserve"> after</w:t></w:r></w:p>`
+	rels := `<Relationship Id="rId30" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/comments" Target="comments.xml"/>`
+	data := minimalPackage(t, body, rels, map[string][]byte{
+		"word/comments.xml": []byte(`<w:comments xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:comment w:id="7" w:author="Jane Doe" w:initials="JD" w:date="2024-03-01T10:30:00Z"><w:p><w:r><w:t>Check "this"</w:t></w:r></w:p></w:comment>
+</w:comments>`),
+	})
+	m, err := ParseDocumentModel(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseDocumentModel failed: %v", err)
+	}
+	if len(m.Comments) != 1 || m.Comments[0].Author != "Jane Doe" || m.Comments[0].Date.Year() != 2024 {
+		t.Fatalf("unexpected comments: %v", m.Comments)
+	}
+	runs := m.Paragraphs[0].Runs
+	if len(runs[0].Comments) != 0 || len(runs[1].Comments) != 1 || runs[2].CommentRef == nil || len(runs[3].Comments) != 0 {
+		t.Fatalf("unexpected comment markers: %v", runs)
+	}
+
+	if out := RenderDocumentHTML(m); strings.Contains(out, "docx-comment") || strings.Contains(out, "Check") {
+		t.Errorf("comments should be stripped by default: %s", out)
+	}
+	render := func(mode CommentMode) string {
+		var buf bytes.Buffer
+		if err := RenderDocumentHTMLTo(&buf, m, RenderOptions{Comments: mode}); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	inline := render(CommentsInline)
+	if !strings.Contains(inline, `<mark class="docx-comment" data-comment-ids="7" title="Jane Doe (2024-03-01 10:30): Check &#34;this&#34;"><span>commented</span></mark>`) ||
+		!strings.Contains(inline, `<sup class="docx-comment-ref" data-comment-id="7" title="Jane Doe (2024-03-01 10:30): Check &#34;this&#34;">[JD1]</sup>`) {
+		t.Errorf("unexpected inline comments: %s", inline)
+	}
+	margin := render(CommentsMargin)
+	for _, want := range []string{
+		`<mark class="docx-comment" data-comment-ids="7"><span>commented</span></mark>`,
+		`<a id="docx-comment-ref-7" href="#docx-comment-7">[JD1]</a>`,
+		`<aside class="docx-comments">`,
+		`<div class="docx-comment" id="docx-comment-7" data-comment-id="7">`,
+		`<time datetime="2024-03-01T10:30:00Z">2024-03-01 10:30</time>`,
+		`<span>Check &#34;this&#34;</span>`,
+	} {
+		if !strings.Contains(margin, want) {
+			t.Errorf("margin output missing %s:\n%s", want, margin)
+		}
+	}
+}
+
+func TestExternalCSS(t *testing.T) {
+	red := RunStyle{FontColor: "FF0000", Bold: true}
+	m := DocumentModel{Paragraphs: []RenderParagraph{
+		{Style: ParagraphStyle{Alignment: "center"}, Runs: []RenderRun{{Text: "a", Style: red}, {Text: "b", Style: red}}},
+		{Runs: []RenderRun{{Text: "c"}}},
+	}}
+	body, err := RenderDocumentBody(m, RenderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	css := RenderDocumentCSS(m, RenderOptions{})
+	if strings.Contains(body, "style=") {
+		t.Errorf("body should not carry inline styles: %s", body)
+	}
+	runClass := cssClassName(runStyleToCSS(red, nil))
+	if strings.Count(body, `<span class="`+runClass+`">`) != 2 || !strings.Contains(body, "<span>c</span>") {
+		t.Errorf("unexpected body: %s", body)
+	}
+	if !strings.HasPrefix(css, DocumentCSS()) || !strings.Contains(css, "."+runClass+" { color:#FF0000;font-weight:bold; }\n") || strings.Count(css, ".docx-s") != 2 {
+		t.Errorf("unexpected stylesheet: %s", css)
+	}
+	var buf bytes.Buffer
+	if err := RenderDocumentHTMLTo(&buf, m, RenderOptions{Standalone: true, ExternalCSS: true, StylesheetHref: "shared.css"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `<link rel="stylesheet" href="shared.css">`) {
+		t.Errorf("stylesheet link missing: %s", buf.String())
+	}
+}
+
+type stubConverter []byte
+
+func (c stubConverter) ConvertToDOCX(io.ReaderAt, int64) ([]byte, error) { return c, nil }
+
+func TestLegacyFormat(t *testing.T) {
+	doc := cfbtest.Build("WordDocument", make([]byte, 64))
+	if _, err := ParseDocumentModel(bytes.NewReader(doc), int64(len(doc))); !errors.Is(err, ErrLegacyFormat) {
+		t.Fatalf("err = %v, want ErrLegacyFormat", err)
+	}
+	enc := cfbtest.Build("EncryptedPackage", make([]byte, 64))
+	if _, err := ParseDocumentModel(bytes.NewReader(enc), int64(len(enc))); !errors.Is(err, ErrEncrypted) {
+		t.Fatalf("err = %v, want ErrEncrypted", err)
+	}
+
+	opts := ParseOptions{LegacyConverter: stubConverter(minimalPackage(t, `<w:p><w:r><w:t>converted</w:t></w:r></w:p>`, "", nil))}
+	m, err := ParseDocumentModelWith(bytes.NewReader(doc), int64(len(doc)), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if html := RenderDocumentHTML(m); !strings.Contains(html, "converted") {
+		t.Errorf("converted document not rendered: %s", html)
+	}
+}
+
+func TestWriteDocument(t *testing.T) {
+	write := func(m DocumentModel) *document.Document {
+		t.Helper()
+		var buf bytes.Buffer
+		if err := WriteDocument(&buf, m); err != nil {
+			t.Fatal(err)
+		}
+		doc, err := document.Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return doc
+	}
+
+	h, err := ParseHTMLModel(strings.NewReader(`<html><head><title>T</title><style>p{}</style></head><body>
+<h1>Title</h1><p>Some <b>bold</b> and <a href="https://example.com/">a link</a>.</p>
+<ul><li>one<li>two</ul>
+<table><tr><th>A<th>B<tr><td colspan=2 style="background-color:#ff0000">wide</td></table>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Properties.Title != "T" || len(h.Blocks) != 5 || h.Blocks[0].Paragraph.Style.HeadingLevel != 1 {
+		t.Fatalf("html model: %+v", h)
+	}
+	if runs := h.Blocks[1].Paragraph.Runs; len(runs) != 5 || !runs[1].Style.Bold || runs[3].Href != "https://example.com/" {
+		t.Errorf("html runs: %v", runs)
+	}
+	if a, b := h.Blocks[2].Paragraph.Style, h.Blocks[3].Paragraph.Style; a.ListType != "unordered" || a.ListID != b.ListID {
+		t.Errorf("list item styles: %s / %s", a, b)
+	}
+	if c := h.Blocks[4].Table.Rows[1].Cells[0]; c.ColSpan != 2 || c.Style.BackgroundColor != "FF0000" {
+		t.Errorf("spanned cell: %s", c)
+	}
+
+	doc := write(h)
+	paras := doc.Paragraphs() // includes the three table cells
+	if len(paras) != 7 || paras[0].Style() != "Heading1" || len(doc.Tables()) != 1 {
+		t.Fatalf("paragraphs %d, tables %d", len(paras), len(doc.Tables()))
+	}
+	if !paras[1].Runs()[1].Properties().IsBold() || len(paras[1].X().EG_PContent) < 2 {
+		t.Errorf("bold run or hyperlink not written")
+	}
+	if np := paras[2].X().PPr.NumPr; np == nil || np.NumId == nil || np.NumId.ValAttr < 1 {
+		t.Errorf("list numbering not written")
+	}
+	if tc := doc.Tables()[0].Rows()[1].Cells()[0].X().TcPr; tc == nil || tc.GridSpan == nil || tc.GridSpan.ValAttr != 2 {
+		t.Errorf("column span not written")
+	}
+	if doc.CoreProperties.Title() != "T" {
+		t.Errorf("title = %q", doc.CoreProperties.Title())
+	}
+
+	md, err := ParseMarkdownModel(strings.NewReader("# Head\n\nText with **bold**, *it* and [link](https://example.com/).\n\n1. a\n2. b\n   - nested\n\n| x | y |\n|---|--:|\n| 1 | 2 |\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(md.Blocks) != 6 || md.Blocks[5].Table == nil || len(md.Blocks[5].Table.Rows) != 2 {
+		t.Fatalf("markdown blocks: %d", len(md.Blocks))
+	}
+	runs := md.Blocks[1].Paragraph.Runs
+	if len(runs) != 7 || !runs[1].Style.Bold || !runs[3].Style.Italic || runs[5].Href != "https://example.com/" {
+		t.Errorf("markdown runs: %v", runs)
+	}
+	if st := md.Blocks[2].Paragraph.Style; st.ListType != "ordered" || st.ListLevel != 0 {
+		t.Errorf("ordered item style: %s", st)
+	}
+	if st := md.Blocks[4].Paragraph.Style; st.ListType != "unordered" || st.ListLevel != 1 {
+		t.Errorf("nested item style: %s", st)
+	}
+	if a := md.Blocks[5].Table.Rows[1].Cells[1].Paragraphs[0].Style.Alignment; a != "right" {
+		t.Errorf("column alignment = %q", a)
+	}
+	if doc := write(md); len(doc.Paragraphs()) != 9 || len(doc.Tables()) != 1 {
+		t.Errorf("markdown document: %d paragraphs, %d tables", len(doc.Paragraphs()), len(doc.Tables()))
+	}
+}
+
+func TestCompareDocuments(t *testing.T) {
+	parse := func(md string) DocumentModel {
+		t.Helper()
+		m, err := ParseMarkdownModel(strings.NewReader(md))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	old := parse("# Terms\n\nThe fee is due within 30 days.\n\nRemoved clause.\n\n| a | b |\n|---|---|\n| 1 | 2 |\n")
+	cur := parse("# Terms\n\nThe fee is due within 45 days.\n\n| a | b |\n|---|---|\n| 1 | 3 |\n\nA new clause.\n")
+
+	m := CompareDocuments(old, cur)
+	if len(m.Blocks) != 5 {
+		t.Fatalf("got %d blocks, want 5", len(m.Blocks))
+	}
+	var changes []string
+	for _, p := range m.Paragraphs {
+		prev := ""
+		for _, r := range p.Runs {
+			switch {
+			case r.Change == "":
+			case r.Change == prev:
+				changes[len(changes)-1] += r.Text
+			default:
+				changes = append(changes, r.Change+":"+r.Text)
+			}
+			prev = r.Change
+		}
+	}
+	want := []string{"delete:30", "insert:45", "delete:Removed clause.", "insert:A new clause."}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("paragraph changes = %q, want %q", changes, want)
+	}
+	if ps := m.Tables[0].Rows[1].Cells[1].Paragraphs; len(ps) != 2 || ps[0].Runs[0].Change != "delete" || ps[1].Runs[0].Text != "3" {
+		t.Errorf("cell paragraphs = %v", ps)
+	}
+
+	var b strings.Builder
+	if err := RenderDocumentHTMLTo(&b, m, RenderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if out := b.String(); !strings.Contains(out, `<del class="docx-del"><span>30</span></del><ins class="docx-ins"><span>45</span></ins>`) {
+		t.Errorf("redline HTML: %s", out)
+	}
+
+	withChunk := old
+	withChunk.Blocks = append(slices.Clip(old.Blocks), DocumentBlock{AltChunk: &AltChunk{Text: "imported"}})
+	m = CompareDocuments(withChunk, old)
+	if a := m.Blocks[len(m.Blocks)-1].AltChunk; a == nil || a.Change != "delete" {
+		t.Fatalf("removed altChunk not marked: %v", m.Blocks)
+	}
+	if out := RenderDocumentHTML(m); !strings.Contains(out, `<del class="docx-del"><div class="docx-altchunk">`) {
+		t.Errorf("removed altChunk HTML: %s", out)
+	}
+}
+
+func TestDiffKeys(t *testing.T) {
+	// lcs is the length of a longest common subsequence, the number of
+	// pairs a shortest edit script keeps.
+	lcs := func(a, b []string) int {
+		prev, cur := make([]int, len(b)+1), make([]int, len(b)+1)
+		for i := range a {
+			for j := range b {
+				if a[i] == b[j] {
+					cur[j+1] = prev[j] + 1
+				} else {
+					cur[j+1] = max(prev[j+1], cur[j])
+				}
+			}
+			prev, cur = cur, prev
+		}
+		return prev[len(b)]
+	}
+	check := func(a, b []string, want int) {
+		t.Helper()
+		i, j, kept := 0, 0, 0
+		for _, op := range diffKeys(a, b) {
+			switch {
+			case op.a >= 0 && op.b >= 0:
+				if op.a != i || op.b != j || a[i] != b[j] {
+					t.Fatalf("%q -> %q: bad pair %v", a, b, op)
+				}
+				i, j, kept = i+1, j+1, kept+1
+			case op.a >= 0:
+				if op.a != i {
+					t.Fatalf("%q -> %q: bad deletion %v", a, b, op)
+				}
+				i++
+			default:
+				if op.b != j {
+					t.Fatalf("%q -> %q: bad insertion %v", a, b, op)
+				}
+				j++
+			}
+		}
+		if i != len(a) || j != len(b) || kept != want {
+			t.Errorf("%q -> %q: covered %d/%d, kept %d, want %d", a, b, i, j, kept, want)
+		}
+	}
+	words := strings.Fields("a b c d e")
+	seq := func(n int, seed uint32) []string {
+		out := make([]string, n)
+		for i := range out {
+			seed = seed*1103515245 + 12345
+			out[i] = words[int(seed>>16)%len(words)]
+		}
+		return out
+	}
+	for n := range 12 {
+		for m := range 12 {
+			a, b := seq(n, uint32(n*31+m)), seq(m, uint32(m*17+n+1))
+			check(a, b, lcs(a, b))
+		}
+	}
+
+	// Lists further apart than maxDiffEdits are replaced whole.
+	a, b := make([]string, 2*maxDiffEdits), make([]string, 2*maxDiffEdits)
+	for i := range a {
+		a[i], b[i] = fmt.Sprint("a", i), fmt.Sprint("b", i)
+	}
+	a[0], b[0] = "same", "same"
+	check(a, b, 1)
+}
+
+func TestSanitizeDocument(t *testing.T) {
+	m, err := ParseMarkdownModel(strings.NewReader("Shared text.\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := int64(1)
+	p := m.Blocks[0].Paragraph
+	p.Runs[0].Comments = []int64{id}
+	p.Runs = append(p.Runs,
+		RenderRun{Text: " internal note", Style: RunStyle{Hidden: true}},
+		RenderRun{CommentRef: &id})
+	p.Revision = &RevisionInfo{Author: "Alice"}
+	m.Properties = DocProperties{Author: "Alice", Title: "Draft", Language: "en-US"}
+	m.Comments = []Comment{{ID: id, Author: "Bob"}}
+
+	SanitizeDocument(&m)
+	if m.Properties != (DocProperties{Language: "en-US"}) || m.Comments != nil {
+		t.Errorf("properties %v, comments %v", m.Properties, m.Comments)
+	}
+	if p := m.Paragraphs[0]; p.Revision != nil || len(p.Runs) != 1 || p.Runs[0].Text != "Shared text." || p.Runs[0].Comments != nil {
+		t.Errorf("paragraph = %v", p)
+	}
+}
+
+func TestWatermark(t *testing.T) {
+	m, err := ParseMarkdownModel(strings.NewReader("Text.\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pageLayout := range []bool{false, true} {
+		var b strings.Builder
+		opts := RenderOptions{Watermark: "DRAFT", Banner: "Confidential <client>", PageLayout: pageLayout}
+		if err := RenderDocumentHTMLTo(&b, m, opts); err != nil {
+			t.Fatal(err)
+		}
+		out := b.String()
+		if strings.Count(out, `class="docx-watermark"`) != 1 || !strings.Contains(out, ">Confidential &lt;client&gt;</div>") {
+			t.Errorf("PageLayout %t: %s", pageLayout, out)
+		}
+		if pageLayout && !strings.Contains(out, `<div class="docx-banner" role="note" style="position:absolute;`) {
+			t.Errorf("banner not placed on the page: %s", out)
+		}
+	}
+}
+
+func TestEncodeDocumentModel(t *testing.T) {
+	m, err := ParseMarkdownModel(strings.NewReader("# Title\n\nSome *text* with a [link](https://example.com).\n\n| a | b |\n|---|---|\n| 1 | 2 |\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := EncodeDocumentModel(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeDocumentModel(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Paragraphs) != len(m.Paragraphs) || len(got.Tables) != len(m.Tables) {
+		t.Errorf("got %d paragraphs and %d tables, want %d and %d", len(got.Paragraphs), len(got.Tables), len(m.Paragraphs), len(m.Tables))
+	}
+	if a, b := RenderDocumentHTML(m), RenderDocumentHTML(got); a != b {
+		t.Errorf("decoded model renders differently:\n%s\n%s", a, b)
+	}
+
+	if _, err := DecodeDocumentModel(strings.NewReader(`{"version": 99, "document": {}}`)); !errors.Is(err, ErrModelVersion) {
+		t.Errorf("future version: err = %v", err)
+	}
+}
+
+func TestDocumentText(t *testing.T) {
+	p := RenderParagraph{Runs: []RenderRun{{Text: "Hello "}, {Text: "secret", Style: RunStyle{Hidden: true}}, {Text: "gone", Change: "delete"}, {Text: "world"}}}
+	cell := func(s string) RenderTableCell {
+		return RenderTableCell{Paragraphs: []RenderParagraph{{Runs: []RenderRun{{Text: s}}}}}
+	}
+	tbl := RenderTable{Rows: []RenderTableRow{{Cells: []RenderTableCell{cell("a"), cell("b")}}}}
+	m := DocumentModel{
+		Blocks: []DocumentBlock{{Paragraph: &p}, {Table: &tbl}},
+		Notes:  []Note{{Blocks: []DocumentBlock{{Paragraph: &RenderParagraph{Runs: []RenderRun{{Text: "note"}}}}}}},
+	}
+	if got, want := DocumentText(m), "Hello world\na\tb\nnote"; got != want {
+		t.Errorf("DocumentText = %q, want %q", got, want)
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	body := `<w:p><w:r><w:t>text</w:t></w:r></w:p><w:sectPr><w:headerReference w:type="default" r:id="rId5"/></w:sectPr>`
+	rels := `<Relationship Id="rId5" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/header" Target="header1.xml"/>
+<Relationship Id="rId6" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/footnotes" Target="footnotes.xml"/>`
+	data := minimalPackage(t, body, rels, nil)
+	m, err := ParseDocumentModel(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var codes []string
+	for _, w := range m.Warnings {
+		codes = append(codes, string(w.Code)+" "+w.Location.Part)
+	}
+	slices.Sort(codes)
+	if want := []string{"missing-part word/footnotes.xml", "missing-part word/header1.xml"}; !slices.Equal(codes, want) {
+		t.Errorf("warnings = %v, want %v", m.Warnings, want)
+	}
+
+	var list diag.List
+	obj := &EmbeddedObject{Type: "Package", PreviewPart: "word/media/image1.tiff", PreviewType: "image/tiff", Preview: []byte("II*\x00")}
+	doc := DocumentModel{Paragraphs: []RenderParagraph{{Runs: []RenderRun{{Object: obj}}}}}
+	if err := RenderDocumentHTMLTo(io.Discard, doc, RenderOptions{Warnings: &list}); err != nil {
+		t.Fatal(err)
+	}
+	if ws := list.Warnings(); len(ws) != 1 || ws[0].Code != diag.UnsupportedImage || ws[0].Location.Part != obj.PreviewPart {
+		t.Errorf("render warnings = %v", ws)
+	}
+}
+
+func TestRenderRepairsText(t *testing.T) {
+	m := DocumentModel{Paragraphs: []RenderParagraph{{Runs: []RenderRun{{Text: "bell\x07 bad\xff e\u0301"}}}}}
+	var b strings.Builder
+	nfc := func(s string) string { return strings.ReplaceAll(s, "e\u0301", "\u00e9") }
+	if err := RenderDocumentHTMLTo(&b, m, RenderOptions{NormalizeText: nfc}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "bell bad\ufffd \u00e9<") {
+		t.Errorf("text not repaired: %q", b.String())
+	}
+	if got := DocumentText(m); got != "bell bad\ufffd e\u0301" {
+		t.Errorf("DocumentText = %q", got)
+	}
+}
+
+func TestRenderers(t *testing.T) {
+	cell := RenderTableCell{Paragraphs: []RenderParagraph{{Runs: []RenderRun{{Text: "in table"}}}}}
+	m := DocumentModel{Blocks: []DocumentBlock{
+		{Paragraph: &RenderParagraph{StyleID: "Callout", Runs: []RenderRun{{Text: "note this"}}}},
+		{Paragraph: &RenderParagraph{Runs: []RenderRun{{Text: "plain"}, {Object: &EmbeddedObject{Type: "Package", FileName: "a.zip"}}}}},
+		{Table: &RenderTable{Rows: []RenderTableRow{{Cells: []RenderTableCell{cell}}}}},
+	}}
+	opts := RenderOptions{Renderers: Renderers{
+		Paragraphs: map[string]RenderFunc[*RenderParagraph]{
+			"Callout": func(p *RenderParagraph, _ func() string) string {
+				return "<aside class=\"callout\">" + p.Runs[0].Text + "</aside>\n"
+			},
+		},
+		Table: func(_ *RenderTable, builtin func() string) string {
+			return "<div class=\"scroll\">" + builtin() + "</div>\n"
+		},
+		Objects: map[string]RenderFunc[EmbeddedObject]{
+			"": func(o EmbeddedObject, _ func() string) string { return "<a download>" + o.FileName + "</a>" },
+		},
+	}}
+	body, err := RenderDocumentBody(m, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`<aside class="callout">note this</aside>`, "<a download>a.zip</a></p>", `<div class="scroll"><table`, "in table"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("%q missing:\n%s", want, body)
+		}
+	}
+	if plain, _ := RenderDocumentBody(m, RenderOptions{}); strings.Contains(plain, "callout") || !strings.Contains(plain, "docx-object") {
+		t.Errorf("built-in rendering changed:\n%s", plain)
+	}
+}
@@ -0,0 +1,116 @@
+package docx
+
+import (
+	"strings"
+
+	"github.com/unidoc/unioffice/schema/soo/wml"
+)
+
+// -----------------------------------------------------------------------------
+// Fields
+// -----------------------------------------------------------------------------
+//
+// A complex field is spread over several runs:
+//
+//	<w:fldChar w:fldCharType="begin"/> <w:instrText>REF _Ref123 \h</w:instrText>
+//	<w:fldChar w:fldCharType="separate"/> …result runs… <w:fldChar w:fldCharType="end"/>
+//
+// and may span paragraphs, so the parser keeps a stack of open fields while
+// walking the document.  Only the cached result is rendered; the instruction
+// decides how result runs are decorated: cross-reference links, and page
+// numbers that page-layout rendering recomputes.
+
+// openField is a complex field between its begin and end markers.
+type openField struct {
+	instr  strings.Builder
+	result bool   // past the separate marker
+	href   string // link target derived from the instruction
+	page   string // page-number field name, see pageFieldName
+	marked bool   // a result run has been marked with page
+}
+
+type fieldStack []*openField
+
+// fldChar processes a begin/separate/end marker.
+func (s *fieldStack) fldChar(fc *wml.CT_FldChar) {
+	switch fc.FldCharTypeAttr {
+	case wml.ST_FldCharTypeBegin:
+		*s = append(*s, &openField{})
+	case wml.ST_FldCharTypeSeparate:
+		if f := s.top(); f != nil {
+			f.result = true
+			f.href = crossRefHref(f.instr.String())
+			f.page = pageFieldName(f.instr.String())
+		}
+	case wml.ST_FldCharTypeEnd:
+		if len(*s) > 0 {
+			*s = (*s)[:len(*s)-1]
+		}
+	}
+}
+
+// instrText appends to the instruction of the innermost field.
+func (s fieldStack) instrText(t string) {
+	if f := s.top(); f != nil && !f.result {
+		f.instr.WriteString(t)
+	}
+}
+
+func (s fieldStack) top() *openField {
+	if len(s) == 0 {
+		return nil
+	}
+	return s[len(s)-1]
+}
+
+// href returns the link target of the innermost field whose result is
+// being read, or "".
+func (s fieldStack) href() string {
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i].result && s[i].href != "" {
+			return s[i].href
+		}
+	}
+	return ""
+}
+
+// pageField returns the name of the innermost field if it is a page-number
+// field whose result is being read and none of its result runs has been
+// marked yet, or "".  Only the first result run carries the field, so the
+// renderer replaces the cached number once.
+func (s fieldStack) pageField() string {
+	f := s.top()
+	if f == nil || !f.result || f.page == "" || f.marked {
+		return ""
+	}
+	f.marked = true
+	return f.page
+}
+
+// pageFieldName returns "PAGE", "NUMPAGES" or "SECTIONPAGES" for those field
+// instructions, or "".
+func pageFieldName(instr string) string {
+	args := strings.Fields(instr)
+	if len(args) == 0 {
+		return ""
+	}
+	switch name := strings.ToUpper(args[0]); name {
+	case "PAGE", "NUMPAGES", "SECTIONPAGES":
+		return name
+	}
+	return ""
+}
+
+// crossRefHref returns the in-page link for a cross-reference field
+// instruction (REF, PAGEREF or NOTEREF followed by a bookmark name), or "".
+func crossRefHref(instr string) string {
+	args := strings.Fields(instr)
+	if len(args) < 2 {
+		return ""
+	}
+	switch strings.ToUpper(args[0]) {
+	case "REF", "PAGEREF", "NOTEREF":
+		return "#" + strings.Trim(args[1], `"`)
+	}
+	return ""
+}
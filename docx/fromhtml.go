@@ -0,0 +1,565 @@
+package docx
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// -----------------------------------------------------------------------------
+// HTML input
+// -----------------------------------------------------------------------------
+//
+// ParseHTMLModel reads the HTML subset this package's renderer and simple
+// editors produce into a DocumentModel, for writing back to DOCX with
+// WriteDocument.  Supported are block elements (p, div, h1-h6, blockquote,
+// pre, li in ul/ol), inline formatting (b, i, u, s, sup, sub, code, a, span
+// and font) with the inline CSS properties the renderer emits, and tables
+// with colspan/rowspan and cell backgrounds.  Tables nested in a cell are
+// flattened into the cell's paragraphs.  Classes, external stylesheets and
+// images are ignored.  The markup does not need to be well-formed XML;
+// unclosed elements are closed by their parent's end tag.
+
+// htmlSkipped lists elements whose content is not document text.
+var htmlSkipped = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true,
+	"svg": true, "math": true, "object": true, "iframe": true,
+}
+
+// htmlBlocks lists the elements that delimit paragraphs.
+var htmlBlocks = map[string]bool{
+	"p": true, "div": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"blockquote": true, "pre": true, "li": true, "address": true, "section": true, "article": true,
+	"header": true, "footer": true, "main": true, "nav": true, "aside": true, "figure": true,
+	"figcaption": true, "dt": true, "dd": true, "caption": true, "hr": true,
+}
+
+// htmlElement is an open element with the formatting it establishes.
+type htmlElement struct {
+	tag   string
+	run   RunStyle
+	href  string
+	block ParagraphStyle
+	pre   bool
+}
+
+// htmlTable is a table being built.
+type htmlTable struct {
+	t      RenderTable
+	row    *RenderTableRow
+	cell   *RenderTableCell
+	header bool // inside thead
+}
+
+// htmlBuilder converts the token stream of one HTML document.
+type htmlBuilder struct {
+	mdl      DocumentModel
+	stack    []htmlElement
+	runs     []RenderRun
+	space    bool // the text written last ends in collapsed whitespace
+	skip     int  // depth inside skipped elements
+	title    bool // inside <title>
+	lists    []listKey
+	nextList int
+	tables   []*htmlTable
+}
+
+// ParseHTMLModel reads an HTML document (or fragment) and builds a
+// DocumentModel.
+func ParseHTMLModel(r io.Reader) (DocumentModel, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return DocumentModel{}, err
+	}
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+	b := &htmlBuilder{stack: []htmlElement{{}}}
+	for {
+		tok, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil && d.InputOffset() >= int64(len(data)) {
+			break // elements left open at the end of the input
+		}
+		if err != nil {
+			return DocumentModel{}, fmt.Errorf("docx: parsing HTML: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			b.start(strings.ToLower(t.Name.Local), t.Attr)
+		case xml.EndElement:
+			b.end(strings.ToLower(t.Name.Local))
+		case xml.CharData:
+			b.text(string(t))
+		}
+	}
+	for len(b.tables) > 0 {
+		b.endTable()
+	}
+	b.flush()
+	b.mdl.Properties.Title = strings.TrimSpace(b.mdl.Properties.Title)
+	return b.mdl, nil
+}
+
+// HTMLToDOCX converts an HTML document to DOCX, see ParseHTMLModel.
+func HTMLToDOCX(w io.Writer, r io.Reader) error {
+	m, err := ParseHTMLModel(r)
+	if err != nil {
+		return err
+	}
+	return WriteDocument(w, m)
+}
+
+// start handles a start tag.
+func (b *htmlBuilder) start(tag string, attrs []xml.Attr) {
+	if b.skip > 0 || htmlSkipped[tag] {
+		b.skip++
+		return
+	}
+	if tag == "title" {
+		b.title = true
+		return
+	}
+	attr := func(name string) string {
+		for _, a := range attrs {
+			if strings.EqualFold(a.Name.Local, name) {
+				return a.Value
+			}
+		}
+		return ""
+	}
+	css := parseInlineCSS(attr("style"))
+
+	el := b.stack[len(b.stack)-1]
+	el.tag = tag
+	if htmlBlocks[tag] || tag == "ul" || tag == "ol" || tag == "table" || tag == "td" || tag == "th" {
+		b.flush()
+	}
+	switch tag {
+	case "br":
+		b.add("\n")
+		b.space = false
+		return
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		el.block.HeadingLevel = int(tag[1] - '0')
+	case "blockquote":
+		el.block.IndentLeftPx += 40
+	case "pre":
+		el.pre = true
+		el.run.FontFamily = "Courier New"
+	case "ul", "ol":
+		b.nextList++
+		b.lists = append(b.lists, listKey{id: b.nextList, ordered: tag == "ol"})
+	case "li":
+		if n := len(b.lists); n > 0 {
+			el.block.ListType = "unordered"
+			if b.lists[n-1].ordered {
+				el.block.ListType = "ordered"
+			}
+			el.block.ListLevel = n - 1
+			el.block.ListID = b.lists[n-1].id
+		}
+	case "table":
+		b.tables = append(b.tables, &htmlTable{})
+		el.block = ParagraphStyle{}
+	case "thead":
+		if t := b.table(); t != nil {
+			t.header = true
+		}
+	case "tbody", "tfoot":
+		if t := b.table(); t != nil {
+			t.header = false
+		}
+	case "tr":
+		if t := b.table(); t != nil {
+			b.endRow(t)
+			t.row = &RenderTableRow{Header: t.header}
+		}
+	case "td", "th":
+		if t := b.table(); t != nil {
+			b.endCell(t)
+			if t.row == nil {
+				t.row = &RenderTableRow{Header: t.header}
+			}
+			cell := &RenderTableCell{ColSpan: 1, RowSpan: 1}
+			if n, err := strconv.Atoi(attr("colspan")); err == nil && n > 1 {
+				cell.ColSpan = n
+			}
+			if n, err := strconv.Atoi(attr("rowspan")); err == nil && n > 1 {
+				cell.RowSpan = n
+			}
+			cell.Style.BackgroundColor = cssColor(attr("bgcolor"))
+			if c := cssColor(css["background-color"]); c != "" {
+				cell.Style.BackgroundColor = c
+			}
+			if c := cssColor(css["background"]); c != "" {
+				cell.Style.BackgroundColor = c
+			}
+			switch va := css["vertical-align"]; va {
+			case "top", "bottom":
+				cell.Style.VerticalAlign = va
+			case "middle":
+				cell.Style.VerticalAlign = "middle"
+			}
+			if w := cssLengthPx(css["width"]); w > 0 {
+				cell.WidthPx = w
+			}
+			t.cell = cell
+		}
+		el.block = ParagraphStyle{}
+		if tag == "th" {
+			el.run.Bold = true
+		}
+	case "b", "strong":
+		el.run.Bold = true
+	case "i", "em", "cite", "var", "dfn":
+		el.run.Italic = true
+	case "u", "ins":
+		el.run.Underline = true
+	case "s", "strike", "del":
+		el.run.Strike = true
+	case "sup":
+		el.run.VerticalAlign = "superscript"
+	case "sub":
+		el.run.VerticalAlign = "subscript"
+	case "code", "kbd", "samp", "tt":
+		el.run.FontFamily = "Courier New"
+	case "a":
+		if href := strings.TrimSpace(attr("href")); href != "" {
+			el.href = href
+		}
+	case "font":
+		if c := cssColor(attr("color")); c != "" {
+			el.run.FontColor = c
+		}
+		if f := attr("face"); f != "" {
+			el.run.FontFamily = firstFontFamily(f)
+		}
+	}
+	applyInlineCSS(&el, css)
+	b.stack = append(b.stack, el)
+	if tag == "hr" {
+		b.pop("hr")
+	}
+}
+
+// end handles an end tag.
+func (b *htmlBuilder) end(tag string) {
+	if b.skip > 0 {
+		b.skip--
+		return
+	}
+	if tag == "title" {
+		b.title = false
+		return
+	}
+	switch {
+	case htmlBlocks[tag]:
+		b.flush()
+	case tag == "ul" || tag == "ol":
+		b.flush()
+		if n := len(b.lists); n > 0 {
+			b.lists = b.lists[:n-1]
+		}
+	case tag == "td" || tag == "th":
+		if t := b.table(); t != nil {
+			b.endCell(t)
+		}
+	case tag == "tr":
+		if t := b.table(); t != nil {
+			b.endRow(t)
+		}
+	case tag == "thead":
+		if t := b.table(); t != nil {
+			t.header = false
+		}
+	case tag == "table":
+		if len(b.tables) > 0 {
+			b.endTable()
+		}
+	}
+	b.pop(tag)
+}
+
+// pop closes the innermost open element named tag.
+func (b *htmlBuilder) pop(tag string) {
+	for i := len(b.stack) - 1; i > 0; i-- {
+		if b.stack[i].tag == tag {
+			b.stack = b.stack[:i]
+			return
+		}
+	}
+}
+
+// text handles character data, collapsing whitespace outside pre.
+func (b *htmlBuilder) text(s string) {
+	if b.skip > 0 {
+		return
+	}
+	if b.title {
+		b.mdl.Properties.Title += s
+		return
+	}
+	if b.stack[len(b.stack)-1].pre {
+		b.add(strings.ReplaceAll(s, "\r\n", "\n"))
+		return
+	}
+	var sb strings.Builder
+	for _, r := range s {
+		if unicode.IsSpace(r) && r != ' ' {
+			if !b.space && (len(b.runs) > 0 || sb.Len() > 0) {
+				sb.WriteByte(' ')
+			}
+			b.space = true
+			continue
+		}
+		sb.WriteRune(r)
+		b.space = false
+	}
+	if sb.Len() > 0 {
+		b.add(sb.String())
+	}
+}
+
+// add appends text in the current formatting to the paragraph being built.
+func (b *htmlBuilder) add(s string) {
+	el := b.stack[len(b.stack)-1]
+	if n := len(b.runs); n > 0 && b.runs[n-1].Style == el.run && b.runs[n-1].Href == el.href {
+		b.runs[n-1].Text += s
+		return
+	}
+	b.runs = append(b.runs, RenderRun{Text: s, Style: el.run, Href: el.href})
+}
+
+// flush ends the paragraph being built, if it has text.
+func (b *htmlBuilder) flush() {
+	b.space = false
+	for n := len(b.runs); n > 0; n-- {
+		if b.runs[n-1].Text = strings.TrimRight(b.runs[n-1].Text, " "); b.runs[n-1].Text != "" {
+			break
+		}
+		b.runs = b.runs[:n-1]
+	}
+	if len(b.runs) == 0 {
+		return
+	}
+	p := RenderParagraph{Runs: b.runs, Style: b.stack[len(b.stack)-1].block}
+	b.runs = nil
+	if t := b.table(); t != nil {
+		if t.cell == nil {
+			if t.row == nil {
+				t.row = &RenderTableRow{Header: t.header}
+			}
+			t.cell = &RenderTableCell{ColSpan: 1, RowSpan: 1}
+		}
+		t.cell.Paragraphs = append(t.cell.Paragraphs, p)
+		return
+	}
+	b.mdl.AppendBlock(DocumentBlock{Paragraph: &p})
+}
+
+// table returns the innermost open table.
+func (b *htmlBuilder) table() *htmlTable {
+	if len(b.tables) == 0 {
+		return nil
+	}
+	return b.tables[len(b.tables)-1]
+}
+
+func (b *htmlBuilder) endCell(t *htmlTable) {
+	b.flush()
+	if t.cell != nil {
+		t.row.Cells = append(t.row.Cells, *t.cell)
+		t.cell = nil
+	}
+}
+
+func (b *htmlBuilder) endRow(t *htmlTable) {
+	b.endCell(t)
+	if t.row != nil {
+		if len(t.row.Cells) > 0 {
+			t.t.Rows = append(t.t.Rows, *t.row)
+		}
+		t.row = nil
+	}
+}
+
+// endTable closes the innermost table.  A nested table's cell content is
+// appended to the enclosing cell.
+func (b *htmlBuilder) endTable() {
+	t := b.table()
+	b.endRow(t)
+	b.tables = b.tables[:len(b.tables)-1]
+	if len(t.t.Rows) == 0 {
+		return
+	}
+	if outer := b.table(); outer != nil {
+		if outer.cell == nil {
+			outer.cell = &RenderTableCell{ColSpan: 1, RowSpan: 1}
+			if outer.row == nil {
+				outer.row = &RenderTableRow{Header: outer.header}
+			}
+		}
+		for _, row := range t.t.Rows {
+			for _, c := range row.Cells {
+				outer.cell.Paragraphs = append(outer.cell.Paragraphs, c.Paragraphs...)
+			}
+		}
+		return
+	}
+	b.mdl.AppendBlock(DocumentBlock{Table: &t.t})
+}
+
+// -----------------------------------------------------------------------------
+// Inline CSS
+// -----------------------------------------------------------------------------
+
+// parseInlineCSS splits a style attribute into lower-cased properties.
+func parseInlineCSS(s string) map[string]string {
+	css := make(map[string]string)
+	for _, decl := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(decl, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "!important"))
+		css[strings.ToLower(strings.TrimSpace(name))] = value
+	}
+	return css
+}
+
+// applyInlineCSS applies the supported properties to an element's
+// formatting.
+func applyInlineCSS(el *htmlElement, css map[string]string) {
+	if c := cssColor(css["color"]); c != "" {
+		el.run.FontColor = c
+	}
+	if f := css["font-family"]; f != "" {
+		el.run.FontFamily = firstFontFamily(f)
+	}
+	if v := css["font-size"]; v != "" {
+		if px := cssLengthPx(v); px > 0 {
+			el.run.FontSizePt = px * pxToPt
+		}
+	}
+	switch w := strings.ToLower(css["font-weight"]); w {
+	case "":
+	case "bold", "bolder":
+		el.run.Bold = true
+	case "normal", "lighter":
+		el.run.Bold = false
+	default:
+		if n, err := strconv.Atoi(w); err == nil {
+			el.run.Bold = n >= 600
+		}
+	}
+	switch strings.ToLower(css["font-style"]) {
+	case "italic", "oblique":
+		el.run.Italic = true
+	case "normal":
+		el.run.Italic = false
+	}
+	for _, prop := range []string{"text-decoration", "text-decoration-line"} {
+		if d := strings.ToLower(css[prop]); d != "" {
+			el.run.Underline = strings.Contains(d, "underline")
+			el.run.Strike = strings.Contains(d, "line-through")
+		}
+	}
+	switch strings.ToLower(css["vertical-align"]) {
+	case "super":
+		el.run.VerticalAlign = "superscript"
+	case "sub":
+		el.run.VerticalAlign = "subscript"
+	}
+	switch a := strings.ToLower(css["text-align"]); a {
+	case "left", "center", "right", "justify":
+		el.block.Alignment = a
+	}
+	if px := cssLengthPx(css["margin-left"]); px > 0 {
+		el.block.IndentLeftPx = px
+	}
+	if px := cssLengthPx(css["margin-right"]); px > 0 {
+		el.block.IndentRightPx = px
+	}
+	if px := cssLengthPx(css["margin-top"]); px > 0 {
+		el.block.SpaceBeforePt = px * pxToPt
+	}
+	if px := cssLengthPx(css["margin-bottom"]); px > 0 {
+		el.block.SpaceAfterPt = px * pxToPt
+	}
+}
+
+// cssLengthPx converts an absolute CSS length in px, pt or in to pixels;
+// other units yield 0.
+func cssLengthPx(v string) float64 {
+	v = strings.ToLower(strings.TrimSpace(v))
+	for _, u := range []struct {
+		suffix string
+		px     float64
+	}{{"px", 1}, {"pt", 1 / pxToPt}, {"in", 96}} {
+		if num, ok := strings.CutSuffix(v, u.suffix); ok {
+			f, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+			if err != nil {
+				return 0
+			}
+			return f * u.px
+		}
+	}
+	return 0
+}
+
+// cssNamedColors holds the basic CSS colour keywords.
+var cssNamedColors = map[string]string{
+	"black": "000000", "white": "FFFFFF", "red": "FF0000", "lime": "00FF00", "green": "008000",
+	"blue": "0000FF", "yellow": "FFFF00", "aqua": "00FFFF", "cyan": "00FFFF", "fuchsia": "FF00FF",
+	"magenta": "FF00FF", "silver": "C0C0C0", "gray": "808080", "grey": "808080", "maroon": "800000",
+	"olive": "808000", "purple": "800080", "teal": "008080", "navy": "000080", "orange": "FFA500",
+}
+
+// cssColor converts a CSS colour (#rgb, #rrggbb, rgb() or a basic keyword)
+// to "RRGGBB", or "" if it is not recognised.
+func cssColor(v string) string {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if c, ok := cssNamedColors[v]; ok {
+		return c
+	}
+	if hex, ok := strings.CutPrefix(v, "#"); ok {
+		if len(hex) == 3 {
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		}
+		if _, err := strconv.ParseUint(hex, 16, 32); err == nil && len(hex) == 6 {
+			return strings.ToUpper(hex)
+		}
+		return ""
+	}
+	if args, ok := strings.CutPrefix(v, "rgb("); ok {
+		parts := strings.Split(strings.TrimSuffix(args, ")"), ",")
+		if len(parts) != 3 {
+			return ""
+		}
+		var rgb [3]int
+		for i, p := range parts {
+			n, err := strconv.Atoi(strings.TrimSpace(p))
+			if err != nil {
+				return ""
+			}
+			rgb[i] = min(max(n, 0), 255)
+		}
+		return fmt.Sprintf("%02X%02X%02X", rgb[0], rgb[1], rgb[2])
+	}
+	return ""
+}
+
+// firstFontFamily returns the first family of a CSS font-family list.
+func firstFontFamily(v string) string {
+	first, _, _ := strings.Cut(v, ",")
+	return strings.Trim(strings.TrimSpace(first), `"'`)
+}
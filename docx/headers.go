@@ -0,0 +1,113 @@
+package docx
+
+import (
+	"encoding/xml"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/aerissecure/convert/diag"
+	"github.com/unidoc/unioffice/schema/soo/wml"
+)
+
+// -----------------------------------------------------------------------------
+// Headers & footers
+// -----------------------------------------------------------------------------
+//
+// Each section's w:sectPr references its header and footer parts by
+// relationship ID, one per page type (default, first, even).  A section that
+// does not reference a part of some type inherits the previous section's.
+// Headers and footers are only rendered in page-layout mode; even-page
+// variants are not supported and pages use the default ones.
+
+// readHeaders converts the headers and footers of every section.  Parts
+// shared between sections are converted once.
+func (p *parser) readHeaders() {
+	if p.pkg == nil {
+		return
+	}
+	cache := make(map[string][]DocumentBlock)
+	convert := func(id string, footer bool) []DocumentBlock {
+		if blocks, ok := cache[id]; ok {
+			return blocks
+		}
+		blocks := p.headerBlocks(id, footer)
+		cache[id] = blocks
+		return blocks
+	}
+	var prev Section
+	for i, sp := range p.sectPrs {
+		if i >= len(p.mdl.Sections) {
+			break
+		}
+		s := &p.mdl.Sections[i]
+		s.Header, s.Footer = prev.Header, prev.Footer
+		s.FirstHeader, s.FirstFooter = prev.FirstHeader, prev.FirstFooter
+		if sp == nil {
+			prev = *s
+			continue
+		}
+		for _, ref := range sp.EG_HdrFtrReferences {
+			if r := ref.HeaderReference; r != nil {
+				switch r.TypeAttr {
+				case wml.ST_HdrFtrFirst:
+					s.FirstHeader = convert(r.IdAttr, false)
+				case wml.ST_HdrFtrEven:
+				default:
+					s.Header = convert(r.IdAttr, false)
+				}
+			}
+			if r := ref.FooterReference; r != nil {
+				switch r.TypeAttr {
+				case wml.ST_HdrFtrFirst:
+					s.FirstFooter = convert(r.IdAttr, true)
+				case wml.ST_HdrFtrEven:
+				default:
+					s.Footer = convert(r.IdAttr, true)
+				}
+			}
+		}
+		prev = *s
+	}
+}
+
+// headerBlocks reads and converts the header or footer part with the given
+// relationship ID.
+func (p *parser) headerBlocks(id string, footer bool) []DocumentBlock {
+	kind := "header"
+	if footer {
+		kind = "footer"
+	}
+	rel, ok := p.docRels()[id]
+	if !ok {
+		p.warn(diag.MissingPart, diag.Location{Part: p.pkg.main}, fmt.Sprintf("%s: no relationship %q", kind, id))
+		return nil
+	}
+	if rel.External() {
+		return nil
+	}
+	part := resolveTarget(p.pkg.main, rel.Target)
+	data, err := p.pkg.readPart(part)
+	if err != nil {
+		p.warn(diag.MissingPart, diag.Location{Part: part}, kind+": "+err.Error())
+		return nil
+	}
+	p.scanTrackedChanges(data)
+	var content []*wml.EG_ContentBlockContent
+	if footer {
+		var x wml.Ftr
+		err = xml.Unmarshal(data, &x)
+		content = x.EG_ContentBlockContent
+	} else {
+		var x wml.Hdr
+		err = xml.Unmarshal(data, &x)
+		content = x.EG_ContentBlockContent
+	}
+	if err != nil {
+		p.warn(diag.BadPart, diag.Location{Part: part}, kind+": "+err.Error())
+		return nil
+	}
+	elts := []*wml.EG_BlockLevelElts{{EG_ContentBlockContent: content}}
+	p.src.add(strings.TrimSuffix(path.Base(part), path.Ext(part))+"/", elts)
+	return p.detachedBlocks(elts)
+}
@@ -0,0 +1,54 @@
+package docx
+
+// -----------------------------------------------------------------------------
+// Render hooks
+// -----------------------------------------------------------------------------
+//
+// RenderOptions.Renderers lets a caller take over the rendering of chosen
+// kinds of element, e.g. paragraphs in a "Callout" style or a kind of
+// embedded object the converter only shows as a box, without forking the
+// renderer.  A hook receives the element and a function returning its
+// built-in HTML, so it can replace the HTML, wrap it, or fall back to it
+// for elements it does not handle.  What a hook returns is emitted as is;
+// with convert's Strict option it is sanitised with the rest of the page.
+
+// RenderFunc renders v in place of the built-in renderer, whose HTML
+// builtin returns.
+type RenderFunc[T any] func(v T, builtin func() string) string
+
+// Renderers holds the render hooks of a document.  Elements without a hook
+// are rendered as built in; the zero value overrides nothing.
+type Renderers struct {
+	// Paragraphs are hooks for paragraphs by style ID, e.g. "Quote"; the
+	// "" entry applies to paragraphs no other entry matches.  List items
+	// are rendered as lists and not passed.
+	Paragraphs map[string]RenderFunc[*RenderParagraph]
+	// Table is the hook for tables.
+	Table RenderFunc[*RenderTable]
+	// Objects are hooks for embedded objects by EmbeddedObject.Type, e.g.
+	// "Package"; the "" entry applies to objects no other entry matches.
+	Objects map[string]RenderFunc[EmbeddedObject]
+}
+
+// Empty reports whether r overrides nothing.
+func (r Renderers) Empty() bool {
+	return len(r.Paragraphs) == 0 && r.Table == nil && len(r.Objects) == 0
+}
+
+// hookFor returns the hook of hooks for key, or the "" entry if key has
+// none.
+func hookFor[T any](hooks map[string]RenderFunc[T], key string) RenderFunc[T] {
+	if fn, ok := hooks[key]; ok {
+		return fn
+	}
+	return hooks[""]
+}
+
+// renderHooked returns the HTML fn renders v as, or that of builtin if fn
+// is nil.
+func renderHooked[T any](fn RenderFunc[T], v T, builtin func() string) string {
+	if fn == nil {
+		return builtin()
+	}
+	return fn(v, builtin)
+}
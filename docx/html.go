@@ -1,65 +1,56 @@
 package docx
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"html"
 	"io"
-	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
+
+	"github.com/aerissecure/convert/diag"
+	"github.com/aerissecure/convert/fonts"
+	"github.com/aerissecure/convert/internal/csssafe"
+	"github.com/aerissecure/convert/internal/overlay"
+	"github.com/aerissecure/convert/internal/panics"
+	"github.com/aerissecure/convert/internal/textsafe"
+	"github.com/aerissecure/convert/media"
 )
 
 // DebugHTML controls whether extra data attributes with raw style info are included in the rendered HTML output.
+//
+// Deprecated: Set RenderOptions.Debug instead.  DebugHTML is still honoured
+// when Debug is unset, but changing it while documents are being rendered
+// is a data race.
 var DebugHTML bool
 
-// DocxToHTML is a convenience wrapper that converts a DOCX reader to HTML
-// using the intermediate representation defined in this package.
+// DocxToHTML converts a DOCX reader to HTML.
+//
+// Deprecated: use DOCXToHTML, named like xlsx.XLSXToHTML.
 func DocxToHTML(r io.ReaderAt, size int64) (string, error) {
-	ir, err := ParseDocumentModel(r, size)
-	if err != nil {
-		return "", err
-	}
-	return RenderDocumentHTML(ir), nil
-}
-
-// -----------------------------------------------------------------------------
-// Helpers for sanitising CSS values – copied from xlsx/html.go for consistency.
-// -----------------------------------------------------------------------------
-var (
-	fontFamilySafeRe = regexp.MustCompile(`[^a-zA-Z0-9 ,_-]+`)
-	hexColorRe       = regexp.MustCompile(`^[0-9a-fA-F]{3}([0-9a-fA-F]{3})?$`)
-)
-
-// sanitizeFontFamily strips any characters that are not considered safe for a
-// CSS font-family declaration.  This prevents breaking out of the CSS context
-// and injecting arbitrary directives.
-func sanitizeFontFamily(s string) string {
-	return fontFamilySafeRe.ReplaceAllString(s, "")
-}
-
-// sanitizeColor ensures the value is a valid 3- or 6-digit hexadecimal string.
-// Any invalid input results in an empty string, preventing potential CSS or
-// markup injection.
-func sanitizeColor(s string) string {
-	if hexColorRe.MatchString(s) {
-		return s
-	}
-	return ""
+	return DOCXToHTML(r, size)
 }
 
 // -----------------------------------------------------------------------------
 // Run-level helpers
 // -----------------------------------------------------------------------------
 
-func runStyleToCSS(s RunStyle) string {
+// runStyleToCSS returns the declarations of s, with font stacks extended by
+// subs.
+func runStyleToCSS(s RunStyle, subs fonts.Substitutes) string {
 	var b strings.Builder
-	if s.FontFamily != "" {
-		b.WriteString(fmt.Sprintf("font-family:'%s';", sanitizeFontFamily(s.FontFamily)))
+	if stack := subs.Stack(fontStack(s)...); stack != "" {
+		b.WriteString("font-family:" + stack + ";")
 	}
 	if s.FontSizePt > 0 {
 		b.WriteString(fmt.Sprintf("font-size:%.1fpt;", s.FontSizePt))
 	}
 	if s.FontColor != "" {
-		if safe := sanitizeColor(s.FontColor); safe != "" {
+		if safe := csssafe.Color(s.FontColor); safe != "" {
 			b.WriteString(fmt.Sprintf("color:#%s;", safe))
 		}
 	}
@@ -82,9 +73,53 @@ func runStyleToCSS(s RunStyle) string {
 	case "subscript":
 		b.WriteString("vertical-align:sub;")
 	}
+	if s.Hidden {
+		b.WriteString("display:none;")
+	}
 	return b.String()
 }
 
+// semanticRunHTML wraps run text in the elements matching its bold, italic,
+// underline, strike and vertical alignment properties and returns the style
+// left to express in CSS.
+func semanticRunHTML(text string, s RunStyle) (string, RunStyle) {
+	wrap := func(on bool, tag string) {
+		if on {
+			text = "<" + tag + ">" + text + "</" + tag + ">"
+		}
+	}
+	wrap(s.VerticalAlign == "superscript", "sup")
+	wrap(s.VerticalAlign == "subscript", "sub")
+	wrap(s.Strike, "s")
+	wrap(s.Underline, "u")
+	wrap(s.Italic, "em")
+	wrap(s.Bold, "strong")
+	s.Bold, s.Italic, s.Underline, s.Strike, s.VerticalAlign = false, false, false, false, ""
+	return text, s
+}
+
+// fontStack orders the run's fonts so the one Word would use for the run's
+// script comes first; the others remain as fallbacks for mixed text.
+func fontStack(s RunStyle) []string {
+	order := []string{s.FontFamily, s.FontFamilyEastAsia, s.FontFamilyCS}
+	switch s.Script {
+	case "eastAsia":
+		order = []string{s.FontFamilyEastAsia, s.FontFamily, s.FontFamilyCS}
+	case "cs":
+		order = []string{s.FontFamilyCS, s.FontFamily, s.FontFamilyEastAsia}
+	}
+	var stack []string
+	seen := make(map[string]bool)
+	for _, f := range order {
+		f = csssafe.FontFamily(f)
+		if f != "" && !seen[f] {
+			seen[f] = true
+			stack = append(stack, f)
+		}
+	}
+	return stack
+}
+
 // -----------------------------------------------------------------------------
 // Paragraph-level helpers
 // -----------------------------------------------------------------------------
@@ -109,6 +144,9 @@ func paragraphStyleToCSS(s ParagraphStyle) string {
 	if s.SpaceAfterPt > 0 {
 		b.WriteString(fmt.Sprintf("margin-bottom:%.0fpt;", s.SpaceAfterPt))
 	}
+	if s.LineSpacingPt > 0 {
+		b.WriteString(fmt.Sprintf("line-height:%.0fpt;", s.LineSpacingPt))
+	}
 	// Indent (convert px)
 	if s.IndentLeftPx > 0 {
 		b.WriteString(fmt.Sprintf("padding-left:%.0fpx;", s.IndentLeftPx))
@@ -126,7 +164,7 @@ func paragraphStyleToCSS(s ParagraphStyle) string {
 func cellStyleToCSS(s TableCellStyle) string {
 	var b strings.Builder
 	if s.BackgroundColor != "" {
-		if safe := sanitizeColor(s.BackgroundColor); safe != "" {
+		if safe := csssafe.Color(s.BackgroundColor); safe != "" {
 			b.WriteString(fmt.Sprintf("background-color:#%s;", safe))
 		}
 	}
@@ -143,55 +181,853 @@ func cellStyleToCSS(s TableCellStyle) string {
 	return b.String()
 }
 
+// -----------------------------------------------------------------------------
+// Content control helpers
+// -----------------------------------------------------------------------------
+
+// contentControlAttrs returns data attributes identifying the content control
+// an element belongs to, so host applications can locate template fields in
+// the rendered output.
+func contentControlAttrs(cc *ContentControl) string {
+	if cc == nil {
+		return ""
+	}
+	var b strings.Builder
+	if cc.Tag != "" {
+		b.WriteString(fmt.Sprintf(" data-sdt-tag=\"%s\"", html.EscapeString(cc.Tag)))
+	}
+	if cc.Alias != "" {
+		b.WriteString(fmt.Sprintf(" data-sdt-alias=\"%s\"", html.EscapeString(cc.Alias)))
+	}
+	if cc.ShowingPlaceholder {
+		b.WriteString(" data-sdt-placeholder")
+	}
+	return b.String()
+}
+
 // -----------------------------------------------------------------------------
 // Paragraph & Run rendering
 // -----------------------------------------------------------------------------
 
-func renderRunsHTML(runs []RenderRun) string {
+// renderObjectHTML renders a visible placeholder for an embedded object.  The
+// preview image Word stores alongside the object is used when browsers can
+// display it, if need be after converting it from a metafile; otherwise a
+// labelled box stands in for the object.  With RedactImages the box takes
+// the size of the image instead, which is neither converted nor handed to
+// the ImageHandler.
+func (hr *htmlRenderer) renderObjectHTML(o EmbeddedObject) string {
+	return renderHooked(hookFor(hr.opts.Renderers.Objects, o.Type), o, func() string { return hr.objectHTML(o) })
+}
+
+// objectHTML is the built-in rendering of renderObjectHTML.
+func (hr *htmlRenderer) objectHTML(o EmbeddedObject) string {
+	label := o.Type
+	if o.FileName != "" {
+		label += ": " + o.FileName
+	}
+	attrs := fmt.Sprintf(" class=\"docx-object\" data-object-type=\"%s\" title=\"%s\"", html.EscapeString(o.Type), html.EscapeString(label))
+	alt := label
+	if o.AltText != "" {
+		alt = o.AltText
+	}
+	const box = "border:1px dashed #999;padding:4px 8px;color:#555;"
+	if hr.opts.RedactImages && len(o.Preview) > 0 {
+		size := ""
+		if o.WidthPt > 0 && o.HeightPt > 0 {
+			size = fmt.Sprintf("width:%.0fpt;height:%.0fpt;box-sizing:border-box;overflow:hidden;", o.WidthPt, o.HeightPt)
+		}
+		return fmt.Sprintf("<span%s data-redacted style=\"display:inline-block;%s%s\">[%s]</span>", attrs, size, box, html.EscapeString(label))
+	}
+	img := media.Image{Name: o.PreviewPart, ContentType: o.PreviewType, Data: o.Preview}
+	img, ok := media.WebImage(img, hr.opts.MetafileRasterizer)
+	switch {
+	case len(o.Preview) == 0:
+	case !ok:
+		hr.opts.Warnings.Add(diag.Warning{Code: diag.UnsupportedImage, Location: diag.Location{Part: o.PreviewPart},
+			Message: "object preview of type " + o.PreviewType + " cannot be shown"})
+	default:
+		size := ""
+		if o.WidthPt > 0 && o.HeightPt > 0 {
+			size = fmt.Sprintf(" style=\"width:%.0fpt;height:%.0fpt;\"", o.WidthPt, o.HeightPt)
+		}
+		if src, ok := hr.imageSrc(img); ok {
+			if src, ok = hr.rewriteURL(src); !ok {
+				break
+			}
+			return fmt.Sprintf("<span%s><img src=\"%s\" alt=\"%s\"%s></span>",
+				attrs, html.EscapeString(src), html.EscapeString(alt), size)
+		}
+	}
+	return fmt.Sprintf("<span%s style=\"display:inline-block;%s\">[%s]</span>", attrs, box, html.EscapeString(label))
+}
+
+// renderImageHTML renders a picture as an <img> of its size in the
+// document, floated beside the text if it is anchored.  A picture that
+// cannot be shown (linked, unreadable, or a metafile that cannot be
+// converted) is rendered as a labelled box of the same size, as is every
+// picture with RedactImages.
+func (hr *htmlRenderer) renderImageHTML(im Image) string {
+	alt := im.AltText
+	if alt == "" {
+		alt = im.Title
+	}
+	var css string
+	if im.WidthPt > 0 && im.HeightPt > 0 {
+		css = fmt.Sprintf("width:%.0fpt;height:%.0fpt;", im.WidthPt, im.HeightPt)
+	}
+	if im.Anchored {
+		switch im.Align {
+		case "right":
+			css += "float:right;margin:0 0 0.5em 1em;"
+		case "center":
+			css += "display:block;margin:0.5em auto;"
+		default:
+			css += "float:left;margin:0 1em 0.5em 0;"
+		}
+	}
+	if !hr.opts.RedactImages && len(im.Data) > 0 {
+		img, ok := media.WebImage(media.Image{Name: im.PartName, ContentType: im.ContentType, Data: im.Data}, hr.opts.MetafileRasterizer)
+		if !ok {
+			hr.opts.Warnings.Add(diag.Warning{Code: diag.UnsupportedImage, Location: diag.Location{Part: im.PartName},
+				Message: "picture of type " + im.ContentType + " cannot be shown"})
+		} else if src, ok := hr.imageSrc(img); ok {
+			if src, ok = hr.rewriteURL(src); ok {
+				return fmt.Sprintf("<img src=\"%s\" alt=\"%s\"%s>", html.EscapeString(src), html.EscapeString(alt), hr.styleAttr(css, "docx-image"))
+			}
+		}
+	}
+	label, attrs := alt, ""
+	if label == "" {
+		label = "Picture"
+	}
+	if hr.opts.RedactImages {
+		attrs = " data-redacted"
+	}
+	const box = "display:inline-block;box-sizing:border-box;overflow:hidden;border:1px dashed #999;padding:4px 8px;color:#555;"
+	return fmt.Sprintf("<span%s%s>[%s]</span>", hr.styleAttr(box+css, "docx-image"), attrs, html.EscapeString(label))
+}
+
+// safeHref returns href if it uses a scheme that is safe to emit in an
+// <a href>, or "" otherwise.
+func safeHref(href string) string {
+	if strings.HasPrefix(href, "#") {
+		return href
+	}
+	scheme, _, ok := strings.Cut(href, ":")
+	if !ok {
+		return ""
+	}
+	switch strings.ToLower(scheme) {
+	case "http", "https", "mailto", "ftp":
+		return href
+	}
+	return ""
+}
+
+func (hr *htmlRenderer) renderRunsHTML(runs []RenderRun) string {
+	var b strings.Builder
+	for i := 0; i < len(runs); i++ {
+		// Consecutive runs of the same hyperlink share one anchor.
+		if href := hr.href(runs[i].Href); href != "" {
+			j := i
+			for j < len(runs) && runs[j].Href == runs[i].Href {
+				j++
+			}
+			b.WriteString(fmt.Sprintf("<a href=\"%s\">", html.EscapeString(href)))
+			b.WriteString(hr.renderRunSpans(runs[i:j]))
+			b.WriteString("</a>")
+			i = j - 1
+			continue
+		}
+		b.WriteString(hr.renderRunSpans(runs[i : i+1]))
+	}
+	return b.String()
+}
+
+// runTextReplacer writes line breaks as <br> and the characters that control
+// line breaking as entities, so they keep Word's breaking behaviour and stay
+// recognisable in the markup.
+var runTextReplacer = strings.NewReplacer(
+	"\n", "<br>",
+	"\u00a0", "&nbsp;", // no-break space
+	"\u00ad", "&shy;", // w:softHyphen
+	"\u2011", "&#8209;", // w:noBreakHyphen
+)
+
+// runTextHTML escapes run text for HTML.
+func runTextHTML(s string) string {
+	return runTextReplacer.Replace(html.EscapeString(s))
+}
+
+func (hr *htmlRenderer) renderRunSpans(runs []RenderRun) string {
 	var b strings.Builder
 	for _, run := range runs {
-		text := html.EscapeString(run.Text)
-		text = strings.ReplaceAll(text, "\n", "<br>")
-		css := runStyleToCSS(run.Style)
-		debugAttr := ""
-		if DebugHTML {
-			debugAttr = fmt.Sprintf(" data-run-style=\"%s\"", html.EscapeString(run.Style.String()))
-		}
-		if css != "" {
-			b.WriteString(fmt.Sprintf("<span style=\"%s\"%s>%s</span>", css, debugAttr, text))
+		run, ok := revisedRun(run, hr.opts.Revisions)
+		if !ok {
+			continue
+		}
+		if run.Change != "" {
+			b.WriteString(hr.renderChangeHTML(run, hr.renderRunSpans([]RenderRun{withoutChange(run)})))
+			continue
+		}
+		if fc := run.FormatChange; fc != nil {
+			css := "border-bottom:1px dotted " + hr.authorColor(fc.Author) + ";"
+			b.WriteString(fmt.Sprintf("<span%s title=\"%s\">", hr.styleAttr(css, "docx-format-change"), html.EscapeString(revisionTitle("Formatted", *fc))))
+			run.FormatChange, run.OriginalStyle = nil, nil
+			b.WriteString(hr.renderRunSpans([]RenderRun{run}) + "</span>")
+			continue
+		}
+		if run.Object != nil {
+			b.WriteString(hr.renderObjectHTML(*run.Object))
+			continue
+		}
+		if run.Image != nil {
+			b.WriteString(hr.renderImageHTML(*run.Image))
+			continue
+		}
+		if run.Ruby != nil {
+			b.WriteString("<ruby>" + hr.renderRunSpans(run.Ruby.Base) + "<rt>" + hr.renderRunSpans(run.Ruby.Guide) + "</rt></ruby>")
+			continue
+		}
+		if run.Bookmark != "" {
+			b.WriteString(fmt.Sprintf("<a id=\"%s\"></a>", html.EscapeString(hr.opts.IDPrefix+run.Bookmark)))
+			continue
+		}
+		if run.Note != nil {
+			b.WriteString(hr.renderNoteRefHTML(*run.Note))
+			continue
+		}
+		if run.CommentRef != nil {
+			b.WriteString(hr.renderCommentRefHTML(*run.CommentRef))
+			continue
+		}
+		text := runTextHTML(run.Text)
+		if v, ok := hr.fields[run.Field]; ok {
+			text = strconv.Itoa(v)
+		}
+		style := run.Style
+		if hr.opts.SemanticTags {
+			text, style = semanticRunHTML(text, style)
+		}
+		css := runStyleToCSS(style, hr.fontSubstitutes())
+		attrs := contentControlAttrs(run.ContentControl) + hr.sourceAttr(run.Source)
+		if hr.debug() {
+			attrs += fmt.Sprintf(" data-run-style=\"%s\"", html.EscapeString(run.Style.String()))
+		}
+		var span string
+		if hr.opts.SemanticTags && css == "" && attrs == "" {
+			span = text
 		} else {
-			b.WriteString(fmt.Sprintf("<span%s>%s</span>", debugAttr, text))
+			span = fmt.Sprintf("<span%s%s>%s</span>", hr.styleAttr(css), attrs, text)
 		}
+		b.WriteString(hr.markCommented(span, run.Comments))
 	}
 	return b.String()
 }
 
-func renderParagraphHTML(p RenderParagraph) string {
+// renderChangeHTML marks up the content of an inserted or deleted run of a
+// comparison or a tracked change; the latter is coloured by its author and
+// titled with its author and date.
+func (hr *htmlRenderer) renderChangeHTML(r RenderRun, content string) string {
+	var tag, label string
+	switch r.Change {
+	case revInsert:
+		tag, label = "ins", "Inserted"
+	case revDelete:
+		tag, label = "del", "Deleted"
+	default:
+		return content
+	}
+	var attrs string
+	if r.Revision != nil {
+		attrs = hr.styleAttr("color:"+hr.authorColor(r.Revision.Author)+";") +
+			fmt.Sprintf(" title=\"%s\"", html.EscapeString(revisionTitle(label, *r.Revision)))
+		if d := r.Revision.Date; !d.IsZero() {
+			attrs += fmt.Sprintf(" datetime=\"%s\"", d.Format(time.RFC3339))
+		}
+	}
+	return fmt.Sprintf("<%s class=\"docx-%s\"%s>%s</%s>", tag, tag, attrs, content, tag)
+}
+
+func withoutChange(r RenderRun) RenderRun {
+	r.Change, r.Revision = "", nil
+	return r
+}
+
+// revisionColors are the colours given to the authors of tracked changes,
+// in order of their first change.
+var revisionColors = []string{"#b5082e", "#1f4fd1", "#2e7d32", "#8e24aa", "#e65100", "#00838f", "#6d4c41", "#c2185b"}
+
+// authorColor returns the colour of the tracked changes of author.
+func (hr *htmlRenderer) authorColor(author string) string {
+	if hr.revisionAuthors == nil {
+		hr.revisionAuthors = make(map[string]int)
+	}
+	i, ok := hr.revisionAuthors[author]
+	if !ok {
+		i = len(hr.revisionAuthors)
+		hr.revisionAuthors[author] = i
+	}
+	return revisionColors[i%len(revisionColors)]
+}
+
+// revisionTitle returns the tooltip of a tracked change, e.g. "Inserted by
+// Ann (2024-03-01 10:00)".
+func revisionTitle(label string, r Revision) string {
+	if r.Author != "" {
+		label += " by " + r.Author
+	}
+	if !r.Date.IsZero() {
+		label += " (" + r.Date.Format("2006-01-02 15:04") + ")"
+	}
+	return label
+}
+
+func (hr *htmlRenderer) renderParagraphHTML(p *RenderParagraph) string {
 	var tag string
-	if p.Style.HeadingLevel > 0 && p.Style.HeadingLevel <= 6 {
+	if level, ok := hr.headings.levels[p]; ok {
+		tag = fmt.Sprintf("h%d", level)
+	} else if isHeading(*p) {
 		tag = fmt.Sprintf("h%d", p.Style.HeadingLevel)
 	} else {
 		tag = "p"
 	}
+	return renderHooked(hookFor(hr.opts.Renderers.Paragraphs, p.StyleID), p, func() string { return hr.renderParagraphElement(tag, p) })
+}
+
+// renderParagraphElement renders p as the given element with the
+// paragraph's formatting and attributes.
+func (hr *htmlRenderer) renderParagraphElement(tag string, p *RenderParagraph) string {
 	css := paragraphStyleToCSS(p.Style)
-	debugAttr := ""
-	if DebugHTML {
-		debugAttr = fmt.Sprintf(" data-para-style=\"%s\"", html.EscapeString(p.Style.String()))
+	attrs := contentControlAttrs(p.ContentControl) + hr.sourceAttr(p.Source)
+	if id := hr.headings.ids[p]; id != "" {
+		attrs = fmt.Sprintf(" id=\"%s\"", html.EscapeString(id)) + attrs
 	}
-	if css != "" {
-		return fmt.Sprintf("<%s style=\"%s\"%s>%s</%s>\n", tag, css, debugAttr, renderRunsHTML(p.Runs), tag)
+	if hr.debug() {
+		attrs += fmt.Sprintf(" data-para-style=\"%s\"", html.EscapeString(p.Style.String()))
+	}
+	content := hr.renderRunsHTML(p.Runs)
+	if p.DropCap != nil {
+		content = hr.renderDropCapHTML(*p.DropCap) + content
+	}
+	var classes []string
+	if p.StyleID != "" {
+		classes = append(classes, StyleClass(p.StyleID))
+	}
+	return fmt.Sprintf("<%s%s%s>%s</%s>\n", tag, hr.styleAttr(css, classes...), attrs, content, tag)
+}
+
+// renderParagraphsHTML renders a sequence of paragraphs, grouping list
+// items into lists.
+func (hr *htmlRenderer) renderParagraphsHTML(paras []RenderParagraph) string {
+	var b strings.Builder
+	for i := 0; i < len(paras); i++ {
+		if !isListItem(paras[i]) {
+			b.WriteString(hr.renderParagraphHTML(&paras[i]))
+			continue
+		}
+		var items []*RenderParagraph
+		for ; i < len(paras) && isListItem(paras[i]); i++ {
+			items = append(items, &paras[i])
+		}
+		i--
+		b.WriteString(hr.renderListHTML(items))
+	}
+	return b.String()
+}
+
+// renderDropCapHTML floats the dropped capital to the left of the paragraph,
+// sized to span roughly the requested number of lines.
+func (hr *htmlRenderer) renderDropCapHTML(dc DropCap) string {
+	css := fmt.Sprintf("float:left;font-size:%.1fem;line-height:1;margin-right:0.1em;", float64(dc.Lines)*1.1)
+	if dc.Margin {
+		css += "margin-left:-1em;"
+	}
+	return fmt.Sprintf("<span class=\"docx-dropcap\" style=\"%s\">%s</span>", css, hr.renderRunsHTML(dc.Runs))
+}
+
+// -----------------------------------------------------------------------------
+// Style classes
+// -----------------------------------------------------------------------------
+
+// StyleClass returns the class emitted on paragraphs with the given Word
+// style ID: "docx-style-" followed by the ID with characters other than
+// letters, digits, '-' and '_' replaced by '-', e.g. "docx-style-Heading1".
+func StyleClass(styleID string) string {
+	return "docx-style-" + strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' {
+			return r
+		}
+		return '-'
+	}, styleID)
+}
+
+// StyleClasses maps the display name of every paragraph style used in the
+// document (the style ID when the style has no name) to the class the
+// renderer emits for it, so host applications can restyle converted
+// documents with their own CSS.
+func StyleClasses(m DocumentModel) map[string]string {
+	out := make(map[string]string)
+	_ = Walk(&m, Visitor{Paragraph: func(p *RenderParagraph) error {
+		if p.StyleID == "" {
+			return nil
+		}
+		name := p.StyleName
+		if name == "" {
+			name = p.StyleID
+		}
+		out[name] = StyleClass(p.StyleID)
+		return SkipChildren
+	}})
+	return out
+}
+
+// -----------------------------------------------------------------------------
+// Heading anchors & table of contents
+// -----------------------------------------------------------------------------
+
+func isHeading(p RenderParagraph) bool {
+	return p.Style.HeadingLevel > 0 && p.Style.HeadingLevel <= 6
+}
+
+// headingIndex assigns ids to top-level headings and, for accessible
+// output, normalised levels.  Headings are added in document order, so the
+// index can be filled up front or while streaming.
+type headingIndex struct {
+	normalize bool
+	prefix    string                      // RenderOptions.IDPrefix
+	revisions RevisionsMode               // RenderOptions.Revisions, for the heading text
+	ids       map[*RenderParagraph]string // heading ids
+	levels    map[*RenderParagraph]int    // normalised heading levels, accessible output only
+	used      map[string]bool
+	stack     []int // original levels of the enclosing headings, depth = output level
+	toc       []tocEntry
+}
+
+func newHeadingIndex(normalize bool, prefix string, revisions RevisionsMode) *headingIndex {
+	return &headingIndex{
+		normalize: normalize,
+		prefix:    prefix,
+		revisions: revisions,
+		ids:       make(map[*RenderParagraph]string),
+		levels:    make(map[*RenderParagraph]int),
+		used:      make(map[string]bool),
+	}
+}
+
+// add indexes blk if it is a heading.
+//
+// Ids are derived from the heading text so links keep working when the
+// document is re-rendered; repeated titles get a numeric suffix in document
+// order.  Normalisation renumbers headings so that none is more than one
+// level below the one before it, starting at h1, keeping each heading's
+// offset from the heading it was promoted under.
+func (x *headingIndex) add(blk DocumentBlock) {
+	if blk.Paragraph == nil || !isHeading(*blk.Paragraph) {
+		return
+	}
+	p := blk.Paragraph
+	var text strings.Builder
+	for _, r := range p.Runs {
+		if _, ok := revisedRun(r, x.revisions); ok {
+			text.WriteString(r.Text)
+		}
+	}
+	title := strings.Join(strings.Fields(text.String()), " ")
+	base := headingSlug(title)
+	id := base
+	for n := 2; x.used[id]; n++ {
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+	x.used[id] = true
+	x.ids[p] = x.prefix + id
+	x.toc = append(x.toc, tocEntry{level: p.Style.HeadingLevel, text: title, id: x.prefix + id})
+
+	if x.normalize {
+		level := p.Style.HeadingLevel
+		for len(x.stack) > 0 && x.stack[len(x.stack)-1] >= level {
+			x.stack = x.stack[:len(x.stack)-1]
+		}
+		x.stack = append(x.stack, level)
+		x.levels[p] = len(x.stack)
+	}
+}
+
+// tocEntry is a heading listed in the generated table of contents.
+type tocEntry struct {
+	level int
+	text  string
+	id    string
+}
+
+// headingSlug turns a heading title into an id: lower-case letters and
+// digits separated by single hyphens, e.g. "4.2 Access Control" becomes
+// "4-2-access-control".
+func headingSlug(title string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(title) {
+		if unicode.Is(unicode.Cf, r) { // soft hyphens and other invisible format characters
+			continue
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			hyphen = false
+		} else {
+			hyphen = true
+		}
+	}
+	if b.Len() == 0 {
+		return "section"
+	}
+	return b.String()
+}
+
+// renderTOCHTML renders the headings as nested lists of links.  Skipped
+// levels are not padded with empty lists; a heading nests under the nearest
+// preceding heading of a lower level.
+func renderTOCHTML(toc []tocEntry) string {
+	if len(toc) == 0 {
+		return ""
+	}
+	var (
+		b     strings.Builder
+		stack []int // levels of the open lists
+	)
+	b.WriteString("<nav class=\"docx-toc\">\n")
+	for _, e := range toc {
+		for len(stack) > 0 && stack[len(stack)-1] > e.level {
+			b.WriteString("</li>\n</ul>\n")
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) > 0 && stack[len(stack)-1] == e.level {
+			b.WriteString("</li>\n")
+		} else {
+			b.WriteString("<ul>\n")
+			stack = append(stack, e.level)
+		}
+		b.WriteString(fmt.Sprintf("<li><a href=\"#%s\">%s</a>", html.EscapeString(e.id), html.EscapeString(e.text)))
 	}
-	return fmt.Sprintf("<%s%s>%s</%s>\n", tag, debugAttr, renderRunsHTML(p.Runs), tag)
+	for range stack {
+		b.WriteString("</li>\n</ul>\n")
+	}
+	b.WriteString("</nav>\n")
+	return b.String()
+}
+
+// Heading is a heading of a document, as listed in its table of contents.
+type Heading struct {
+	Level int    // heading level in the document, 1 for Heading 1
+	Text  string // its text, white space collapsed
+	ID    string // the id of its element in the output
+}
+
+// DocumentHeadings returns the headings of m in document order, with the
+// ids the renderer gives them under opts, for building a table of
+// contents outside the document.
+func DocumentHeadings(m DocumentModel, opts RenderOptions) []Heading {
+	x := newHeadingIndex(opts.Accessible, opts.IDPrefix, opts.Revisions)
+	for _, blk := range m.Blocks {
+		x.add(blk)
+	}
+	headings := make([]Heading, len(x.toc))
+	for i, e := range x.toc {
+		headings[i] = Heading{Level: e.level, Text: e.text, ID: e.id}
+	}
+	return headings
+}
+
+// -----------------------------------------------------------------------------
+// Note rendering
+// -----------------------------------------------------------------------------
+
+// noteAnchor returns the id of a note in the notes section and of its first
+// reference, e.g. "docx-footnote-2" and "docx-footnote-ref-2".
+func (hr *htmlRenderer) noteAnchor(n NoteReference) (note, ref string) {
+	p := hr.opts.IDPrefix
+	return fmt.Sprintf("%sdocx-%s-%d", p, n.Kind, n.ID), fmt.Sprintf("%sdocx-%s-ref-%d", p, n.Kind, n.ID)
+}
+
+// renderNoteRefHTML renders a note reference mark.  When the note body is
+// rendered the mark links to it, and the first reference is the target of
+// the note's back link.  Custom marks are the text of the following run, so
+// only the anchor is emitted for them.
+func (hr *htmlRenderer) renderNoteRefHTML(n NoteReference) string {
+	k := noteKey{n.Kind, n.ID}
+	noteID, refID := hr.noteAnchor(n)
+	idAttr := ""
+	if hr.notes[k] && !hr.noteRefs[k] {
+		if hr.noteRefs == nil {
+			hr.noteRefs = make(map[noteKey]bool)
+		}
+		hr.noteRefs[k] = true
+		idAttr = fmt.Sprintf(" id=\"%s\"", refID)
+	}
+	if n.Mark == "" {
+		if idAttr == "" {
+			return ""
+		}
+		return fmt.Sprintf("<a%s></a>", idAttr)
+	}
+	mark := html.EscapeString(n.Mark)
+	if hr.notes[k] {
+		mark = fmt.Sprintf("<a%s href=\"#%s\">%s</a>", idAttr, noteID, mark)
+	}
+	return fmt.Sprintf("<sup class=\"docx-noteref\" data-note=\"%s\" data-note-id=\"%d\">%s</sup>", n.Kind, n.ID, mark)
+}
+
+// renderNotesHTML renders the notes of one kind as an <ol>, each item
+// starting with its mark linking back to the reference.  section selects the
+// notes referenced from one section; -1 selects all.  The list is unnumbered
+// since marks may be letters, symbols or custom text.
+func (hr *htmlRenderer) renderNotesHTML(notes []Note, kind string, section int) string {
+	var b strings.Builder
+	for _, n := range notes {
+		if n.Kind != kind || (section >= 0 && n.Section != section) {
+			continue
+		}
+		if b.Len() == 0 {
+			b.WriteString(fmt.Sprintf("<ol class=\"docx-notes docx-%ss\">\n", kind))
+		}
+		noteID, refID := hr.noteAnchor(n.NoteReference)
+		mark := n.Mark
+		if mark == "" {
+			mark = "\u21a9" // ↩ for custom marks, which the note text repeats
+		}
+		b.WriteString(fmt.Sprintf("<li id=\"%s\"><a class=\"docx-noteback\" href=\"#%s\">%s</a>\n", noteID, refID, html.EscapeString(mark)))
+		hr.renderBlocks(n.Blocks, func(s string) { b.WriteString(s) })
+		b.WriteString("</li>\n")
+	}
+	if b.Len() > 0 {
+		b.WriteString("</ol>\n")
+	}
+	return b.String()
+}
+
+// -----------------------------------------------------------------------------
+// Comment rendering
+// -----------------------------------------------------------------------------
+
+// CommentMode selects how review comments are rendered.
+type CommentMode int
+
+const (
+	// CommentsStrip omits comments.
+	CommentsStrip CommentMode = iota
+	// CommentsInline highlights commented text with <mark>, the comments
+	// with their authors and dates shown as its title tooltip.
+	CommentsInline
+	// CommentsMargin highlights commented text and lists the comments in an
+	// aside column next to the body, keyed by comment id.
+	CommentsMargin
+)
+
+// commentLabel returns the reference label Word shows for a comment: the
+// author's initials and the comment's position, e.g. "JD3".
+func (hr *htmlRenderer) commentLabel(id int64) string {
+	c := hr.comments[id]
+	return fmt.Sprintf("%s%d", c.Initials, hr.commentIndex[id])
+}
+
+// commentTitle returns the tooltip text of the given comments, each as
+// "Author (date): text".
+func (hr *htmlRenderer) commentTitle(ids []int64) string {
+	var parts []string
+	for _, id := range ids {
+		if c, ok := hr.comments[id]; ok {
+			author := c.Author
+			if !c.Date.IsZero() {
+				author += " (" + c.Date.Format("2006-01-02 15:04") + ")"
+			}
+			parts = append(parts, author+": "+blocksText(c.Blocks))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// markCommented wraps the HTML of a run covered by comments in a <mark>.
+func (hr *htmlRenderer) markCommented(s string, ids []int64) string {
+	if hr.opts.Comments == CommentsStrip || len(ids) == 0 {
+		return s
+	}
+	var known []string
+	for _, id := range ids {
+		if _, ok := hr.comments[id]; ok {
+			known = append(known, fmt.Sprint(id))
+		}
+	}
+	if len(known) == 0 {
+		return s
+	}
+	title := ""
+	if hr.opts.Comments == CommentsInline {
+		title = fmt.Sprintf(" title=\"%s\"", html.EscapeString(hr.commentTitle(ids)))
+	}
+	return fmt.Sprintf("<mark class=\"docx-comment\" data-comment-ids=\"%s\"%s>%s</mark>", strings.Join(known, " "), title, s)
+}
+
+// renderCommentRefHTML renders a comment reference mark: a tooltip in inline
+// mode, a link to the comment in the margin column otherwise.
+func (hr *htmlRenderer) renderCommentRefHTML(id int64) string {
+	if _, ok := hr.comments[id]; !ok || hr.opts.Comments == CommentsStrip {
+		return ""
+	}
+	label := html.EscapeString(hr.commentLabel(id))
+	if hr.opts.Comments == CommentsInline {
+		return fmt.Sprintf("<sup class=\"docx-comment-ref\" data-comment-id=\"%d\" title=\"%s\">[%s]</sup>",
+			id, html.EscapeString(hr.commentTitle([]int64{id})), label)
+	}
+	p := hr.opts.IDPrefix
+	return fmt.Sprintf("<sup class=\"docx-comment-ref\" data-comment-id=\"%d\"><a id=\"%sdocx-comment-ref-%d\" href=\"#%sdocx-comment-%d\">[%s]</a></sup>",
+		id, p, id, p, id, label)
+}
+
+// renderCommentsAsideHTML renders the margin column of comments.
+func (hr *htmlRenderer) renderCommentsAsideHTML(comments []Comment) string {
+	var b strings.Builder
+	b.WriteString("<aside class=\"docx-comments\">\n")
+	for _, c := range comments {
+		b.WriteString(fmt.Sprintf("<div class=\"docx-comment\" id=\"%sdocx-comment-%d\" data-comment-id=\"%d\">\n", hr.opts.IDPrefix, c.ID, c.ID))
+		meta := html.EscapeString(c.Author)
+		if !c.Date.IsZero() {
+			meta += fmt.Sprintf(" <time datetime=\"%s\">%s</time>", c.Date.Format(time.RFC3339), c.Date.Format("2006-01-02 15:04"))
+		}
+		b.WriteString(fmt.Sprintf("<div class=\"docx-comment-meta\"><a href=\"#%sdocx-comment-ref-%d\">[%s]</a> %s</div>\n",
+			hr.opts.IDPrefix, c.ID, html.EscapeString(hr.commentLabel(c.ID)), meta))
+		hr.renderBlocks(c.Blocks, func(s string) { b.WriteString(s) })
+		b.WriteString("</div>\n")
+	}
+	b.WriteString("</aside>\n")
+	return b.String()
+}
+
+// -----------------------------------------------------------------------------
+// List rendering
+// -----------------------------------------------------------------------------
+
+// isListItem reports whether p is a numbered or bulleted paragraph.
+func isListItem(p RenderParagraph) bool {
+	return p.Style.ListType == "ordered" || p.Style.ListType == "unordered"
+}
+
+// openList is a list element left open while rendering nested lists.
+type openList struct {
+	tag   string // "ol" | "ul"
+	level int
+	id    int
+	next  int // number the next item continues with, 0 if unknown
+}
+
+// renderListHTML renders consecutive list paragraphs as nested <ul>/<ol>
+// trees.  A list is nested inside the preceding item when the level goes up;
+// skipped levels get an unmarked wrapper item.  A change of list type or
+// list instance at the same level, or a number that does not continue the
+// current list, starts a new list.
+func (hr *htmlRenderer) renderListHTML(items []*RenderParagraph) string {
+	var (
+		b     strings.Builder
+		stack []openList
+	)
+	closeTop := func() {
+		b.WriteString("</li>\n</" + stack[len(stack)-1].tag + ">\n")
+		stack = stack[:len(stack)-1]
+	}
+	for _, item := range items {
+		st := item.Style
+		level := st.ListLevel
+		if level < 0 {
+			level = 0
+		}
+		tag := "ul"
+		if st.ListType == "ordered" {
+			tag = "ol"
+		}
+		for len(stack) > 0 && stack[len(stack)-1].level > level {
+			closeTop()
+		}
+		if len(stack) > 0 {
+			top := stack[len(stack)-1]
+			restart := st.ListNumber > 0 && top.next > 0 && st.ListNumber != top.next
+			if top.level == level && (top.tag != tag || top.id != st.ListID || restart) {
+				closeTop()
+			}
+		}
+		if len(stack) > 0 && stack[len(stack)-1].level == level {
+			b.WriteString("</li>\n")
+		} else {
+			base := 0
+			if len(stack) > 0 {
+				base = stack[len(stack)-1].level + 1
+			}
+			for l := base; l <= level; l++ {
+				t, start, marker := tag, st.ListNumber, st.ListMarker
+				if l < level {
+					t, start, marker = "ul", 0, ""
+				}
+				var attrs string
+				if start > 1 {
+					attrs = fmt.Sprintf(" start=\"%d\"", start)
+				}
+				if marker = csssafe.Keyword(marker); marker != "" && marker != "decimal" {
+					attrs += hr.styleAttr("list-style-type:" + marker + ";")
+				}
+				b.WriteString("<" + t + attrs + ">\n")
+				stack = append(stack, openList{tag: t, level: l, id: st.ListID})
+				if l < level {
+					b.WriteString("<li style=\"list-style-type:none;\">")
+				}
+			}
+		}
+		top := &stack[len(stack)-1]
+		if st.ListNumber > 0 {
+			top.next = st.ListNumber + 1
+		}
+		b.WriteString(strings.TrimSuffix(hr.renderParagraphElement("li", item), "</li>\n"))
+	}
+	for len(stack) > 0 {
+		closeTop()
+	}
+	return b.String()
 }
 
 // -----------------------------------------------------------------------------
 // Table rendering
 // -----------------------------------------------------------------------------
 
-func renderTableHTML(t RenderTable) string {
+func (hr *htmlRenderer) renderTableHTML(t RenderTable) string {
+	return renderHooked(hr.opts.Renderers.Table, &t, func() string { return hr.tableHTML(t) })
+}
+
+// tableHTML is the built-in rendering of renderTableHTML.
+func (hr *htmlRenderer) tableHTML(t RenderTable) string {
 	var b strings.Builder
-	b.WriteString("<table style=\"border-collapse:collapse;\">\n")
-	for _, row := range t.Rows {
+	attrs := contentControlAttrs(t.ContentControl) + hr.sourceAttr(t.Source)
+	if t.Description != "" {
+		attrs += fmt.Sprintf(" summary=\"%s\"", html.EscapeString(t.Description))
+	}
+	b.WriteString(fmt.Sprintf("<table%s%s>\n", hr.styleAttr("border-collapse:collapse;"), attrs))
+	if t.Caption != "" {
+		b.WriteString(fmt.Sprintf("  <caption>%s</caption>\n", html.EscapeString(t.Caption)))
+	}
+	// Accessible output marks up header rows with <th>.  Header rows are the
+	// leading rows flagged to repeat on each page, else the first row.
+	headerRows := 0
+	if hr.opts.Accessible {
+		for headerRows < len(t.Rows) && t.Rows[headerRows].Header {
+			headerRows++
+		}
+		if headerRows == 0 && len(t.Rows) > 1 {
+			headerRows = 1
+		}
+	}
+	for i, row := range t.Rows {
+		cellTag, scope := "td", ""
+		if i < headerRows {
+			cellTag, scope = "th", " scope=\"col\""
+		}
 		b.WriteString("  <tr>")
 		for _, cell := range row.Cells {
 			// Guard against nil cells (shouldn't happen normally)
@@ -199,11 +1035,7 @@ func renderTableHTML(t RenderTable) string {
 			if len(cell.Paragraphs) == 0 {
 				cellHTML = "&nbsp;"
 			} else {
-				var paraB strings.Builder
-				for _, p := range cell.Paragraphs {
-					paraB.WriteString(renderParagraphHTML(p))
-				}
-				cellHTML = paraB.String()
+				cellHTML = hr.renderParagraphsHTML(cell.Paragraphs)
 			}
 
 			css := cellStyleToCSS(cell.Style)
@@ -217,15 +1049,15 @@ func renderTableHTML(t RenderTable) string {
 			if cell.WidthPx > 0 {
 				css += fmt.Sprintf("width:%.0fpx;", cell.WidthPx)
 			}
-			debugAttr := ""
-			if DebugHTML {
-				debugAttr = fmt.Sprintf(" data-cell-style=\"%s\"", html.EscapeString(cell.Style.String()))
+			debugAttr := hr.sourceAttr(cell.Source)
+			if hr.debug() {
+				debugAttr += fmt.Sprintf(" data-cell-style=\"%s\"", html.EscapeString(cell.Style.String()))
 			}
+			cellCSS := "border:1px solid #333; padding:4px;"
 			if css != "" {
-				b.WriteString(fmt.Sprintf("    <td%s style=\"%s border:1px solid #333; padding:4px;\"%s>%s</td>", spanAttr, css, debugAttr, cellHTML))
-			} else {
-				b.WriteString(fmt.Sprintf("    <td%s style=\"border:1px solid #333; padding:4px;\"%s>%s</td>", spanAttr, debugAttr, cellHTML))
+				cellCSS = css + " " + cellCSS
 			}
+			b.WriteString(fmt.Sprintf("    <%s%s%s%s%s>%s</%s>", cellTag, scope, spanAttr, hr.styleAttr(cellCSS), debugAttr, cellHTML, cellTag))
 		}
 		b.WriteString("  </tr>\n")
 	}
@@ -233,6 +1065,32 @@ func renderTableHTML(t RenderTable) string {
 	return b.String()
 }
 
+// -----------------------------------------------------------------------------
+// altChunk rendering
+// -----------------------------------------------------------------------------
+
+// renderAltChunkHTML renders imported altChunk content.  HTML chunks were
+// sanitised while parsing; other chunks are rendered as text paragraphs.
+func (hr *htmlRenderer) renderAltChunkHTML(a AltChunk) string {
+	var b strings.Builder
+	b.WriteString("<div class=\"docx-altchunk\">\n")
+	if a.HTML != "" {
+		b.WriteString(a.HTML)
+		b.WriteString("\n")
+	} else {
+		for _, line := range strings.Split(a.Text, "\n") {
+			if line = strings.TrimRight(line, "\r"); line != "" {
+				b.WriteString(fmt.Sprintf("<p>%s</p>\n", html.EscapeString(line)))
+			}
+		}
+	}
+	b.WriteString("</div>\n")
+	if a.Change != "" {
+		return hr.renderChangeHTML(RenderRun{Change: a.Change}, b.String()) + "\n"
+	}
+	return b.String()
+}
+
 // -----------------------------------------------------------------------------
 // Top-level rendering entry point
 // -----------------------------------------------------------------------------
@@ -240,27 +1098,590 @@ func renderTableHTML(t RenderTable) string {
 // RenderDocumentHTML converts the DocumentModel into an HTML string.
 func RenderDocumentHTML(m DocumentModel) string {
 	var b strings.Builder
+	_ = RenderDocumentHTMLTo(&b, m, RenderOptions{})
+	return b.String()
+}
+
+// RenderOptions controls HTML rendering.  The zero value produces the same
+// output as RenderDocumentHTML.
+type RenderOptions struct {
+	// Debug includes extra data attributes with raw style info.  It
+	// replaces the deprecated DebugHTML package variable.
+	Debug bool
+	// Standalone wraps the output in a complete HTML document with the
+	// stylesheet from DocumentCSS in its head.  By default only the body
+	// content is emitted, ready to be embedded into an existing page.
+	Standalone bool
+	// FootnotesPerSection renders footnotes at the end of the section that
+	// references them rather than at the end of the document.  Endnotes
+	// always follow the document.
+	FootnotesPerSection bool
+	// PageLayout lays the body out in fixed-size page divs sized from each
+	// section's page setup, approximating Word's pagination.  Each page
+	// carries its section's header and footer, with PAGE, NUMPAGES and
+	// SECTIONPAGES fields set to the simulated page numbers.  Notes follow
+	// the last page.
+	PageLayout bool
+	// Accessible adjusts the output towards WCAG conformance: heading levels
+	// are renumbered so none is skipped, the language is always declared
+	// (falling back to "en", on a wrapper div for fragments), standalone
+	// documents fall back to the first heading for their title, and table
+	// header rows are emitted as <th>.
+	// Images always carry alt text, taken from the document where present.
+	Accessible bool
+	// ExternalCSS replaces the inline style of runs, paragraphs and tables
+	// with generated classes so their rules can be served from a shared
+	// stylesheet; see RenderDocumentBody and RenderDocumentCSS.
+	ExternalCSS bool
+	// StylesheetHref adds a <link rel="stylesheet"> to the head of standalone
+	// output, e.g. for a shared stylesheet built with RenderDocumentCSS.
+	StylesheetHref string
+	// Comments selects how review comments are rendered; by default they
+	// are omitted.
+	Comments CommentMode
+	// Revisions selects whether tracked changes are accepted, rejected or
+	// shown; by default they are accepted.
+	Revisions RevisionsMode
+	// SemanticTags emits <strong>, <em>, <u>, <s>, <sup> and <sub> for bold,
+	// italic, underlined, struck-through, superscript and subscript runs
+	// instead of expressing them in the span's style.  Runs with no other
+	// formatting are written as bare text.
+	SemanticTags bool
+	// TableOfContents prepends a nested list of links to the document's
+	// headings.  Headings get stable ids whether or not it is set.
+	TableOfContents bool
+	// IDPrefix is prepended to every id the output declares (headings,
+	// bookmarks, notes and comments) and to the links to them, so the
+	// output of several documents can share one page.
+	IDPrefix string
+	// SourceMap adds a data-src attribute to paragraphs, runs, tables and
+	// table cells holding the location of the OOXML element they were
+	// converted from (the Source field of the model), so a selection in the
+	// HTML can be traced back to the original file.  A location is a
+	// slash-separated path of 0-based element indices in document order:
+	//
+	//	p12           the 13th w:p of the body, counting paragraphs inside
+	//	              tables and content controls
+	//	p12/r3        the 4th w:r of that paragraph, counting runs inside
+	//	              hyperlinks, fields and other inline wrappers
+	//	tbl2/tr0/tc1  the 2nd w:tc of the 1st w:tr of the 3rd w:tbl
+	//
+	// Content outside the body is prefixed with its container:
+	// "footnote3/p0" (the note with w:id 3), "endnote1/p0/r2",
+	// "comment7/p0", "header1/p0" for the part word/header1.xml (likewise
+	// footers), and "altChunk-rId8/p4" for a DOCX imported through the
+	// altChunk with r:id rId8.
+	SourceMap bool
+	// ImageHandler decides the src of every emitted image; see the media
+	// package for the built-in strategies.  nil inlines images as data URIs.
+	ImageHandler media.ImageHandler
+	// URLRewriter, if set, is applied to every URL taken from the document
+	// or the options before it is emitted: hyperlink targets, image
+	// sources (after ImageHandler) and StylesheetHref, e.g. to route
+	// external links through a proxy or strip tracking parameters.  It
+	// returns the URL to emit, or false to drop it: a hyperlink then
+	// renders as plain text and an image as its placeholder.  The links
+	// between notes, comments and the table of contents are not passed.
+	URLRewriter func(url string) (string, bool)
+	// Renderers overrides the rendering of chosen paragraphs, tables and
+	// embedded objects; see the Renderers type.
+	Renderers Renderers
+	// MetafileRasterizer converts WMF and EMF images that cannot be
+	// converted to SVG (see media.MetafileToSVG) to PNG.  nil leaves them
+	// out.
+	MetafileRasterizer media.MetafileRasterizer
+	// RedactImages replaces every image with a neutral box of the same
+	// size labelled with the object type and original file name, for
+	// previews that must not show embedded photos or screenshots.
+	RedactImages bool
+	// Watermark is text written diagonally across every page with
+	// PageLayout, and across the window (and every printed page)
+	// otherwise, e.g. "CONFIDENTIAL".
+	Watermark string
+	// Banner is text shown in a bar at the top of every page with
+	// PageLayout, and kept at the top of the window otherwise, e.g.
+	// "CONFIDENTIAL — Client — 2024-05-01 10:00".
+	Banner string
+	// Locale is the BCP 47 language tag declared for documents that do not
+	// name their language, e.g. "de-DE"; with Accessible it replaces the
+	// "en" fallback.
+	Locale string
+	// Warnings, if set, collects the problems met while rendering, such as
+	// images that cannot be shown.
+	Warnings *diag.List
+	// FontSubstitutes extends every font-family with replacements for
+	// fonts clients may not have; nil means fonts.Default and an empty map
+	// emits the document's fonts alone.
+	FontSubstitutes fonts.Substitutes
+	// NormalizeText, if set, is applied to the output after invalid UTF-8
+	// and disallowed control characters are repaired, e.g. norm.NFC.String
+	// from golang.org/x/text.  It sees markup as well as text, so it must
+	// leave ASCII unchanged.
+	NormalizeText func(string) string
+}
+
+// documentCSS styles the page around the rendered blocks.  Block and run
+// formatting is emitted inline, so a fragment renders correctly without it.
+const documentCSS = `body { margin: 2em auto; max-width: 50em; padding: 0 1em; }
+table { margin: 0.5em 0; }
+sup.docx-noteref { line-height: 0; }
+ol.docx-notes { list-style: none; padding-left: 0; border-top: 1px solid #ccc; font-size: 0.9em; }
+ol.docx-notes > li > p:first-of-type { display: inline; }
+body:has(> div.docx-page) { max-width: none; background: #eee; }
+body:has(> div.docx-commented) { max-width: 70em; }
+mark.docx-comment { background: #fff3b0; }
+aside.docx-comments { font-size: 0.85em; }
+div.docx-comment { border-left: 3px solid #e0c000; padding: 0.25em 0.5em; margin-bottom: 1em; }
+div.docx-comment-meta { color: #555; }
+ins.docx-ins { color: #1a6f2a; text-decoration: underline; }
+del.docx-del { color: #b3261e; text-decoration: line-through; }
+div.docx-page { margin: 1em auto; background: #fff; box-shadow: 0 0 4px rgba(0, 0, 0, 0.3); }
+@media print { div.docx-page { margin: 0; box-shadow: none; break-after: page; } }
+`
+
+// DocumentCSS returns the stylesheet used by standalone output, for callers
+// embedding fragments who want the same page styling.
+func DocumentCSS() string {
+	return documentCSS
+}
+
+// RenderDocumentBody renders m as an HTML fragment whose formatting refers
+// to generated classes instead of inline styles.  Pair it with
+// RenderDocumentCSS; because class names derive from the declarations, the
+// stylesheets of many documents can be merged into one shared file.  It
+// returns the first image handler error, as RenderDocumentHTMLTo does.
+func RenderDocumentBody(m DocumentModel, opts RenderOptions) (string, error) {
+	opts.ExternalCSS, opts.Standalone = true, false
+	var b strings.Builder
+	if err := RenderDocumentHTMLTo(&b, m, opts); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// RenderDocumentCSS returns the stylesheet for RenderDocumentBody output:
+// the DocumentCSS page styling followed by one rule per generated class,
+// sorted by class name.
+func RenderDocumentCSS(m DocumentModel, opts RenderOptions) string {
+	opts.ExternalCSS, opts.Standalone = true, false
+	opts.ImageHandler = func(media.Image) (string, error) { return "", nil } // output is discarded
+	hr := &htmlRenderer{opts: opts, w: io.Discard, classes: make(map[string]string)}
+	hr.render(m)
+	names := make([]string, 0, len(hr.classes))
+	for name := range hr.classes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString(documentCSS)
+	for _, name := range names {
+		b.WriteString(fmt.Sprintf(".%s { %s }\n", name, hr.classes[name]))
+	}
+	return b.String()
+}
+
+// RenderDocumentHTMLTo renders the DocumentModel as HTML to w.  Output is
+// written block by block, so memory use is bounded by the largest block
+// rather than the whole document.  It returns the first write or image
+// handler error.
+func RenderDocumentHTMLTo(w io.Writer, m DocumentModel, opts RenderOptions) error {
+	hr := &htmlRenderer{opts: opts, w: w}
+	hr.render(m)
+	return hr.err
+}
+
+// StreamDocumentHTML converts a DOCX document to HTML on w, rendering each
+// top-level block as soon as it is parsed, so neither the document model
+// nor the output is held in memory as a whole.  Use it for very large
+// documents.
+//
+// Options that need the whole document before the body is written are
+// degraded: TableOfContents is omitted, PageLayout is ignored, footnotes go
+// at the end rather than per section and the accessible title fallback to
+// the first heading is not applied.  Output is otherwise identical to
+// RenderDocumentHTMLTo on the parsed model.
+func StreamDocumentHTML(w io.Writer, r io.ReaderAt, size int64, opts RenderOptions) (err error) {
+	defer panics.Catch(&err)
+	p, err := openParser(r, size, ParseOptions{})
+	if err != nil {
+		return err
+	}
+	opts.TableOfContents = false
+	opts.PageLayout = false
+	opts.FootnotesPerSection = false
+	hr := &htmlRenderer{opts: opts, w: w, headings: newHeadingIndex(opts.Accessible, opts.IDPrefix, opts.Revisions)}
+	notes := make(map[noteKey]bool, len(p.noteBodies))
+	for k := range p.noteBodies {
+		notes[k] = true
+	}
+	hr.begin(p.mdl, notes)
 
-	if len(m.Blocks) > 0 {
-		for _, blk := range m.Blocks {
-			if blk.Paragraph != nil {
-				b.WriteString(renderParagraphHTML(*blk.Paragraph))
-			} else if blk.Table != nil {
-				b.WriteString(renderTableHTML(*blk.Table))
+	// Consecutive list items are rendered together so they nest.
+	var list []*RenderParagraph
+	flush := func() {
+		if len(list) > 0 {
+			hr.write(hr.renderListHTML(list))
+			list = nil
+		}
+	}
+	p.emit = func(blk DocumentBlock) error {
+		hr.headings.add(blk)
+		if blk.Paragraph != nil && isListItem(*blk.Paragraph) {
+			list = append(list, blk.Paragraph)
+			return hr.err
+		}
+		flush()
+		hr.renderBlocks([]DocumentBlock{blk}, hr.write)
+		return hr.err
+	}
+	p.walkBody()
+	flush()
+	if p.err != nil {
+		return p.err
+	}
+	p.emit = nil
+	p.finish()
+	hr.end(p.mdl)
+	return hr.err
+}
+
+// render writes the document.
+func (hr *htmlRenderer) render(m DocumentModel) {
+	opts := hr.opts
+	hr.headings = newHeadingIndex(opts.Accessible, opts.IDPrefix, opts.Revisions)
+	for _, blk := range m.Blocks {
+		hr.headings.add(blk)
+	}
+	notes := make(map[noteKey]bool, len(m.Notes))
+	for _, n := range m.Notes {
+		notes[noteKey{n.Kind, n.ID}] = true
+	}
+	hr.begin(m, notes)
+	if opts.PageLayout && len(m.Blocks) > 0 {
+		pages := paginate(m.Blocks, m.Sections)
+		numbers, sectionPages := pageNumbers(pages)
+		for i, pg := range pages {
+			hr.fields = map[string]int{"PAGE": numbers[i], "NUMPAGES": len(pages), "SECTIONPAGES": sectionPages[pg.index]}
+			hr.write(pageOpenTag(pg.section))
+			hr.renderOverlays("absolute", "absolute")
+			hr.renderPageHeaders(pg)
+			hr.renderBlocks(pg.blocks, hr.write)
+			hr.write("</div>\n")
+		}
+		hr.fields = nil
+	} else if len(m.Blocks) > 0 {
+		section, start := 0, 0
+		for i, blk := range m.Blocks {
+			if blk.Paragraph == nil || !blk.Paragraph.SectionEnd {
+				continue
+			}
+			hr.renderBlocks(m.Blocks[start:i+1], hr.write)
+			if opts.FootnotesPerSection {
+				hr.write(hr.renderNotesHTML(m.Notes, noteFootnote, section))
 			}
+			section, start = section+1, i+1
+		}
+		hr.renderBlocks(m.Blocks[start:], hr.write)
+		if opts.FootnotesPerSection {
+			hr.write(hr.renderNotesHTML(m.Notes, noteFootnote, section))
 		}
 	} else {
 		// Fallback to legacy behaviour if Blocks not populated
-		for _, p := range m.Paragraphs {
-			b.WriteString(renderParagraphHTML(p))
-		}
+		hr.write(hr.renderParagraphsHTML(m.Paragraphs))
 		for _, tbl := range m.Tables {
-			b.WriteString(renderTableHTML(tbl))
+			hr.write(hr.renderTableHTML(tbl))
+		}
+	}
+	hr.end(m)
+}
+
+// begin writes everything before the body: the head or language wrapper,
+// the table of contents and the comment layout.  notes are the notes whose
+// bodies will appear in the notes section.
+func (hr *htmlRenderer) begin(m DocumentModel, notes map[noteKey]bool) {
+	opts := hr.opts
+	props := m.Properties
+	if props.Language == "" {
+		props.Language = opts.Locale
+	}
+	if opts.Accessible {
+		if props.Language == "" {
+			props.Language = "en"
+		}
+		if props.Title == "" && len(hr.headings.toc) > 0 {
+			props.Title = hr.headings.toc[0].text
+		}
+	}
+	if opts.Standalone {
+		stylesheet := opts.StylesheetHref
+		if stylesheet != "" {
+			stylesheet, _ = hr.rewriteURL(stylesheet) // "" if dropped
+		}
+		hr.write(documentHead(props, stylesheet))
+	} else if opts.Accessible {
+		hr.write(fmt.Sprintf("<div lang=\"%s\">\n", html.EscapeString(props.Language)))
+	}
+	if !opts.PageLayout || len(m.Blocks) == 0 {
+		hr.renderOverlays("fixed", "sticky")
+	}
+	if opts.TableOfContents {
+		hr.write(renderTOCHTML(hr.headings.toc))
+	}
+	if opts.Comments != CommentsStrip {
+		hr.comments = make(map[int64]Comment, len(m.Comments))
+		hr.commentIndex = make(map[int64]int, len(m.Comments))
+		for i, c := range m.Comments {
+			hr.comments[c.ID] = c
+			hr.commentIndex[c.ID] = i + 1
 		}
 	}
+	if hr.commentMargin(m) {
+		hr.write("<div class=\"docx-commented\" style=\"display:grid;grid-template-columns:minmax(0,1fr) 16em;gap:2em;\">\n<div class=\"docx-body\">\n")
+	}
+	hr.notes = notes
+}
+
+// end writes everything after the body: the notes, the comment aside and
+// the closing tags opened by begin.
+func (hr *htmlRenderer) end(m DocumentModel) {
+	opts := hr.opts
+	if !opts.FootnotesPerSection || opts.PageLayout || len(m.Blocks) == 0 {
+		hr.write(hr.renderNotesHTML(m.Notes, noteFootnote, -1))
+	}
+	hr.write(hr.renderNotesHTML(m.Notes, noteEndnote, -1))
+	if hr.commentMargin(m) {
+		hr.write("</div>\n" + hr.renderCommentsAsideHTML(m.Comments) + "</div>\n")
+	}
+	if opts.Standalone {
+		hr.write("</body>\n</html>\n")
+	} else if opts.Accessible {
+		hr.write("</div>\n")
+	}
+}
+
+// commentMargin reports whether comments are laid out beside the body.
+func (hr *htmlRenderer) commentMargin(m DocumentModel) bool {
+	return hr.opts.Comments == CommentsMargin && len(m.Comments) > 0
+}
+
+// documentHead renders the start of a standalone document, up to and
+// including <body>, with metadata taken from the document properties.
+func documentHead(p DocProperties, stylesheet string) string {
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n")
+	if p.Language != "" {
+		b.WriteString(fmt.Sprintf("<html lang=\"%s\">\n", html.EscapeString(p.Language)))
+	} else {
+		b.WriteString("<html>\n")
+	}
+	b.WriteString("<head>\n<meta charset=\"utf-8\">\n")
+	if p.Title != "" {
+		b.WriteString(fmt.Sprintf("<title>%s</title>\n", html.EscapeString(p.Title)))
+	}
+	for _, meta := range []struct{ name, content string }{
+		{"author", p.Author},
+		{"description", p.Description},
+		{"keywords", p.Keywords},
+	} {
+		if meta.content != "" {
+			b.WriteString(fmt.Sprintf("<meta name=\"%s\" content=\"%s\">\n", meta.name, html.EscapeString(meta.content)))
+		}
+	}
+	b.WriteString("<style>\n" + documentCSS + "</style>\n")
+	if stylesheet != "" {
+		b.WriteString(fmt.Sprintf("<link rel=\"stylesheet\" href=\"%s\">\n", html.EscapeString(stylesheet)))
+	}
+	b.WriteString("</head>\n<body>\n")
 	return b.String()
 }
 
+// htmlRenderer carries the per-call rendering state.
+type htmlRenderer struct {
+	opts RenderOptions
+	w    io.Writer
+	err  error // first write error; later writes are skipped
+
+	headings *headingIndex
+
+	classes map[string]string // generated class -> declarations, for RenderDocumentCSS
+
+	comments     map[int64]Comment
+	commentIndex map[int64]int    // 1-based position of each comment
+	notes        map[noteKey]bool // notes with a body in the notes section
+	fields       map[string]int   // values of page-number fields on the page being rendered
+	noteRefs     map[noteKey]bool // notes whose first reference has been emitted
+
+	revisionAuthors map[string]int // authors of tracked changes, by order of first change
+}
+
+func (hr *htmlRenderer) debug() bool {
+	return hr.opts.Debug || DebugHTML
+}
+
+// renderPageHeaders writes the header and footer of a page, positioned in
+// its top and bottom margins.
+func (hr *htmlRenderer) renderPageHeaders(pg page) {
+	s := pg.section
+	header, footer := s.Header, s.Footer
+	if pg.first && s.TitlePage {
+		header, footer = s.FirstHeader, s.FirstFooter
+	}
+	if len(header) > 0 {
+		hr.write(fmt.Sprintf("<div class=\"docx-header\" style=\"position:absolute;top:%.1fpt;left:%.1fpt;right:%.1fpt;\">\n", s.HeaderPt, s.MarginLeftPt, s.MarginRightPt))
+		hr.renderBlocks(header, hr.write)
+		hr.write("</div>\n")
+	}
+	if len(footer) > 0 {
+		hr.write(fmt.Sprintf("<div class=\"docx-footer\" style=\"position:absolute;bottom:%.1fpt;left:%.1fpt;right:%.1fpt;\">\n", s.FooterPt, s.MarginLeftPt, s.MarginRightPt))
+		hr.renderBlocks(footer, hr.write)
+		hr.write("</div>\n")
+	}
+}
+
+// renderOverlays writes the watermark and banner, if any, with the given
+// CSS positions.
+func (hr *htmlRenderer) renderOverlays(watermark, banner string) {
+	if hr.opts.Watermark != "" {
+		hr.write(overlay.Watermark("docx-watermark", hr.opts.Watermark, watermark))
+	}
+	if hr.opts.Banner != "" {
+		hr.write(overlay.Banner("docx-banner", hr.opts.Banner, banner))
+	}
+}
+
+// pageOpenTag opens a page div with the section's page size and margins.
+// The height is a minimum: paginate only estimates how much fits on a
+// page, and a page holding more grows rather than cutting text off.
+func pageOpenTag(s Section) string {
+	return fmt.Sprintf("<div class=\"docx-page\" style=\"position:relative;box-sizing:border-box;width:%.1fpt;min-height:%.1fpt;padding:%.1fpt %.1fpt %.1fpt %.1fpt;\">\n",
+		s.PageWidthPt, s.PageHeightPt, s.MarginTopPt, s.MarginRightPt, s.MarginBottomPt, s.MarginLeftPt)
+}
+
+// renderBlocks renders a sequence of blocks, grouping list paragraphs into
+// lists, and passes the HTML of each top-level element to emit.
+func (hr *htmlRenderer) renderBlocks(blocks []DocumentBlock, emit func(string)) {
+	for i := 0; i < len(blocks); i++ {
+		blk := blocks[i]
+		if blk.Paragraph != nil && isListItem(*blk.Paragraph) {
+			var items []*RenderParagraph
+			for ; i < len(blocks) && blocks[i].Paragraph != nil && isListItem(*blocks[i].Paragraph); i++ {
+				items = append(items, blocks[i].Paragraph)
+			}
+			i--
+			emit(hr.renderListHTML(items))
+		} else if blk.Paragraph != nil {
+			emit(hr.renderParagraphHTML(blk.Paragraph))
+		} else if blk.Table != nil {
+			emit(hr.renderTableHTML(*blk.Table))
+		} else if blk.AltChunk != nil {
+			emit(hr.renderAltChunkHTML(*blk.AltChunk))
+		}
+	}
+}
+
+// rewriteURL applies the URLRewriter, if set, to u.
+func (hr *htmlRenderer) rewriteURL(u string) (string, bool) {
+	if hr.opts.URLRewriter == nil {
+		return u, true
+	}
+	u, ok := hr.opts.URLRewriter(u)
+	return u, ok && u != ""
+}
+
+// href returns the rewritten target of hyperlink href, or "" if it is
+// dropped or its scheme is not safe to emit.
+func (hr *htmlRenderer) href(href string) string {
+	if href == "" {
+		return ""
+	}
+	href, ok := hr.rewriteURL(href)
+	if !ok {
+		return ""
+	}
+	if anchor, ok := strings.CutPrefix(href, "#"); ok {
+		return "#" + hr.opts.IDPrefix + anchor
+	}
+	return safeHref(href)
+}
+
+// imageSrc returns the src for img from the configured ImageHandler.  A
+// handler error is kept as the render error and reported as !ok.
+func (hr *htmlRenderer) imageSrc(img media.Image) (string, bool) {
+	handler := hr.opts.ImageHandler
+	if handler == nil {
+		handler = media.DataURI
+	}
+	src, err := handler(img)
+	if err != nil {
+		if hr.err == nil {
+			hr.err = err
+		}
+		return "", false
+	}
+	return src, true
+}
+
+// styleAttr returns the attribute applying css to an element: an inline
+// style, or with ExternalCSS a generated class whose rule is recorded for
+// RenderDocumentCSS.  classes are added to the element's class attribute.
+func (hr *htmlRenderer) styleAttr(css string, classes ...string) string {
+	var style string
+	if css != "" {
+		if !hr.opts.ExternalCSS {
+			style = fmt.Sprintf(" style=\"%s\"", css)
+		} else {
+			name := cssClassName(css)
+			if hr.classes != nil {
+				hr.classes[name] = css
+			}
+			classes = append(classes, name)
+		}
+	}
+	if len(classes) == 0 {
+		return style
+	}
+	return fmt.Sprintf(" class=\"%s\"", strings.Join(classes, " ")) + style
+}
+
+// cssClassName derives a class name from a declaration block.  Names depend
+// only on the declarations, so identical formatting in different documents
+// shares a class and their stylesheets can be merged.  64 bits of the hash
+// keep names apart across the many stylesheets MergeHTML may combine.
+func cssClassName(css string) string {
+	sum := sha256.Sum256([]byte(css))
+	return "docx-s" + hex.EncodeToString(sum[:8])
+}
+
+// sourceAttr returns the data-src attribute for a source location when
+// SourceMap is set.
+func (hr *htmlRenderer) sourceAttr(src string) string {
+	if !hr.opts.SourceMap || src == "" {
+		return ""
+	}
+	return fmt.Sprintf(" data-src=\"%s\"", html.EscapeString(src))
+}
+
+// fontSubstitutes returns the substitutes applied to font stacks.
+func (hr *htmlRenderer) fontSubstitutes() fonts.Substitutes {
+	if hr.opts.FontSubstitutes == nil {
+		return fonts.Default
+	}
+	return hr.opts.FontSubstitutes
+}
+
+// write emits s, repaired with textsafe.Clean and normalised.
+func (hr *htmlRenderer) write(s string) {
+	if hr.err == nil {
+		s = textsafe.Clean(s)
+		if hr.opts.NormalizeText != nil {
+			s = hr.opts.NormalizeText(s)
+		}
+		_, hr.err = io.WriteString(hr.w, s)
+	}
+}
+
+// DOCXToHTML is a convenience wrapper that converts a DOCX reader to HTML
+// using the intermediate representation defined in this package.
 func DOCXToHTML(r io.ReaderAt, size int64) (string, error) {
 	ir, err := ParseDocumentModel(r, size)
 	if err != nil {
@@ -0,0 +1,118 @@
+package docx
+
+import (
+	"github.com/aerissecure/convert/diag"
+	"github.com/unidoc/unioffice/schema/soo/dml"
+	pic "github.com/unidoc/unioffice/schema/soo/dml/picture"
+	"github.com/unidoc/unioffice/schema/soo/wml"
+)
+
+// -----------------------------------------------------------------------------
+// Pictures
+// -----------------------------------------------------------------------------
+//
+// Word stores a picture as a w:drawing holding either a wp:inline, which
+// sits in the line like a large character, or a wp:anchor, which floats
+// beside the text.  Both carry the displayed size (wp:extent, in EMU), the
+// alternative text (wp:docPr) and a pic:pic whose a:blip names the image
+// part by relationship, embedded (r:embed) or linked (r:link).  Drawings
+// that hold no picture, e.g. charts, shapes and text boxes, are skipped.
+// Picture bytes are read once per part and shared by every drawing of it.
+
+const emuPerPt = 12700
+
+// drawingImages returns the pictures of a w:drawing in document order.
+func (p *parser) drawingImages(d *wml.CT_Drawing) []Image {
+	var out []Image
+	for _, in := range d.Inline {
+		if img, ok := p.drawingImage(in.Graphic, in.Extent, in.DocPr); ok {
+			out = append(out, img)
+		}
+	}
+	for _, an := range d.Anchor {
+		img, ok := p.drawingImage(an.Graphic, an.Extent, an.DocPr)
+		if !ok {
+			continue
+		}
+		img.Anchored, img.Align = true, "left"
+		if h := an.PositionH; h != nil && h.Choice != nil {
+			switch h.Choice.Align {
+			case wml.WdST_AlignHRight, wml.WdST_AlignHOutside:
+				img.Align = "right"
+			case wml.WdST_AlignHCenter:
+				img.Align = "center"
+			}
+		}
+		out = append(out, img)
+	}
+	return out
+}
+
+// drawingImage resolves the picture of one drawing, reporting false if it
+// holds none.
+func (p *parser) drawingImage(g *dml.Graphic, ext *dml.CT_PositiveSize2D, pr *dml.CT_NonVisualDrawingProps) (Image, bool) {
+	if g == nil || g.GraphicData == nil {
+		return Image{}, false
+	}
+	var blip *dml.CT_Blip
+	for _, a := range g.GraphicData.Any {
+		if pp, ok := a.(*pic.Pic); ok && pp.BlipFill != nil && pp.BlipFill.Blip != nil {
+			blip = pp.BlipFill.Blip
+			break
+		}
+	}
+	if blip == nil {
+		return Image{}, false
+	}
+	var img Image
+	if ext != nil {
+		img.WidthPt, img.HeightPt = float64(ext.CxAttr)/emuPerPt, float64(ext.CyAttr)/emuPerPt
+	}
+	if pr != nil {
+		img.Title = pr.NameAttr
+		if pr.TitleAttr != nil && *pr.TitleAttr != "" {
+			img.Title = *pr.TitleAttr
+		}
+		if pr.DescrAttr != nil {
+			img.AltText = *pr.DescrAttr
+		}
+	}
+	if p.pkg == nil {
+		return img, true
+	}
+	rels := p.docRels()
+	switch {
+	case blip.EmbedAttr != nil:
+		rel, ok := rels[*blip.EmbedAttr]
+		if !ok || rel.External() {
+			break
+		}
+		img.PartName = resolveTarget(p.pkg.main, rel.Target)
+		img.ContentType = imageMIMEType(img.PartName)
+		img.Data = p.imageData(img.PartName)
+	case blip.LinkAttr != nil:
+		if rel, ok := rels[*blip.LinkAttr]; ok {
+			img.Source = rel.Target
+			img.ContentType = imageMIMEType(rel.Target)
+		}
+	}
+	return img, true
+}
+
+// imageData returns the bytes of image part name, or nil if it cannot be
+// read.
+func (p *parser) imageData(name string) []byte {
+	if data, ok := p.images[name]; ok {
+		return data
+	}
+	data, err := p.pkg.readPart(name)
+	if err != nil {
+		p.warn(diag.MissingPart, diag.Location{Part: name, Block: p.blocks + 1}, "picture: "+err.Error())
+		data = nil
+	}
+	if p.images == nil {
+		p.images = make(map[string][]byte)
+	}
+	p.images[name] = data
+	return data
+}
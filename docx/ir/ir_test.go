@@ -0,0 +1,39 @@
+package ir
+
+import (
+	"bytes"
+	"go/build"
+	"strings"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	var m DocumentModel
+	m.AppendBlock(DocumentBlock{Paragraph: &RenderParagraph{Runs: []RenderRun{{Text: "hello", Run: struct{}{}}}}})
+	m.AppendBlock(DocumentBlock{Table: &RenderTable{}})
+	var buf bytes.Buffer
+	if err := Encode(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Blocks) != 2 || len(got.Paragraphs) != 1 || len(got.Tables) != 1 || got.Paragraphs[0].Runs[0].Text != "hello" || got.Paragraphs[0].Runs[0].Run != nil {
+		t.Errorf("decoded %+v", got)
+	}
+}
+
+func TestDependencies(t *testing.T) {
+	for _, dir := range []string{".", "../../diag"} {
+		pkg, err := build.ImportDir(dir, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, imp := range pkg.Imports {
+			if strings.Contains(strings.Split(imp, "/")[0], ".") && imp != "github.com/aerissecure/convert/diag" {
+				t.Errorf("%s imports %s", dir, imp)
+			}
+		}
+	}
+}
@@ -0,0 +1,450 @@
+// Package ir holds the intermediate representation (IR) of DOCX documents
+// that the docx package parses into and renders from, with its JSON
+// serialization.  It depends on nothing but the standard library and the
+// diag package, so services that only consume serialized models, such as
+// renderers and indexers, need not pull in unioffice.  The docx package
+// aliases every type, so docx.DocumentModel and ir.DocumentModel are the
+// same type.
+//
+// The purpose of these types is to provide a Go-native structure that captures
+// just the information our converter cares about – no more and no less.  They
+// intentionally mirror the level of detail found in the XLSX IR so development
+// against the two formats feels familiar.
+//
+// All colours are expressed as 6-character RGB hex strings without the leading
+// "#" (e.g. "FF0000" for red).
+package ir
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aerissecure/convert/diag"
+)
+
+// -----------------------------------------------------------------------------
+// Document-level information
+// -----------------------------------------------------------------------------
+
+// DocProperties captures the common document properties that users typically
+// care about (title, author, …).  The field list can be expanded later if we
+// need deeper metadata.
+type DocProperties struct {
+	Title       string
+	Subject     string
+	Author      string
+	Keywords    string
+	Description string
+	Language    string // BCP 47 tag, e.g. "en-US"
+	Created     time.Time
+	Modified    time.Time
+}
+
+func (p DocProperties) String() string {
+	return fmt.Sprintf("Title: %q, Subject: %q, Author: %q, Keywords: %q, Description: %q, Language: %q, Created: %s, Modified: %s",
+		p.Title, p.Subject, p.Author, p.Keywords, p.Description, p.Language, p.Created.Format(time.RFC3339), p.Modified.Format(time.RFC3339))
+}
+
+// -----------------------------------------------------------------------------
+// Content controls
+// -----------------------------------------------------------------------------
+
+// ContentControl captures the metadata of a structured document tag (\<w:sdt>)
+// wrapping blocks or runs.  The wrapped content itself is converted like any
+// other content; blocks and runs simply point at their enclosing control.
+type ContentControl struct {
+	ID                 int64
+	Tag                string // programmatic tag
+	Alias              string // friendly name shown in Word
+	Placeholder        string // name of the docPart holding the placeholder text
+	ShowingPlaceholder bool   // true if the content is still the placeholder text
+	Type               string // "richText" | "text" | "date" | "dropDownList" | "comboBox" | "picture" | "docPart" | …
+}
+
+func (c ContentControl) String() string {
+	return fmt.Sprintf("ID: %d, Tag: %q, Alias: %q, Placeholder: %q, ShowingPlaceholder: %t, Type: %s",
+		c.ID, c.Tag, c.Alias, c.Placeholder, c.ShowingPlaceholder, c.Type)
+}
+
+// -----------------------------------------------------------------------------
+// Run-level information
+// -----------------------------------------------------------------------------
+
+// RunStyle captures the character formatting for a run of text.
+type RunStyle struct {
+	FontFamily         string  // e.g. "Calibri" (w:rFonts ascii/hAnsi)
+	FontFamilyEastAsia string  // font for East Asian text, e.g. "MS Mincho"
+	FontFamilyCS       string  // font for complex-script text, e.g. "Arial"
+	Script             string  // "" | "eastAsia" | "cs": which font applies to the run's text
+	FontSizePt         float64 // size in points
+	FontColor          string  // "RRGGBB"
+	Bold               bool
+	Italic             bool
+	Underline          bool
+	Strike             bool
+	Hidden             bool   // w:vanish: text Word neither displays nor prints by default
+	VerticalAlign      string // "superscript" | "subscript" | "baseline"
+}
+
+func (s RunStyle) String() string {
+	return fmt.Sprintf("FontFamily: %s, FontFamilyEastAsia: %s, FontFamilyCS: %s, Script: %s, FontSizePt: %f, FontColor: %s, Bold: %t, Italic: %t, Underline: %t, Strike: %t, Hidden: %t, VerticalAlign: %s",
+		s.FontFamily, s.FontFamilyEastAsia, s.FontFamilyCS, s.Script, s.FontSizePt, s.FontColor, s.Bold, s.Italic, s.Underline, s.Strike, s.Hidden, s.VerticalAlign)
+}
+
+// EmbeddedObject describes an OLE object (spreadsheet, PDF, packaged file, …)
+// embedded in or linked from the document.
+type EmbeddedObject struct {
+	ProgID      string  // OLE ProgID, e.g. "Excel.Sheet.12"
+	Type        string  // human readable type, e.g. "Excel worksheet"
+	FileName    string  // original file name where known, else the payload part's name
+	PartName    string  // package part holding the payload, e.g. "word/embeddings/oleObject1.bin"
+	ContentType string  // content type of the payload part
+	Linked      bool    // true if the object is linked rather than embedded
+	Source      string  // link target for linked objects
+	WidthPt     float64 // displayed size in points (0 if unknown)
+	HeightPt    float64
+	Preview     []byte // preview image Word stores alongside the object, if any
+	PreviewType string // MIME type of Preview, e.g. "image/x-emf"
+	PreviewPart string // package part holding Preview
+	AltText     string // alternative text of the object's shape (v:shape alt), if any
+}
+
+func (o EmbeddedObject) String() string {
+	return fmt.Sprintf("ProgID: %s, Type: %s, FileName: %q, PartName: %s, ContentType: %s, Linked: %t, Source: %q, WidthPt: %f, HeightPt: %f, Preview: %d bytes (%s)",
+		o.ProgID, o.Type, o.FileName, o.PartName, o.ContentType, o.Linked, o.Source, o.WidthPt, o.HeightPt, len(o.Preview), o.PreviewType)
+}
+
+// NoteReference is a footnote or endnote reference mark in the text.
+type NoteReference struct {
+	Kind       string // "footnote" or "endnote"
+	ID         int64  // w:id of the note in footnotes.xml / endnotes.xml
+	Mark       string // computed reference mark, e.g. "3", "iv" or "†"
+	CustomMark bool   // the mark is the run text that follows rather than Mark
+}
+
+func (n NoteReference) String() string {
+	return fmt.Sprintf("Kind: %s, ID: %d, Mark: %q, CustomMark: %t", n.Kind, n.ID, n.Mark, n.CustomMark)
+}
+
+// Comment is a review comment.  Runs reference it through
+// RenderRun.Comments (the commented range) and RenderRun.CommentRef (the
+// reference mark).
+type Comment struct {
+	ID       int64
+	Author   string
+	Initials string
+	Date     time.Time
+	Blocks   []DocumentBlock // comment content
+}
+
+func (c Comment) String() string {
+	return fmt.Sprintf("ID: %d, Author: %q, Initials: %q, Date: %s, Blocks: %d", c.ID, c.Author, c.Initials, c.Date, len(c.Blocks))
+}
+
+// Note is the body of a referenced footnote or endnote.
+type Note struct {
+	NoteReference // the first reference to the note
+
+	Section int             // 0-based index of the section holding the reference
+	Blocks  []DocumentBlock // note content
+}
+
+func (n Note) String() string {
+	return fmt.Sprintf("%s, Section: %d, Blocks: %d", n.NoteReference.String(), n.Section, len(n.Blocks))
+}
+
+// Image is a picture drawn in the document (w:drawing).
+type Image struct {
+	PartName    string  // package part holding the picture, e.g. "word/media/image1.png"
+	ContentType string  // MIME type of Data, e.g. "image/png"
+	Data        []byte  // nil for linked pictures
+	Source      string  // link target of a linked picture
+	WidthPt     float64 // displayed size in points (0 if unknown)
+	HeightPt    float64
+	AltText     string // description (wp:docPr descr), if any
+	Title       string // name or title of the drawing, if any
+	Anchored    bool   // the picture floats, anchored to the paragraph, rather than sitting in the text
+	Align       string // horizontal alignment of an anchored picture: "left" | "center" | "right"
+}
+
+// RenderRun represents a single run (\<w:r>) within a paragraph.
+type RenderRun struct {
+	Run   any      `json:"-"` // underlying unioffice document.Run – nil when the parser does not expose one
+	Text  string   // already expanded/decoded text for the run
+	Style RunStyle // resolved run style
+
+	ContentControl *ContentControl // enclosing inline content control, if any
+	Object         *EmbeddedObject // set for runs standing in for an embedded object
+	Image          *Image          // set for runs holding a picture
+	Href           string          // target of the enclosing hyperlink ("#name" for bookmarks)
+	Note           *NoteReference  // set for footnote/endnote reference marks
+	Bookmark       string          // set for bookmark start markers; the bookmark name
+	Ruby           *Ruby           // set for runs holding East Asian phonetic guides
+	Comments       []int64         // IDs of the comments whose range covers the run
+	CommentRef     *int64          // set for comment reference marks; the comment ID
+	Source         string          // source location, e.g. "p12/r3" (see RenderOptions.SourceMap)
+	Field          string          // "PAGE" | "NUMPAGES" | "SECTIONPAGES" for the cached result of a page-number field
+	Change         string          // "insert" | "delete" for runs of a comparison (see CompareDocuments) or a tracked change
+	Revision       *Revision       // the tracked insertion, deletion or move the run belongs to, if any
+	FormatChange   *Revision       // the tracked formatting change (w:rPrChange) of the run, if any
+	OriginalStyle  *RunStyle       // style before FormatChange
+}
+
+// Ruby is a w:ruby element: base text annotated with a phonetic guide.
+type Ruby struct {
+	Base  []RenderRun
+	Guide []RenderRun
+}
+
+func (r RenderRun) String() string {
+	return fmt.Sprintf("Text: %q, Style: [%s]", r.Text, r.Style.String())
+}
+
+// -----------------------------------------------------------------------------
+// Paragraph-level information
+// -----------------------------------------------------------------------------
+
+// ParagraphStyle captures paragraph-level formatting.
+type ParagraphStyle struct {
+	Alignment     string  // "left" | "center" | "right" | "justify"
+	LineSpacingPt float64 // leading – 0 means default/single
+	SpaceBeforePt float64 // spacing before paragraph in points
+	SpaceAfterPt  float64 // spacing after paragraph in points
+	IndentLeftPx  float64 // left indent in pixels
+	IndentRightPx float64 // right indent in pixels
+	HeadingLevel  int     // 0 means normal paragraph, 1-6 for headings
+	ListType      string  // "ordered" | "unordered" | "none"
+	ListLevel     int     // nesting level (0-based)
+	ListID        int     // list instance (w:numId); items of different instances form separate lists
+	ListNumber    int     // the item's number within its level, 0 if unknown
+	ListMarker    string  // CSS list-style-type of the item's level, e.g. "lower-roman"; "" for the default
+}
+
+func (s ParagraphStyle) String() string {
+	return fmt.Sprintf("Alignment: %s, LineSpacingPt: %f, SpaceBeforePt: %f, SpaceAfterPt: %f, IndentLeftPx: %f, IndentRightPx: %f, HeadingLevel: %d, ListType: %s, ListLevel: %d, ListID: %d, ListNumber: %d, ListMarker: %s",
+		s.Alignment, s.LineSpacingPt, s.SpaceBeforePt, s.SpaceAfterPt, s.IndentLeftPx, s.IndentRightPx, s.HeadingLevel, s.ListType, s.ListLevel, s.ListID, s.ListNumber, s.ListMarker)
+}
+
+// RenderParagraph is the IR for a paragraph.
+type RenderParagraph struct {
+	Paragraph any            `json:"-"` // underlying unioffice document.Paragraph – nil when the parser does not expose one
+	Runs      []RenderRun    // constituent runs
+	Style     ParagraphStyle // resolved paragraph style
+	StyleID   string         // w:pStyle, e.g. "Heading1" – empty for the default paragraph style
+	StyleName string         // display name of StyleID, e.g. "heading 1"
+
+	ContentControl *ContentControl // enclosing block-level content control, if any
+	DropCap        *DropCap        // dropped capital preceding the paragraph text, if any
+	Revision       *RevisionInfo   // revision history, nil if the paragraph carries none
+	SectionEnd     bool            // the paragraph ends a section (carries w:sectPr)
+
+	PageBreakBefore bool   // w:pageBreakBefore, or the previous paragraph holds a hard page break
+	Source          string // source location, e.g. "p12" (see RenderOptions.SourceMap)
+}
+
+// DropCap is a dropped capital.  Word stores it as a separate framed
+// paragraph (w:framePr w:dropCap) before the paragraph it belongs to; the
+// parser folds it into that paragraph.
+type DropCap struct {
+	Runs   []RenderRun // the capital letter(s)
+	Lines  int         // height in lines of body text
+	Margin bool        // true if placed in the margin rather than in the text
+}
+
+func (p RenderParagraph) String() string {
+	return fmt.Sprintf("Runs: %d, StyleID: %q, Style: [%s]", len(p.Runs), p.StyleID, p.Style.String())
+}
+
+// -----------------------------------------------------------------------------
+// Table-level information
+// -----------------------------------------------------------------------------
+
+// TableCellStyle represents the limited set of cell properties we are currently
+// interested in (borders/shading could be added later).
+type TableCellStyle struct {
+	BackgroundColor string // fill colour – "RRGGBB"
+	VerticalAlign   string // "top" | "middle" | "bottom"
+}
+
+func (s TableCellStyle) String() string {
+	return fmt.Sprintf("BackgroundColor: %s, VerticalAlign: %s", s.BackgroundColor, s.VerticalAlign)
+}
+
+// RenderTableCell is the IR for a single table cell.  It can contain multiple
+// paragraphs.
+type RenderTableCell struct {
+	Paragraphs []RenderParagraph // content
+	ColSpan    int               // 1 if not horizontally merged
+	RowSpan    int               // 1 if not vertically merged
+	WidthPx    float64           // resolved width in px (0 means auto)
+	Style      TableCellStyle    // resolved style
+	Source     string            // source location, e.g. "tbl2/tr0/tc1" (see RenderOptions.SourceMap)
+}
+
+func (c RenderTableCell) String() string {
+	return fmt.Sprintf("Paragraphs: %d, ColSpan: %d, RowSpan: %d, WidthPx: %f, Style: [%s]", len(c.Paragraphs), c.ColSpan, c.RowSpan, c.WidthPx, c.Style.String())
+}
+
+// RenderTableRow represents a row within a table.
+type RenderTableRow struct {
+	Cells    []RenderTableCell // cells, length equals column count of parent table
+	HeightPx float64           // resolved height in px (0 means auto)
+	Header   bool              // w:tblHeader: the row repeats as a header on each page
+}
+
+func (r RenderTableRow) String() string {
+	return fmt.Sprintf("Cells: %d, HeightPx: %f, Header: %t", len(r.Cells), r.HeightPx, r.Header)
+}
+
+// RenderTable is the IR for a table – rows in order.
+type RenderTable struct {
+	Rows        []RenderTableRow // in order
+	Caption     string           // w:tblCaption (alternative text title)
+	Description string           // w:tblDescription (alternative text description)
+	Revision    *RevisionInfo    // combined revision history of the table's paragraphs
+
+	ContentControl *ContentControl // enclosing block-level content control, if any
+	Source         string          // source location, e.g. "tbl2" (see RenderOptions.SourceMap)
+}
+
+func (t RenderTable) String() string {
+	return fmt.Sprintf("Rows: %d, Caption: %q", len(t.Rows), t.Caption)
+}
+
+// -----------------------------------------------------------------------------
+// Revision metadata
+// -----------------------------------------------------------------------------
+
+// Revision is a tracked change.
+type Revision struct {
+	Type   string // "insert" | "delete" | "moveFrom" | "moveTo" | "formatChange" | "paragraphInsert" | "paragraphDelete"
+	ID     int64  // w:id of the change
+	Author string
+	Date   time.Time // zero if not recorded
+}
+
+func (r Revision) String() string {
+	return fmt.Sprintf("Type: %s, ID: %d, Author: %q, Date: %s", r.Type, r.ID, r.Author, r.Date.Format(time.RFC3339))
+}
+
+// RevisionInfo is the revision history of a block.
+type RevisionInfo struct {
+	// Rsids are the revision save IDs of the editing sessions that created
+	// or formatted the block's content, in order of first appearance.
+	Rsids []string
+	// Revisions are the tracked changes within the block.
+	Revisions []Revision
+	// Author and Date identify the most recent change that can be
+	// attributed, either from a tracked change or from an rsid whose
+	// session also produced tracked changes.  Empty if none can be.
+	Author string
+	Date   time.Time
+}
+
+func (r RevisionInfo) String() string {
+	return fmt.Sprintf("Rsids: %v, Revisions: %d, Author: %q, Date: %s", r.Rsids, len(r.Revisions), r.Author, r.Date.Format(time.RFC3339))
+}
+
+// -----------------------------------------------------------------------------
+// Block ordering
+// -----------------------------------------------------------------------------
+
+// DocumentBlock represents a top-level block element in the DOCX body – a
+// paragraph, a table or imported altChunk content.  Exactly one of
+// Paragraph/Table/AltChunk will be non-nil.
+type DocumentBlock struct {
+	Paragraph *RenderParagraph
+	Table     *RenderTable
+	AltChunk  *AltChunk
+}
+
+// AltChunk is foreign content (HTML, MHT, RTF, plain text) imported into the
+// body through w:altChunk.  Nested WordprocessingML documents are spliced into
+// the model as ordinary blocks instead.
+type AltChunk struct {
+	PartName    string // package part holding the chunk
+	ContentType string
+	HTML        string // sanitised HTML for HTML/MHT chunks, empty otherwise
+	Text        string // plain-text content
+	Change      string // "insert" | "delete" for a chunk of a comparison (see CompareDocuments)
+}
+
+func (a AltChunk) String() string {
+	return fmt.Sprintf("PartName: %s, ContentType: %s, HTML: %d bytes, Text: %d bytes", a.PartName, a.ContentType, len(a.HTML), len(a.Text))
+}
+
+// -----------------------------------------------------------------------------
+// Top-level document model
+// -----------------------------------------------------------------------------
+
+type DocumentModel struct {
+	Properties DocProperties
+
+	// The document body is represented as a sequence of paragraphs and tables
+	// in the order they appear.  For compatibility we keep dedicated slices
+	// too, but the primary ordering source is Blocks.
+	Blocks     []DocumentBlock
+	Paragraphs []RenderParagraph
+	Tables     []RenderTable
+
+	// ContentControls lists every content control in document order.
+	ContentControls []ContentControl
+	// Objects lists every embedded or linked OLE object in document order.
+	Objects []EmbeddedObject
+	// AltChunks lists the imported altChunk parts in document order.
+	AltChunks []AltChunk
+	// Revisions lists every tracked change in document order.
+	Revisions []Revision
+	// Comments lists the review comments of comments.xml.
+	Comments []Comment
+	// Sections lists the page setup of every section in document order.
+	Sections []Section
+	// Notes lists the referenced footnotes, then endnotes, in order of first
+	// reference.
+	Notes []Note
+	// Warnings lists the problems the parser worked around, in the order
+	// found.
+	Warnings []diag.Warning
+}
+
+// AppendBlock appends a top-level block, keeping the compatibility slices
+// in step with Blocks.
+func (m *DocumentModel) AppendBlock(blk DocumentBlock) {
+	m.Blocks = append(m.Blocks, blk)
+	if blk.Paragraph != nil {
+		m.Paragraphs = append(m.Paragraphs, *blk.Paragraph)
+	}
+	if blk.Table != nil {
+		m.Tables = append(m.Tables, *blk.Table)
+	}
+}
+
+// Section is the page setup of a document section (w:sectPr).
+type Section struct {
+	PageWidthPt    float64
+	PageHeightPt   float64
+	MarginTopPt    float64
+	MarginRightPt  float64
+	MarginBottomPt float64
+	MarginLeftPt   float64
+	Landscape      bool
+	HeaderPt       float64 // distance from the top edge of the page to the header
+	FooterPt       float64 // distance from the bottom edge of the page to the footer
+	PageStart      int     // first page number (w:pgNumType w:start), 0 to continue from the previous section
+	TitlePage      bool    // the first page uses FirstHeader and FirstFooter
+
+	// Headers and footers, inherited from the previous section where the
+	// section does not define its own.
+	Header, Footer           []DocumentBlock
+	FirstHeader, FirstFooter []DocumentBlock
+}
+
+func (s Section) String() string {
+	return fmt.Sprintf("PageWidthPt: %f, PageHeightPt: %f, Margins: %f %f %f %f, Landscape: %t, HeaderPt: %f, FooterPt: %f, PageStart: %d, TitlePage: %t, Header: %d, Footer: %d",
+		s.PageWidthPt, s.PageHeightPt, s.MarginTopPt, s.MarginRightPt, s.MarginBottomPt, s.MarginLeftPt, s.Landscape,
+		s.HeaderPt, s.FooterPt, s.PageStart, s.TitlePage, len(s.Header), len(s.Footer))
+}
+
+func (d DocumentModel) String() string {
+	return fmt.Sprintf("Blocks: %d, Paragraphs: %d, Tables: %d, Properties: [%s]", len(d.Blocks), len(d.Paragraphs), len(d.Tables), d.Properties.String())
+}
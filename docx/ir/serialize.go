@@ -0,0 +1,86 @@
+package ir
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// -----------------------------------------------------------------------------
+// Model serialization
+// -----------------------------------------------------------------------------
+//
+// A DocumentModel is encoded as a JSON envelope holding the schema version
+// and the model, so a document can be parsed in one process (e.g. a
+// sandboxed worker) and rendered in another.  Keys are the Go field names.
+// The unioffice handles (RenderRun.Run, RenderParagraph.Paragraph) are not
+// encoded; nothing in the renderers depends on them.  Paragraphs and Tables
+// are encoded only for models without Blocks and are otherwise rebuilt from
+// Blocks when decoding.
+//
+// A change to the model that alters the meaning of existing fields bumps
+// Version and registers a migration from the previous version in
+// documentMigrations.  Adding fields does not.
+
+// Version is the schema version written by Encode.
+const Version = 1
+
+// ErrVersion is returned by Decode for an envelope of a schema version
+// this package cannot read.
+var ErrVersion = errors.New("docx: unsupported model version")
+
+// documentMigrations[v] upgrades the encoded model of version v to v+1.
+var documentMigrations = map[int]func(json.RawMessage) (json.RawMessage, error){}
+
+type documentEnvelope struct {
+	Version  int             `json:"version"`
+	Document json.RawMessage `json:"document"`
+}
+
+// Encode writes m to w as versioned JSON.
+func Encode(w io.Writer, m DocumentModel) error {
+	if len(m.Blocks) > 0 {
+		m.Paragraphs, m.Tables = nil, nil
+	}
+	doc, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(documentEnvelope{Version: Version, Document: doc})
+}
+
+// Decode reads a model written by Encode, migrating it from an earlier
+// schema version if needed.
+func Decode(r io.Reader) (DocumentModel, error) {
+	var env documentEnvelope
+	if err := json.NewDecoder(r).Decode(&env); err != nil {
+		return DocumentModel{}, err
+	}
+	if env.Version < 1 || env.Version > Version {
+		return DocumentModel{}, fmt.Errorf("%w %d", ErrVersion, env.Version)
+	}
+	data := env.Document
+	for v := env.Version; v < Version; v++ {
+		migrate, ok := documentMigrations[v]
+		if !ok {
+			return DocumentModel{}, fmt.Errorf("%w %d", ErrVersion, env.Version)
+		}
+		var err error
+		if data, err = migrate(data); err != nil {
+			return DocumentModel{}, fmt.Errorf("docx: migrating model from version %d: %w", v, err)
+		}
+	}
+	var m DocumentModel
+	if err := json.Unmarshal(data, &m); err != nil {
+		return DocumentModel{}, err
+	}
+	if len(m.Blocks) > 0 {
+		blocks := m.Blocks
+		m.Blocks, m.Paragraphs, m.Tables = nil, nil, nil
+		for _, blk := range blocks {
+			m.AppendBlock(blk)
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,261 @@
+package docx
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/unidoc/unioffice/schema/soo/ofc/sharedTypes"
+	"github.com/unidoc/unioffice/schema/soo/wml"
+)
+
+// -----------------------------------------------------------------------------
+// Page layout
+// -----------------------------------------------------------------------------
+//
+// HTML has no pages, so page-layout rendering approximates Word's pagination:
+// blocks are laid greedily into pages of the section's text area, starting a
+// new page when the estimated height of the next block does not fit, at
+// explicit page breaks and at section boundaries.  Heights are estimated from
+// the amount of text, the font size and the paragraph spacing; the result is
+// close enough for previews but will drift from Word on long documents.
+
+const (
+	defaultFontSizePt = 11   // Word's default body text size
+	avgCharWidthEm    = 0.5  // average glyph advance of proportional fonts
+	lineHeightEm      = 1.15 // single line spacing of common fonts
+	pxToPt            = 0.75
+)
+
+// sectionLayout reads the page size and margins of a section, defaulting to
+// US Letter with 1in margins.
+func sectionLayout(sp *wml.CT_SectPr) Section {
+	s := Section{
+		PageWidthPt: 612, PageHeightPt: 792,
+		MarginTopPt: 72, MarginRightPt: 72, MarginBottomPt: 72, MarginLeftPt: 72,
+		HeaderPt: 36, FooterPt: 36,
+	}
+	if sp == nil {
+		return s
+	}
+	if sz := sp.PgSz; sz != nil {
+		if v, ok := twipsPt(sz.WAttr); ok {
+			s.PageWidthPt = v
+		}
+		if v, ok := twipsPt(sz.HAttr); ok {
+			s.PageHeightPt = v
+		}
+		s.Landscape = sz.OrientAttr == wml.ST_PageOrientationLandscape
+	}
+	if m := sp.PgMar; m != nil {
+		if v, ok := signedTwipsPt(m.TopAttr); ok {
+			s.MarginTopPt = math.Abs(v)
+		}
+		if v, ok := twipsPt(&m.RightAttr); ok {
+			s.MarginRightPt = v
+		}
+		if v, ok := signedTwipsPt(m.BottomAttr); ok {
+			s.MarginBottomPt = math.Abs(v)
+		}
+		if v, ok := twipsPt(&m.LeftAttr); ok {
+			s.MarginLeftPt = v
+		}
+		if v, ok := twipsPt(&m.HeaderAttr); ok {
+			s.HeaderPt = v
+		}
+		if v, ok := twipsPt(&m.FooterAttr); ok {
+			s.FooterPt = v
+		}
+	}
+	if sp.PgNumType != nil && sp.PgNumType.StartAttr != nil {
+		s.PageStart = int(*sp.PgNumType.StartAttr)
+	}
+	s.TitlePage = sp.TitlePg != nil && onOff(sp.TitlePg)
+	return s
+}
+
+func twipsPt(m *sharedTypes.ST_TwipsMeasure) (float64, bool) {
+	switch {
+	case m == nil:
+		return 0, false
+	case m.ST_UnsignedDecimalNumber != nil:
+		return float64(*m.ST_UnsignedDecimalNumber) / 20, true
+	case m.ST_PositiveUniversalMeasure != nil:
+		return universalMeasurePt(*m.ST_PositiveUniversalMeasure)
+	}
+	return 0, false
+}
+
+func signedTwipsPt(m wml.ST_SignedTwipsMeasure) (float64, bool) {
+	switch {
+	case m.Int64 != nil:
+		return float64(*m.Int64) / 20, true
+	case m.ST_UniversalMeasure != nil:
+		return universalMeasurePt(*m.ST_UniversalMeasure)
+	}
+	return 0, false
+}
+
+// universalMeasurePt converts a measure with a unit suffix ("2.5cm", "1in",
+// "12pt", …) to points.
+func universalMeasurePt(s string) (float64, bool) {
+	if len(s) < 3 {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(s[:len(s)-2], 64)
+	if err != nil {
+		return 0, false
+	}
+	switch s[len(s)-2:] {
+	case "mm":
+		return v * 72 / 25.4, true
+	case "cm":
+		return v * 72 / 2.54, true
+	case "in":
+		return v * 72, true
+	case "pt":
+		return v, true
+	case "pc", "pi":
+		return v * 12, true
+	}
+	return 0, false
+}
+
+// page is a group of blocks laid out on one page.
+type page struct {
+	section Section
+	index   int  // index of the section in the document
+	first   bool // first page of the section
+	blocks  []DocumentBlock
+}
+
+// paginate lays blocks into pages.  sections are the document's sections in
+// order; blocks after the last section end use the last one.
+func paginate(blocks []DocumentBlock, sections []Section) []page {
+	sectionAt := func(i int) Section {
+		if i < len(sections) {
+			return sections[i]
+		}
+		if len(sections) > 0 {
+			return sections[len(sections)-1]
+		}
+		return sectionLayout(nil)
+	}
+	var (
+		pages   []page
+		section int
+		cur     = page{section: sectionAt(0), first: true}
+		used    float64
+	)
+	newPage := func() {
+		pages = append(pages, cur)
+		first := cur.index != section
+		cur = page{section: sectionAt(section), index: section, first: first}
+		used = 0
+	}
+	for _, blk := range blocks {
+		width := cur.section.PageWidthPt - cur.section.MarginLeftPt - cur.section.MarginRightPt
+		height := cur.section.PageHeightPt - cur.section.MarginTopPt - cur.section.MarginBottomPt
+		h := blockHeightPt(blk, width)
+		breakBefore := blk.Paragraph != nil && blk.Paragraph.PageBreakBefore
+		if len(cur.blocks) > 0 && (breakBefore || used+h > height) {
+			newPage()
+		}
+		cur.blocks = append(cur.blocks, blk)
+		used += h
+		if blk.Paragraph != nil && blk.Paragraph.SectionEnd {
+			section++
+			newPage()
+		}
+	}
+	if len(cur.blocks) > 0 || len(pages) == 0 {
+		pages = append(pages, cur)
+	}
+	return pages
+}
+
+// blockHeightPt estimates the rendered height of a block laid out in a text
+// area widthPt wide.
+func blockHeightPt(blk DocumentBlock, widthPt float64) float64 {
+	switch {
+	case blk.Paragraph != nil:
+		return paragraphHeightPt(*blk.Paragraph, widthPt)
+	case blk.Table != nil:
+		var h float64
+		for _, row := range blk.Table.Rows {
+			rowH := row.HeightPx * pxToPt
+			for _, cell := range row.Cells {
+				cw := widthPt / float64(max(len(row.Cells), 1))
+				if cell.WidthPx > 0 {
+					cw = cell.WidthPx * pxToPt
+				}
+				var ch float64
+				for _, p := range cell.Paragraphs {
+					ch += paragraphHeightPt(p, cw)
+				}
+				rowH = max(rowH, ch+4) // cell padding
+			}
+			h += rowH
+		}
+		return h
+	case blk.AltChunk != nil:
+		return textHeightPt(blk.AltChunk.Text, defaultFontSizePt, 0, widthPt)
+	}
+	return 0
+}
+
+// paragraphHeightPt estimates the height of a paragraph from its text
+// length, largest font size and spacing.
+func paragraphHeightPt(p RenderParagraph, widthPt float64) float64 {
+	size := 0.0
+	var text strings.Builder
+	for _, r := range p.Runs {
+		if _, ok := revisedRun(r, RevisionsAccept); !ok {
+			continue
+		}
+		size = max(size, r.Style.FontSizePt)
+		text.WriteString(r.Text)
+		if r.Object != nil {
+			size = max(size, r.Object.HeightPt)
+		}
+		if r.Image != nil && !r.Image.Anchored {
+			size = max(size, r.Image.HeightPt)
+		}
+	}
+	if size == 0 {
+		size = defaultFontSizePt
+	}
+	widthPt -= (p.Style.IndentLeftPx + p.Style.IndentRightPx) * pxToPt
+	return p.Style.SpaceBeforePt + p.Style.SpaceAfterPt + textHeightPt(text.String(), size, p.Style.LineSpacingPt, widthPt)
+}
+
+// textHeightPt estimates the height of text wrapped to widthPt.
+func textHeightPt(text string, sizePt, leadingPt, widthPt float64) float64 {
+	if leadingPt <= 0 {
+		leadingPt = sizePt * lineHeightEm
+	}
+	perLine := math.Max(1, math.Floor(widthPt/(sizePt*avgCharWidthEm)))
+	lines := 0.0
+	for _, l := range strings.Split(text, "\n") {
+		lines += math.Max(1, math.Ceil(float64(utf8.RuneCountInString(l))/perLine))
+	}
+	return lines * leadingPt
+}
+
+// pageNumbers returns the displayed number of each page and the page count
+// of each section.  Numbering restarts where a section sets PageStart.
+func pageNumbers(pages []page) (numbers []int, sectionPages map[int]int) {
+	numbers = make([]int, len(pages))
+	sectionPages = make(map[int]int)
+	n := 0
+	for i, pg := range pages {
+		n++
+		if pg.first && pg.section.PageStart > 0 {
+			n = pg.section.PageStart
+		}
+		numbers[i] = n
+		sectionPages[pg.index]++
+	}
+	return numbers, sectionPages
+}
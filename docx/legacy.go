@@ -0,0 +1,61 @@
+package docx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aerissecure/convert/internal/cfb"
+)
+
+// -----------------------------------------------------------------------------
+// Legacy .doc input
+// -----------------------------------------------------------------------------
+//
+// Word 97-2003 files are compound files (CFB) rather than ZIP packages and
+// cannot be read by this package.  They are detected by their signature and
+// either rejected with ErrLegacyFormat or, when ParseOptions.LegacyConverter
+// is set, converted to DOCX first.  Password-protected DOCX files are compound files
+// too; they are reported with ErrEncrypted since converting them would not
+// help.
+
+// ErrLegacyFormat is returned for binary Word 97-2003 (.doc) input when no
+// ParseOptions.LegacyConverter is configured.
+var ErrLegacyFormat = errors.New("docx: legacy binary .doc format")
+
+// ErrEncrypted is returned for password-protected documents.
+var ErrEncrypted = errors.New("docx: document is encrypted")
+
+// ExternalConverter converts a legacy document to DOCX, typically by
+// running an external program.
+type ExternalConverter interface {
+	ConvertToDOCX(r io.ReaderAt, size int64) ([]byte, error)
+}
+
+// openLegacy checks r for a compound file.  DOCX input is returned
+// unchanged; .doc input is converted with conv, if set.
+func openLegacy(r io.ReaderAt, size int64, conv ExternalConverter) (io.ReaderAt, int64, error) {
+	sig := make([]byte, len(cfb.Signature))
+	if _, err := r.ReadAt(sig, 0); err != nil || !cfb.IsCFB(sig) {
+		return r, size, nil
+	}
+	f, err := cfb.Open(r, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	if _, ok := f.Stat("EncryptedPackage"); ok {
+		return nil, 0, ErrEncrypted
+	}
+	if _, ok := f.Stat("WordDocument"); !ok {
+		return nil, 0, errors.New("docx: compound file is not a Word document")
+	}
+	if conv == nil {
+		return nil, 0, ErrLegacyFormat
+	}
+	data, err := conv.ConvertToDOCX(r, size)
+	if err != nil {
+		return nil, 0, fmt.Errorf("docx: converting legacy document: %w", err)
+	}
+	return bytes.NewReader(data), int64(len(data)), nil
+}
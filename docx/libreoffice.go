@@ -0,0 +1,61 @@
+//go:build !js && !wasip1
+
+package docx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// LibreOffice converts documents by running LibreOffice headless.  It is
+// not built for WebAssembly, which cannot run programs.
+type LibreOffice struct {
+	// Path is the soffice executable; "soffice" is looked up on PATH when
+	// empty.
+	Path string
+	// Timeout bounds a single conversion; zero means one minute.
+	Timeout time.Duration
+}
+
+// ConvertToDOCX implements ExternalConverter.
+func (lo LibreOffice) ConvertToDOCX(r io.ReaderAt, size int64) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "convert-doc-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	in := filepath.Join(dir, "input.doc")
+	data, err := io.ReadAll(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(in, data, 0o600); err != nil {
+		return nil, err
+	}
+
+	bin, timeout := lo.Path, lo.Timeout
+	if bin == "" {
+		bin = "soffice"
+	}
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	// A private profile directory lets conversions run concurrently and
+	// alongside a desktop instance.
+	cmd := exec.CommandContext(ctx, bin,
+		"-env:UserInstallation=file://"+filepath.ToSlash(filepath.Join(dir, "profile")),
+		"--headless", "--convert-to", "docx", "--outdir", dir, in)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("docx: soffice: %w: %s", err, bytes.TrimSpace(out))
+	}
+	return os.ReadFile(filepath.Join(dir, "input.docx"))
+}
@@ -0,0 +1,489 @@
+package docx
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// -----------------------------------------------------------------------------
+// Markdown input
+// -----------------------------------------------------------------------------
+//
+// ParseMarkdownModel reads a CommonMark subset into a DocumentModel:
+// ATX headings, paragraphs with hard line breaks, fenced code blocks,
+// bullet and ordered lists nested by indentation, block quotes, pipe tables
+// and the inline forms **bold**, *italic*, ~~strike~~, `code` and
+// [text](url).  Setext headings, reference links, images and raw HTML are
+// read as plain text.
+
+// ParseMarkdownModel reads a Markdown document and builds a DocumentModel.
+func ParseMarkdownModel(r io.Reader) (DocumentModel, error) {
+	var lines []string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		lines = append(lines, strings.ReplaceAll(sc.Text(), "\t", "    "))
+	}
+	if err := sc.Err(); err != nil {
+		return DocumentModel{}, err
+	}
+	mb := &mdBuilder{}
+	mb.blocks(lines)
+	return mb.mdl, nil
+}
+
+// MarkdownToDOCX converts a Markdown document to DOCX, see
+// ParseMarkdownModel.
+func MarkdownToDOCX(w io.Writer, r io.Reader) error {
+	m, err := ParseMarkdownModel(r)
+	if err != nil {
+		return err
+	}
+	return WriteDocument(w, m)
+}
+
+// mdBuilder carries the state of one Markdown conversion.
+type mdBuilder struct {
+	mdl      DocumentModel
+	nextList int
+}
+
+// mdList is an open list at one indentation.
+type mdList struct {
+	indent  int
+	ordered bool
+	id      int
+}
+
+// blocks converts lines to block-level content.
+func (mb *mdBuilder) blocks(lines []string) {
+	var (
+		para   []string
+		quote  []string
+		lists  []mdList
+		inList bool // the pending paragraph is a list item
+		item   ParagraphStyle
+	)
+	flush := func() {
+		if len(para) > 0 {
+			st := ParagraphStyle{}
+			if inList {
+				st = item
+			}
+			mb.add(RenderParagraph{Runs: mdInline(mdJoin(para), RunStyle{}), Style: st})
+		}
+		para, inList = nil, false
+	}
+	flushQuote := func() {
+		if len(quote) == 0 {
+			return
+		}
+		start := len(mb.mdl.Blocks)
+		mb.blocks(quote)
+		for _, blk := range mb.mdl.Blocks[start:] {
+			if blk.Paragraph != nil {
+				blk.Paragraph.Style.IndentLeftPx += 40
+			}
+		}
+		quote = nil
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+
+		if q, ok := strings.CutPrefix(trimmed, ">"); ok && indent < 4 {
+			flush()
+			quote = append(quote, strings.TrimPrefix(q, " "))
+			continue
+		}
+		flushQuote()
+
+		switch {
+		case trimmed == "":
+			flush()
+			// Blank lines inside a list keep it open for the next item.
+			continue
+
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			flush()
+			fence := trimmed[:3]
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence); i++ {
+				l := lines[i]
+				for n := 0; n < indent && strings.HasPrefix(l, " "); n++ {
+					l = l[1:]
+				}
+				code = append(code, l)
+			}
+			mb.add(RenderParagraph{Runs: []RenderRun{{Text: strings.Join(code, "\n"), Style: RunStyle{FontFamily: "Courier New"}}}})
+			lists = nil
+			continue
+
+		case mdHeading(trimmed) > 0 && indent < 4:
+			flush()
+			lists = nil
+			level := mdHeading(trimmed)
+			text := strings.TrimSpace(strings.TrimRight(strings.TrimSpace(trimmed[level:]), "#"))
+			mb.add(RenderParagraph{Runs: mdInline(text, RunStyle{}), Style: ParagraphStyle{HeadingLevel: level}})
+			continue
+
+		case mdThematicBreak(trimmed):
+			flush()
+			lists = nil
+			continue
+
+		case strings.Contains(trimmed, "|") && i+1 < len(lines) && mdTableSeparator(lines[i+1]):
+			flush()
+			lists = nil
+			i = mb.table(lines, i)
+			continue
+		}
+
+		if marker, ordered, ok := mdListMarker(trimmed); ok {
+			flush()
+			for len(lists) > 0 && lists[len(lists)-1].indent > indent {
+				lists = lists[:len(lists)-1]
+			}
+			if n := len(lists); n == 0 || lists[n-1].indent < indent || lists[n-1].ordered != ordered {
+				if n > 0 && lists[n-1].indent == indent {
+					lists = lists[:n-1]
+				}
+				mb.nextList++
+				lists = append(lists, mdList{indent: indent, ordered: ordered, id: mb.nextList})
+			}
+			top := lists[len(lists)-1]
+			item = ParagraphStyle{ListType: "unordered", ListLevel: len(lists) - 1, ListID: top.id}
+			if ordered {
+				item.ListType = "ordered"
+			}
+			inList = true
+			para = append(para, strings.TrimSpace(trimmed[len(marker):]))
+			continue
+		}
+
+		if len(para) == 0 && len(lists) > 0 && indent <= lists[0].indent {
+			// An unindented paragraph after a blank line ends the lists.
+			lists = nil
+		}
+		if len(para) == 0 && len(lists) > 0 {
+			item = ParagraphStyle{
+				IndentLeftPx: float64(36*len(lists)) / pxToPt,
+			}
+			inList = true
+		}
+		para = append(para, strings.TrimLeft(line, " "))
+	}
+	flush()
+	flushQuote()
+}
+
+// add appends a paragraph to the document.
+func (mb *mdBuilder) add(p RenderParagraph) {
+	mb.mdl.AppendBlock(DocumentBlock{Paragraph: &p})
+}
+
+// table reads the pipe table starting at lines[i] and returns the index of
+// its last line.
+func (mb *mdBuilder) table(lines []string, i int) int {
+	var align []string
+	for _, spec := range mdTableCells(lines[i+1]) {
+		a := ""
+		switch {
+		case strings.HasPrefix(spec, ":") && strings.HasSuffix(spec, ":"):
+			a = "center"
+		case strings.HasSuffix(spec, ":"):
+			a = "right"
+		case strings.HasPrefix(spec, ":"):
+			a = "left"
+		}
+		align = append(align, a)
+	}
+	var t RenderTable
+	row := func(line string, header bool) {
+		r := RenderTableRow{Header: header}
+		cells := mdTableCells(line)
+		for c := range align {
+			text := ""
+			if c < len(cells) {
+				text = cells[c]
+			}
+			style := RunStyle{Bold: header}
+			cell := RenderTableCell{ColSpan: 1, RowSpan: 1}
+			if text != "" {
+				cell.Paragraphs = []RenderParagraph{{Runs: mdInline(text, style), Style: ParagraphStyle{Alignment: align[c]}}}
+			}
+			r.Cells = append(r.Cells, cell)
+		}
+		t.Rows = append(t.Rows, r)
+	}
+	row(lines[i], true)
+	i += 2
+	for ; i < len(lines) && strings.Contains(lines[i], "|") && strings.TrimSpace(lines[i]) != ""; i++ {
+		row(lines[i], false)
+	}
+	mb.mdl.AppendBlock(DocumentBlock{Table: &t})
+	return i - 1
+}
+
+// mdJoin joins the lines of a paragraph.  A line ending in two spaces or a
+// backslash is a hard break.
+func mdJoin(lines []string) string {
+	var sb strings.Builder
+	for i, l := range lines {
+		hard := strings.HasSuffix(l, "  ")
+		l = strings.TrimRight(l, " ")
+		if !hard && strings.HasSuffix(l, `\`) && !strings.HasSuffix(l, `\\`) {
+			hard = true
+			l = l[:len(l)-1]
+		}
+		sb.WriteString(l)
+		if i < len(lines)-1 {
+			if hard {
+				sb.WriteByte('\n')
+			} else {
+				sb.WriteByte(' ')
+			}
+		}
+	}
+	return sb.String()
+}
+
+// mdHeading returns the level of an ATX heading line, or 0.
+func mdHeading(s string) int {
+	n := 0
+	for n < len(s) && s[n] == '#' {
+		n++
+	}
+	if n == 0 || n > 6 || (n < len(s) && s[n] != ' ') {
+		return 0
+	}
+	return n
+}
+
+// mdThematicBreak reports whether s is a ---, *** or ___ rule.
+func mdThematicBreak(s string) bool {
+	s = strings.ReplaceAll(s, " ", "")
+	if len(s) < 3 {
+		return false
+	}
+	return strings.Count(s, s[:1]) == len(s) && strings.Contains("-*_", s[:1])
+}
+
+// mdListMarker returns the list marker s starts with, including the space
+// after it.
+func mdListMarker(s string) (marker string, ordered, ok bool) {
+	if len(s) >= 2 && strings.ContainsRune("-*+", rune(s[0])) && s[1] == ' ' {
+		return s[:2], false, true
+	}
+	n := 0
+	for n < len(s) && n < 9 && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	if n > 0 && n+1 < len(s) && (s[n] == '.' || s[n] == ')') && s[n+1] == ' ' {
+		return s[:n+2], true, true
+	}
+	return "", false, false
+}
+
+// mdTableSeparator reports whether line is the |---|:--:| row under a
+// table header.
+func mdTableSeparator(line string) bool {
+	cells := mdTableCells(line)
+	if len(cells) == 0 {
+		return false
+	}
+	for _, c := range cells {
+		c = strings.Trim(c, ":")
+		if c == "" || strings.Trim(c, "-") != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// mdTableCells splits a table row at unescaped pipes.
+func mdTableCells(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	var cells []string
+	var sb strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			sb.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(sb.String()))
+			sb.Reset()
+		default:
+			sb.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(sb.String()))
+}
+
+// -----------------------------------------------------------------------------
+// Inline Markdown
+// -----------------------------------------------------------------------------
+
+// mdInline converts inline Markdown to runs in style base.
+func mdInline(s string, base RunStyle) []RenderRun {
+	var runs []RenderRun
+	add := func(text string, st RunStyle, href string) {
+		if text == "" {
+			return
+		}
+		if n := len(runs); n > 0 && runs[n-1].Style == st && runs[n-1].Href == href {
+			runs[n-1].Text += text
+			return
+		}
+		runs = append(runs, RenderRun{Text: text, Style: st, Href: href})
+	}
+	mdSpans(s, base, "", add)
+	return runs
+}
+
+// mdSpans walks s, calling add for each piece of text with its style.
+func mdSpans(s string, st RunStyle, href string, add func(string, RunStyle, string)) {
+	var text strings.Builder
+	emit := func() {
+		add(text.String(), st, href)
+		text.Reset()
+	}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte("\\`*_{}[]()#+-.!|~>", s[i+1]) >= 0:
+			text.WriteByte(s[i+1])
+			i += 2
+			continue
+
+		case c == '`':
+			n := 1
+			for i+n < len(s) && s[i+n] == '`' {
+				n++
+			}
+			fence := s[i : i+n]
+			if end := strings.Index(s[i+n:], fence); end >= 0 {
+				emit()
+				code := st
+				code.FontFamily = "Courier New"
+				add(strings.TrimSpace(s[i+n:i+n+end]), code, href)
+				i += 2*n + end
+				continue
+			}
+
+		case c == '[' && href == "":
+			if label, url, n, ok := mdLink(s[i:]); ok {
+				emit()
+				mdSpans(label, st, url, add)
+				i += n
+				continue
+			}
+
+		case c == '*' || c == '_' || c == '~':
+			n := 1
+			for i+n < len(s) && s[i+n] == c && n < 2 {
+				n++
+			}
+			if c == '~' && n != 2 {
+				break
+			}
+			delim := s[i : i+n]
+			if c == '_' && i > 0 && mdWordChar(s[i-1]) {
+				break
+			}
+			end := mdCloser(s, i+n, delim)
+			if end < 0 {
+				break
+			}
+			emit()
+			inner := st
+			switch {
+			case c == '~':
+				inner.Strike = true
+			case n == 2:
+				inner.Bold = true
+			default:
+				inner.Italic = true
+			}
+			mdSpans(s[i+n:end], inner, href, add)
+			i = end + n
+			continue
+		}
+		text.WriteByte(c)
+		i++
+	}
+	emit()
+}
+
+// mdCloser returns the index of the delimiter closing an emphasis span that
+// opens before from, or -1.
+func mdCloser(s string, from int, delim string) int {
+	if from >= len(s) || s[from] == ' ' {
+		return -1
+	}
+	for i := from + 1; i+len(delim) <= len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if !strings.HasPrefix(s[i:], delim) || s[i-1] == ' ' {
+			continue
+		}
+		// A single delimiter must not be half of a double one.
+		if len(delim) == 1 && i+1 < len(s) && s[i+1] == delim[0] {
+			i++
+			continue
+		}
+		if delim[0] == '_' && i+len(delim) < len(s) && mdWordChar(s[i+len(delim)]) {
+			continue
+		}
+		return i
+	}
+	return -1
+}
+
+// mdLink parses [label](url) at the start of s and returns the number of
+// bytes consumed.
+func mdLink(s string) (label, url string, n int, ok bool) {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth > 0 {
+				continue
+			}
+			if i+1 >= len(s) || s[i+1] != '(' {
+				return "", "", 0, false
+			}
+			end := strings.IndexByte(s[i+2:], ')')
+			if end < 0 {
+				return "", "", 0, false
+			}
+			target := strings.TrimSpace(s[i+2 : i+2+end])
+			if sp := strings.IndexByte(target, ' '); sp >= 0 {
+				target = target[:sp] // drop a "title"
+			}
+			target = strings.TrimSuffix(strings.TrimPrefix(target, "<"), ">")
+			return s[1:i], target, i + 3 + end, true
+		}
+	}
+	return "", "", 0, false
+}
+
+func mdWordChar(c byte) bool {
+	return c < 0x80 && (unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)))
+}
@@ -0,0 +1,299 @@
+package docx
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/aerissecure/convert/diag"
+	"github.com/unidoc/unioffice/schema/soo/wml"
+)
+
+// -----------------------------------------------------------------------------
+// Footnote and endnote numbering
+// -----------------------------------------------------------------------------
+//
+// Note reference marks are not stored in the document; Word computes them
+// from the numbering rules in settings.xml (w:footnotePr / w:endnotePr),
+// which each section's w:sectPr may override.  Sections are delimited by the
+// w:sectPr in the properties of a section's last paragraph, with the final
+// section described by the w:sectPr of the body.
+//
+// HTML has no pages, so "restart each page" is approximated with the page
+// boundaries Word recorded when the document was last saved
+// (w:lastRenderedPageBreak) and explicit page breaks.
+
+const (
+	noteFootnote = "footnote"
+	noteEndnote  = "endnote"
+)
+
+// noteRules are the numbering rules of one kind of note in one section.
+type noteRules struct {
+	format  wml.ST_NumberFormat
+	start   int64
+	restart wml.ST_RestartNumber
+}
+
+// override applies the properties specified in a footnotePr/endnotePr.
+func (r noteRules) override(f *wml.CT_NumFmt, start *wml.CT_DecimalNumber, restart *wml.CT_NumRestart) noteRules {
+	if f != nil && f.ValAttr != wml.ST_NumberFormatUnset {
+		r.format = f.ValAttr
+	}
+	if start != nil {
+		r.start = start.ValAttr
+	}
+	if restart != nil && restart.ValAttr != wml.ST_RestartNumberUnset {
+		r.restart = restart.ValAttr
+	}
+	return r
+}
+
+// noteCounter numbers the references of one kind of note.
+type noteCounter struct {
+	rules   []noteRules // per section
+	section int
+	next    int64
+}
+
+func (c *noteCounter) current() noteRules {
+	if c.section < len(c.rules) {
+		return c.rules[c.section]
+	}
+	return c.rules[len(c.rules)-1]
+}
+
+// mark returns the reference mark for the next note and advances the counter.
+func (c *noteCounter) mark() string {
+	r := c.current()
+	m := formatNumber(c.next, r.format)
+	c.next++
+	return m
+}
+
+// newSection moves to the next section, restarting if its rules say so.
+func (c *noteCounter) newSection() {
+	c.section++
+	if r := c.current(); r.restart != wml.ST_RestartNumberContinuous {
+		c.next = r.start
+	}
+}
+
+// newPage restarts numbering for sections numbered per page.
+func (c *noteCounter) newPage() {
+	if r := c.current(); r.restart == wml.ST_RestartNumberEachPage {
+		c.next = r.start
+	}
+}
+
+// noteNumbering tracks footnote and endnote numbering through the document.
+type noteNumbering struct {
+	footnotes noteCounter
+	endnotes  noteCounter
+}
+
+// newNoteNumbering derives the numbering rules of every section from the
+// document settings and the sections' own properties.
+func newNoteNumbering(settings *wml.CT_Settings, sections []*wml.CT_SectPr) *noteNumbering {
+	foot := noteRules{format: wml.ST_NumberFormatDecimal, start: 1, restart: wml.ST_RestartNumberContinuous}
+	end := noteRules{format: wml.ST_NumberFormatLowerRoman, start: 1, restart: wml.ST_RestartNumberContinuous}
+	if settings != nil {
+		if fp := settings.FootnotePr; fp != nil {
+			foot = foot.override(fp.NumFmt, fp.NumStart, fp.NumRestart)
+		}
+		if ep := settings.EndnotePr; ep != nil {
+			end = end.override(ep.NumFmt, ep.NumStart, ep.NumRestart)
+		}
+	}
+	n := &noteNumbering{}
+	for _, sp := range sections {
+		f, e := foot, end
+		if sp != nil && sp.FootnotePr != nil {
+			f = f.override(sp.FootnotePr.NumFmt, sp.FootnotePr.NumStart, sp.FootnotePr.NumRestart)
+		}
+		if sp != nil && sp.EndnotePr != nil {
+			e = e.override(sp.EndnotePr.NumFmt, sp.EndnotePr.NumStart, sp.EndnotePr.NumRestart)
+		}
+		n.footnotes.rules = append(n.footnotes.rules, f)
+		n.endnotes.rules = append(n.endnotes.rules, e)
+	}
+	if len(sections) == 0 {
+		n.footnotes.rules = []noteRules{foot}
+		n.endnotes.rules = []noteRules{end}
+	}
+	n.footnotes.next = n.footnotes.rules[0].start
+	n.endnotes.next = n.endnotes.rules[0].start
+	return n
+}
+
+// reference builds the NoteReference for a w:footnoteReference or
+// w:endnoteReference.  Notes with a custom mark do not consume a number;
+// their mark is the text that follows in the run.
+func (n *noteNumbering) reference(kind string, ref *wml.CT_FtnEdnRef) *NoteReference {
+	nr := &NoteReference{Kind: kind, ID: ref.IdAttr}
+	if ref.CustomMarkFollowsAttr != nil && onOffValue(ref.CustomMarkFollowsAttr) {
+		nr.CustomMark = true
+		return nr
+	}
+	if kind == noteEndnote {
+		nr.Mark = n.endnotes.mark()
+	} else {
+		nr.Mark = n.footnotes.mark()
+	}
+	return nr
+}
+
+func (n *noteNumbering) newSection() {
+	n.footnotes.newSection()
+	n.endnotes.newSection()
+}
+
+func (n *noteNumbering) newPage() {
+	n.footnotes.newPage()
+	n.endnotes.newPage()
+}
+
+// documentSections returns the section properties of the body in document
+// order: one per paragraph-level w:sectPr, followed by the body's own.
+func documentSections(body *wml.CT_Body) []*wml.CT_SectPr {
+	var out []*wml.CT_SectPr
+	var walk func(c *wml.EG_ContentBlockContent)
+	walk = func(c *wml.EG_ContentBlockContent) {
+		for _, par := range c.P {
+			if par.PPr != nil && par.PPr.SectPr != nil {
+				out = append(out, par.PPr.SectPr)
+			}
+		}
+		if c.Sdt != nil && c.Sdt.SdtContent != nil {
+			walk(&wml.EG_ContentBlockContent{
+				CustomXml: c.Sdt.SdtContent.CustomXml,
+				Sdt:       c.Sdt.SdtContent.Sdt,
+				P:         c.Sdt.SdtContent.P,
+			})
+		}
+		if c.CustomXml != nil {
+			for _, c2 := range c.CustomXml.EG_ContentBlockContent {
+				walk(c2)
+			}
+		}
+	}
+	for _, bl := range body.EG_BlockLevelElts {
+		for _, c := range bl.EG_ContentBlockContent {
+			walk(c)
+		}
+	}
+	return append(out, body.SectPr)
+}
+
+// -----------------------------------------------------------------------------
+// Note bodies
+// -----------------------------------------------------------------------------
+//
+// unioffice reads footnotes.xml and endnotes.xml but does not expose them, so
+// the parts are located through the document relationships and decoded here.
+// Only notes that are referenced from the body end up in the model; the
+// separator notes Word keeps alongside them are never referenced.
+
+const (
+	relFootnotes = "/footnotes"
+	relEndnotes  = "/endnotes"
+)
+
+type noteKey struct {
+	kind string
+	id   int64
+}
+
+// noteReferenced records the first reference to each note.
+func (p *parser) noteReferenced(nr *NoteReference) {
+	k := noteKey{nr.Kind, nr.ID}
+	if p.noteSeen[k] {
+		return
+	}
+	if p.noteSeen == nil {
+		p.noteSeen = make(map[noteKey]bool)
+	}
+	p.noteSeen[k] = true
+	p.noteRefs = append(p.noteRefs, Note{NoteReference: *nr, Section: p.section})
+}
+
+// loadNoteParts decodes footnotes.xml and endnotes.xml.  Their content is
+// converted by readNotes once the body has been walked and the referenced
+// notes are known.
+func (p *parser) loadNoteParts() {
+	if p.pkg == nil {
+		return
+	}
+	p.noteBodies = make(map[noteKey]*wml.CT_FtnEdn)
+	for _, rel := range sortedRels(p.docRels()) {
+		if rel.External() {
+			continue
+		}
+		var (
+			kind string
+			list []*wml.CT_FtnEdn
+		)
+		footnotes, endnotes := strings.HasSuffix(rel.Type, relFootnotes), strings.HasSuffix(rel.Type, relEndnotes)
+		if !footnotes && !endnotes {
+			continue
+		}
+		part := resolveTarget(p.pkg.main, rel.Target)
+		data, err := p.pkg.readPart(part)
+		if err != nil {
+			p.warn(diag.MissingPart, diag.Location{Part: part}, "notes: "+err.Error())
+			continue
+		}
+		p.scanTrackedChanges(data)
+		if footnotes {
+			var x wml.Footnotes
+			err = xml.Unmarshal(data, &x)
+			kind, list = noteFootnote, x.Footnote
+		} else {
+			var x wml.Endnotes
+			err = xml.Unmarshal(data, &x)
+			kind, list = noteEndnote, x.Endnote
+		}
+		if err != nil {
+			p.warn(diag.BadPart, diag.Location{Part: part}, "notes: "+err.Error())
+			continue
+		}
+		for _, n := range list {
+			p.noteBodies[noteKey{kind, n.IdAttr}] = n
+			p.src.add(fmt.Sprintf("%s%d/", kind, n.IdAttr), n.EG_BlockLevelElts)
+		}
+	}
+}
+
+// readNotes converts the bodies of the referenced notes, footnotes first.
+func (p *parser) readNotes() {
+	for _, kind := range []string{noteFootnote, noteEndnote} {
+		for _, n := range p.noteRefs {
+			if n.Kind != kind {
+				continue
+			}
+			if x, ok := p.noteBodies[noteKey{n.Kind, n.ID}]; ok {
+				n.Blocks = p.detachedBlocks(x.EG_BlockLevelElts)
+				p.mdl.Notes = append(p.mdl.Notes, n)
+			}
+		}
+	}
+}
+
+// detachedBlocks converts content kept outside the body, such as a note or
+// comment.  The blocks are collected separately from the body; content
+// controls and revisions found in them are still listed in the model.
+func (p *parser) detachedBlocks(elts []*wml.EG_BlockLevelElts) []DocumentBlock {
+	outer, emit := p.mdl, p.emit
+	p.mdl = DocumentModel{ContentControls: outer.ContentControls, Revisions: outer.Revisions}
+	p.emit = nil
+	for _, bl := range elts {
+		for _, c := range bl.EG_ContentBlockContent {
+			p.walkBlockContent(c, nil)
+		}
+	}
+	p.flushDropCap()
+	blocks := p.mdl.Blocks
+	outer.ContentControls, outer.Revisions = p.mdl.ContentControls, p.mdl.Revisions
+	p.mdl, p.emit = outer, emit
+	return blocks
+}
@@ -0,0 +1,207 @@
+package docx
+
+import (
+	"strings"
+
+	"github.com/unidoc/unioffice/document"
+	"github.com/unidoc/unioffice/schema/soo/wml"
+)
+
+// -----------------------------------------------------------------------------
+// List numbering
+// -----------------------------------------------------------------------------
+//
+// A list paragraph refers by w:numPr to a numbering instance (w:num) and a
+// level.  The instance names an abstract numbering definition, whose levels
+// give the number format, start value and restart rule, and may override
+// some levels or their start values.  Instances of one definition share its
+// counters, as in Word, so a list interrupted by other paragraphs or
+// continued under another instance goes on counting; a start override
+// restarts the count where the instance is first used.  A level restarts
+// whenever a shallower level is used, unless its w:lvlRestart says
+// otherwise.  Picture bullets are rendered as discs.
+
+const relNumbering = "/numbering"
+
+// listLevel is the resolved definition of one list level.
+type listLevel struct {
+	format  wml.ST_NumberFormat
+	text    string // w:lvlText, the bullet character of bullet levels
+	start   int
+	restart *int64 // w:lvlRestart; nil restarts after any shallower level
+}
+
+// listNumbering resolves numbering instances and counts list items.
+type listNumbering struct {
+	nums     map[int64]*wml.CT_Num
+	abstract map[int64]*wml.CT_AbstractNum
+	styles   styleSheet
+
+	counts map[int64]*[9]int // by abstract definition; 0 is not started
+	used   map[[2]int64]bool // instance and level pairs seen
+}
+
+// newListNumbering indexes the numbering part of doc, if it has one.
+func newListNumbering(doc *document.Document, styles styleSheet, hasPart bool) *listNumbering {
+	n := &listNumbering{
+		nums:     make(map[int64]*wml.CT_Num),
+		abstract: make(map[int64]*wml.CT_AbstractNum),
+		styles:   styles,
+		counts:   make(map[int64]*[9]int),
+		used:     make(map[[2]int64]bool),
+	}
+	x := doc.Numbering.X()
+	if !hasPart || x == nil {
+		return n
+	}
+	for _, num := range x.Num {
+		n.nums[num.NumIdAttr] = num
+	}
+	for _, an := range x.AbstractNum {
+		n.abstract[an.AbstractNumIdAttr] = an
+	}
+	return n
+}
+
+// abstractOf returns the ID of the abstract definition of instance numID,
+// following numbering styles (w:numStyleLink) to the definition they name.
+func (n *listNumbering) abstractOf(numID int64) (int64, bool) {
+	for range 4 {
+		num, ok := n.nums[numID]
+		if !ok || num.AbstractNumId == nil {
+			return 0, false
+		}
+		id := num.AbstractNumId.ValAttr
+		an, ok := n.abstract[id]
+		if !ok || an.NumStyleLink == nil {
+			return id, ok
+		}
+		st, ok := n.styles.styles[an.NumStyleLink.ValAttr]
+		if !ok || st.PPr == nil || st.PPr.NumPr == nil || st.PPr.NumPr.NumId == nil {
+			return id, true
+		}
+		numID = st.PPr.NumPr.NumId.ValAttr
+	}
+	return 0, false
+}
+
+// level returns the definition of level ilvl of instance numID, with the
+// instance's overrides applied.
+func (n *listNumbering) level(numID, abstractID, ilvl int64) listLevel {
+	lvl := listLevel{start: 1}
+	apply := func(l *wml.CT_Lvl) {
+		if l.NumFmt != nil {
+			lvl.format = l.NumFmt.ValAttr
+		}
+		if l.LvlText != nil && l.LvlText.ValAttr != nil {
+			lvl.text = *l.LvlText.ValAttr
+		}
+		if l.Start != nil {
+			lvl.start = int(l.Start.ValAttr)
+		}
+		if l.LvlRestart != nil {
+			lvl.restart = &l.LvlRestart.ValAttr
+		}
+	}
+	if an := n.abstract[abstractID]; an != nil {
+		for _, l := range an.Lvl {
+			if l.IlvlAttr == ilvl {
+				apply(l)
+			}
+		}
+	}
+	for _, o := range n.nums[numID].LvlOverride {
+		if o.IlvlAttr != ilvl {
+			continue
+		}
+		if o.Lvl != nil {
+			apply(o.Lvl)
+		}
+		if o.StartOverride != nil {
+			lvl.start = int(o.StartOverride.ValAttr)
+		}
+	}
+	return lvl
+}
+
+// item numbers a paragraph of level ilvl of instance numID, setting the
+// list fields of s.  It leaves s alone if the instance is unknown.
+func (n *listNumbering) item(s *ParagraphStyle, numID, ilvl int64) {
+	abstractID, ok := n.abstractOf(numID)
+	if !ok {
+		return
+	}
+	ilvl = min(max(ilvl, 0), 8)
+	lvl := n.level(numID, abstractID, ilvl)
+	counts := n.counts[abstractID]
+	if counts == nil {
+		counts = new([9]int)
+		n.counts[abstractID] = counts
+	}
+	key := [2]int64{numID, ilvl}
+	if !n.used[key] {
+		n.used[key] = true
+		if n.hasStartOverride(numID, ilvl) {
+			counts[ilvl] = 0
+		}
+	}
+	if counts[ilvl] == 0 {
+		counts[ilvl] = lvl.start
+	} else {
+		counts[ilvl]++
+	}
+	for deeper := ilvl + 1; deeper < int64(len(counts)); deeper++ {
+		if r := n.level(numID, abstractID, deeper).restart; r == nil || *r != 0 && ilvl < *r {
+			counts[deeper] = 0
+		}
+	}
+
+	s.ListID = int(numID)
+	s.ListLevel = int(ilvl)
+	s.ListMarker = listMarker(lvl)
+	switch lvl.format {
+	case wml.ST_NumberFormatBullet, wml.ST_NumberFormatNone:
+		s.ListType = "unordered"
+	default:
+		s.ListType = "ordered"
+		s.ListNumber = counts[ilvl]
+	}
+}
+
+// hasStartOverride reports whether instance numID restarts level ilvl.
+func (n *listNumbering) hasStartOverride(numID, ilvl int64) bool {
+	for _, o := range n.nums[numID].LvlOverride {
+		if o.IlvlAttr == ilvl && o.StartOverride != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// listMarker returns the CSS list-style-type of lvl.  Bullets are told
+// apart by the characters Word's default levels use.
+func listMarker(lvl listLevel) string {
+	switch lvl.format {
+	case wml.ST_NumberFormatNone:
+		return "none"
+	case wml.ST_NumberFormatBullet:
+		switch {
+		case lvl.text == "o":
+			return "circle"
+		case strings.ContainsAny(lvl.text, "§▪■\uf0a7"):
+			return "square"
+		}
+		return "disc"
+	case wml.ST_NumberFormatLowerLetter:
+		return "lower-alpha"
+	case wml.ST_NumberFormatUpperLetter:
+		return "upper-alpha"
+	case wml.ST_NumberFormatLowerRoman:
+		return "lower-roman"
+	case wml.ST_NumberFormatUpperRoman:
+		return "upper-roman"
+	case wml.ST_NumberFormatDecimalZero:
+		return "decimal-leading-zero"
+	}
+	return "decimal"
+}
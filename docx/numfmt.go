@@ -0,0 +1,113 @@
+package docx
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/unidoc/unioffice/schema/soo/wml"
+)
+
+// -----------------------------------------------------------------------------
+// Number formatting
+// -----------------------------------------------------------------------------
+//
+// WordprocessingML describes automatic numbers (note marks, list labels, page
+// numbers) by an ST_NumberFormat.  formatNumber renders the formats that have
+// a sensible Western rendering; everything else falls back to decimal.
+
+// chicagoSymbols is the symbol sequence of the "chicago" format.  Past the
+// fourth note the symbols are repeated: **, ††, ‡‡, §§, ***, ...
+var chicagoSymbols = []string{"*", "†", "‡", "§"}
+
+// formatNumber renders n in the given number format.
+func formatNumber(n int64, f wml.ST_NumberFormat) string {
+	switch f {
+	case wml.ST_NumberFormatNone:
+		return ""
+	case wml.ST_NumberFormatBullet:
+		return "•"
+	case wml.ST_NumberFormatUpperRoman:
+		return romanNumeral(n)
+	case wml.ST_NumberFormatLowerRoman:
+		return strings.ToLower(romanNumeral(n))
+	case wml.ST_NumberFormatUpperLetter:
+		return letterNumber(n)
+	case wml.ST_NumberFormatLowerLetter:
+		return strings.ToLower(letterNumber(n))
+	case wml.ST_NumberFormatChicago:
+		if n < 1 {
+			break
+		}
+		sym := chicagoSymbols[(n-1)%int64(len(chicagoSymbols))]
+		return strings.Repeat(sym, int((n-1)/int64(len(chicagoSymbols)))+1)
+	case wml.ST_NumberFormatDecimalZero:
+		if n >= 0 && n < 10 {
+			return "0" + strconv.FormatInt(n, 10)
+		}
+	case wml.ST_NumberFormatOrdinal:
+		return strconv.FormatInt(n, 10) + ordinalSuffix(n)
+	case wml.ST_NumberFormatDecimalEnclosedParen:
+		return "(" + strconv.FormatInt(n, 10) + ")"
+	case wml.ST_NumberFormatDecimalEnclosedFullstop:
+		return strconv.FormatInt(n, 10) + "."
+	case wml.ST_NumberFormatNumberInDash:
+		return "- " + strconv.FormatInt(n, 10) + " -"
+	case wml.ST_NumberFormatDecimalFullWidth:
+		return fullWidthDigits(strconv.FormatInt(n, 10))
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+// romanNumeral renders n in upper-case Roman numerals.  Values outside
+// 1..3999 cannot be written that way and are returned as decimal.
+func romanNumeral(n int64) string {
+	if n < 1 || n > 3999 {
+		return strconv.FormatInt(n, 10)
+	}
+	values := []int64{1000, 900, 500, 400, 100, 90, 50, 40, 10, 9, 5, 4, 1}
+	symbols := []string{"M", "CM", "D", "CD", "C", "XC", "L", "XL", "X", "IX", "V", "IV", "I"}
+	var b strings.Builder
+	for i, v := range values {
+		for n >= v {
+			b.WriteString(symbols[i])
+			n -= v
+		}
+	}
+	return b.String()
+}
+
+// letterNumber renders n the way Word letters lists: A..Z, then AA..ZZ,
+// AAA..ZZZ and so on (not spreadsheet-style AA, AB, ...).
+func letterNumber(n int64) string {
+	if n < 1 {
+		return strconv.FormatInt(n, 10)
+	}
+	letter := string(rune('A' + (n-1)%26))
+	return strings.Repeat(letter, int((n-1)/26)+1)
+}
+
+func ordinalSuffix(n int64) string {
+	if n%100 >= 11 && n%100 <= 13 {
+		return "th"
+	}
+	switch n % 10 {
+	case 1:
+		return "st"
+	case 2:
+		return "nd"
+	case 3:
+		return "rd"
+	}
+	return "th"
+}
+
+func fullWidthDigits(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			r += '０' - '0'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,296 @@
+package docx
+
+import (
+	"bytes"
+	"encoding/xml"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/aerissecure/convert/internal/cfb"
+	"github.com/unidoc/unioffice/schema/soo/wml"
+)
+
+// -----------------------------------------------------------------------------
+// Embedded OLE objects
+// -----------------------------------------------------------------------------
+//
+// Word stores embedded objects as
+//
+//	<w:object>
+//	  <v:shape style="width:…pt;height:…pt"><v:imagedata r:id="rIdPreview"/></v:shape>
+//	  <o:OLEObject ProgID="Excel.Sheet.12" Type="Embed" r:id="rIdPayload"/>
+//	</w:object>
+//
+// unioffice keeps the w:object element but discards the VML children, which
+// carry everything interesting.  We therefore scan document.xml ourselves and
+// pair the n-th w:object found there with the n-th CT_Object in the unioffice
+// tree.
+
+// rawObject is the information recovered for a single w:object.
+type rawObject struct {
+	progID       string
+	relID        string
+	previewRelID string
+	title        string
+	alt          string
+	linked       bool
+	widthPt      float64
+	heightPt     float64
+}
+
+const (
+	nsMC   = "http://schemas.openxmlformats.org/markup-compatibility/2006"
+	nsRels = "relationships"
+)
+
+// scanObjects returns the w:object elements of a WordprocessingML part in
+// document order.  Content that unioffice drops (markup-compatibility blocks
+// and tracked insertions/deletions) is skipped as well so the ordinal
+// positions line up with the unioffice tree.
+func scanObjects(data []byte) []rawObject {
+	var (
+		out     []rawObject
+		cur     *rawObject
+		depth   int // depth inside the current w:object
+		skip    int // depth inside skipped content
+		decoder = xml.NewDecoder(bytes.NewReader(data))
+	)
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch el := tok.(type) {
+		case xml.StartElement:
+			if skip > 0 {
+				skip++
+				continue
+			}
+			if el.Name.Space == nsMC && el.Name.Local == "AlternateContent" {
+				skip = 1
+				continue
+			}
+			switch el.Name.Local {
+			case "ins", "del", "moveFrom", "moveTo":
+				skip = 1
+				continue
+			}
+			if cur == nil {
+				if el.Name.Local == "object" {
+					cur = &rawObject{}
+					depth = 1
+				}
+				continue
+			}
+			depth++
+			switch el.Name.Local {
+			case "shape":
+				cur.widthPt, cur.heightPt = parseShapeSize(attrValue(el, "style"))
+				cur.alt = attrValue(el, "alt")
+			case "imagedata":
+				cur.previewRelID = relAttr(el, "id")
+				if t := attrValue(el, "title"); t != "" {
+					cur.title = t
+				}
+			case "OLEObject":
+				cur.progID = attrValue(el, "ProgID")
+				cur.relID = relAttr(el, "id")
+				cur.linked = strings.EqualFold(attrValue(el, "Type"), "Link")
+			case "objectEmbed", "objectLink":
+				cur.progID = attrValue(el, "progId")
+				cur.relID = relAttr(el, "id")
+				cur.linked = el.Name.Local == "objectLink"
+			}
+		case xml.EndElement:
+			if skip > 0 {
+				skip--
+				continue
+			}
+			if cur != nil {
+				depth--
+				if depth == 0 {
+					out = append(out, *cur)
+					cur = nil
+				}
+			}
+		}
+	}
+	return out
+}
+
+// attrValue returns the value of the first attribute with the given local
+// name that is not in the relationships namespace.
+func attrValue(el xml.StartElement, local string) string {
+	for _, a := range el.Attr {
+		if a.Name.Local == local && !strings.HasSuffix(a.Name.Space, nsRels) {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// relAttr returns the value of a relationship attribute such as r:id.
+func relAttr(el xml.StartElement, local string) string {
+	for _, a := range el.Attr {
+		if a.Name.Local == local && strings.HasSuffix(a.Name.Space, nsRels) {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// parseShapeSize extracts width/height in points from a VML style attribute.
+func parseShapeSize(style string) (w, h float64) {
+	for _, decl := range strings.Split(style, ";") {
+		k, v, ok := strings.Cut(decl, ":")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(k) {
+		case "width":
+			w = cssLengthPt(v)
+		case "height":
+			h = cssLengthPt(v)
+		}
+	}
+	return w, h
+}
+
+// cssUnitsPt holds the size of the supported CSS/VML length units in points.
+var cssUnitsPt = map[string]float64{"pt": 1, "in": 72, "cm": 72 / 2.54, "mm": 72 / 25.4, "px": 0.75, "pc": 12}
+
+// cssLengthPt converts a CSS/VML length to points.  Unitless or unknown
+// values are ambiguous in VML and yield 0.
+func cssLengthPt(v string) float64 {
+	v = strings.TrimSpace(v)
+	for unit, factor := range cssUnitsPt {
+		if strings.HasSuffix(v, unit) {
+			f, err := strconv.ParseFloat(strings.TrimSuffix(v, unit), 64)
+			if err != nil {
+				return 0
+			}
+			return f * factor
+		}
+	}
+	return 0
+}
+
+// embeddedObject resolves a scanned object against the package.
+func (p *parser) embeddedObject(raw rawObject, x *wml.CT_Object) EmbeddedObject {
+	obj := EmbeddedObject{
+		ProgID:   raw.progID,
+		Type:     objectTypeName(raw.progID),
+		Linked:   raw.linked,
+		WidthPt:  raw.widthPt,
+		HeightPt: raw.heightPt,
+	}
+	if obj.WidthPt == 0 && x != nil && x.DxaOrigAttr != nil && x.DxaOrigAttr.ST_UnsignedDecimalNumber != nil {
+		obj.WidthPt = float64(*x.DxaOrigAttr.ST_UnsignedDecimalNumber) / 20
+	}
+	if obj.HeightPt == 0 && x != nil && x.DyaOrigAttr != nil && x.DyaOrigAttr.ST_UnsignedDecimalNumber != nil {
+		obj.HeightPt = float64(*x.DyaOrigAttr.ST_UnsignedDecimalNumber) / 20
+	}
+	if p.pkg == nil {
+		return obj
+	}
+	rels := p.docRels()
+
+	if rel, ok := rels[raw.relID]; ok {
+		if rel.External() || obj.Linked {
+			obj.Linked = true
+			obj.FileName = path.Base(strings.ReplaceAll(rel.Target, "\\", "/"))
+			obj.Source = rel.Target
+		} else {
+			obj.PartName = resolveTarget(p.pkg.main, rel.Target)
+			obj.ContentType = p.pkg.contentType(obj.PartName)
+			obj.FileName = path.Base(obj.PartName)
+			if name := p.oleNativeFileName(obj.PartName); name != "" {
+				obj.FileName = name
+			}
+		}
+	}
+	obj.AltText = raw.alt
+	if raw.title != "" && obj.FileName == "" {
+		obj.FileName = raw.title
+	}
+
+	if rel, ok := rels[raw.previewRelID]; ok && !rel.External() {
+		part := resolveTarget(p.pkg.main, rel.Target)
+		if data, err := p.pkg.readPart(part); err == nil {
+			obj.Preview = data
+			obj.PreviewType = imageMIMEType(part)
+			obj.PreviewPart = part
+		}
+	}
+	return obj
+}
+
+// oleNativeFileName returns the original file name stored in the
+// \x01Ole10Native stream of an OLE "Package" payload, or "".
+func (p *parser) oleNativeFileName(part string) string {
+	data, err := p.pkg.readPart(part)
+	if err != nil || !cfb.IsCFB(data) {
+		return ""
+	}
+	f, err := cfb.Open(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return ""
+	}
+	native, err := f.ReadStream("\x01Ole10Native")
+	if err != nil || len(native) < 7 {
+		return ""
+	}
+	// uint32 size, uint16 flags, then the NUL-terminated label.
+	label, _, _ := bytes.Cut(native[6:], []byte{0})
+	return strings.TrimSpace(string(label))
+}
+
+// objectTypeName maps an OLE ProgID to a human readable type.
+func objectTypeName(progID string) string {
+	id := strings.ToLower(progID)
+	switch {
+	case strings.HasPrefix(id, "excel.sheet"):
+		return "Excel worksheet"
+	case strings.HasPrefix(id, "excel.chart"):
+		return "Excel chart"
+	case strings.HasPrefix(id, "word.document"):
+		return "Word document"
+	case strings.HasPrefix(id, "powerpoint."):
+		return "PowerPoint presentation"
+	case strings.HasPrefix(id, "acroexch.document"), strings.HasPrefix(id, "acrobat.document"), strings.Contains(id, "pdf"):
+		return "PDF document"
+	case strings.HasPrefix(id, "visio."):
+		return "Visio drawing"
+	case strings.HasPrefix(id, "equation."):
+		return "Equation"
+	case strings.HasPrefix(id, "package"):
+		return "Packaged file"
+	case id == "":
+		return "Embedded object"
+	}
+	return progID
+}
+
+// imageMIMEType guesses the MIME type of an image part from its extension.
+func imageMIMEType(name string) string {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".png":
+		return "image/png"
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".gif":
+		return "image/gif"
+	case ".bmp":
+		return "image/bmp"
+	case ".tif", ".tiff":
+		return "image/tiff"
+	case ".svg":
+		return "image/svg+xml"
+	case ".emf":
+		return "image/x-emf"
+	case ".wmf":
+		return "image/x-wmf"
+	}
+	return "application/octet-stream"
+}
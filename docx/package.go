@@ -0,0 +1,166 @@
+package docx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/aerissecure/convert/internal/safezip"
+)
+
+// -----------------------------------------------------------------------------
+// Raw package access
+// -----------------------------------------------------------------------------
+//
+// unioffice decodes the main document part but silently drops a number of
+// constructs we care about (VML inside w:object, parts it has no type for).
+// opcPackage gives the parser direct access to the ZIP container so those
+// pieces can be read alongside the unioffice model.
+
+// mainDocumentPart is the conventional location of the main document part,
+// assumed when the package does not name one.
+const mainDocumentPart = "word/document.xml"
+
+// relOfficeDocument is the final path segment of the type of the package
+// relationship to the main document part, the same in transitional and
+// strict documents.
+const relOfficeDocument = "/officeDocument"
+
+// relationship is a single entry of a .rels part.
+type relationship struct {
+	ID         string `xml:"Id,attr"`
+	Type       string `xml:"Type,attr"`
+	Target     string `xml:"Target,attr"`
+	TargetMode string `xml:"TargetMode,attr"`
+}
+
+// External reports whether the relationship points outside the package.
+func (r relationship) External() bool {
+	return strings.EqualFold(r.TargetMode, "External")
+}
+
+// opcPackage is a read-only view of the parts in a DOCX container.
+type opcPackage struct {
+	files map[string]*zip.File
+	main  string // name of the main document part
+
+	// content types, loaded on first use
+	defaults  map[string]string // extension -> content type
+	overrides map[string]string // part name -> content type
+}
+
+func openPackage(r io.ReaderAt, size int64) (*opcPackage, error) {
+	zr, err := safezip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	pkg := &opcPackage{files: make(map[string]*zip.File, len(zr.File))}
+	for _, f := range zr.File {
+		pkg.files[strings.TrimPrefix(f.Name, "/")] = f
+	}
+	pkg.main = mainDocumentPart
+	for _, rel := range sortedRels(pkg.rels("")) {
+		if strings.HasSuffix(rel.Type, relOfficeDocument) && !rel.External() {
+			pkg.main = resolveTarget("", rel.Target)
+			break
+		}
+	}
+	return pkg, nil
+}
+
+// readPart returns the contents of the named part.
+func (p *opcPackage) readPart(name string) ([]byte, error) {
+	f, ok := p.files[strings.TrimPrefix(name, "/")]
+	if !ok {
+		return nil, fmt.Errorf("part %q not found", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// hasPart reports whether the named part exists.
+func (p *opcPackage) hasPart(name string) bool {
+	_, ok := p.files[strings.TrimPrefix(name, "/")]
+	return ok
+}
+
+// rels returns the relationships of the named source part keyed by Id.  A
+// missing or malformed .rels part yields an empty map.
+func (p *opcPackage) rels(source string) map[string]relationship {
+	out := make(map[string]relationship)
+	dir, file := path.Split(source)
+	data, err := p.readPart(dir + "_rels/" + file + ".rels")
+	if err != nil {
+		return out
+	}
+	var doc struct {
+		Relationships []relationship `xml:"Relationship"`
+	}
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return out
+	}
+	for _, rel := range doc.Relationships {
+		out[rel.ID] = rel
+	}
+	return out
+}
+
+// sortedRels returns rels ordered by Id, for loops whose result depends on
+// the order, so that output does not vary with map iteration.
+func sortedRels(rels map[string]relationship) []relationship {
+	out := make([]relationship, 0, len(rels))
+	for _, rel := range rels {
+		out = append(out, rel)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// resolveTarget turns a relationship target into a part name relative to the
+// package root.
+func resolveTarget(source, target string) string {
+	if strings.HasPrefix(target, "/") {
+		return strings.TrimPrefix(target, "/")
+	}
+	return path.Clean(path.Join(path.Dir(source), target))
+}
+
+// contentType returns the declared content type of the named part, or "" if
+// [Content_Types].xml does not cover it.
+func (p *opcPackage) contentType(name string) string {
+	if p.defaults == nil {
+		p.defaults = make(map[string]string)
+		p.overrides = make(map[string]string)
+		var ct struct {
+			Defaults []struct {
+				Extension   string `xml:"Extension,attr"`
+				ContentType string `xml:"ContentType,attr"`
+			} `xml:"Default"`
+			Overrides []struct {
+				PartName    string `xml:"PartName,attr"`
+				ContentType string `xml:"ContentType,attr"`
+			} `xml:"Override"`
+		}
+		if data, err := p.readPart("[Content_Types].xml"); err == nil && xml.Unmarshal(data, &ct) == nil {
+			for _, d := range ct.Defaults {
+				p.defaults[strings.ToLower(d.Extension)] = d.ContentType
+			}
+			for _, o := range ct.Overrides {
+				p.overrides[strings.TrimPrefix(o.PartName, "/")] = o.ContentType
+			}
+		}
+	}
+	name = strings.TrimPrefix(name, "/")
+	if ct, ok := p.overrides[name]; ok {
+		return ct
+	}
+	return p.defaults[strings.ToLower(strings.TrimPrefix(path.Ext(name), "."))]
+}
@@ -2,116 +2,1086 @@ package docx
 
 import (
 	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
 
+	"github.com/aerissecure/convert/diag"
+	"github.com/aerissecure/convert/internal/panics"
 	"github.com/unidoc/unioffice/document"
+	"github.com/unidoc/unioffice/schema/soo/ofc/sharedTypes"
 	"github.com/unidoc/unioffice/schema/soo/wml"
 )
 
 // ParseDocumentModel reads a DOCX document from the provided reader and size
-// and builds a DocumentModel intermediate representation.  The current
-// implementation focuses on text content and basic structure (paragraphs and
-// tables).  Most styling information is left at zero-values for now – the
-// HTML renderer will gracefully fall back to defaults when style attributes
-// are empty.
+// and builds a DocumentModel intermediate representation.  Paragraphs and
+// tables carry their run and paragraph formatting resolved through the
+// style hierarchy, list numbering, images, fields and hyperlinks; the model
+// also lists the sections, notes, comments, tracked changes, content
+// controls and embedded objects of the document.  Input that makes the
+// parser panic fails it with a *diag.PanicError.
 func ParseDocumentModel(r io.ReaderAt, size int64) (DocumentModel, error) {
-	doc, err := document.Read(r, size)
+	return ParseDocumentModelWith(r, size, ParseOptions{})
+}
+
+// ParseOptions configures ParseDocumentModelWith.
+type ParseOptions struct {
+	// LegacyConverter, when set, converts .doc input to DOCX so it is
+	// parsed like any other document; without one such input fails with
+	// ErrLegacyFormat.
+	LegacyConverter ExternalConverter
+}
+
+// ParseDocumentModelWith is ParseDocumentModel configured by opts.
+func ParseDocumentModelWith(r io.ReaderAt, size int64, opts ParseOptions) (m DocumentModel, err error) {
+	defer panics.Catch(&err)
+	return parseDocumentModel(r, size, opts, 0)
+}
+
+// parseDocumentModel is ParseDocumentModelWith for a document nested depth
+// altChunks deep.
+func parseDocumentModel(r io.ReaderAt, size int64, opts ParseOptions, depth int) (DocumentModel, error) {
+	// A panic, in unioffice or below, during the body walk is attributed to
+	// the top-level block being converted.
+	var p *parser
+	walking := false
+	defer panics.Annotate(func() (string, string) {
+		if !walking {
+			return "", ""
+		}
+		return p.pkg.main, "block " + strconv.Itoa(p.blocks+1)
+	})
+	p, err := openParser(r, size, opts)
 	if err != nil {
 		return DocumentModel{}, err
 	}
+	p.depth = depth
+	walking = true
+	p.walkBody()
+	walking = false
+	p.finish()
+	return p.mdl, nil
+}
 
-	var mdl DocumentModel
+// ParseDocumentFile is ParseDocumentModel for the file at path.
+func ParseDocumentFile(path string) (DocumentModel, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return DocumentModel{}, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return DocumentModel{}, err
+	}
+	return ParseDocumentModel(f, fi.Size())
+}
 
-	// ---- Build lookup maps from underlying XML ptr -> high-level wrapper ----
-	pMap := make(map[*wml.CT_P]document.Paragraph)
-	for _, p := range doc.Paragraphs() {
-		pMap[p.X()] = p
+// ParseDocumentBlocks parses like ParseDocumentModel but hands each top-level
+// block to fn as soon as it is converted instead of collecting it, so the
+// body is never held in memory as a whole.  The returned model carries
+// everything else (properties, sections, notes, comments, …) but no Blocks,
+// Paragraphs or Tables.  An error from fn stops the walk and is returned.
+// Legacy .doc input fails with ErrLegacyFormat.
+func ParseDocumentBlocks(r io.ReaderAt, size int64, fn func(DocumentBlock) error) (_ DocumentModel, err error) {
+	defer panics.Catch(&err)
+	p, err := openParser(r, size, ParseOptions{})
+	if err != nil {
+		return DocumentModel{}, err
+	}
+	p.emit = fn
+	p.walkBody()
+	if p.err != nil {
+		return p.mdl, p.err
+	}
+	p.emit = nil
+	p.finish()
+	return p.mdl, nil
+}
+
+// openParser reads the package and everything the body walk depends on:
+// properties, raw scans of the main part, note parts and comments.  Legacy
+// .doc input is converted first with opts.LegacyConverter, see openLegacy.
+func openParser(r io.ReaderAt, size int64, opts ParseOptions) (*parser, error) {
+	r, size, err := openLegacy(r, size, opts.LegacyConverter)
+	if err != nil {
+		return nil, err
+	}
+	// The package is opened first so unioffice only sees archives that
+	// passed the safezip checks.
+	pkg, err := openPackage(r, size)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := document.Read(r, size)
+	if err != nil {
+		return nil, err
 	}
 
-	tMap := make(map[*wml.CT_Tbl]document.Table)
-	for _, tbl := range doc.Tables() {
-		tMap[tbl.X()] = tbl
+	p := newParser(doc)
+	p.opts = opts
+	p.pkg = pkg
+	if !p.hasPart(relStyles) {
+		p.styles = styleSheet{styles: make(map[string]*wml.CT_Style)}
+	}
+	p.lists = newListNumbering(doc, p.styles, p.hasPart(relNumbering))
+	p.readProperties()
+	p.src = newSourceIndex()
+	if body := doc.X().Body; body != nil {
+		p.src.add("", body.EG_BlockLevelElts)
 	}
+	if data, err := p.pkg.readPart(p.pkg.main); err == nil {
+		p.indexObjects(data)
+		p.rsidAuthors = scanRsidAuthors(data)
+		p.scanTrackedChanges(data)
+	}
+	p.loadNoteParts()
+	p.readComments()
+	p.readHeaders()
+	return p, nil
+}
 
-	// ---- Walk body elements in order ----
-	body := doc.X().Body
+// walkBody converts the body elements in order.
+func (p *parser) walkBody() {
+	body := p.doc.X().Body
 	if body == nil {
 		// Empty document
-		return mdl, nil
+		return
 	}
-
 	for _, bl := range body.EG_BlockLevelElts {
+		if p.err != nil {
+			return
+		}
+		for _, ac := range bl.AltChunk {
+			p.flushDropCap()
+			p.walkAltChunk(ac)
+		}
 		for _, c := range bl.EG_ContentBlockContent {
-			// Paragraphs
-			for _, cp := range c.P {
-				if par, ok := pMap[cp]; ok {
-					rp := convertParagraph(par)
-					mdl.Paragraphs = append(mdl.Paragraphs, rp)
-					rpCopy := rp
-					mdl.Blocks = append(mdl.Blocks, DocumentBlock{Paragraph: &rpCopy})
-				}
+			p.walkBlockContent(c, nil)
+		}
+	}
+	p.flushDropCap()
+}
+
+// finish converts the content that follows the body walk.
+func (p *parser) finish() {
+	p.readNotes()
+}
+
+// addBlock appends a top-level block to the model, or hands it to the emit
+// callback when streaming.
+func (p *parser) addBlock(blk DocumentBlock) {
+	p.blocks++
+	if p.emit != nil {
+		if p.err == nil {
+			p.err = p.emit(blk)
+		}
+		return
+	}
+	p.mdl.AppendBlock(blk)
+}
+
+// parser carries the state shared while walking a single document.
+type parser struct {
+	doc *document.Document
+	mdl DocumentModel
+
+	emit   func(DocumentBlock) error // receives top-level blocks when streaming
+	err    error                     // first error returned by emit
+	blocks int                       // top-level blocks added so far
+	depth  int                       // of the document in altChunks, 0 for the main one
+	opts   ParseOptions              // also used for nested documents
+
+	// Lookup maps from underlying XML ptr -> high-level wrapper.  unioffice
+	// only hands out wrappers for content it knows how to reach (body, tables,
+	// top-level content controls), so anything else is left as a zero value.
+	paras map[*wml.CT_P]document.Paragraph
+
+	styles styleSheet
+	lists  *listNumbering
+	images map[string][]byte // picture parts read so far, by name
+	notes  *noteNumbering
+	fields fieldStack // complex fields open at the current position
+
+	openComments []int64 // comment ranges open at the current position
+
+	section    int      // index of the section being walked
+	pageBreak  bool     // a hard page break was seen in the current paragraph
+	paraRun    runProps // run properties of the current paragraph's style
+	noteRefs   []Note   // first reference to each note, in order
+	noteSeen   map[noteKey]bool
+	noteBodies map[noteKey]*wml.CT_FtnEdn // note content by kind and ID
+	src        sourceIndex
+	sectPrs    []*wml.CT_SectPr // section properties in document order
+
+	// Drop cap frame waiting for the paragraph it belongs to.
+	dropCap     *DropCap
+	dropCapPara RenderParagraph
+
+	// Raw package access for content unioffice does not decode.
+	pkg     *opcPackage
+	rels    map[string]relationship // main document relationships, loaded lazily
+	objects map[*wml.CT_Object]rawObject
+
+	rsidAuthors   map[string]revisionStamp  // rsids attributable through tracked changes
+	tracked       map[int64][]trackedChange // content of tracked changes by w:id
+	revisionDates map[int64]time.Time       // dates of tracked changes by w:id
+	rev           *revisionCollector        // revision info of the current paragraph
+}
+
+// warn records a problem the parser worked around.
+func (p *parser) warn(code diag.Code, loc diag.Location, msg string) {
+	p.mdl.Warnings = append(p.mdl.Warnings, diag.Warning{Code: code, Location: loc, Message: msg})
+}
+
+// docRels returns the relationships of the main document part.
+func (p *parser) docRels() map[string]relationship {
+	if p.rels == nil {
+		p.rels = p.pkg.rels(p.pkg.main)
+	}
+	return p.rels
+}
+
+// hasPart reports whether the main document part has a relationship of
+// the type ending in rel.  unioffice fabricates the styles and numbering
+// parts of documents without them, whose definitions Word would not apply.
+func (p *parser) hasPart(rel string) bool {
+	for _, r := range p.docRels() {
+		if strings.HasSuffix(r.Type, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// indexObjects pairs the CT_Object nodes of the unioffice tree with the
+// objects recovered by scanning document.xml directly.
+func (p *parser) indexObjects(data []byte) {
+	body := p.doc.X().Body
+	if body == nil {
+		return
+	}
+	raw := scanObjects(data)
+	if len(raw) == 0 {
+		return
+	}
+	p.objects = make(map[*wml.CT_Object]rawObject, len(raw))
+	i := 0
+	visitBodyRuns(body, func(r *wml.CT_R) {
+		for _, ic := range r.EG_RunInnerContent {
+			if ic.Object != nil && i < len(raw) {
+				p.objects[ic.Object] = raw[i]
+				i++
 			}
-			// Tables
-			for _, ct := range c.Tbl {
-				if tbl, ok := tMap[ct]; ok {
-					rt := convertTable(tbl)
-					mdl.Tables = append(mdl.Tables, rt)
-					rtCopy := rt
-					mdl.Blocks = append(mdl.Blocks, DocumentBlock{Table: &rtCopy})
-				}
+		}
+	})
+}
+
+func newParser(doc *document.Document) *parser {
+	p := &parser{
+		doc:    doc,
+		paras:  make(map[*wml.CT_P]document.Paragraph),
+		styles: newStyleSheet(doc),
+	}
+	for _, par := range doc.Paragraphs() {
+		p.paras[par.X()] = par
+	}
+	var sections []*wml.CT_SectPr
+	if body := doc.X().Body; body != nil {
+		for _, sdt := range doc.StructuredDocumentTags() {
+			for _, par := range sdt.Paragraphs() {
+				p.paras[par.X()] = par
+			}
+		}
+		sections = documentSections(body)
+		p.sectPrs = sections
+		for _, sp := range sections {
+			p.mdl.Sections = append(p.mdl.Sections, sectionLayout(sp))
+		}
+	}
+	var settings *wml.CT_Settings
+	if s := doc.Settings.X(); s != nil {
+		settings = &s.CT_Settings
+	}
+	p.notes = newNoteNumbering(settings, sections)
+	return p
+}
+
+// walkBlockContent appends the blocks found in c to the model.  cc is the
+// innermost enclosing content control, if any.
+func (p *parser) walkBlockContent(c *wml.EG_ContentBlockContent, cc *ContentControl) {
+	for _, rl := range c.EG_RunLevelElts {
+		for _, rm := range rl.EG_RangeMarkupElements {
+			p.commentRange(rm)
+		}
+	}
+	// Paragraphs
+	for _, cp := range c.P {
+		rp := p.convertParagraph(cp)
+		rp.ContentControl = cc
+		rp.SectionEnd = cp.PPr != nil && cp.PPr.SectPr != nil
+		if dc := dropCap(cp, rp); dc != nil && p.dropCap == nil {
+			p.dropCap = dc
+			p.dropCapPara = rp
+		} else {
+			p.addParagraph(rp)
+		}
+		if rp.SectionEnd {
+			p.notes.newSection()
+			p.section++
+		}
+	}
+	// Tables
+	for _, ct := range c.Tbl {
+		p.flushDropCap()
+		rt := p.convertTable(ct)
+		rt.ContentControl = cc
+		p.addBlock(DocumentBlock{Table: &rt})
+	}
+	// Content controls
+	if c.Sdt != nil {
+		p.walkSdtBlock(c.Sdt)
+	}
+	// Custom XML wrappers are transparent.
+	if c.CustomXml != nil {
+		for _, cc2 := range c.CustomXml.EG_ContentBlockContent {
+			p.walkBlockContent(cc2, cc)
+		}
+	}
+}
+
+// addParagraph appends a body paragraph to the model, attaching a pending
+// drop cap to it.
+func (p *parser) addParagraph(rp RenderParagraph) {
+	if p.dropCap != nil {
+		rp.DropCap = p.dropCap
+		p.dropCap = nil
+	}
+	p.addBlock(DocumentBlock{Paragraph: &rp})
+}
+
+// flushDropCap emits a pending drop cap that has no following paragraph to
+// attach to as a paragraph of its own.
+func (p *parser) flushDropCap() {
+	if p.dropCap == nil {
+		return
+	}
+	p.dropCap = nil
+	p.addParagraph(p.dropCapPara)
+}
+
+// dropCap returns the drop cap described by a framed paragraph, or nil if x
+// is not a drop cap frame.
+func dropCap(x *wml.CT_P, rp RenderParagraph) *DropCap {
+	if x.PPr == nil || x.PPr.FramePr == nil {
+		return nil
+	}
+	fp := x.PPr.FramePr
+	if fp.DropCapAttr != wml.ST_DropCapDrop && fp.DropCapAttr != wml.ST_DropCapMargin {
+		return nil
+	}
+	dc := &DropCap{Runs: rp.Runs, Lines: 3, Margin: fp.DropCapAttr == wml.ST_DropCapMargin}
+	if fp.LinesAttr != nil && *fp.LinesAttr > 0 {
+		dc.Lines = int(*fp.LinesAttr)
+	}
+	return dc
+}
+
+// walkSdtBlock descends into a block-level content control.  unioffice
+// decodes the paragraphs and tables of an SDT into separate slices, so when
+// both are present paragraphs are emitted before tables.
+func (p *parser) walkSdtBlock(sdt *wml.CT_SdtBlock) {
+	cc := p.contentControl(sdt.SdtPr)
+	if sdt.SdtContent == nil {
+		return
+	}
+	p.walkBlockContent(&wml.EG_ContentBlockContent{
+		CustomXml: sdt.SdtContent.CustomXml,
+		Sdt:       sdt.SdtContent.Sdt,
+		P:         sdt.SdtContent.P,
+		Tbl:       sdt.SdtContent.Tbl,
+	}, cc)
+}
+
+// contentControl extracts the metadata of a content control and records it
+// on the model.
+func (p *parser) contentControl(pr *wml.CT_SdtPr) *ContentControl {
+	cc := &ContentControl{}
+	if pr != nil {
+		if pr.Id != nil {
+			cc.ID = pr.Id.ValAttr
+		}
+		if pr.Tag != nil {
+			cc.Tag = pr.Tag.ValAttr
+		}
+		if pr.Alias != nil {
+			cc.Alias = pr.Alias.ValAttr
+		}
+		if pr.Placeholder != nil && pr.Placeholder.DocPart != nil {
+			cc.Placeholder = pr.Placeholder.DocPart.ValAttr
+		}
+		cc.ShowingPlaceholder = onOff(pr.ShowingPlcHdr)
+		cc.Type = sdtType(pr.Choice)
+	}
+	p.mdl.ContentControls = append(p.mdl.ContentControls, *cc)
+	return cc
+}
+
+// sdtType names the kind of content control.  Controls without an explicit
+// type are rich text.
+func sdtType(c *wml.CT_SdtPrChoice) string {
+	if c == nil {
+		return "richText"
+	}
+	switch {
+	case c.Text != nil:
+		return "text"
+	case c.Date != nil:
+		return "date"
+	case c.DropDownList != nil:
+		return "dropDownList"
+	case c.ComboBox != nil:
+		return "comboBox"
+	case c.Picture != nil:
+		return "picture"
+	case c.DocPartObj != nil, c.DocPartList != nil:
+		return "docPart"
+	case c.Equation != nil:
+		return "equation"
+	case c.Citation != nil:
+		return "citation"
+	case c.Bibliography != nil:
+		return "bibliography"
+	case c.Group != nil:
+		return "group"
+	}
+	return "richText"
+}
+
+// onOff evaluates an OOXML on/off element: present without a value means on.
+func onOff(v *wml.CT_OnOff) bool {
+	if v == nil {
+		return false
+	}
+	return onOffValue(v.ValAttr)
+}
+
+// onOffValue evaluates an ST_OnOff attribute, treating a missing value as on.
+func onOffValue(v *sharedTypes.ST_OnOff) bool {
+	if v == nil {
+		return true
+	}
+	if v.Bool != nil {
+		return *v.Bool
+	}
+	return v.ST_OnOff1 != sharedTypes.ST_OnOff1Off
+}
+
+// convertRun builds the RenderRuns for a single <w:r>. Styling information is
+// resolved from the run's character style and direct formatting (see
+// resolveRunStyle).  Where a
+// style attribute cannot be determined it is simply left at the zero value.
+//
+// A single <w:r> normally yields a single RenderRun.  Symbol characters
+// (w:sym) that cannot be mapped to Unicode are split into their own RenderRun
+// carrying the declared symbol font so they still render with that font.
+func (p *parser) convertRun(r document.Run, x *wml.CT_R, ctx inlineContext) []RenderRun {
+	var (
+		out      []RenderRun
+		buf      strings.Builder
+		style    = p.resolveRunStyle(x, ctx)
+		fc, orig = p.formatChange(x, ctx)
+	)
+	p.noteRunRevisions(x)
+	newRun := func() RenderRun {
+		rr := RenderRun{Style: style, ContentControl: ctx.cc, Href: ctx.href, Comments: p.activeComments(), Source: p.src.runs[x]}
+		if fc != nil && *orig != style {
+			rr.FormatChange, rr.OriginalStyle = fc, orig
+		}
+		if c := ctx.change; c != nil {
+			rr.Revision = c
+			rr.Change = revInsert
+			if c.Type == revDelete || c.Type == revMoveFrom {
+				rr.Change = revDelete
+			}
+		}
+		if r.X() != nil {
+			rr.Run = r
+		}
+		if rr.Href == "" {
+			rr.Href = ctx.ref
+		}
+		if rr.Href == "" {
+			rr.Href = p.fields.href()
+		}
+		rr.Field = ctx.field
+		return rr
+	}
+	flush := func() {
+		if buf.Len() > 0 {
+			rr := newRun()
+			rr.Text = buf.String()
+			if rr.Field == "" {
+				rr.Field = p.fields.pageField()
+			}
+			if rr.Style.Script == "" {
+				rr.Style.Script = textScript(rr.Text)
 			}
+			out = append(out, rr)
+			buf.Reset()
 		}
 	}
 
-	return mdl, nil
+	for _, ic := range x.EG_RunInnerContent {
+		switch {
+		case ic.T != nil:
+			buf.WriteString(ic.T.Content)
+		case ic.DelText != nil:
+			buf.WriteString(ic.DelText.Content)
+		case ic.Tab != nil:
+			buf.WriteByte('\t')
+		case ic.SoftHyphen != nil:
+			buf.WriteRune('\u00ad')
+		case ic.NoBreakHyphen != nil:
+			buf.WriteRune('\u2011')
+		case ic.Sym != nil:
+			var font, char string
+			if ic.Sym.FontAttr != nil {
+				font = *ic.Sym.FontAttr
+			}
+			if ic.Sym.CharAttr != nil {
+				char = *ic.Sym.CharAttr
+			}
+			text, mapped := mapSymbol(font, char)
+			if mapped || text == "" {
+				buf.WriteString(text)
+				continue
+			}
+			flush()
+			rr := newRun()
+			rr.Text = text
+			rr.Style.FontFamily = font
+			out = append(out, rr)
+		case ic.Drawing != nil:
+			flush()
+			for _, img := range p.drawingImages(ic.Drawing) {
+				rr := newRun()
+				rr.Image = &img
+				out = append(out, rr)
+			}
+		case ic.Object != nil:
+			flush()
+			obj := p.embeddedObject(p.objects[ic.Object], ic.Object)
+			p.mdl.Objects = append(p.mdl.Objects, obj)
+			rr := newRun()
+			rr.Object = &obj
+			out = append(out, rr)
+		case ic.FootnoteReference != nil:
+			flush()
+			rr := newRun()
+			rr.Note = p.notes.reference(noteFootnote, ic.FootnoteReference)
+			p.noteReferenced(rr.Note)
+			out = append(out, rr)
+		case ic.CommentReference != nil:
+			flush()
+			rr := newRun()
+			id := ic.CommentReference.IdAttr
+			rr.CommentRef = &id
+			out = append(out, rr)
+		case ic.EndnoteReference != nil:
+			flush()
+			rr := newRun()
+			rr.Note = p.notes.reference(noteEndnote, ic.EndnoteReference)
+			p.noteReferenced(rr.Note)
+			out = append(out, rr)
+		case ic.Ruby != nil:
+			flush()
+			rr := newRun()
+			rr.Ruby = &Ruby{
+				Base:  p.rubyRuns(ic.Ruby.RubyBase, ctx),
+				Guide: p.rubyRuns(ic.Ruby.Rt, ctx),
+			}
+			out = append(out, rr)
+		case ic.FldChar != nil:
+			flush()
+			p.fields.fldChar(ic.FldChar)
+		case ic.InstrText != nil:
+			p.fields.instrText(ic.InstrText.Content)
+		case ic.DelInstrText != nil:
+			p.fields.instrText(ic.DelInstrText.Content)
+		case ic.LastRenderedPageBreak != nil:
+			p.notes.newPage()
+		case ic.Br != nil && ic.Br.TypeAttr == wml.ST_BrTypePage:
+			p.notes.newPage()
+			p.pageBreak = true
+		}
+	}
+	flush()
+
+	if len(out) == 0 {
+		// Keep empty runs so callers relying on run positions still see them.
+		out = append(out, newRun())
+	}
+	return out
 }
 
-// convertRun builds a RenderRun from a unioffice Run. Styling information is
-// currently resolved on a best-effort basis.  Where a style attribute cannot
-// be determined it is simply left at the zero value.
-func convertRun(r document.Run) RenderRun {
-	return RenderRun{
-		Run:   r,
-		Text:  r.Text(),
-		Style: RunStyle{}, // default/empty style
+// textScript classifies text by the first character that belongs to an East
+// Asian or complex script, the distinction rFonts makes when picking a font.
+func textScript(text string) string {
+	for _, r := range text {
+		switch {
+		case r < 0x0590:
+			continue
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul, unicode.Bopomofo):
+			return "eastAsia"
+		case unicode.In(r, unicode.Hebrew, unicode.Arabic, unicode.Syriac, unicode.Thaana, unicode.Devanagari,
+			unicode.Bengali, unicode.Tamil, unicode.Thai, unicode.Lao, unicode.Khmer):
+			return "cs"
+		}
 	}
+	return ""
 }
 
-// convertParagraph converts a unioffice Paragraph into the RenderParagraph IR.
-func convertParagraph(p document.Paragraph) RenderParagraph {
-	rp := RenderParagraph{Paragraph: p}
+// rubyRuns converts the base or guide text of a w:ruby element.
+func (p *parser) rubyRuns(c *wml.CT_RubyContent, ctx inlineContext) []RenderRun {
+	if c == nil || c.R == nil {
+		return nil
+	}
+	return p.convertRun(document.Run{}, c.R, ctx)
+}
 
-	for _, run := range p.Runs() {
-		rp.Runs = append(rp.Runs, convertRun(run))
+// resolveRunStyle computes the effective formatting of a run: the document
+// defaults and its paragraph's style, then its character style, then the
+// run's direct formatting (w:rPr).  Runs inside a hyperlink without a
+// character style of their own pick up Word's Hyperlink style so links
+// look like links.
+func (p *parser) resolveRunStyle(x *wml.CT_R, ctx inlineContext) RunStyle {
+	styleID := ""
+	if x.RPr != nil && x.RPr.RStyle != nil {
+		styleID = x.RPr.RStyle.ValAttr
+	}
+	if styleID == "" && ctx.href != "" {
+		styleID = hyperlinkStyleID
 	}
+	rp := p.paraRun
+	switch {
+	case styleID == "":
+	case styleID == hyperlinkStyleID && !p.styles.has(hyperlinkStyleID):
+		rp = rp.merge(defaultHyperlinkProps())
+	default:
+		rp = rp.merge(p.styles.characterProps(styleID))
+	}
+	return rp.merge(runPropsFromRPr(x.RPr)).runStyle()
+}
 
-	// Paragraph style left as zero-values for now.
-	rp.Style = ParagraphStyle{}
+// hyperlinkHref resolves the target of a w:hyperlink: an external URL from
+// the relationship, an internal "#bookmark" anchor, or both.
+func (p *parser) hyperlinkHref(h *wml.CT_Hyperlink) string {
+	var href string
+	if h.IdAttr != nil && p.pkg != nil {
+		if rel, ok := p.docRels()[*h.IdAttr]; ok {
+			href = rel.Target
+		}
+	}
+	if h.AnchorAttr != nil && *h.AnchorAttr != "" {
+		href += "#" + *h.AnchorAttr
+	}
+	return href
+}
+
+// convertParagraph converts a paragraph into the RenderParagraph IR.
+func (p *parser) convertParagraph(x *wml.CT_P) RenderParagraph {
+	par := p.paras[x]
+	rp := RenderParagraph{Source: p.src.paras[x]}
+	if par.X() != nil {
+		rp.Paragraph = par
+	}
+	rp.PageBreakBefore = p.pageBreak || (x.PPr != nil && onOff(x.PPr.PageBreakBefore))
+	if x.PPr != nil && x.PPr.PStyle != nil {
+		rp.StyleID = x.PPr.PStyle.ValAttr
+		rp.StyleName = p.styles.name(rp.StyleID)
+	}
+	p.pageBreak = false
+	defer func(paraRun runProps) { p.paraRun = paraRun }(p.paraRun)
+	p.paraRun = p.styles.paragraphRunProps(rp.StyleID)
+	prev := p.beginRevisions()
+	p.noteParagraphRevisions(x)
+
+	runs := make(map[*wml.CT_R]document.Run)
+	if par.X() != nil {
+		for _, run := range par.Runs() {
+			runs[run.X()] = run
+		}
+	}
+	for _, pc := range x.EG_PContent {
+		rp.Runs = p.appendPContent(rp.Runs, pc, runs, inlineContext{})
+	}
+
+	pp := p.styles.paragraphProps(rp.StyleID).merge(paraPropsFromPPr(x.PPr))
+	rp.Style = pp.paragraphStyle()
+	if pp.numID != nil && *pp.numID != 0 {
+		var ilvl int64
+		if pp.numLevel != nil {
+			ilvl = *pp.numLevel
+		}
+		p.lists.item(&rp.Style, *pp.numID, ilvl)
+	}
+	rp.Revision = p.endRevisions(prev)
 
 	return rp
 }
 
-// convertTable converts a unioffice Table into the RenderTable IR.
-func convertTable(t document.Table) RenderTable {
-	rt := RenderTable{}
+// inlineContext carries the inline wrappers enclosing a run.
+type inlineContext struct {
+	cc   *ContentControl // innermost inline content control
+	href string          // target of the enclosing hyperlink
+	ref  string          // target of an enclosing cross-reference field
 
-	for _, row := range t.Rows() {
-		rr := RenderTableRow{}
+	field string // name of an enclosing simple page-number field
 
-		for _, cell := range row.Cells() {
-			rc := RenderTableCell{
-				ColSpan: 1,
-				RowSpan: 1,
+	change *Revision // enclosing tracked insertion, deletion or move
+}
+
+// appendPContent appends the runs contained in pc, descending into
+// hyperlinks, simple fields, inline content controls and other inline
+// wrappers.
+func (p *parser) appendPContent(out []RenderRun, pc *wml.EG_PContent, runs map[*wml.CT_R]document.Run, ctx inlineContext) []RenderRun {
+	for _, f := range pc.FldSimple {
+		inner := ctx
+		if href := crossRefHref(f.InstrAttr); href != "" {
+			inner.ref = href
+		}
+		name := pageFieldName(f.InstrAttr)
+		if name != "" {
+			inner.field = name
+		}
+		start := len(out)
+		for _, pc2 := range f.EG_PContent {
+			out = p.appendPContent(out, pc2, runs, inner)
+		}
+		// As for complex fields (see pageField), only the first result run
+		// carries the field, so the renderer replaces the cached number once.
+		marked := false
+		for i := start; name != "" && i < len(out); i++ {
+			if out[i].Field == name {
+				if marked {
+					out[i].Field = ""
+				}
+				marked = true
 			}
+		}
+	}
+	if h := pc.Hyperlink; h != nil {
+		inner := ctx
+		inner.href = p.hyperlinkHref(h)
+		out = p.appendPContent(out, &wml.EG_PContent{
+			FldSimple:            h.FldSimple,
+			Hyperlink:            h.Hyperlink,
+			EG_ContentRunContent: h.EG_ContentRunContent,
+		}, runs, inner)
+	}
+	for _, rc := range pc.EG_ContentRunContent {
+		out = p.appendRunContent(out, rc, runs, ctx)
+	}
+	return out
+}
 
-			for _, p := range cell.Paragraphs() {
-				rc.Paragraphs = append(rc.Paragraphs, convertParagraph(p))
+func (p *parser) appendRunContent(out []RenderRun, rc *wml.EG_ContentRunContent, runs map[*wml.CT_R]document.Run, ctx inlineContext) []RenderRun {
+	if rc.CustomXml != nil {
+		for _, pc := range rc.CustomXml.EG_PContent {
+			out = p.appendPContent(out, pc, runs, ctx)
+		}
+	}
+	if rc.SmartTag != nil {
+		for _, pc := range rc.SmartTag.EG_PContent {
+			out = p.appendPContent(out, pc, runs, ctx)
+		}
+	}
+	if rc.Sdt != nil {
+		inner := ctx
+		inner.cc = p.contentControl(rc.Sdt.SdtPr)
+		if c := rc.Sdt.SdtContent; c != nil {
+			out = p.appendPContent(out, &wml.EG_PContent{
+				FldSimple:            c.FldSimple,
+				Hyperlink:            c.Hyperlink,
+				EG_ContentRunContent: c.EG_ContentRunContent,
+			}, runs, inner)
+		}
+	}
+	if d := rc.Dir; d != nil {
+		out = p.appendPContent(out, &wml.EG_PContent{FldSimple: d.FldSimple, Hyperlink: d.Hyperlink, EG_ContentRunContent: d.EG_ContentRunContent}, runs, ctx)
+	}
+	if b := rc.Bdo; b != nil {
+		out = p.appendPContent(out, &wml.EG_PContent{FldSimple: b.FldSimple, Hyperlink: b.Hyperlink, EG_ContentRunContent: b.EG_ContentRunContent}, runs, ctx)
+	}
+	if rc.R != nil {
+		out = append(out, p.convertRun(runs[rc.R], rc.R, ctx)...)
+	}
+	for _, rl := range rc.EG_RunLevelElts {
+		p.noteRunLevelRevisions(rl)
+		out = p.appendTrackedRuns(out, rl, runs, ctx)
+		for _, rm := range rl.EG_RangeMarkupElements {
+			p.commentRange(rm)
+			if bm := rm.BookmarkStart; bm != nil && bm.NameAttr != "" && bm.NameAttr != "_GoBack" {
+				out = append(out, RenderRun{Bookmark: bm.NameAttr, ContentControl: ctx.cc})
 			}
+		}
+	}
+	return out
+}
 
-			rr.Cells = append(rr.Cells, rc)
+// convertTable converts a table into the RenderTable IR.
+func (p *parser) convertTable(t *wml.CT_Tbl) RenderTable {
+	rt := RenderTable{Source: p.src.tables[t]}
+	if pr := t.TblPr; pr != nil {
+		if pr.TblCaption != nil {
+			rt.Caption = pr.TblCaption.ValAttr
 		}
+		if pr.TblDescription != nil {
+			rt.Description = pr.TblDescription.ValAttr
+		}
+	}
+
+	nrow := 0
+	for _, rowContent := range t.EG_ContentRowContent {
+		for _, row := range tableRows(rowContent, p.contentControl, nil) {
+			rr := RenderTableRow{}
+			ncell := 0
+			if row.TrPr != nil {
+				for _, h := range row.TrPr.TblHeader {
+					rr.Header = onOff(h)
+				}
+			}
+
+			for _, cellContent := range row.EG_ContentCellContent {
+				for _, cell := range tableCells(cellContent, p.contentControl, row.cc) {
+					rc := RenderTableCell{
+						ColSpan: 1,
+						RowSpan: 1,
+						Source:  cellSource(rt.Source, nrow, ncell),
+					}
+					ncell++
 
-		rt.Rows = append(rt.Rows, rr)
+					for _, ble := range cell.EG_BlockLevelElts {
+						for _, c := range ble.EG_ContentBlockContent {
+							rc.Paragraphs = p.appendCellParagraphs(rc.Paragraphs, c, cell.cc)
+						}
+					}
+
+					rr.Cells = append(rr.Cells, rc)
+				}
+			}
+
+			rt.Rows = append(rt.Rows, rr)
+			nrow++
+		}
 	}
 
+	var revs []*RevisionInfo
+	for _, row := range rt.Rows {
+		for _, cell := range row.Cells {
+			for _, par := range cell.Paragraphs {
+				revs = append(revs, par.Revision)
+			}
+		}
+	}
+	rt.Revision = mergeRevisionInfo(revs)
+
 	return rt
 }
+
+// sdtRow is a table row with the innermost row-level content control
+// around it, if any.
+type sdtRow struct {
+	*wml.CT_Row
+	cc *ContentControl
+}
+
+// sdtCell is a table cell with the innermost row- or cell-level content
+// control around it, if any.
+type sdtCell struct {
+	*wml.CT_Tc
+	cc *ContentControl
+}
+
+// tableRows returns the rows of a row-content group, looking through
+// row-level content controls and custom XML.  Each control is passed to
+// record, when set, whose result is the control of the rows within; cc is
+// that of the group.
+func tableRows(rc *wml.EG_ContentRowContent, record func(*wml.CT_SdtPr) *ContentControl, cc *ContentControl) []sdtRow {
+	var rows []sdtRow
+	for _, row := range rc.Tr {
+		rows = append(rows, sdtRow{row, cc})
+	}
+	if rc.Sdt != nil && rc.Sdt.SdtContent != nil {
+		inner := cc
+		if record != nil {
+			inner = record(rc.Sdt.SdtPr)
+		}
+		c := rc.Sdt.SdtContent
+		rows = append(rows, tableRows(&wml.EG_ContentRowContent{Tr: c.Tr, Sdt: c.Sdt}, record, inner)...)
+	}
+	if rc.CustomXml != nil {
+		for _, c := range rc.CustomXml.EG_ContentRowContent {
+			rows = append(rows, tableRows(c, record, cc)...)
+		}
+	}
+	return rows
+}
+
+// tableCells returns the cells of a cell-content group, looking through
+// cell-level content controls and custom XML, as tableRows does rows.
+func tableCells(content *wml.EG_ContentCellContent, record func(*wml.CT_SdtPr) *ContentControl, cc *ContentControl) []sdtCell {
+	var cells []sdtCell
+	for _, cell := range content.Tc {
+		cells = append(cells, sdtCell{cell, cc})
+	}
+	if content.Sdt != nil && content.Sdt.SdtContent != nil {
+		inner := cc
+		if record != nil {
+			inner = record(content.Sdt.SdtPr)
+		}
+		c := content.Sdt.SdtContent
+		cells = append(cells, tableCells(&wml.EG_ContentCellContent{Tc: c.Tc, Sdt: c.Sdt}, record, inner)...)
+	}
+	if content.CustomXml != nil {
+		for _, c := range content.CustomXml.EG_ContentCellContent {
+			cells = append(cells, tableCells(c, record, cc)...)
+		}
+	}
+	return cells
+}
+
+// appendCellParagraphs appends the paragraphs of a block-content group
+// inside a table cell, looking through content controls and custom XML.
+// Nested tables are skipped since table cells only carry paragraphs.
+func (p *parser) appendCellParagraphs(out []RenderParagraph, c *wml.EG_ContentBlockContent, cc *ContentControl) []RenderParagraph {
+	for _, cp := range c.P {
+		rp := p.convertParagraph(cp)
+		rp.ContentControl = cc
+		rp.SectionEnd = cp.PPr != nil && cp.PPr.SectPr != nil
+		out = append(out, rp)
+	}
+	if c.Sdt != nil {
+		inner := p.contentControl(c.Sdt.SdtPr)
+		if sc := c.Sdt.SdtContent; sc != nil {
+			out = p.appendCellParagraphs(out, &wml.EG_ContentBlockContent{
+				CustomXml: sc.CustomXml,
+				Sdt:       sc.Sdt,
+				P:         sc.P,
+			}, inner)
+		}
+	}
+	if c.CustomXml != nil {
+		for _, c2 := range c.CustomXml.EG_ContentBlockContent {
+			out = p.appendCellParagraphs(out, c2, cc)
+		}
+	}
+	return out
+}
+
+// -----------------------------------------------------------------------------
+// Run traversal
+// -----------------------------------------------------------------------------
+
+// visitBodyRuns calls fn for every run in the body, in document order,
+// descending into every container unioffice decodes (tables, content
+// controls, hyperlinks, fields, smart tags, custom XML).
+func visitBodyRuns(body *wml.CT_Body, fn func(*wml.CT_R)) {
+	blockVisitor{run: fn}.blocks(body.EG_BlockLevelElts)
+}
+
+// blockVisitor receives the paragraphs, tables and runs of block content in
+// document order.  Any callback may be nil.
+type blockVisitor struct {
+	para func(*wml.CT_P)
+	tbl  func(*wml.CT_Tbl)
+	run  func(*wml.CT_R)
+}
+
+func (v blockVisitor) blocks(elts []*wml.EG_BlockLevelElts) {
+	for _, ble := range elts {
+		for _, c := range ble.EG_ContentBlockContent {
+			v.block(c)
+		}
+	}
+}
+
+func (v blockVisitor) block(c *wml.EG_ContentBlockContent) {
+	fn := v.run
+	if fn == nil {
+		fn = func(*wml.CT_R) {}
+	}
+	for _, cp := range c.P {
+		if v.para != nil {
+			v.para(cp)
+		}
+		for _, pc := range cp.EG_PContent {
+			visitPContentRuns(pc, fn)
+		}
+	}
+	for _, tbl := range c.Tbl {
+		if v.tbl != nil {
+			v.tbl(tbl)
+		}
+		for _, rc := range tbl.EG_ContentRowContent {
+			for _, row := range tableRows(rc, nil, nil) {
+				for _, cc := range row.EG_ContentCellContent {
+					for _, cell := range tableCells(cc, nil, nil) {
+						v.blocks(cell.EG_BlockLevelElts)
+					}
+				}
+			}
+		}
+	}
+	if c.Sdt != nil && c.Sdt.SdtContent != nil {
+		sc := c.Sdt.SdtContent
+		v.block(&wml.EG_ContentBlockContent{CustomXml: sc.CustomXml, Sdt: sc.Sdt, P: sc.P, Tbl: sc.Tbl})
+	}
+	if c.CustomXml != nil {
+		for _, c2 := range c.CustomXml.EG_ContentBlockContent {
+			v.block(c2)
+		}
+	}
+}
+
+func visitPContentRuns(pc *wml.EG_PContent, fn func(*wml.CT_R)) {
+	for _, f := range pc.FldSimple {
+		for _, pc2 := range f.EG_PContent {
+			visitPContentRuns(pc2, fn)
+		}
+	}
+	if h := pc.Hyperlink; h != nil {
+		visitPContentRuns(&wml.EG_PContent{FldSimple: h.FldSimple, Hyperlink: h.Hyperlink, EG_ContentRunContent: h.EG_ContentRunContent}, fn)
+	}
+	for _, rc := range pc.EG_ContentRunContent {
+		visitRunContentRuns(rc, fn)
+	}
+}
+
+func visitRunContentRuns(rc *wml.EG_ContentRunContent, fn func(*wml.CT_R)) {
+	if rc.CustomXml != nil {
+		for _, pc := range rc.CustomXml.EG_PContent {
+			visitPContentRuns(pc, fn)
+		}
+	}
+	if rc.SmartTag != nil {
+		for _, pc := range rc.SmartTag.EG_PContent {
+			visitPContentRuns(pc, fn)
+		}
+	}
+	if s := rc.Sdt; s != nil && s.SdtContent != nil {
+		visitPContentRuns(&wml.EG_PContent{FldSimple: s.SdtContent.FldSimple, Hyperlink: s.SdtContent.Hyperlink, EG_ContentRunContent: s.SdtContent.EG_ContentRunContent}, fn)
+	}
+	if d := rc.Dir; d != nil {
+		visitPContentRuns(&wml.EG_PContent{FldSimple: d.FldSimple, Hyperlink: d.Hyperlink, EG_ContentRunContent: d.EG_ContentRunContent}, fn)
+	}
+	if b := rc.Bdo; b != nil {
+		visitPContentRuns(&wml.EG_PContent{FldSimple: b.FldSimple, Hyperlink: b.Hyperlink, EG_ContentRunContent: b.EG_ContentRunContent}, fn)
+	}
+	if rc.R != nil {
+		fn(rc.R)
+	}
+}
@@ -0,0 +1,62 @@
+package docx
+
+import (
+	"encoding/xml"
+	"strings"
+	"time"
+)
+
+// -----------------------------------------------------------------------------
+// Document properties
+// -----------------------------------------------------------------------------
+
+// corePropertiesRel is the package relationship type of docProps/core.xml.
+const corePropertiesRel = "/metadata/core-properties"
+
+// readProperties fills the model's DocProperties from the core properties
+// part, falling back to the document's proofing language for Language.
+func (p *parser) readProperties() {
+	props := &p.mdl.Properties
+	if p.pkg != nil {
+		part := "docProps/core.xml"
+		for _, rel := range sortedRels(p.pkg.rels("")) {
+			if strings.HasSuffix(rel.Type, corePropertiesRel) {
+				part = resolveTarget("", rel.Target)
+			}
+		}
+		if data, err := p.pkg.readPart(part); err == nil {
+			var core struct {
+				Title       string `xml:"title"`
+				Subject     string `xml:"subject"`
+				Creator     string `xml:"creator"`
+				Keywords    string `xml:"keywords"`
+				Description string `xml:"description"`
+				Language    string `xml:"language"`
+				Created     string `xml:"created"`
+				Modified    string `xml:"modified"`
+			}
+			if xml.Unmarshal(data, &core) == nil {
+				props.Title = strings.TrimSpace(core.Title)
+				props.Subject = strings.TrimSpace(core.Subject)
+				props.Author = strings.TrimSpace(core.Creator)
+				props.Keywords = strings.TrimSpace(core.Keywords)
+				props.Description = strings.TrimSpace(core.Description)
+				props.Language = strings.TrimSpace(core.Language)
+				props.Created, _ = time.Parse(time.RFC3339, strings.TrimSpace(core.Created))
+				props.Modified, _ = time.Parse(time.RFC3339, strings.TrimSpace(core.Modified))
+			}
+		}
+	}
+	if props.Language == "" {
+		if s := p.doc.Settings.X(); s != nil && s.ThemeFontLang != nil && s.ThemeFontLang.ValAttr != nil {
+			props.Language = *s.ThemeFontLang.ValAttr
+		}
+	}
+	if props.Language == "" {
+		if st := p.doc.Styles.X(); st != nil && st.DocDefaults != nil && st.DocDefaults.RPrDefault != nil {
+			if rpr := st.DocDefaults.RPrDefault.RPr; rpr != nil && rpr.Lang != nil && rpr.Lang.ValAttr != nil {
+				props.Language = *rpr.Lang.ValAttr
+			}
+		}
+	}
+}
@@ -0,0 +1,517 @@
+package docx
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strconv"
+	"time"
+
+	"github.com/unidoc/unioffice/document"
+	"github.com/unidoc/unioffice/schema/soo/wml"
+)
+
+// -----------------------------------------------------------------------------
+// Revision metadata
+// -----------------------------------------------------------------------------
+//
+// Two sources describe who changed a block and when:
+//
+//   - tracked changes (w:ins, w:del, w:moveFrom, w:moveTo, w:rPrChange,
+//     w:pPrChange) carry an author and date directly;
+//   - every paragraph and run carries revision save IDs (rsids) naming the
+//     editing session that created or last formatted it.
+//
+// rsids are anonymous, but a session that also produced tracked changes can
+// be attributed: the runs inside a w:ins carry the rsid of the session that
+// inserted them.  unioffice discards the content of tracked changes, so that
+// mapping is recovered by scanning document.xml directly.
+//
+// The same scan recovers the runs of each tracked insertion, deletion and
+// move, which are converted with RenderRun.Change and RenderRun.Revision
+// set; moved text counts as deleted where it was and inserted where it
+// went.  A run whose formatting change (w:rPrChange) is tracked carries it
+// in RenderRun.FormatChange, with the style it had before in
+// RenderRun.OriginalStyle.  RevisionsMode decides
+// whether the changes are accepted, rejected or shown; see revisedRun.
+
+const (
+	revInsert          = "insert"
+	revDelete          = "delete"
+	revMoveFrom        = "moveFrom"
+	revMoveTo          = "moveTo"
+	revFormatChange    = "formatChange"
+	revParagraphInsert = "paragraphInsert"
+	revParagraphDelete = "paragraphDelete"
+)
+
+// revisionStamp attributes an edit session.
+type revisionStamp struct {
+	author string
+	date   time.Time
+}
+
+// later reports whether s is more recent than o.
+func (s revisionStamp) later(o revisionStamp) bool {
+	return o.author == "" || s.date.After(o.date)
+}
+
+// scanRsidAuthors maps the rsids found on runs inside tracked insertions and
+// deletions to the author and date of that change.
+func scanRsidAuthors(data []byte) map[string]revisionStamp {
+	out := make(map[string]revisionStamp)
+	var (
+		stack   []revisionStamp // enclosing tracked changes
+		decoder = xml.NewDecoder(bytes.NewReader(data))
+	)
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch el := tok.(type) {
+		case xml.StartElement:
+			switch el.Name.Local {
+			case "ins", "del", "moveFrom", "moveTo":
+				st := revisionStamp{author: attrValue(el, "author")}
+				st.date, _ = time.Parse(time.RFC3339, attrValue(el, "date"))
+				stack = append(stack, st)
+			case "r":
+				if len(stack) == 0 {
+					continue
+				}
+				st := stack[len(stack)-1]
+				if st.author == "" {
+					continue
+				}
+				for _, name := range []string{"rsidR", "rsidDel"} {
+					if id := attrValue(el, name); id != "" {
+						if cur, ok := out[id]; !ok || st.later(cur) {
+							out[id] = st
+						}
+					}
+				}
+			}
+		case xml.EndElement:
+			switch el.Name.Local {
+			case "ins", "del", "moveFrom", "moveTo":
+				if len(stack) > 0 {
+					stack = stack[:len(stack)-1]
+				}
+			}
+		}
+	}
+	return out
+}
+
+// trackedChange is the content of a run-level tracked change.  It is read
+// as a w:hyperlink, whose content model is the same.
+type trackedChange struct {
+	author  string
+	content *wml.CT_Hyperlink
+}
+
+// scanTrackedChanges records the content of the tracked changes in part
+// data by w:id, for trackedContent, and the dates of all tracked changes,
+// which unioffice does not parse, for revisionDate.  Each change is decoded
+// on its own, with the namespace declarations of the root element, so that
+// changes nested in others are found too.
+func (p *parser) scanTrackedChanges(data []byte) {
+	if p.tracked == nil {
+		p.tracked = make(map[int64][]trackedChange)
+		p.revisionDates = make(map[int64]time.Time)
+	}
+	var (
+		root    []byte // start tag of the root element
+		starts  []int64
+		decoder = xml.NewDecoder(bytes.NewReader(data))
+	)
+	for {
+		offset := decoder.InputOffset()
+		tok, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch el := tok.(type) {
+		case xml.StartElement:
+			if root == nil {
+				root = data[offset:decoder.InputOffset()]
+				continue
+			}
+			switch el.Name.Local {
+			case "ins", "del", "moveFrom", "moveTo", "rPrChange", "pPrChange":
+				id, err := strconv.ParseInt(attrValue(el, "id"), 10, 64)
+				if date, derr := time.Parse(time.RFC3339, attrValue(el, "date")); err == nil && derr == nil {
+					p.revisionDates[id] = date
+				}
+			}
+			switch el.Name.Local {
+			case "ins", "del", "moveFrom", "moveTo":
+				starts = append(starts, offset)
+			}
+		case xml.EndElement:
+			switch el.Name.Local {
+			case "ins", "del", "moveFrom", "moveTo":
+				if len(starts) == 0 {
+					continue
+				}
+				start := starts[len(starts)-1]
+				starts = starts[:len(starts)-1]
+				if c, id, ok := decodeTrackedChange(root, data[start:decoder.InputOffset()]); ok {
+					p.tracked[id] = append(p.tracked[id], c)
+				}
+			}
+		}
+	}
+}
+
+// decodeTrackedChange decodes the tracked change element raw, read as the
+// child of root, reporting false if it cannot.
+func decodeTrackedChange(root, raw []byte) (trackedChange, int64, bool) {
+	decoder := xml.NewDecoder(bytes.NewReader(append(append([]byte(nil), root...), raw...)))
+	depth := 0
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			return trackedChange{}, 0, false
+		}
+		el, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if depth++; depth == 1 {
+			continue
+		}
+		id, err := strconv.ParseInt(attrValue(el, "id"), 10, 64)
+		if err != nil {
+			return trackedChange{}, 0, false
+		}
+		c := trackedChange{author: attrValue(el, "author"), content: &wml.CT_Hyperlink{}}
+		if err := decoder.DecodeElement(c.content, &el); err != nil {
+			return trackedChange{}, 0, false
+		}
+		return c, id, true
+	}
+}
+
+// revisionDate returns the date of the tracked change with w:id id.
+func (p *parser) revisionDate(id int64) time.Time {
+	return p.revisionDates[id]
+}
+
+// trackedContent returns the content of tracked change tc found by
+// scanTrackedChanges, or nil.
+func (p *parser) trackedContent(tc *wml.CT_RunTrackChange) *wml.CT_Hyperlink {
+	for _, c := range p.tracked[tc.IdAttr] {
+		if c.author == tc.AuthorAttr {
+			return c.content
+		}
+	}
+	return nil
+}
+
+// appendTrackedRuns appends the runs of the tracked insertions, deletions
+// and moves among rl, marked with their change.
+func (p *parser) appendTrackedRuns(out []RenderRun, rl *wml.EG_RunLevelElts, runs map[*wml.CT_R]document.Run, ctx inlineContext) []RenderRun {
+	for _, c := range []struct {
+		typ, change string
+		tc          *wml.CT_RunTrackChange
+	}{
+		{revInsert, revInsert, rl.Ins},
+		{revDelete, revDelete, rl.Del},
+		{revMoveFrom, revDelete, rl.MoveFrom},
+		{revMoveTo, revInsert, rl.MoveTo},
+	} {
+		if c.tc == nil {
+			continue
+		}
+		content := p.trackedContent(c.tc)
+		if content == nil {
+			continue
+		}
+		inner := ctx
+		inner.change = &Revision{Type: c.typ, ID: c.tc.IdAttr, Author: c.tc.AuthorAttr, Date: p.revisionDate(c.tc.IdAttr)}
+		out = p.appendPContent(out, &wml.EG_PContent{
+			FldSimple:            content.FldSimple,
+			Hyperlink:            content.Hyperlink,
+			EG_ContentRunContent: content.EG_ContentRunContent,
+		}, runs, inner)
+	}
+	return out
+}
+
+// formatChange returns the tracked formatting change of run x and the
+// style x had before it, or nils if it has none.
+func (p *parser) formatChange(x *wml.CT_R, ctx inlineContext) (*Revision, *RunStyle) {
+	if x.RPr == nil || x.RPr.RPrChange == nil || x.RPr.RPrChange.RPr == nil {
+		return nil, nil
+	}
+	c := x.RPr.RPrChange
+	r := &Revision{Type: revFormatChange, ID: c.IdAttr, Author: c.AuthorAttr, Date: p.revisionDate(c.IdAttr)}
+	o := c.RPr
+	before := *x
+	before.RPr = &wml.CT_RPr{
+		RStyle: o.RStyle, RFonts: o.RFonts, B: o.B, I: o.I, Strike: o.Strike, Dstrike: o.Dstrike,
+		Vanish: o.Vanish, Color: o.Color, Sz: o.Sz, U: o.U, VertAlign: o.VertAlign, Rtl: o.Rtl, Cs: o.Cs,
+	}
+	st := p.resolveRunStyle(&before, ctx)
+	return r, &st
+}
+
+// revisionCollector accumulates the revision info of the paragraph being
+// converted.
+type revisionCollector struct {
+	info RevisionInfo
+	seen map[string]bool
+}
+
+// beginRevisions starts collecting revision info for a paragraph and returns
+// the collector that was active before, to be restored by endRevisions.
+func (p *parser) beginRevisions() *revisionCollector {
+	prev := p.rev
+	p.rev = &revisionCollector{seen: make(map[string]bool)}
+	return prev
+}
+
+// endRevisions finishes the current collector and returns its info, or nil
+// if the paragraph carries no revision metadata.
+func (p *parser) endRevisions(prev *revisionCollector) *RevisionInfo {
+	c := p.rev
+	p.rev = prev
+	if c == nil || (len(c.info.Rsids) == 0 && len(c.info.Revisions) == 0) {
+		return nil
+	}
+	info := c.info
+	var last revisionStamp
+	for _, r := range info.Revisions {
+		if st := (revisionStamp{r.Author, r.Date}); r.Author != "" && st.later(last) {
+			last = st
+		}
+	}
+	for _, id := range info.Rsids {
+		if st, ok := p.rsidAuthors[id]; ok && st.later(last) {
+			last = st
+		}
+	}
+	info.Author, info.Date = last.author, last.date
+	return &info
+}
+
+// noteRsid records a revision save ID used by the current paragraph.
+func (p *parser) noteRsid(id *string) {
+	if p.rev == nil || id == nil || *id == "" || p.rev.seen[*id] {
+		return
+	}
+	p.rev.seen[*id] = true
+	p.rev.info.Rsids = append(p.rev.info.Rsids, *id)
+}
+
+// noteRevision records a tracked change in the current paragraph and the
+// document.
+func (p *parser) noteRevision(typ string, id int64, author string) {
+	r := Revision{Type: typ, ID: id, Author: author, Date: p.revisionDate(id)}
+	p.mdl.Revisions = append(p.mdl.Revisions, r)
+	if p.rev != nil {
+		p.rev.info.Revisions = append(p.rev.info.Revisions, r)
+	}
+}
+
+// noteParagraphRevisions records the paragraph-level rsids and tracked
+// changes of x.
+func (p *parser) noteParagraphRevisions(x *wml.CT_P) {
+	p.noteRsid(x.RsidRAttr)
+	p.noteRsid(x.RsidPAttr)
+	p.noteRsid(x.RsidRPrAttr)
+	if x.PPr == nil {
+		return
+	}
+	if rpr := x.PPr.RPr; rpr != nil {
+		if c := rpr.Ins; c != nil {
+			p.noteRevision(revParagraphInsert, c.IdAttr, c.AuthorAttr)
+		}
+		if c := rpr.Del; c != nil {
+			p.noteRevision(revParagraphDelete, c.IdAttr, c.AuthorAttr)
+		}
+	}
+	if c := x.PPr.PPrChange; c != nil {
+		p.noteRevision(revFormatChange, c.IdAttr, c.AuthorAttr)
+	}
+}
+
+// noteRunRevisions records the rsids and formatting changes of a run.
+func (p *parser) noteRunRevisions(x *wml.CT_R) {
+	p.noteRsid(x.RsidRAttr)
+	p.noteRsid(x.RsidRPrAttr)
+	if x.RPr != nil && x.RPr.RPrChange != nil {
+		c := x.RPr.RPrChange
+		p.noteRevision(revFormatChange, c.IdAttr, c.AuthorAttr)
+	}
+}
+
+// noteRunLevelRevisions records the tracked insertions, deletions and moves
+// among run-level elements.
+func (p *parser) noteRunLevelRevisions(rl *wml.EG_RunLevelElts) {
+	for _, c := range []struct {
+		typ string
+		tc  *wml.CT_RunTrackChange
+	}{
+		{revInsert, rl.Ins},
+		{revDelete, rl.Del},
+		{revMoveFrom, rl.MoveFrom},
+		{revMoveTo, rl.MoveTo},
+	} {
+		if c.tc != nil {
+			p.noteRevision(c.typ, c.tc.IdAttr, c.tc.AuthorAttr)
+		}
+	}
+}
+
+// mergeRevisionInfo combines the revision info of several blocks, e.g. the
+// paragraphs of a table.
+func mergeRevisionInfo(infos []*RevisionInfo) *RevisionInfo {
+	var out *RevisionInfo
+	seen := make(map[string]bool)
+	for _, in := range infos {
+		if in == nil {
+			continue
+		}
+		if out == nil {
+			out = &RevisionInfo{}
+		}
+		for _, id := range in.Rsids {
+			if !seen[id] {
+				seen[id] = true
+				out.Rsids = append(out.Rsids, id)
+			}
+		}
+		out.Revisions = append(out.Revisions, in.Revisions...)
+		if in.Author != "" && (revisionStamp{in.Author, in.Date}).later(revisionStamp{out.Author, out.Date}) {
+			out.Author, out.Date = in.Author, in.Date
+		}
+	}
+	return out
+}
+
+// RevisionsMode selects what becomes of tracked changes.
+type RevisionsMode int
+
+const (
+	// RevisionsAccept applies every tracked change, showing the document
+	// as it would read with all changes accepted.
+	RevisionsAccept RevisionsMode = iota
+	// RevisionsReject undoes every tracked change, showing the document as
+	// it read before the changes.
+	RevisionsReject
+	// RevisionsShow marks the changes up: insertions underlined in <ins>,
+	// deletions struck through in <del>, both coloured by author, and
+	// formatting changes in a span; each carries its author and date as
+	// its title tooltip.
+	RevisionsShow
+)
+
+// revisedRun returns r as mode leaves it, reporting false if mode removes
+// it.  Runs of a comparison, which carry a Change but no Revision, are left
+// alone.
+func revisedRun(r RenderRun, mode RevisionsMode) (RenderRun, bool) {
+	if mode == RevisionsShow {
+		return r, true
+	}
+	if r.Revision != nil {
+		if (mode == RevisionsAccept) == (r.Change == revDelete) {
+			return r, false
+		}
+		r.Revision, r.Change = nil, ""
+	}
+	if r.FormatChange != nil {
+		if mode == RevisionsReject && r.OriginalStyle != nil {
+			st := *r.OriginalStyle
+			if st.Script == "" {
+				st.Script = r.Style.Script // follows the text, not the formatting
+			}
+			r.Style = st
+		}
+		r.FormatChange, r.OriginalStyle = nil, nil
+	}
+	return r, true
+}
+
+// revisedRuns returns the runs mode leaves of runs, in a new slice.
+func revisedRuns(runs []RenderRun, mode RevisionsMode) []RenderRun {
+	var out []RenderRun
+	for _, r := range runs {
+		r, ok := revisedRun(r, mode)
+		if !ok {
+			continue
+		}
+		if r.Ruby != nil {
+			ruby := Ruby{Base: revisedRuns(r.Ruby.Base, mode), Guide: revisedRuns(r.Ruby.Guide, mode)}
+			r.Ruby = &ruby
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// revisedBlocks returns a copy of blocks with the tracked changes of their
+// paragraphs, including those in tables, resolved by mode.
+func revisedBlocks(blocks []DocumentBlock, mode RevisionsMode) []DocumentBlock {
+	paragraph := func(p RenderParagraph) RenderParagraph {
+		p.Runs = revisedRuns(p.Runs, mode)
+		if p.DropCap != nil {
+			dc := *p.DropCap
+			dc.Runs = revisedRuns(dc.Runs, mode)
+			p.DropCap = &dc
+		}
+		return p
+	}
+	out := make([]DocumentBlock, len(blocks))
+	for i, blk := range blocks {
+		if blk.Paragraph != nil {
+			p := paragraph(*blk.Paragraph)
+			blk.Paragraph = &p
+		}
+		if blk.Table != nil {
+			t := *blk.Table
+			t.Rows = make([]RenderTableRow, len(blk.Table.Rows))
+			for r, row := range blk.Table.Rows {
+				row.Cells = append([]RenderTableCell(nil), row.Cells...)
+				for c := range row.Cells {
+					ps := make([]RenderParagraph, len(row.Cells[c].Paragraphs))
+					for k, p := range row.Cells[c].Paragraphs {
+						ps[k] = paragraph(p)
+					}
+					row.Cells[c].Paragraphs = ps
+				}
+				t.Rows[r] = row
+			}
+			blk.Table = &t
+		}
+		out[i] = blk
+	}
+	return out
+}
+
+// ApplyRevisions resolves the tracked changes of m in place, as the HTML
+// renderer does for RenderOptions.Revisions: RevisionsAccept and
+// RevisionsReject leave the runs of one version without revision marks,
+// RevisionsShow leaves m unchanged.  Headers, footers, notes and comments
+// are included.  m.Revisions, the record of the changes, is kept.
+func ApplyRevisions(m *DocumentModel, mode RevisionsMode) {
+	if mode == RevisionsShow {
+		return
+	}
+	v := Visitor{
+		Paragraph: func(p *RenderParagraph) error {
+			p.Runs = revisedRuns(p.Runs, mode)
+			if p.DropCap != nil {
+				p.DropCap.Runs = revisedRuns(p.DropCap.Runs, mode)
+			}
+			return nil
+		},
+	}
+	Walk(m, v)
+	for _, sec := range m.Sections {
+		for _, blocks := range [][]DocumentBlock{sec.Header, sec.Footer, sec.FirstHeader, sec.FirstFooter} {
+			v.blocks(blocks)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package docx
+
+// -----------------------------------------------------------------------------
+// Sanitization
+// -----------------------------------------------------------------------------
+
+// SanitizeDocument removes from m, in place, what a document shared outside
+// the organisation should not carry: the document properties (except the
+// language), comments and their marks, the revision history and its
+// authors, and hidden text, including that of notes, headers and
+// footers.  Tracked changes are accepted, so deleted text is dropped.
+// Rendering or writing the model afterwards produces a cleaned artifact;
+// the source file is untouched.
+func SanitizeDocument(m *DocumentModel) {
+	m.Properties = DocProperties{Language: m.Properties.Language}
+	m.Comments = nil
+	ApplyRevisions(m, RevisionsAccept)
+	m.Revisions = nil
+	clean := func(runs []RenderRun) []RenderRun {
+		out := runs[:0]
+		for _, r := range runs {
+			if r.CommentRef != nil || r.Style.Hidden {
+				continue
+			}
+			r.Comments = nil
+			out = append(out, r)
+		}
+		return out
+	}
+	v := Visitor{
+		Paragraph: func(p *RenderParagraph) error {
+			p.Revision = nil
+			p.Runs = clean(p.Runs)
+			if p.DropCap != nil {
+				p.DropCap.Runs = clean(p.DropCap.Runs)
+			}
+			return nil
+		},
+		Table: func(t *RenderTable) error {
+			t.Revision = nil
+			return nil
+		},
+		Run: func(r *RenderRun) error {
+			if r.Ruby != nil {
+				r.Ruby.Base, r.Ruby.Guide = clean(r.Ruby.Base), clean(r.Ruby.Guide)
+			}
+			return nil
+		},
+	}
+	Walk(m, v)
+	for _, sec := range m.Sections {
+		for _, blocks := range [][]DocumentBlock{sec.Header, sec.Footer, sec.FirstHeader, sec.FirstFooter} {
+			v.blocks(blocks)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package docx
+
+import (
+	"io"
+
+	"github.com/aerissecure/convert/docx/ir"
+)
+
+// DocumentModel serialization is implemented by package ir, so models can be
+// decoded without this package; see ir.Encode.
+
+// DocumentModelVersion is the schema version written by EncodeDocumentModel.
+const DocumentModelVersion = ir.Version
+
+// ErrModelVersion is returned by DecodeDocumentModel for an envelope of a
+// schema version this package cannot read.  It is ir.ErrVersion.
+var ErrModelVersion = ir.ErrVersion
+
+// EncodeDocumentModel writes m to w as versioned JSON.
+func EncodeDocumentModel(w io.Writer, m DocumentModel) error {
+	return ir.Encode(w, m)
+}
+
+// DecodeDocumentModel reads a model written by EncodeDocumentModel,
+// migrating it from an earlier schema version if needed.
+func DecodeDocumentModel(r io.Reader) (DocumentModel, error) {
+	return ir.Decode(r)
+}
@@ -0,0 +1,88 @@
+package docx
+
+import (
+	"fmt"
+
+	"github.com/unidoc/unioffice/schema/soo/wml"
+)
+
+// -----------------------------------------------------------------------------
+// Source locations
+// -----------------------------------------------------------------------------
+//
+// Paragraphs, runs, tables and table cells carry the location of the OOXML
+// element they were converted from, so a selection in the rendered HTML can
+// be traced back to the original file.  The path format is documented on
+// RenderOptions.SourceMap.  Runs without an element of their own, such as
+// bookmark markers and ruby text, have no location.
+
+// sourceIndex records the location of every paragraph, table and run of the
+// decoded parts.  Locations are assigned before conversion so content the
+// converter skips (e.g. nested tables) does not shift later indices.
+type sourceIndex struct {
+	paras  map[*wml.CT_P]string
+	tables map[*wml.CT_Tbl]string
+	runs   map[*wml.CT_R]string
+}
+
+func newSourceIndex() sourceIndex {
+	return sourceIndex{
+		paras:  make(map[*wml.CT_P]string),
+		tables: make(map[*wml.CT_Tbl]string),
+		runs:   make(map[*wml.CT_R]string),
+	}
+}
+
+// add indexes the content of one container; prefix is "" for the body or
+// the container path followed by a slash.
+func (s sourceIndex) add(prefix string, elts []*wml.EG_BlockLevelElts) {
+	var (
+		para       string
+		np, nt, nr int
+	)
+	blockVisitor{
+		para: func(x *wml.CT_P) {
+			para = fmt.Sprintf("%sp%d", prefix, np)
+			s.paras[x] = para
+			np, nr = np+1, 0
+		},
+		tbl: func(x *wml.CT_Tbl) {
+			s.tables[x] = fmt.Sprintf("%stbl%d", prefix, nt)
+			nt++
+		},
+		run: func(x *wml.CT_R) {
+			s.runs[x] = fmt.Sprintf("%s/r%d", para, nr)
+			nr++
+		},
+	}.blocks(elts)
+}
+
+// cellSource returns the location of a table cell.
+func cellSource(table string, row, cell int) string {
+	if table == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/tr%d/tc%d", table, row, cell)
+}
+
+// prefixSources prefixes every location in m, used for imported documents.
+func prefixSources(m *DocumentModel, prefix string) {
+	add := func(s *string) {
+		if *s != "" {
+			*s = prefix + *s
+		}
+	}
+	_ = Walk(m, Visitor{
+		Paragraph: func(p *RenderParagraph) error { add(&p.Source); return nil },
+		Run:       func(r *RenderRun) error { add(&r.Source); return nil },
+		Table: func(t *RenderTable) error {
+			add(&t.Source)
+			for i := range t.Rows {
+				for j := range t.Rows[i].Cells {
+					add(&t.Rows[i].Cells[j].Source)
+				}
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,485 @@
+package docx
+
+import (
+	"strings"
+
+	"github.com/unidoc/unioffice/document"
+	"github.com/unidoc/unioffice/schema/soo/ofc/sharedTypes"
+	"github.com/unidoc/unioffice/schema/soo/wml"
+)
+
+// -----------------------------------------------------------------------------
+// Style resolution
+// -----------------------------------------------------------------------------
+//
+// Formatting in WordprocessingML is layered.  A paragraph starts from the
+// document defaults (w:docDefaults), then takes the properties of its
+// paragraph style, or of the default paragraph style if it names none, and
+// its direct formatting overrides them.  A run starts from the same
+// defaults and the run properties of its paragraph's style, then takes
+// those of its character style and its own direct formatting.  Styles may
+// be based on other styles, whose properties they inherit.  runProps and
+// paraProps model a single layer, with nil meaning "not specified here",
+// so layers can be merged before being flattened into a RunStyle or
+// ParagraphStyle.
+
+// runProps is the set of character properties specified by one w:rPr.
+type runProps struct {
+	fontFamily   *string
+	fontEastAsia *string
+	fontCS       *string
+	script       *string // "eastAsia" from the rFonts hint, "cs" from w:cs/w:rtl
+	fontSizePt   *float64
+	color        *string
+	bold         *bool
+	italic       *bool
+	underline    *bool
+	strike       *bool
+	hidden       *bool
+	vertAlign    *string
+}
+
+// runPropsFromRPr extracts the properties we model from a w:rPr.
+func runPropsFromRPr(rpr *wml.CT_RPr) runProps {
+	var rp runProps
+	if rpr == nil {
+		return rp
+	}
+	if f := rpr.RFonts; f != nil {
+		switch {
+		case f.AsciiAttr != nil:
+			rp.fontFamily = f.AsciiAttr
+		case f.HAnsiAttr != nil:
+			rp.fontFamily = f.HAnsiAttr
+		}
+		rp.fontEastAsia = f.EastAsiaAttr
+		rp.fontCS = f.CsAttr
+		if f.HintAttr == wml.ST_HintEastAsia {
+			v := "eastAsia"
+			rp.script = &v
+		}
+	}
+	if onOff(rpr.Cs) || onOff(rpr.Rtl) {
+		v := "cs"
+		rp.script = &v
+	}
+	if rpr.Sz != nil && rpr.Sz.ValAttr.ST_UnsignedDecimalNumber != nil {
+		sz := float64(*rpr.Sz.ValAttr.ST_UnsignedDecimalNumber) / 2 // half-points
+		rp.fontSizePt = &sz
+	}
+	if rpr.Color != nil {
+		c := ""
+		if rgb := rpr.Color.ValAttr.ST_HexColorRGB; rgb != nil {
+			c = strings.ToUpper(*rgb)
+		}
+		rp.color = &c // "auto" resets to the default colour
+	}
+	rp.bold = onOffPtr(rpr.B)
+	rp.italic = onOffPtr(rpr.I)
+	if rpr.Strike != nil || rpr.Dstrike != nil {
+		v := onOff(rpr.Strike) || onOff(rpr.Dstrike)
+		rp.strike = &v
+	}
+	rp.hidden = onOffPtr(rpr.Vanish)
+	if rpr.U != nil {
+		v := rpr.U.ValAttr != wml.ST_UnderlineNone
+		rp.underline = &v
+	}
+	if rpr.VertAlign != nil {
+		var v string
+		switch rpr.VertAlign.ValAttr {
+		case sharedTypes.ST_VerticalAlignRunSuperscript:
+			v = "superscript"
+		case sharedTypes.ST_VerticalAlignRunSubscript:
+			v = "subscript"
+		default:
+			v = "baseline"
+		}
+		rp.vertAlign = &v
+	}
+	return rp
+}
+
+// onOffPtr is onOff for optional properties: nil when the element is absent.
+func onOffPtr(v *wml.CT_OnOff) *bool {
+	if v == nil {
+		return nil
+	}
+	b := onOff(v)
+	return &b
+}
+
+// merge returns p with every property specified in over replacing its own.
+func (p runProps) merge(over runProps) runProps {
+	if over.fontFamily != nil {
+		p.fontFamily = over.fontFamily
+	}
+	if over.fontEastAsia != nil {
+		p.fontEastAsia = over.fontEastAsia
+	}
+	if over.fontCS != nil {
+		p.fontCS = over.fontCS
+	}
+	if over.script != nil {
+		p.script = over.script
+	}
+	if over.fontSizePt != nil {
+		p.fontSizePt = over.fontSizePt
+	}
+	if over.color != nil {
+		p.color = over.color
+	}
+	if over.bold != nil {
+		p.bold = over.bold
+	}
+	if over.italic != nil {
+		p.italic = over.italic
+	}
+	if over.underline != nil {
+		p.underline = over.underline
+	}
+	if over.strike != nil {
+		p.strike = over.strike
+	}
+	if over.hidden != nil {
+		p.hidden = over.hidden
+	}
+	if over.vertAlign != nil {
+		p.vertAlign = over.vertAlign
+	}
+	return p
+}
+
+// runStyle flattens the merged properties into the IR's RunStyle.
+func (p runProps) runStyle() RunStyle {
+	var s RunStyle
+	if p.fontFamily != nil {
+		s.FontFamily = *p.fontFamily
+	}
+	if p.fontEastAsia != nil {
+		s.FontFamilyEastAsia = *p.fontEastAsia
+	}
+	if p.fontCS != nil {
+		s.FontFamilyCS = *p.fontCS
+	}
+	if p.script != nil {
+		s.Script = *p.script
+	}
+	if p.fontSizePt != nil {
+		s.FontSizePt = *p.fontSizePt
+	}
+	if p.color != nil {
+		s.FontColor = *p.color
+	}
+	s.Bold = p.bold != nil && *p.bold
+	s.Italic = p.italic != nil && *p.italic
+	s.Underline = p.underline != nil && *p.underline
+	s.Strike = p.strike != nil && *p.strike
+	s.Hidden = p.hidden != nil && *p.hidden
+	if p.vertAlign != nil && *p.vertAlign != "baseline" {
+		s.VerticalAlign = *p.vertAlign
+	}
+	return s
+}
+
+// hyperlinkStyleID is the built-in character style Word applies to links.
+const hyperlinkStyleID = "Hyperlink"
+
+// defaultHyperlinkProps mirrors Word's built-in Hyperlink style and is used
+// when a document links text without defining that style.
+func defaultHyperlinkProps() runProps {
+	color, underline := "0563C1", true
+	return runProps{color: &color, underline: &underline}
+}
+
+const relStyles = "/styles"
+
+// styleSheet indexes the styles part of a document.
+type styleSheet struct {
+	styles       map[string]*wml.CT_Style
+	runDefaults  runProps  // w:rPrDefault
+	paraDefaults paraProps // w:pPrDefault
+	defaultPara  string    // ID of the default paragraph style, e.g. "Normal"
+}
+
+func newStyleSheet(doc *document.Document) styleSheet {
+	ss := styleSheet{styles: make(map[string]*wml.CT_Style)}
+	x := doc.Styles.X()
+	if x == nil {
+		return ss
+	}
+	for _, st := range x.Style {
+		if st.StyleIdAttr == nil {
+			continue
+		}
+		ss.styles[*st.StyleIdAttr] = st
+		if st.TypeAttr == wml.ST_StyleTypeParagraph && st.DefaultAttr != nil && onOffValue(st.DefaultAttr) && ss.defaultPara == "" {
+			ss.defaultPara = *st.StyleIdAttr
+		}
+	}
+	if dd := x.DocDefaults; dd != nil {
+		if dd.RPrDefault != nil {
+			ss.runDefaults = runPropsFromRPr(dd.RPrDefault.RPr)
+		}
+		if dd.PPrDefault != nil {
+			ss.paraDefaults = paraPropsFromStyle(dd.PPrDefault.PPr)
+		}
+	}
+	return ss
+}
+
+// has reports whether the style sheet defines the given style ID.
+func (ss styleSheet) has(id string) bool {
+	_, ok := ss.styles[id]
+	return ok
+}
+
+// name returns the display name of a style, or "" if it has none.
+func (ss styleSheet) name(id string) string {
+	if st, ok := ss.styles[id]; ok && st.Name != nil {
+		return st.Name.ValAttr
+	}
+	return ""
+}
+
+// characterProps resolves the run properties of a style, following its
+// basedOn chain so properties defined on ancestors are inherited.
+func (ss styleSheet) characterProps(id string) runProps {
+	var rp runProps
+	chain := ss.chain(id)
+	for i := len(chain) - 1; i >= 0; i-- {
+		rp = rp.merge(runPropsFromRPr(chain[i].RPr))
+	}
+	return rp
+}
+
+// chain returns style id followed by the styles it is based on, nearest
+// first, stopping at an unknown style or a cycle.
+func (ss styleSheet) chain(id string) []*wml.CT_Style {
+	var chain []*wml.CT_Style
+	seen := make(map[string]bool)
+	for id != "" && !seen[id] {
+		seen[id] = true
+		st, ok := ss.styles[id]
+		if !ok {
+			break
+		}
+		chain = append(chain, st)
+		id = ""
+		if st.BasedOn != nil {
+			id = st.BasedOn.ValAttr
+		}
+	}
+	return chain
+}
+
+// paraProps is the set of paragraph properties specified by one w:pPr,
+// with nil meaning "not specified here" as for runProps.
+type paraProps struct {
+	alignment     *string
+	lineSpacingPt *float64
+	spaceBeforePt *float64
+	spaceAfterPt  *float64
+	indentLeftPt  *float64
+	indentRightPt *float64
+	outlineLevel  *int   // w:outlineLvl, 0-based; 9 is body text
+	numID         *int64 // w:numPr numbering instance; 0 removes numbering
+	numLevel      *int64 // w:numPr level
+}
+
+// paraPropsFromPPr extracts the properties we model from a paragraph's
+// w:pPr.
+func paraPropsFromPPr(ppr *wml.CT_PPr) paraProps {
+	if ppr == nil {
+		return paraProps{}
+	}
+	return newParaProps(ppr.Jc, ppr.Spacing, ppr.Ind, ppr.OutlineLvl, ppr.NumPr)
+}
+
+// paraPropsFromStyle extracts the properties we model from a style's
+// w:pPr.
+func paraPropsFromStyle(ppr *wml.CT_PPrGeneral) paraProps {
+	if ppr == nil {
+		return paraProps{}
+	}
+	return newParaProps(ppr.Jc, ppr.Spacing, ppr.Ind, ppr.OutlineLvl, ppr.NumPr)
+}
+
+// newParaProps extracts paraProps from the elements that paragraph and
+// style properties share.
+func newParaProps(jc *wml.CT_Jc, spacing *wml.CT_Spacing, ind *wml.CT_Ind, outline *wml.CT_DecimalNumber, num *wml.CT_NumPr) paraProps {
+	var pp paraProps
+	if jc != nil {
+		var v string
+		switch jc.ValAttr {
+		case wml.ST_JcCenter:
+			v = "center"
+		case wml.ST_JcRight, wml.ST_JcEnd:
+			v = "right"
+		case wml.ST_JcBoth, wml.ST_JcDistribute:
+			v = "justify"
+		default:
+			v = "left"
+		}
+		pp.alignment = &v
+	}
+	if spacing != nil {
+		if v, ok := twipsPt(spacing.BeforeAttr); ok {
+			pp.spaceBeforePt = &v
+		}
+		if v, ok := twipsPt(spacing.AfterAttr); ok {
+			pp.spaceAfterPt = &v
+		}
+		// An "auto" rule gives the spacing in 240ths of a line, which
+		// LineSpacingPt cannot hold; it falls back to single spacing.
+		if spacing.LineAttr != nil {
+			v, ok := signedTwipsPt(*spacing.LineAttr)
+			if spacing.LineRuleAttr != wml.ST_LineSpacingRuleExact && spacing.LineRuleAttr != wml.ST_LineSpacingRuleAtLeast {
+				v, ok = 0, true
+			}
+			if ok {
+				pp.lineSpacingPt = &v
+			}
+		}
+	}
+	if ind != nil {
+		left, right := ind.LeftAttr, ind.RightAttr
+		if ind.StartAttr != nil {
+			left = ind.StartAttr
+		}
+		if ind.EndAttr != nil {
+			right = ind.EndAttr
+		}
+		if left != nil {
+			if v, ok := signedTwipsPt(*left); ok {
+				pp.indentLeftPt = &v
+			}
+		}
+		if right != nil {
+			if v, ok := signedTwipsPt(*right); ok {
+				pp.indentRightPt = &v
+			}
+		}
+	}
+	if outline != nil {
+		v := int(outline.ValAttr)
+		pp.outlineLevel = &v
+	}
+	if num != nil {
+		if num.NumId != nil {
+			pp.numID = &num.NumId.ValAttr
+		}
+		if num.Ilvl != nil {
+			pp.numLevel = &num.Ilvl.ValAttr
+		}
+	}
+	return pp
+}
+
+// merge returns p with every property specified in over replacing its own.
+func (p paraProps) merge(over paraProps) paraProps {
+	if over.alignment != nil {
+		p.alignment = over.alignment
+	}
+	if over.lineSpacingPt != nil {
+		p.lineSpacingPt = over.lineSpacingPt
+	}
+	if over.spaceBeforePt != nil {
+		p.spaceBeforePt = over.spaceBeforePt
+	}
+	if over.spaceAfterPt != nil {
+		p.spaceAfterPt = over.spaceAfterPt
+	}
+	if over.indentLeftPt != nil {
+		p.indentLeftPt = over.indentLeftPt
+	}
+	if over.indentRightPt != nil {
+		p.indentRightPt = over.indentRightPt
+	}
+	if over.outlineLevel != nil {
+		p.outlineLevel = over.outlineLevel
+	}
+	if over.numID != nil {
+		p.numID = over.numID
+	}
+	if over.numLevel != nil {
+		p.numLevel = over.numLevel
+	}
+	return p
+}
+
+// paragraphStyle flattens the merged properties into the IR's
+// ParagraphStyle.  Outline levels 0-5 make headings 1-6.  The list fields
+// are left to listNumbering.
+func (p paraProps) paragraphStyle() ParagraphStyle {
+	var s ParagraphStyle
+	if p.alignment != nil && *p.alignment != "left" {
+		s.Alignment = *p.alignment
+	}
+	if p.lineSpacingPt != nil {
+		s.LineSpacingPt = *p.lineSpacingPt
+	}
+	if p.spaceBeforePt != nil {
+		s.SpaceBeforePt = *p.spaceBeforePt
+	}
+	if p.spaceAfterPt != nil {
+		s.SpaceAfterPt = *p.spaceAfterPt
+	}
+	if p.indentLeftPt != nil {
+		s.IndentLeftPx = *p.indentLeftPt * 96 / 72
+	}
+	if p.indentRightPt != nil {
+		s.IndentRightPx = *p.indentRightPt * 96 / 72
+	}
+	if p.outlineLevel != nil && *p.outlineLevel >= 0 && *p.outlineLevel < 6 {
+		s.HeadingLevel = *p.outlineLevel + 1
+	}
+	return s
+}
+
+// paragraphProps resolves the paragraph properties of paragraph style id,
+// or of the default paragraph style if id is "", over the document
+// defaults, following the style's basedOn chain.  The built-in heading
+// styles are headings whether or not the style sheet gives them an
+// outline level, and even when the document has no style sheet.
+func (ss styleSheet) paragraphProps(id string) paraProps {
+	if id == "" {
+		id = ss.defaultPara
+	}
+	pp := ss.paraDefaults
+	chain := ss.chain(id)
+	for i := len(chain) - 1; i >= 0; i-- {
+		pp = pp.merge(paraPropsFromStyle(chain[i].PPr))
+	}
+	if pp.outlineLevel == nil {
+		name := id
+		if n := ss.name(id); n != "" {
+			name = n
+		}
+		if level := builtinHeadingLevel(name); level > 0 {
+			v := level - 1
+			pp.outlineLevel = &v
+		}
+	}
+	return pp
+}
+
+// paragraphRunProps resolves the run properties paragraph style id, or the
+// default paragraph style if id is "", gives the runs of its paragraphs,
+// over the document defaults.
+func (ss styleSheet) paragraphRunProps(id string) runProps {
+	if id == "" {
+		id = ss.defaultPara
+	}
+	return ss.runDefaults.merge(ss.characterProps(id))
+}
+
+// builtinHeadingLevel returns N for the built-in style "heading N" (by
+// name) or "HeadingN" (by ID), N from 1 to 6, and 0 otherwise.
+func builtinHeadingLevel(name string) int {
+	name = strings.ToLower(strings.ReplaceAll(name, " ", ""))
+	if len(name) == len("heading1") && strings.HasPrefix(name, "heading") && name[7] >= '1' && name[7] <= '6' {
+		return int(name[7] - '0')
+	}
+	return 0
+}
@@ -0,0 +1,81 @@
+package docx
+
+import (
+	"strings"
+
+	"github.com/aerissecure/convert/internal/textsafe"
+)
+
+// -----------------------------------------------------------------------------
+// Plain text
+// -----------------------------------------------------------------------------
+
+// DocumentText returns the text of m as a reader would see it, for search
+// indexing and previews: one line per paragraph, table rows as lines of
+// tab-separated cells, then the footnotes and endnotes.  Hidden text and
+// deleted runs are left out, and the text is repaired with the rules of the
+// HTML output.
+func DocumentText(m DocumentModel) string {
+	var lines []string
+	if len(m.Blocks) == 0 {
+		for _, p := range m.Paragraphs {
+			lines = append(lines, paragraphText(p))
+		}
+		for _, t := range m.Tables {
+			lines = appendTableText(lines, t)
+		}
+	} else {
+		lines = appendBlocksText(lines, m.Blocks)
+	}
+	for _, n := range m.Notes {
+		lines = appendBlocksText(lines, n.Blocks)
+	}
+	return textsafe.Clean(strings.Join(lines, "\n"))
+}
+
+func appendBlocksText(lines []string, blocks []DocumentBlock) []string {
+	for _, blk := range blocks {
+		switch {
+		case blk.Paragraph != nil:
+			lines = append(lines, paragraphText(*blk.Paragraph))
+		case blk.Table != nil:
+			lines = appendTableText(lines, *blk.Table)
+		case blk.AltChunk != nil && blk.AltChunk.Text != "":
+			lines = append(lines, blk.AltChunk.Text)
+		}
+	}
+	return lines
+}
+
+func appendTableText(lines []string, t RenderTable) []string {
+	for _, row := range t.Rows {
+		cells := make([]string, len(row.Cells))
+		for i, c := range row.Cells {
+			paras := make([]string, len(c.Paragraphs))
+			for j, p := range c.Paragraphs {
+				paras[j] = paragraphText(p)
+			}
+			cells[i] = strings.Join(paras, " ")
+		}
+		lines = append(lines, strings.Join(cells, "\t"))
+	}
+	return lines
+}
+
+func paragraphText(p RenderParagraph) string {
+	var b strings.Builder
+	if p.DropCap != nil {
+		writeRunsText(&b, p.DropCap.Runs)
+	}
+	writeRunsText(&b, p.Runs)
+	return b.String()
+}
+
+func writeRunsText(b *strings.Builder, runs []RenderRun) {
+	for _, r := range runs {
+		if r.Style.Hidden || r.Change == "delete" {
+			continue
+		}
+		b.WriteString(r.Text)
+	}
+}
@@ -0,0 +1,226 @@
+package docx
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aerissecure/convert/internal/csssafe"
+	"github.com/aerissecure/convert/media"
+)
+
+// -----------------------------------------------------------------------------
+// Thumbnails
+// -----------------------------------------------------------------------------
+//
+// Thumbnails draw the first page directly as SVG shapes rather than embedding
+// the HTML, so they are valid standalone images that any rasterizer can
+// handle.  Blocks flow down the first section's page until it is full or a
+// page or section break; line wrapping uses the page-layout estimates.  Text
+// becomes wrapped lines, tables become grids and images and objects become
+// grey boxes.  The result shows the shape of the page, not an exact
+// rendering.
+
+// ThumbnailSVG renders the first page of the document as a standalone SVG of
+// width×height pixels, for previews such as file-browser grids.  The page
+// keeps its aspect ratio and is centred.
+func ThumbnailSVG(m DocumentModel, width, height int) string {
+	blocks := m.Blocks
+	if len(blocks) == 0 {
+		for i := range m.Paragraphs {
+			blocks = append(blocks, DocumentBlock{Paragraph: &m.Paragraphs[i]})
+		}
+		for i := range m.Tables {
+			blocks = append(blocks, DocumentBlock{Table: &m.Tables[i]})
+		}
+	}
+	s := sectionLayout(nil)
+	if len(m.Sections) > 0 {
+		s = m.Sections[0]
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %.1f %.1f\" preserveAspectRatio=\"xMidYMid meet\">\n",
+		width, height, s.PageWidthPt, s.PageHeightPt))
+	b.WriteString(fmt.Sprintf("<rect width=\"%.1f\" height=\"%.1f\" fill=\"#fff\"/>\n", s.PageWidthPt, s.PageHeightPt))
+	t := thumbnail{b: &b, bottom: s.PageHeightPt - s.MarginBottomPt}
+	x, w, y := s.MarginLeftPt, s.PageWidthPt-s.MarginLeftPt-s.MarginRightPt, s.MarginTopPt
+	for i, blk := range blocks {
+		if y >= t.bottom || (i > 0 && blk.Paragraph != nil && blk.Paragraph.PageBreakBefore) {
+			break
+		}
+		switch {
+		case blk.Paragraph != nil:
+			y = t.paragraph(*blk.Paragraph, x, w, y)
+		case blk.Table != nil:
+			y = t.table(*blk.Table, x, w, y)
+		case blk.AltChunk != nil:
+			y = t.paragraph(RenderParagraph{Runs: []RenderRun{{Text: blk.AltChunk.Text}}}, x, w, y)
+		}
+		if blk.Paragraph != nil && blk.Paragraph.SectionEnd {
+			break
+		}
+	}
+	b.WriteString("</svg>\n")
+	return b.String()
+}
+
+// ThumbnailPNG renders ThumbnailSVG and rasterizes it with r.
+func ThumbnailPNG(m DocumentModel, width, height int, r media.Rasterizer) ([]byte, error) {
+	return r([]byte(ThumbnailSVG(m, width, height)), width, height)
+}
+
+// thumbnail draws blocks into an SVG, in points.  Drawing stops at bottom.
+type thumbnail struct {
+	b      *strings.Builder
+	bottom float64
+}
+
+// paragraph draws p in the column starting at x, width wide, with its top
+// at y, and returns the y below it.
+func (t thumbnail) paragraph(p RenderParagraph, x, width, y float64) float64 {
+	size, color, weight := 0.0, "", ""
+	var text strings.Builder
+	for _, r := range p.Runs {
+		if _, ok := revisedRun(r, RevisionsAccept); !ok {
+			continue
+		}
+		if r.Object != nil || r.Image != nil {
+			w, h := 0.0, 0.0
+			if r.Object != nil {
+				w, h = r.Object.WidthPt, r.Object.HeightPt
+			} else {
+				w, h = r.Image.WidthPt, r.Image.HeightPt
+			}
+			h = math.Min(h, t.bottom-y)
+			if h > 0 {
+				t.b.WriteString(fmt.Sprintf("<rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\" fill=\"#ddd\"/>\n", x, y, math.Min(w, width), h))
+				y += h
+			}
+			continue
+		}
+		size = math.Max(size, r.Style.FontSizePt)
+		if color == "" {
+			color = csssafe.Color(r.Style.FontColor)
+		}
+		if r.Style.Bold || isHeading(p) {
+			weight = " font-weight=\"bold\""
+		}
+		text.WriteString(r.Text)
+	}
+	if size == 0 {
+		size = defaultFontSizePt
+	}
+	if color == "" {
+		color = "000"
+	}
+	leading := p.Style.LineSpacingPt
+	if leading <= 0 {
+		leading = size * lineHeightEm
+	}
+	x += p.Style.IndentLeftPx * pxToPt
+	width -= (p.Style.IndentLeftPx + p.Style.IndentRightPx) * pxToPt
+	anchor, ax := "", x
+	switch p.Style.Alignment {
+	case "center":
+		anchor, ax = " text-anchor=\"middle\"", x+width/2
+	case "right":
+		anchor, ax = " text-anchor=\"end\"", x+width
+	}
+
+	y += p.Style.SpaceBeforePt
+	perLine := int(math.Max(1, math.Floor(width/(size*avgCharWidthEm))))
+	for _, line := range wrapLines(text.String(), perLine) {
+		if y+leading > t.bottom {
+			return t.bottom
+		}
+		y += leading
+		if strings.TrimSpace(line) != "" {
+			t.b.WriteString(fmt.Sprintf("<text x=\"%.1f\" y=\"%.1f\" font-family=\"sans-serif\" font-size=\"%.1f\" fill=\"#%s\"%s%s>%s</text>\n",
+				ax, y-(leading-size)/2-size*0.2, size, color, weight, anchor, html.EscapeString(line)))
+		}
+	}
+	return y + p.Style.SpaceAfterPt
+}
+
+// table draws t as a grid of cells and returns the y below it.
+func (t thumbnail) table(tbl RenderTable, x, width, y float64) float64 {
+	for _, row := range tbl.Rows {
+		if y >= t.bottom {
+			break
+		}
+		widths := make([]float64, len(row.Cells))
+		for i, cell := range row.Cells {
+			widths[i] = width / float64(len(row.Cells))
+			if cell.WidthPx > 0 {
+				widths[i] = cell.WidthPx * pxToPt
+			}
+		}
+		h := row.HeightPx * pxToPt
+		for i, cell := range row.Cells {
+			var ch float64
+			for _, p := range cell.Paragraphs {
+				ch += paragraphHeightPt(p, widths[i]-4)
+			}
+			h = math.Max(h, ch+4)
+		}
+		h = math.Min(h, t.bottom-y)
+		cx := x
+		for i, cell := range row.Cells {
+			fill := "none"
+			if c := csssafe.Color(cell.Style.BackgroundColor); c != "" {
+				fill = "#" + c
+			}
+			t.b.WriteString(fmt.Sprintf("<rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\" fill=\"%s\" stroke=\"#999\" stroke-width=\"0.5\"/>\n", cx, y, widths[i], h, fill))
+			inner := thumbnail{b: t.b, bottom: y + h}
+			cy := y + 2
+			for _, p := range cell.Paragraphs {
+				cy = inner.paragraph(p, cx+2, widths[i]-4, cy)
+			}
+			cx += widths[i]
+		}
+		y += h
+	}
+	return y
+}
+
+// wrapLines breaks text into lines of at most perLine characters at spaces,
+// splitting words that are longer than a line.
+func wrapLines(text string, perLine int) []string {
+	var lines []string
+	for _, para := range strings.Split(text, "\n") {
+		var line strings.Builder
+		n := 0
+		for _, word := range strings.Fields(para) {
+			for utf8.RuneCountInString(word) > perLine {
+				if n > 0 {
+					lines = append(lines, line.String())
+					line.Reset()
+					n = 0
+				}
+				head := []rune(word)[:perLine]
+				lines = append(lines, string(head))
+				word = word[len(string(head)):]
+			}
+			if word == "" {
+				continue
+			}
+			wn := utf8.RuneCountInString(word)
+			if n > 0 && n+1+wn > perLine {
+				lines = append(lines, line.String())
+				line.Reset()
+				n = 0
+			}
+			if n > 0 {
+				line.WriteByte(' ')
+				n++
+			}
+			line.WriteString(word)
+			n += wn
+		}
+		lines = append(lines, line.String())
+	}
+	return lines
+}
@@ -0,0 +1,159 @@
+package docx
+
+import "errors"
+
+// -----------------------------------------------------------------------------
+// Model traversal
+// -----------------------------------------------------------------------------
+//
+// Walk lets callers inspect or rewrite a parsed document between parse and
+// render – redacting text, rewriting link targets, tagging blocks – without
+// knowing how paragraphs, tables, notes and comments nest.
+
+// SkipChildren may be returned by a Visitor callback to skip the contents of
+// the node it was called for.  Walk continues with the next sibling.
+var SkipChildren = errors.New("docx: skip children")
+
+// Visitor holds the callbacks Walk calls for each node.  Nodes are passed by
+// pointer and may be modified in place.  Any callback may be nil.  An error
+// other than SkipChildren stops the walk and is returned by Walk.
+type Visitor struct {
+	Block     func(*DocumentBlock) error
+	Paragraph func(*RenderParagraph) error
+	Table     func(*RenderTable) error
+	Run       func(*RenderRun) error
+}
+
+// Walk visits the document in order: the body, then the note bodies, then
+// the comment bodies.  Table paragraphs, drop caps and ruby text are visited
+// as part of their enclosing block.
+//
+// Paragraphs and Tables, which duplicate the top-level entries of Blocks, are
+// rebuilt from Blocks afterwards so both views reflect the changes.  Models
+// without Blocks are walked through Paragraphs and Tables instead.
+func Walk(m *DocumentModel, v Visitor) error {
+	if len(m.Blocks) == 0 {
+		for i := range m.Paragraphs {
+			if err := v.paragraph(&m.Paragraphs[i]); err != nil {
+				return err
+			}
+		}
+		for i := range m.Tables {
+			if err := v.table(&m.Tables[i]); err != nil {
+				return err
+			}
+		}
+	} else {
+		err := v.blocks(m.Blocks)
+		m.Paragraphs, m.Tables = nil, nil
+		for _, blk := range m.Blocks {
+			if blk.Paragraph != nil {
+				m.Paragraphs = append(m.Paragraphs, *blk.Paragraph)
+			}
+			if blk.Table != nil {
+				m.Tables = append(m.Tables, *blk.Table)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for i := range m.Notes {
+		if err := v.blocks(m.Notes[i].Blocks); err != nil {
+			return err
+		}
+	}
+	for i := range m.Comments {
+		if err := v.blocks(m.Comments[i].Blocks); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// visit calls fn on node, translating SkipChildren into skip.
+func visit[T any](fn func(*T) error, node *T) (skip bool, err error) {
+	if fn == nil {
+		return false, nil
+	}
+	switch err := fn(node); {
+	case errors.Is(err, SkipChildren):
+		return true, nil
+	case err != nil:
+		return false, err
+	}
+	return false, nil
+}
+
+func (v Visitor) blocks(blocks []DocumentBlock) error {
+	for i := range blocks {
+		blk := &blocks[i]
+		if skip, err := visit(v.Block, blk); err != nil || skip {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if blk.Paragraph != nil {
+			if err := v.paragraph(blk.Paragraph); err != nil {
+				return err
+			}
+		}
+		if blk.Table != nil {
+			if err := v.table(blk.Table); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (v Visitor) paragraph(p *RenderParagraph) error {
+	if skip, err := visit(v.Paragraph, p); err != nil || skip {
+		return err
+	}
+	if p.DropCap != nil {
+		if err := v.runs(p.DropCap.Runs); err != nil {
+			return err
+		}
+	}
+	return v.runs(p.Runs)
+}
+
+func (v Visitor) table(t *RenderTable) error {
+	if skip, err := visit(v.Table, t); err != nil || skip {
+		return err
+	}
+	for r := range t.Rows {
+		for c := range t.Rows[r].Cells {
+			cell := &t.Rows[r].Cells[c]
+			for i := range cell.Paragraphs {
+				if err := v.paragraph(&cell.Paragraphs[i]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (v Visitor) runs(runs []RenderRun) error {
+	for i := range runs {
+		r := &runs[i]
+		if skip, err := visit(v.Run, r); err != nil || skip {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if r.Ruby != nil {
+			if err := v.runs(r.Ruby.Base); err != nil {
+				return err
+			}
+			if err := v.runs(r.Ruby.Guide); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
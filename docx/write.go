@@ -0,0 +1,300 @@
+package docx
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/unidoc/unioffice/color"
+	"github.com/unidoc/unioffice/document"
+	"github.com/unidoc/unioffice/measurement"
+	"github.com/unidoc/unioffice/schema/soo/ofc/sharedTypes"
+	"github.com/unidoc/unioffice/schema/soo/wml"
+)
+
+// -----------------------------------------------------------------------------
+// DOCX writer
+// -----------------------------------------------------------------------------
+//
+// WriteDocument is the reverse of ParseDocumentModel for the parts of the
+// model that HTML and Markdown input can produce: paragraphs with headings,
+// alignment, spacing, indents and list membership, runs with basic
+// character formatting and hyperlinks, and tables with spans, widths and
+// shading.  Headings use the built-in "HeadingN" styles; every list
+// instance gets its own numbering definition so ordered lists restart.
+// Notes, comments, revisions, objects, sections and content controls are
+// not written; tracked changes are written accepted.
+
+// WriteDocument serializes m as a DOCX package to w.
+func WriteDocument(w io.Writer, m DocumentModel) error {
+	doc := document.New()
+	if t := m.Properties.Title; t != "" {
+		doc.CoreProperties.SetTitle(t)
+	}
+	if a := m.Properties.Author; a != "" {
+		doc.CoreProperties.SetAuthor(a)
+	}
+	if d := m.Properties.Description; d != "" {
+		doc.CoreProperties.SetDescription(d)
+	}
+	if l := m.Properties.Language; l != "" {
+		doc.CoreProperties.SetLanguage(l)
+	}
+
+	dw := &docWriter{doc: doc, lists: make(map[listKey]int64)}
+	blocks := m.Blocks
+	if len(blocks) == 0 {
+		for i := range m.Paragraphs {
+			blocks = append(blocks, DocumentBlock{Paragraph: &m.Paragraphs[i]})
+		}
+		for i := range m.Tables {
+			blocks = append(blocks, DocumentBlock{Table: &m.Tables[i]})
+		}
+	}
+	for _, blk := range blocks {
+		switch {
+		case blk.Paragraph != nil:
+			dw.paragraph(doc.AddParagraph(), *blk.Paragraph)
+		case blk.Table != nil:
+			dw.table(doc.AddTable(), *blk.Table)
+		case blk.AltChunk != nil:
+			for _, line := range strings.Split(blk.AltChunk.Text, "\n") {
+				dw.paragraph(doc.AddParagraph(), RenderParagraph{Runs: []RenderRun{{Text: line}}})
+			}
+		}
+	}
+	return doc.Save(w)
+}
+
+// listKey identifies a list instance of the model.
+type listKey struct {
+	id      int
+	ordered bool
+}
+
+// docWriter carries the state shared while writing one document.
+type docWriter struct {
+	doc   *document.Document
+	lists map[listKey]int64 // list instance -> w:numId
+}
+
+// paragraph writes p into para.
+func (dw *docWriter) paragraph(para document.Paragraph, p RenderParagraph) {
+	st := p.Style
+	pp := para.Properties()
+	if isHeading(p) {
+		para.SetStyle(fmt.Sprintf("Heading%d", st.HeadingLevel))
+	}
+	switch st.Alignment {
+	case "left":
+		pp.SetAlignment(wml.ST_JcLeft)
+	case "center":
+		pp.SetAlignment(wml.ST_JcCenter)
+	case "right":
+		pp.SetAlignment(wml.ST_JcRight)
+	case "justify":
+		pp.SetAlignment(wml.ST_JcBoth)
+	}
+	if st.SpaceBeforePt > 0 {
+		pp.Spacing().SetBefore(measurement.Distance(st.SpaceBeforePt))
+	}
+	if st.SpaceAfterPt > 0 {
+		pp.Spacing().SetAfter(measurement.Distance(st.SpaceAfterPt))
+	}
+	if st.LineSpacingPt > 0 {
+		pp.Spacing().SetLineSpacing(measurement.Distance(st.LineSpacingPt), wml.ST_LineSpacingRuleAtLeast)
+	}
+	if st.IndentLeftPx > 0 {
+		pp.SetStartIndent(measurement.Distance(st.IndentLeftPx * pxToPt))
+	}
+	if st.IndentRightPx > 0 {
+		pp.SetEndIndent(measurement.Distance(st.IndentRightPx * pxToPt))
+	}
+	if p.PageBreakBefore {
+		pp.SetPageBreakBefore(true)
+	}
+	if st.ListType == "ordered" || st.ListType == "unordered" {
+		para.SetNumberingDefinitionByID(dw.list(listKey{st.ListID, st.ListType == "ordered"}))
+		para.SetNumberingLevel(min(max(st.ListLevel, 0), 8))
+	}
+
+	// Consecutive runs with the same target share one hyperlink.
+	p.Runs = revisedRuns(p.Runs, RevisionsAccept)
+	for i := 0; i < len(p.Runs); {
+		r := p.Runs[i]
+		if r.Bookmark != "" {
+			para.AddBookmark(r.Bookmark)
+			i++
+			continue
+		}
+		if r.Href == "" {
+			writeRun(para.AddRun(), r)
+			i++
+			continue
+		}
+		hl := para.AddHyperLink()
+		if anchor, ok := strings.CutPrefix(r.Href, "#"); ok {
+			hl.X().AnchorAttr = &anchor
+		} else {
+			hl.SetTarget(r.Href)
+		}
+		for ; i < len(p.Runs) && p.Runs[i].Href == r.Href && p.Runs[i].Bookmark == ""; i++ {
+			writeRun(hl.AddRun(), p.Runs[i])
+		}
+	}
+}
+
+// list returns the numbering instance of a list, creating its definition
+// on first use.
+func (dw *docWriter) list(k listKey) int64 {
+	if id, ok := dw.lists[k]; ok {
+		return id
+	}
+	nd := dw.doc.Numbering.AddDefinition()
+	nd.SetMultiLevelType(wml.ST_MultiLevelTypeHybridMultilevel)
+	for i := 0; i < 9; i++ {
+		lvl := nd.AddLevel()
+		if k.ordered {
+			lvl.SetFormat(wml.ST_NumberFormatDecimal)
+			lvl.SetText(fmt.Sprintf("%%%d.", i+1))
+		} else {
+			lvl.SetFormat(wml.ST_NumberFormatBullet)
+			lvl.SetText("•")
+		}
+		lvl.SetAlignment(wml.ST_JcLeft)
+		lvl.Properties().SetLeftIndent(measurement.Distance(36 * (i + 1)))
+		lvl.Properties().SetHangingIndent(measurement.Distance(18))
+	}
+	// AddDefinition adds the w:num instance last, with the same ID.
+	nums := dw.doc.Numbering.X().Num
+	id := nums[len(nums)-1].NumIdAttr
+	dw.lists[k] = id
+	return id
+}
+
+// writeRun writes the text and formatting of r into run.  Line breaks and
+// tabs in the text become w:br and w:tab.
+func writeRun(run document.Run, r RenderRun) {
+	rp := run.Properties()
+	s := r.Style
+	if s.FontFamily != "" {
+		rp.SetFontFamily(s.FontFamily)
+	}
+	if s.FontSizePt > 0 {
+		rp.SetSize(measurement.Distance(s.FontSizePt))
+	}
+	if s.FontColor != "" {
+		rp.SetColor(color.FromHex("#" + s.FontColor))
+	}
+	if s.Bold {
+		rp.SetBold(true)
+	}
+	if s.Italic {
+		rp.SetItalic(true)
+	}
+	if s.Underline {
+		rp.SetUnderline(wml.ST_UnderlineSingle, color.Auto)
+	}
+	if s.Strike {
+		rp.SetStrikeThrough(true)
+	}
+	if s.Hidden {
+		rp.X().Vanish = wml.NewCT_OnOff()
+	}
+	switch s.VerticalAlign {
+	case "superscript":
+		rp.SetVerticalAlignment(sharedTypes.ST_VerticalAlignRunSuperscript)
+	case "subscript":
+		rp.SetVerticalAlignment(sharedTypes.ST_VerticalAlignRunSubscript)
+	}
+
+	for i, line := range strings.Split(r.Text, "\n") {
+		if i > 0 {
+			run.AddBreak()
+		}
+		for j, seg := range strings.Split(line, "\t") {
+			if j > 0 {
+				run.AddTab()
+			}
+			if seg != "" {
+				run.AddText(seg)
+			}
+		}
+	}
+}
+
+// table writes t into tbl.  Cells covered by a row span are absent from
+// the model; they are written as vertically merged continuation cells.
+func (dw *docWriter) table(tbl document.Table, t RenderTable) {
+	b := tbl.Properties().Borders()
+	b.SetAll(wml.ST_BorderSingle, color.Auto, measurement.Distance(0.5))
+
+	type span struct{ rows, cols int }
+	pending := make(map[int]span) // grid column -> remaining rows of a vertical merge
+	for _, r := range t.Rows {
+		row := tbl.AddRow()
+		if r.HeightPx > 0 {
+			row.Properties().SetHeight(measurement.Distance(r.HeightPx*pxToPt), wml.ST_HeightRuleAtLeast)
+		}
+		if r.Header {
+			row.X().TrPr = wml.NewCT_TrPr()
+			row.X().TrPr.TblHeader = []*wml.CT_OnOff{wml.NewCT_OnOff()}
+		}
+		col := 0
+		continuation := func() {
+			for {
+				s, ok := pending[col]
+				if !ok {
+					return
+				}
+				cell := row.AddCell()
+				cell.Properties().SetVerticalMerge(wml.ST_MergeContinue)
+				if s.cols > 1 {
+					cell.Properties().SetColumnSpan(s.cols)
+				}
+				cell.AddParagraph()
+				if s.rows <= 1 {
+					delete(pending, col)
+				} else {
+					pending[col] = span{s.rows - 1, s.cols}
+				}
+				col += s.cols
+			}
+		}
+		for _, c := range r.Cells {
+			continuation()
+			cell := row.AddCell()
+			cp := cell.Properties()
+			cols := max(c.ColSpan, 1)
+			if cols > 1 {
+				cp.SetColumnSpan(cols)
+			}
+			if c.RowSpan > 1 {
+				cp.SetVerticalMerge(wml.ST_MergeRestart)
+				pending[col] = span{c.RowSpan - 1, cols}
+			}
+			if c.WidthPx > 0 {
+				cp.SetWidth(measurement.Distance(c.WidthPx * pxToPt))
+			}
+			if bg := c.Style.BackgroundColor; bg != "" {
+				cp.SetShading(wml.ST_ShdClear, color.Auto, color.FromHex("#"+bg))
+			}
+			switch c.Style.VerticalAlign {
+			case "top":
+				cp.SetVerticalAlignment(wml.ST_VerticalJcTop)
+			case "middle":
+				cp.SetVerticalAlignment(wml.ST_VerticalJcCenter)
+			case "bottom":
+				cp.SetVerticalAlignment(wml.ST_VerticalJcBottom)
+			}
+			for _, p := range c.Paragraphs {
+				dw.paragraph(cell.AddParagraph(), p)
+			}
+			if len(c.Paragraphs) == 0 {
+				cell.AddParagraph() // a cell must hold a paragraph
+			}
+			col += cols
+		}
+		continuation()
+	}
+}
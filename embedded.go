@@ -0,0 +1,157 @@
+package convert
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/aerissecure/convert/internal/cfb"
+	"github.com/aerissecure/convert/internal/safezip"
+)
+
+// -----------------------------------------------------------------------------
+// Embedded file extraction
+// -----------------------------------------------------------------------------
+//
+// ExtractEmbeddedFiles pulls the files embedded in an OPC package out of
+// it, for scanning or converting them separately.  Office stores them below
+// an embeddings folder, either as they are (an embedded workbook is an
+// .xlsx part) or wrapped in an OLE compound file.  The common OLE wrappers
+// are unpacked: a packaged file (Ole10Native) yields the file under its
+// original name, an embedded Office 2007+ document its package and an
+// Acrobat document its PDF.  Other compound files are returned as stored.
+
+// Attachment is a file embedded in a document.
+type Attachment struct {
+	Part        string // package part holding it, e.g. "word/embeddings/oleObject1.bin"
+	Name        string // original file name where known, else derived from Part
+	ContentType string
+	Data        []byte
+}
+
+// ExtractEmbeddedFiles returns the files embedded in r, in package order.
+// DOCX, DOCM, XLSX, XLSM and PPTX input is searched; other formats have
+// no embedded files, and formats DetectFormat cannot identify and
+// encrypted files yield the error of their Report.  Parts are read through
+// the safezip checks the converters apply, so a damaged or oversized
+// package fails as ToHTML does.
+func ExtractEmbeddedFiles(r io.ReaderAt, size int64) ([]Attachment, error) {
+	rep, err := DetectFormat(r, size)
+	if err != nil {
+		return nil, err
+	}
+	switch rep.Format {
+	case FormatDOCX, FormatDOCM, FormatXLSX, FormatXLSM, FormatPPTX:
+	default:
+		if rep.Encrypted || rep.Format == FormatUnknown {
+			return nil, rep.Err()
+		}
+		return nil, nil
+	}
+	zr, err := safezip.NewReader(r, size)
+	if err != nil {
+		return nil, parseError(rep.Format, err)
+	}
+	var types *zip.File
+	for _, f := range zr.File {
+		if f.Name == "[Content_Types].xml" {
+			types = f
+		}
+	}
+	contentType := packageContentTypes(types)
+	var files []Attachment
+	for _, f := range zr.File {
+		if !strings.Contains(f.Name, "/embeddings/") || strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, parseError(rep.Format, err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, parseError(rep.Format, err)
+		}
+		a := Attachment{Part: f.Name, Name: path.Base(f.Name), ContentType: contentType(f.Name), Data: data}
+		if cfb.IsCFB(data) {
+			unwrapOLE(&a)
+		}
+		files = append(files, a)
+	}
+	return files, nil
+}
+
+// unwrapOLE replaces the compound file in a with the file it wraps, if it
+// is of a kind that wraps one.
+func unwrapOLE(a *Attachment) {
+	f, err := cfb.Open(bytes.NewReader(a.Data), int64(len(a.Data)))
+	if err != nil {
+		return
+	}
+	base := strings.TrimSuffix(a.Name, path.Ext(a.Name))
+	if native, err := f.ReadStream("\x01Ole10Native"); err == nil {
+		name, data := ole10Native(native)
+		if data == nil {
+			return // truncated
+		}
+		if name == "" {
+			name = base
+		}
+		a.Name, a.Data = name, data
+		a.ContentType = extContentType(path.Ext(name))
+		return
+	}
+	if pkg, err := f.ReadStream("Package"); err == nil {
+		rep, _ := DetectFormat(bytes.NewReader(pkg), int64(len(pkg)))
+		if ext := formatExt(rep.Format); ext != "" {
+			a.Name, a.Data = base+ext, pkg
+			a.ContentType = extContentType(ext)
+		}
+		return
+	}
+	if contents, err := f.ReadStream("CONTENTS"); err == nil && bytes.HasPrefix(contents, []byte("%PDF-")) {
+		a.Name, a.Data = base+".pdf", contents
+		a.ContentType = "application/pdf"
+	}
+}
+
+// formatExt returns the file extension of an Office 2007+ format, "" for
+// the others.
+func formatExt(f Format) string {
+	switch f {
+	case FormatDOCX, FormatDOCM, FormatXLSX, FormatXLSM, FormatPPTX:
+		return "." + strings.ToLower(f.String())
+	}
+	return ""
+}
+
+// extContentType returns the content type of files with extension ext,
+// e.g. ".pdf".
+func extContentType(ext string) string {
+	switch strings.ToLower(ext) {
+	case ".docx":
+		return "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	case ".docm":
+		return "application/vnd.ms-word.document.macroEnabled.12"
+	case ".xlsx":
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case ".xlsm":
+		return "application/vnd.ms-excel.sheet.macroEnabled.12"
+	case ".pptx":
+		return "application/vnd.openxmlformats-officedocument.presentationml.presentation"
+	case ".doc":
+		return "application/msword"
+	case ".xls":
+		return "application/vnd.ms-excel"
+	case ".ppt":
+		return "application/vnd.ms-powerpoint"
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
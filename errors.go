@@ -0,0 +1,173 @@
+package convert
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"runtime/debug"
+
+	"github.com/aerissecure/convert/diag"
+	"github.com/aerissecure/convert/docx"
+	"github.com/aerissecure/convert/internal/cfb"
+	"github.com/aerissecure/convert/internal/safezip"
+	"github.com/aerissecure/convert/xlsx"
+)
+
+// -----------------------------------------------------------------------------
+// Errors
+// -----------------------------------------------------------------------------
+//
+// Conversion failures a service would answer differently are told apart with
+// errors.Is against the sentinels below; errors.As with *FormatError,
+// *CorruptError and *LimitError gives their context.  As a rough guide:
+//
+//	ErrUnsupportedFormat  415 Unsupported Media Type
+//	ErrEncrypted          415, asking for an unprotected copy
+//	ErrCorruptArchive     422 Unprocessable Entity
+//	ErrTooLarge           413 Content Too Large
+//	ErrPoolFull           503 Service Unavailable
+
+var (
+	// ErrUnsupportedFormat matches every *FormatError: input that is not
+	// one of the supported formats, or that is but cannot be converted.
+	ErrUnsupportedFormat = errors.New("convert: unsupported format")
+	// ErrEncrypted matches encrypted input.  It is docx.ErrEncrypted, so
+	// either can be tested for.
+	ErrEncrypted = docx.ErrEncrypted
+	// ErrPasswordRequired matches input encrypted with a password, as
+	// opposed to rights-managed (IRM) documents, which need a licence from
+	// their rights server instead.
+	ErrPasswordRequired = errors.New("convert: password required")
+	// ErrCorruptArchive matches every *CorruptError.
+	ErrCorruptArchive = errors.New("convert: corrupt archive")
+	// ErrTooLarge matches every *LimitError.
+	ErrTooLarge = errors.New("convert: input too large")
+	// ErrPoolFull is returned by Pool.ToHTML when its queue is full.
+	ErrPoolFull = errors.New("convert: conversion pool full")
+)
+
+// FormatError reports input that cannot be converted because of its
+// format.  It matches ErrUnsupportedFormat, and ErrEncrypted when Encrypted
+// is set.
+type FormatError struct {
+	Format    Format // FormatUnknown if not recognized
+	Detail    string // what was found, e.g. "PowerPoint presentation"
+	Encrypted bool
+	Err       error // ErrPasswordRequired, docx.ErrLegacyFormat or nil
+}
+
+func (e *FormatError) Error() string {
+	msg := ErrUnsupportedFormat.Error()
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *FormatError) Unwrap() error { return e.Err }
+
+func (e *FormatError) Is(target error) bool {
+	return target == ErrUnsupportedFormat || target == ErrEncrypted && e.Encrypted
+}
+
+// CorruptError reports a damaged ZIP package or compound file, or a part
+// in it that cannot be decoded.  It matches ErrCorruptArchive.
+type CorruptError struct {
+	Format Format // FormatUnknown if the container could not be read
+	Part   string // the ZIP entry, stream or sheet, empty if not known
+	Ref    string // the cell or block within Part, empty if not known
+	Err    error
+}
+
+func (e *CorruptError) Error() string {
+	msg := ErrCorruptArchive.Error()
+	if e.Part != "" {
+		msg += ": " + e.Part
+	}
+	if e.Ref != "" {
+		msg += " " + e.Ref
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *CorruptError) Unwrap() error { return e.Err }
+
+func (e *CorruptError) Is(target error) bool { return target == ErrCorruptArchive }
+
+// PanicError is the Err of a *CorruptError for input that made a parser
+// panic, and the error of a conversion that panicked while rendering or
+// elsewhere; see Options.FailFast.
+type PanicError struct {
+	Value any    // the panic value
+	Stack []byte // the stack where it was raised
+}
+
+func (e *PanicError) Error() string { return fmt.Sprintf("panic: %v", e.Value) }
+
+// LimitError reports input exceeding a configured limit.  It matches
+// ErrTooLarge.
+type LimitError struct {
+	Limit string // the limit hit, e.g. "MaxSize" or "MaxRatio"
+	Max   int64  // its value
+	Part  string // the part that exceeded it, empty for the whole input
+}
+
+func (e *LimitError) Error() string {
+	msg := fmt.Sprintf("%s: %s of %d exceeded", ErrTooLarge, e.Limit, e.Max)
+	if e.Part != "" {
+		msg += " by " + e.Part
+	}
+	return msg
+}
+
+func (e *LimitError) Is(target error) bool { return target == ErrTooLarge }
+
+// recoverParse, deferred, turns a panic in the parser for format f into a
+// *CorruptError in *err, for parsers such as a custom WorkbookBackend.
+// The built-in parsers return theirs as a *diag.PanicError instead, which
+// parseError turns into the same.
+func recoverParse(f Format, err *error) {
+	if v := recover(); v != nil {
+		*err = &CorruptError{Format: f, Err: &PanicError{Value: v, Stack: debug.Stack()}}
+	}
+}
+
+// recoverRender, deferred, turns a panic while rendering into a
+// *PanicError in *err.
+func recoverRender(err *error) {
+	if v := recover(); v != nil {
+		*err = &PanicError{Value: v, Stack: debug.Stack()}
+	}
+}
+
+// parseError classifies an error of the parser for format f, turning the
+// safezip limit errors into a *LimitError and the signs of a damaged file
+// into a *CorruptError.
+func parseError(f Format, err error) error {
+	var limit *safezip.LimitError
+	var part *xlsx.PartError
+	var syntax *xml.SyntaxError
+	var panicked *diag.PanicError
+	switch {
+	case errors.As(err, &panicked):
+		return &CorruptError{Format: f, Part: panicked.Part, Ref: panicked.Ref, Err: &PanicError{Value: panicked.Value, Stack: panicked.Stack}}
+	case errors.As(err, &limit):
+		return &LimitError{Limit: limit.Limit, Max: limit.Max, Part: limit.Part}
+	case errors.Is(err, safezip.ErrUnsafeName):
+		return &CorruptError{Format: f, Err: err}
+	case errors.As(err, &part):
+		return &CorruptError{Format: f, Part: part.Part, Err: part.Err}
+	case errors.Is(err, zip.ErrFormat), errors.Is(err, zip.ErrChecksum), errors.Is(err, zip.ErrAlgorithm),
+		errors.Is(err, cfb.ErrCorrupt), errors.Is(err, io.ErrUnexpectedEOF), errors.As(err, &syntax):
+		return &CorruptError{Format: f, Err: err}
+	}
+	return err
+}
@@ -0,0 +1,188 @@
+package convert
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aerissecure/convert/internal/cfb"
+)
+
+// -----------------------------------------------------------------------------
+// Pre-flight estimates
+// -----------------------------------------------------------------------------
+//
+// Estimate predicts how much work converting a file is without parsing it,
+// so a service can convert small files inline and queue large ones.  It
+// reads the container only: the sizes of the package parts or streams, the
+// dimension each worksheet declares at its start, and the number of images.
+// Cell and paragraph counts are extrapolated from the bytes a typical cell
+// or paragraph takes, so they are approximations in both directions, and
+// Cost is a rough guide for routing rather than the time a conversion will
+// take on any particular machine.
+
+// Bytes per cell and per paragraph in typical input, and the work per byte
+// of XML, per cell, per paragraph and per image that Cost adds up.
+const (
+	cellBytes         = 32  // <c r="B7" s="3"><v>42</v></c>
+	biffCellBytes     = 18  // NUMBER, LABELSST and RK records with their headers
+	paragraphBytes    = 600 // a paragraph of body text with its run properties
+	rtfParagraphBytes = 250
+	docParagraphBytes = 150 // the text and formatting of a Word 97 paragraph
+
+	costPerByte      = 20 * time.Nanosecond
+	costPerCell      = 4 * time.Microsecond
+	costPerParagraph = 40 * time.Microsecond
+	costPerImage     = 5 * time.Millisecond
+)
+
+// Complexity is the predicted size of a conversion.
+type Complexity struct {
+	Format     Format
+	Bytes      int64 // uncompressed size of the parts or streams to parse
+	Sheets     int
+	Cells      int64 // predicted non-blank cells of a workbook
+	Paragraphs int64 // predicted paragraphs of a document
+	Images     int   // images and embedded objects
+	Memory     int64 // memory the parsers need, as checked against MemoryBudget
+	Cost       time.Duration
+}
+
+// Estimate predicts the complexity of converting r.  Formats DetectFormat
+// cannot identify and encrypted files yield the error of their Report.
+func Estimate(r io.ReaderAt, size int64) (Complexity, error) {
+	rep, err := DetectFormat(r, size)
+	if err != nil {
+		return Complexity{}, err
+	}
+	if rep.Encrypted || rep.Format == FormatUnknown {
+		return Complexity{Format: rep.Format}, rep.Err()
+	}
+	c := Complexity{Format: rep.Format, Bytes: size, Memory: estimateMemory(r, size)}
+	switch rep.Format {
+	case FormatDOCX, FormatDOCM, FormatXLSX, FormatXLSM, FormatODT, FormatODS, FormatPPTX:
+		zr, err := zip.NewReader(r, size)
+		if err != nil {
+			return c, parseError(rep.Format, err)
+		}
+		c.estimatePackage(zr)
+	case FormatDOC, FormatXLS, FormatPPT:
+		f, err := cfb.Open(r, size)
+		if err != nil {
+			return c, parseError(rep.Format, err)
+		}
+		c.estimateCompound(f)
+	case FormatRTF:
+		c.Paragraphs = size / rtfParagraphBytes
+	}
+	c.Cost = time.Duration(c.Bytes)*costPerByte + time.Duration(c.Cells)*costPerCell +
+		time.Duration(c.Paragraphs)*costPerParagraph + time.Duration(c.Images)*costPerImage
+	return c, nil
+}
+
+// estimatePackage fills c from the parts of an OPC package.
+func (c *Complexity) estimatePackage(zr *zip.Reader) {
+	c.Bytes = 0
+	for _, f := range zr.File {
+		name, n := f.Name, int64(f.UncompressedSize64)
+		dir := path.Dir(name) + "/"
+		switch {
+		case strings.HasSuffix(dir, "/media/") || strings.HasSuffix(dir, "/embeddings/"):
+			c.Images++
+			continue // images are copied, not parsed
+		case strings.HasPrefix(name, "xl/worksheets/") && strings.HasSuffix(name, ".xml"):
+			c.Sheets++
+			cells := n / cellBytes
+			if area, ok := declaredArea(f); ok {
+				cells = min(cells, area)
+			}
+			c.Cells += cells
+		case name == "word/document.xml" || strings.HasPrefix(name, "word/header") || strings.HasPrefix(name, "word/footer") ||
+			name == "word/footnotes.xml" || name == "word/endnotes.xml":
+			c.Paragraphs += n / paragraphBytes
+		}
+		c.Bytes += n
+	}
+}
+
+// estimateCompound fills c from the streams of a compound file.
+func (c *Complexity) estimateCompound(f *cfb.File) {
+	if e, ok := f.Stat("Workbook"); ok {
+		c.Cells = e.Size / biffCellBytes
+		c.Sheets = 1
+		if wb, err := f.ReadStream("Workbook"); err == nil {
+			c.Sheets = max(countBoundSheets(wb), 1)
+		}
+	}
+	if e, ok := f.Stat("WordDocument"); ok {
+		c.Paragraphs = e.Size / docParagraphBytes
+	}
+	for _, e := range f.Entries() {
+		dir, base := path.Split(e.Path)
+		if e.Storage && (dir == "" && strings.HasPrefix(base, "MBD") || strings.EqualFold(dir, "ObjectPool/")) {
+			c.Images++
+		}
+	}
+}
+
+// countBoundSheets counts the worksheets of a BIFF8 workbook stream, from
+// its BOUNDSHEET records.
+func countBoundSheets(b []byte) int {
+	sheets := 0
+	for pos := 0; pos+4 <= len(b); {
+		id := binary.LittleEndian.Uint16(b[pos:])
+		n := int(binary.LittleEndian.Uint16(b[pos+2:]))
+		data := b[pos+4 : min(pos+4+n, len(b))]
+		pos += 4 + n
+		switch id {
+		case 0x0085: // BOUNDSHEET
+			if len(data) >= 6 && data[5] == 0x00 {
+				sheets++
+			}
+		case 0x000A: // EOF of the globals substream
+			return sheets
+		}
+	}
+	return sheets
+}
+
+// dimensionRef matches the dimension element near the start of a
+// worksheet part.
+var dimensionRef = regexp.MustCompile(`<(?:\w+:)?dimension\s+ref="([A-Z]{1,3})(\d{1,7})(?::([A-Z]{1,3})(\d{1,7}))?"`)
+
+// declaredArea returns the number of cells in the range a worksheet part
+// declares it uses, reading only its first few kilobytes.
+func declaredArea(f *zip.File) (int64, bool) {
+	m := dimensionRef.FindSubmatch(readEntry(f, 4<<10))
+	if m == nil {
+		return 0, false
+	}
+	r1, c1 := atoi(m[2]), columnNumber(m[1])
+	r2, c2 := r1, c1
+	if len(m[3]) > 0 {
+		r2, c2 = atoi(m[4]), columnNumber(m[3])
+	}
+	return (max(r1, r2) - min(r1, r2) + 1) * (max(c1, c2) - min(c1, c2) + 1), true
+}
+
+// columnNumber returns the 1-based number of column letters such as "AB".
+func columnNumber(b []byte) int64 {
+	var n int64
+	for _, c := range b {
+		n = n*26 + int64(c-'A'+1)
+	}
+	return n
+}
+
+// atoi parses the decimal digits of b.
+func atoi(b []byte) int64 {
+	var n int64
+	for _, c := range b {
+		n = n*10 + int64(c-'0')
+	}
+	return n
+}
@@ -0,0 +1,106 @@
+// Package fonts maps the fonts Office documents name to CSS font-family
+// stacks that still render close to the original where those fonts are not
+// installed, which is most browsers outside Windows.  Each font is followed
+// by its metric-compatible open replacements (Carlito for Calibri, Liberation
+// Sans for Arial, …) so line breaks and column widths hold, and the stack
+// ends with the generic family of the first font that has one.
+//
+// The DOCX and XLSX renderers emit every font-family through a Substitutes
+// map, Default unless their RenderOptions name another.
+package fonts
+
+import (
+	"strings"
+
+	"github.com/aerissecure/convert/internal/csssafe"
+)
+
+// Substitutes maps a font name to the fonts to try in its place, in order.
+// Lookups ignore case.  A generic family (sans-serif, serif, monospace, …)
+// among them is moved to the end of the stack.
+type Substitutes map[string][]string
+
+// Default substitutes the fonts Office uses by default and the common core
+// fonts.
+var Default = Substitutes{
+	"Aptos":           {"Calibri", "Carlito", "sans-serif"},
+	"Arial":           {"Liberation Sans", "Arimo", "Helvetica", "sans-serif"},
+	"Calibri":         {"Carlito", "sans-serif"},
+	"Calibri Light":   {"Carlito", "sans-serif"},
+	"Cambria":         {"Caladea", "serif"},
+	"Century Gothic":  {"URW Gothic", "sans-serif"},
+	"Consolas":        {"Menlo", "Liberation Mono", "monospace"},
+	"Courier New":     {"Liberation Mono", "Cousine", "Courier", "monospace"},
+	"Garamond":        {"EB Garamond", "serif"},
+	"Georgia":         {"Gelasio", "serif"},
+	"MS Gothic":       {"Yu Gothic", "Hiragino Sans", "Noto Sans CJK JP", "sans-serif"},
+	"MS Mincho":       {"Yu Mincho", "Hiragino Mincho ProN", "Noto Serif CJK JP", "serif"},
+	"Segoe UI":        {"system-ui", "-apple-system", "Roboto", "Helvetica Neue", "Arial", "sans-serif"},
+	"SimSun":          {"Songti SC", "Noto Serif CJK SC", "serif"},
+	"Tahoma":          {"DejaVu Sans", "Verdana", "sans-serif"},
+	"Times New Roman": {"Liberation Serif", "Tinos", "Times", "serif"},
+	"Verdana":         {"DejaVu Sans", "sans-serif"},
+}
+
+// generic lists the CSS keywords that are emitted unquoted.
+var generic = map[string]bool{
+	"serif": true, "sans-serif": true, "monospace": true, "cursive": true, "fantasy": true,
+	"system-ui": true, "-apple-system": true, "ui-sans-serif": true, "ui-serif": true, "ui-monospace": true,
+}
+
+// last lists the generic families that end a stack; the others are
+// platform aliases that can stand anywhere.
+var last = map[string]bool{"serif": true, "sans-serif": true, "monospace": true, "cursive": true, "fantasy": true}
+
+// lookup returns the substitutes of name.  Of several keys matching it up
+// to case, the least wins, so the result does not vary with map iteration.
+func (s Substitutes) lookup(name string) []string {
+	if subs, ok := s[name]; ok {
+		return subs
+	}
+	var key string
+	var found []string
+	for k, subs := range s {
+		if strings.EqualFold(k, name) && (found == nil || k < key) {
+			key, found = k, subs
+		}
+	}
+	return found
+}
+
+// Stack returns the value of a CSS font-family declaration for families, in
+// order of preference, each followed by its substitutes.  Names are
+// sanitised with csssafe and quoted; duplicates and empty names are dropped.
+// It returns "" if no name remains.
+func (s Substitutes) Stack(families ...string) string {
+	var out []string
+	var end string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		name = csssafe.FontFamily(name)
+		key := strings.ToLower(name)
+		switch {
+		case name == "" || seen[key]:
+		case last[key]:
+			if end == "" {
+				end = key
+			}
+		case generic[key]:
+			seen[key] = true
+			out = append(out, key)
+		default:
+			seen[key] = true
+			out = append(out, "'"+name+"'")
+		}
+	}
+	for _, f := range families {
+		add(f)
+		for _, sub := range s.lookup(csssafe.FontFamily(f)) {
+			add(sub)
+		}
+	}
+	if end != "" {
+		out = append(out, end)
+	}
+	return strings.Join(out, ",")
+}
@@ -0,0 +1,24 @@
+package fonts
+
+import "testing"
+
+func TestStack(t *testing.T) {
+	for _, tt := range []struct {
+		subs     Substitutes
+		families []string
+		want     string
+	}{
+		{Default, []string{"Calibri"}, "'Calibri','Carlito',sans-serif"},
+		{Default, []string{"calibri", "Cambria"}, "'calibri','Carlito','Cambria','Caladea',sans-serif"},
+		{Default, []string{"Segoe UI"}, "'Segoe UI',system-ui,-apple-system,'Roboto','Helvetica Neue','Arial',sans-serif"},
+		{Default, []string{"Unknown Font", ""}, "'Unknown Font'"},
+		{Default, []string{"Evil';}body{x:'"}, "'Evilbodyx'"},
+		{Substitutes{}, []string{"Calibri", "Calibri"}, "'Calibri'"},
+		{Substitutes{"FOO": {"B"}, "Foo": {"A"}}, []string{"foo"}, "'foo','B'"},
+		{nil, nil, ""},
+	} {
+		if got := tt.subs.Stack(tt.families...); got != tt.want {
+			t.Errorf("Stack(%q) = %q, want %q", tt.families, got, tt.want)
+		}
+	}
+}
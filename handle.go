@@ -0,0 +1,142 @@
+package convert
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/aerissecure/convert/diag"
+	"github.com/aerissecure/convert/docx"
+	"github.com/aerissecure/convert/xlsx"
+)
+
+// -----------------------------------------------------------------------------
+// Parsed handles
+// -----------------------------------------------------------------------------
+//
+// Open parses input once into a Handle, which renders it any number of
+// times with different options, from any number of goroutines at once: a
+// preview service keeps the handle of an open file instead of converting
+// the file again for every tab the viewer switches to.  The parsed model
+// is never modified after Open; selecting sheets and ranges
+// (xlsx.RenderOptions.Sheets and Range, see WithSheets and WithRange)
+// shares its cells rather than cutting them out of it.
+//
+// The options are split between the two: MaxSize, MemoryBudget, MaxCells,
+// WorkbookBackend, FailFast, Sanitize and Parts apply when parsing and are
+// ignored when rendering, the others when rendering.  Options.Cache is not
+// used.
+
+// Handle is parsed input, ready to be rendered.  It is safe for concurrent
+// use.
+type Handle struct {
+	format    Format
+	doc       *docx.DocumentModel // for word-processing input
+	book      *xlsx.WorkbookModel // for spreadsheet input
+	sanitized bool
+	warnings  []diag.Warning
+}
+
+// Open parses r with the parse-time options of opts, adding the problems
+// the parser worked around to opts.Warnings if set.  It fails as ToHTML
+// does.
+func Open(r io.ReaderAt, size int64, opts Options) (*Handle, error) {
+	if opts.MaxSize > 0 && size > opts.MaxSize {
+		return nil, &LimitError{Limit: "MaxSize", Max: opts.MaxSize}
+	}
+	rep, err := detect(r, size, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := rep.Err(); err != nil {
+		return nil, err
+	}
+	if opts.MemoryBudget > 0 && estimateMemory(r, size) > opts.MemoryBudget {
+		return nil, &LimitError{Limit: "MemoryBudget", Max: opts.MemoryBudget}
+	}
+	return parseFormat(r, size, rep, opts)
+}
+
+// Format returns the format of the input.
+func (h *Handle) Format() Format { return h.format }
+
+// SheetNames returns the names of the sheets of a workbook, nil for a
+// document.
+func (h *Handle) SheetNames() []string {
+	if h.book == nil {
+		return nil
+	}
+	names := make([]string, len(h.book.Sheets))
+	for i, sheet := range h.book.Sheets {
+		names[i] = sheet.Name
+	}
+	return names
+}
+
+// Warnings returns the problems the parser worked around.
+func (h *Handle) Warnings() []diag.Warning {
+	return append([]diag.Warning(nil), h.warnings...)
+}
+
+// HTML renders the input with the render-time options of opts.  Naming a
+// sheet the workbook does not have fails with xlsx.ErrNoSheet.
+func (h *Handle) HTML(opts Options) (string, error) {
+	opts.MemoryBudget = 0
+	limit, name := outputLimit(opts, 0)
+	html, err := h.render(opts, limit, name, nil)
+	if err != nil || !opts.Strict {
+		return html, err
+	}
+	return strictOutput(html, opts, limit, name)
+}
+
+// Text returns the plain text of the input, as Output.Text; for a workbook
+// only that of the sheets and range opts selects.
+func (h *Handle) Text(opts Options) (string, error) {
+	if h.doc != nil {
+		return docx.DocumentText(*h.doc), nil
+	}
+	shown, err := xlsx.Select(*h.book, opts.Workbook.Sheets, opts.Workbook.Range)
+	if err != nil {
+		return "", err
+	}
+	var out Output
+	workbookOutput(&out, *h.book, shown, opts)
+	return out.Text, nil
+}
+
+// render renders h, applying the output limit named name of limit bytes if
+// that is set.  If out is set, the plain text and the statistics of the
+// Metadata are stored in it too.
+func (h *Handle) render(opts Options, limit int64, name string, out *Output) (_ string, err error) {
+	if !opts.FailFast {
+		defer recoverRender(&err)
+	}
+	if h.doc != nil {
+		if out != nil && h.format == FormatRTF && !h.sanitized {
+			documentMetadata(&out.Metadata, h.doc.Properties)
+		}
+		return renderDocument(*h.doc, opts, limit, name, out)
+	}
+	m, err := xlsx.Select(*h.book, opts.Workbook.Sheets, opts.Workbook.Range)
+	if err != nil {
+		return "", err
+	}
+	opts.Workbook.Sheets, opts.Workbook.Range = nil, ""
+	if out != nil {
+		workbookOutput(out, *h.book, m, opts)
+	}
+	var b strings.Builder
+	var w io.Writer = &b
+	if limit > 0 {
+		w = &limitWriter{w: &b, max: limit}
+	}
+	err = xlsx.RenderWorkbookHTMLTo(w, m, opts.Workbook)
+	if errors.Is(err, errOutputLimit) {
+		return limitOutput(b.String(), true, limit, name, opts)
+	}
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
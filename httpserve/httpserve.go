@@ -0,0 +1,328 @@
+// Package httpserve serves HTML previews of office documents over HTTP.
+// Handler converts uploaded files, or files fetched by name from a Source,
+// with convert.ToHTML and serves the result with headers that confine it:
+// a restrictive Content-Security-Policy that blocks scripts and remote
+// loads, so previews can be shown in a sandboxed iframe on another page.
+// Results are cached by content hash.
+package httpserve
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aerissecure/convert"
+)
+
+// Defaults for the zero fields of Handler.
+const (
+	DefaultMaxSize   = 32 << 20
+	DefaultTimeout   = 30 * time.Second
+	DefaultCacheSize = 64
+)
+
+// contentSecurity is the CSP of every preview, completed with the
+// frame-ancestors list.  Converted documents only ever reference inline
+// styles and data: URIs.
+const contentSecurity = "default-src 'none'; img-src data:; style-src 'unsafe-inline'; font-src data:; " +
+	"base-uri 'none'; form-action 'none'; sandbox; frame-ancestors "
+
+// Source fetches documents by name for GET requests.
+type Source interface {
+	Fetch(ctx context.Context, name string) ([]byte, error)
+}
+
+// FS returns a Source reading names from fsys.  A missing file results in
+// 404 Not Found.
+func FS(fsys fs.FS) Source {
+	return fsSource{fsys}
+}
+
+type fsSource struct{ fsys fs.FS }
+
+func (s fsSource) Fetch(ctx context.Context, name string) ([]byte, error) {
+	return s.fetchLimited(ctx, name, -1)
+}
+
+// fetchLimited reads name, failing with errTooLarge before reading a file
+// over max bytes unless max is negative.
+func (s fsSource) fetchLimited(ctx context.Context, name string, max int64) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, fs.ErrNotExist
+	}
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if max < 0 {
+		return io.ReadAll(f)
+	}
+	if fi, err := f.Stat(); err != nil {
+		return nil, err
+	} else if fi.Size() > max {
+		return nil, errTooLarge
+	}
+	// The file may have grown since.
+	data, err := io.ReadAll(io.LimitReader(f, max+1))
+	if err == nil && int64(len(data)) > max {
+		return nil, errTooLarge
+	}
+	return data, err
+}
+
+// limitedSource is a Source that can refuse a document over max bytes
+// without reading it, as FS does.
+type limitedSource interface {
+	fetchLimited(ctx context.Context, name string, max int64) ([]byte, error)
+}
+
+// errTooLarge reports a document over MaxSize.
+var errTooLarge = errors.New("httpserve: document too large")
+
+// Handler converts documents to HTML previews.
+//
+// POST requests carry the document either as the raw request body or as the
+// "file" field of a multipart form.  GET requests name a document to fetch
+// from Source with the "name" query parameter; without a Source they are
+// rejected.  Unsupported and encrypted input is answered with 415
+// Unsupported Media Type, input over MaxSize or another limit with 413,
+// damaged input with 422 Unprocessable Entity, and conversions exceeding
+// Timeout with 504.  Error responses carry fixed messages, never text from
+// the document or the parsers.
+//
+// Conversions run in a convert.Pool of MaxConcurrent slots; requests wait
+// for a slot within their Timeout.  A conversion cannot be interrupted, so
+// one that times out keeps its slot until it finishes.
+type Handler struct {
+	// Source, when set, serves GET requests.
+	Source Source
+	// Options is passed to convert.ToHTML.  Previews are normally
+	// standalone, so Options.Document.Standalone is usually wanted.
+	Options convert.Options
+	// MaxSize bounds the size of a document in bytes; zero means
+	// DefaultMaxSize.
+	MaxSize int64
+	// Timeout bounds fetching, waiting for a slot and converting a
+	// document; zero means DefaultTimeout.
+	Timeout time.Duration
+	// MaxConcurrent is the number of conversions run at once; zero means
+	// GOMAXPROCS.
+	MaxConcurrent int
+	// CacheSize is the number of converted documents kept; zero means
+	// DefaultCacheSize and a negative value disables caching.
+	CacheSize int
+	// FrameAncestors is the CSP frame-ancestors source list naming the
+	// pages allowed to frame previews; empty means "'self'".
+	FrameAncestors string
+
+	once  sync.Once
+	cache *lru
+	pool  *convert.Pool
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.once.Do(func() {
+		size := h.CacheSize
+		if size == 0 {
+			size = DefaultCacheSize
+		}
+		h.cache = newLRU(size)
+		h.pool = convert.NewPool(convert.PoolConfig{Options: h.Options, MaxConcurrent: h.MaxConcurrent})
+	})
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	data, status, err := h.input(ctx, w, r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	html, ok := h.cache.get(etag)
+	if !ok {
+		html, status, err = h.convert(ctx, data)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		h.cache.add(etag, html)
+	}
+
+	ancestors := h.FrameAncestors
+	if ancestors == "" {
+		ancestors = "'self'"
+	}
+	hdr := w.Header()
+	hdr.Set("Content-Type", "text/html; charset=utf-8")
+	hdr.Set("Content-Security-Policy", contentSecurity+ancestors)
+	hdr.Set("X-Content-Type-Options", "nosniff")
+	hdr.Set("Referrer-Policy", "no-referrer")
+	hdr.Set("Cache-Control", "private, no-cache")
+	hdr.Set("ETag", etag)
+	io.WriteString(w, html)
+}
+
+// input reads the document of a request, returning the HTTP status to
+// answer with on error.
+func (h *Handler) input(ctx context.Context, w http.ResponseWriter, r *http.Request) ([]byte, int, error) {
+	limit := h.MaxSize
+	if limit <= 0 {
+		limit = DefaultMaxSize
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		name := r.URL.Query().Get("name")
+		if h.Source == nil || name == "" {
+			return nil, http.StatusBadRequest, errors.New("httpserve: no document named")
+		}
+		var data []byte
+		var err error
+		if s, ok := h.Source.(limitedSource); ok {
+			data, err = s.fetchLimited(ctx, name, limit)
+		} else {
+			data, err = h.Source.Fetch(ctx, name)
+		}
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			return nil, http.StatusNotFound, errors.New("httpserve: document not found")
+		case errors.Is(err, errTooLarge):
+			return nil, http.StatusRequestEntityTooLarge, errTooLarge
+		case err != nil:
+			return nil, http.StatusBadGateway, errors.New("httpserve: fetching document failed")
+		case int64(len(data)) > limit:
+			return nil, http.StatusRequestEntityTooLarge, errTooLarge
+		}
+		return data, 0, nil
+
+	case http.MethodPost:
+		// Leave room for the multipart framing around the file.
+		r.Body = http.MaxBytesReader(w, r.Body, limit+1<<20)
+		var body io.Reader = r.Body
+		if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); strings.HasPrefix(mt, "multipart/") {
+			mr, err := r.MultipartReader()
+			if err != nil {
+				return nil, http.StatusBadRequest, errors.New("httpserve: malformed form")
+			}
+			for {
+				part, err := mr.NextPart()
+				if err != nil {
+					return nil, http.StatusBadRequest, errors.New("httpserve: no file in form")
+				}
+				if part.FormName() == "file" {
+					body = part
+					break
+				}
+			}
+		}
+		data, err := io.ReadAll(io.LimitReader(body, limit+1))
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge), int64(len(data)) > limit:
+			return nil, http.StatusRequestEntityTooLarge, errTooLarge
+		case err != nil:
+			return nil, http.StatusBadRequest, errors.New("httpserve: reading the document failed")
+		}
+		return data, 0, nil
+	}
+	w.Header().Set("Allow", "GET, HEAD, POST")
+	return nil, http.StatusMethodNotAllowed, errors.New("httpserve: method not allowed")
+}
+
+// convert converts data in the pool within the deadline of ctx.  The
+// conversion itself cannot be interrupted; on timeout its result is
+// discarded.  The error returned is one of fixed messages, as the errors
+// of the parsers may quote the document.
+func (h *Handler) convert(ctx context.Context, data []byte) (string, int, error) {
+	html, err := h.pool.ToHTML(ctx, bytes.NewReader(data), int64(len(data)))
+	switch {
+	case err == nil:
+		return html, 0, nil
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return "", http.StatusGatewayTimeout, errors.New("httpserve: conversion timed out")
+	case errors.Is(err, convert.ErrPoolFull):
+		return "", http.StatusServiceUnavailable, errors.New("httpserve: too many conversions")
+	case errors.Is(err, convert.ErrUnsupportedFormat):
+		return "", http.StatusUnsupportedMediaType, errors.New("httpserve: unsupported document format")
+	case errors.Is(err, convert.ErrTooLarge):
+		return "", http.StatusRequestEntityTooLarge, errTooLarge
+	}
+	return "", http.StatusUnprocessableEntity, errors.New("httpserve: document could not be converted")
+}
+
+// -----------------------------------------------------------------------------
+// Cache
+// -----------------------------------------------------------------------------
+
+// lru is a fixed-size least-recently-used cache of converted documents.
+// A nil *lru caches nothing.
+type lru struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List // of *lruEntry, most recent first
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	key, html string
+}
+
+func newLRU(size int) *lru {
+	if size < 0 {
+		return nil
+	}
+	return &lru{size: size, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *lru) get(key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return "", false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*lruEntry).html, true
+}
+
+func (c *lru) add(key, html string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.order.MoveToFront(e)
+		return
+	}
+	c.items[key] = c.order.PushFront(&lruEntry{key, html})
+	for c.order.Len() > c.size {
+		last := c.order.Back()
+		c.order.Remove(last)
+		delete(c.items, last.Value.(*lruEntry).key)
+	}
+}
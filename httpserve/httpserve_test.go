@@ -0,0 +1,79 @@
+package httpserve
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestHandler(t *testing.T) {
+	const doc = `{\rtf1\ansi preview text\par}`
+	h := &Handler{
+		Source: FS(fstest.MapFS{
+			"a.rtf":   {Data: []byte(doc)},
+			"big.rtf": {Data: bytes.Repeat([]byte("x"), 2048)},
+		}),
+		MaxSize:       1024,
+		MaxConcurrent: 1,
+	}
+	do := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(httptest.NewRequest("POST", "/", strings.NewReader(doc)))
+	if rec.Code != 200 || !strings.Contains(rec.Body.String(), "preview text") {
+		t.Fatalf("POST: %d %q", rec.Code, rec.Body)
+	}
+	if csp := rec.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "default-src 'none'") {
+		t.Errorf("CSP = %q", csp)
+	}
+	etag := rec.Header().Get("ETag")
+	if _, ok := h.cache.get(etag); !ok {
+		t.Error("result not cached")
+	}
+
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	fw, _ := mw.CreateFormFile("file", "a.rtf")
+	fw.Write([]byte(doc))
+	mw.Close()
+	req := httptest.NewRequest("POST", "/", &form)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	if rec := do(req); rec.Code != 200 || rec.Header().Get("ETag") != etag {
+		t.Errorf("multipart POST: %d %q", rec.Code, rec.Body)
+	}
+
+	req = httptest.NewRequest("GET", "/?name=a.rtf", nil)
+	req.Header.Set("If-None-Match", etag)
+	if rec := do(req); rec.Code != http.StatusNotModified {
+		t.Errorf("conditional GET: %d", rec.Code)
+	}
+
+	for _, tc := range []struct {
+		req  *http.Request
+		code int
+	}{
+		{httptest.NewRequest("GET", "/?name=missing.rtf", nil), http.StatusNotFound},
+		{httptest.NewRequest("GET", "/?name=../a.rtf", nil), http.StatusNotFound},
+		{httptest.NewRequest("GET", "/?name=big.rtf", nil), http.StatusRequestEntityTooLarge},
+		{httptest.NewRequest("POST", "/", strings.NewReader("plain text")), http.StatusUnsupportedMediaType},
+		{httptest.NewRequest("POST", "/", strings.NewReader(strings.Repeat("x", 2048))), http.StatusRequestEntityTooLarge},
+		{httptest.NewRequest("PUT", "/", nil), http.StatusMethodNotAllowed},
+	} {
+		if rec := do(tc.req); rec.Code != tc.code {
+			t.Errorf("%s %s: %d, want %d", tc.req.Method, tc.req.URL, rec.Code, tc.code)
+		}
+	}
+
+	// Errors of the parsers are not passed on.
+	rec = do(httptest.NewRequest("POST", "/", strings.NewReader("PK\x03\x04"+strings.Repeat("x", 100))))
+	if rec.Code != http.StatusUnprocessableEntity || !strings.HasPrefix(rec.Body.String(), "httpserve: ") {
+		t.Errorf("damaged input: %d %q", rec.Code, rec.Body)
+	}
+}
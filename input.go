@@ -0,0 +1,98 @@
+package convert
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// -----------------------------------------------------------------------------
+// File and stream input
+// -----------------------------------------------------------------------------
+//
+// The converters need random access, so input that only comes as an
+// io.Reader is buffered first: in memory while small, in a temporary file
+// removed after the conversion once it outgrows spoolMemory.  Options.MaxSize
+// caps what is read, DefaultMaxSize when unset, since a stream gives no size
+// up front.
+
+// DefaultMaxSize is the input size limit of ReaderToHTML and ConvertReader
+// when Options.MaxSize is zero.
+const DefaultMaxSize = 256 << 20
+
+// spoolMemory is the largest input buffered in memory.
+const spoolMemory = 16 << 20
+
+// FileToHTML is ToHTML for the file at path.
+func FileToHTML(path string, opts Options) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	return ToHTML(f, fi.Size(), opts)
+}
+
+// ReaderToHTML is ToHTML for input read from r, up to opts.MaxSize bytes.
+func ReaderToHTML(r io.Reader, opts Options) (string, error) {
+	max := opts.MaxSize
+	if max <= 0 {
+		max = DefaultMaxSize
+	}
+	ra, size, done, err := spool(r, max)
+	if err != nil {
+		return "", err
+	}
+	defer done()
+	return ToHTML(ra, size, opts)
+}
+
+// ConvertFile is FileToHTML configured with functional options.
+func ConvertFile(path string, opts ...Option) (string, error) {
+	return FileToHTML(path, NewOptions(opts...))
+}
+
+// ConvertReader is ReaderToHTML configured with functional options.
+func ConvertReader(r io.Reader, opts ...Option) (string, error) {
+	return ReaderToHTML(r, NewOptions(opts...))
+}
+
+// spool buffers r for random access, failing with a *LimitError once it
+// exceeds max bytes.  done releases the buffer.
+func spool(r io.Reader, max int64) (ra io.ReaderAt, size int64, done func(), err error) {
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, io.LimitReader(r, min(max, spoolMemory)+1))
+	switch {
+	case err != nil:
+		return nil, 0, nil, err
+	case n > max:
+		return nil, 0, nil, &LimitError{Limit: "MaxSize", Max: max}
+	case n <= spoolMemory:
+		return bytes.NewReader(buf.Bytes()), n, func() {}, nil
+	}
+
+	f, err := os.CreateTemp("", "convert-*")
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	done = func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	if _, err = buf.WriteTo(f); err == nil {
+		var m int64
+		m, err = io.Copy(f, io.LimitReader(r, max-n+1))
+		if n += m; err == nil && n > max {
+			err = &LimitError{Limit: "MaxSize", Max: max}
+		}
+	}
+	if err != nil {
+		done()
+		return nil, 0, nil, err
+	}
+	return f, n, done, nil
+}
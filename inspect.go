@@ -0,0 +1,451 @@
+package convert
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/aerissecure/convert/internal/cfb"
+	"github.com/aerissecure/convert/internal/safezip"
+)
+
+// -----------------------------------------------------------------------------
+// Security inspection
+// -----------------------------------------------------------------------------
+//
+// Inspect looks for content that can act when a document is opened in its
+// application, or reach out of it: macros, dynamic data exchange, external
+// data and links, remote templates and images, ActiveX controls and embedded
+// files.  Nothing is rendered or executed; findings only say that such
+// content is present, not that it is malicious.
+
+// Kinds of Finding.
+const (
+	FindingEncrypted      = "encrypted"      // password-protected; contents cannot be inspected
+	FindingVBAMacros      = "vbaMacros"      // VBA project
+	FindingXLMMacros      = "xlmMacros"      // Excel 4.0 macro sheet
+	FindingDDE            = "dde"            // DDE field, formula or link
+	FindingExternalData   = "externalData"   // data connection or query table
+	FindingExternalLink   = "externalLink"   // link to another workbook
+	FindingRemoteTemplate = "remoteTemplate" // attached template loaded from outside the file
+	FindingRemoteResource = "remoteResource" // other external relationship (image, frame, linked object …)
+	FindingActiveX        = "activeX"        // ActiveX control
+	FindingOLEObject      = "oleObject"      // embedded OLE object or file
+	FindingExecutable     = "executable"     // embedded Windows executable or script
+	FindingWebExtension   = "webExtension"   // Office add-in running web content
+)
+
+// Finding is one piece of risky content.
+type Finding struct {
+	Kind   string
+	Part   string // package part or compound file stream where it was found
+	Detail string // target, field code, file name … where known
+}
+
+// Inspection is the result of Inspect.
+type Inspection struct {
+	Format   Format
+	Findings []Finding
+	// Connections lists the external data sources of a workbook; see
+	// DataConnection.
+	Connections []DataConnection
+}
+
+// Has reports whether the inspection found content of the given kind.
+func (in Inspection) Has(kind string) bool {
+	for _, f := range in.Findings {
+		if f.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Inspect reports the risky content of r.  Any ZIP package or compound
+// file is inspected, whether or not DetectFormat identifies it; other
+// unrecognised input yields the error of its Report.  Encrypted input is
+// reported with a FindingEncrypted finding.
+func Inspect(r io.ReaderAt, size int64) (Inspection, error) {
+	rep, err := DetectFormat(r, size)
+	if err != nil {
+		return Inspection{}, err
+	}
+	in := Inspection{Format: rep.Format}
+	if rep.Encrypted {
+		in.add(FindingEncrypted, "", rep.Detail)
+		return in, nil
+	}
+
+	head := make([]byte, 8)
+	n, _ := r.ReadAt(head, 0)
+	switch {
+	case bytes.HasPrefix(head[:n], []byte("PK\x03\x04")):
+		zr, err := safezip.NewReader(r, size)
+		if err != nil {
+			return in, rep.Err()
+		}
+		in.inspectPackage(zr)
+	case cfb.IsCFB(head[:n]):
+		f, err := cfb.Open(r, size)
+		if err != nil {
+			return in, rep.Err()
+		}
+		in.inspectCompound(f)
+	case rep.Format == FormatRTF:
+		data, err := io.ReadAll(io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return in, err
+		}
+		in.inspectRTF(data)
+	default:
+		return in, rep.Err()
+	}
+	return in, nil
+}
+
+func (in *Inspection) add(kind, part, detail string) {
+	in.Findings = append(in.Findings, Finding{Kind: kind, Part: part, Detail: detail})
+}
+
+// executableExts are the file extensions Windows runs or interprets.
+var executableExts = map[string]bool{
+	".exe": true, ".dll": true, ".scr": true, ".com": true, ".pif": true, ".cpl": true,
+	".bat": true, ".cmd": true, ".ps1": true, ".vbs": true, ".vbe": true, ".js": true,
+	".jse": true, ".wsf": true, ".wsh": true, ".hta": true, ".msi": true, ".lnk": true,
+	".jar": true, ".reg": true, ".inf": true,
+}
+
+// checkEmbedded reports an embedded file as executable when its name or
+// content says so.
+func (in *Inspection) checkEmbedded(part, name string, data []byte) {
+	switch {
+	case executableExts[strings.ToLower(path.Ext(name))]:
+		in.add(FindingExecutable, part, name)
+	case bytes.HasPrefix(data, []byte("MZ")):
+		in.add(FindingExecutable, part, "Windows executable")
+	}
+}
+
+// -----------------------------------------------------------------------------
+// OPC packages
+// -----------------------------------------------------------------------------
+
+// ddeFormula matches DDE formulas such as =cmd|'/c calc'!A1.
+var ddeFormula = regexp.MustCompile(`(?i)(^|[=(,+\-*/&\s])[a-z0-9_.]+\|\s*['"]`)
+
+func (in *Inspection) inspectPackage(zr *zip.Reader) {
+	var conns []xmlConnection
+	for _, f := range zr.File {
+		if f.Name == "xl/connections.xml" {
+			conns = parseConnections(readEntry(f, 16<<20))
+		}
+	}
+	for _, f := range zr.File {
+		name := f.Name
+		dir, base := path.Split(name)
+		switch {
+		case strings.EqualFold(base, "vbaProject.bin"):
+			in.add(FindingVBAMacros, name, "")
+		case strings.HasPrefix(name, "xl/macrosheets/") || strings.HasPrefix(name, "xl/intlMacrosheets/"):
+			if strings.HasSuffix(name, ".xml") {
+				in.add(FindingXLMMacros, name, "")
+			}
+		case strings.HasPrefix(name, "xl/externalLinks/") && strings.HasSuffix(name, ".xml"):
+			// Links to workbooks are reported from their relationship,
+			// which holds the path.
+			if data := readEntry(f, 16<<20); bytes.Contains(data, []byte("<ddeLink")) {
+				in.add(FindingDDE, name, ddeLinkDetail(data))
+			}
+		case name == "xl/connections.xml":
+			in.inspectConnections(name, conns)
+		case strings.HasPrefix(name, "xl/queryTables/") && strings.HasSuffix(name, ".xml"):
+			in.inspectQueryTable(name, readEntry(f, 1<<20), conns)
+		case strings.HasSuffix(dir, "/webextensions/") && strings.HasPrefix(base, "webextension") && strings.HasSuffix(base, ".xml"):
+			in.inspectWebExtension(name, readEntry(f, 1<<20))
+		case strings.HasPrefix(name, "xl/worksheets/") && strings.HasSuffix(name, ".xml"):
+			in.inspectFormulas(f)
+		case dir == "word/" && strings.HasSuffix(name, ".xml"):
+			in.inspectFields(f)
+		case strings.HasSuffix(dir, "/activeX/") && strings.HasSuffix(name, ".xml"):
+			in.add(FindingActiveX, name, activeXDetail(readEntry(f, 1<<20)))
+		case strings.HasSuffix(dir, "/embeddings/") && base != "":
+			in.add(FindingOLEObject, name, "")
+			in.inspectEmbedding(name, readEntry(f, 64<<20))
+		case strings.HasSuffix(dir, "_rels/") && strings.HasSuffix(name, ".rels"):
+			in.inspectRels(name, readEntry(f, 16<<20))
+		}
+	}
+}
+
+// inspectRels reports the external relationships of a part, other than
+// hyperlinks.
+func (in *Inspection) inspectRels(name string, data []byte) {
+	var rels struct {
+		Relationship []struct {
+			Type       string `xml:"Type,attr"`
+			Target     string `xml:"Target,attr"`
+			TargetMode string `xml:"TargetMode,attr"`
+		}
+	}
+	if xml.Unmarshal(data, &rels) != nil {
+		return
+	}
+	for _, rel := range rels.Relationship {
+		if rel.TargetMode != "External" {
+			continue
+		}
+		switch typ := rel.Type[strings.LastIndex(rel.Type, "/")+1:]; typ {
+		case "hyperlink":
+		case "attachedTemplate":
+			in.add(FindingRemoteTemplate, name, rel.Target)
+		case "externalLinkPath", "xlExternalLinkPath":
+			in.add(FindingExternalLink, name, rel.Target)
+		default:
+			in.add(FindingRemoteResource, name, typ+": "+rel.Target)
+		}
+	}
+}
+
+// inspectFormulas reports the DDE formulas of a worksheet.
+func (in *Inspection) inspectFormulas(f *zip.File) {
+	rc, err := f.Open()
+	if err != nil {
+		return
+	}
+	defer rc.Close()
+	d := xml.NewDecoder(rc)
+	var formula bool
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			formula = t.Name.Local == "f"
+		case xml.EndElement:
+			formula = false
+		case xml.CharData:
+			if formula && ddeFormula.Match(t) {
+				in.add(FindingDDE, f.Name, strings.TrimSpace(string(t)))
+			}
+		}
+	}
+}
+
+// inspectFields reports the DDE fields of a WordprocessingML part.
+func (in *Inspection) inspectFields(f *zip.File) {
+	rc, err := f.Open()
+	if err != nil {
+		return
+	}
+	defer rc.Close()
+	check := func(code string) {
+		code = strings.TrimSpace(code)
+		word, _, _ := strings.Cut(code, " ")
+		if strings.EqualFold(word, "DDE") || strings.EqualFold(word, "DDEAUTO") {
+			in.add(FindingDDE, f.Name, code)
+		}
+	}
+	d := xml.NewDecoder(rc)
+	var (
+		code               strings.Builder
+		inField, instrText bool
+	)
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "fldSimple":
+				for _, a := range t.Attr {
+					if a.Name.Local == "instr" {
+						check(a.Value)
+					}
+				}
+			case "fldChar":
+				for _, a := range t.Attr {
+					if a.Name.Local != "fldCharType" {
+						continue
+					}
+					if a.Value == "begin" {
+						code.Reset()
+						inField = true
+					} else if inField {
+						check(code.String())
+						inField = false
+					}
+				}
+			case "instrText":
+				instrText = true
+			}
+		case xml.EndElement:
+			if t.Name.Local == "instrText" {
+				instrText = false
+			}
+		case xml.CharData:
+			if inField && instrText {
+				code.Write(t)
+			}
+		}
+	}
+}
+
+// inspectEmbedding looks inside an embedded part for executables.
+func (in *Inspection) inspectEmbedding(name string, data []byte) {
+	if !cfb.IsCFB(data) {
+		in.checkEmbedded(name, name, data)
+		return
+	}
+	f, err := cfb.Open(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return
+	}
+	if native, err := f.ReadStream("\x01Ole10Native"); err == nil {
+		file, payload := ole10Native(native)
+		in.checkEmbedded(name, file, payload)
+	}
+}
+
+// ddeLinkDetail returns "service|topic" of an externalLink part's ddeLink.
+func ddeLinkDetail(data []byte) string {
+	var link struct {
+		DDELink struct {
+			Service string `xml:"ddeService,attr"`
+			Topic   string `xml:"ddeTopic,attr"`
+		} `xml:"ddeLink"`
+	}
+	xml.Unmarshal(data, &link)
+	return link.DDELink.Service + "|" + link.DDELink.Topic
+}
+
+// activeXDetail returns the class ID of an ActiveX control part.
+func activeXDetail(data []byte) string {
+	var ctrl struct {
+		ClassID string `xml:"classid,attr"`
+	}
+	xml.Unmarshal(data, &ctrl)
+	return ctrl.ClassID
+}
+
+// ole10Native parses the Ole10Native stream of an OLE Package object: the
+// total size, a flags word, the label and source path (NUL terminated),
+// eight reserved bytes, the temporary path, then the length-prefixed file
+// data.  It returns the source file name (the label if there is none) and
+// the data.
+func ole10Native(b []byte) (name string, data []byte) {
+	pos := 6
+	cstr := func() string {
+		if pos >= len(b) {
+			return ""
+		}
+		i := bytes.IndexByte(b[pos:], 0)
+		if i < 0 {
+			pos = len(b)
+			return ""
+		}
+		s := string(b[pos : pos+i])
+		pos += i + 1
+		return s
+	}
+	label, src := cstr(), cstr()
+	name = label
+	if src != "" {
+		name = src[strings.LastIndexAny(src, `\/`)+1:]
+	}
+	pos += 8
+	cstr() // temporary path
+	if pos+4 > len(b) {
+		return name, nil
+	}
+	n := int(binary.LittleEndian.Uint32(b[pos:]))
+	pos += 4
+	return name, b[pos:min(pos+n, len(b))]
+}
+
+// -----------------------------------------------------------------------------
+// Compound files and RTF
+// -----------------------------------------------------------------------------
+
+func (in *Inspection) inspectCompound(f *cfb.File) {
+	for _, e := range f.Entries() {
+		dir, base := path.Split(e.Path)
+		switch {
+		case dir == "" && (strings.EqualFold(base, "Macros") || strings.EqualFold(base, "_VBA_PROJECT_CUR")):
+			in.add(FindingVBAMacros, e.Path, "")
+		case dir == "" && e.Storage && strings.HasPrefix(base, "MBD"):
+			// Excel keeps one storage per embedded object at the root.
+			in.add(FindingOLEObject, e.Path, "")
+		case strings.EqualFold(dir, "ObjectPool/") && e.Storage:
+			// Word keeps them below ObjectPool.
+			in.add(FindingOLEObject, e.Path, "")
+		case base == "\x01Ole10Native":
+			if native, err := f.ReadStream(e.Path); err == nil {
+				file, payload := ole10Native(native)
+				in.checkEmbedded(e.Path, file, payload)
+			}
+		}
+	}
+	if wb, err := f.ReadStream("Workbook"); err == nil {
+		in.inspectBIFF(wb)
+	}
+}
+
+// inspectBIFF reports the macro sheets of a BIFF8 workbook stream, from
+// the sheet type of its BOUNDSHEET records.
+func (in *Inspection) inspectBIFF(b []byte) {
+	for pos := 0; pos+4 <= len(b); {
+		id := binary.LittleEndian.Uint16(b[pos:])
+		n := int(binary.LittleEndian.Uint16(b[pos+2:]))
+		data := b[pos+4 : min(pos+4+n, len(b))]
+		pos += 4 + n
+		switch id {
+		case 0x0085: // BOUNDSHEET
+			if len(data) >= 8 && data[5] == 0x01 {
+				in.add(FindingXLMMacros, "Workbook", biffSheetName(data[6:]))
+			}
+		case 0x000A: // EOF of the globals substream
+			return
+		}
+	}
+}
+
+// biffSheetName decodes the ShortXLUnicodeString of a BOUNDSHEET record.
+func biffSheetName(b []byte) string {
+	if len(b) < 2 {
+		return ""
+	}
+	n, wide := int(b[0]), b[1]&1 != 0
+	b = b[2:]
+	if !wide {
+		return string(b[:min(n, len(b))])
+	}
+	var sb strings.Builder
+	for i := 0; i < n && 2*i+1 < len(b); i++ {
+		sb.WriteRune(rune(binary.LittleEndian.Uint16(b[2*i:])))
+	}
+	return sb.String()
+}
+
+// rtfDDE matches DDE field instructions in RTF.
+var rtfDDE = regexp.MustCompile(`(?i)\\fldinst[^}]*?\b(DDE|DDEAUTO)\b`)
+
+func (in *Inspection) inspectRTF(data []byte) {
+	for range bytes.Count(data, []byte(`\object`)) {
+		in.add(FindingOLEObject, "", "")
+	}
+	for _, m := range rtfDDE.FindAll(data, -1) {
+		in.add(FindingDDE, "", string(m))
+	}
+	if bytes.Contains(data, []byte(`\*\template`)) {
+		in.add(FindingRemoteTemplate, "", "")
+	}
+}
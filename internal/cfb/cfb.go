@@ -0,0 +1,328 @@
+// Package cfb implements a minimal, read-only parser for the Compound File
+// Binary format (also known as OLE2 or structured storage).  It is used for
+// legacy Office files and for the OLE payloads embedded inside OOXML packages.
+//
+// Only what the converters need is supported: walking the directory and
+// reading whole streams.  All chain walks are bounded by the file size so
+// malformed input fails with an error instead of looping.
+package cfb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// Signature is the 8-byte magic number every compound file starts with.
+var Signature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// ErrNotCFB is returned when the input does not start with the CFB signature.
+var ErrNotCFB = errors.New("cfb: not a compound file")
+
+// ErrCorrupt is wrapped by the errors for structurally invalid compound
+// files: broken sector chains, out-of-range sectors and the like.
+var ErrCorrupt = errors.New("cfb: corrupt compound file")
+
+// Sector markers.
+const (
+	endOfChain = 0xFFFFFFFE
+	freeSect   = 0xFFFFFFFF
+	noStream   = 0xFFFFFFFF
+)
+
+// Directory entry object types.
+const (
+	typeStorage = 1
+	typeStream  = 2
+	typeRoot    = 5
+)
+
+// IsCFB reports whether b starts with the compound file signature.
+func IsCFB(b []byte) bool {
+	return bytes.HasPrefix(b, Signature)
+}
+
+// Entry describes a stream or storage in the compound file.
+type Entry struct {
+	Path    string // slash separated, relative to the root storage
+	Name    string
+	Storage bool
+	Size    int64
+
+	start uint32
+}
+
+// File is an opened compound file.
+type File struct {
+	r          io.ReaderAt
+	size       int64
+	sectorSize int64
+	miniSize   int64
+	miniCutoff int64
+	fat        []uint32
+	miniFAT    []uint32
+	miniStream []byte
+	entries    []Entry
+}
+
+// Open parses the header, allocation tables and directory of a compound file.
+func Open(r io.ReaderAt, size int64) (*File, error) {
+	hdr := make([]byte, 512)
+	if _, err := r.ReadAt(hdr, 0); err != nil {
+		return nil, ErrNotCFB
+	}
+	if !IsCFB(hdr) {
+		return nil, ErrNotCFB
+	}
+	le := binary.LittleEndian
+	shift := le.Uint16(hdr[0x1E:])
+	miniShift := le.Uint16(hdr[0x20:])
+	if shift != 9 && shift != 12 {
+		return nil, fmt.Errorf("%w: unsupported sector shift %d", ErrCorrupt, shift)
+	}
+	if miniShift != 6 {
+		return nil, fmt.Errorf("%w: unsupported mini sector shift %d", ErrCorrupt, miniShift)
+	}
+	f := &File{
+		r:          r,
+		size:       size,
+		sectorSize: 1 << shift,
+		miniSize:   1 << miniShift,
+		miniCutoff: int64(le.Uint32(hdr[0x38:])),
+	}
+
+	// ---- FAT, located through the DIFAT ----
+	numFAT := le.Uint32(hdr[0x2C:])
+	var fatSectors []uint32
+	for i := 0; i < 109 && uint32(len(fatSectors)) < numFAT; i++ {
+		fatSectors = append(fatSectors, le.Uint32(hdr[0x4C+4*i:]))
+	}
+	difat := le.Uint32(hdr[0x44:])
+	for n := 0; difat != endOfChain && difat != freeSect && uint32(len(fatSectors)) < numFAT; n++ {
+		if int64(n) > f.maxSectors() {
+			return nil, fmt.Errorf("%w: DIFAT chain loop", ErrCorrupt)
+		}
+		buf, err := f.sector(difat)
+		if err != nil {
+			return nil, err
+		}
+		per := len(buf)/4 - 1
+		for i := 0; i < per && uint32(len(fatSectors)) < numFAT; i++ {
+			fatSectors = append(fatSectors, le.Uint32(buf[4*i:]))
+		}
+		difat = le.Uint32(buf[4*per:])
+	}
+	for _, s := range fatSectors {
+		buf, err := f.sector(s)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i+4 <= len(buf); i += 4 {
+			f.fat = append(f.fat, le.Uint32(buf[i:]))
+		}
+	}
+
+	// ---- Directory ----
+	dir, err := f.readChain(le.Uint32(hdr[0x30:]), -1)
+	if err != nil {
+		return nil, fmt.Errorf("cfb: reading directory: %w", err)
+	}
+	raw := parseDirectory(dir)
+	if shift == 9 {
+		// Version 3 files only define the low 32 bits of the stream size.
+		for i := range raw {
+			raw[i].size &= 0xFFFFFFFF
+		}
+	}
+	if len(raw) == 0 || raw[0].typ != typeRoot {
+		return nil, fmt.Errorf("%w: missing root entry", ErrCorrupt)
+	}
+
+	// ---- Mini stream and mini FAT ----
+	if mf := le.Uint32(hdr[0x3C:]); mf != endOfChain && mf != freeSect {
+		buf, err := f.readChain(mf, -1)
+		if err != nil {
+			return nil, fmt.Errorf("cfb: reading mini FAT: %w", err)
+		}
+		for i := 0; i+4 <= len(buf); i += 4 {
+			f.miniFAT = append(f.miniFAT, le.Uint32(buf[i:]))
+		}
+	}
+	if raw[0].start != endOfChain && raw[0].size > 0 {
+		f.miniStream, err = f.readChain(raw[0].start, raw[0].size)
+		if err != nil {
+			return nil, fmt.Errorf("cfb: reading mini stream: %w", err)
+		}
+	}
+
+	f.walk(raw, raw[0].child, "", make(map[uint32]bool))
+	return f, nil
+}
+
+// Entries returns every storage and stream below the root, in directory
+// order.
+func (f *File) Entries() []Entry {
+	return append([]Entry(nil), f.entries...)
+}
+
+// Stat returns the entry at path (case-insensitive, as in the format).
+func (f *File) Stat(path string) (Entry, bool) {
+	for _, e := range f.entries {
+		if strings.EqualFold(e.Path, path) {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// ReadStream returns the full contents of the stream at path.
+func (f *File) ReadStream(path string) ([]byte, error) {
+	e, ok := f.Stat(path)
+	if !ok || e.Storage {
+		return nil, fmt.Errorf("cfb: stream %q not found", path)
+	}
+	if e.Size > f.size*64 {
+		return nil, fmt.Errorf("%w: stream %q has implausible size %d", ErrCorrupt, path, e.Size)
+	}
+	if e.Size < f.miniCutoff {
+		return f.readMiniChain(e.start, e.Size)
+	}
+	return f.readChain(e.start, e.Size)
+}
+
+type dirEntry struct {
+	name               string
+	typ                byte
+	left, right, child uint32
+	start              uint32
+	size               int64
+}
+
+func parseDirectory(b []byte) []dirEntry {
+	le := binary.LittleEndian
+	var out []dirEntry
+	for off := 0; off+128 <= len(b); off += 128 {
+		e := b[off : off+128]
+		nameLen := int(le.Uint16(e[0x40:]))
+		if nameLen > 64 {
+			nameLen = 64
+		}
+		u := make([]uint16, 0, 32)
+		for i := 0; i+1 < nameLen; i += 2 {
+			c := le.Uint16(e[i:])
+			if c == 0 {
+				break
+			}
+			u = append(u, c)
+		}
+		out = append(out, dirEntry{
+			name:  string(utf16.Decode(u)),
+			typ:   e[0x42],
+			left:  le.Uint32(e[0x44:]),
+			right: le.Uint32(e[0x48:]),
+			child: le.Uint32(e[0x4C:]),
+			start: le.Uint32(e[0x74:]),
+			size:  int64(le.Uint64(e[0x78:])),
+		})
+	}
+	return out
+}
+
+// walk flattens the red-black tree of a storage into f.entries.
+func (f *File) walk(raw []dirEntry, id uint32, prefix string, seen map[uint32]bool) {
+	if id == noStream || int(id) >= len(raw) || seen[id] {
+		return
+	}
+	seen[id] = true
+	e := raw[id]
+	f.walk(raw, e.left, prefix, seen)
+	if e.typ == typeStorage || e.typ == typeStream {
+		path := e.name
+		if prefix != "" {
+			path = prefix + "/" + e.name
+		}
+		f.entries = append(f.entries, Entry{
+			Path:    path,
+			Name:    e.name,
+			Storage: e.typ == typeStorage,
+			Size:    e.size,
+			start:   e.start,
+		})
+		if e.typ == typeStorage {
+			f.walk(raw, e.child, path, seen)
+		}
+	}
+	f.walk(raw, e.right, prefix, seen)
+}
+
+func (f *File) maxSectors() int64 {
+	return f.size/f.sectorSize + 1
+}
+
+func (f *File) sector(id uint32) ([]byte, error) {
+	off := (int64(id) + 1) * f.sectorSize
+	if id >= endOfChain-1 || off+f.sectorSize > f.size+f.sectorSize {
+		return nil, fmt.Errorf("%w: sector %d out of range", ErrCorrupt, id)
+	}
+	buf := make([]byte, f.sectorSize)
+	n, err := f.r.ReadAt(buf, off)
+	if n == 0 && err != nil {
+		return nil, err
+	}
+	// The last sector of a file may be truncated; the rest reads as zero.
+	return buf, nil
+}
+
+// readChain reads a regular sector chain.  A negative size reads the whole
+// chain.
+func (f *File) readChain(start uint32, size int64) ([]byte, error) {
+	var out []byte
+	for n, s := int64(0), start; s != endOfChain; n++ {
+		if n > f.maxSectors() || int(s) >= len(f.fat) && len(f.fat) > 0 {
+			return nil, fmt.Errorf("%w: sector chain loop or gap", ErrCorrupt)
+		}
+		buf, err := f.sector(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, buf...)
+		if size >= 0 && int64(len(out)) >= size {
+			break
+		}
+		if len(f.fat) == 0 {
+			break
+		}
+		s = f.fat[s]
+	}
+	if size >= 0 {
+		if int64(len(out)) < size {
+			return nil, fmt.Errorf("%w: stream shorter than declared", ErrCorrupt)
+		}
+		out = out[:size]
+	}
+	return out, nil
+}
+
+// readMiniChain reads a stream stored in the mini stream.
+func (f *File) readMiniChain(start uint32, size int64) ([]byte, error) {
+	out := make([]byte, 0, size)
+	for n, s := 0, start; s != endOfChain && int64(len(out)) < size; n++ {
+		if n > len(f.miniFAT) || int(s) >= len(f.miniFAT) {
+			return nil, fmt.Errorf("%w: mini sector chain loop or gap", ErrCorrupt)
+		}
+		off := int64(s) * f.miniSize
+		if off+f.miniSize > int64(len(f.miniStream)) {
+			return nil, fmt.Errorf("%w: mini sector out of range", ErrCorrupt)
+		}
+		out = append(out, f.miniStream[off:off+f.miniSize]...)
+		s = f.miniFAT[s]
+	}
+	if int64(len(out)) < size {
+		return nil, fmt.Errorf("%w: stream shorter than declared", ErrCorrupt)
+	}
+	return out[:size], nil
+}
@@ -0,0 +1,113 @@
+package cfb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+)
+
+// buildCFB assembles a version 3 compound file holding one regular stream
+// ("Big") and one stream stored in the mini stream ("Small").
+func buildCFB(big, small []byte) []byte {
+	le := binary.LittleEndian
+	const ss = 512
+	bigSectors := (len(big) + ss - 1) / ss
+	total := 4 + bigSectors
+	out := make([]byte, (total+1)*ss)
+	sector := func(i int) []byte { return out[(i+1)*ss : (i+2)*ss] }
+
+	hdr := out[:ss]
+	copy(hdr, Signature)
+	le.PutUint16(hdr[0x18:], 0x3E)
+	le.PutUint16(hdr[0x1A:], 3)
+	le.PutUint16(hdr[0x1C:], 0xFFFE)
+	le.PutUint16(hdr[0x1E:], 9)
+	le.PutUint16(hdr[0x20:], 6)
+	le.PutUint32(hdr[0x2C:], 1)
+	le.PutUint32(hdr[0x30:], 1)
+	le.PutUint32(hdr[0x38:], 4096)
+	le.PutUint32(hdr[0x3C:], 2)
+	le.PutUint32(hdr[0x40:], 1)
+	le.PutUint32(hdr[0x44:], endOfChain)
+	for i := 0; i < 109; i++ {
+		le.PutUint32(hdr[0x4C+4*i:], freeSect)
+	}
+	le.PutUint32(hdr[0x4C:], 0)
+
+	fat := sector(0)
+	for i := 0; i < ss/4; i++ {
+		le.PutUint32(fat[4*i:], freeSect)
+	}
+	le.PutUint32(fat[0:], 0xFFFFFFFD)
+	le.PutUint32(fat[4:], endOfChain)
+	le.PutUint32(fat[8:], endOfChain)
+	le.PutUint32(fat[12:], endOfChain)
+	for i := 0; i < bigSectors; i++ {
+		next := uint32(5 + i)
+		if i == bigSectors-1 {
+			next = endOfChain
+		}
+		le.PutUint32(fat[4*(4+i):], next)
+	}
+
+	entry := func(i int, name string, typ byte, right, child, start uint32, size int) {
+		e := sector(1)[i*128 : (i+1)*128]
+		u := utf16.Encode([]rune(name))
+		for j, c := range u {
+			le.PutUint16(e[2*j:], c)
+		}
+		le.PutUint16(e[0x40:], uint16(2*(len(u)+1)))
+		e[0x42] = typ
+		le.PutUint32(e[0x44:], noStream)
+		le.PutUint32(e[0x48:], right)
+		le.PutUint32(e[0x4C:], child)
+		le.PutUint32(e[0x74:], start)
+		le.PutUint64(e[0x78:], uint64(size))
+	}
+	entry(0, "Root Entry", typeRoot, noStream, 1, 3, 128)
+	entry(1, "Big", typeStream, 2, noStream, 4, len(big))
+	entry(2, "Small", typeStream, noStream, noStream, 0, len(small))
+
+	mfat := sector(2)
+	for i := 0; i < ss/4; i++ {
+		le.PutUint32(mfat[4*i:], freeSect)
+	}
+	le.PutUint32(mfat[0:], 1)
+	le.PutUint32(mfat[4:], endOfChain)
+
+	copy(sector(3), small)
+	for i := 0; i < bigSectors; i++ {
+		end := (i + 1) * ss
+		if end > len(big) {
+			end = len(big)
+		}
+		copy(sector(4+i), big[i*ss:end])
+	}
+	return out
+}
+
+func TestReadStreams(t *testing.T) {
+	big := bytes.Repeat([]byte("0123456789"), 500)
+	small := bytes.Repeat([]byte("ab"), 50)
+	data := buildCFB(big, small)
+
+	f, err := Open(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if n := len(f.Entries()); n != 2 {
+		t.Fatalf("got %d entries, want 2", n)
+	}
+	got, err := f.ReadStream("Big")
+	if err != nil || !bytes.Equal(got, big) {
+		t.Errorf("Big stream mismatch (err %v)", err)
+	}
+	got, err = f.ReadStream("small")
+	if err != nil || !bytes.Equal(got, small) {
+		t.Errorf("Small stream mismatch (err %v)", err)
+	}
+	if _, err := Open(bytes.NewReader([]byte("PK\x03\x04")), 4); err != ErrNotCFB {
+		t.Errorf("expected ErrNotCFB, got %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+// Package cfbtest builds compound files for tests.
+package cfbtest
+
+import (
+	"encoding/binary"
+	"unicode/utf16"
+)
+
+// Build returns a compound file whose root storage holds a single stream.
+// The mini-stream cutoff is zero, so the stream is stored in regular
+// sectors whatever its size.
+func Build(name string, stream []byte) []byte {
+	le := binary.LittleEndian
+	const ss = 512
+	n := (len(stream) + ss - 1) / ss
+	out := make([]byte, (3+n)*ss)
+	sector := func(i int) []byte { return out[(i+1)*ss : (i+2)*ss] }
+
+	hdr := out[:ss]
+	copy(hdr, []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1})
+	le.PutUint16(hdr[0x1A:], 3)
+	le.PutUint16(hdr[0x1C:], 0xFFFE)
+	le.PutUint16(hdr[0x1E:], 9)
+	le.PutUint16(hdr[0x20:], 6)
+	le.PutUint32(hdr[0x2C:], 1)
+	le.PutUint32(hdr[0x30:], 1)
+	le.PutUint32(hdr[0x3C:], 0xFFFFFFFE)
+	le.PutUint32(hdr[0x44:], 0xFFFFFFFE)
+	for i := 0; i < 109; i++ {
+		le.PutUint32(hdr[0x4C+4*i:], 0xFFFFFFFF)
+	}
+	le.PutUint32(hdr[0x4C:], 0)
+
+	fat := sector(0)
+	for i := 0; i < ss/4; i++ {
+		le.PutUint32(fat[4*i:], 0xFFFFFFFF)
+	}
+	le.PutUint32(fat[0:], 0xFFFFFFFD)
+	le.PutUint32(fat[4:], 0xFFFFFFFE)
+	for i := 0; i < n; i++ {
+		next := uint32(3 + i)
+		if i == n-1 {
+			next = 0xFFFFFFFE
+		}
+		le.PutUint32(fat[4*(2+i):], next)
+	}
+
+	entry := func(i int, name string, typ byte, child, start uint32, size int) {
+		e := sector(1)[i*128 : (i+1)*128]
+		u := utf16.Encode([]rune(name))
+		for j, c := range u {
+			le.PutUint16(e[2*j:], c)
+		}
+		le.PutUint16(e[0x40:], uint16(2*(len(u)+1)))
+		e[0x42] = typ
+		le.PutUint32(e[0x44:], 0xFFFFFFFF)
+		le.PutUint32(e[0x48:], 0xFFFFFFFF)
+		le.PutUint32(e[0x4C:], child)
+		le.PutUint32(e[0x74:], start)
+		le.PutUint64(e[0x78:], uint64(size))
+	}
+	entry(0, "Root Entry", 5, 1, 0xFFFFFFFE, 0)
+	entry(1, name, 2, 0xFFFFFFFF, 2, len(stream))
+	copy(out[3*ss:], stream)
+	return out
+}
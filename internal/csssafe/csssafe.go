@@ -0,0 +1,37 @@
+// Package csssafe sanitises values taken from documents before they are
+// interpolated into CSS declarations.  It is shared by the converters so
+// that a fix to the allowed character sets applies to every output format.
+package csssafe
+
+import "regexp"
+
+var (
+	fontFamilySafeRe = regexp.MustCompile(`[^a-zA-Z0-9 ,_-]+`)
+	hexColorRe       = regexp.MustCompile(`^[0-9a-fA-F]{3}([0-9a-fA-F]{3})?$`)
+	keywordRe        = regexp.MustCompile(`^[a-z]+(-[a-z]+)*$`)
+)
+
+// FontFamily strips any characters that are not considered safe for a CSS
+// font-family declaration.  This prevents breaking out of the CSS context and
+// injecting arbitrary directives.
+func FontFamily(s string) string {
+	return fontFamilySafeRe.ReplaceAllString(s, "")
+}
+
+// Color returns s if it is a valid 3- or 6-digit hexadecimal colour and ""
+// otherwise, preventing CSS or markup injection.
+func Color(s string) string {
+	if hexColorRe.MatchString(s) {
+		return s
+	}
+	return ""
+}
+
+// Keyword returns s if it is a lowercase CSS keyword such as "lower-roman"
+// and "" otherwise.
+func Keyword(s string) string {
+	if keywordRe.MatchString(s) {
+		return s
+	}
+	return ""
+}
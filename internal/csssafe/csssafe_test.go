@@ -0,0 +1,25 @@
+package csssafe
+
+import "testing"
+
+func TestFontFamily(t *testing.T) {
+	if got := FontFamily(`Calibri'; } body { x: url(evil)`); got != "Calibri  body  x urlevil" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestColor(t *testing.T) {
+	for in, want := range map[string]string{"FF0000": "FF0000", "abc": "abc", "red": "", "FF0000;x": "", "": ""} {
+		if got := Color(in); got != want {
+			t.Errorf("Color(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestKeyword(t *testing.T) {
+	for in, want := range map[string]string{"lower-roman": "lower-roman", "disc": "disc", "disc;color:red": "", "-x": "", "": ""} {
+		if got := Keyword(in); got != want {
+			t.Errorf("Keyword(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,532 @@
+// Package htmlsafe reduces HTML to an allow-listed subset that is safe to
+// embed in another page.  It is the verification pass of the strict output
+// profile: whatever the converters emit, Sanitize re-parses it and writes
+// back only the elements, attributes and CSS properties listed below, so a
+// bug in a renderer cannot smuggle markup through it.
+//
+// Elements outside the list are removed, keeping their content, except for
+// those whose content is code or foreign markup (script, iframe, svg, ...),
+// which are removed with it.  Attributes are decoded, checked and written
+// back double-quoted; event handlers are never listed.  URLs may be
+// fragments, relative references, data: images in img and CSS, and
+// absolute URLs starting with one of Policy.URLs.  Style attributes and
+// <style> elements keep only listed properties whose values load nothing
+// else; at-rules other than @media are dropped.  Comments and processing
+// instructions are removed.
+package htmlsafe
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Policy configures Sanitize.
+type Policy struct {
+	// URLs lists the prefixes of the absolute URLs links and images may
+	// point to, e.g. "https://intranet.example.com/" or "mailto:".  End
+	// host names with a slash, or "https://example.com" also admits
+	// "https://example.com.evil.test/".
+	URLs []string
+}
+
+// elements lists the elements kept, mapped to whether they are void.
+// style and title are kept too, with their content sanitized as CSS and
+// text.
+var elements = map[string]bool{
+	"a": false, "abbr": false, "article": false, "aside": false, "b": false, "bdi": false, "bdo": false,
+	"blockquote": false, "body": false, "br": true, "caption": false, "cite": false, "code": false,
+	"col": true, "colgroup": false, "dd": false, "del": false, "details": false, "dfn": false,
+	"div": false, "dl": false, "dt": false, "em": false, "figcaption": false, "figure": false,
+	"footer": false, "h1": false, "h2": false, "h3": false, "h4": false, "h5": false, "h6": false,
+	"head": false, "header": false, "hr": true, "html": false, "i": false, "img": true, "ins": false,
+	"kbd": false, "li": false, "main": false, "mark": false, "meta": true, "nav": false, "ol": false,
+	"p": false, "pre": false, "q": false, "rp": false, "rt": false, "ruby": false, "s": false,
+	"samp": false, "section": false, "small": false, "span": false, "strong": false, "sub": false,
+	"summary": false, "sup": false, "table": false, "tbody": false, "td": false, "tfoot": false,
+	"th": false, "thead": false, "time": false, "tr": false, "u": false, "ul": false, "var": false,
+	"wbr": true,
+}
+
+// dropped lists the elements removed together with their content.
+var dropped = map[string]bool{
+	"applet": true, "audio": true, "canvas": true, "embed": true, "frame": true, "frameset": true,
+	"iframe": true, "math": true, "noembed": true, "noframes": true, "noscript": true, "object": true,
+	"plaintext": true, "script": true, "select": true, "svg": true, "template": true, "textarea": true,
+	"video": true, "xmp": true,
+}
+
+// globalAttributes are kept on every element, as are aria-* and data-*.
+var globalAttributes = map[string]bool{
+	"class": true, "dir": true, "hidden": true, "id": true, "lang": true, "role": true, "style": true,
+	"title": true, "translate": true,
+}
+
+// elementAttributes are kept on the elements they are listed for.  href,
+// cite and src hold URLs and are checked as such.
+var elementAttributes = map[string]map[string]bool{
+	"a":          {"href": true, "hreflang": true, "name": true, "rel": true, "target": true},
+	"blockquote": {"cite": true},
+	"col":        {"span": true},
+	"colgroup":   {"span": true},
+	"del":        {"cite": true, "datetime": true},
+	"img":        {"alt": true, "decoding": true, "height": true, "loading": true, "src": true, "width": true},
+	"ins":        {"cite": true, "datetime": true},
+	"li":         {"value": true},
+	"meta":       {"charset": true, "content": true, "name": true},
+	"ol":         {"reversed": true, "start": true, "type": true},
+	"q":          {"cite": true},
+	"table":      {"summary": true},
+	"td":         {"colspan": true, "headers": true, "rowspan": true},
+	"th":         {"abbr": true, "colspan": true, "headers": true, "rowspan": true, "scope": true},
+	"time":       {"datetime": true},
+}
+
+// attributeNameRe matches the attribute names written back.
+var attributeNameRe = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// Sanitize returns s reduced to what p allows.
+func Sanitize(s string, p Policy) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for s != "" {
+		i := strings.IndexByte(s, '<')
+		if i < 0 {
+			b.WriteString(s)
+			break
+		}
+		b.WriteString(s[:i])
+		s = s[i:]
+		switch {
+		case strings.HasPrefix(s, "<!--"):
+			s = skipPast(s[4:], "-->")
+		case strings.HasPrefix(s, "<!"):
+			end := strings.IndexByte(s, '>')
+			if end < 0 {
+				return b.String()
+			}
+			if strings.EqualFold(strings.Join(strings.Fields(s[2:end]), " "), "doctype html") {
+				b.WriteString("<!DOCTYPE html>")
+			}
+			s = s[end+1:]
+		case strings.HasPrefix(s, "<?"):
+			s = skipPast(s, ">")
+		case len(s) > 2 && s[1] == '/' && isLetter(s[2]):
+			var name string
+			name, s = tagName(s[2:])
+			s = skipPast(s, ">")
+			if void, ok := elements[name]; ok && !void {
+				b.WriteString("</" + name + ">")
+			}
+		case len(s) > 1 && isLetter(s[1]):
+			s = p.startTag(&b, s)
+		default:
+			b.WriteString("&lt;")
+			s = s[1:]
+		}
+	}
+	return b.String()
+}
+
+// startTag writes the start tag at the beginning of s if it is allowed,
+// with its allowed attributes, and returns the rest of s.  The content of
+// raw text elements is consumed with their tag.
+func (p Policy) startTag(b *strings.Builder, s string) string {
+	name, s := tagName(s[1:])
+	type attribute struct{ name, value string }
+	var attrs []attribute
+	for {
+		s = strings.TrimLeft(s, whitespace)
+		if s == "" {
+			return "" // unterminated: dropped, as browsers do
+		}
+		if s[0] == '>' {
+			s = s[1:]
+			break
+		}
+		if s[0] == '/' {
+			s = s[1:]
+			continue
+		}
+		j := 1
+		for j < len(s) && !strings.ContainsRune(whitespace+"/>=", rune(s[j])) {
+			j++
+		}
+		a := attribute{name: strings.ToLower(s[:j])}
+		s = strings.TrimLeft(s[j:], whitespace)
+		if strings.HasPrefix(s, "=") {
+			s = strings.TrimLeft(s[1:], whitespace)
+			var raw string
+			if s != "" && (s[0] == '"' || s[0] == '\'') {
+				k := strings.IndexByte(s[1:], s[0])
+				if k < 0 {
+					return ""
+				}
+				raw, s = s[1:1+k], s[2+k:]
+			} else {
+				k := strings.IndexAny(s, whitespace+">")
+				if k < 0 {
+					return ""
+				}
+				raw, s = s[:k], s[k:]
+			}
+			a.value = html.UnescapeString(raw)
+		}
+		attrs = append(attrs, a)
+	}
+
+	switch {
+	case name == "style":
+		css, rest := rawText(s, name)
+		b.WriteString("<style>" + p.styleSheet(css) + "</style>")
+		return rest
+	case name == "title":
+		text, rest := rawText(s, name)
+		b.WriteString("<title>" + html.EscapeString(html.UnescapeString(text)) + "</title>")
+		return rest
+	case dropped[name]:
+		_, rest := rawText(s, name)
+		return rest
+	}
+	if _, ok := elements[name]; !ok {
+		return s
+	}
+	b.WriteString("<" + name)
+	seen := map[string]bool{}
+	for _, a := range attrs {
+		if seen[a.name] || !attributeNameRe.MatchString(a.name) {
+			continue
+		}
+		seen[a.name] = true
+		if v, ok := p.attribute(name, a.name, a.value); ok {
+			b.WriteString(" " + a.name + `="` + escapeAttribute(v) + `"`)
+		}
+	}
+	b.WriteString(">")
+	return s
+}
+
+// attribute returns the value of the attribute name of elem as written
+// back, and whether it is kept.
+func (p Policy) attribute(elem, name, value string) (string, bool) {
+	switch {
+	case name == "style":
+		v := p.declarations(value)
+		return v, v != ""
+	case name == "href" || name == "cite":
+		if !elementAttributes[elem][name] {
+			return "", false
+		}
+		return p.url(value, false)
+	case name == "src":
+		if !elementAttributes[elem][name] {
+			return "", false
+		}
+		return p.url(value, true)
+	case name == "target":
+		switch value {
+		case "_blank", "_self", "_parent", "_top":
+			return value, elementAttributes[elem][name]
+		}
+		return "", false
+	case globalAttributes[name], strings.HasPrefix(name, "aria-"), strings.HasPrefix(name, "data-"):
+		return value, true
+	}
+	return value, elementAttributes[elem][name]
+}
+
+// url returns u cleaned of the tabs and line breaks browsers ignore in
+// URLs, and whether it may be kept: fragments and relative references
+// always, absolute URLs if they start with one of p.URLs and, for images,
+// data: URIs of images.
+func (p Policy) url(u string, image bool) (string, bool) {
+	u = strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, u)
+	u = strings.TrimFunc(u, func(r rune) bool { return r <= ' ' })
+	if strings.ContainsFunc(u, func(r rune) bool { return r < ' ' || r == 0x7f || r == '\\' }) {
+		return "", false
+	}
+	for _, prefix := range p.URLs {
+		if prefix != "" && strings.HasPrefix(u, prefix) {
+			return u, true
+		}
+	}
+	if image && isDataImage(u) {
+		return u, true
+	}
+	if strings.HasPrefix(u, "//") {
+		return "", false // scheme-relative, i.e. absolute
+	}
+	if i := strings.IndexAny(u, ":/?#"); i >= 0 && u[i] == ':' {
+		return "", false
+	}
+	return u, true
+}
+
+// isDataImage reports whether u is a data: URI of an image format browsers
+// display without running scripts, in img elements at least.
+func isDataImage(u string) bool {
+	if len(u) < len("data:image/") || !strings.EqualFold(u[:len("data:image/")], "data:image/") {
+		return false
+	}
+	subtype, _, ok := strings.Cut(u[len("data:image/"):], ",")
+	if !ok {
+		return false
+	}
+	subtype, _, _ = strings.Cut(subtype, ";")
+	switch strings.ToLower(subtype) {
+	case "png", "jpeg", "gif", "webp", "bmp", "avif", "svg+xml":
+		return true
+	}
+	return false
+}
+
+// -----------------------------------------------------------------------------
+// CSS
+// -----------------------------------------------------------------------------
+
+// properties lists the CSS properties kept, besides those starting with
+// one of propertyPrefixes.
+var properties = map[string]bool{
+	"align-content": true, "align-items": true, "align-self": true, "bottom": true, "box-shadow": true,
+	"box-sizing": true, "caption-side": true, "clear": true, "color": true, "direction": true,
+	"display": true, "empty-cells": true, "float": true, "gap": true, "height": true, "hyphens": true,
+	"justify-content": true, "justify-items": true, "justify-self": true, "left": true,
+	"letter-spacing": true, "line-height": true, "max-height": true, "max-width": true,
+	"min-height": true, "min-width": true, "opacity": true, "order": true, "overflow-wrap": true,
+	"pointer-events": true, "position": true, "right": true, "row-gap": true, "tab-size": true,
+	"table-layout": true, "top": true, "transform": true, "transform-origin": true,
+	"unicode-bidi": true, "vertical-align": true, "visibility": true, "white-space": true,
+	"width": true, "word-break": true, "word-spacing": true, "word-wrap": true, "writing-mode": true,
+	"z-index": true,
+}
+
+// propertyPrefixes lists the families of CSS properties kept.
+var propertyPrefixes = []string{
+	"background", "border", "break-", "column", "flex", "font", "grid", "list-style", "margin",
+	"outline", "overflow", "padding", "page-break-", "ruby-", "text-",
+}
+
+// unsafeValues are substrings of CSS values that run code, load resources
+// without url() or are otherwise not emitted by the converters.
+var unsafeValues = []string{
+	"expression", "javascript:", "vbscript:", "behavior", "binding", "image-set", "src(", "element(",
+}
+
+func allowedProperty(prop string) bool {
+	if properties[prop] {
+		return true
+	}
+	for _, prefix := range propertyPrefixes {
+		if strings.HasPrefix(prop, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// declarations returns the declarations of the block s that p allows.
+func (p Policy) declarations(s string) string {
+	var kept []string
+	for _, d := range splitDeclarations(s) {
+		prop, value, ok := strings.Cut(d, ":")
+		if !ok {
+			continue
+		}
+		prop, value = strings.ToLower(strings.TrimSpace(prop)), strings.TrimSpace(value)
+		if value == "" || !allowedProperty(prop) {
+			continue
+		}
+		if value, ok = p.value(prop, value); ok {
+			kept = append(kept, prop+":"+value)
+		}
+	}
+	return strings.Join(kept, ";")
+}
+
+// value returns the value v of the CSS property prop as written back, and
+// whether it is kept.  position: fixed becomes absolute, so output cannot
+// cover the page embedding it.
+func (p Policy) value(prop, v string) (string, bool) {
+	if strings.ContainsAny(v, "<>@\\{}") || strings.Contains(v, "/*") ||
+		strings.Count(v, `"`)%2 != 0 || strings.Count(v, "'")%2 != 0 {
+		return "", false
+	}
+	lower := strings.ToLower(v)
+	for _, bad := range unsafeValues {
+		if strings.Contains(lower, bad) {
+			return "", false
+		}
+	}
+	for i := 0; ; {
+		k := strings.Index(lower[i:], "url(")
+		if k < 0 {
+			break
+		}
+		start := i + k + len("url(")
+		end := strings.IndexByte(v[start:], ')')
+		if end < 0 {
+			return "", false
+		}
+		arg := strings.Trim(strings.TrimSpace(v[start:start+end]), `"'`)
+		if u, ok := p.url(arg, true); !ok || u != arg {
+			return "", false
+		}
+		i = start + end + 1
+	}
+	if prop == "position" && strings.Contains(lower, "fixed") {
+		return "absolute", true
+	}
+	return v, true
+}
+
+// splitDeclarations splits s at the semicolons outside strings and
+// parentheses, which data: URIs contain.
+func splitDeclarations(s string) []string {
+	var out []string
+	var quote byte
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		case c == ';' && depth == 0:
+			out = append(out, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(out, s[start:])
+}
+
+// mediaRe matches the @media preludes kept.
+var mediaRe = regexp.MustCompile(`^@media[a-zA-Z0-9 \t\n(),:.-]*$`)
+
+// styleSheet returns the rules of css that p allows.
+func (p Policy) styleSheet(css string) string {
+	for {
+		i := strings.Index(css, "/*")
+		if i < 0 {
+			break
+		}
+		css = css[:i] + " " + skipPast(css[i+2:], "*/")
+	}
+	var b strings.Builder
+	b.WriteString("\n")
+	p.rules(&b, css, false)
+	return b.String()
+}
+
+// rules writes the rules in css that p allows to b, descending into @media
+// blocks unless nested.
+func (p Policy) rules(b *strings.Builder, css string, nested bool) {
+	for {
+		open := strings.IndexByte(css, '{')
+		if open < 0 {
+			return
+		}
+		prelude := strings.TrimSpace(css[:open])
+		var body string
+		body, css = block(css[open+1:])
+		switch {
+		case strings.HasPrefix(prelude, "@"):
+			if !nested && mediaRe.MatchString(prelude) {
+				b.WriteString(prelude + " {\n")
+				p.rules(b, body, true)
+				b.WriteString("}\n")
+			}
+		case !selectorRe.MatchString(prelude):
+		default:
+			if decls := p.declarations(body); decls != "" {
+				b.WriteString(prelude + " { " + decls + " }\n")
+			}
+		}
+	}
+}
+
+// selectorRe matches the selectors kept: no escapes, comments or markup,
+// and so nothing that could end the <style> element.
+var selectorRe = regexp.MustCompile(`^[a-zA-Z0-9 \t\n_.#,>+~:*()\[\]="'|^$-]+$`)
+
+// block returns the content of the block whose opening brace precedes s,
+// and what follows its closing brace.
+func block(s string) (body, rest string) {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return s[:i], s[i+1:]
+			}
+			depth--
+		}
+	}
+	return s, ""
+}
+
+// -----------------------------------------------------------------------------
+// Tokenizing
+// -----------------------------------------------------------------------------
+
+// whitespace is HTML's ASCII whitespace.
+const whitespace = " \t\n\f\r"
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// tagName returns the lowercase tag name at the start of s and the rest.
+func tagName(s string) (string, string) {
+	i := strings.IndexAny(s, whitespace+"/>")
+	if i < 0 {
+		i = len(s)
+	}
+	return strings.ToLower(s[:i]), s[i:]
+}
+
+// skipPast returns what follows the first sep in s, or "" if there is
+// none.
+func skipPast(s, sep string) string {
+	i := strings.Index(s, sep)
+	if i < 0 {
+		return ""
+	}
+	return s[i+len(sep):]
+}
+
+// rawText splits s at the end tag of the raw text element name: the text
+// before it, and what follows it.
+func rawText(s, name string) (text, rest string) {
+	for i := 0; ; {
+		k := strings.Index(s[i:], "</")
+		if k < 0 {
+			return s, ""
+		}
+		j := i + k + 2
+		if e := j + len(name); e <= len(s) && strings.EqualFold(s[j:e], name) &&
+			(e == len(s) || strings.IndexByte(whitespace+"/>", s[e]) >= 0) {
+			return s[:i+k], skipPast(s[e:], ">")
+		}
+		i = j
+	}
+}
+
+// escapeAttribute escapes v for a double-quoted attribute value.
+func escapeAttribute(v string) string {
+	return attributeEscaper.Replace(v)
+}
+
+var attributeEscaper = strings.NewReplacer("&", "&amp;", `"`, "&#34;", "<", "&lt;", ">", "&gt;")
@@ -0,0 +1,52 @@
+package htmlsafe
+
+import "testing"
+
+func TestSanitize(t *testing.T) {
+	p := Policy{URLs: []string{"https://example.com/"}}
+	for _, tc := range []struct{ in, want string }{
+		{`<p class="x">a &amp; b</p>`, `<p class="x">a &amp; b</p>`},
+		{`<p onclick="alert(1)" id=x>t</p>`, `<p id="x">t</p>`},
+		{`<a href="javascript:alert(1)">x</a>`, `<a>x</a>`},
+		{`<a href=" java&#9;script:alert(1)">x</a>`, `<a>x</a>`},
+		{`<a href="https://evil.test/">x</a>`, `<a>x</a>`},
+		{`<a href="//evil.test/">x</a>`, `<a>x</a>`},
+		{`<a href="https://example.com/doc?a=1&amp;b=2">x</a>`, `<a href="https://example.com/doc?a=1&amp;b=2">x</a>`},
+		{`<a href="#_Toc1">x</a>`, `<a href="#_Toc1">x</a>`},
+		{`<img src="data:image/png;base64,AAAA" onerror="x()">`, `<img src="data:image/png;base64,AAAA">`},
+		{`<img src="data:text/html,<script>">`, `<img>`},
+		{`a<script>alert("</p>")</script>b`, `ab`},
+		{`<svg><script>x</script></svg>c`, `c`},
+		{`<form><input value=x>y</form>`, `y`},
+		{`<!-- c --><b>x</b><?php ?>`, `<b>x</b>`},
+		{`<span style="color:red;background:url(https://evil.test/x)">x</span>`, `<span style="color:red">x</span>`},
+		{`<span style="width:expression(alert(1))">x</span>`, `<span>x</span>`},
+		{`<span style="position:fixed;top:0">x</span>`, `<span style="position:absolute;top:0">x</span>`},
+		{`<span style="background-image:url('data:image/png;base64,AA')">x</span>`, `<span style="background-image:url('data:image/png;base64,AA')">x</span>`},
+		{`<div title='a"b' data-x=1 aria-hidden="true">`, `<div title="a&#34;b" data-x="1" aria-hidden="true">`},
+		{`1 < 2`, `1 &lt; 2`},
+		{`<meta http-equiv="refresh" content="0;url=https://evil.test/">`, `<meta content="0;url=https://evil.test/">`},
+		{`<link rel="stylesheet" href="https://evil.test/x.css">`, ``},
+		{`<title>a</title><b>`, `<title>a</title><b>`},
+		{`<p title="x`, ``},
+	} {
+		if got := Sanitize(tc.in, p); got != tc.want {
+			t.Errorf("Sanitize(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestSanitizeStyleSheet(t *testing.T) {
+	in := `<style>
+p { color: red; behavior: url(x.htc) }
+@import url(https://evil.test/x.css);
+@font-face { font-family: x; src: url(https://evil.test/f.woff) }
+/* @import url(https://evil.test/y.css); */
+@media print { div.page { margin: 0; break-after: page; } }
+body:has(> div.x) { max-width: 70em; }
+</style>`
+	want := "<style>\np { color:red }\n@media print {\ndiv.page { margin:0;break-after:page }\n}\nbody:has(> div.x) { max-width:70em }\n</style>"
+	if got := Sanitize(in, Policy{}); got != want {
+		t.Errorf("got %q\nwant %q", got, want)
+	}
+}
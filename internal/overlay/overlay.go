@@ -0,0 +1,31 @@
+// Package overlay renders the watermark and banner the converters lay over
+// their output, for previews handed to third parties.  Both are plain
+// elements with inline styles, so they work in fragments as well as in
+// standalone documents, and neither blocks selecting the text beneath.
+package overlay
+
+import (
+	"fmt"
+	"html"
+)
+
+// Watermark returns a layer with text written diagonally across its
+// containing block.  position is the CSS position of the layer: "absolute"
+// to cover the nearest positioned ancestor, "fixed" to cover the viewport
+// and, when printed, every page.
+func Watermark(class, text, position string) string {
+	return fmt.Sprintf(`<div class="%s" aria-hidden="true" style="position:%s;top:0;right:0;bottom:0;left:0;z-index:1000;`+
+		`display:flex;align-items:center;justify-content:center;overflow:hidden;pointer-events:none;">`+
+		`<span style="transform:rotate(-30deg);font:bold 48px sans-serif;color:rgba(128,128,128,0.25);white-space:nowrap;">%s</span></div>`+"\n",
+		class, position, html.EscapeString(text))
+}
+
+// Banner returns a bar with text spanning the top of its containing block.
+// position is the CSS position of the bar: "absolute" to place it over the
+// top edge of the nearest positioned ancestor, "sticky" to keep it in view
+// while scrolling, "static" to leave it in the flow.
+func Banner(class, text, position string) string {
+	return fmt.Sprintf(`<div class="%s" role="note" style="position:%s;top:0;left:0;right:0;z-index:1001;`+
+		`padding:2px 8px;background:#b3261e;color:#fff;font:bold 12px sans-serif;text-align:center;">%s</div>`+"\n",
+		class, position, html.EscapeString(text))
+}
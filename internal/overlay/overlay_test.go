@@ -0,0 +1,17 @@
+package overlay
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEscapes(t *testing.T) {
+	for _, out := range []string{
+		Watermark("w", `<b>"x"</b>`, "fixed"),
+		Banner("b", `<b>"x"</b>`, "sticky"),
+	} {
+		if strings.Contains(out, "<b>") || !strings.Contains(out, "&lt;b&gt;&#34;x&#34;&lt;/b&gt;") {
+			t.Errorf("text not escaped: %s", out)
+		}
+	}
+}
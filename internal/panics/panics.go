@@ -0,0 +1,46 @@
+// Package panics attributes a panic in a parser to the part of the input
+// being read when it happened.  The parsers defer Annotate around their
+// walks, and the panic goes on unwinding with a *diag.PanicError in place
+// of its value.  The exported functions of packages docx, xlsx and rtf
+// that read input (the Parse*, Open*, Stream*, FingerprintWorkbook and
+// UpdateWorkbook functions, the built-in xlsx backends and the lazy
+// xlsx.Workbook methods) defer Catch, which returns it as their error.
+// The renderers, which only read models, do not; package convert recovers
+// their panics.
+package panics
+
+import (
+	"runtime/debug"
+
+	"github.com/aerissecure/convert/diag"
+)
+
+// Annotate, deferred, re-raises a panic as a *diag.PanicError located by
+// where, which is only called then.  A panic already annotated by an inner
+// walk passes through unchanged.
+func Annotate(where func() (part, ref string)) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	if _, ok := v.(*diag.PanicError); ok {
+		panic(v)
+	}
+	part, ref := where()
+	panic(&diag.PanicError{Part: part, Ref: ref, Value: v, Stack: debug.Stack()})
+}
+
+// Catch, deferred, stores a panic in *err as a *diag.PanicError, the one
+// raised by Annotate or, for a panic outside an annotated walk, one that
+// is not located.
+func Catch(err *error) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	if pe, ok := v.(*diag.PanicError); ok {
+		*err = pe
+		return
+	}
+	*err = &diag.PanicError{Value: v, Stack: debug.Stack()}
+}
@@ -0,0 +1,43 @@
+package pdf
+
+// Glyph advance widths of the standard fonts in 1/1000 em, for the
+// printable ASCII range 0x20-0x7E, from the Adobe Core14 AFM files.  Other
+// characters use the width of "n" (Courier: 600).  Times is measured with
+// the Helvetica metrics, which are slightly wider, so measured text never
+// overflows the space it was laid out in.
+
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+var helveticaBoldWidths = [95]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
+
+// glyphWidth returns the advance of the Windows-1252 byte b in font.
+func glyphWidth(font Font, b byte) int {
+	if font >= Courier {
+		return 600
+	}
+	bold := font == HelveticaBold || font == HelveticaBoldOblique || font == TimesBold || font == TimesBoldItalic
+	if b < 0x20 || b > 0x7E {
+		if bold {
+			return 611
+		}
+		return 556
+	}
+	if bold {
+		return helveticaBoldWidths[b-0x20]
+	}
+	return helveticaWidths[b-0x20]
+}
@@ -0,0 +1,324 @@
+// Package pdf writes simple PDF documents: pages of filled rectangles,
+// lines and single-line text in the 14 standard fonts, which every PDF
+// reader provides so nothing has to be embedded.  It is the output backend
+// of the converters' PDF renderers and deliberately knows nothing about
+// documents or spreadsheets.
+//
+// Coordinates are in points with the origin at the top-left corner of the
+// page and y growing downwards, like HTML and the converters' layouts; they
+// are flipped when the content stream is written.  Text is encoded as
+// Windows-1252 (WinAnsiEncoding); characters outside it are written as "?".
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Font is one of the standard PDF fonts.
+type Font int
+
+const (
+	Helvetica Font = iota
+	HelveticaBold
+	HelveticaOblique
+	HelveticaBoldOblique
+	Times
+	TimesBold
+	TimesItalic
+	TimesBoldItalic
+	Courier
+	CourierBold
+	CourierOblique
+	CourierBoldOblique
+	numFonts
+)
+
+var fontNames = [numFonts]string{
+	"Helvetica", "Helvetica-Bold", "Helvetica-Oblique", "Helvetica-BoldOblique",
+	"Times-Roman", "Times-Bold", "Times-Italic", "Times-BoldItalic",
+	"Courier", "Courier-Bold", "Courier-Oblique", "Courier-BoldOblique",
+}
+
+// FontFor picks the standard font closest to a font family name:
+// monospaced families map to Courier, serif families to Times and
+// everything else to Helvetica.
+func FontFor(family string, bold, italic bool) Font {
+	base := Helvetica
+	f := strings.ToLower(family)
+	switch {
+	case strings.Contains(f, "courier"), strings.Contains(f, "mono"), strings.Contains(f, "consolas"),
+		strings.Contains(f, "lucida console"):
+		base = Courier
+	case strings.Contains(f, "times"), strings.Contains(f, "serif") && !strings.Contains(f, "sans"),
+		strings.Contains(f, "cambria"), strings.Contains(f, "georgia"), strings.Contains(f, "garamond"),
+		strings.Contains(f, "book antiqua"), strings.Contains(f, "palatino"):
+		base = Times
+	}
+	if bold {
+		base++
+	}
+	if italic {
+		base += 2
+	}
+	return base
+}
+
+// Document is a PDF document being built.
+type Document struct {
+	pages []*Page
+	Title string // document information dictionary /Title, optional
+}
+
+// Page is one page of a Document.
+type Page struct {
+	width, height float64
+	content       bytes.Buffer
+	fonts         [numFonts]bool
+}
+
+// New returns an empty document.
+func New() *Document {
+	return &Document{}
+}
+
+// AddPage appends a page of the given size in points.
+func (d *Document) AddPage(width, height float64) *Page {
+	p := &Page{width: width, height: height}
+	d.pages = append(d.pages, p)
+	return p
+}
+
+// Pages returns the number of pages.
+func (d *Document) Pages() int {
+	return len(d.pages)
+}
+
+// Page returns page i, counting from 0.
+func (d *Document) Page(i int) *Page {
+	return d.pages[i]
+}
+
+// Size returns the width and height of the page in points.
+func (p *Page) Size() (width, height float64) {
+	return p.width, p.height
+}
+
+// num formats a coordinate compactly, to 1/1000 pt.
+func num(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1000)/1000, 'f', -1, 64)
+}
+
+// rgb parses "RRGGBB" into PDF colour components, defaulting to black.
+func rgb(hex string) string {
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 6 {
+		return "0 0 0"
+	}
+	c := func(shift uint) string { return num(float64((v>>shift)&0xFF) / 255) }
+	return c(16) + " " + c(8) + " " + c(0)
+}
+
+// FillRect fills a rectangle with the colour "RRGGBB".
+func (p *Page) FillRect(x, y, w, h float64, color string) {
+	fmt.Fprintf(&p.content, "%s rg %s %s %s %s re f\n", rgb(color), num(x), num(p.height-y-h), num(w), num(h))
+}
+
+// Line strokes a line of the given width and colour.
+func (p *Page) Line(x1, y1, x2, y2, width float64, color string) {
+	fmt.Fprintf(&p.content, "%s RG %s w %s %s m %s %s l S\n", rgb(color), num(width), num(x1), num(p.height-y1), num(x2), num(p.height-y2))
+}
+
+// DashedLine strokes a line like Line, dashed with the pattern of dash and
+// gap lengths in dash.
+func (p *Page) DashedLine(x1, y1, x2, y2, width float64, color string, dash ...float64) {
+	p.content.WriteString("q [")
+	for i, d := range dash {
+		if i > 0 {
+			p.content.WriteByte(' ')
+		}
+		p.content.WriteString(num(d))
+	}
+	p.content.WriteString("] 0 d ")
+	p.Line(x1, y1, x2, y2, width, color)
+	p.content.WriteString("Q\n")
+}
+
+// Clip restricts the following drawing to a rectangle until Restore.
+func (p *Page) Clip(x, y, w, h float64) {
+	fmt.Fprintf(&p.content, "q %s %s %s %s re W n\n", num(x), num(p.height-y-h), num(w), num(h))
+}
+
+// Restore ends the clipping started by the matching Clip.
+func (p *Page) Restore() {
+	p.content.WriteString("Q\n")
+}
+
+// Text draws s with its baseline starting at (x, y).
+func (p *Page) Text(x, y float64, font Font, size float64, color, s string) {
+	p.fonts[font] = true
+	fmt.Fprintf(&p.content, "BT %s rg /F%d %s Tf %s %s Td (%s) Tj ET\n",
+		rgb(color), font, num(size), num(x), num(p.height-y), escape(encode(s)))
+}
+
+// RotatedText draws s like Text, turned angle degrees anticlockwise about
+// the start of its baseline.
+func (p *Page) RotatedText(x, y, angle float64, font Font, size float64, color, s string) {
+	p.fonts[font] = true
+	sin, cos := math.Sincos(angle * math.Pi / 180)
+	fmt.Fprintf(&p.content, "BT %s rg /F%d %s Tf %s %s %s %s %s %s Tm (%s) Tj ET\n",
+		rgb(color), font, num(size), num(cos), num(sin), num(-sin), num(cos), num(x), num(p.height-y), escape(encode(s)))
+}
+
+// TextWidth returns the advance width of s in points.
+func TextWidth(font Font, size float64, s string) float64 {
+	total := 0
+	for _, b := range encode(s) {
+		total += glyphWidth(font, b)
+	}
+	return float64(total) * size / 1000
+}
+
+// WriteTo writes the document as PDF.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	cw := &countingWriter{w: bw}
+	var offsets []int64
+	obj := func(body string) int {
+		offsets = append(offsets, cw.n)
+		fmt.Fprintf(cw, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+		return len(offsets)
+	}
+	cw.WriteString("%PDF-1.4\n%\xE2\xE3\xCF\xD3\n")
+
+	// Object 1 is the catalog and 2 the page tree; reserve them.
+	offsets = append(offsets, 0, 0)
+	var fontRefs [numFonts]int
+	for _, p := range d.pages {
+		for f, used := range p.fonts {
+			if used && fontRefs[f] == 0 {
+				fontRefs[f] = obj(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", fontNames[f]))
+			}
+		}
+	}
+	var kids []string
+	for _, p := range d.pages {
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		zw.Write(p.content.Bytes())
+		zw.Close()
+		offsets = append(offsets, cw.n)
+		content := len(offsets)
+		fmt.Fprintf(cw, "%d 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", content, z.Len())
+		cw.Write(z.Bytes())
+		cw.WriteString("\nendstream\nendobj\n")
+
+		var res strings.Builder
+		for f, used := range p.fonts {
+			if used {
+				fmt.Fprintf(&res, " /F%d %d 0 R", f, fontRefs[f])
+			}
+		}
+		page := obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font <<%s >> >> /Contents %d 0 R >>",
+			num(p.width), num(p.height), res.String(), content))
+		kids = append(kids, fmt.Sprintf("%d 0 R", page))
+	}
+	info := 0
+	if d.Title != "" {
+		info = obj(fmt.Sprintf("<< /Title (%s) >>", escape(encode(d.Title))))
+	}
+
+	offsets[0] = cw.n
+	fmt.Fprintf(cw, "1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	offsets[1] = cw.n
+	fmt.Fprintf(cw, "2 0 obj\n<< /Type /Pages /Kids [%s] /Count %d >>\nendobj\n", strings.Join(kids, " "), len(kids))
+
+	xref := cw.n
+	fmt.Fprintf(cw, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(cw, "%010d 00000 n \n", off)
+	}
+	trailer := fmt.Sprintf("/Size %d /Root 1 0 R", len(offsets)+1)
+	if info != 0 {
+		trailer += fmt.Sprintf(" /Info %d 0 R", info)
+	}
+	fmt.Fprintf(cw, "trailer\n<< %s >>\nstartxref\n%d\n%%%%EOF\n", trailer, xref)
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, bw.Flush()
+}
+
+// countingWriter tracks the output offset for the cross-reference table and
+// keeps the first write error.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+func (c *countingWriter) WriteString(s string) {
+	c.Write([]byte(s))
+}
+
+// escape quotes a byte string for a PDF literal string.
+func escape(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		switch c {
+		case '(', ')', '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\n':
+			sb.WriteString(`\n`)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// encode converts s to Windows-1252.
+func encode(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r < 0x80 || r >= 0xA0 && r <= 0xFF:
+			out = append(out, byte(r))
+		default:
+			b, ok := winAnsiHigh[r]
+			if !ok {
+				b = '?'
+			}
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// winAnsiHigh maps the characters of bytes 0x80-0x9F.
+var winAnsiHigh = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87, 'ˆ': 0x88,
+	'‰': 0x89, 'Š': 0x8A, '‹': 0x8B, 'Œ': 0x8C, 'Ž': 0x8E, '‘': 0x91, '’': 0x92, '“': 0x93,
+	'”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '˜': 0x98, '™': 0x99, 'š': 0x9A, '›': 0x9B,
+	'œ': 0x9C, 'ž': 0x9E, 'Ÿ': 0x9F,
+	'\u2011': '-', '\u2002': ' ', '\u2003': ' ', '\u2009': ' ',
+}
@@ -0,0 +1,52 @@
+package pdf
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	d := New()
+	d.Title = "T (1)"
+	p := d.AddPage(612, 792)
+	p.FillRect(10, 10, 100, 20, "FF0000")
+	p.Text(12, 25, HelveticaBold, 12, "000000", "Grüße (€)")
+	p.DashedLine(10, 40, 110, 40, 0.5, "0000FF", 3, 1.5)
+	if want := "q [3 1.5] 0 d 0 0 1 RG 0.5 w 10 752 m 110 752 l S\nQ\n"; !bytes.HasSuffix(p.content.Bytes(), []byte(want)) {
+		t.Errorf("dashed line: %q", p.content.String())
+	}
+	p.RotatedText(100, 692, 90, Helvetica, 10, "000000", "up")
+	if want := "BT 0 0 0 rg /F0 10 Tf 0 1 -1 0 100 100 Tm (up) Tj ET\n"; !bytes.HasSuffix(p.content.Bytes(), []byte(want)) {
+		t.Errorf("rotated text: %q", p.content.String())
+	}
+	var buf bytes.Buffer
+	if _, err := d.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.Bytes()
+
+	// Every cross-reference entry must point at its object.
+	m := regexp.MustCompile(`startxref\n(\d+)`).FindSubmatch(out)
+	if m == nil {
+		t.Fatal("no startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(out[xref:], -1)
+	if len(entries) == 0 {
+		t.Fatal("empty xref table")
+	}
+	for i, e := range entries {
+		off, _ := strconv.Atoi(string(e[1]))
+		if want := strconv.Itoa(i+1) + " 0 obj"; !bytes.HasPrefix(out[off:], []byte(want)) {
+			t.Errorf("object %d: offset %d does not start %q", i+1, off, want)
+		}
+	}
+	if !bytes.Contains(out, []byte("/BaseFont /Helvetica-Bold")) || !bytes.Contains(out, []byte(`/Title (T \(1\))`)) {
+		t.Error("font or title missing")
+	}
+	if w := TextWidth(Helvetica, 10, "ab"); w != 11.12 {
+		t.Errorf("TextWidth = %v, want 11.12", w)
+	}
+}
@@ -0,0 +1,109 @@
+// Package safezip opens untrusted ZIP archives (OPC packages and
+// OpenDocument files) for the parsers.  NewReader checks the central
+// directory before any part is read: the number of parts, their
+// uncompressed sizes, alone and in total, and their compression ratio are
+// bounded, and names that could escape a directory or alias another part
+// are rejected.
+//
+// The checks use the declared sizes.  archive/zip fails reads that produce
+// more data than a part declares, so they also bound the readers built on
+// it, including unioffice's.
+package safezip
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Limits applied by NewReader.
+const (
+	MaxParts     = 10000     // parts in the archive
+	MaxPartSize  = 512 << 20 // uncompressed bytes of one part
+	MaxTotalSize = 2 << 30   // uncompressed bytes of all parts
+	MaxRatio     = 200       // uncompressed to compressed size of one part
+	// ratioFloor exempts small parts from MaxRatio; runs of identical
+	// XML compress extremely well without being a threat.
+	ratioFloor = 1 << 20
+)
+
+// ErrUnsafeName is wrapped by the error for a part name that is absolute
+// after its optional leading slash, contains a ".." segment, a backslash or
+// a drive letter, or repeats another name up to case.
+var ErrUnsafeName = errors.New("safezip: unsafe part name")
+
+// LimitError reports an archive exceeding one of the limits.
+type LimitError struct {
+	Limit string // "MaxParts", "MaxPartSize", "MaxTotalSize" or "MaxRatio"
+	Max   int64
+	Part  string // the part that exceeded it, empty for the whole archive
+}
+
+func (e *LimitError) Error() string {
+	msg := fmt.Sprintf("safezip: %s of %d exceeded", e.Limit, e.Max)
+	if e.Part != "" {
+		msg += " by " + e.Part
+	}
+	return msg
+}
+
+// NewReader opens the archive r/size and checks it.
+func NewReader(r io.ReaderAt, size int64) (*zip.Reader, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	if err := Check(zr); err != nil {
+		return nil, err
+	}
+	return zr, nil
+}
+
+// Check checks an open archive.
+func Check(zr *zip.Reader) error {
+	if len(zr.File) > MaxParts {
+		return &LimitError{Limit: "MaxParts", Max: MaxParts}
+	}
+	var total uint64
+	seen := make(map[string]bool, len(zr.File))
+	for _, f := range zr.File {
+		if err := checkName(f.Name); err != nil {
+			return err
+		}
+		key := strings.ToLower(strings.TrimPrefix(f.Name, "/"))
+		if seen[key] {
+			return fmt.Errorf("%w: duplicate %q", ErrUnsafeName, f.Name)
+		}
+		seen[key] = true
+
+		n := f.UncompressedSize64
+		switch {
+		case n > MaxPartSize:
+			return &LimitError{Limit: "MaxPartSize", Max: MaxPartSize, Part: f.Name}
+		case n > ratioFloor && n/MaxRatio > f.CompressedSize64:
+			return &LimitError{Limit: "MaxRatio", Max: MaxRatio, Part: f.Name}
+		}
+		if total += n; total > MaxTotalSize {
+			return &LimitError{Limit: "MaxTotalSize", Max: MaxTotalSize, Part: f.Name}
+		}
+	}
+	return nil
+}
+
+// checkName rejects names that are unsafe as paths.
+func checkName(name string) error {
+	p := strings.TrimPrefix(name, "/")
+	switch {
+	case p == "", strings.HasPrefix(p, "/"), strings.ContainsAny(p, "\\\x00"),
+		len(p) >= 2 && p[1] == ':':
+		return fmt.Errorf("%w: %q", ErrUnsafeName, name)
+	}
+	for _, seg := range strings.Split(p, "/") {
+		if seg == ".." {
+			return fmt.Errorf("%w: %q", ErrUnsafeName, name)
+		}
+	}
+	return nil
+}
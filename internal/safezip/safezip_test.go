@@ -0,0 +1,48 @@
+package safezip
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func archive(t *testing.T, files map[string]string) *bytes.Reader {
+	t.Helper()
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for name, data := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(data))
+	}
+	zw.Close()
+	return bytes.NewReader(b.Bytes())
+}
+
+func TestNewReader(t *testing.T) {
+	ok := archive(t, map[string]string{"[Content_Types].xml": "<Types/>", "word/document.xml": "<w:document/>"})
+	if _, err := NewReader(ok, ok.Size()); err != nil {
+		t.Errorf("valid archive: %v", err)
+	}
+
+	for _, name := range []string{"../evil.xml", "word/../../evil.xml", `word\..\evil.xml`, "//etc/passwd", "C:/evil.xml"} {
+		r := archive(t, map[string]string{name: "x"})
+		if _, err := NewReader(r, r.Size()); !errors.Is(err, ErrUnsafeName) {
+			t.Errorf("%q: err = %v", name, err)
+		}
+	}
+	dup := archive(t, map[string]string{"word/document.xml": "a", "Word/Document.xml": "b"})
+	if _, err := NewReader(dup, dup.Size()); !errors.Is(err, ErrUnsafeName) {
+		t.Errorf("duplicate: err = %v", err)
+	}
+
+	bomb := archive(t, map[string]string{"word/document.xml": strings.Repeat("a", 4<<20)})
+	var le *LimitError
+	if _, err := NewReader(bomb, bomb.Size()); !errors.As(err, &le) || le.Limit != "MaxRatio" || le.Part != "word/document.xml" {
+		t.Errorf("bomb: err = %v", err)
+	}
+}
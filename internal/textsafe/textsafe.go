@@ -0,0 +1,88 @@
+// Package textsafe repairs text taken from documents before it is emitted.
+// Generated files routinely carry invalid UTF-8 and control characters that
+// HTML tolerates badly and XML not at all, so downstream XML pipelines
+// choke on output that passed them through.  It is shared by the converters
+// so every output format applies the same rules.
+package textsafe
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Clean returns s with each invalid UTF-8 byte replaced by U+FFFD and the
+// characters XML 1.0 and HTML disallow removed: the C0 controls other than
+// tab, line feed and carriage return, DEL, the C1 controls and the
+// noncharacters U+FFFE and U+FFFF.  Text without them is returned unchanged.
+func Clean(s string) string {
+	i := firstBad(s)
+	if i < 0 {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	b.WriteString(s[:i])
+	for _, r := range s[i:] {
+		switch {
+		case r == utf8.RuneError:
+			// Both invalid bytes, which range decodes as RuneError, and
+			// U+FFFD itself are written as U+FFFD.
+			b.WriteRune(utf8.RuneError)
+		case disallowed(r):
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// CleanBytes is Clean for text held in a byte slice, which is returned as
+// is if it needs no repair.
+func CleanBytes(b []byte) []byte {
+	for i := 0; i < len(b); {
+		if c := b[i]; c < utf8.RuneSelf {
+			if c < 0x20 && c != '\t' && c != '\n' && c != '\r' || c == 0x7f {
+				return []byte(Clean(string(b)))
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRune(b[i:])
+		if r == utf8.RuneError && size == 1 || disallowed(r) {
+			return []byte(Clean(string(b)))
+		}
+		i += size
+	}
+	return b
+}
+
+// firstBad returns the index of the first invalid byte or disallowed
+// character in s, or -1.
+func firstBad(s string) int {
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c < 0x20 && c != '\t' && c != '\n' && c != '\r' || c == 0x7f {
+				return i
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 || disallowed(r) {
+			return i
+		}
+		i += size
+	}
+	return -1
+}
+
+func disallowed(r rune) bool {
+	switch {
+	case r < 0x20:
+		return r != '\t' && r != '\n' && r != '\r'
+	case r >= 0x7f && r <= 0x9f:
+		return true
+	}
+	return r == 0xfffe || r == 0xffff
+}
@@ -0,0 +1,20 @@
+package textsafe
+
+import "testing"
+
+func TestClean(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{"plain text\twith\r\nbreaks", "plain text\twith\r\nbreaks"},
+		{"héllo – 日本語 \U0001F600", "héllo – 日本語 \U0001F600"},
+		{"a\x00b\x0bc\x1fd\x7fe", "abcde"},
+		{"bad \xff\xfe utf-8 \xe2\x82", "bad �� utf-8 ��"},
+		{"c1 \u0085 and ￿ gone", "c1  and  gone"},
+	} {
+		if got := Clean(tt.in); got != tt.want {
+			t.Errorf("Clean(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if got := CleanBytes([]byte(tt.in)); string(got) != tt.want {
+			t.Errorf("CleanBytes(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package convert
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"math"
+	"strings"
+)
+
+// -----------------------------------------------------------------------------
+// Output and memory limits
+// -----------------------------------------------------------------------------
+//
+// Options.MaxOutputBytes bounds the HTML a conversion produces.  Documents
+// are rendered through a writer that stops the renderer at the limit;
+// workbooks are measured once rendered.  Either way the conversion fails
+// with a *LimitError, or with Options.TruncateOutput returns the HTML cut
+// at the last complete tag before the limit, followed by truncationNotice.
+//
+// Options.MemoryBudget is a coarser guard against the parsers: the memory a
+// conversion needs is estimated from the uncompressed size of the input
+// before parsing it, and input over budget is rejected.  What remains of
+// the budget also bounds the output, which is held in memory as a string.
+
+// memoryFactor approximates the memory the parsers need per byte of
+// uncompressed input; the XML of an OPC package is held as a DOM.
+const memoryFactor = 8
+
+// truncationNotice is appended to output cut by TruncateOutput.
+const truncationNotice = `<p class="convert-truncated" role="note">The rest of this document was not converted because it exceeds the size limit.</p>`
+
+// errOutputLimit stops a renderer writing to a limitWriter.
+var errOutputLimit = errors.New("convert: output limit reached")
+
+// limitWriter passes through up to max bytes to w.
+type limitWriter struct {
+	w   io.Writer
+	n   int64
+	max int64
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if l.n+int64(len(p)) <= l.max {
+		n, err := l.w.Write(p)
+		l.n += int64(n)
+		return n, err
+	}
+	n, err := l.w.Write(p[:l.max-l.n])
+	l.n += int64(n)
+	if err == nil {
+		err = errOutputLimit
+	}
+	return n, err
+}
+
+// outputLimit is the limit on the output of a conversion estimated to need
+// mem bytes, and the name of the option imposing it; zero means none.
+func outputLimit(opts Options, mem int64) (int64, string) {
+	limit, name := opts.MaxOutputBytes, "MaxOutputBytes"
+	if opts.MemoryBudget > 0 {
+		if left := opts.MemoryBudget - mem; limit <= 0 || left < limit {
+			limit, name = max(left, 1), "MemoryBudget"
+		}
+	}
+	if limit <= 0 {
+		return 0, ""
+	}
+	return limit, name
+}
+
+// limitOutput applies the limit named name of max bytes to html, which
+// overran it if over is set.
+func limitOutput(html string, over bool, max int64, name string, opts Options) (string, error) {
+	if !over && int64(len(html)) <= max {
+		return html, nil
+	}
+	if !opts.TruncateOutput {
+		return "", &LimitError{Limit: name, Max: max}
+	}
+	return truncateHTML(html, max), nil
+}
+
+// truncateHTML cuts html after its last complete tag that leaves room for
+// truncationNotice within max bytes, and appends the notice.  A limit too
+// small for the notice drops it, so the result never exceeds max.  Elements
+// left open are closed by the browser, but a cut inside a <style> block
+// backs up to before it: the '>' of a child combinator is no tag, and the
+// notice would be read as CSS.
+func truncateHTML(html string, max int64) string {
+	notice := truncationNotice
+	if max < int64(len(notice)) {
+		notice = ""
+	}
+	if keep := max - int64(len(notice)); keep < int64(len(html)) {
+		html = html[:keep]
+	}
+	return cutAtTag(html) + notice
+}
+
+// cutAtTag cuts html after its last '>' outside a <style> block.
+func cutAtTag(html string) string {
+	for {
+		i := strings.LastIndexByte(html, '>')
+		if i < 0 {
+			return ""
+		}
+		html = html[:i+1]
+		open := strings.LastIndex(html, "<style")
+		if open < 0 || strings.Contains(html[open:], "</style>") {
+			return html
+		}
+		html = html[:open]
+	}
+}
+
+// estimateMemory approximates the memory parsing r needs.  ZIP packages
+// are measured by the declared size of their parts, which safezip holds
+// them to; other input by its own size.
+func estimateMemory(r io.ReaderAt, size int64) int64 {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return size * memoryFactor
+	}
+	var n uint64
+	for _, f := range zr.File {
+		if n += f.UncompressedSize64; n > math.MaxInt64/memoryFactor {
+			return math.MaxInt64
+		}
+	}
+	return int64(n) * memoryFactor
+}
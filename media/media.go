@@ -0,0 +1,88 @@
+// Package media holds the image output strategies shared by the DOCX and
+// XLSX renderers.  A renderer hands every image it emits to an ImageHandler,
+// which decides what goes into the <img src> attribute: an inline data URI
+// (the default), a file written next to the HTML, or whatever a caller-supplied
+// function returns (e.g. a URL after uploading the image elsewhere).  It also
+// defines the Rasterizer hook used to turn SVG thumbnails into PNGs.
+package media
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Image is an image found in a document.
+type Image struct {
+	Name        string // part name inside the package, e.g. "word/media/image1.png"
+	ContentType string // MIME type, e.g. "image/png"
+	Data        []byte
+}
+
+// ImageHandler returns the src to use for an image.  An error aborts
+// rendering.
+type ImageHandler func(img Image) (src string, err error)
+
+// DataURI inlines the image as a base64 data URI.  It is the default
+// handler, producing self-contained HTML.
+func DataURI(img Image) (string, error) {
+	return "data:" + img.ContentType + ";base64," + base64.StdEncoding.EncodeToString(img.Data), nil
+}
+
+// WriteDir returns a handler that writes each image into dir and references
+// it as srcPrefix followed by the file name, e.g. WriteDir("out/img", "img")
+// for HTML saved as out/index.html.  Files are named after a hash of their
+// content, so images shared between documents are written once.
+func WriteDir(dir, srcPrefix string) ImageHandler {
+	return func(img Image) (string, error) {
+		name := FileName(img)
+		p := filepath.Join(dir, name)
+		if existing, err := os.ReadFile(p); err != nil || !bytes.Equal(existing, img.Data) {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return "", fmt.Errorf("media: %w", err)
+			}
+			if err := os.WriteFile(p, img.Data, 0o644); err != nil {
+				return "", fmt.Errorf("media: %w", err)
+			}
+		}
+		if srcPrefix == "" {
+			return name, nil
+		}
+		return path.Join(srcPrefix, name), nil
+	}
+}
+
+// FileName returns the content-addressed file name WriteDir uses for img:
+// a hash of the data plus an extension from the part name or content type.
+func FileName(img Image) string {
+	sum := sha256.Sum256(img.Data)
+	return hex.EncodeToString(sum[:8]) + extension(img)
+}
+
+func extension(img Image) string {
+	if ext := strings.ToLower(path.Ext(img.Name)); ext != "" {
+		return ext
+	}
+	switch img.ContentType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/svg+xml":
+		return ".svg"
+	}
+	if exts, _ := mime.ExtensionsByType(img.ContentType); len(exts) > 0 {
+		return exts[0]
+	}
+	return ".bin"
+}
+
+// Rasterizer converts an SVG document to a PNG of the given size in pixels.
+// The module ships no rasterizer of its own; callers plug one in, e.g. a
+// binding to resvg or librsvg, or a headless browser.
+type Rasterizer func(svg []byte, width, height int) (png []byte, err error)
@@ -0,0 +1,107 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestWriteDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "img")
+	h := WriteDir(dir, "img")
+	img := Image{Name: "word/media/image1.PNG", ContentType: "image/png", Data: []byte("\x89PNG")}
+	src, err := h(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(src, "img/") || !strings.HasSuffix(src, ".png") {
+		t.Errorf("unexpected src %q", src)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, strings.TrimPrefix(src, "img/")))
+	if err != nil || string(data) != string(img.Data) {
+		t.Errorf("image not written: %v", err)
+	}
+	if again, _ := h(Image{ContentType: "image/png", Data: img.Data, Name: "other.png"}); again != src {
+		t.Errorf("same content got different src %q and %q", src, again)
+	}
+	if jpg := FileName(Image{ContentType: "image/jpeg", Data: []byte("x")}); !strings.HasSuffix(jpg, ".jpg") {
+		t.Errorf("unexpected name %q", jpg)
+	}
+}
+
+func TestDataURI(t *testing.T) {
+	src, _ := DataURI(Image{ContentType: "image/gif", Data: []byte("GIF89a")})
+	if src != "data:image/gif;base64,R0lGODlh" {
+		t.Errorf("unexpected data URI %q", src)
+	}
+}
+
+// metafile assembles little-endian values into a byte slice.
+func metafile(vals ...any) []byte {
+	var b bytes.Buffer
+	for _, v := range vals {
+		binary.Write(&b, binary.LittleEndian, v)
+	}
+	return b.Bytes()
+}
+
+func TestMetafileToSVG(t *testing.T) {
+	// EMF: header, a red brush, a rectangle, a text run and EOF.
+	header := metafile(uint32(1), uint32(88),
+		int32(0), int32(0), int32(99), int32(49), // bounds, device units
+		int32(0), int32(0), int32(2540), int32(1270), // frame, 0.01 mm
+		uint32(0x464D4520), uint32(0x10000), uint32(0), uint32(0), uint16(1), uint16(0),
+		uint32(0), uint32(0), uint32(0),
+		int32(1000), int32(1000), int32(254), int32(254)) // 100 dpi reference device
+	text := utf16.Encode([]rune("Hi"))
+	emf := slices.Concat(header,
+		metafile(uint32(39), uint32(24), uint32(1), uint32(0), uint32(0x0000FF), uint32(0)),
+		metafile(uint32(37), uint32(12), uint32(1)),
+		metafile(uint32(43), uint32(24), int32(10), int32(10), int32(50), int32(40)),
+		metafile(uint32(84), uint32(80), [4]int32{}, uint32(1), float32(0), float32(0),
+			int32(5), int32(6), uint32(len(text)), uint32(76), uint32(0), [4]int32{}, uint32(0), text),
+		metafile(uint32(14), uint32(20), uint32(0), uint32(0), uint32(20)))
+	svg, err := MetafileToSVG(emf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`width="96" height="48"`, `<rect x="10" y="10" width="40" height="30" fill="#ff0000"`, `>Hi</text>`} {
+		if !strings.Contains(string(svg), want) {
+			t.Errorf("EMF: %q missing from\n%s", want, svg)
+		}
+	}
+
+	// WMF: placeable header (1 inch = 1000 units), window, a polygon.
+	wmf := metafile(uint32(0x9AC6CDD7), uint16(0), int16(0), int16(0), int16(1000), int16(500), uint16(1000), uint32(0), uint16(0),
+		uint16(1), uint16(9), uint16(0x300), uint32(0), uint16(0), uint32(0), uint16(0),
+		uint32(5), uint16(0x020C), int16(500), int16(1000),
+		uint32(10), uint16(0x0324), int16(3), int16(0), int16(0), int16(1000), int16(0), int16(500), int16(500),
+		uint32(3), uint16(0))
+	svg, err = MetafileToSVG(wmf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(svg); !strings.Contains(s, `width="96" height="48"`) || !strings.Contains(s, `d="M0 0 L96 0 L48 48 Z"`) {
+		t.Errorf("WMF:\n%s", s)
+	}
+
+	// A bitmap record is left to the rasterizer.
+	bitmap := slices.Concat(header, metafile(uint32(81), uint32(8)))
+	if _, err := MetafileToSVG(bitmap); !errors.Is(err, ErrUnsupportedMetafile) {
+		t.Errorf("bitmap: err = %v", err)
+	}
+	img := Image{Name: "word/media/image1.emf", ContentType: "image/x-emf", Data: bitmap}
+	if _, ok := WebImage(img, nil); ok {
+		t.Error("bitmap converted without a rasterizer")
+	}
+	png, ok := WebImage(img, func([]byte, string) ([]byte, error) { return []byte("\x89PNG"), nil })
+	if !ok || png.ContentType != "image/png" || png.Name != "word/media/image1.png" {
+		t.Errorf("rasterized = %+v, %t", png, ok)
+	}
+}
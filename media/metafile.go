@@ -0,0 +1,1154 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"html"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// -----------------------------------------------------------------------------
+// Windows metafiles
+// -----------------------------------------------------------------------------
+//
+// Office documents often carry images, and nearly always the previews of
+// embedded objects, as Windows metafiles (WMF, or EMF for 32-bit ones),
+// which no browser displays.  MetafileToSVG replays the simple drawing
+// records of a metafile (lines, polygons, rectangles, ellipses, Bézier
+// curves, paths and text, with pens, brushes, fonts and the mapping modes)
+// into an SVG document.  Metafiles using anything else, chiefly embedded
+// bitmaps, arcs and regions, are rejected with ErrUnsupportedMetafile so a
+// MetafileRasterizer can take over.  Clipping is ignored.
+
+// ErrUnsupportedMetafile is returned by MetafileToSVG for metafiles using
+// records it does not convert.
+var ErrUnsupportedMetafile = errors.New("media: unsupported metafile content")
+
+// errNotMetafile is returned by MetafileToSVG for data that is neither an
+// EMF nor a WMF file.
+var errNotMetafile = errors.New("media: not a Windows metafile")
+
+// MetafileRasterizer converts a WMF or EMF image MetafileToSVG cannot
+// handle to PNG.  The module ships none; callers plug one in, e.g. a
+// binding to libwmf or a LibreOffice or ImageMagick process.
+type MetafileRasterizer func(data []byte, contentType string) (png []byte, err error)
+
+// BrowserImage reports whether browsers can display images of the given
+// MIME type.
+func BrowserImage(contentType string) bool {
+	switch contentType {
+	case "image/png", "image/jpeg", "image/gif", "image/bmp", "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// IsMetafile reports whether contentType is that of a WMF or EMF image.
+func IsMetafile(contentType string) bool {
+	switch contentType {
+	case "image/x-emf", "image/emf", "image/x-wmf", "image/wmf":
+		return true
+	}
+	return false
+}
+
+// WebImage returns img in a format browsers display.  Such images are
+// returned unchanged; metafiles are converted to SVG with MetafileToSVG or,
+// failing that, to PNG with r if it is not nil.  The converted image's Name
+// gets the extension of its new type.  ok is false if img cannot be shown.
+func WebImage(img Image, r MetafileRasterizer) (_ Image, ok bool) {
+	if BrowserImage(img.ContentType) {
+		return img, true
+	}
+	if !IsMetafile(img.ContentType) {
+		return Image{}, false
+	}
+	if svg, err := MetafileToSVG(img.Data); err == nil {
+		return Image{Name: renameExt(img.Name, ".svg"), ContentType: "image/svg+xml", Data: svg}, true
+	}
+	if r != nil {
+		if png, err := r(img.Data, img.ContentType); err == nil {
+			return Image{Name: renameExt(img.Name, ".png"), ContentType: "image/png", Data: png}, true
+		}
+	}
+	return Image{}, false
+}
+
+func renameExt(name, ext string) string {
+	if name == "" {
+		return ""
+	}
+	return strings.TrimSuffix(name, path.Ext(name)) + ext
+}
+
+// MetafileToSVG converts a WMF or EMF image, told apart by content, to an
+// SVG document sized as the metafile's frame.
+func MetafileToSVG(data []byte) ([]byte, error) {
+	if len(data) >= 44 && le32(data, 0) == 1 && le32(data, 40) == 0x464D4520 {
+		return emfToSVG(data)
+	}
+	return wmfToSVG(data)
+}
+
+// -----------------------------------------------------------------------------
+// Drawing state and SVG output
+// -----------------------------------------------------------------------------
+
+type mfPen struct {
+	null  bool
+	width float64 // logical units; 0 is one device pixel
+	color string
+	dash  string // stroke-dasharray, in multiples of the width
+}
+
+type mfBrush struct {
+	null  bool
+	color string
+}
+
+type mfFont struct {
+	height     float64 // logical units
+	weight     int
+	italic     bool
+	underline  bool
+	strike     bool
+	escapement float64 // tenths of a degree, counter-clockwise
+	face       string
+}
+
+// mfObject is a GDI object; all fields nil for objects that only hold an
+// index, such as palettes.
+type mfObject struct {
+	pen   *mfPen
+	brush *mfBrush
+	font  *mfFont
+}
+
+// mfState is the part of the device context saved by SaveDC.
+type mfState struct {
+	pen       mfPen
+	brush     mfBrush
+	font      mfFont
+	textColor string
+	textAlign uint32
+	evenOdd   bool
+	cur       [2]float64 // current position, logical
+
+	mapMode        uint32
+	winOrg, winExt [2]float64
+	vpOrg, vpExt   [2]float64
+	xform          [6]float64 // EMF world transform: m11 m12 m21 m22 dx dy
+}
+
+// mfCanvas accumulates the SVG elements of a metafile.
+type mfCanvas struct {
+	b     strings.Builder
+	st    mfState
+	saved []mfState
+	// pxPerMM is the resolution of the EMF reference device, for the
+	// metric mapping modes.
+	pxPerMM [2]float64
+	// path holds the figures between EMF BeginPath and EndPath; inPath is
+	// set while they are recorded.
+	path   strings.Builder
+	inPath bool
+}
+
+func newCanvas() *mfCanvas {
+	c := &mfCanvas{}
+	c.st = mfState{
+		pen:       mfPen{color: "#000000"},
+		brush:     mfBrush{color: "#ffffff"},
+		textColor: "#000000",
+		mapMode:   1,
+		winExt:    [2]float64{1, 1},
+		vpExt:     [2]float64{1, 1},
+		xform:     [6]float64{1, 0, 0, 1, 0, 0},
+	}
+	return c
+}
+
+// scale returns the device units per logical unit of the current mapping
+// mode.
+func (c *mfCanvas) scale() (float64, float64) {
+	mm := func(unit float64) (float64, float64) {
+		return unit * c.pxPerMM[0], -unit * c.pxPerMM[1]
+	}
+	switch c.st.mapMode {
+	case 2: // MM_LOMETRIC
+		return mm(0.1)
+	case 3: // MM_HIMETRIC
+		return mm(0.01)
+	case 4: // MM_LOENGLISH
+		return mm(0.254)
+	case 5: // MM_HIENGLISH
+		return mm(0.0254)
+	case 6: // MM_TWIPS
+		return mm(25.4 / 1440)
+	case 7, 8: // MM_ISOTROPIC, MM_ANISOTROPIC
+		sx, sy := c.st.vpExt[0]/c.st.winExt[0], c.st.vpExt[1]/c.st.winExt[1]
+		if c.st.mapMode == 7 {
+			m := math.Min(math.Abs(sx), math.Abs(sy))
+			sx, sy = math.Copysign(m, sx), math.Copysign(m, sy)
+		}
+		return sx, sy
+	}
+	return 1, 1
+}
+
+// pt maps a logical point to device coordinates.
+func (c *mfCanvas) pt(x, y float64) (float64, float64) {
+	m := c.st.xform
+	x, y = m[0]*x+m[2]*y+m[4], m[1]*x+m[3]*y+m[5]
+	sx, sy := c.scale()
+	return (x-c.st.winOrg[0])*sx + c.st.vpOrg[0], (y-c.st.winOrg[1])*sy + c.st.vpOrg[1]
+}
+
+// size maps a logical length to device units.
+func (c *mfCanvas) size(v float64) float64 {
+	sx, _ := c.scale()
+	m := c.st.xform
+	return math.Abs(v * sx * math.Hypot(m[0], m[1]))
+}
+
+func num(v float64) string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return "0"
+	}
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
+
+func colorRef(v uint32) string {
+	return fmt.Sprintf("#%02x%02x%02x", v&0xFF, v>>8&0xFF, v>>16&0xFF)
+}
+
+func (c *mfCanvas) strokeAttrs() string {
+	p := c.st.pen
+	if p.null {
+		return ` stroke="none"`
+	}
+	if p.width == 0 {
+		return fmt.Sprintf(` stroke="%s" stroke-width="1" vector-effect="non-scaling-stroke"`, p.color)
+	}
+	w := c.size(p.width)
+	s := fmt.Sprintf(` stroke="%s" stroke-width="%s"`, p.color, num(w))
+	if p.dash != "" {
+		var parts []string
+		for _, f := range strings.Fields(p.dash) {
+			n, _ := strconv.ParseFloat(f, 64)
+			parts = append(parts, num(n*math.Max(w, 1)))
+		}
+		s += ` stroke-dasharray="` + strings.Join(parts, " ") + `"`
+	}
+	return s
+}
+
+func (c *mfCanvas) fillAttrs() string {
+	if c.st.brush.null {
+		return ` fill="none"`
+	}
+	s := fmt.Sprintf(` fill="%s"`, c.st.brush.color)
+	if c.st.evenOdd {
+		s += ` fill-rule="evenodd"`
+	}
+	return s
+}
+
+// figure returns the path data of a polyline through pts (logical x, y
+// pairs), closed if closed is set.
+func (c *mfCanvas) figure(pts [][2]float64, closed bool) string {
+	var d strings.Builder
+	for i, p := range pts {
+		x, y := c.pt(p[0], p[1])
+		if i == 0 {
+			d.WriteString("M")
+		} else {
+			d.WriteString(" L")
+		}
+		d.WriteString(num(x) + " " + num(y))
+	}
+	if closed && len(pts) > 0 {
+		d.WriteString(" Z")
+	}
+	return d.String()
+}
+
+// drawPath emits path data with the current pen, and brush if filled.
+func (c *mfCanvas) drawPath(d string, filled, stroked bool) {
+	if d == "" {
+		return
+	}
+	fill, stroke := ` fill="none"`, ` stroke="none"`
+	if filled {
+		fill = c.fillAttrs()
+	}
+	if stroked {
+		stroke = c.strokeAttrs()
+	}
+	fmt.Fprintf(&c.b, "<path d=\"%s\"%s%s/>\n", d, fill, stroke)
+}
+
+// poly draws a polygon or polyline, or adds it to the open path.
+func (c *mfCanvas) poly(pts [][2]float64, closed bool) {
+	if len(pts) == 0 {
+		return
+	}
+	d := c.figure(pts, closed)
+	c.st.cur = pts[len(pts)-1]
+	if c.inPath {
+		c.path.WriteString(d + " ")
+		return
+	}
+	c.drawPath(d, closed, true)
+}
+
+// polyTo continues the current figure of the open path (or a line from the
+// current position) through pts; bezier takes them as control and end
+// points of cubic curves.
+func (c *mfCanvas) polyTo(pts [][2]float64, bezier bool) {
+	if len(pts) == 0 {
+		return
+	}
+	var d strings.Builder
+	if !c.inPath {
+		x, y := c.pt(c.st.cur[0], c.st.cur[1])
+		d.WriteString("M" + num(x) + " " + num(y) + " ")
+	}
+	if bezier {
+		d.WriteString("C")
+	} else {
+		d.WriteString("L")
+	}
+	for _, p := range pts {
+		x, y := c.pt(p[0], p[1])
+		d.WriteString(" " + num(x) + " " + num(y))
+	}
+	c.st.cur = pts[len(pts)-1]
+	if c.inPath {
+		c.path.WriteString(d.String() + " ")
+		return
+	}
+	c.drawPath(d.String(), false, true)
+}
+
+// bezier draws cubic curves through pts: a start point, then control,
+// control and end points for each curve.
+func (c *mfCanvas) bezier(pts [][2]float64) {
+	if len(pts) == 0 {
+		return
+	}
+	c.moveTo(pts[0][0], pts[0][1])
+	c.polyTo(pts[1:], true)
+}
+
+func (c *mfCanvas) moveTo(x, y float64) {
+	c.st.cur = [2]float64{x, y}
+	if c.inPath {
+		dx, dy := c.pt(x, y)
+		c.path.WriteString("M" + num(dx) + " " + num(dy) + " ")
+	}
+}
+
+func (c *mfCanvas) lineTo(x, y float64) {
+	c.polyTo([][2]float64{{x, y}}, false)
+}
+
+// rect draws a rectangle from logical corners; rx, ry round its corners.
+func (c *mfCanvas) rect(l, t, r, b, rx, ry float64) {
+	if c.inPath {
+		c.poly([][2]float64{{l, t}, {r, t}, {r, b}, {l, b}}, true)
+		return
+	}
+	x1, y1 := c.pt(l, t)
+	x2, y2 := c.pt(r, b)
+	round := ""
+	if rx > 0 || ry > 0 {
+		round = fmt.Sprintf(` rx="%s" ry="%s"`, num(c.size(rx)/2), num(c.size(ry)/2))
+	}
+	fmt.Fprintf(&c.b, "<rect x=\"%s\" y=\"%s\" width=\"%s\" height=\"%s\"%s%s%s/>\n",
+		num(math.Min(x1, x2)), num(math.Min(y1, y2)), num(math.Abs(x2-x1)), num(math.Abs(y2-y1)),
+		round, c.fillAttrs(), c.strokeAttrs())
+}
+
+// fillRect fills a rectangle with the brush, without outline.
+func (c *mfCanvas) fillRect(l, t, r, b float64) {
+	pen := c.st.pen
+	c.st.pen.null = true
+	c.rect(l, t, r, b, 0, 0)
+	c.st.pen = pen
+}
+
+func (c *mfCanvas) ellipse(l, t, r, b float64) {
+	x1, y1 := c.pt(l, t)
+	x2, y2 := c.pt(r, b)
+	fmt.Fprintf(&c.b, "<ellipse cx=\"%s\" cy=\"%s\" rx=\"%s\" ry=\"%s\"%s%s/>\n",
+		num((x1+x2)/2), num((y1+y2)/2), num(math.Abs(x2-x1)/2), num(math.Abs(y2-y1)/2),
+		c.fillAttrs(), c.strokeAttrs())
+}
+
+// text draws s at the logical point x, y, or at the current position when
+// the alignment says so.
+func (c *mfCanvas) text(x, y float64, s string) {
+	if strings.TrimSpace(s) == "" {
+		return
+	}
+	align := c.st.textAlign
+	if align&1 != 0 { // TA_UPDATECP
+		x, y = c.st.cur[0], c.st.cur[1]
+	}
+	dx, dy := c.pt(x, y)
+	f := c.st.font
+	_, sy := c.scale()
+	size := math.Abs(f.height * sy)
+	if size == 0 {
+		size = 16
+	}
+	var attrs strings.Builder
+	fmt.Fprintf(&attrs, ` x="%s" y="%s" font-size="%s"`, num(dx), num(dy), num(size))
+	if f.face != "" {
+		fmt.Fprintf(&attrs, ` font-family="%s"`, html.EscapeString(f.face))
+	}
+	if f.weight >= 600 {
+		attrs.WriteString(` font-weight="bold"`)
+	}
+	if f.italic {
+		attrs.WriteString(` font-style="italic"`)
+	}
+	switch {
+	case f.underline:
+		attrs.WriteString(` text-decoration="underline"`)
+	case f.strike:
+		attrs.WriteString(` text-decoration="line-through"`)
+	}
+	switch align & 6 {
+	case 2: // TA_RIGHT
+		attrs.WriteString(` text-anchor="end"`)
+	case 6: // TA_CENTER
+		attrs.WriteString(` text-anchor="middle"`)
+	}
+	switch align & 24 {
+	case 0: // TA_TOP
+		attrs.WriteString(` dominant-baseline="text-before-edge"`)
+	case 8: // TA_BOTTOM
+		attrs.WriteString(` dominant-baseline="text-after-edge"`)
+	}
+	if f.escapement != 0 {
+		fmt.Fprintf(&attrs, ` transform="rotate(%s %s %s)"`, num(-f.escapement/10), num(dx), num(dy))
+	}
+	fmt.Fprintf(&c.b, "<text%s fill=\"%s\" xml:space=\"preserve\">%s</text>\n", attrs.String(), c.st.textColor, html.EscapeString(s))
+}
+
+func (c *mfCanvas) save() {
+	c.saved = append(c.saved, c.st)
+}
+
+// restore pops the state saved n levels up (n < 0, relative) or at level n
+// (n > 0, absolute).
+func (c *mfCanvas) restore(n int) {
+	i := len(c.saved) + n
+	if n > 0 {
+		i = n - 1
+	}
+	if i < 0 || i >= len(c.saved) {
+		return
+	}
+	c.st = c.saved[i]
+	c.saved = c.saved[:i]
+}
+
+func (c *mfCanvas) selectObject(o *mfObject) {
+	switch {
+	case o == nil:
+	case o.pen != nil:
+		c.st.pen = *o.pen
+	case o.brush != nil:
+		c.st.brush = *o.brush
+	case o.font != nil:
+		c.st.font = *o.font
+	}
+}
+
+// svg wraps the elements in an SVG document showing the device rectangle
+// x, y, w, h at w x h CSS pixels scaled to width x height.
+func (c *mfCanvas) svg(x, y, w, h, width, height float64) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<svg xmlns=\"http://www.w3.org/2000/svg\" viewBox=\"%s %s %s %s\" width=\"%s\" height=\"%s\" preserveAspectRatio=\"none\">\n",
+		num(x), num(y), num(w), num(h), num(width), num(height))
+	b.WriteString(c.b.String())
+	b.WriteString("</svg>\n")
+	return []byte(b.String())
+}
+
+// penDash returns the dash pattern of a GDI pen style.
+func penDash(style uint32) string {
+	switch style & 0x0F {
+	case 1: // PS_DASH
+		return "3 1"
+	case 2: // PS_DOT
+		return "1 1"
+	case 3: // PS_DASHDOT
+		return "3 1 1 1"
+	case 4: // PS_DASHDOTDOT
+		return "3 1 1 1 1 1"
+	}
+	return ""
+}
+
+// stockObject returns the EMF stock object with the given index (without
+// its high bit).
+func stockObject(i uint32) *mfObject {
+	switch i {
+	case 0: // WHITE_BRUSH
+		return &mfObject{brush: &mfBrush{color: "#ffffff"}}
+	case 1: // LTGRAY_BRUSH
+		return &mfObject{brush: &mfBrush{color: "#c0c0c0"}}
+	case 2: // GRAY_BRUSH
+		return &mfObject{brush: &mfBrush{color: "#808080"}}
+	case 3: // DKGRAY_BRUSH
+		return &mfObject{brush: &mfBrush{color: "#404040"}}
+	case 4: // BLACK_BRUSH
+		return &mfObject{brush: &mfBrush{color: "#000000"}}
+	case 5: // NULL_BRUSH
+		return &mfObject{brush: &mfBrush{null: true}}
+	case 6: // WHITE_PEN
+		return &mfObject{pen: &mfPen{color: "#ffffff"}}
+	case 7: // BLACK_PEN
+		return &mfObject{pen: &mfPen{color: "#000000"}}
+	case 8: // NULL_PEN
+		return &mfObject{pen: &mfPen{null: true}}
+	case 18: // DC_BRUSH
+		return &mfObject{brush: &mfBrush{color: "#ffffff"}}
+	case 19: // DC_PEN
+		return &mfObject{pen: &mfPen{color: "#000000"}}
+	case 10, 11, 12, 13, 14, 16, 17: // the stock fonts
+		return &mfObject{font: &mfFont{}}
+	}
+	return &mfObject{}
+}
+
+// -----------------------------------------------------------------------------
+// EMF
+// -----------------------------------------------------------------------------
+
+func emfToSVG(d []byte) ([]byte, error) {
+	if len(d) < 88 {
+		return nil, errNotMetafile
+	}
+	c := newCanvas()
+	bounds := [4]float64{float64(i32(d, 8)), float64(i32(d, 12)), float64(i32(d, 16)), float64(i32(d, 20))}
+	frame := [4]float64{float64(i32(d, 24)), float64(i32(d, 28)), float64(i32(d, 32)), float64(i32(d, 36))}
+	dev := [2]float64{float64(i32(d, 72)), float64(i32(d, 76))}
+	mm := [2]float64{float64(i32(d, 80)), float64(i32(d, 84))}
+	if dev[0] <= 0 || dev[1] <= 0 || mm[0] <= 0 || mm[1] <= 0 {
+		return nil, errNotMetafile
+	}
+	c.pxPerMM = [2]float64{dev[0] / mm[0], dev[1] / mm[1]}
+	objects := map[uint32]*mfObject{}
+
+	for off := 0; off+8 <= len(d); {
+		typ, size := le32(d, off), int(le32(d, off+4))
+		if size < 8 || size%4 != 0 || off+size > len(d) {
+			return nil, fmt.Errorf("media: EMF record at %d has bad size %d", off, size)
+		}
+		r := d[off+8 : off+size]
+		off += size
+		if err := c.emfRecord(typ, r, objects); err != nil {
+			return nil, err
+		}
+		if typ == 14 { // EMR_EOF
+			break
+		}
+	}
+
+	// The picture is the frame (0.01 mm), shown in device units.
+	wmm, hmm := (frame[2]-frame[0])/100, (frame[3]-frame[1])/100
+	x, y := frame[0]/100*c.pxPerMM[0], frame[1]/100*c.pxPerMM[1]
+	w, h := wmm*c.pxPerMM[0], hmm*c.pxPerMM[1]
+	if w <= 0 || h <= 0 {
+		x, y, w, h = bounds[0], bounds[1], bounds[2]-bounds[0]+1, bounds[3]-bounds[1]+1
+		wmm, hmm = w/c.pxPerMM[0], h/c.pxPerMM[1]
+	}
+	if w <= 0 || h <= 0 {
+		return nil, ErrUnsupportedMetafile
+	}
+	return c.svg(x, y, w, h, wmm/25.4*96, hmm/25.4*96), nil
+}
+
+// emfRecord replays one EMF record with parameters r.
+func (c *mfCanvas) emfRecord(typ uint32, r []byte, objects map[uint32]*mfObject) error {
+	need := func(n int) bool { return len(r) >= n }
+	switch typ {
+	case 1, 14: // EMR_HEADER, EMR_EOF
+
+	case 9, 10, 11, 12: // EMR_SETWINDOWEXTEX, SETWINDOWORGEX, SETVIEWPORTEXTEX, SETVIEWPORTORGEX
+		if !need(8) {
+			return ErrUnsupportedMetafile
+		}
+		p := [2]float64{float64(i32(r, 0)), float64(i32(r, 4))}
+		switch typ {
+		case 9:
+			if p[0] == 0 || p[1] == 0 {
+				return ErrUnsupportedMetafile
+			}
+			c.st.winExt = p
+		case 10:
+			c.st.winOrg = p
+		case 11:
+			c.st.vpExt = p
+		case 12:
+			c.st.vpOrg = p
+		}
+	case 17: // EMR_SETMAPMODE
+		if need(4) {
+			c.st.mapMode = le32(r, 0)
+		}
+	case 19: // EMR_SETPOLYFILLMODE
+		if need(4) {
+			c.st.evenOdd = le32(r, 0) == 1
+		}
+	case 22: // EMR_SETTEXTALIGN
+		if need(4) {
+			c.st.textAlign = le32(r, 0)
+		}
+	case 24: // EMR_SETTEXTCOLOR
+		if need(4) {
+			c.st.textColor = colorRef(le32(r, 0))
+		}
+	case 27: // EMR_MOVETOEX
+		if need(8) {
+			c.moveTo(float64(i32(r, 0)), float64(i32(r, 4)))
+		}
+	case 54: // EMR_LINETO
+		if need(8) {
+			c.lineTo(float64(i32(r, 0)), float64(i32(r, 4)))
+		}
+	case 33: // EMR_SAVEDC
+		c.save()
+	case 34: // EMR_RESTOREDC
+		if need(4) {
+			c.restore(int(i32(r, 0)))
+		}
+	case 35, 36: // EMR_SETWORLDTRANSFORM, EMR_MODIFYWORLDTRANSFORM
+		if !need(24) {
+			return ErrUnsupportedMetafile
+		}
+		var m [6]float64
+		for i := range m {
+			m[i] = float64(math.Float32frombits(le32(r, 4*i)))
+		}
+		mode := uint32(4)
+		if typ == 36 && need(28) {
+			mode = le32(r, 24)
+		}
+		switch mode {
+		case 1: // MWT_IDENTITY
+			c.st.xform = [6]float64{1, 0, 0, 1, 0, 0}
+		case 2: // MWT_LEFTMULTIPLY
+			c.st.xform = mulXform(m, c.st.xform)
+		case 3: // MWT_RIGHTMULTIPLY
+			c.st.xform = mulXform(c.st.xform, m)
+		default: // MWT_SET
+			c.st.xform = m
+		}
+	case 37: // EMR_SELECTOBJECT
+		if need(4) {
+			ih := le32(r, 0)
+			if ih&0x80000000 != 0 {
+				c.selectObject(stockObject(ih &^ 0x80000000))
+			} else {
+				c.selectObject(objects[ih])
+			}
+		}
+	case 40: // EMR_DELETEOBJECT
+		if need(4) {
+			delete(objects, le32(r, 0))
+		}
+	case 38: // EMR_CREATEPEN
+		if need(20) {
+			style := le32(r, 4)
+			objects[le32(r, 0)] = &mfObject{pen: &mfPen{
+				null: style&0x0F == 5, width: float64(i32(r, 8)), color: colorRef(le32(r, 16)), dash: penDash(style),
+			}}
+		}
+	case 95: // EMR_EXTCREATEPEN
+		if need(36) {
+			style := le32(r, 20)
+			objects[le32(r, 0)] = &mfObject{pen: &mfPen{
+				null: style&0x0F == 5 || le32(r, 28) == 1, width: float64(le32(r, 24)), color: colorRef(le32(r, 32)), dash: penDash(style),
+			}}
+		}
+	case 39: // EMR_CREATEBRUSHINDIRECT
+		if need(16) {
+			// Hatched brushes are drawn solid.
+			objects[le32(r, 0)] = &mfObject{brush: &mfBrush{null: le32(r, 4) == 1, color: colorRef(le32(r, 8))}}
+		}
+	case 82: // EMR_EXTCREATEFONTINDIRECTW
+		if need(96) {
+			objects[le32(r, 0)] = &mfObject{font: &mfFont{
+				height:     float64(i32(r, 4)),
+				escapement: float64(i32(r, 12)),
+				weight:     int(i32(r, 20)),
+				italic:     r[24] != 0,
+				underline:  r[25] != 0,
+				strike:     r[26] != 0,
+				face:       utf16String(r[32:96]),
+			}}
+		}
+	case 49, 99: // EMR_CREATEPALETTE, EMR_CREATECOLORSPACE
+		if need(4) {
+			objects[le32(r, 0)] = &mfObject{}
+		}
+
+	case 43, 42, 44: // EMR_RECTANGLE, EMR_ELLIPSE, EMR_ROUNDRECT
+		if !need(16) {
+			return ErrUnsupportedMetafile
+		}
+		l, t, rt, b := float64(i32(r, 0)), float64(i32(r, 4)), float64(i32(r, 8)), float64(i32(r, 12))
+		switch {
+		case typ == 42:
+			c.ellipse(l, t, rt, b)
+		case typ == 44 && need(24):
+			c.rect(l, t, rt, b, float64(i32(r, 16)), float64(i32(r, 20)))
+		default:
+			c.rect(l, t, rt, b, 0, 0)
+		}
+	case 2, 3, 4, 5, 6, 85, 86, 87, 88, 89:
+		// EMR_POLYBEZIER, POLYGON, POLYLINE, POLYBEZIERTO, POLYLINETO and
+		// their 16-bit variants: bounds, count, points.
+		short := typ >= 85
+		pts, ok := emfPoints(r, 20, 16, short)
+		if !ok {
+			return ErrUnsupportedMetafile
+		}
+		switch typ {
+		case 2, 85:
+			c.bezier(pts)
+		case 3, 86:
+			c.poly(pts, true)
+		case 4, 87:
+			c.poly(pts, false)
+		case 5, 88:
+			c.polyTo(pts, true)
+		case 6, 89:
+			c.polyTo(pts, false)
+		}
+	case 7, 8, 90, 91: // EMR_POLYPOLYLINE, POLYPOLYGON and 16-bit variants
+		if !need(24) {
+			return ErrUnsupportedMetafile
+		}
+		n := int(le32(r, 16))
+		if n < 0 || n > len(r)/4 || !need(24+4*n) {
+			return ErrUnsupportedMetafile
+		}
+		pts, ok := emfPoints(r, 24+4*n, 20, typ >= 90)
+		if !ok {
+			return ErrUnsupportedMetafile
+		}
+		closed := typ == 8 || typ == 91
+		var d strings.Builder
+		for i := range n {
+			k := int(le32(r, 24+4*i))
+			if k > len(pts) {
+				return ErrUnsupportedMetafile
+			}
+			d.WriteString(c.figure(pts[:k], closed) + " ")
+			pts = pts[k:]
+		}
+		if c.inPath {
+			c.path.WriteString(d.String())
+		} else {
+			c.drawPath(strings.TrimSpace(d.String()), closed, true)
+		}
+
+	case 59: // EMR_BEGINPATH
+		c.inPath = true
+		c.path.Reset()
+	case 60: // EMR_ENDPATH
+		c.inPath = false
+	case 61: // EMR_CLOSEFIGURE
+		if c.inPath {
+			c.path.WriteString("Z ")
+		}
+	case 68: // EMR_ABORTPATH
+		c.inPath = false
+		c.path.Reset()
+	case 62, 63, 64: // EMR_FILLPATH, EMR_STROKEANDFILLPATH, EMR_STROKEPATH
+		c.drawPath(strings.TrimSpace(c.path.String()), typ != 64, typ != 62)
+		c.path.Reset()
+
+	case 84: // EMR_EXTTEXTOUTW
+		if !need(64) {
+			return ErrUnsupportedMetafile
+		}
+		n, at := int(le32(r, 36)), int(le32(r, 40))-8
+		if at < 0 || n < 0 || at+2*n > len(r) {
+			return ErrUnsupportedMetafile
+		}
+		u := make([]uint16, n)
+		for i := range u {
+			u[i] = binary.LittleEndian.Uint16(r[at+2*i:])
+		}
+		c.text(float64(i32(r, 28)), float64(i32(r, 32)), string(utf16.Decode(u)))
+
+	case 76: // EMR_BITBLT
+		// Without a source bitmap it is a PatBlt: a rectangle filled with
+		// the brush.
+		if !need(84) || le32(r, 80) != 0 {
+			return ErrUnsupportedMetafile
+		}
+		x, y := float64(i32(r, 16)), float64(i32(r, 20))
+		c.fillRect(x, y, x+float64(i32(r, 24)), y+float64(i32(r, 28)))
+
+	case 13, 16, 18, 20, 21, 23, 25, 26, 28, 29, 30, 48, 50, 51, 52, 57, 58, 65, 66, 67, 70, 75, 98, 100, 101, 115:
+		// State that does not affect the vector output (brush origin,
+		// background, raster operations, palettes, clipping, comments, …).
+	default:
+		return fmt.Errorf("%w: EMF record %d", ErrUnsupportedMetafile, typ)
+	}
+	return nil
+}
+
+// emfPoints reads the points of a poly record whose count is at countAt
+// and points start at at.
+func emfPoints(r []byte, at, countAt int, short bool) ([][2]float64, bool) {
+	if len(r) < countAt+4 {
+		return nil, false
+	}
+	n := int(le32(r, countAt))
+	step := 8
+	if short {
+		step = 4
+	}
+	if n < 0 || n > len(r)/step || at+n*step > len(r) {
+		return nil, false
+	}
+	pts := make([][2]float64, n)
+	for i := range pts {
+		p := at + i*step
+		if short {
+			pts[i] = [2]float64{float64(int16(binary.LittleEndian.Uint16(r[p:]))), float64(int16(binary.LittleEndian.Uint16(r[p+2:])))}
+		} else {
+			pts[i] = [2]float64{float64(i32(r, p)), float64(i32(r, p+4))}
+		}
+	}
+	return pts, true
+}
+
+// mulXform returns the transform applying a, then b.
+func mulXform(a, b [6]float64) [6]float64 {
+	return [6]float64{
+		a[0]*b[0] + a[1]*b[2],
+		a[0]*b[1] + a[1]*b[3],
+		a[2]*b[0] + a[3]*b[2],
+		a[2]*b[1] + a[3]*b[3],
+		a[4]*b[0] + a[5]*b[2] + b[4],
+		a[4]*b[1] + a[5]*b[3] + b[5],
+	}
+}
+
+func utf16String(b []byte) string {
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		v := binary.LittleEndian.Uint16(b[i:])
+		if v == 0 {
+			break
+		}
+		u = append(u, v)
+	}
+	return string(utf16.Decode(u))
+}
+
+// -----------------------------------------------------------------------------
+// WMF
+// -----------------------------------------------------------------------------
+
+func wmfToSVG(d []byte) ([]byte, error) {
+	c := newCanvas()
+	c.st.mapMode = 8 // logical units are mapped to the picture below
+	var bbox [4]float64
+	inch := 0.0
+	if len(d) >= 22 && le32(d, 0) == 0x9AC6CDD7 { // placeable header
+		bbox = [4]float64{float64(i16(d, 6)), float64(i16(d, 8)), float64(i16(d, 10)), float64(i16(d, 12))}
+		inch = float64(le16(d, 14))
+		d = d[22:]
+	}
+	if len(d) < 18 || (le16(d, 0) != 1 && le16(d, 0) != 2) || le16(d, 2) != 9 {
+		return nil, errNotMetafile
+	}
+	c.st.winOrg = [2]float64{bbox[0], bbox[1]}
+	c.st.winExt = [2]float64{bbox[2] - bbox[0], bbox[3] - bbox[1]}
+	hasWindow := c.st.winExt[0] != 0 && c.st.winExt[1] != 0
+
+	// The picture is drawn into a w x h device space; replay first with
+	// a unit viewport to learn the window, which may be set late.
+	var objects []*mfObject
+	type record struct {
+		fn uint16
+		p  []byte
+	}
+	var recs []record
+	for off := 18; off+6 <= len(d); {
+		size := int(le32(d, off)) * 2
+		if size < 6 || off+size > len(d) {
+			return nil, fmt.Errorf("media: WMF record at %d has bad size %d", off, size)
+		}
+		fn := le16(d, off+4)
+		recs = append(recs, record{fn, d[off+6 : off+size]})
+		off += size
+		if fn == 0 { // META_EOF
+			break
+		}
+		if fn == 0x020C && size >= 10 && !hasWindow { // META_SETWINDOWEXT
+			c.st.winExt = [2]float64{float64(i16(d, off-size+8)), float64(i16(d, off-size+6))}
+			hasWindow = c.st.winExt[0] != 0 && c.st.winExt[1] != 0
+		}
+	}
+	if !hasWindow {
+		return nil, ErrUnsupportedMetafile
+	}
+	w, h := math.Abs(c.st.winExt[0]), math.Abs(c.st.winExt[1])
+	if inch > 0 {
+		w, h = math.Abs(bbox[2]-bbox[0])*96/inch, math.Abs(bbox[3]-bbox[1])*96/inch
+	}
+	if w == 0 || h == 0 {
+		return nil, ErrUnsupportedMetafile
+	}
+	c.st.vpExt = [2]float64{w, h}
+	for _, rec := range recs {
+		if err := c.wmfRecord(rec.fn, rec.p, &objects); err != nil {
+			return nil, err
+		}
+	}
+	return c.svg(0, 0, w, h, w, h), nil
+}
+
+// wmfRecord replays one WMF record with parameters p.  objects is the
+// object table, in which a new object takes the first free slot.
+func (c *mfCanvas) wmfRecord(fn uint16, p []byte, objects *[]*mfObject) error {
+	need := func(n int) bool { return len(p) >= n }
+	add := func(o *mfObject) {
+		for i, x := range *objects {
+			if x == nil {
+				(*objects)[i] = o
+				return
+			}
+		}
+		*objects = append(*objects, o)
+	}
+	// Coordinates are stored in reverse order: y before x, bottom-right
+	// before top-left.
+	xy := func(at int) (float64, float64) { return float64(i16(p, at+2)), float64(i16(p, at)) }
+	switch fn {
+	case 0x0000: // META_EOF
+
+	case 0x020B, 0x020C: // META_SETWINDOWORG, META_SETWINDOWEXT
+		if !need(4) {
+			return ErrUnsupportedMetafile
+		}
+		x, y := xy(0)
+		if fn == 0x020B {
+			c.st.winOrg = [2]float64{x, y}
+		} else if x != 0 && y != 0 {
+			c.st.winExt = [2]float64{x, y}
+		}
+	case 0x0106: // META_SETPOLYFILLMODE
+		if need(2) {
+			c.st.evenOdd = le16(p, 0) == 1
+		}
+	case 0x012E: // META_SETTEXTALIGN
+		if need(2) {
+			c.st.textAlign = uint32(le16(p, 0))
+		}
+	case 0x0209: // META_SETTEXTCOLOR
+		if need(4) {
+			c.st.textColor = colorRef(le32(p, 0))
+		}
+	case 0x0214: // META_MOVETO
+		if need(4) {
+			c.moveTo(xy(0))
+		}
+	case 0x0213: // META_LINETO
+		if need(4) {
+			c.lineTo(xy(0))
+		}
+	case 0x001E: // META_SAVEDC
+		c.save()
+	case 0x0127: // META_RESTOREDC
+		if need(2) {
+			c.restore(int(i16(p, 0)))
+		}
+
+	case 0x012D: // META_SELECTOBJECT
+		if need(2) {
+			if i := int(le16(p, 0)); i < len(*objects) {
+				c.selectObject((*objects)[i])
+			}
+		}
+	case 0x01F0: // META_DELETEOBJECT
+		if need(2) {
+			if i := int(le16(p, 0)); i < len(*objects) {
+				(*objects)[i] = nil
+			}
+		}
+	case 0x02FA: // META_CREATEPENINDIRECT
+		if !need(10) {
+			return ErrUnsupportedMetafile
+		}
+		style := uint32(le16(p, 0))
+		add(&mfObject{pen: &mfPen{null: style&0x0F == 5, width: float64(i16(p, 2)), color: colorRef(le32(p, 6)), dash: penDash(style)}})
+	case 0x02FC: // META_CREATEBRUSHINDIRECT
+		if !need(6) {
+			return ErrUnsupportedMetafile
+		}
+		add(&mfObject{brush: &mfBrush{null: le16(p, 0) == 1, color: colorRef(le32(p, 2))}})
+	case 0x02FB: // META_CREATEFONTINDIRECT
+		if !need(18) {
+			return ErrUnsupportedMetafile
+		}
+		face := p[18:min(len(p), 50)]
+		if i := bytes.IndexByte(face, 0); i >= 0 {
+			face = face[:i]
+		}
+		add(&mfObject{font: &mfFont{
+			height:     float64(i16(p, 0)),
+			escapement: float64(i16(p, 4)),
+			weight:     int(i16(p, 8)),
+			italic:     p[10] != 0,
+			underline:  p[11] != 0,
+			strike:     p[12] != 0,
+			face:       latin1(face),
+		}})
+	case 0x00F7, 0x06FF, 0x0142, 0x01F9: // META_CREATEPALETTE, CREATEREGION, DIBCREATEPATTERNBRUSH, CREATEPATTERNBRUSH
+		// Pattern brushes are drawn as mid-gray.
+		if fn == 0x0142 || fn == 0x01F9 {
+			add(&mfObject{brush: &mfBrush{color: "#808080"}})
+		} else {
+			add(&mfObject{})
+		}
+
+	case 0x041B, 0x0418, 0x061C: // META_RECTANGLE, META_ELLIPSE, META_ROUNDRECT
+		at := 0
+		if fn == 0x061C {
+			at = 4
+		}
+		if !need(at + 8) {
+			return ErrUnsupportedMetafile
+		}
+		r, b := xy(at)
+		l, t := xy(at + 4)
+		switch fn {
+		case 0x0418:
+			c.ellipse(l, t, r, b)
+		case 0x061C:
+			rw, rh := xy(0)
+			c.rect(l, t, r, b, rw, rh)
+		default:
+			c.rect(l, t, r, b, 0, 0)
+		}
+	case 0x0324, 0x0325: // META_POLYGON, META_POLYLINE
+		if !need(2) {
+			return ErrUnsupportedMetafile
+		}
+		pts, ok := wmfPoints(p, 2, int(le16(p, 0)))
+		if !ok {
+			return ErrUnsupportedMetafile
+		}
+		c.poly(pts, fn == 0x0324)
+	case 0x0538: // META_POLYPOLYGON
+		if !need(2) {
+			return ErrUnsupportedMetafile
+		}
+		n := int(le16(p, 0))
+		if !need(2 + 2*n) {
+			return ErrUnsupportedMetafile
+		}
+		at := 2 + 2*n
+		var d strings.Builder
+		for i := range n {
+			k := int(le16(p, 2+2*i))
+			pts, ok := wmfPoints(p, at, k)
+			if !ok {
+				return ErrUnsupportedMetafile
+			}
+			d.WriteString(c.figure(pts, true) + " ")
+			at += 4 * k
+		}
+		c.drawPath(strings.TrimSpace(d.String()), true, true)
+	case 0x061D: // META_PATBLT
+		if !need(12) {
+			return ErrUnsupportedMetafile
+		}
+		h, w := xy(4)
+		x, y := xy(8)
+		c.fillRect(x, y, x+w, y+h)
+
+	case 0x0521: // META_TEXTOUT
+		if !need(2) {
+			return ErrUnsupportedMetafile
+		}
+		n := int(le16(p, 0))
+		at := 2 + (n+1)&^1
+		if !need(at + 4) {
+			return ErrUnsupportedMetafile
+		}
+		y, x := float64(i16(p, at)), float64(i16(p, at+2))
+		c.text(x, y, latin1(p[2:2+n]))
+	case 0x0A32: // META_EXTTEXTOUT
+		if !need(8) {
+			return ErrUnsupportedMetafile
+		}
+		x, y := xy(0)
+		n, opts := int(le16(p, 4)), le16(p, 6)
+		at := 8
+		if opts&0x0006 != 0 { // ETO_OPAQUE, ETO_CLIPPED: a rectangle follows
+			at += 8
+		}
+		if !need(at + n) {
+			return ErrUnsupportedMetafile
+		}
+		c.text(x, y, latin1(p[at:at+n]))
+
+	case 0x0102, 0x0103, 0x0104, 0x0107, 0x0108, 0x0201, 0x020A, 0x020D, 0x020E, 0x0231, 0x0234, 0x0035,
+		0x0415, 0x0416, 0x012C, 0x0626, 0x0037, 0x0139, 0x0436:
+		// State that does not affect the vector output (background,
+		// raster operations, viewport, palettes, clipping, escapes, …).
+		// The viewport is ignored because the window is mapped onto the
+		// whole picture.
+	default:
+		return fmt.Errorf("%w: WMF record %#04x", ErrUnsupportedMetafile, fn)
+	}
+	return nil
+}
+
+// wmfPoints reads n points of x, y pairs at p[at:].
+func wmfPoints(p []byte, at, n int) ([][2]float64, bool) {
+	if at+4*n > len(p) {
+		return nil, false
+	}
+	pts := make([][2]float64, n)
+	for i := range pts {
+		pts[i] = [2]float64{float64(i16(p, at+4*i)), float64(i16(p, at+4*i+2))}
+	}
+	return pts, true
+}
+
+// latin1 decodes text of the ANSI code page as Latin-1, which agrees with
+// Windows-1252 outside 0x80-0x9F.
+func latin1(b []byte) string {
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+func le16(b []byte, at int) uint16 { return binary.LittleEndian.Uint16(b[at:]) }
+func i16(b []byte, at int) int16   { return int16(binary.LittleEndian.Uint16(b[at:])) }
+func le32(b []byte, at int) uint32 { return binary.LittleEndian.Uint32(b[at:]) }
+func i32(b []byte, at int) int32   { return int32(binary.LittleEndian.Uint32(b[at:])) }
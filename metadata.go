@@ -0,0 +1,232 @@
+package convert
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aerissecure/convert/docx"
+	"github.com/aerissecure/convert/internal/safezip"
+	"github.com/aerissecure/convert/rtf"
+)
+
+// -----------------------------------------------------------------------------
+// Metadata
+// -----------------------------------------------------------------------------
+
+// Metadata is the descriptive information of a document, read without
+// converting it.  For OPC packages (DOCX, XLSX, PPTX and their
+// macro-enabled variants) it comes from the core and extended properties
+// parts; the statistics are those the application saved, except Cells,
+// which is counted.  RTF documents only provide the core fields.  For the
+// other formats only Format is set.
+type Metadata struct {
+	Format Format
+
+	Title          string
+	Subject        string
+	Author         string
+	LastModifiedBy string
+	Keywords       string
+	Description    string
+	Created        time.Time
+	Modified       time.Time
+	Revision       int // number of saves (cp:revision), 0 if not recorded
+
+	Company     string
+	Application string // e.g. "Microsoft Office Word"
+	AppVersion  string // e.g. "16.0000"
+
+	Pages      int
+	Words      int
+	Characters int
+	Slides     int
+	Cells      int // non-empty cells of all worksheets
+
+	// Embedded lists the embedded files (OLE objects and packages) in
+	// package order.
+	Embedded []EmbeddedFile
+}
+
+// EmbeddedFile is a file embedded in a document.
+type EmbeddedFile struct {
+	Name        string // package part, e.g. "word/embeddings/oleObject1.bin"
+	ContentType string
+	Size        int64
+}
+
+// ExtractMetadata reads the metadata of r.  Formats DetectFormat cannot
+// identify and encrypted files yield the error of their Report; other
+// unsupported formats are identified by Format, and PowerPoint
+// presentations have their metadata read although they cannot be
+// converted.
+func ExtractMetadata(r io.ReaderAt, size int64) (Metadata, error) {
+	rep, err := DetectFormat(r, size)
+	if err != nil {
+		return Metadata{}, err
+	}
+	md := Metadata{Format: rep.Format}
+	switch rep.Format {
+	case FormatDOCX, FormatDOCM, FormatXLSX, FormatXLSM, FormatPPTX:
+		return md, readPackageMetadata(&md, r, size, true)
+	case FormatRTF:
+		m, err := rtf.ParseDocumentModel(r, size)
+		if err != nil {
+			return md, err
+		}
+		documentMetadata(&md, m.Properties)
+		return md, nil
+	}
+	if rep.Encrypted || rep.Format == FormatUnknown {
+		return md, rep.Err()
+	}
+	return md, nil
+}
+
+// documentMetadata fills the core fields of md from the properties of a
+// parsed document.
+func documentMetadata(md *Metadata, p docx.DocProperties) {
+	md.Title, md.Subject, md.Author = p.Title, p.Subject, p.Author
+	md.Keywords, md.Description = p.Keywords, p.Description
+	md.Created, md.Modified = p.Created, p.Modified
+}
+
+// readPackageMetadata fills md from the parts of an OPC package, counting
+// the cells of its worksheets if cells is set.
+func readPackageMetadata(md *Metadata, r io.ReaderAt, size int64, cells bool) error {
+	zr, err := safezip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	if f, ok := files["docProps/core.xml"]; ok {
+		var core struct {
+			Title          string `xml:"title"`
+			Subject        string `xml:"subject"`
+			Creator        string `xml:"creator"`
+			LastModifiedBy string `xml:"lastModifiedBy"`
+			Keywords       string `xml:"keywords"`
+			Description    string `xml:"description"`
+			Created        string `xml:"created"`
+			Modified       string `xml:"modified"`
+			Revision       string `xml:"revision"`
+		}
+		if xml.Unmarshal(readEntry(f, 1<<20), &core) == nil {
+			md.Title = strings.TrimSpace(core.Title)
+			md.Subject = strings.TrimSpace(core.Subject)
+			md.Author = strings.TrimSpace(core.Creator)
+			md.LastModifiedBy = strings.TrimSpace(core.LastModifiedBy)
+			md.Keywords = strings.TrimSpace(core.Keywords)
+			md.Description = strings.TrimSpace(core.Description)
+			md.Created, _ = time.Parse(time.RFC3339, strings.TrimSpace(core.Created))
+			md.Modified, _ = time.Parse(time.RFC3339, strings.TrimSpace(core.Modified))
+			md.Revision, _ = strconv.Atoi(strings.TrimSpace(core.Revision))
+		}
+	}
+	if f, ok := files["docProps/app.xml"]; ok {
+		var app struct {
+			Company     string `xml:"Company"`
+			Application string `xml:"Application"`
+			AppVersion  string `xml:"AppVersion"`
+			Pages       int    `xml:"Pages"`
+			Words       int    `xml:"Words"`
+			Characters  int    `xml:"Characters"`
+			Slides      int    `xml:"Slides"`
+		}
+		if xml.Unmarshal(readEntry(f, 1<<20), &app) == nil {
+			md.Company = strings.TrimSpace(app.Company)
+			md.Application = strings.TrimSpace(app.Application)
+			md.AppVersion = strings.TrimSpace(app.AppVersion)
+			md.Pages, md.Words, md.Characters, md.Slides = app.Pages, app.Words, app.Characters, app.Slides
+		}
+	}
+
+	contentType := packageContentTypes(files["[Content_Types].xml"])
+	for _, f := range zr.File {
+		switch {
+		case strings.Contains(f.Name, "/embeddings/") && !strings.HasSuffix(f.Name, "/"):
+			md.Embedded = append(md.Embedded, EmbeddedFile{
+				Name:        f.Name,
+				ContentType: contentType(f.Name),
+				Size:        int64(f.UncompressedSize64),
+			})
+		case cells && strings.HasPrefix(f.Name, "xl/worksheets/") && strings.HasSuffix(f.Name, ".xml"):
+			md.Cells += countCells(f)
+		}
+	}
+	return nil
+}
+
+// packageContentTypes returns a function giving the content type of a
+// part from the [Content_Types].xml entry f of its package, "" if it has
+// none.  f may be nil.
+func packageContentTypes(f *zip.File) func(name string) string {
+	var types struct {
+		Default []struct {
+			Extension   string `xml:"Extension,attr"`
+			ContentType string `xml:"ContentType,attr"`
+		}
+		Override []struct {
+			PartName    string `xml:"PartName,attr"`
+			ContentType string `xml:"ContentType,attr"`
+		}
+	}
+	if f != nil {
+		xml.Unmarshal(readEntry(f, 1<<20), &types)
+	}
+	return func(name string) string {
+		for _, o := range types.Override {
+			if strings.EqualFold(strings.TrimPrefix(o.PartName, "/"), name) {
+				return o.ContentType
+			}
+		}
+		ext := strings.TrimPrefix(path.Ext(name), ".")
+		for _, d := range types.Default {
+			if strings.EqualFold(d.Extension, ext) {
+				return d.ContentType
+			}
+		}
+		return ""
+	}
+}
+
+// countCells counts the cells of a worksheet part holding a value.
+func countCells(f *zip.File) int {
+	rc, err := f.Open()
+	if err != nil {
+		return 0
+	}
+	defer rc.Close()
+	d := xml.NewDecoder(rc)
+	n, inCell, counted := 0, false, false
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return n
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "c":
+				inCell, counted = true, false
+			case "v", "is":
+				if inCell && !counted {
+					n++
+					counted = true
+				}
+			}
+		case xml.EndElement:
+			if t.Name.Local == "c" {
+				inCell = false
+			}
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package convert
+
+import (
+	"io"
+
+	"github.com/aerissecure/convert/diag"
+	"github.com/aerissecure/convert/docx"
+	"github.com/aerissecure/convert/fonts"
+	"github.com/aerissecure/convert/media"
+	"github.com/aerissecure/convert/xlsx"
+)
+
+// -----------------------------------------------------------------------------
+// Functional options
+// -----------------------------------------------------------------------------
+//
+// Option is the one configuration surface of the converters: each With
+// function sets the Options field it names, whichever converter the input
+// ends up with, so
+//
+//	html, err := convert.Convert(r, size, convert.WithStandalone(true), convert.WithHiddenSheets(false))
+//
+// converts a document or a workbook alike.  Options that do not apply to
+// the detected format are ignored.  The Options struct remains available
+// for callers building it directly; NewOptions bridges the two.
+
+// Option sets a conversion option.
+type Option func(*Options)
+
+// NewOptions returns the Options set by opts, applied in order to the zero
+// value.
+func NewOptions(opts ...Option) Options {
+	var o Options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Convert is ToHTML configured with functional options.
+func Convert(r io.ReaderAt, size int64, opts ...Option) (string, error) {
+	return ToHTML(r, size, NewOptions(opts...))
+}
+
+// WithStandalone wraps document output in a complete HTML document.
+func WithStandalone(on bool) Option {
+	return func(o *Options) { o.Document.Standalone = on }
+}
+
+// WithHiddenSheets sets whether sheets hidden in a workbook are rendered;
+// they are by default.
+func WithHiddenSheets(show bool) Option {
+	return func(o *Options) { o.Workbook.SkipHiddenSheets = !show }
+}
+
+// WithSheets renders only the sheets of a workbook with these names.
+func WithSheets(names ...string) Option {
+	return func(o *Options) { o.Workbook.Sheets = names }
+}
+
+// WithRange renders only the cells of each sheet in an A1-style range, e.g.
+// "A1:F40".
+func WithRange(ref string) Option {
+	return func(o *Options) { o.Workbook.Range = ref }
+}
+
+// WithUnits sets the factors converting workbook row heights, column
+// widths and indents to pixels; see xlsx.Units.
+func WithUnits(u xlsx.Units) Option {
+	return func(o *Options) { o.Workbook.Units = u }
+}
+
+// WithDefangedFormulas sets whether workbook cells holding DDE or
+// external-command formulas show the formula instead of their value; see
+// xlsx.RenderOptions.DefangFormulas.
+func WithDefangedFormulas(on bool) Option {
+	return func(o *Options) { o.Workbook.DefangFormulas = on }
+}
+
+// WithCellRenderers overrides the rendering of the workbook cells the
+// renderers match; see xlsx.CellRenderer.
+func WithCellRenderers(renderers ...xlsx.CellRenderer) Option {
+	return func(o *Options) { o.Workbook.CellRenderers = append(o.Workbook.CellRenderers, renderers...) }
+}
+
+// WithSheetIndex sets whether a summary linking to each sheet is written
+// above the sheets of a multi-sheet workbook; see
+// xlsx.RenderOptions.SheetIndex.
+func WithSheetIndex(on bool) Option {
+	return func(o *Options) { o.Workbook.SheetIndex = on }
+}
+
+// WithLocale sets the BCP 47 language tag declared for input that does not
+// name its language.
+func WithLocale(tag string) Option {
+	return func(o *Options) {
+		o.Document.Locale = tag
+		o.Workbook.Locale = tag
+	}
+}
+
+// WithMaxCells rejects workbooks with more than n non-blank cells with a
+// *LimitError; zero means no limit.
+func WithMaxCells(n int) Option {
+	return func(o *Options) { o.MaxCells = n }
+}
+
+// WithMaxSize rejects input larger than n bytes; see Options.MaxSize.
+func WithMaxSize(n int64) Option {
+	return func(o *Options) { o.MaxSize = n }
+}
+
+// WithMaxOutputBytes limits the HTML to n bytes; output over it fails with
+// a *LimitError, or is cut short if truncate is set.  Zero means no limit.
+func WithMaxOutputBytes(n int64, truncate bool) Option {
+	return func(o *Options) {
+		o.MaxOutputBytes = n
+		o.TruncateOutput = truncate
+	}
+}
+
+// WithMemoryBudget rejects input estimated to need more than n bytes to
+// convert; zero means no limit.
+func WithMemoryBudget(n int64) Option {
+	return func(o *Options) { o.MemoryBudget = n }
+}
+
+// WithFailFast lets a panic in a parser or renderer crash the program
+// instead of failing the conversion.
+func WithFailFast(on bool) Option {
+	return func(o *Options) { o.FailFast = on }
+}
+
+// WithFontSubstitutes sets the replacements appended to font stacks for
+// fonts clients may not have; see the fonts package.
+func WithFontSubstitutes(subs fonts.Substitutes) Option {
+	return func(o *Options) {
+		o.Document.FontSubstitutes = subs
+		o.Workbook.FontSubstitutes = subs
+	}
+}
+
+// WithNormalizeText applies fn, e.g. norm.NFC.String, to the output of
+// both converters; see docx.RenderOptions.NormalizeText.
+func WithNormalizeText(fn func(string) string) Option {
+	return func(o *Options) {
+		o.Document.NormalizeText = fn
+		o.Workbook.NormalizeText = fn
+	}
+}
+
+// WithWarnings collects the problems the converters worked around in l.
+func WithWarnings(l *diag.List) Option {
+	return func(o *Options) { o.Warnings = l }
+}
+
+// WithImageHandler sets the handler deciding the src of emitted images.
+func WithImageHandler(h media.ImageHandler) Option {
+	return func(o *Options) {
+		o.Document.ImageHandler = h
+		o.Workbook.ImageHandler = h
+	}
+}
+
+// WithURLRewriter passes the hyperlink targets and image sources of
+// documents, and the picture sources of workbooks, through fn; see
+// docx.RenderOptions.URLRewriter and xlsx.RenderOptions.URLRewriter.
+func WithURLRewriter(fn func(url string) (string, bool)) Option {
+	return func(o *Options) {
+		o.Document.URLRewriter = fn
+		o.Workbook.URLRewriter = fn
+	}
+}
+
+// WithRenderers overrides the rendering of the document paragraphs, tables
+// and embedded objects r has hooks for; see docx.Renderers.
+func WithRenderers(r docx.Renderers) Option {
+	return func(o *Options) { o.Document.Renderers = r }
+}
+
+// WithRevisions selects whether the tracked changes of documents are
+// accepted, rejected or shown; see docx.RevisionsMode.
+func WithRevisions(mode docx.RevisionsMode) Option {
+	return func(o *Options) { o.Document.Revisions = mode }
+}
+
+// WithRedactedImages sets whether the images of documents and workbooks
+// are replaced with placeholders of the same size; see
+// docx.RenderOptions.RedactImages.
+func WithRedactedImages(on bool) Option {
+	return func(o *Options) {
+		o.Document.RedactImages = on
+		o.Workbook.RedactImages = on
+	}
+}
+
+// WithMetafileRasterizer sets the fallback for WMF and EMF images that
+// cannot be converted to SVG.
+func WithMetafileRasterizer(r media.MetafileRasterizer) Option {
+	return func(o *Options) {
+		o.Document.MetafileRasterizer = r
+		o.Workbook.MetafileRasterizer = r
+	}
+}
+
+// WithSanitize removes metadata, comments, tracked changes and hidden
+// content before rendering.
+func WithSanitize(on bool) Option {
+	return func(o *Options) { o.Sanitize = on }
+}
+
+// WithStrict sanitizes the output against a fixed allow-list so it can be
+// embedded without further sanitizing; absolute URLs are kept only if they
+// start with one of allowedURLs.
+func WithStrict(allowedURLs ...string) Option {
+	return func(o *Options) {
+		o.Strict = true
+		o.AllowedURLs = allowedURLs
+	}
+}
+
+// WithWatermark writes text diagonally across the output.
+func WithWatermark(text string) Option {
+	return func(o *Options) {
+		o.Document.Watermark = text
+		o.Workbook.Watermark = text
+	}
+}
+
+// WithBanner shows text in a bar at the top of the output.
+func WithBanner(text string) Option {
+	return func(o *Options) {
+		o.Document.Banner = text
+		o.Workbook.Banner = text
+	}
+}
+
+// WithParts calls fn with each part of OPC package input; see PartFunc.
+func WithParts(fn PartFunc) Option {
+	return func(o *Options) { o.Parts = fn }
+}
+
+// WithCache serves repeat conversions from c.
+func WithCache(c Cache) Option {
+	return func(o *Options) { o.Cache = c }
+}
+
+// WithLegacyConverter converts .doc input to DOCX with c; see
+// Options.LegacyConverter.
+func WithLegacyConverter(c docx.ExternalConverter) Option {
+	return func(o *Options) { o.LegacyConverter = c }
+}
+
+// WithWorkbookBackend sets the parser of spreadsheet input.
+func WithWorkbookBackend(b xlsx.Backend) Option {
+	return func(o *Options) { o.WorkbookBackend = b }
+}
+
+// WithWorkers sets the number of files ConvertTree converts at once.
+func WithWorkers(n int) Option {
+	return func(o *Options) { o.Workers = n }
+}
+
+// WithDebug adds data attributes with the raw style info to the output.
+func WithDebug(on bool) Option {
+	return func(o *Options) {
+		o.Document.Debug = on
+		o.Workbook.Debug = on
+	}
+}
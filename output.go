@@ -0,0 +1,87 @@
+package convert
+
+import (
+	"io"
+
+	"github.com/aerissecure/convert/diag"
+	"github.com/aerissecure/convert/xlsx"
+)
+
+// -----------------------------------------------------------------------------
+// Combined output
+// -----------------------------------------------------------------------------
+
+// Output is the HTML of a document together with what an indexing pipeline
+// stores alongside it.
+type Output struct {
+	HTML     string
+	Text     string // see docx.DocumentText and xlsx.WorkbookText
+	Metadata Metadata
+	Warnings []diag.Warning // the problems worked around, see the diag package
+}
+
+// ToOutput converts r like ToHTML and also extracts its plain text and
+// metadata, from a single parse.  The metadata of OPC packages is read from
+// their property parts, as by ExtractMetadata, except Cells, which is counted
+// from the parsed workbook; with Options.Sanitize only Format and Cells are
+// set.  The text of a workbook leaves out the sheets its HTML does.
+// Options.Cache is not used; warnings are also added to Options.Warnings if
+// set.
+func ToOutput(r io.ReaderAt, size int64, opts Options) (Output, error) {
+	if opts.MaxSize > 0 && size > opts.MaxSize {
+		return Output{}, &LimitError{Limit: "MaxSize", Max: opts.MaxSize}
+	}
+	rep, err := detect(r, size, opts)
+	if err != nil {
+		return Output{}, err
+	}
+	if err := rep.Err(); err != nil {
+		return Output{}, err
+	}
+	out := Output{Metadata: Metadata{Format: rep.Format}}
+	switch rep.Format {
+	case FormatDOCX, FormatDOCM, FormatXLSX, FormatXLSM:
+		if !opts.Sanitize {
+			if err := readPackageMetadata(&out.Metadata, r, size, false); err != nil {
+				return Output{}, parseError(rep.Format, err)
+			}
+		}
+	}
+	caller, warnings := opts.Warnings, &diag.List{}
+	opts.Warnings = warnings
+	if out.HTML, err = convertFormat(r, size, rep, opts, &out); err != nil {
+		return Output{}, err
+	}
+	out.Warnings = warnings.Warnings()
+	caller.Add(out.Warnings...)
+	return out, nil
+}
+
+// ConvertOutput is ToOutput configured with functional options.
+func ConvertOutput(r io.ReaderAt, size int64, opts ...Option) (Output, error) {
+	return ToOutput(r, size, NewOptions(opts...))
+}
+
+// workbookOutput stores the cell count of the workbook m and the text of
+// shown, the part of it selected for rendering, in out.
+func workbookOutput(out *Output, m, shown xlsx.WorkbookModel, opts Options) {
+	for _, sheet := range m.Sheets {
+		for _, row := range sheet.Rows {
+			for _, cell := range row.Cells {
+				if cell != nil && cell.Value != "" {
+					out.Metadata.Cells++
+				}
+			}
+		}
+	}
+	if opts.Workbook.SkipHiddenSheets {
+		var visible []xlsx.RenderSheet
+		for _, sheet := range shown.Sheets {
+			if !sheet.Hidden {
+				visible = append(visible, sheet)
+			}
+		}
+		shown.Sheets = visible
+	}
+	out.Text = xlsx.WorkbookText(shown)
+}
@@ -0,0 +1,49 @@
+package convert
+
+import (
+	"io"
+	"strings"
+
+	"github.com/aerissecure/convert/internal/safezip"
+)
+
+// -----------------------------------------------------------------------------
+// Raw part access
+// -----------------------------------------------------------------------------
+//
+// Options.Parts hands the parts of an OPC package (DOCX, DOCM, XLSX and
+// XLSM input) to the caller as the input is converted, for what the model
+// leaves out: extracting customXml parts, detecting proprietary extensions
+// or archiving the original alongside its HTML.  It sees every part, in
+// archive order, before the package is parsed into the model, and only
+// once the package has passed the safezip checks the parsers apply, so a
+// part cannot decompress past the size it declares.  Compound-file and RTF
+// input have no parts and do not call it.
+
+// PartFunc is called with the name and content of each part of a package,
+// e.g. "customXml/item1.xml".  The reader is valid during the call only.
+// An error stops the conversion, which returns it.
+type PartFunc func(name string, r io.Reader) error
+
+// visitParts calls fn with each part of the package r/size of format f.
+func visitParts(f Format, r io.ReaderAt, size int64, fn PartFunc) error {
+	zr, err := safezip.NewReader(r, size)
+	if err != nil {
+		return parseError(f, err)
+	}
+	for _, file := range zr.File {
+		if strings.HasSuffix(file.Name, "/") {
+			continue // a directory entry
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return parseError(f, err)
+		}
+		err = fn(file.Name, rc)
+		rc.Close()
+		if err != nil {
+			return parseError(f, err)
+		}
+	}
+	return nil
+}
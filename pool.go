@@ -0,0 +1,201 @@
+package convert
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// -----------------------------------------------------------------------------
+// Conversion pool
+// -----------------------------------------------------------------------------
+//
+// A Pool bounds the conversions a service runs at once, so a burst of
+// uploads queues instead of exhausting the machine.  A conversion starts
+// when fewer than MaxConcurrent are running and, with a MemoryWatermark,
+// when the memory the running conversions are estimated to need (as
+// Options.MemoryBudget estimates it) leaves room for its own; a conversion
+// over the watermark by itself runs only when the pool is otherwise idle.
+// Callers wait their turn in arrival order, up to QueueLength of them;
+// further callers fail at once with ErrPoolFull, which a service can answer
+// with 503.  The converters cannot be interrupted, so a conversion over its
+// Timeout keeps its slot until it finishes, and only its result is
+// discarded.
+
+// PoolConfig configures NewPool.
+type PoolConfig struct {
+	// Options are the options of every conversion.
+	Options Options
+	// MaxConcurrent is the number of conversions run at once; zero means
+	// GOMAXPROCS.
+	MaxConcurrent int
+	// QueueLength is the number of callers that may wait for a slot; zero
+	// means no limit.
+	QueueLength int
+	// Timeout bounds a conversion once started; zero means no limit.
+	// Time spent waiting is bounded by the caller's context.
+	Timeout time.Duration
+	// MemoryWatermark is the estimated memory the running conversions may
+	// need together; zero means no limit.
+	MemoryWatermark int64
+}
+
+// PoolStats is a snapshot of a Pool.
+type PoolStats struct {
+	Running int
+	Queued  int
+	Memory  int64 // estimated memory of the running conversions
+}
+
+// Pool runs conversions with bounded concurrency and memory.  It is safe
+// for concurrent use.
+type Pool struct {
+	cfg PoolConfig
+
+	mu      sync.Mutex
+	running int
+	memory  int64
+	queue   []*poolWaiter // in arrival order
+}
+
+// poolWaiter is a caller waiting for a slot; ready is closed once it has
+// one.
+type poolWaiter struct {
+	mem   int64
+	ready chan struct{}
+}
+
+// NewPool returns a Pool configured by cfg.
+func NewPool(cfg PoolConfig) *Pool {
+	if cfg.MaxConcurrent <= 0 {
+		cfg.MaxConcurrent = runtime.GOMAXPROCS(0)
+	}
+	return &Pool{cfg: cfg}
+}
+
+// ToHTML converts r as ToHTML does once the pool has room for it.  It fails
+// with ErrPoolFull if the queue is full, with the error of ctx if ctx ends
+// while waiting or converting, and with an error matching
+// context.DeadlineExceeded if the conversion outlasts the Timeout.  A panic
+// in the conversion fails it with a *PanicError, unless Options.FailFast
+// is set.
+//
+// A conversion that times out or is cancelled goes on reading r after
+// ToHTML returns, until it finishes and releases its slot, so r must stay
+// valid until then: pass a reader over memory the pool may keep, not one
+// over a file or buffer the caller closes or reuses.
+func (p *Pool) ToHTML(ctx context.Context, r io.ReaderAt, size int64) (string, error) {
+	mem := estimateMemory(r, size)
+	if err := p.acquire(ctx, mem); err != nil {
+		return "", err
+	}
+	type result struct {
+		html string
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer p.release(mem)
+		defer func() {
+			// A panic here would take the program down, not the caller.
+			if v := recover(); v != nil {
+				if p.cfg.Options.FailFast {
+					panic(v)
+				}
+				done <- result{err: &PanicError{Value: v, Stack: debug.Stack()}}
+			}
+		}()
+		html, err := ToHTML(r, size, p.cfg.Options)
+		done <- result{html, err}
+	}()
+	var timeout <-chan time.Time
+	if p.cfg.Timeout > 0 {
+		t := time.NewTimer(p.cfg.Timeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case res := <-done:
+		return res.html, res.err
+	case <-timeout:
+		return "", fmt.Errorf("convert: conversion timed out after %v: %w", p.cfg.Timeout, context.DeadlineExceeded)
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Stats returns the current load of the pool.
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return PoolStats{Running: p.running, Queued: len(p.queue), Memory: p.memory}
+}
+
+// acquire takes a slot for a conversion needing mem bytes, waiting in the
+// queue if there is none.
+func (p *Pool) acquire(ctx context.Context, mem int64) error {
+	p.mu.Lock()
+	if len(p.queue) == 0 && p.fits(mem) {
+		p.take(mem)
+		p.mu.Unlock()
+		return nil
+	}
+	if p.cfg.QueueLength > 0 && len(p.queue) >= p.cfg.QueueLength {
+		p.mu.Unlock()
+		return ErrPoolFull
+	}
+	w := &poolWaiter{mem: mem, ready: make(chan struct{})}
+	p.queue = append(p.queue, w)
+	p.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		for i, q := range p.queue {
+			if q == w {
+				p.queue = append(p.queue[:i], p.queue[i+1:]...)
+				p.mu.Unlock()
+				return ctx.Err()
+			}
+		}
+		p.mu.Unlock()
+		p.release(mem) // granted as ctx ended
+		return ctx.Err()
+	}
+}
+
+// release returns the slot of a conversion needing mem bytes and starts
+// the waiters that now fit, in order.
+func (p *Pool) release(mem int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running--
+	p.memory -= mem
+	for len(p.queue) > 0 && p.fits(p.queue[0].mem) {
+		w := p.queue[0]
+		p.queue = p.queue[1:]
+		p.take(w.mem)
+		close(w.ready)
+	}
+}
+
+// fits reports whether a conversion needing mem bytes can start now.
+// p.mu is held.
+func (p *Pool) fits(mem int64) bool {
+	if p.running >= p.cfg.MaxConcurrent {
+		return false
+	}
+	return p.cfg.MemoryWatermark <= 0 || p.running == 0 || p.memory+mem <= p.cfg.MemoryWatermark
+}
+
+// take records a started conversion needing mem bytes.  p.mu is held.
+func (p *Pool) take(mem int64) {
+	p.running++
+	p.memory += mem
+}
@@ -0,0 +1,145 @@
+package convert
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/aerissecure/convert/docx"
+	"github.com/aerissecure/convert/xlsx"
+)
+
+// -----------------------------------------------------------------------------
+// Merged reports
+// -----------------------------------------------------------------------------
+//
+// MergeHTML assembles the models of many files into one page, e.g. an
+// engagement report bundle: a combined table of contents, then each file
+// in a section of its own under a header with its title.  Every section's
+// ids are prefixed with the section's id ("report-2-…"), so headings,
+// notes and bookmarks of different files cannot clash.  Documents are
+// rendered with generated classes (docx.RenderOptions.ExternalCSS), whose
+// names derive from their declarations, so their rules are written to the
+// head once however many documents use them; each workbook's stylesheet is
+// scoped to its section (xlsx.RenderOptions.Scope).
+
+// reportCSS styles the table of contents and section headers of a merged
+// report.
+const reportCSS = `.report-toc ul { list-style: none; padding-left: 1.5em; }
+.report-source { margin-top: 3em; }
+.report-source-title { border-bottom: 1px solid #999; padding-bottom: 0.25em; }
+`
+
+// ReportSource is one file of a merged report.  Exactly one of Document
+// and Workbook is set.
+type ReportSource struct {
+	Title    string // section header, e.g. the file name
+	Document *docx.DocumentModel
+	Workbook *xlsx.WorkbookModel
+}
+
+// MergeHTML renders sources as one standalone HTML page titled title.  The
+// render-time options of opts apply to every source, as for Handle.HTML;
+// Standalone and TableOfContents are implied, and the output limits and
+// Strict apply to the page as a whole.
+func MergeHTML(title string, sources []ReportSource, opts Options) (_ string, err error) {
+	if !opts.FailFast {
+		defer recoverRender(&err)
+	}
+	if opts.Warnings != nil {
+		opts.Document.Warnings = opts.Warnings
+	}
+	var (
+		toc, body strings.Builder
+		rules     []string
+		seen      = make(map[string]bool)
+	)
+	toc.WriteString("<nav class=\"report-toc\">\n<ul>\n")
+	for i, src := range sources {
+		id := fmt.Sprintf("report-%d", i+1)
+		toc.WriteString(fmt.Sprintf("<li><a href=\"#%s\">%s</a>\n", id, html.EscapeString(src.Title)))
+		body.WriteString(fmt.Sprintf("<section class=\"report-source\" id=\"%s\">\n<h1 class=\"report-source-title\">%s</h1>\n", id, html.EscapeString(src.Title)))
+		switch {
+		case src.Document != nil:
+			dopts := opts.Document
+			dopts.Standalone, dopts.TableOfContents, dopts.ExternalCSS = false, false, true
+			dopts.IDPrefix = id + "-"
+			if err := docx.RenderDocumentHTMLTo(&body, *src.Document, dopts); err != nil {
+				return "", err
+			}
+			css := strings.TrimPrefix(docx.RenderDocumentCSS(*src.Document, dopts), docx.DocumentCSS())
+			for _, rule := range strings.SplitAfter(css, "\n") {
+				if rule != "" && !seen[rule] {
+					seen[rule] = true
+					rules = append(rules, rule)
+				}
+			}
+			writeReportTOC(&toc, docx.DocumentHeadings(*src.Document, dopts))
+		case src.Workbook != nil:
+			wopts := opts.Workbook
+			wopts.Scope = id
+			if err := xlsx.RenderWorkbookHTMLTo(&body, *src.Workbook, wopts); err != nil {
+				return "", err
+			}
+			var sheets []docx.Heading
+			if m, err := xlsx.Select(*src.Workbook, wopts.Sheets, wopts.Range); err == nil {
+				for _, sheet := range m.Sheets {
+					if !sheet.Hidden || !wopts.SkipHiddenSheets {
+						sheets = append(sheets, docx.Heading{Level: 1, Text: sheet.Name, ID: fmt.Sprintf("%s-sheet-%d", id, len(sheets)+1)})
+					}
+				}
+			}
+			writeReportTOC(&toc, sheets)
+		}
+		toc.WriteString("</li>\n")
+		body.WriteString("</section>\n")
+	}
+	toc.WriteString("</ul>\n</nav>\n")
+
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n")
+	if lang := opts.Document.Locale; lang != "" {
+		b.WriteString(fmt.Sprintf("<html lang=\"%s\">\n", html.EscapeString(lang)))
+	} else {
+		b.WriteString("<html>\n")
+	}
+	b.WriteString("<head>\n<meta charset=\"utf-8\">\n")
+	b.WriteString(fmt.Sprintf("<title>%s</title>\n", html.EscapeString(title)))
+	b.WriteString("<style>\n" + docx.DocumentCSS() + reportCSS + strings.Join(rules, "") + "</style>\n")
+	b.WriteString("</head>\n<body>\n")
+	b.WriteString(fmt.Sprintf("<h1 class=\"report-title\">%s</h1>\n", html.EscapeString(title)))
+	b.WriteString(toc.String())
+	b.WriteString(body.String())
+	b.WriteString("</body>\n</html>\n")
+
+	limit, name := outputLimit(opts, 0)
+	if opts.Strict {
+		return strictOutput(b.String(), opts, limit, name)
+	}
+	if limit > 0 {
+		return limitOutput(b.String(), false, limit, name, opts)
+	}
+	return b.String(), nil
+}
+
+// writeReportTOC writes headings as nested lists of links, as the table of
+// contents of a document nests them.
+func writeReportTOC(b *strings.Builder, headings []docx.Heading) {
+	var stack []int // levels of the open lists
+	for _, h := range headings {
+		for len(stack) > 0 && stack[len(stack)-1] > h.Level {
+			b.WriteString("</li>\n</ul>\n")
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) > 0 && stack[len(stack)-1] == h.Level {
+			b.WriteString("</li>\n")
+		} else {
+			b.WriteString("<ul>\n")
+			stack = append(stack, h.Level)
+		}
+		b.WriteString(fmt.Sprintf("<li><a href=\"#%s\">%s</a>", html.EscapeString(h.ID), html.EscapeString(h.Text)))
+	}
+	for range stack {
+		b.WriteString("</li>\n</ul>\n")
+	}
+}
@@ -0,0 +1,17 @@
+package rtf
+
+import (
+	"io"
+
+	"github.com/aerissecure/convert/docx"
+)
+
+// RTFToHTML is a convenience wrapper that converts an RTF reader to HTML
+// with the DOCX renderer.
+func RTFToHTML(r io.ReaderAt, size int64) (string, error) {
+	m, err := ParseDocumentModel(r, size)
+	if err != nil {
+		return "", err
+	}
+	return docx.RenderDocumentHTML(m), nil
+}
@@ -0,0 +1,594 @@
+// Package rtf converts Rich Text Format documents to the DOCX intermediate
+// representation, so they render with the DOCX HTML renderer.  Text,
+// character formatting (bold, italic, underline, strike, super/subscript,
+// fonts, sizes, colours), paragraph alignment, spacing and indents,
+// hyperlinks, document properties and simple tables are converted.
+// Pictures, objects, headers, footers, footnotes and nested tables are
+// dropped.
+package rtf
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/aerissecure/convert/docx"
+	"github.com/aerissecure/convert/internal/panics"
+)
+
+// ErrNotRTF is returned when the input does not start with "{\rtf".
+var ErrNotRTF = errors.New("rtf: not an RTF document")
+
+// -----------------------------------------------------------------------------
+// Parser state
+// -----------------------------------------------------------------------------
+
+// Destinations that are handled specially; any other destination (or
+// unknown "\*" destination) is skipped as a whole.
+const (
+	destSkip     = "skip"
+	destFontTbl  = "fonttbl"
+	destColorTbl = "colortbl"
+	destInfo     = "info"
+	destFldInst  = "fldinst"
+)
+
+// skipDests lists the destinations whose content is not body text.
+var skipDests = map[string]bool{
+	"stylesheet": true, "pict": true, "object": true, "shppict": true, "nonshppict": true,
+	"header": true, "headerl": true, "headerr": true, "headerf": true,
+	"footer": true, "footerl": true, "footerr": true, "footerf": true,
+	"footnote": true, "annotation": true, "listtable": true, "listoverridetable": true,
+	"rsidtbl": true, "revtbl": true, "filetbl": true, "generator": true, "xmlnstbl": true,
+	"themedata": true, "datastore": true, "latentstyles": true, "colorschememapping": true,
+	"pn": true, "bkmkstart": true, "bkmkend": true, "nesttableprops": true,
+}
+
+// infoFields maps the document information destinations to properties.
+var infoFields = map[string]func(*docx.DocProperties) *string{
+	"title":    func(p *docx.DocProperties) *string { return &p.Title },
+	"subject":  func(p *docx.DocProperties) *string { return &p.Subject },
+	"author":   func(p *docx.DocProperties) *string { return &p.Author },
+	"keywords": func(p *docx.DocProperties) *string { return &p.Keywords },
+	"doccomm":  func(p *docx.DocProperties) *string { return &p.Description },
+}
+
+// symbols maps control words that stand for a character.
+var symbols = map[string]string{
+	"line": "\n", "tab": "\t", "emdash": "—", "endash": "–",
+	"emspace": "\u2003", "enspace": "\u2002", "qmspace": "\u2005", "bullet": "•",
+	"lquote": "‘", "rquote": "’", "ldblquote": "“", "rdblquote": "”",
+}
+
+// charState is the character formatting in effect.
+type charState struct {
+	font      int
+	sizeHalf  int // font size in half points, 0 if not set
+	color     int // colour table index, 0 for automatic
+	bold      bool
+	italic    bool
+	underline bool
+	strike    bool
+	script    string // "superscript" | "subscript" | ""
+}
+
+// paraState is the paragraph formatting in effect.
+type paraState struct {
+	align           string
+	spaceBeforePt   float64
+	spaceAfterPt    float64
+	indentLeftPx    float64
+	indentRightPx   float64
+	headingLevel    int
+	pageBreakBefore bool
+	inTable         bool
+}
+
+// groupState is saved on "{" and restored on "}".
+type groupState struct {
+	char charState
+	para paraState
+	dest string
+	info string // info field collected in destInfo, e.g. "title"
+	href string // target of the enclosing hyperlink field
+	uc   int    // fallback characters following \u
+}
+
+// cellDef is a cell definition of the current table row (\cellx).
+type cellDef struct {
+	rightTwips int
+	background int
+	valign     string
+}
+
+// parser converts one RTF document.
+type parser struct {
+	mdl docx.DocumentModel
+
+	st      groupState
+	stack   []groupState
+	starred bool // "\*" seen, the next control word names a destination
+	skipN   int  // fallback characters still to skip after \u
+
+	deff   int
+	fonts  map[int]string
+	font   int // font being defined in the font table
+	colors []string
+	color  [3]int
+	dirty  bool // color holds components of the current colour table entry
+
+	fldInst strings.Builder
+	runs    []docx.RenderRun
+	brk     bool // a \page break precedes the next paragraph
+
+	cells    []cellDef
+	nextCell cellDef
+	cell     docx.RenderTableCell
+	row      docx.RenderTableRow
+	table    *docx.RenderTable
+}
+
+// ParseDocumentModel reads an RTF document from r/size and builds a
+// DocumentModel.
+func ParseDocumentModel(r io.ReaderAt, size int64) (_ docx.DocumentModel, err error) {
+	defer panics.Catch(&err)
+	data, err := io.ReadAll(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return docx.DocumentModel{}, err
+	}
+	if !strings.HasPrefix(strings.TrimLeft(string(data[:min(len(data), 16)]), " \t\r\n"), `{\rtf`) {
+		return docx.DocumentModel{}, ErrNotRTF
+	}
+	p := &parser{fonts: make(map[int]string), st: groupState{uc: 1}}
+	p.parse(data)
+	p.endParagraph(false)
+	p.endTable()
+	return p.mdl, nil
+}
+
+// -----------------------------------------------------------------------------
+// Tokens
+// -----------------------------------------------------------------------------
+
+// parse tokenizes data and dispatches groups, control words and text.
+func (p *parser) parse(data []byte) {
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch c {
+		case '{':
+			p.stack = append(p.stack, p.st)
+			p.starred = false
+			continue
+		case '}':
+			p.closeGroup()
+			continue
+		case '\r', '\n':
+			continue
+		case '\\':
+		default:
+			p.char(rune(c))
+			continue
+		}
+		if i+1 >= len(data) {
+			break
+		}
+		i++
+		c = data[i]
+		switch {
+		case c == '\'' && i+2 < len(data):
+			v, err := strconv.ParseUint(string(data[i+1:i+3]), 16, 8)
+			if err == nil {
+				p.char(cp1252(byte(v)))
+			}
+			i += 2
+		case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			start := i
+			for i < len(data) && (data[i] >= 'a' && data[i] <= 'z' || data[i] >= 'A' && data[i] <= 'Z') {
+				i++
+			}
+			word := string(data[start:i])
+			numStart := i
+			if i < len(data) && data[i] == '-' {
+				i++
+			}
+			for i < len(data) && data[i] >= '0' && data[i] <= '9' {
+				i++
+			}
+			param, err := strconv.Atoi(string(data[numStart:i]))
+			hasParam := err == nil
+			if i >= len(data) || data[i] != ' ' {
+				i-- // the delimiter is not part of the control word
+			}
+			if word == "bin" && param > 0 {
+				i += min(param, len(data)-1-i) // binary data, skipped
+				continue
+			}
+			p.control(word, param, hasParam)
+		default:
+			p.symbol(c)
+		}
+	}
+}
+
+// closeGroup restores the state saved by the matching "{".
+func (p *parser) closeGroup() {
+	if len(p.stack) == 0 {
+		return
+	}
+	closed := p.st
+	p.st = p.stack[len(p.stack)-1]
+	p.stack = p.stack[:len(p.stack)-1]
+	p.starred = false
+	if closed.dest == destFldInst && p.st.dest != destFldInst {
+		p.st.href = hyperlinkTarget(p.fldInst.String())
+		p.fldInst.Reset()
+	}
+}
+
+// symbol handles a control symbol (backslash and one non-letter).
+func (p *parser) symbol(c byte) {
+	switch c {
+	case '*':
+		p.starred = true
+	case '~':
+		p.text("\u00a0") // non-breaking space
+	case '-':
+		p.text("\u00ad") // soft hyphen
+	case '_':
+		p.text("\u2011") // non-breaking hyphen
+	case '\\', '{', '}':
+		p.char(rune(c))
+	case '\r', '\n':
+		p.control("par", 0, false)
+	}
+}
+
+// char handles one character of text, counting off \u fallbacks.
+func (p *parser) char(r rune) {
+	if p.skipN > 0 {
+		p.skipN--
+		return
+	}
+	p.text(string(r))
+}
+
+// -----------------------------------------------------------------------------
+// Control words
+// -----------------------------------------------------------------------------
+
+// control handles a control word with its optional numeric parameter.
+func (p *parser) control(word string, param int, hasParam bool) {
+	on := !hasParam || param != 0
+	starred := p.starred
+	p.starred = false
+	cs, ps := &p.st.char, &p.st.para
+
+	switch {
+	case word == "fonttbl" || word == "colortbl" || word == "info" || word == "fldinst":
+		p.st.dest = word
+		return
+	case infoFields[word] != nil && p.st.dest == destInfo:
+		p.st.info = word
+		return
+	case skipDests[word] || starred:
+		p.st.dest = destSkip
+		return
+	}
+	if p.st.dest == destSkip {
+		return
+	}
+	if p.st.dest == destFontTbl {
+		if word == "f" {
+			p.font = param
+		}
+		return
+	}
+	if p.st.dest == destColorTbl {
+		switch word {
+		case "red":
+			p.color[0], p.dirty = param, true
+		case "green":
+			p.color[1], p.dirty = param, true
+		case "blue":
+			p.color[2], p.dirty = param, true
+		}
+		return
+	}
+
+	if s, ok := symbols[word]; ok {
+		p.text(s)
+		return
+	}
+	switch word {
+	// ---- document ----
+	case "deff":
+		p.deff, cs.font = param, param
+	case "uc":
+		p.st.uc = param
+	case "u":
+		if param < 0 {
+			param += 65536
+		}
+		p.text(string(rune(param)))
+		p.skipN = p.st.uc
+
+	// ---- character formatting ----
+	case "plain":
+		*cs = charState{font: p.deff}
+	case "f":
+		cs.font = param
+	case "fs":
+		cs.sizeHalf = param
+	case "cf":
+		cs.color = param
+	case "b":
+		cs.bold = on
+	case "i":
+		cs.italic = on
+	case "ul":
+		cs.underline = on
+	case "ulnone":
+		cs.underline = false
+	case "strike":
+		cs.strike = on
+	case "super":
+		cs.script = "superscript"
+	case "sub":
+		cs.script = "subscript"
+	case "nosupersub":
+		cs.script = ""
+
+	// ---- paragraphs ----
+	case "pard":
+		*ps = paraState{}
+	case "ql":
+		ps.align = "left"
+	case "qc":
+		ps.align = "center"
+	case "qr":
+		ps.align = "right"
+	case "qj":
+		ps.align = "justify"
+	case "sb":
+		ps.spaceBeforePt = float64(param) / 20
+	case "sa":
+		ps.spaceAfterPt = float64(param) / 20
+	case "li":
+		ps.indentLeftPx = float64(param) / 15
+	case "ri":
+		ps.indentRightPx = float64(param) / 15
+	case "outlinelevel":
+		if param >= 0 && param < 6 {
+			ps.headingLevel = param + 1
+		}
+	case "pagebb":
+		ps.pageBreakBefore = on
+	case "intbl":
+		ps.inTable = true
+	case "par":
+		p.endParagraph(true)
+	case "page":
+		p.endParagraph(false)
+		p.brk = true
+
+	// ---- tables ----
+	case "trowd":
+		p.cells, p.nextCell = nil, cellDef{}
+	case "clcbpat":
+		p.nextCell.background = param
+	case "clvertalt":
+		p.nextCell.valign = "top"
+	case "clvertalc":
+		p.nextCell.valign = "middle"
+	case "clvertalb":
+		p.nextCell.valign = "bottom"
+	case "cellx":
+		p.nextCell.rightTwips = param
+		p.cells = append(p.cells, p.nextCell)
+		p.nextCell = cellDef{}
+	case "cell":
+		p.endCell()
+	case "row":
+		p.endRow()
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Content
+// -----------------------------------------------------------------------------
+
+// text adds s to the current destination.
+func (p *parser) text(s string) {
+	switch p.st.dest {
+	case destSkip:
+	case destFontTbl:
+		for _, r := range s {
+			if r == ';' {
+				p.fonts[p.font] = strings.TrimSpace(p.fonts[p.font])
+				continue
+			}
+			p.fonts[p.font] += string(r)
+		}
+	case destColorTbl:
+		for _, r := range s {
+			if r != ';' {
+				continue
+			}
+			c := ""
+			if p.dirty {
+				c = strings.ToUpper(strconv.FormatInt(int64(1<<24|p.color[0]<<16|p.color[1]<<8|p.color[2]), 16)[1:])
+			}
+			p.colors = append(p.colors, c)
+			p.color, p.dirty = [3]int{}, false
+		}
+	case destInfo:
+		if f := infoFields[p.st.info]; f != nil {
+			*f(&p.mdl.Properties) += s
+		}
+	case destFldInst:
+		p.fldInst.WriteString(s)
+	default:
+		style := p.runStyle()
+		if n := len(p.runs); n > 0 && p.runs[n-1].Style == style && p.runs[n-1].Href == p.st.href {
+			p.runs[n-1].Text += s
+			return
+		}
+		p.runs = append(p.runs, docx.RenderRun{Text: s, Style: style, Href: p.st.href})
+	}
+}
+
+// runStyle resolves the character state to a RunStyle.
+func (p *parser) runStyle() docx.RunStyle {
+	cs := p.st.char
+	s := docx.RunStyle{
+		FontFamily:    p.fonts[cs.font],
+		FontSizePt:    float64(cs.sizeHalf) / 2,
+		Bold:          cs.bold,
+		Italic:        cs.italic,
+		Underline:     cs.underline,
+		Strike:        cs.strike,
+		VerticalAlign: cs.script,
+	}
+	if cs.color > 0 && cs.color < len(p.colors) {
+		s.FontColor = p.colors[cs.color]
+	}
+	return s
+}
+
+// endParagraph closes the current paragraph.  Without force, a paragraph
+// with no text is dropped.
+func (p *parser) endParagraph(force bool) {
+	if len(p.runs) == 0 && !force {
+		return
+	}
+	para := p.paragraph()
+	if p.st.para.inTable {
+		p.cell.Paragraphs = append(p.cell.Paragraphs, para)
+		return
+	}
+	p.endTable()
+	p.addBlock(docx.DocumentBlock{Paragraph: &para})
+}
+
+// paragraph takes the pending runs as a paragraph.
+func (p *parser) paragraph() docx.RenderParagraph {
+	ps := p.st.para
+	para := docx.RenderParagraph{
+		Runs: p.runs,
+		Style: docx.ParagraphStyle{
+			Alignment:     ps.align,
+			SpaceBeforePt: ps.spaceBeforePt,
+			SpaceAfterPt:  ps.spaceAfterPt,
+			IndentLeftPx:  ps.indentLeftPx,
+			IndentRightPx: ps.indentRightPx,
+			HeadingLevel:  ps.headingLevel,
+		},
+		PageBreakBefore: ps.pageBreakBefore || p.brk,
+	}
+	p.runs, p.brk = nil, false
+	return para
+}
+
+// endCell closes the current table cell.
+func (p *parser) endCell() {
+	if len(p.runs) > 0 || len(p.cell.Paragraphs) == 0 {
+		p.cell.Paragraphs = append(p.cell.Paragraphs, p.paragraph())
+	}
+	p.cell.ColSpan, p.cell.RowSpan = 1, 1
+	p.row.Cells = append(p.row.Cells, p.cell)
+	p.cell = docx.RenderTableCell{}
+}
+
+// endRow closes the current table row, applying the cell definitions.
+func (p *parser) endRow() {
+	if len(p.runs) > 0 || len(p.cell.Paragraphs) > 0 {
+		p.endCell()
+	}
+	left := 0
+	for i := range p.row.Cells {
+		if i >= len(p.cells) {
+			break
+		}
+		d := p.cells[i]
+		c := &p.row.Cells[i]
+		if w := d.rightTwips - left; w > 0 {
+			c.WidthPx = float64(w) / 15
+		}
+		left = d.rightTwips
+		if d.background > 0 && d.background < len(p.colors) {
+			c.Style.BackgroundColor = p.colors[d.background]
+		}
+		c.Style.VerticalAlign = d.valign
+	}
+	if p.table == nil {
+		p.table = &docx.RenderTable{}
+	}
+	p.table.Rows = append(p.table.Rows, p.row)
+	p.row = docx.RenderTableRow{}
+}
+
+// endTable emits the table being built, if any.
+func (p *parser) endTable() {
+	if len(p.row.Cells) > 0 {
+		p.endRow()
+	}
+	if p.table == nil {
+		return
+	}
+	t := p.table
+	p.table = nil
+	p.addBlock(docx.DocumentBlock{Table: t})
+}
+
+// addBlock appends a top-level block to the model.
+func (p *parser) addBlock(blk docx.DocumentBlock) {
+	p.mdl.Blocks = append(p.mdl.Blocks, blk)
+	if blk.Paragraph != nil {
+		p.mdl.Paragraphs = append(p.mdl.Paragraphs, *blk.Paragraph)
+	}
+	if blk.Table != nil {
+		p.mdl.Tables = append(p.mdl.Tables, *blk.Table)
+	}
+}
+
+// hyperlinkTarget returns the target of a HYPERLINK field instruction, or
+// "" for other fields.
+func hyperlinkTarget(instr string) string {
+	f := strings.Fields(instr)
+	if len(f) < 2 || !strings.EqualFold(f[0], "HYPERLINK") {
+		return ""
+	}
+	var target, anchor string
+	for i := 1; i < len(f); i++ {
+		switch {
+		case f[i] == `\l` && i+1 < len(f):
+			i++
+			anchor = strings.Trim(f[i], `"`)
+		case !strings.HasPrefix(f[i], `\`) && target == "":
+			target = strings.Trim(f[i], `"`)
+		}
+	}
+	if anchor != "" {
+		return target + "#" + anchor
+	}
+	return target
+}
+
+// cp1252 decodes a Windows-1252 byte.  Other code pages are approximated
+// as Windows-1252.
+func cp1252(b byte) rune {
+	if b >= 0x80 && b < 0xA0 {
+		if r := cp1252High[b-0x80]; r != 0 {
+			return r
+		}
+	}
+	return rune(b)
+}
+
+// cp1252High holds the characters of bytes 0x80-0x9F; zero entries are
+// undefined and decoded as the byte value.
+var cp1252High = [32]rune{
+	'€', 0, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0, 'Ž', 0,
+	0, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0, 'ž', 'Ÿ',
+}
@@ -0,0 +1,56 @@
+package rtf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRTFToHTML(t *testing.T) {
+	src := `{\rtf1\ansi\deff0{\fonttbl{\f0\fswiss Arial;}{\f1\froman Times New Roman;}}
+{\colortbl;\red255\green0\blue0;\red255\green255\blue0;}
+{\info{\title Menu}{\author Chef}}
+{\*\generator Test;}
+\pard\qc\fs32\b Caf\'e9 \u8364?\b0  prices\par
+\pard\f1\cf1\i Red italic\i0  {\field{\*\fldinst HYPERLINK "https://example.com"}{\fldrslt link}}\par
+\trowd\clcbpat2\cellx1500\cellx3000
+\pard\intbl A\cell B\cell\row
+\pard After\par}`
+	m, err := ParseDocumentModel(strings.NewReader(src), int64(len(src)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Properties.Title != "Menu" || m.Properties.Author != "Chef" {
+		t.Errorf("properties = %+v", m.Properties)
+	}
+	if len(m.Blocks) != 4 || m.Blocks[2].Table == nil {
+		t.Fatalf("blocks = %d %+v", len(m.Blocks), m.Blocks)
+	}
+	p0 := m.Blocks[0].Paragraph
+	if p0.Style.Alignment != "center" || p0.Runs[0].Text != "Café €" || !p0.Runs[0].Style.Bold || p0.Runs[0].Style.FontSizePt != 16 || p0.Runs[0].Style.FontFamily != "Arial" {
+		t.Errorf("first paragraph = %+v", p0)
+	}
+	p1 := m.Blocks[1].Paragraph
+	if r := p1.Runs[0]; r.Text != "Red italic" || r.Style.FontColor != "FF0000" || r.Style.FontFamily != "Times New Roman" || !r.Style.Italic {
+		t.Errorf("second paragraph run = %+v", r)
+	}
+	if r := p1.Runs[len(p1.Runs)-1]; r.Text != "link" || r.Href != "https://example.com" {
+		t.Errorf("hyperlink run = %+v", r)
+	}
+	row := m.Blocks[2].Table.Rows[0]
+	if len(row.Cells) != 2 || row.Cells[0].Paragraphs[0].Runs[0].Text != "A" || row.Cells[0].Style.BackgroundColor != "FFFF00" || row.Cells[1].WidthPx != 100 {
+		t.Errorf("table row = %+v", row)
+	}
+
+	html, err := RTFToHTML(strings.NewReader(src), int64(len(src)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Café €", `href="https://example.com"`, "<table", "After"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("html missing %q:\n%s", want, html)
+		}
+	}
+	if _, err := ParseDocumentModel(strings.NewReader("plain"), 5); err != ErrNotRTF {
+		t.Errorf("err = %v, want ErrNotRTF", err)
+	}
+}
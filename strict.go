@@ -0,0 +1,30 @@
+package convert
+
+import "github.com/aerissecure/convert/internal/htmlsafe"
+
+// -----------------------------------------------------------------------------
+// Strict output profile
+// -----------------------------------------------------------------------------
+//
+// With Options.Strict the converters' output is not trusted as is: it is
+// re-parsed by internal/htmlsafe and written back with only allow-listed
+// elements, attributes and CSS properties.  No event handler, script,
+// javascript: link or style loading an external resource survives, and
+// absolute URLs only if they start with one of Options.AllowedURLs, so the
+// HTML can be embedded in another page without running a sanitizer such as
+// bluemonday over it.  The profile is stricter than the default output in
+// a few visible ways: links to other sites lose their href, the stylesheet
+// link of docx.RenderOptions.StylesheetHref is removed, and position: fixed
+// becomes absolute, so watermarks and banners cannot cover the embedding
+// page.
+
+// strictOutput passes html through the sanitizer of the strict profile.
+// Quoting attributes may lengthen it, so the output limit named name of
+// limit bytes is applied again if that is set.
+func strictOutput(html string, opts Options, limit int64, name string) (string, error) {
+	html = htmlsafe.Sanitize(html, htmlsafe.Policy{URLs: opts.AllowedURLs})
+	if limit > 0 {
+		return limitOutput(html, false, limit, name, opts)
+	}
+	return html, nil
+}
@@ -0,0 +1,84 @@
+package xlsx
+
+// -----------------------------------------------------------------------------
+// Borders
+// -----------------------------------------------------------------------------
+//
+// The readers resolve the four sides of a cell's border into
+// CellStyle.Borders, reducing Excel's thirteen line styles to the six the
+// renderers draw.  CellStyle.BorderColor keeps the colour of the left side,
+// as before, and the renderers fall back on it for models without Borders.
+
+// borderStyles maps Excel's line styles, in the order of the BIFF codes
+// (0 is none), to those of a Border.
+var borderStyles = [...]struct{ excel, style string }{
+	{"none", ""},
+	{"thin", "thin"},
+	{"medium", "medium"},
+	{"dashed", "dashed"},
+	{"dotted", "dotted"},
+	{"thick", "thick"},
+	{"double", "double"},
+	{"hair", "thin"},
+	{"mediumDashed", "dashed"},
+	{"dashDot", "dashed"},
+	{"mediumDashDot", "dashed"},
+	{"dashDotDot", "dashed"},
+	{"mediumDashDotDot", "dashed"},
+	{"slantDashDot", "dashed"},
+}
+
+// borderStyle returns the Border style of an Excel line style, "" for none
+// or an unknown one.
+func borderStyle(excel string) string {
+	for _, s := range borderStyles {
+		if s.excel == excel {
+			return s.style
+		}
+	}
+	return ""
+}
+
+// xlsBorderStyle returns the Border style of a BIFF line style code.
+func xlsBorderStyle(code int) string {
+	if code < 0 || code >= len(borderStyles) {
+		return ""
+	}
+	return borderStyles[code].style
+}
+
+// overlayBorders sets the sides of dst that src has a line on to those of
+// src.
+func overlayBorders(dst *Borders, src Borders) {
+	side := func(to *Border, from Border) {
+		if from.Style != "" {
+			*to = from
+		}
+	}
+	side(&dst.Top, src.Top)
+	side(&dst.Right, src.Right)
+	side(&dst.Bottom, src.Bottom)
+	side(&dst.Left, src.Left)
+}
+
+// borderWidthPx returns the width of a Border style in CSS pixels.
+func borderWidthPx(style string) float64 {
+	switch style {
+	case "medium":
+		return 2
+	case "thick", "double":
+		return 3
+	}
+	return 1
+}
+
+// borderSide is a side of a cell's border with its CSS name.
+type borderSide struct {
+	name string // top, right, bottom or left
+	Border
+}
+
+// borderSides returns the sides of b in CSS order.
+func borderSides(b Borders) [4]borderSide {
+	return [4]borderSide{{"top", b.Top}, {"right", b.Right}, {"bottom", b.Bottom}, {"left", b.Left}}
+}
@@ -0,0 +1,103 @@
+package xlsx
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// -----------------------------------------------------------------------------
+// Cell references
+// -----------------------------------------------------------------------------
+//
+// A1-style references are read and written here rather than with
+// unioffice's reference package, so that the native reader, the XLS reader
+// and the renderers build without unioffice (see Native).
+
+// Excel's grid limits, which references are checked against.
+const (
+	maxRows = 1 << 20
+	maxCols = 1 << 14
+)
+
+// cellRef is the position of a cell, 0-based.
+type cellRef struct {
+	row, col int
+}
+
+// columnName returns the letters of 0-based column col, e.g. "AA" for 26.
+func columnName(col int) string {
+	var b [8]byte
+	i := len(b)
+	for {
+		i--
+		b[i] = byte('A' + col%26)
+		col = col/26 - 1
+		if col < 0 {
+			return string(b[i:])
+		}
+	}
+}
+
+// cellName returns the A1-style name of the cell at 0-based row and col.
+func cellName(row, col int) string {
+	return columnName(col) + strconv.Itoa(row+1)
+}
+
+// columnIndex returns the 0-based index of column letters name, in either
+// case, or -1 if name is not a column within Excel's limits.
+func columnIndex(name string) int {
+	if name == "" {
+		return -1
+	}
+	n := 0
+	for _, ch := range strings.ToUpper(name) {
+		if ch < 'A' || ch > 'Z' {
+			return -1
+		}
+		n = n*26 + int(ch-'A'+1)
+		if n > maxCols {
+			return -1
+		}
+	}
+	return n - 1
+}
+
+// parseCellRef parses a cell reference such as "B7" or "Sheet1!$B$7"; the
+// sheet name and absolute markers are ignored.
+func parseCellRef(s string) (cellRef, error) {
+	s = stripSheet(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return r >= '0' && r <= '9' })
+	switch i {
+	case 0:
+		return cellRef{}, fmt.Errorf("no column in %q", s)
+	case -1:
+		return cellRef{}, fmt.Errorf("no row in %q", s)
+	}
+	col := columnIndex(s[:i])
+	if col < 0 {
+		return cellRef{}, fmt.Errorf("bad column in %q", s)
+	}
+	row, err := strconv.Atoi(s[i:])
+	if err != nil || row < 1 || row > maxRows {
+		return cellRef{}, fmt.Errorf("bad row in %q", s)
+	}
+	return cellRef{row - 1, col}, nil
+}
+
+// parseRangeRef parses a range reference such as "A1:C9", returning its
+// corners as written.
+func parseRangeRef(s string) (from, to cellRef, err error) {
+	a, b, ok := strings.Cut(stripSheet(s), ":")
+	if !ok {
+		return cellRef{}, cellRef{}, errors.New("invalid range format")
+	}
+	if from, err = parseCellRef(a); err != nil {
+		return cellRef{}, cellRef{}, err
+	}
+	if to, err = parseCellRef(b); err != nil {
+		return cellRef{}, cellRef{}, err
+	}
+	return from, to, nil
+}
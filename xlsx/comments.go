@@ -0,0 +1,202 @@
+package xlsx
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aerissecure/convert/diag"
+)
+
+// -----------------------------------------------------------------------------
+// Comments
+// -----------------------------------------------------------------------------
+//
+// A worksheet has two kinds of comment.  Notes, the older kind, live in a
+// comments part with a list of authors; Excel starts their text with the
+// author's name and a colon, which is dropped.  Threaded comments, the
+// newer kind, live in a threadedComments part and name their authors by ID
+// in the workbook's persons part; replies name the comment they answer.
+// Excel writes a note alongside every thread for older readers, so notes
+// on cells that have a thread are ignored.
+//
+// A comment belongs to the cell it names, or to the merged cell covering
+// it; a blank cell with a comment is added to the grid, which grows if the
+// cell lies beyond it.
+
+const (
+	relComments        = "comments"
+	relThreadedComment = "threadedComment"
+	relPerson          = "person"
+)
+
+type xmlComments struct {
+	Authors  []string `xml:"authors>author"`
+	Comments []struct {
+		Ref      string `xml:"ref,attr"`
+		AuthorID int    `xml:"authorId,attr"`
+		Text     xmlRst `xml:"text"`
+	} `xml:"commentList>comment"`
+}
+
+type xmlThreadedComments struct {
+	Comments []struct {
+		Ref      string `xml:"ref,attr"`
+		DT       string `xml:"dT,attr"`
+		PersonID string `xml:"personId,attr"`
+		ParentID string `xml:"parentId,attr"`
+		Text     string `xml:"text"`
+	} `xml:"threadedComment"`
+}
+
+// sheetObjects reads the pictures and comments of worksheet part into rs.
+func (p *nativeParser) sheetObjects(part string, rs *RenderSheet) error {
+	images, err := p.sheetImages(part, rs)
+	if err != nil {
+		return err
+	}
+	rs.Images = images
+	return p.sheetComments(part, rs)
+}
+
+// sheetComments reads the notes and threaded comments of worksheet part
+// and attaches them to the cells of rs.
+func (p *nativeParser) sheetComments(part string, rs *RenderSheet) error {
+	_, byType, err := p.rels(part)
+	if err != nil {
+		return err
+	}
+	var refs []string // in order of first comment
+	byRef := make(map[string][]CellComment)
+	if name, ok := byType[relThreadedComment]; ok {
+		var tc xmlThreadedComments
+		if err := p.readXML(name, &tc); err != nil {
+			return err
+		}
+		persons, err := p.commentAuthors()
+		if err != nil {
+			return err
+		}
+		for _, c := range tc.Comments {
+			if _, ok := byRef[c.Ref]; !ok {
+				refs = append(refs, c.Ref)
+			}
+			byRef[c.Ref] = append(byRef[c.Ref], CellComment{Author: persons[c.PersonID], Text: c.Text, Date: commentDate(c.DT), Reply: c.ParentID != ""})
+		}
+	}
+	if name, ok := byType[relComments]; ok {
+		var cs xmlComments
+		if err := p.readXML(name, &cs); err != nil {
+			return err
+		}
+		threaded := len(refs)
+		for _, c := range cs.Comments {
+			if slices.Contains(refs[:threaded], c.Ref) {
+				continue
+			}
+			var author string
+			if c.AuthorID >= 0 && c.AuthorID < len(cs.Authors) {
+				author = cs.Authors[c.AuthorID]
+			}
+			text := c.Text.text()
+			if author != "" {
+				text = strings.TrimPrefix(text, author+":\n")
+			}
+			if _, ok := byRef[c.Ref]; !ok {
+				refs = append(refs, c.Ref)
+			}
+			byRef[c.Ref] = append(byRef[c.Ref], CellComment{Author: author, Text: text})
+		}
+	}
+	for _, ref := range refs {
+		if !attachComments(rs, ref, byRef[ref]) {
+			p.warnings = append(p.warnings, diag.Warning{Code: diag.BadReference, Location: diag.Location{Sheet: rs.Name, Cell: ref}, Message: "comment: bad cell reference"})
+		}
+	}
+	return nil
+}
+
+// commentAuthors returns the display names of the workbook's persons by
+// ID, reading them once.
+func (p *nativeParser) commentAuthors() (map[string]string, error) {
+	if p.persons != nil {
+		return p.persons, nil
+	}
+	var x struct {
+		Persons []struct {
+			ID          string `xml:"id,attr"`
+			DisplayName string `xml:"displayName,attr"`
+		} `xml:"person"`
+	}
+	if name, ok := p.parts[relPerson]; ok {
+		if err := p.readXML(name, &x); err != nil {
+			return nil, err
+		}
+	}
+	p.persons = make(map[string]string, len(x.Persons))
+	for _, ps := range x.Persons {
+		p.persons[ps.ID] = ps.DisplayName
+	}
+	return p.persons, nil
+}
+
+// commentDate parses the dT attribute of a threaded comment, which Excel
+// writes without a zone, as UTC.  It returns the zero time if s is not a
+// date.
+func commentDate(s string) time.Time {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// attachComments adds cs to the cell of rs at ref, or to the merged cell
+// covering it, adding a blank cell if there is none.  It reports false if
+// ref is not a cell reference.
+func attachComments(rs *RenderSheet, ref string, cs []CellComment) bool {
+	cr, err := parseCellRef(ref)
+	if err != nil {
+		return false
+	}
+	r, c := cr.row, cr.col
+	if cell := coveringCell(rs, r, c); cell != nil {
+		cell.Comments = append(cell.Comments, cs...)
+		return true
+	}
+	// Grow the grid to hold the cell.
+	cols := max(len(rs.ColWidths), c+1)
+	for len(rs.ColWidths) < cols {
+		rs.ColWidths = append(rs.ColWidths, defaultColChars*pxPerChar)
+	}
+	for len(rs.ColHidden) < cols {
+		rs.ColHidden = append(rs.ColHidden, false)
+	}
+	for len(rs.Rows) <= r {
+		rs.Rows = append(rs.Rows, RenderRow{HeightPx: defaultRowPt * pxPerPt})
+	}
+	for i := range rs.Rows {
+		if n := len(rs.Rows[i].Cells); n < cols {
+			rs.Rows[i].Cells = append(rs.Rows[i].Cells, make([]*RenderCell, cols-n)...)
+		}
+	}
+	rs.Rows[r].Cells[c] = &RenderCell{Ref: strings.ToUpper(ref), ColSpan: 1, RowSpan: 1, Comments: cs}
+	return true
+}
+
+// coveringCell returns the cell of rs at row r and column c, or the merged
+// cell covering it, or nil.
+func coveringCell(rs *RenderSheet, r, c int) *RenderCell {
+	for i := min(r, len(rs.Rows)-1); i >= 0; i-- {
+		cells := rs.Rows[i].Cells
+		for j := min(c, len(cells)-1); j >= 0; j-- {
+			if cell := cells[j]; cell != nil {
+				if i+max(cell.RowSpan, 1) > r && j+max(cell.ColSpan, 1) > c {
+					return cell
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,645 @@
+package xlsx
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aerissecure/convert/diag"
+	"github.com/aerissecure/convert/xlsx/ir"
+)
+
+// -----------------------------------------------------------------------------
+// Conditional formatting
+// -----------------------------------------------------------------------------
+//
+// A worksheet's conditionalFormatting elements apply rules to lists of
+// ranges (sqref).  A rule that holds for a cell gives it the differential
+// format (dxf) it names in the styles part: its fill, font colour, bold,
+// italic, underline and strike through, and the sides of its border.
+// Rules are evaluated once, as the sheet is read, against the values the
+// workbook cached; the result is baked into the cells' styles, so every
+// renderer shows it.  Rules apply in priority order: where several hold for
+// a cell, the properties of the first win, and one with stopIfTrue set
+// hides those after it.
+//
+// The rule types evaluated are cellIs, expression (with the formulas the
+// evaluator supports), top10, duplicateValues, uniqueValues, colorScale and
+// iconSet.  Other types, and rules whose formulas cannot be evaluated, are
+// skipped.  Blank cells of the grid that a rule fills or borders get a cell
+// of their own; cells beyond the grid are left out.
+//
+// Colour scales and icon sets apply to the numbers of their ranges, placed
+// against thresholds (cfvo) that are the lowest or highest number, a
+// number, a percentage of the way between the two, a percentile or a
+// formula.  A colour scale fills a cell with the colour interpolated
+// between those of the thresholds around its value; an icon set gives it
+// the icon of the highest threshold it reaches, as RenderCell.Icon, which
+// renderers draw before the value.
+
+// cfRule is a conditional formatting rule, as both backends read it.
+type cfRule struct {
+	typ        string // e.g. "cellIs"
+	operator   string // of cellIs, e.g. "between"
+	formulas   []string
+	dxf        int // -1 if none
+	priority   int
+	stopIfTrue bool
+	rank       int      // of top10
+	percent    bool     // of top10: rank is a percentage
+	bottom     bool     // of top10: the lowest values
+	cfvos      []cfvo   // of colorScale and iconSet: the thresholds, in increasing order
+	colors     []string // of colorScale: "RRGGBB" per threshold
+	iconSet    string   // of iconSet, e.g. "3Arrows"
+	reverse    bool     // of iconSet: the highest values get the first icon
+	hideValue  bool     // of iconSet: showValue="0"
+}
+
+// cfvo is a threshold of a colour scale or icon set.
+type cfvo struct {
+	typ string // min, max, num, percent, percentile or formula
+	val string
+	gte bool // of iconSet: a value equal to the threshold reaches it
+}
+
+// cfRange is a conditionalFormatting element: rules and the ranges they
+// apply to.
+type cfRange struct {
+	sqref []string
+	rules []cfRule
+}
+
+// dxfStyle is a differential format, the formatting a rule applies.
+type dxfStyle struct {
+	fontColor, fillColor            string
+	borders                         Borders
+	bold, italic, underline, strike bool
+}
+
+// Properties of a dxfStyle, set by at most one rule per cell.
+const (
+	cfFill = 1 << iota
+	cfFontColor
+	cfBorder
+	cfBold
+	cfItalic
+	cfUnderline
+	cfStrike
+	cfIcon
+)
+
+// area is a rectangle of cells, 0-based and inclusive.
+type area struct {
+	r0, c0, r1, c1 int
+}
+
+// parseArea parses a cell, range, row or column reference of an sqref.
+func parseArea(ref string) (area, bool) {
+	n, err := parseFormula(ref)
+	if err != nil {
+		return area{}, false
+	}
+	const last = math.MaxInt32
+	switch n := n.(type) {
+	case refNode:
+		return area{n.row, n.col, n.row, n.col}, true
+	case rangeNode:
+		a := area{n.from.row, n.from.col, n.to.row, n.to.col}
+		if n.from.row < 0 {
+			a.r0, a.r1 = 0, last
+		}
+		if n.from.col < 0 {
+			a.c0, a.c1 = 0, last
+		}
+		a.r0, a.r1 = min(a.r0, a.r1), max(a.r0, a.r1)
+		a.c0, a.c1 = min(a.c0, a.c1), max(a.c0, a.c1)
+		return a, true
+	}
+	return area{}, false
+}
+
+// cfTarget is a rule with the areas it applies to.
+type cfTarget struct {
+	rule  cfRule
+	areas []area
+}
+
+// applyConditionalFormats evaluates the rules of ranges on rs and applies
+// the formats of dxfs to the cells they hold for.
+func applyConditionalFormats(rs *RenderSheet, ranges []cfRange, dxfs []dxfStyle, warn func(code diag.Code, ref, msg string)) {
+	var targets []cfTarget
+	for _, cr := range ranges {
+		var areas []area
+		for _, ref := range cr.sqref {
+			a, ok := parseArea(ref)
+			if !ok {
+				warn(diag.BadReference, ref, "conditional format: bad range")
+				continue
+			}
+			areas = append(areas, a)
+		}
+		if len(areas) == 0 {
+			continue
+		}
+		for _, r := range cr.rules {
+			targets = append(targets, cfTarget{r, areas})
+		}
+	}
+	sort.SliceStable(targets, func(i, j int) bool { return targets[i].rule.priority < targets[j].rule.priority })
+
+	rows, cols := len(rs.Rows), len(rs.ColWidths)
+	set := make(map[[2]int]int) // properties applied, by cell
+	stopped := make(map[[2]int]bool)
+	for _, t := range targets {
+		format := cfFormat(rs, t, dxfs)
+		if format == nil {
+			continue
+		}
+		for _, a := range t.areas {
+			for r := a.r0; r <= min(a.r1, rows-1); r++ {
+				for c := a.c0; c <= min(a.c1, cols-1); c++ {
+					pos := [2]int{r, c}
+					if stopped[pos] {
+						continue
+					}
+					dxf, icon, ok := format(r, c)
+					if !ok {
+						continue
+					}
+					set[pos] = applyFormat(rs, r, c, dxf, icon, set[pos])
+					stopped[pos] = t.rule.stopIfTrue
+				}
+			}
+		}
+	}
+}
+
+// cfFormat returns the formatting a rule gives the cell at row r and
+// column c, if it holds for the cell, or nil if the rule cannot be
+// evaluated.
+func cfFormat(rs *RenderSheet, t cfTarget, dxfs []dxfStyle) func(r, c int) (dxfStyle, *CellIcon, bool) {
+	switch t.rule.typ {
+	case "colorScale":
+		return colorScale(rs, t)
+	case "iconSet":
+		return iconSet(rs, t)
+	}
+	if t.rule.dxf < 0 || t.rule.dxf >= len(dxfs) {
+		return nil
+	}
+	holds := cfCondition(rs, t)
+	if holds == nil {
+		return nil
+	}
+	dxf := dxfs[t.rule.dxf]
+	return func(r, c int) (dxfStyle, *CellIcon, bool) { return dxf, nil, holds(r, c) }
+}
+
+// cfCondition returns the test of a rule for the cell at row r and column
+// c, or nil if the rule cannot be evaluated.
+func cfCondition(rs *RenderSheet, t cfTarget) func(r, c int) bool {
+	first := t.areas[0]
+	formulas := make([]fnode, len(t.rule.formulas))
+	for i, f := range t.rule.formulas {
+		n, err := parseFormula(f)
+		if err != nil {
+			return nil
+		}
+		formulas[i] = n
+	}
+	eval := func(n fnode, r, c int) fvalue {
+		e := evaluator{rs: rs, row: r, col: c, dr: r - first.r0, dc: c - first.c0}
+		return n.eval(&e)
+	}
+	value := func(r, c int) fvalue {
+		e := evaluator{rs: rs}
+		return e.value(r, c)
+	}
+	switch t.rule.typ {
+	case "expression":
+		if len(formulas) == 0 {
+			return nil
+		}
+		return func(r, c int) bool { return eval(formulas[0], r, c).truth() }
+	case "cellIs":
+		want := 1
+		switch t.rule.operator {
+		case "between", "notBetween":
+			want = 2
+		}
+		if len(formulas) < want {
+			return nil
+		}
+		return func(r, c int) bool {
+			v := value(r, c)
+			a := eval(formulas[0], r, c)
+			if v.kind == kindError || a.kind == kindError {
+				return false
+			}
+			switch t.rule.operator {
+			case "lessThan":
+				return compare(v, a) < 0
+			case "lessThanOrEqual":
+				return compare(v, a) <= 0
+			case "equal":
+				return compare(v, a) == 0
+			case "notEqual":
+				return compare(v, a) != 0
+			case "greaterThanOrEqual":
+				return compare(v, a) >= 0
+			case "greaterThan":
+				return compare(v, a) > 0
+			}
+			b := eval(formulas[1], r, c)
+			if b.kind == kindError {
+				return false
+			}
+			lo, hi := a, b
+			if compare(lo, hi) > 0 {
+				lo, hi = hi, lo
+			}
+			in := compare(v, lo) >= 0 && compare(v, hi) <= 0
+			return in == (t.rule.operator == "between")
+		}
+	case "top10":
+		var nums []float64
+		cfEach(rs, t.areas, func(r, c int) {
+			if v := value(r, c); v.kind == kindNumber {
+				nums = append(nums, v.num)
+			}
+		})
+		n := t.rule.rank
+		if t.rule.percent {
+			n = len(nums) * n / 100
+		}
+		n = max(min(n, len(nums)), 1)
+		if len(nums) == 0 {
+			return func(int, int) bool { return false }
+		}
+		slices.Sort(nums)
+		if t.rule.bottom {
+			limit := nums[n-1]
+			return func(r, c int) bool { v := value(r, c); return v.kind == kindNumber && v.num <= limit }
+		}
+		limit := nums[len(nums)-n]
+		return func(r, c int) bool { v := value(r, c); return v.kind == kindNumber && v.num >= limit }
+	case "duplicateValues", "uniqueValues":
+		key := func(v fvalue) string {
+			if v.kind == kindText {
+				return "t" + strings.ToLower(v.str)
+			}
+			return strconv.Itoa(int(v.kind)) + strconv.FormatFloat(v.num, 'g', -1, 64) + v.str
+		}
+		counts := make(map[string]int)
+		cfEach(rs, t.areas, func(r, c int) {
+			if v := value(r, c); v.kind != kindBlank {
+				counts[key(v)]++
+			}
+		})
+		dup := t.rule.typ == "duplicateValues"
+		return func(r, c int) bool {
+			v := value(r, c)
+			return v.kind != kindBlank && (counts[key(v)] > 1) == dup
+		}
+	}
+	return nil
+}
+
+// cfEach calls f for each cell of areas within the grid of rs, once.
+func cfEach(rs *RenderSheet, areas []area, f func(r, c int)) {
+	seen := make(map[[2]int]bool)
+	for _, a := range areas {
+		for r := a.r0; r <= min(a.r1, len(rs.Rows)-1); r++ {
+			for c := a.c0; c <= min(a.c1, len(rs.ColWidths)-1); c++ {
+				if !seen[[2]int{r, c}] {
+					seen[[2]int{r, c}] = true
+					f(r, c)
+				}
+			}
+		}
+	}
+}
+
+// cfNumbers returns the numbers of the cells of t's areas, sorted, and a
+// function returning the number of a cell, false if it holds none.
+func cfNumbers(rs *RenderSheet, t cfTarget) ([]float64, func(r, c int) (float64, bool)) {
+	number := func(r, c int) (float64, bool) {
+		e := evaluator{rs: rs}
+		v := e.value(r, c)
+		return v.num, v.kind == kindNumber
+	}
+	var nums []float64
+	cfEach(rs, t.areas, func(r, c int) {
+		if v, ok := number(r, c); ok {
+			nums = append(nums, v)
+		}
+	})
+	slices.Sort(nums)
+	return nums, number
+}
+
+// thresholds returns the values of the thresholds of t over nums, which
+// are sorted and not empty, or false if one cannot be evaluated.
+func thresholds(rs *RenderSheet, t cfTarget, nums []float64) ([]float64, bool) {
+	lo, hi := nums[0], nums[len(nums)-1]
+	out := make([]float64, len(t.rule.cfvos))
+	for i, v := range t.rule.cfvos {
+		switch v.typ {
+		case "min":
+			out[i] = lo
+			continue
+		case "max":
+			out[i] = hi
+			continue
+		}
+		n, err := parseFormula(v.val)
+		if err != nil {
+			return nil, false
+		}
+		e := evaluator{rs: rs, row: t.areas[0].r0, col: t.areas[0].c0}
+		x, errv := n.eval(&e).number()
+		if errv != nil {
+			return nil, false
+		}
+		switch v.typ {
+		case "num", "formula":
+			out[i] = x
+		case "percent":
+			out[i] = lo + (hi-lo)*x/100
+		case "percentile":
+			// PERCENTILE.INC: interpolated between the nearest ranks.
+			k := min(max(x, 0), 100) / 100 * float64(len(nums)-1)
+			j := int(k)
+			out[i] = nums[j]
+			if j+1 < len(nums) {
+				out[i] += (k - float64(j)) * (nums[j+1] - nums[j])
+			}
+		default:
+			return nil, false
+		}
+	}
+	return out, true
+}
+
+// colorScale returns the fill of a colour scale rule for a cell.
+func colorScale(rs *RenderSheet, t cfTarget) func(r, c int) (dxfStyle, *CellIcon, bool) {
+	cv := t.rule.cfvos
+	if len(cv) < 2 || len(cv) != len(t.rule.colors) {
+		return nil
+	}
+	nums, number := cfNumbers(rs, t)
+	if len(nums) == 0 {
+		return nil
+	}
+	limits, ok := thresholds(rs, t, nums)
+	if !ok {
+		return nil
+	}
+	colors := t.rule.colors
+	return func(r, c int) (dxfStyle, *CellIcon, bool) {
+		v, ok := number(r, c)
+		if !ok {
+			return dxfStyle{}, nil, false
+		}
+		i := 0
+		for i < len(limits)-2 && v > limits[i+1] {
+			i++
+		}
+		f := 0.0
+		if span := limits[i+1] - limits[i]; span > 0 {
+			f = min(max((v-limits[i])/span, 0), 1)
+		} else if v >= limits[i+1] {
+			f = 1
+		}
+		return dxfStyle{fillColor: mixColors(colors[i], colors[i+1], f)}, nil, true
+	}
+}
+
+// mixColors returns the colour a fraction f of the way from "RRGGBB"
+// colour a to b.
+func mixColors(a, b string, f float64) string {
+	x, err1 := strconv.ParseUint(a, 16, 32)
+	y, err2 := strconv.ParseUint(b, 16, 32)
+	if err1 != nil || err2 != nil {
+		return a
+	}
+	var out uint64
+	for shift := 16; shift >= 0; shift -= 8 {
+		ca, cb := float64(x>>shift&0xFF), float64(y>>shift&0xFF)
+		out |= uint64(math.Round(ca+(cb-ca)*f)) << shift
+	}
+	return fmt.Sprintf("%06X", out)
+}
+
+// iconSet returns the icon of an icon set rule for a cell.
+func iconSet(rs *RenderSheet, t cfTarget) func(r, c int) (dxfStyle, *CellIcon, bool) {
+	size := ir.IconSetSize(t.rule.iconSet)
+	if size == 0 || len(t.rule.cfvos) != size {
+		return nil
+	}
+	nums, number := cfNumbers(rs, t)
+	if len(nums) == 0 {
+		return nil
+	}
+	limits, ok := thresholds(rs, t, nums)
+	if !ok {
+		return nil
+	}
+	return func(r, c int) (dxfStyle, *CellIcon, bool) {
+		v, ok := number(r, c)
+		if !ok {
+			return dxfStyle{}, nil, false
+		}
+		// The first threshold is the lower bound of the first icon, which
+		// values below it get too.
+		i := 0
+		for j := 1; j < size; j++ {
+			if v > limits[j] || v == limits[j] && t.rule.cfvos[j].gte {
+				i = j
+			}
+		}
+		if t.rule.reverse {
+			i = size - 1 - i
+		}
+		return dxfStyle{}, &CellIcon{Set: t.rule.iconSet, Index: i, HideValue: t.rule.hideValue}, true
+	}
+}
+
+// applyFormat applies the properties of dxf and icon that are not in set
+// to the cell at row r and column c, returning the properties now set.  A
+// blank cell is added if dxf fills or borders it, unless a merge covers
+// it.
+func applyFormat(rs *RenderSheet, r, c int, dxf dxfStyle, icon *CellIcon, set int) int {
+	row := &rs.Rows[r]
+	var rc *RenderCell
+	if c < len(row.Cells) {
+		rc = row.Cells[c]
+	}
+	if rc == nil {
+		if dxf.fillColor == "" && dxf.borders.IsZero() || coveringCell(rs, r, c) != nil {
+			return set
+		}
+		for len(row.Cells) < len(rs.ColWidths) {
+			row.Cells = append(row.Cells, nil)
+		}
+		rc = &RenderCell{Ref: cellName(r, c), ColSpan: 1, RowSpan: 1}
+		row.Cells[c] = rc
+	}
+	apply := func(bit int, ok bool, f func()) {
+		if ok && set&bit == 0 {
+			f()
+			set |= bit
+		}
+	}
+	apply(cfFill, dxf.fillColor != "", func() { rc.Style.BackgroundColor = dxf.fillColor })
+	apply(cfBorder, !dxf.borders.IsZero(), func() {
+		overlayBorders(&rc.Style.Borders, dxf.borders)
+		if dxf.borders.Left.Style != "" {
+			rc.Style.BorderColor = dxf.borders.Left.Color
+		}
+	})
+	apply(cfFontColor, dxf.fontColor != "", func() { colorCell(rc, dxf.fontColor) })
+	if (dxf.bold || dxf.italic || dxf.underline || dxf.strike) && len(rc.Runs) == 0 && rc.Value != "" {
+		rc.Runs = []RenderRun{{Text: rc.Value, FontColor: rc.Style.FontColor}}
+	}
+	runs := func(f func(*RenderRun)) func() {
+		return func() {
+			for i := range rc.Runs {
+				f(&rc.Runs[i])
+			}
+		}
+	}
+	apply(cfBold, dxf.bold, runs(func(r *RenderRun) { r.Bold = true }))
+	apply(cfItalic, dxf.italic, runs(func(r *RenderRun) { r.Italic = true }))
+	apply(cfUnderline, dxf.underline, runs(func(r *RenderRun) { r.Underline = true }))
+	apply(cfStrike, dxf.strike, runs(func(r *RenderRun) { r.Strike = true }))
+	apply(cfIcon, icon != nil, func() { rc.Icon = icon })
+	return set
+}
+
+// -----------------------------------------------------------------------------
+// Reading rules
+// -----------------------------------------------------------------------------
+
+// xmlConditionalFormatting is a conditionalFormatting element of a
+// worksheet.
+type xmlConditionalFormatting struct {
+	Sqref string `xml:"sqref,attr"`
+	Rules []struct {
+		Type       string   `xml:"type,attr"`
+		DxfID      *int     `xml:"dxfId,attr"`
+		Priority   int      `xml:"priority,attr"`
+		StopIfTrue string   `xml:"stopIfTrue,attr"`
+		Operator   string   `xml:"operator,attr"`
+		Rank       int      `xml:"rank,attr"`
+		Percent    string   `xml:"percent,attr"`
+		Bottom     string   `xml:"bottom,attr"`
+		Formulas   []string `xml:"formula"`
+		ColorScale *struct {
+			Cfvos  []xmlCfvo  `xml:"cfvo"`
+			Colors []xmlColor `xml:"color"`
+		} `xml:"colorScale"`
+		IconSet *struct {
+			IconSet   string    `xml:"iconSet,attr"`
+			ShowValue string    `xml:"showValue,attr"`
+			Reverse   string    `xml:"reverse,attr"`
+			Cfvos     []xmlCfvo `xml:"cfvo"`
+		} `xml:"iconSet"`
+	} `xml:"cfRule"`
+}
+
+// xmlCfvo is a threshold of a colour scale or icon set.
+type xmlCfvo struct {
+	Type string `xml:"type,attr"`
+	Val  string `xml:"val,attr"`
+	Gte  string `xml:"gte,attr"`
+}
+
+// cfvos converts thresholds.
+func cfvos(xs []xmlCfvo) []cfvo {
+	out := make([]cfvo, len(xs))
+	for i, x := range xs {
+		out[i] = cfvo{typ: x.Type, val: x.Val, gte: x.Gte == "" || xmlBool(x.Gte)}
+	}
+	return out
+}
+
+// defaultIconSet is the icon set of an iconSet element without one.
+const defaultIconSet = "3TrafficLights1"
+
+// xmlDxf is a differential format of the styles part.
+type xmlDxf struct {
+	Font *struct {
+		B      *xmlVal   `xml:"b"`
+		I      *xmlVal   `xml:"i"`
+		Strike *xmlVal   `xml:"strike"`
+		U      *xmlVal   `xml:"u"`
+		Color  *xmlColor `xml:"color"`
+	} `xml:"font"`
+	FgColor *xmlColor  `xml:"fill>patternFill>fgColor"`
+	BgColor *xmlColor  `xml:"fill>patternFill>bgColor"`
+	Border  *xmlBorder `xml:"border"`
+}
+
+// dxfFlag reports whether a boolean font property is on; it is when
+// present without a value.
+func dxfFlag(v *xmlVal) bool {
+	return v != nil && (v.Val == "" || xmlBool(v.Val))
+}
+
+// conditionalFormats reads the conditional formatting of ws.
+func (p *nativeParser) conditionalFormats(ws *xmlWorksheet) []cfRange {
+	var out []cfRange
+	for _, cf := range ws.ConditionalFormatting {
+		cr := cfRange{sqref: strings.Fields(cf.Sqref)}
+		for _, x := range cf.Rules {
+			r := cfRule{typ: x.Type, operator: x.Operator, formulas: x.Formulas, dxf: -1, priority: x.Priority, stopIfTrue: xmlBool(x.StopIfTrue),
+				rank: x.Rank, percent: xmlBool(x.Percent), bottom: xmlBool(x.Bottom)}
+			if x.DxfID != nil {
+				r.dxf = *x.DxfID
+			}
+			if cs := x.ColorScale; cs != nil {
+				r.cfvos = cfvos(cs.Cfvos)
+				for i := range cs.Colors {
+					r.colors = append(r.colors, p.color(&cs.Colors[i]))
+				}
+			}
+			if is := x.IconSet; is != nil {
+				r.cfvos = cfvos(is.Cfvos)
+				r.iconSet, r.reverse, r.hideValue = is.IconSet, xmlBool(is.Reverse), is.ShowValue != "" && !xmlBool(is.ShowValue)
+				if r.iconSet == "" {
+					r.iconSet = defaultIconSet
+				}
+			}
+			cr.rules = append(cr.rules, r)
+		}
+		out = append(out, cr)
+	}
+	return out
+}
+
+// readDxfs returns the differential formats of the styles part.
+func (p *nativeParser) readDxfs() []dxfStyle {
+	var out []dxfStyle
+	for _, x := range p.styles.Dxfs {
+		var d dxfStyle
+		if f := x.Font; f != nil {
+			d.fontColor = p.color(f.Color)
+			d.bold, d.italic, d.strike = dxfFlag(f.B), dxfFlag(f.I), dxfFlag(f.Strike)
+			d.underline = f.U != nil && f.U.Val != "none"
+		}
+		// The fill of a dxf is its background colour, unlike that of a
+		// cell format.
+		if d.fillColor = p.color(x.BgColor); d.fillColor == "" {
+			d.fillColor = p.color(x.FgColor)
+		}
+		if x.Border != nil {
+			d.borders = p.borders(*x.Border)
+		}
+		out = append(out, d)
+	}
+	return out
+}
@@ -0,0 +1,49 @@
+package xlsx
+
+import (
+	"regexp"
+	"strings"
+)
+
+// -----------------------------------------------------------------------------
+// Dangerous formulas
+// -----------------------------------------------------------------------------
+//
+// A DDE formula such as =cmd|'/c calc'!A1 makes Excel start a program when
+// the workbook is opened and its links are updated, and CALL, REGISTER,
+// WEBSERVICE and RTD reach code or services outside the workbook.  The
+// preview shows only the cached result of a formula, often #N/A or 0, so
+// nothing on screen hints at them.  The XLSX parsers flag these formulas,
+// and text cells that would act as one if the sheet were exported to CSV
+// and reopened, by setting RenderCell.Unsafe and reporting a
+// diag.DangerousFormula warning; RenderOptions.DefangFormulas shows the
+// payload instead of the value.  The XLS backend reads formulas as cached
+// results only and flags nothing.
+
+var (
+	// ddeReference matches a DDE reference, application|topic!item,
+	// e.g. cmd|'/c calc'!A1 or MSEXCEL|'\..\..\cmd.exe'!''.
+	ddeReference = regexp.MustCompile(`(?i)(^|[=(,+\-*/&\s@])[a-z0-9_.]+\s*\|\s*(['"]|[a-z0-9_.]+\s*!)`)
+	// commandFunction matches calls of the functions reaching outside the
+	// workbook.
+	commandFunction = regexp.MustCompile(`(?i)(^|[^a-z0-9_.])(CALL|REGISTER|REGISTER\.ID|EXEC|WEBSERVICE|RTD|DDE|DDEAUTO)\s*\(`)
+)
+
+// dangerousFormula reports whether formula f, with or without its leading
+// "=", launches a program through DDE or calls out of the workbook.
+func dangerousFormula(f string) bool {
+	return ddeReference.MatchString(f) || commandFunction.MatchString(f)
+}
+
+// unsafeCell returns the payload to flag a cell by: "=" and its formula if
+// that is dangerous, else its text if that starts like a formula and would
+// be, else "".
+func unsafeCell(formula, text string) string {
+	if formula != "" && dangerousFormula(formula) {
+		return "=" + strings.TrimPrefix(formula, "=")
+	}
+	if text != "" && strings.ContainsRune("=+-@", rune(text[0])) && dangerousFormula(text) {
+		return text
+	}
+	return ""
+}
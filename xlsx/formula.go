@@ -0,0 +1,1024 @@
+package xlsx
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/aerissecure/convert/xlsx/numfmt"
+)
+
+// -----------------------------------------------------------------------------
+// Formulas
+// -----------------------------------------------------------------------------
+//
+// Conditional formatting rules hold formulas, which are evaluated against
+// the values the workbook cached for its cells, read back from the model.
+// The evaluator knows constants, references to cells, rows, columns and
+// ranges of the same sheet, the arithmetic, text and comparison operators,
+// and the functions of funcs.  Relative references move with the cell a
+// rule is evaluated for, counting from the first cell of the rule's range.
+// References to other sheets, defined names, array formulas and volatile
+// functions such as TODAY are not supported: a formula using them fails to
+// parse, and the rule holding it is skipped.  Comparisons follow Excel:
+// numbers sort before text, which sorts before booleans; text compares
+// without regard to case; and a blank cell equals 0, "" and FALSE.
+
+// errUnsupported is returned for formulas the evaluator cannot handle.
+var errUnsupported = errors.New("unsupported formula")
+
+type valueKind int
+
+const (
+	kindBlank valueKind = iota
+	kindNumber
+	kindText
+	kindBool
+	kindError
+)
+
+// fvalue is the value of a cell or expression.
+type fvalue struct {
+	kind valueKind
+	num  float64 // numbers; 1 or 0 for booleans
+	str  string  // text, or the error, e.g. "#DIV/0!"
+}
+
+func numberValue(v float64) fvalue {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return errorValue("#NUM!")
+	}
+	return fvalue{kind: kindNumber, num: v}
+}
+
+func textValue(s string) fvalue  { return fvalue{kind: kindText, str: s} }
+func errorValue(e string) fvalue { return fvalue{kind: kindError, str: e} }
+
+func boolValue(b bool) fvalue {
+	if b {
+		return fvalue{kind: kindBool, num: 1}
+	}
+	return fvalue{kind: kindBool}
+}
+
+// cellErrors are the error values a cell may hold.
+var cellErrors = map[string]bool{
+	"#NULL!": true, "#DIV/0!": true, "#VALUE!": true, "#REF!": true,
+	"#NAME?": true, "#NUM!": true, "#N/A": true, "#GETTING_DATA": true,
+}
+
+// cellFValue returns the value rc holds, from its raw value, or from the
+// formatted one for models that lack it.
+func cellFValue(rc *RenderCell) fvalue {
+	if rc == nil {
+		return fvalue{}
+	}
+	raw := rc.Raw
+	if raw == "" {
+		raw = rc.Value
+	}
+	switch {
+	case raw == "":
+		return fvalue{}
+	case raw == "TRUE" || raw == "FALSE":
+		return boolValue(raw == "TRUE")
+	case cellErrors[raw]:
+		return errorValue(raw)
+	case strings.ContainsRune("+-.0123456789", rune(raw[0])):
+		if v, err := strconv.ParseFloat(raw, 64); err == nil {
+			return numberValue(v)
+		}
+	}
+	return textValue(raw)
+}
+
+// number converts v for arithmetic, as Excel does: blanks are 0, booleans
+// 0 or 1 and text must hold a number.
+func (v fvalue) number() (float64, *fvalue) {
+	switch v.kind {
+	case kindText:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v.str), 64)
+		if err != nil {
+			e := errorValue("#VALUE!")
+			return 0, &e
+		}
+		return n, nil
+	case kindError:
+		return 0, &v
+	}
+	return v.num, nil
+}
+
+// text converts v for text functions and concatenation.
+func (v fvalue) text() string {
+	switch v.kind {
+	case kindNumber:
+		s, _ := numfmt.Number(v.num, "General")
+		return s
+	case kindBool:
+		if v.num != 0 {
+			return "TRUE"
+		}
+		return "FALSE"
+	}
+	return v.str
+}
+
+// truth reports whether v holds as the result of a rule's formula: a
+// non-zero number or TRUE.
+func (v fvalue) truth() bool {
+	return (v.kind == kindNumber || v.kind == kindBool) && v.num != 0
+}
+
+// compare orders a and b as Excel's comparison operators do.
+func compare(a, b fvalue) int {
+	if a.kind == kindBlank {
+		a = blankAs(b)
+	}
+	if b.kind == kindBlank {
+		b = blankAs(a)
+	}
+	rank := func(v fvalue) int {
+		switch v.kind {
+		case kindText:
+			return 1
+		case kindBool:
+			return 2
+		}
+		return 0
+	}
+	if ra, rb := rank(a), rank(b); ra != rb {
+		return ra - rb
+	}
+	if a.kind == kindText {
+		return strings.Compare(strings.ToLower(a.str), strings.ToLower(b.str))
+	}
+	switch {
+	case a.num < b.num:
+		return -1
+	case a.num > b.num:
+		return 1
+	}
+	return 0
+}
+
+// blankAs returns the value a blank takes when compared with v.
+func blankAs(v fvalue) fvalue {
+	switch v.kind {
+	case kindText:
+		return textValue("")
+	case kindBool:
+		return boolValue(false)
+	}
+	return numberValue(0)
+}
+
+// -----------------------------------------------------------------------------
+// Parsing
+// -----------------------------------------------------------------------------
+
+// fnode is a node of a parsed formula.
+type fnode interface {
+	eval(e *evaluator) fvalue
+}
+
+type constNode struct{ v fvalue }
+
+// refNode is a reference to a cell, or one side of a range.  Whole rows
+// and columns have col or row -1.
+type refNode struct {
+	row, col       int
+	absRow, absCol bool
+}
+
+type rangeNode struct{ from, to refNode }
+
+type unaryNode struct {
+	op byte // '-', '+' or '%'
+	x  fnode
+}
+
+type binaryNode struct {
+	op   string
+	l, r fnode
+}
+
+type callNode struct {
+	name string
+	args []fnode
+}
+
+// parseFormula parses a formula, with or without its leading "=".
+func parseFormula(s string) (fnode, error) {
+	p := &formulaParser{s: strings.TrimPrefix(strings.TrimSpace(s), "=")}
+	n, err := p.compare()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.i < len(p.s) {
+		return nil, errUnsupported
+	}
+	return n, nil
+}
+
+type formulaParser struct {
+	s string
+	i int
+}
+
+func (p *formulaParser) skipSpace() {
+	for p.i < len(p.s) && p.s[p.i] == ' ' {
+		p.i++
+	}
+}
+
+// accept consumes the first of ops found at the current position.
+func (p *formulaParser) accept(ops ...string) string {
+	p.skipSpace()
+	for _, op := range ops {
+		if strings.HasPrefix(p.s[p.i:], op) {
+			p.i += len(op)
+			return op
+		}
+	}
+	return ""
+}
+
+func (p *formulaParser) compare() (fnode, error) {
+	l, err := p.concat()
+	for err == nil {
+		op := p.accept("<>", "<=", ">=", "=", "<", ">")
+		if op == "" {
+			break
+		}
+		var r fnode
+		if r, err = p.concat(); err == nil {
+			l = binaryNode{op, l, r}
+		}
+	}
+	return l, err
+}
+
+func (p *formulaParser) concat() (fnode, error) {
+	return p.binary(p.additive, "&")
+}
+
+func (p *formulaParser) additive() (fnode, error) {
+	return p.binary(p.multiplicative, "+", "-")
+}
+
+func (p *formulaParser) multiplicative() (fnode, error) {
+	return p.binary(p.power, "*", "/")
+}
+
+func (p *formulaParser) power() (fnode, error) {
+	return p.binary(p.unary, "^")
+}
+
+// binary parses a left-associative chain of ops between operands.
+func (p *formulaParser) binary(operand func() (fnode, error), ops ...string) (fnode, error) {
+	l, err := operand()
+	for err == nil {
+		op := p.accept(ops...)
+		if op == "" {
+			break
+		}
+		var r fnode
+		if r, err = operand(); err == nil {
+			l = binaryNode{op, l, r}
+		}
+	}
+	return l, err
+}
+
+func (p *formulaParser) unary() (fnode, error) {
+	if op := p.accept("-", "+"); op != "" {
+		x, err := p.unary()
+		return unaryNode{op[0], x}, err
+	}
+	x, err := p.primary()
+	for err == nil && p.accept("%") != "" {
+		x = unaryNode{'%', x}
+	}
+	return x, err
+}
+
+func (p *formulaParser) primary() (fnode, error) {
+	p.skipSpace()
+	if p.i >= len(p.s) {
+		return nil, errUnsupported
+	}
+	switch c := p.s[p.i]; {
+	case c == '(':
+		p.i++
+		n, err := p.compare()
+		if err != nil {
+			return nil, err
+		}
+		if p.accept(")") == "" {
+			return nil, errUnsupported
+		}
+		return n, nil
+	case c == '"':
+		var b strings.Builder
+		for p.i++; p.i < len(p.s); p.i++ {
+			if p.s[p.i] == '"' {
+				if p.i+1 < len(p.s) && p.s[p.i+1] == '"' {
+					b.WriteByte('"')
+					p.i++
+					continue
+				}
+				p.i++
+				return constNode{textValue(b.String())}, nil
+			}
+			b.WriteByte(p.s[p.i])
+		}
+		return nil, errUnsupported
+	case c == '.' || c >= '0' && c <= '9':
+		start := p.i
+		for p.i < len(p.s) && (strings.IndexByte("0123456789.", p.s[p.i]) >= 0 ||
+			(p.s[p.i] == 'E' || p.s[p.i] == 'e') && p.i+1 < len(p.s) && strings.IndexByte("+-0123456789", p.s[p.i+1]) >= 0) {
+			if p.s[p.i] == 'E' || p.s[p.i] == 'e' {
+				p.i++
+			}
+			p.i++
+		}
+		// A row range such as 1:3.
+		if p.i < len(p.s) && p.s[p.i] == ':' {
+			p.i = start
+			return p.reference()
+		}
+		v, err := strconv.ParseFloat(p.s[start:p.i], 64)
+		if err != nil {
+			return nil, errUnsupported
+		}
+		return constNode{numberValue(v)}, nil
+	case c == '$' || unicode.IsLetter(rune(c)):
+		start := p.i
+		for p.i < len(p.s) && (unicode.IsLetter(rune(p.s[p.i])) || unicode.IsDigit(rune(p.s[p.i])) || strings.IndexByte("$._", p.s[p.i]) >= 0) {
+			p.i++
+		}
+		word := strings.ToUpper(p.s[start:p.i])
+		if p.i < len(p.s) && p.s[p.i] == '(' {
+			return p.call(word)
+		}
+		switch word {
+		case "TRUE", "FALSE":
+			return constNode{boolValue(word == "TRUE")}, nil
+		}
+		p.i = start
+		return p.reference()
+	}
+	return nil, errUnsupported
+}
+
+// call parses the arguments of function name.
+func (p *formulaParser) call(name string) (fnode, error) {
+	if _, ok := funcs[name]; !ok {
+		return nil, errUnsupported
+	}
+	p.i++ // (
+	n := callNode{name: name}
+	if p.accept(")") != "" {
+		return n, nil
+	}
+	for {
+		arg, err := p.compare()
+		if err != nil {
+			return nil, err
+		}
+		n.args = append(n.args, arg)
+		switch p.accept(",", ")") {
+		case ")":
+			return n, nil
+		case "":
+			return nil, errUnsupported
+		}
+	}
+}
+
+// reference parses a cell reference, or a range of cells, rows or
+// columns.
+func (p *formulaParser) reference() (fnode, error) {
+	from, ok := p.ref()
+	if !ok {
+		return nil, errUnsupported
+	}
+	if p.i < len(p.s) && p.s[p.i] == ':' {
+		p.i++
+		to, ok := p.ref()
+		if !ok || (from.row < 0) != (to.row < 0) || (from.col < 0) != (to.col < 0) {
+			return nil, errUnsupported
+		}
+		return rangeNode{from, to}, nil
+	}
+	if from.row < 0 || from.col < 0 {
+		return nil, errUnsupported
+	}
+	return from, nil
+}
+
+// ref parses one side of a reference: A1, $A$1, A or 1.
+func (p *formulaParser) ref() (refNode, bool) {
+	r := refNode{row: -1, col: -1}
+	take := func(digits bool) (string, bool) {
+		abs := p.i < len(p.s) && p.s[p.i] == '$'
+		if abs {
+			p.i++
+		}
+		start := p.i
+		for p.i < len(p.s) {
+			c := p.s[p.i]
+			if digits && (c < '0' || c > '9') || !digits && !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z') {
+				break
+			}
+			p.i++
+		}
+		if p.i == start && abs {
+			p.i--
+		}
+		return p.s[start:p.i], abs
+	}
+	start := p.i
+	if col, abs := take(false); col != "" {
+		r.col, r.absCol = columnIndex(col), abs
+		if r.col < 0 {
+			p.i = start
+			return r, false
+		}
+	}
+	if row, abs := take(true); row != "" {
+		n, err := strconv.Atoi(row)
+		if err != nil || n < 1 {
+			return r, false
+		}
+		r.row, r.absRow = n-1, abs
+	}
+	// A name such as a defined name or another sheet is not a reference.
+	if p.i < len(p.s) && (unicode.IsLetter(rune(p.s[p.i])) || strings.IndexByte("!._(", p.s[p.i]) >= 0) {
+		return r, false
+	}
+	return r, r.row >= 0 || r.col >= 0
+}
+
+// -----------------------------------------------------------------------------
+// Evaluation
+// -----------------------------------------------------------------------------
+
+// evaluator evaluates formulas on a sheet for one cell at a time.
+type evaluator struct {
+	rs     *RenderSheet
+	row    int // the cell evaluated for
+	col    int
+	dr, dc int // offset of the cell from the first cell of the range
+}
+
+// value returns the value of the cell at row r and column c.
+func (e *evaluator) value(r, c int) fvalue {
+	if r < 0 || r >= len(e.rs.Rows) || c < 0 || c >= len(e.rs.Rows[r].Cells) {
+		return fvalue{}
+	}
+	return cellFValue(e.rs.Rows[r].Cells[c])
+}
+
+// at resolves a reference for the cell evaluated for.
+func (e *evaluator) at(n refNode) (int, int) {
+	r, c := n.row, n.col
+	if r >= 0 && !n.absRow {
+		r += e.dr
+	}
+	if c >= 0 && !n.absCol {
+		c += e.dc
+	}
+	return r, c
+}
+
+// cells returns the values of the cells of a range, clipped to the sheet's
+// grid.
+func (e *evaluator) cells(n rangeNode) []fvalue {
+	r0, c0 := e.at(n.from)
+	r1, c1 := e.at(n.to)
+	if n.from.row < 0 {
+		r0, r1 = 0, len(e.rs.Rows)-1
+	}
+	if n.from.col < 0 {
+		c0, c1 = 0, len(e.rs.ColWidths)-1
+	}
+	r0, r1 = max(min(r0, r1), 0), min(max(r0, r1), len(e.rs.Rows)-1)
+	c0, c1 = max(min(c0, c1), 0), min(max(c0, c1), len(e.rs.ColWidths)-1)
+	var out []fvalue
+	for r := r0; r <= r1; r++ {
+		for c := c0; c <= c1; c++ {
+			out = append(out, e.value(r, c))
+		}
+	}
+	return out
+}
+
+func (n constNode) eval(*evaluator) fvalue { return n.v }
+
+func (n refNode) eval(e *evaluator) fvalue {
+	r, c := e.at(n)
+	if r < 0 || c < 0 {
+		return errorValue("#REF!")
+	}
+	return e.value(r, c)
+}
+
+// eval of a range outside a function's arguments takes the cell in the
+// same row or column as the cell evaluated for, as Excel does.
+func (n rangeNode) eval(e *evaluator) fvalue {
+	r0, c0 := e.at(n.from)
+	r1, c1 := e.at(n.to)
+	if n.from.row < 0 {
+		r0, r1 = 0, math.MaxInt
+	}
+	if n.from.col < 0 {
+		c0, c1 = 0, math.MaxInt
+	}
+	switch {
+	case c0 == c1 && r0 <= e.row && e.row <= r1:
+		return e.value(e.row, c0)
+	case r0 == r1 && c0 <= e.col && e.col <= c1:
+		return e.value(r0, e.col)
+	}
+	return errorValue("#VALUE!")
+}
+
+func (n unaryNode) eval(e *evaluator) fvalue {
+	v, err := n.x.eval(e).number()
+	if err != nil {
+		return *err
+	}
+	switch n.op {
+	case '-':
+		return numberValue(-v)
+	case '%':
+		return numberValue(v / 100)
+	}
+	return numberValue(v)
+}
+
+func (n binaryNode) eval(e *evaluator) fvalue {
+	l, r := n.l.eval(e), n.r.eval(e)
+	if l.kind == kindError {
+		return l
+	}
+	if r.kind == kindError {
+		return r
+	}
+	switch n.op {
+	case "&":
+		return textValue(l.text() + r.text())
+	case "=", "<>", "<", "<=", ">", ">=":
+		c := compare(l, r)
+		return boolValue(map[string]bool{"=": c == 0, "<>": c != 0, "<": c < 0, "<=": c <= 0, ">": c > 0, ">=": c >= 0}[n.op])
+	}
+	a, err := l.number()
+	if err != nil {
+		return *err
+	}
+	b, err := r.number()
+	if err != nil {
+		return *err
+	}
+	switch n.op {
+	case "+":
+		return numberValue(a + b)
+	case "-":
+		return numberValue(a - b)
+	case "*":
+		return numberValue(a * b)
+	case "/":
+		if b == 0 {
+			return errorValue("#DIV/0!")
+		}
+		return numberValue(a / b)
+	}
+	return numberValue(math.Pow(a, b))
+}
+
+func (n callNode) eval(e *evaluator) fvalue {
+	return funcs[n.name](e, n.args)
+}
+
+// -----------------------------------------------------------------------------
+// Functions
+// -----------------------------------------------------------------------------
+
+// funcs are the functions formulas may call, by name.  Each evaluates its
+// own arguments, so IF and the like evaluate only the branch taken.
+var funcs map[string]func(e *evaluator, args []fnode) fvalue
+
+func init() {
+	funcs = map[string]func(*evaluator, []fnode) fvalue{
+		"AND": func(e *evaluator, args []fnode) fvalue { return logical(e, args, true) },
+		"OR":  func(e *evaluator, args []fnode) fvalue { return logical(e, args, false) },
+		"NOT": func(e *evaluator, args []fnode) fvalue {
+			return unary(e, args, func(v fvalue) fvalue {
+				n, err := v.number()
+				if err != nil {
+					return *err
+				}
+				return boolValue(n == 0)
+			})
+		},
+		"IF": func(e *evaluator, args []fnode) fvalue {
+			if len(args) < 2 || len(args) > 3 {
+				return errorValue("#VALUE!")
+			}
+			cond := args[0].eval(e)
+			n, err := cond.number()
+			switch {
+			case err != nil:
+				return *err
+			case n != 0:
+				return args[1].eval(e)
+			case len(args) == 3:
+				return args[2].eval(e)
+			}
+			return boolValue(false)
+		},
+		"IFERROR": func(e *evaluator, args []fnode) fvalue {
+			if len(args) != 2 {
+				return errorValue("#VALUE!")
+			}
+			if v := args[0].eval(e); v.kind != kindError {
+				return v
+			}
+			return args[1].eval(e)
+		},
+		"ISBLANK":  isKind(kindBlank),
+		"ISNUMBER": isKind(kindNumber),
+		"ISTEXT":   isKind(kindText),
+		"ISERROR":  isKind(kindError),
+		"ISEVEN": func(e *evaluator, args []fnode) fvalue {
+			return numeric(e, args, func(v float64) fvalue { return boolValue(int64(v)%2 == 0) })
+		},
+		"ISODD": func(e *evaluator, args []fnode) fvalue {
+			return numeric(e, args, func(v float64) fvalue { return boolValue(int64(v)%2 != 0) })
+		},
+		"ABS": func(e *evaluator, args []fnode) fvalue {
+			return numeric(e, args, func(v float64) fvalue { return numberValue(math.Abs(v)) })
+		},
+		"INT": func(e *evaluator, args []fnode) fvalue {
+			return numeric(e, args, func(v float64) fvalue { return numberValue(math.Floor(v)) })
+		},
+		"MOD": func(e *evaluator, args []fnode) fvalue {
+			return numeric2(e, args, func(a, b float64) fvalue {
+				if b == 0 {
+					return errorValue("#DIV/0!")
+				}
+				return numberValue(a - b*math.Floor(a/b))
+			})
+		},
+		"ROUND": func(e *evaluator, args []fnode) fvalue {
+			return numeric2(e, args, func(a, b float64) fvalue {
+				p := math.Pow10(int(b))
+				return numberValue(math.Round(a*p) / p)
+			})
+		},
+		"LEN": func(e *evaluator, args []fnode) fvalue {
+			return unary(e, args, func(v fvalue) fvalue { return numberValue(float64(len([]rune(v.text())))) })
+		},
+		"UPPER": func(e *evaluator, args []fnode) fvalue {
+			return unary(e, args, func(v fvalue) fvalue { return textValue(strings.ToUpper(v.text())) })
+		},
+		"LOWER": func(e *evaluator, args []fnode) fvalue {
+			return unary(e, args, func(v fvalue) fvalue { return textValue(strings.ToLower(v.text())) })
+		},
+		"TRIM": func(e *evaluator, args []fnode) fvalue {
+			return unary(e, args, func(v fvalue) fvalue { return textValue(strings.Join(strings.Fields(v.text()), " ")) })
+		},
+		"LEFT":  func(e *evaluator, args []fnode) fvalue { return slice(e, args, true) },
+		"RIGHT": func(e *evaluator, args []fnode) fvalue { return slice(e, args, false) },
+		"EXACT": func(e *evaluator, args []fnode) fvalue {
+			if len(args) != 2 {
+				return errorValue("#VALUE!")
+			}
+			return boolValue(args[0].eval(e).text() == args[1].eval(e).text())
+		},
+		"SEARCH": func(e *evaluator, args []fnode) fvalue { return find(e, args, true) },
+		"FIND":   func(e *evaluator, args []fnode) fvalue { return find(e, args, false) },
+		"ROW":    func(e *evaluator, args []fnode) fvalue { return position(e, args, true) },
+		"COLUMN": func(e *evaluator, args []fnode) fvalue { return position(e, args, false) },
+		"SUM": func(e *evaluator, args []fnode) fvalue {
+			return aggregate(e, args, func(vs []float64) fvalue {
+				s := 0.0
+				for _, v := range vs {
+					s += v
+				}
+				return numberValue(s)
+			})
+		},
+		"AVERAGE": func(e *evaluator, args []fnode) fvalue {
+			return aggregate(e, args, func(vs []float64) fvalue {
+				if len(vs) == 0 {
+					return errorValue("#DIV/0!")
+				}
+				s := 0.0
+				for _, v := range vs {
+					s += v
+				}
+				return numberValue(s / float64(len(vs)))
+			})
+		},
+		"MIN": func(e *evaluator, args []fnode) fvalue {
+			return aggregate(e, args, func(vs []float64) fvalue {
+				if len(vs) == 0 {
+					return numberValue(0)
+				}
+				return numberValue(slices.Min(vs))
+			})
+		},
+		"MAX": func(e *evaluator, args []fnode) fvalue {
+			return aggregate(e, args, func(vs []float64) fvalue {
+				if len(vs) == 0 {
+					return numberValue(0)
+				}
+				return numberValue(slices.Max(vs))
+			})
+		},
+		"COUNT": func(e *evaluator, args []fnode) fvalue {
+			return aggregate(e, args, func(vs []float64) fvalue { return numberValue(float64(len(vs))) })
+		},
+		"COUNTA": func(e *evaluator, args []fnode) fvalue {
+			return count(e, args, func(v fvalue) bool { return v.kind != kindBlank })
+		},
+		"COUNTBLANK": func(e *evaluator, args []fnode) fvalue {
+			return count(e, args, func(v fvalue) bool { return v.kind == kindBlank || v.kind == kindText && v.str == "" })
+		},
+		"COUNTIF": func(e *evaluator, args []fnode) fvalue {
+			if len(args) != 2 {
+				return errorValue("#VALUE!")
+			}
+			match := criterion(args[1].eval(e))
+			return count(e, args[:1], match)
+		},
+	}
+}
+
+// logical evaluates AND (all) or OR over args, whose ranges count their
+// numbers and booleans.
+func logical(e *evaluator, args []fnode, all bool) fvalue {
+	if len(args) == 0 {
+		return errorValue("#VALUE!")
+	}
+	result := all
+	for _, v := range argValues(e, args) {
+		switch v.kind {
+		case kindError:
+			return v
+		case kindNumber, kindBool:
+			if all {
+				result = result && v.num != 0
+			} else {
+				result = result || v.num != 0
+			}
+		}
+	}
+	return boolValue(result)
+}
+
+// argValues evaluates args, expanding ranges to their cells.
+func argValues(e *evaluator, args []fnode) []fvalue {
+	var out []fvalue
+	for _, a := range args {
+		if rn, ok := a.(rangeNode); ok {
+			out = append(out, e.cells(rn)...)
+			continue
+		}
+		out = append(out, a.eval(e))
+	}
+	return out
+}
+
+func isKind(k valueKind) func(*evaluator, []fnode) fvalue {
+	return func(e *evaluator, args []fnode) fvalue {
+		if len(args) != 1 {
+			return errorValue("#VALUE!")
+		}
+		return boolValue(args[0].eval(e).kind == k)
+	}
+}
+
+func unary(e *evaluator, args []fnode, f func(fvalue) fvalue) fvalue {
+	if len(args) != 1 {
+		return errorValue("#VALUE!")
+	}
+	v := args[0].eval(e)
+	if v.kind == kindError {
+		return v
+	}
+	return f(v)
+}
+
+func numeric(e *evaluator, args []fnode, f func(float64) fvalue) fvalue {
+	return unary(e, args, func(v fvalue) fvalue {
+		n, err := v.number()
+		if err != nil {
+			return *err
+		}
+		return f(n)
+	})
+}
+
+func numeric2(e *evaluator, args []fnode, f func(a, b float64) fvalue) fvalue {
+	if len(args) != 2 {
+		return errorValue("#VALUE!")
+	}
+	a, err := args[0].eval(e).number()
+	if err != nil {
+		return *err
+	}
+	b, err := args[1].eval(e).number()
+	if err != nil {
+		return *err
+	}
+	return f(a, b)
+}
+
+// slice evaluates LEFT or RIGHT.
+func slice(e *evaluator, args []fnode, left bool) fvalue {
+	if len(args) == 0 || len(args) > 2 {
+		return errorValue("#VALUE!")
+	}
+	s := []rune(args[0].eval(e).text())
+	n := 1.0
+	if len(args) == 2 {
+		var err *fvalue
+		if n, err = args[1].eval(e).number(); err != nil {
+			return *err
+		}
+	}
+	if n < 0 {
+		return errorValue("#VALUE!")
+	}
+	k := min(int(n), len(s))
+	if left {
+		return textValue(string(s[:k]))
+	}
+	return textValue(string(s[len(s)-k:]))
+}
+
+// find evaluates SEARCH, which ignores case, or FIND, returning the
+// position of the first argument in the second, from 1.
+func find(e *evaluator, args []fnode, fold bool) fvalue {
+	if len(args) != 2 {
+		return errorValue("#VALUE!")
+	}
+	needle, hay := args[0].eval(e).text(), args[1].eval(e).text()
+	if fold {
+		needle, hay = strings.ToLower(needle), strings.ToLower(hay)
+	}
+	i := strings.Index(hay, needle)
+	if i < 0 {
+		return errorValue("#VALUE!")
+	}
+	return numberValue(float64(len([]rune(hay[:i])) + 1))
+}
+
+// position evaluates ROW or COLUMN, of the cell evaluated for or of the
+// reference given.
+func position(e *evaluator, args []fnode, row bool) fvalue {
+	r, c := e.row, e.col
+	switch len(args) {
+	case 0:
+	case 1:
+		var n refNode
+		switch a := args[0].(type) {
+		case refNode:
+			n = a
+		case rangeNode:
+			n = a.from
+		default:
+			return errorValue("#VALUE!")
+		}
+		r, c = e.at(n)
+	default:
+		return errorValue("#VALUE!")
+	}
+	if row {
+		return numberValue(float64(r + 1))
+	}
+	return numberValue(float64(c + 1))
+}
+
+// aggregate applies f to the numbers of args: those of ranges, and
+// arguments given directly that convert to numbers.
+func aggregate(e *evaluator, args []fnode, f func([]float64) fvalue) fvalue {
+	var vs []float64
+	for _, a := range args {
+		if rn, ok := a.(rangeNode); ok {
+			for _, v := range e.cells(rn) {
+				switch v.kind {
+				case kindNumber:
+					vs = append(vs, v.num)
+				case kindError:
+					return v
+				}
+			}
+			continue
+		}
+		n, err := a.eval(e).number()
+		if err != nil {
+			return *err
+		}
+		vs = append(vs, n)
+	}
+	return f(vs)
+}
+
+// count counts the values of args that match.
+func count(e *evaluator, args []fnode, match func(fvalue) bool) fvalue {
+	if len(args) == 0 {
+		return errorValue("#VALUE!")
+	}
+	n := 0
+	for _, v := range argValues(e, args) {
+		if match(v) {
+			n++
+		}
+	}
+	return numberValue(float64(n))
+}
+
+// criterion returns the test of a COUNTIF criterion: a value, or a value
+// after a comparison operator, e.g. ">=10" or "<>done".  Text may use the
+// wildcards * and ?.
+func criterion(c fvalue) func(fvalue) bool {
+	if c.kind != kindText {
+		return func(v fvalue) bool { return v.kind != kindBlank && compare(v, c) == 0 }
+	}
+	op, s := "=", c.str
+	for _, o := range []string{"<>", "<=", ">=", "=", "<", ">"} {
+		if strings.HasPrefix(s, o) {
+			op, s = o, s[len(o):]
+			break
+		}
+	}
+	want := textValue(s)
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		want = numberValue(n)
+	}
+	return func(v fvalue) bool {
+		if want.kind == kindText && (op == "=" || op == "<>") {
+			eq := v.kind != kindNumber && wildcardMatch(strings.ToLower(want.str), strings.ToLower(v.text()))
+			if s == "" {
+				eq = v.kind == kindBlank || v.kind == kindText && v.str == ""
+			}
+			return eq == (op == "=")
+		}
+		if v.kind == kindBlank || (v.kind == kindText) != (want.kind == kindText) {
+			return op == "<>"
+		}
+		c := compare(v, want)
+		switch op {
+		case "=":
+			return c == 0
+		case "<>":
+			return c != 0
+		case "<":
+			return c < 0
+		case "<=":
+			return c <= 0
+		case ">":
+			return c > 0
+		}
+		return c >= 0
+	}
+}
+
+// wildcardMatch reports whether s matches pattern, in which * stands for
+// any text, ? for any character and ~ escapes either.
+func wildcardMatch(pattern, s string) bool {
+	p, t := []rune(pattern), []rune(s)
+	var match func(i, j int) bool
+	match = func(i, j int) bool {
+		for ; i < len(p); i, j = i+1, j+1 {
+			literal := p[i] == '~' && i+1 < len(p)
+			if literal {
+				i++
+			}
+			switch {
+			case p[i] == '*' && !literal:
+				for k := j; k <= len(t); k++ {
+					if match(i+1, k) {
+						return true
+					}
+				}
+				return false
+			case j >= len(t):
+				return false
+			case p[i] == '?' && !literal:
+			case p[i] != t[j]:
+				return false
+			}
+		}
+		return j == len(t)
+	}
+	return match(0, 0)
+}
@@ -1,39 +1,31 @@
 package xlsx
 
 import (
+	"bytes"
 	"fmt"
 	"html"
 	"io"
 	"regexp"
+	"strconv"
 	"strings"
+
+	"github.com/aerissecure/convert/fonts"
+	"github.com/aerissecure/convert/internal/csssafe"
+	"github.com/aerissecure/convert/internal/overlay"
+	"github.com/aerissecure/convert/internal/textsafe"
+	"github.com/aerissecure/convert/media"
 )
 
 // DebugHTML controls whether extra data attributes with raw CellStyle info are included in the rendered HTML.
+//
+// Deprecated: Set RenderOptions.Debug instead.  DebugHTML is still honoured
+// when Debug is unset, but changing it while workbooks are being rendered
+// is a data race.
 var DebugHTML bool
 
-// Regular expressions used for sanitizing style values.
-var (
-	fontFamilySafeRe = regexp.MustCompile(`[^a-zA-Z0-9 ,_-]+`)
-	hexColorRe       = regexp.MustCompile(`^[0-9a-fA-F]{3}([0-9a-fA-F]{3})?$`)
-)
-
-// sanitizeFontFamily strips any characters that are not considered safe for a CSS
-// font-family declaration. This prevents breaking out of the CSS context and
-// injecting arbitrary directives.
-func sanitizeFontFamily(s string) string {
-	return fontFamilySafeRe.ReplaceAllString(s, "")
-}
-
-// sanitizeColor ensures the value is a valid 3- or 6-digit hexadecimal string.
-// Any invalid input results in an empty string, preventing potential CSS or
-// markup injection.
-func sanitizeColor(s string) string {
-	if hexColorRe.MatchString(s) {
-		return s
-	}
-	return ""
-}
-
+// XLSXToHTML is a convenience wrapper that converts an XLSX reader to HTML
+// using the intermediate representation defined in this package.  Legacy XLS
+// input is accepted as well.
 func XLSXToHTML(r io.ReaderAt, size int64) (string, error) {
 	ir, err := ParseWorkbookModel(r, size)
 	if err != nil {
@@ -42,9 +34,122 @@ func XLSXToHTML(r io.ReaderAt, size int64) (string, error) {
 	return RenderWorkbookHTML(ir), nil
 }
 
+// RenderOptions configures RenderWorkbookHTMLWith.
+type RenderOptions struct {
+	// Debug includes extra data attributes with the raw CellStyle and run
+	// info.  It replaces the deprecated DebugHTML package variable.
+	Debug bool
+	// Watermark is text written diagonally across every sheet, or every
+	// page of RenderWorkbookPDFWith, e.g. "CONFIDENTIAL".
+	Watermark string
+	// Banner is text shown in a bar above every sheet, or along the top of
+	// every page of RenderWorkbookPDFWith, e.g.
+	// "CONFIDENTIAL — Client — 2024-05-01 10:00".
+	Banner string
+	// DefangFormulas shows the payload of cells flagged as unsafe (see
+	// RenderCell.Unsafe), marked with a warning sign, in place of their
+	// innocent-looking value.
+	DefangFormulas bool
+	// CellRenderers override the rendering of the content of matching
+	// cells; the first that matches a cell renders it.
+	CellRenderers []CellRenderer
+	// SkipHiddenSheets leaves out sheets that are hidden in the workbook.
+	SkipHiddenSheets bool
+	// Sheets, if set, renders only the sheets with these names, and Range
+	// only the cells of each in an A1-style range such as "A1:F40"; see
+	// Select.  Unknown names and malformed ranges render the whole workbook.
+	Sheets []string
+	Range  string
+	// SheetIndex writes a summary of the sheets above them when more than
+	// one is rendered: each sheet's name linked to it, its size and its tab
+	// colour.  Unlike a tab bar it needs no script and prints as it is.
+	SheetIndex bool
+	// Scope, if set, wraps the output in a div with this id and limits the
+	// stylesheet's rules to it, so several workbooks can share one page.
+	// The sheets get the ids Scope-sheet-1, Scope-sheet-2 … in output
+	// order, or sheet-1, sheet-2 … without a Scope if SheetIndex is set.
+	// Characters other than ASCII letters, digits, hyphens and
+	// underscores are replaced by hyphens; it should start with a letter.
+	Scope string
+	// Units rescales row heights, column widths and indents from the
+	// DefaultUnits the parsers measure them in; the zero value keeps them.
+	Units Units
+	// Locale is the BCP 47 language tag declared on every sheet, e.g.
+	// "de-DE".  Workbooks do not record their language.
+	Locale string
+	// FontSubstitutes extends every font-family with replacements for
+	// fonts clients may not have; nil means fonts.Default and an empty map
+	// emits the workbook's fonts alone.
+	FontSubstitutes fonts.Substitutes
+	// NormalizeText, if set, is applied to the output after invalid UTF-8
+	// and disallowed control characters are repaired, e.g. norm.NFC.String
+	// from golang.org/x/text.  It sees markup as well as text, so it must
+	// leave ASCII unchanged.
+	NormalizeText func(string) string
+	// ImageHandler decides the src of the sheets' pictures; see the media
+	// package for the built-in strategies.  nil inlines them as data URIs.
+	// A handler error ends rendering and is returned.
+	ImageHandler media.ImageHandler
+	// URLRewriter, if set, is applied to the src of every picture after
+	// ImageHandler.  It returns the URL to emit, or false to drop it, in
+	// which case the picture is shown as its placeholder.
+	URLRewriter func(url string) (string, bool)
+	// MetafileRasterizer converts WMF and EMF pictures that cannot be
+	// converted to SVG to PNG.  nil shows them as placeholders.
+	MetafileRasterizer media.MetafileRasterizer
+	// RedactImages replaces every picture with a neutral box of the same
+	// size labelled with its name.
+	RedactImages bool
+}
+
 // RenderWorkbookHTML converts the IR into an HTML string.
 func RenderWorkbookHTML(m WorkbookModel) string {
-	var builder strings.Builder
+	return RenderWorkbookHTMLWith(m, RenderOptions{})
+}
+
+// RenderWorkbookHTMLWith is RenderWorkbookHTML with options.  An
+// ImageHandler error cuts the output short at the failing picture; use
+// RenderWorkbookHTMLTo to have it returned.
+func RenderWorkbookHTMLWith(m WorkbookModel, opts RenderOptions) string {
+	var b strings.Builder
+	RenderWorkbookHTMLTo(&b, m, opts) // only the ImageHandler can fail
+	return b.String()
+}
+
+// flushSize is the amount of output RenderWorkbookHTMLTo buffers before
+// writing it.
+const flushSize = 64 << 10
+
+// RenderWorkbookHTMLTo renders the workbook as RenderWorkbookHTMLWith does,
+// writing the HTML to w row by row, so that only a small buffer of it is
+// held in memory rather than the whole output.  It returns the first write
+// error.
+func RenderWorkbookHTMLTo(w io.Writer, m WorkbookModel, opts RenderOptions) error {
+	if sel, err := Select(m, opts.Sheets, opts.Range); err == nil {
+		m = sel
+	}
+	// Output collects in builder until flush repairs the text taken from
+	// the workbook and writes it to w.  It is flushed between rows, so
+	// every chunk ends in markup.
+	var builder bytes.Buffer
+	var err error
+	flush := func() {
+		if err == nil {
+			out := textsafe.CleanBytes(builder.Bytes())
+			if opts.NormalizeText != nil {
+				_, err = io.WriteString(w, opts.NormalizeText(string(out)))
+			} else {
+				_, err = w.Write(out)
+			}
+		}
+		builder.Reset()
+	}
+	debug := opts.Debug || DebugHTML
+	heightScale, widthScale, indentScale := opts.Units.scales()
+	subs := opts.FontSubstitutes
+	if subs == nil {
+		subs = fonts.Default
+	}
 
 	// 1. Collect unique cell styles and count property values
 	type propCount map[string]int
@@ -60,58 +165,85 @@ func RenderWorkbookHTML(m WorkbookModel) string {
 
 	styleMap := make(map[CellStyle]string) // CellStyle -> class name
 	styleList := make([]CellStyle, 0)      // To preserve order
-	classIdx := 1
+	styleCount := make(map[CellStyle]int)
 	styledCells := 0
+	commented, iconed := false, false
 
+	// Cells are counted by style, and the properties of each distinct
+	// style once, weighted by its count: a large sheet has few styles.
+	// The size of the output is estimated on the way, to allocate it once.
+	size := 4096
 	for _, sheet := range m.Sheets {
+		size += 32 * len(sheet.ColWidths)
+		for _, im := range sheet.Images {
+			size += 256 + len(im.Data)*4/3
+		}
 		for _, row := range sheet.Rows {
+			size += 40 + 12*len(row.Cells)
 			for _, cell := range row.Cells {
 				if cell == nil {
 					continue
 				}
 				styledCells++
-				st := cell.Style
-				if st.FontFamily != "" {
-					fontFamilyCount[st.FontFamily]++
-				}
-				if st.FontSizePt > 0 {
-					fontSizeCount[st.FontSizePt]++
-				}
-				if st.BorderColor != "" {
-					borderColorCount[st.BorderColor]++
-				}
-				if st.HorizontalAlign != "" {
-					hAlignCount[st.HorizontalAlign]++
+				size += 48 + len(cell.Ref) + len(cell.Value)
+				for _, c := range cell.Comments {
+					size += 32 + len(c.Author) + len(c.Text)
+					commented = true
 				}
-				if st.VerticalAlign != "" {
-					vAlignCount[st.VerticalAlign]++
+				for _, run := range cell.Runs {
+					size += 64 + len(run.Text)
 				}
-				if st.FontColor != "" {
-					fontColorCount[st.FontColor]++
+				if cell.Icon != nil {
+					size += 256
+					iconed = true
 				}
-				if st.BackgroundColor != "" {
-					bgColorCount[st.BackgroundColor]++
-				}
-				wrapTextCount[st.WrapText]++
-				if st.IndentPx > 0 {
-					indentPxCount[st.IndentPx]++
-				}
-				if _, exists := styleMap[st]; !exists {
-					className := fmt.Sprintf("cellstyle%d", classIdx)
-					styleMap[st] = className
-					styleList = append(styleList, st)
-					classIdx++
+				if styleCount[cell.Style]++; styleCount[cell.Style] == 1 {
+					styleMap[cell.Style] = "cellstyle" + strconv.Itoa(len(styleList)+1)
+					styleList = append(styleList, cell.Style)
 				}
 			}
 		}
 	}
+	if sb, ok := w.(*strings.Builder); ok {
+		sb.Grow(size)
+	}
+	builder.Grow(min(size, 2*flushSize))
+	for _, st := range styleList {
+		n := styleCount[st]
+		if st.FontFamily != "" {
+			fontFamilyCount[st.FontFamily] += n
+		}
+		if st.FontSizePt > 0 {
+			fontSizeCount[st.FontSizePt] += n
+		}
+		if st.BorderColor != "" {
+			borderColorCount[st.BorderColor] += n
+		}
+		if st.HorizontalAlign != "" {
+			hAlignCount[st.HorizontalAlign] += n
+		}
+		if st.VerticalAlign != "" {
+			vAlignCount[st.VerticalAlign] += n
+		}
+		if st.FontColor != "" {
+			fontColorCount[st.FontColor] += n
+		}
+		if st.BackgroundColor != "" {
+			bgColorCount[st.BackgroundColor] += n
+		}
+		wrapTextCount[st.WrapText] += n
+		if st.IndentPx > 0 {
+			indentPxCount[st.IndentPx] += n
+		}
+	}
 
-	// Helper to find most common value with count
+	// Helpers to find the most common value with its count.  Ties go to
+	// the least value, so the output does not vary with map iteration.
 	mostCommonStr := func(m propCount) (string, int) {
 		max := 0
 		val := ""
 		for k, v := range m {
-			if v > max {
+			if v > max || v == max && k < val {
 				max = v
 				val = k
 			}
@@ -122,7 +254,7 @@ func RenderWorkbookHTML(m WorkbookModel) string {
 		max := 0
 		var val float64
 		for k, v := range m {
-			if v > max {
+			if v > max || v == max && k < val {
 				max = v
 				val = k
 			}
@@ -130,15 +262,10 @@ func RenderWorkbookHTML(m WorkbookModel) string {
 		return val, max
 	}
 	mostCommonBool := func(m map[bool]int) (bool, int) {
-		max := 0
-		val := false
-		for k, v := range m {
-			if v > max {
-				max = v
-				val = k
-			}
+		if m[true] > m[false] {
+			return true, m[true]
 		}
-		return val, max
+		return false, m[false]
 	}
 
 	// 2. Compute defaults
@@ -175,27 +302,32 @@ func RenderWorkbookHTML(m WorkbookModel) string {
 	defaultIndentPx := 0.0 // no default indent
 
 	// 3. Basic CSS
+	scope, sel := cssIdent(opts.Scope), ""
+	if scope != "" {
+		sel = "#" + scope + " "
+		builder.WriteString(`<div id="` + scope + `">`)
+	}
 	builder.WriteString(`<style>`)
-	builder.WriteString(`.table { border-collapse: collapse; table-layout: fixed; margin-bottom: 2em; }`)
-	builder.WriteString(`.table td { padding: 4px 8px;`)
-	if defaultFontFamily != "" {
-		builder.WriteString(fmt.Sprintf(" font-family:'%s';", sanitizeFontFamily(defaultFontFamily)))
+	builder.WriteString(sel + `.table { border-collapse: collapse; table-layout: fixed; margin-bottom: 2em; }`)
+	builder.WriteString(sel + `.table td { padding: 4px 8px;`)
+	if stack := subs.Stack(defaultFontFamily); stack != "" {
+		builder.WriteString(" font-family:" + stack + ";")
 	}
 	if defaultFontSize > 0 {
 		builder.WriteString(fmt.Sprintf(" font-size:%.1fpt;", defaultFontSize))
 	}
 	if defaultFontColor != "" {
-		if safe := sanitizeColor(defaultFontColor); safe != "" {
+		if safe := csssafe.Color(defaultFontColor); safe != "" {
 			builder.WriteString(fmt.Sprintf(" color:#%s;", safe))
 		}
 	}
 	if defaultBgColor != "" {
-		if safe := sanitizeColor(defaultBgColor); safe != "" {
+		if safe := csssafe.Color(defaultBgColor); safe != "" {
 			builder.WriteString(fmt.Sprintf(" background-color:#%s;", safe))
 		}
 	}
 	if defaultBorderColor != "" {
-		if safe := sanitizeColor(defaultBorderColor); safe != "" {
+		if safe := csssafe.Color(defaultBorderColor); safe != "" {
 			builder.WriteString(fmt.Sprintf(" border:1px solid #%s;", safe))
 		} else {
 			builder.WriteString(" border:1px solid #333;")
@@ -231,31 +363,82 @@ func RenderWorkbookHTML(m WorkbookModel) string {
 	}
 	// WrapText and IndentPx are less common as defaults, so skip for now
 	builder.WriteString(` }`)
-	builder.WriteString(`.sheet { margin-bottom: 2em; }`)
+	builder.WriteString(sel + `.sheet { margin-bottom: 2em; }`)
+	if opts.SheetIndex {
+		builder.WriteString(sel + `.sheet-index ul { list-style: none; padding-left: 0; }`)
+		builder.WriteString(sel + `.sheet-index .sheet-tab { display: inline-block; width: 0.8em; height: 0.8em; margin-right: 0.4em; border: 1px solid #999; }`)
+		builder.WriteString(sel + `.sheet-index .sheet-size { color: #666; }`)
+	}
+
+	if commented {
+		// Excel's red corner marks the cells with comments, which show on
+		// hover.
+		builder.WriteString(sel + `.table td.has-comment { background-image: linear-gradient(225deg, #c00 6px, transparent 6px); }`)
+	}
+	if iconed {
+		builder.WriteString(sel + `.table .xlsx-icon { width: 1em; height: 1em; vertical-align: -0.125em; margin-right: 0.3em; }`)
+	}
 
 	// 4. Render cell style classes (only properties that differ from default)
 	for i, style := range styleList {
 		className := fmt.Sprintf("cellstyle%d", i+1)
-		css := styleToCSSDiff(style, defaultFontFamily, defaultFontSize, defaultBorderColor, defaultHAlign, defaultVAlign, defaultFontColor, defaultBgColor, defaultWrapText, defaultIndentPx)
+		style.IndentPx *= indentScale
+		css := styleToCSSDiff(style, defaultFontFamily, defaultFontSize, defaultBorderColor, defaultHAlign, defaultVAlign, defaultFontColor, defaultBgColor, defaultWrapText, defaultIndentPx, subs)
 		if css != "" {
-			builder.WriteString(fmt.Sprintf(".table td.%s { %s }\n", className, css))
+			builder.WriteString(fmt.Sprintf("%s.table td.%s { %s }\n", sel, className, css))
 		}
 	}
 	builder.WriteString(`</style>`)
 
+	idPrefix := "" // of the sheets' ids
+	if scope != "" {
+		idPrefix = scope + "-"
+	}
+	if opts.SheetIndex {
+		writeSheetIndex(&builder, m.Sheets, opts.SkipHiddenSheets, idPrefix)
+	}
+
+	var scratch []byte
+	runCSS := make(map[RenderRun]string)
+	shown := 0
 	for _, sheet := range m.Sheets {
+		if sheet.Hidden && opts.SkipHiddenSheets {
+			continue
+		}
+		shown++
 		totalPx := 0.0
 		for _, w := range sheet.ColWidths {
-			totalPx += w
+			totalPx += w * widthScale
+		}
+		sheetAttrs := ""
+		if opts.Watermark != "" {
+			// Let the watermark cover the whole table, however wide.
+			sheetAttrs = ` style="position:relative;min-width:max-content;"`
+		}
+		if opts.Locale != "" {
+			sheetAttrs += fmt.Sprintf(` lang="%s"`, html.EscapeString(opts.Locale))
+		}
+		if scope != "" || opts.SheetIndex {
+			sheetAttrs += fmt.Sprintf(` id="%ssheet-%d"`, idPrefix, shown)
 		}
 		builder.WriteString(fmt.Sprintf(
-			`<div class="sheet" data-name="%s">`,
-			html.EscapeString(sheet.Name),
+			`<div class="sheet" data-name="%s"%s>`,
+			html.EscapeString(sheet.Name), sheetAttrs,
 		))
+		if opts.Banner != "" {
+			builder.WriteString(overlay.Banner("sheet-banner", opts.Banner, "static"))
+		}
+		if opts.Watermark != "" {
+			builder.WriteString(overlay.Watermark("sheet-watermark", opts.Watermark, "absolute"))
+		}
+		if len(sheet.Images) > 0 {
+			// The pictures are placed over the table, relative to its corner.
+			builder.WriteString(`<div class="sheet-grid" style="position:relative;width:max-content;">`)
+		}
 		builder.WriteString(fmt.Sprintf(`<table class="table" style="width:%.0fpx;">`, totalPx))
 		builder.WriteString("  <colgroup>\n")
 		for i, w := range sheet.ColWidths {
-			style := fmt.Sprintf(" style=\"width:%.0fpx;\"", w)
+			style := fmt.Sprintf(" style=\"width:%.0fpx;\"", w*widthScale)
 			if sheet.ColHidden[i] {
 				style = " style=\"display:none;\""
 			}
@@ -263,12 +446,17 @@ func RenderWorkbookHTML(m WorkbookModel) string {
 		}
 		builder.WriteString("  </colgroup>\n")
 
+		// The rows are the hot path of large sheets: they are written
+		// piecewise into builder, numbers through scratch, without fmt.
 		for _, row := range sheet.Rows {
-			rowStyle := fmt.Sprintf("height:%.0fpx;", row.HeightPx)
+			builder.WriteString(`  <tr style="height:`)
+			scratch = strconv.AppendFloat(scratch[:0], row.HeightPx*heightScale, 'f', 0, 64)
+			builder.Write(scratch)
+			builder.WriteString("px;")
 			if row.Hidden {
-				rowStyle += "display:none;"
+				builder.WriteString("display:none;")
 			}
-			builder.WriteString(fmt.Sprintf("  <tr style=\"%s\">\n", rowStyle))
+			builder.WriteString("\">\n")
 			for colIdx := 0; colIdx < len(row.Cells); colIdx++ {
 				cell := row.Cells[colIdx]
 				// Blank cell
@@ -277,47 +465,45 @@ func RenderWorkbookHTML(m WorkbookModel) string {
 					continue
 				}
 
-				// Prepare attributes
-				className := styleMap[cell.Style]
-				spanAttr := ""
+				builder.WriteString(`    <td data-cell="`)
+				writeEscaped(&builder, cell.Ref, false)
+				builder.WriteByte('"')
 				if cell.ColSpan > 1 {
-					spanAttr += fmt.Sprintf(" colspan=\"%d\"", cell.ColSpan)
+					builder.WriteString(` colspan="`)
+					scratch = strconv.AppendInt(scratch[:0], int64(cell.ColSpan), 10)
+					builder.Write(scratch)
+					builder.WriteByte('"')
 				}
 				if cell.RowSpan > 1 {
-					spanAttr += fmt.Sprintf(" rowspan=\"%d\"", cell.RowSpan)
+					builder.WriteString(` rowspan="`)
+					scratch = strconv.AppendInt(scratch[:0], int64(cell.RowSpan), 10)
+					builder.Write(scratch)
+					builder.WriteByte('"')
 				}
-
-				// Build cell inner HTML: either rich runs or plain value
-				var innerHTML string
-				if len(cell.Runs) > 0 {
-					var runB strings.Builder
-					for _, run := range cell.Runs {
-						text := html.EscapeString(run.Text)
-						text = strings.ReplaceAll(text, "\n", "<br>")
-						style := runToInlineCSS(run)
-						runDebugAttr := ""
-						if DebugHTML {
-							runDebugAttr = fmt.Sprintf(" data-run-style=\"%s\"", html.EscapeString(fmt.Sprintf("%+v", run)))
-						}
-						if style != "" {
-							runB.WriteString(fmt.Sprintf("<span style=\"%s\"%s>%s</span>", style, runDebugAttr, text))
-						} else {
-							runB.WriteString(fmt.Sprintf("<span%s>%s</span>", runDebugAttr, text))
-						}
-					}
-					innerHTML = runB.String()
-				} else {
-					escaped := html.EscapeString(cell.Value)
-					escaped = strings.ReplaceAll(escaped, "\n", "<br>")
-					innerHTML = escaped
+				builder.WriteString(` class="`)
+				builder.WriteString(styleMap[cell.Style])
+				if len(cell.Comments) > 0 {
+					builder.WriteString(` has-comment" title="`)
+					writeCommentsTitle(&builder, cell.Comments)
 				}
+				builder.WriteByte('"')
+				if debug {
+					builder.WriteString(` data-style="`)
+					writeEscaped(&builder, fmt.Sprintf("%+v", cell.Style), false)
+					builder.WriteByte('"')
+				}
+				builder.WriteByte('>')
 
-				debugAttr := ""
-				if DebugHTML {
-					debugAttr = fmt.Sprintf(" data-style=\"%s\"", html.EscapeString(fmt.Sprintf("%+v", cell.Style)))
+				if fn := cellRenderer(opts.CellRenderers, cell); fn != nil {
+					builder.WriteString(fn(cell, func() string {
+						var b bytes.Buffer
+						writeCellContent(&b, cell, opts, debug, runCSS, subs)
+						return b.String()
+					}))
+				} else {
+					writeCellContent(&builder, cell, opts, debug, runCSS, subs)
 				}
-				builder.WriteString(fmt.Sprintf("    <td data-cell=\"%s\"%s class=\"%s\"%s>%s</td>\n",
-					html.EscapeString(cell.Ref), spanAttr, className, debugAttr, innerHTML))
+				builder.WriteString("</td>\n")
 
 				// Skip over columns that are covered by this cell's colspan so we don't emit extra cells
 				if cell.ColSpan > 1 {
@@ -325,33 +511,319 @@ func RenderWorkbookHTML(m WorkbookModel) string {
 				}
 			}
 			builder.WriteString("  </tr>\n")
+			if builder.Len() >= flushSize {
+				if flush(); err != nil {
+					return err
+				}
+			}
+		}
+		builder.WriteString("</table>\n")
+		if len(sheet.Images) > 0 {
+			if herr := writeSheetImages(&builder, &sheet, opts, heightScale, widthScale); herr != nil && err == nil {
+				err = herr
+			}
+			builder.WriteString("</div>\n")
 		}
-		builder.WriteString("</table>\n</div>\n")
+		builder.WriteString("</div>\n")
 	}
-	return builder.String()
+	if scope != "" {
+		builder.WriteString("</div>\n")
+	}
+	flush()
+	return err
+}
+
+// writeCellContent writes the content of cell's td: the defanged payload,
+// rich runs or the plain value.
+func writeCellContent(b *bytes.Buffer, cell *RenderCell, opts RenderOptions, debug bool, runCSS map[RenderRun]string, subs fonts.Substitutes) {
+	if opts.DefangFormulas && cell.Unsafe != "" {
+		b.WriteString(`<span class="xlsx-unsafe" title="Dangerous formula, not evaluated">&#x26A0; `)
+		writeEscaped(b, cell.Unsafe, false)
+		b.WriteString("</span>")
+		return
+	}
+	if cell.Icon != nil {
+		writeIcon(b, *cell.Icon)
+		if cell.Icon.HideValue {
+			return
+		}
+	}
+	if len(cell.Runs) == 0 {
+		writeEscaped(b, cell.Value, true)
+		return
+	}
+	for _, run := range cell.Runs {
+		// Runs are styled alike throughout a sheet, so their CSS is built
+		// once per style.
+		key := run
+		key.Text = ""
+		style, ok := runCSS[key]
+		if !ok {
+			style = runToInlineCSS(run, subs)
+			runCSS[key] = style
+		}
+		b.WriteString("<span")
+		if style != "" {
+			b.WriteString(` style="`)
+			b.WriteString(style)
+			b.WriteByte('"')
+		}
+		if debug {
+			b.WriteString(` data-run-style="`)
+			writeEscaped(b, fmt.Sprintf("%+v", run), false)
+			b.WriteByte('"')
+		}
+		b.WriteByte('>')
+		writeEscaped(b, run.Text, true)
+		b.WriteString("</span>")
+	}
+}
+
+// writeSheetImages writes the pictures of sheet as absolutely positioned
+// <img>s over its table, which rows and columns the scales resize.  A
+// picture that cannot be shown, and every picture with RedactImages, is
+// written as a labelled box of the same size.  It returns the error of
+// the ImageHandler, if any.
+func writeSheetImages(b *bytes.Buffer, sheet *RenderSheet, opts RenderOptions, heightScale, widthScale float64) error {
+	handler := opts.ImageHandler
+	if handler == nil {
+		handler = media.DataURI
+	}
+	for _, im := range sheet.Images {
+		x := sheetOffsetPx(im.Col, 0, func(i int) float64 { return colWidthPx(sheet, i) })*widthScale + im.OffsetXPx
+		y := sheetOffsetPx(im.Row, 0, func(i int) float64 { return rowHeightPx(sheet, i) })*heightScale + im.OffsetYPx
+		css := fmt.Sprintf("position:absolute;left:%.0fpx;top:%.0fpx;width:%.0fpx;height:%.0fpx;", x, y, im.WidthPx, im.HeightPx)
+		alt := im.AltText
+		if alt == "" {
+			alt = im.Name
+		}
+		if !opts.RedactImages && len(im.Data) > 0 {
+			if img, ok := media.WebImage(media.Image{Name: im.PartName, ContentType: im.ContentType, Data: im.Data}, opts.MetafileRasterizer); ok {
+				src, err := handler(img)
+				if err != nil {
+					return err
+				}
+				ok := true
+				if opts.URLRewriter != nil {
+					src, ok = opts.URLRewriter(src)
+				}
+				if ok && src != "" {
+					fmt.Fprintf(b, "<img class=\"sheet-image\" src=\"%s\" alt=\"%s\" style=\"%s\">\n", html.EscapeString(src), html.EscapeString(alt), css)
+					continue
+				}
+			}
+		}
+		label, attrs := alt, ""
+		if label == "" {
+			label = "Picture"
+		}
+		if opts.RedactImages {
+			attrs = " data-redacted"
+		}
+		const box = "box-sizing:border-box;overflow:hidden;border:1px dashed #999;padding:4px 8px;color:#555;background:#fff;"
+		fmt.Fprintf(b, "<span class=\"sheet-image\"%s style=\"%s%s\">[%s]</span>\n", attrs, css, box, html.EscapeString(label))
+	}
+	return nil
+}
+
+// writeCommentsTitle writes the escaped tooltip of a cell's comments: each
+// on a line of its own as "Author: text", replies indented.
+func writeCommentsTitle(b *bytes.Buffer, comments []CellComment) {
+	for i, c := range comments {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		if c.Reply {
+			b.WriteString("  ")
+		}
+		if c.Author != "" {
+			writeEscaped(b, c.Author, false)
+			b.WriteString(": ")
+		}
+		writeEscaped(b, c.Text, false)
+	}
+}
+
+// iconArrows are the rotations of the up arrow that draw the arrows of icon
+// sets.
+var iconArrows = map[string]int{"arrow-up": 0, "arrow-up-right": 45, "arrow-right": 90, "arrow-down-right": 135, "arrow-down": 180}
+
+// writeIcon writes a conditional formatting icon as inline SVG, labelled
+// with its glyph for screen readers.  Unknown icons are left out.
+func writeIcon(b *bytes.Buffer, icon CellIcon) {
+	shape, color := icon.Shape()
+	fill := "#" + csssafe.Color(color)
+	if fill == "#" {
+		return
+	}
+	b.WriteString(`<svg class="xlsx-icon" viewBox="0 0 16 16" role="img" aria-label="`)
+	writeEscaped(b, icon.Glyph(), false)
+	b.WriteString(`">`)
+	mark := func(d string) {
+		fmt.Fprintf(b, `<circle cx="8" cy="8" r="7" fill="%s"/><path d="%s" stroke="#fff" stroke-width="2" fill="none"/>`, fill, d)
+	}
+	switch {
+	case strings.HasPrefix(shape, "arrow-"):
+		fmt.Fprintf(b, `<path d="M8 1 15 8H10.5V15H5.5V8H1Z" fill="%s" transform="rotate(%d 8 8)"/>`, fill, iconArrows[shape])
+	case shape == "circle":
+		fmt.Fprintf(b, `<circle cx="8" cy="8" r="6.5" fill="%s"/>`, fill)
+	case shape == "flag":
+		fmt.Fprintf(b, `<path d="M3.5 1V15" stroke="#404040" stroke-width="1.5"/><path d="M4 2H14L11.5 5.5 14 9H4Z" fill="%s"/>`, fill)
+	case shape == "diamond":
+		fmt.Fprintf(b, `<path d="M8 1 15 8 8 15 1 8Z" fill="%s"/>`, fill)
+	case shape == "triangle":
+		fmt.Fprintf(b, `<path d="M8 1.5 15 14.5H1Z" fill="%s"/>`, fill)
+	case shape == "cross":
+		mark("M5 5 11 11M11 5 5 11")
+	case shape == "exclamation":
+		mark("M8 3.5V9.5M8 11V13")
+	case shape == "check":
+		mark("M4.5 8.5 7 11 11.5 5")
+	case strings.HasPrefix(shape, "bars-"):
+		n := int(shape[len(shape)-1] - '0')
+		for i := 0; i < 4; i++ {
+			c := "#d9d9d9"
+			if i < n {
+				c = fill
+			}
+			fmt.Fprintf(b, `<rect x="%d" y="%d" width="3" height="%d" fill="%s"/>`, 1+4*i, 11-3*i, 4+3*i, c)
+		}
+	case strings.HasPrefix(shape, "quarters-"):
+		wedges := [...]string{"", "M8 8V1.5A6.5 6.5 0 0 1 14.5 8Z", "M8 8V1.5A6.5 6.5 0 0 1 8 14.5Z", "M8 8V1.5A6.5 6.5 0 1 1 1.5 8Z"}
+		n := int(shape[len(shape)-1] - '0')
+		inner := "#fff"
+		if n == 4 {
+			inner = fill
+		}
+		fmt.Fprintf(b, `<circle cx="8" cy="8" r="6.5" fill="%s" stroke="%s"/>`, inner, fill)
+		if n > 0 && n < 4 {
+			fmt.Fprintf(b, `<path d="%s" fill="%s"/>`, wedges[n], fill)
+		}
+	}
+	b.WriteString("</svg>")
+}
+
+// CellRenderer renders the content of the cells it matches in place of the
+// built-in renderer.
+type CellRenderer struct {
+	// Match selects the cells by their Value; nil matches every cell.
+	Match *regexp.Regexp
+	// Render returns the HTML of the content of cell's td, which is
+	// emitted as is; builtin returns the built-in HTML.
+	Render func(cell *RenderCell, builtin func() string) string
+}
+
+// cellRenderer returns the Render function of the first of renderers that
+// matches cell, or nil.
+func cellRenderer(renderers []CellRenderer, cell *RenderCell) func(*RenderCell, func() string) string {
+	for _, r := range renderers {
+		if r.Render != nil && (r.Match == nil || r.Match.MatchString(cell.Value)) {
+			return r.Render
+		}
+	}
+	return nil
+}
+
+// writeSheetIndex writes the summary of RenderOptions.SheetIndex for the
+// sheets that will be rendered, if there is more than one.
+func writeSheetIndex(b *bytes.Buffer, sheets []RenderSheet, skipHidden bool, idPrefix string) {
+	var shown []RenderSheet
+	for _, sheet := range sheets {
+		if !sheet.Hidden || !skipHidden {
+			shown = append(shown, sheet)
+		}
+	}
+	if len(shown) < 2 {
+		return
+	}
+	b.WriteString("<nav class=\"sheet-index\">\n<ul>\n")
+	for i, sheet := range shown {
+		b.WriteString("<li>")
+		if c := csssafe.Color(sheet.TabColor); c != "" {
+			b.WriteString(fmt.Sprintf(`<span class="sheet-tab" style="background-color:#%s;"></span>`, c))
+		} else {
+			b.WriteString(`<span class="sheet-tab"></span>`)
+		}
+		b.WriteString(fmt.Sprintf(`<a href="#%ssheet-%d">%s</a>`, idPrefix, i+1, html.EscapeString(sheet.Name)))
+		b.WriteString(fmt.Sprintf(` <span class="sheet-size">%d rows × %d columns`, len(sheet.Rows), len(sheet.ColWidths)))
+		if sheet.Hidden {
+			b.WriteString(" (hidden)")
+		}
+		b.WriteString("</span></li>\n")
+	}
+	b.WriteString("</ul>\n</nav>\n")
+}
+
+// cssIdent replaces the characters of s that would need escaping in a CSS
+// id selector or an HTML attribute with hyphens.
+func cssIdent(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '-'
+	}, s)
+}
+
+// writeEscaped writes s to b escaped as by html.EscapeString, with line
+// breaks as <br> if breaks is set, without building an intermediate string.
+func writeEscaped(b *bytes.Buffer, s string, breaks bool) {
+	last := 0
+	for i := 0; i < len(s); i++ {
+		var esc string
+		switch s[i] {
+		case '&':
+			esc = "&amp;"
+		case '\'':
+			esc = "&#39;"
+		case '<':
+			esc = "&lt;"
+		case '>':
+			esc = "&gt;"
+		case '"':
+			esc = "&#34;"
+		case '\n':
+			if !breaks {
+				continue
+			}
+			esc = "<br>"
+		default:
+			continue
+		}
+		b.WriteString(s[last:i])
+		b.WriteString(esc)
+		last = i + 1
+	}
+	b.WriteString(s[last:])
 }
 
 // styleToCSSDiff returns only the CSS properties from s that differ from the provided defaults.
-func styleToCSSDiff(s CellStyle, defFontFamily string, defFontSize float64, defBorderColor, defHAlign, defVAlign, defFontColor, defBgColor string, defWrapText bool, defIndentPx float64) string {
+// Font stacks are extended by subs.
+func styleToCSSDiff(s CellStyle, defFontFamily string, defFontSize float64, defBorderColor, defHAlign, defVAlign, defFontColor, defBgColor string, defWrapText bool, defIndentPx float64, subs fonts.Substitutes) string {
 	var b strings.Builder
 	if s.FontFamily != "" && s.FontFamily != defFontFamily {
-		b.WriteString(fmt.Sprintf("font-family:'%s';", sanitizeFontFamily(s.FontFamily)))
+		if stack := subs.Stack(s.FontFamily); stack != "" {
+			b.WriteString("font-family:" + stack + ";")
+		}
 	}
 	if s.FontSizePt > 0 && s.FontSizePt != defFontSize {
 		b.WriteString(fmt.Sprintf("font-size:%.1fpt;", s.FontSizePt))
 	}
 	if s.FontColor != "" && s.FontColor != defFontColor {
-		if safe := sanitizeColor(s.FontColor); safe != "" {
+		if safe := csssafe.Color(s.FontColor); safe != "" {
 			b.WriteString(fmt.Sprintf("color:#%s;", safe))
 		}
 	}
 	if s.BackgroundColor != "" && s.BackgroundColor != defBgColor {
-		if safe := sanitizeColor(s.BackgroundColor); safe != "" {
+		if safe := csssafe.Color(s.BackgroundColor); safe != "" {
 			b.WriteString(fmt.Sprintf("background-color:#%s;", safe))
 		}
 	}
-	if s.BorderColor != "" && s.BorderColor != defBorderColor {
-		if safe := sanitizeColor(s.BorderColor); safe != "" {
+	if !s.Borders.IsZero() {
+		writeBordersCSS(&b, s.Borders)
+	} else if s.BorderColor != "" && s.BorderColor != defBorderColor {
+		if safe := csssafe.Color(s.BorderColor); safe != "" {
 			b.WriteString(fmt.Sprintf("border:1px solid #%s;", safe))
 		}
 	}
@@ -394,17 +866,38 @@ func styleToCSSDiff(s CellStyle, defFontFamily string, defFontSize float64, defB
 	return b.String()
 }
 
-// runToInlineCSS converts a RenderRun's style overrides into an inline CSS string.
-func runToInlineCSS(r RenderRun) string {
+// writeBordersCSS writes the border-* longhands of the sides of b with a
+// line; the others keep the grid's border.
+func writeBordersCSS(b *strings.Builder, borders Borders) {
+	for _, side := range borderSides(borders) {
+		if side.Style == "" {
+			continue
+		}
+		style := side.Style
+		switch style {
+		case "thin", "medium", "thick":
+			style = "solid"
+		}
+		color := "000000"
+		if safe := csssafe.Color(side.Color); safe != "" {
+			color = safe
+		}
+		fmt.Fprintf(b, "border-%[1]s-style:%[2]s;border-%[1]s-width:%.0[3]fpx;border-%[1]s-color:#%[4]s;", side.name, style, borderWidthPx(side.Style), color)
+	}
+}
+
+// runToInlineCSS converts a RenderRun's style overrides into an inline CSS string,
+// extending font stacks by subs.
+func runToInlineCSS(r RenderRun, subs fonts.Substitutes) string {
 	var b strings.Builder
-	if r.FontFamily != "" {
-		b.WriteString(fmt.Sprintf("font-family:'%s';", sanitizeFontFamily(r.FontFamily)))
+	if stack := subs.Stack(r.FontFamily); stack != "" {
+		b.WriteString("font-family:" + stack + ";")
 	}
 	if r.FontSizePt > 0 {
 		b.WriteString(fmt.Sprintf("font-size:%.1fpt;", r.FontSizePt))
 	}
 	if r.FontColor != "" {
-		if safe := sanitizeColor(r.FontColor); safe != "" {
+		if safe := csssafe.Color(r.FontColor); safe != "" {
 			b.WriteString(fmt.Sprintf("color:#%s;", safe))
 		}
 	}
@@ -0,0 +1,216 @@
+package xlsx
+
+import (
+	"encoding/xml"
+	"path"
+	"strings"
+)
+
+// -----------------------------------------------------------------------------
+// Pictures
+// -----------------------------------------------------------------------------
+//
+// A worksheet's pictures live in a drawing part (xdr:wsDr) the sheet refers
+// to by relationship.  Each picture is an xdr:pic held by an anchor: a
+// twoCellAnchor spans from one cell to another, a oneCellAnchor starts at a
+// cell and has a size, and an absoluteAnchor is placed in EMU from the top
+// left corner of the sheet.  All three are reduced to the cell the picture
+// starts in, its offset within that cell and its size in pixels, taken from
+// the picture's a:xfrm or else from the anchor.  Shapes, charts, grouped
+// pictures and linked images are skipped.  Both backends read drawings
+// through the Native reader, as unioffice does not resolve their images.
+
+// emuPerPx is the size of a CSS pixel in EMU.
+const emuPerPx = 9525
+
+const relDrawing = "drawing"
+
+// xmlDrawing is a drawing part; Anchors holds its anchors in document
+// order, which is their stacking order.
+type xmlDrawing struct {
+	Anchors []xmlAnchor `xml:",any"`
+}
+
+type xmlAnchor struct {
+	XMLName xml.Name
+	From    *xmlMarker `xml:"from"`
+	To      *xmlMarker `xml:"to"`
+	Pos     *xmlPoint  `xml:"pos"`
+	Ext     *xmlExtent `xml:"ext"`
+	Pic     *struct {
+		NvPicPr struct {
+			CNvPr struct {
+				Name  string `xml:"name,attr"`
+				Descr string `xml:"descr,attr"`
+				Title string `xml:"title,attr"`
+			} `xml:"cNvPr"`
+		} `xml:"nvPicPr"`
+		Blip struct {
+			Embed string `xml:"embed,attr"`
+		} `xml:"blipFill>blip"`
+		Ext *xmlExtent `xml:"spPr>xfrm>ext"`
+	} `xml:"pic"`
+}
+
+type xmlMarker struct {
+	Col    int   `xml:"col"`
+	ColOff int64 `xml:"colOff"`
+	Row    int   `xml:"row"`
+	RowOff int64 `xml:"rowOff"`
+}
+
+type xmlPoint struct {
+	X int64 `xml:"x,attr"`
+	Y int64 `xml:"y,attr"`
+}
+
+type xmlExtent struct {
+	Cx int64 `xml:"cx,attr"`
+	Cy int64 `xml:"cy,attr"`
+}
+
+// sheetImages returns the pictures of worksheet part, placed on rs, whose
+// column widths and row heights convert two-cell and absolute anchors.
+func (p *nativeParser) sheetImages(part string, rs *RenderSheet) ([]SheetImage, error) {
+	_, byType, err := p.rels(part)
+	if err != nil {
+		return nil, err
+	}
+	name, ok := byType[relDrawing]
+	if !ok {
+		return nil, nil
+	}
+	var d xmlDrawing
+	if err := p.readXML(name, &d); err != nil {
+		return nil, err
+	}
+	byID, _, err := p.rels(name)
+	if err != nil {
+		return nil, err
+	}
+	var out []SheetImage
+	for _, a := range d.Anchors {
+		if a.Pic == nil {
+			continue
+		}
+		media, ok := byID[a.Pic.Blip.Embed]
+		if !ok {
+			continue
+		}
+		data, err := p.readPart(media)
+		if err != nil {
+			return nil, err
+		}
+		pr := a.Pic.NvPicPr.CNvPr
+		img := SheetImage{PartName: media, ContentType: imageContentType(media), Data: data, Name: pr.Name, AltText: pr.Descr}
+		if img.AltText == "" {
+			img.AltText = pr.Title
+		}
+		switch a.XMLName.Local {
+		case "twoCellAnchor", "oneCellAnchor":
+			if a.From == nil {
+				continue
+			}
+			img.Row, img.Col = max(a.From.Row, 0), max(a.From.Col, 0)
+			img.OffsetXPx, img.OffsetYPx = float64(a.From.ColOff)/emuPerPx, float64(a.From.RowOff)/emuPerPx
+		case "absoluteAnchor":
+			if a.Pos == nil {
+				continue
+			}
+			x, y := float64(a.Pos.X)/emuPerPx, float64(a.Pos.Y)/emuPerPx
+			img.Col, img.OffsetXPx = cellAt(x, func(i int) float64 { return colWidthPx(rs, i) })
+			img.Row, img.OffsetYPx = cellAt(y, func(i int) float64 { return rowHeightPx(rs, i) })
+		default:
+			continue
+		}
+		switch {
+		case a.Pic.Ext != nil && a.Pic.Ext.Cx > 0:
+			img.WidthPx, img.HeightPx = float64(a.Pic.Ext.Cx)/emuPerPx, float64(a.Pic.Ext.Cy)/emuPerPx
+		case a.Ext != nil:
+			img.WidthPx, img.HeightPx = float64(a.Ext.Cx)/emuPerPx, float64(a.Ext.Cy)/emuPerPx
+		case a.To != nil:
+			img.WidthPx = sheetOffsetPx(a.To.Col, float64(a.To.ColOff)/emuPerPx, func(i int) float64 { return colWidthPx(rs, i) }) -
+				sheetOffsetPx(img.Col, img.OffsetXPx, func(i int) float64 { return colWidthPx(rs, i) })
+			img.HeightPx = sheetOffsetPx(a.To.Row, float64(a.To.RowOff)/emuPerPx, func(i int) float64 { return rowHeightPx(rs, i) }) -
+				sheetOffsetPx(img.Row, img.OffsetYPx, func(i int) float64 { return rowHeightPx(rs, i) })
+		}
+		if img.WidthPx <= 0 || img.HeightPx <= 0 {
+			continue
+		}
+		out = append(out, img)
+	}
+	return out, nil
+}
+
+// colWidthPx returns the width of column i of rs in DefaultUnits, zero if
+// it is hidden.
+func colWidthPx(rs *RenderSheet, i int) float64 {
+	if i < len(rs.ColHidden) && rs.ColHidden[i] {
+		return 0
+	}
+	if i < len(rs.ColWidths) {
+		return rs.ColWidths[i]
+	}
+	return defaultColChars * pxPerChar
+}
+
+// rowHeightPx returns the height of row i of rs in DefaultUnits, zero if it
+// is hidden.
+func rowHeightPx(rs *RenderSheet, i int) float64 {
+	if i < len(rs.Rows) {
+		if rs.Rows[i].Hidden {
+			return 0
+		}
+		if h := rs.Rows[i].HeightPx; h > 0 {
+			return h
+		}
+	}
+	return defaultRowPt * pxPerPt
+}
+
+// sheetOffsetPx returns the distance from the sheet's edge to offset px
+// into row or column n, whose sizes size returns.
+func sheetOffsetPx(n int, offset float64, size func(int) float64) float64 {
+	for i := range n {
+		offset += size(i)
+	}
+	return offset
+}
+
+// cellAt returns the row or column at distance px from the sheet's edge,
+// and the offset within it.
+func cellAt(px float64, size func(int) float64) (int, float64) {
+	const limit = 1 << 20 // rows in a worksheet
+	for i := range limit {
+		s := size(i)
+		if px < s {
+			return i, px
+		}
+		px -= s
+	}
+	return limit - 1, px
+}
+
+// imageContentType returns the MIME type of the image part name by its
+// extension.
+func imageContentType(name string) string {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".png":
+		return "image/png"
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".gif":
+		return "image/gif"
+	case ".bmp":
+		return "image/bmp"
+	case ".tif", ".tiff":
+		return "image/tiff"
+	case ".svg":
+		return "image/svg+xml"
+	case ".emf":
+		return "image/x-emf"
+	case ".wmf":
+		return "image/x-wmf"
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,264 @@
+package xlsx
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aerissecure/convert/internal/panics"
+	"github.com/aerissecure/convert/internal/safezip"
+)
+
+// -----------------------------------------------------------------------------
+// Incremental updates
+// -----------------------------------------------------------------------------
+//
+// Users re-upload the same workbook with one sheet edited.  UpdateWorkbook
+// compares the new version with the Manifest of the last one and parses
+// and renders only the sheets that changed, returning each as a fragment
+// of its own for the caller to patch into the page it already has.
+//
+// A sheet's digest covers its worksheet part, the shared strings it uses,
+// its drawing, pictures and comments, the styles and theme of the workbook,
+// and its name, visibility and print settings, all read without parsing
+// the sheet.  Shared strings count by their text rather than their index,
+// which Excel renumbers on save, but Excel also rewrites the styles part
+// when a format is first used, so such an edit marks every sheet changed.  Legacy XLS workbooks have no parts
+// to tell apart, so any change to the file marks every sheet changed.
+// Sheets are parsed as the Native backend parses them.
+
+// Manifest identifies the version of each sheet of a workbook.  It can be
+// stored, e.g. as JSON, between uploads.
+type Manifest struct {
+	Sheets []SheetDigest `json:"sheets"`
+}
+
+// SheetDigest identifies the version of one sheet.
+type SheetDigest struct {
+	Name   string `json:"name"`
+	Digest string `json:"digest"` // lowercase hex
+}
+
+// SheetFragment is a sheet rendered on its own by RenderWorkbookHTMLTo,
+// under a Scope of its own so that fragments of different sheets can be
+// patched into one page without their stylesheets or ids clashing.
+type SheetFragment struct {
+	Name  string
+	Scope string // id of the div wrapping HTML, the same in every update
+	HTML  string
+}
+
+// WorkbookUpdate is the result of UpdateWorkbook.
+type WorkbookUpdate struct {
+	Manifest  Manifest        // of the new version, for the next update
+	Changed   []SheetFragment // sheets added or changed, in workbook order
+	Unchanged []string
+	Removed   []string // sheets of the old version the new one lacks
+}
+
+// FingerprintWorkbook returns the Manifest of the XLSX or XLS workbook in
+// r/size without parsing its sheets.
+func FingerprintWorkbook(r io.ReaderAt, size int64) (_ Manifest, err error) {
+	defer panics.Catch(&err)
+	m, _, err := fingerprint(r, size)
+	return m, err
+}
+
+// UpdateWorkbook renders the sheets of the workbook in r/size that differ
+// from old, the Manifest of an earlier version; an empty old renders every
+// sheet.  Sheets the options leave out (Sheets, SkipHiddenSheets) are
+// listed in the Manifest but neither rendered nor reported as changed.
+// Each fragment is scoped by sheetScope.
+func UpdateWorkbook(old Manifest, r io.ReaderAt, size int64, opts RenderOptions) (_ WorkbookUpdate, err error) {
+	defer panics.Catch(&err)
+	m, read, err := fingerprint(r, size)
+	if err != nil {
+		return WorkbookUpdate{}, err
+	}
+	before := make(map[string]string, len(old.Sheets))
+	for _, s := range old.Sheets {
+		before[s.Name] = s.Digest
+	}
+	u := WorkbookUpdate{Manifest: m}
+	selected, scope := opts.Sheets, opts.Scope
+	opts.Sheets = nil
+	for i, s := range m.Sheets {
+		digest, seen := before[s.Name]
+		delete(before, s.Name)
+		if len(selected) > 0 && !containsFold(selected, s.Name) {
+			continue
+		}
+		if seen && digest == s.Digest {
+			u.Unchanged = append(u.Unchanged, s.Name)
+			continue
+		}
+		rs, err := read(i)
+		if err != nil {
+			return WorkbookUpdate{}, err
+		}
+		if rs.Hidden && opts.SkipHiddenSheets {
+			continue
+		}
+		opts.Scope = sheetScope(scope, s.Name)
+		var html strings.Builder
+		if err := RenderWorkbookHTMLTo(&html, WorkbookModel{Sheets: []RenderSheet{rs}}, opts); err != nil {
+			return WorkbookUpdate{}, err
+		}
+		u.Changed = append(u.Changed, SheetFragment{Name: s.Name, Scope: opts.Scope, HTML: html.String()})
+	}
+	for _, s := range old.Sheets {
+		if _, ok := before[s.Name]; ok {
+			u.Removed = append(u.Removed, s.Name)
+		}
+	}
+	return u, nil
+}
+
+// sheetScope returns the Scope of the fragment of the sheet named name:
+// scope, or "sheet" if that is empty, followed by a digest of the name, so
+// that it is a valid id whatever the name and stays the same across
+// updates.
+func sheetScope(scope, name string) string {
+	if scope = cssIdent(scope); scope == "" {
+		scope = "sheet"
+	}
+	sum := sha256.Sum256([]byte(name))
+	return scope + "-" + hex.EncodeToString(sum[:6])
+}
+
+// fingerprint returns the Manifest of r/size and a function parsing its
+// sheet i.
+func fingerprint(r io.ReaderAt, size int64) (Manifest, func(i int) (RenderSheet, error), error) {
+	var m Manifest
+	if IsXLS(r, size) {
+		bk, err := openXLS(r, size)
+		if err != nil {
+			return m, nil, err
+		}
+		file := sha256.New()
+		if _, err := io.Copy(file, io.NewSectionReader(r, 0, size)); err != nil {
+			return m, nil, err
+		}
+		sum := file.Sum(nil)
+		sheets := bk.worksheets()
+		for _, sh := range sheets {
+			h := sha256.New()
+			fmt.Fprintf(h, "%q\n%x", sh.name, sum)
+			m.Sheets = append(m.Sheets, SheetDigest{Name: sh.name, Digest: hex.EncodeToString(h.Sum(nil))})
+		}
+		return m, func(i int) (RenderSheet, error) { return bk.readSheet(sheets[i]), nil }, nil
+	}
+	zr, err := safezip.NewReader(r, size)
+	if err != nil {
+		return m, nil, err
+	}
+	p := newNativeParser(zr)
+	if err := p.open(); err != nil {
+		return m, nil, err
+	}
+	globals := sha256.New()
+	for _, name := range p.globals {
+		data, err := p.readPart(name)
+		if err != nil {
+			return m, nil, err
+		}
+		fmt.Fprintf(globals, "%d\n", len(data))
+		globals.Write(data)
+	}
+	sum := globals.Sum(nil)
+	for _, s := range p.sheets {
+		digest, err := p.sheetDigest(s, sum)
+		if err != nil {
+			return m, nil, err
+		}
+		m.Sheets = append(m.Sheets, SheetDigest{Name: s.name, Digest: digest})
+	}
+	return m, func(i int) (RenderSheet, error) { return p.readSheet(p.sheets[i]) }, nil
+}
+
+// sharedStringRef matches a shared-string cell of a worksheet part,
+// capturing the index of its string as submatch 1.
+var sharedStringRef = regexp.MustCompile(`<(?:\w+:)?c\b[^>]*\bt="s"[^>]*>\s*<(?:\w+:)?v>(\d+)<`)
+
+// sheetDigest returns the digest of worksheet s in a workbook whose
+// styles and theme hash to globals.
+func (p *nativeParser) sheetDigest(s nativeSheet, globals []byte) (string, error) {
+	data, err := p.readPart(s.part)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%q\n%t\n%x\n", s.name, s.hidden, globals)
+	for _, dn := range p.workbook.DefinedNames {
+		if dn.LocalSheetID != nil && *dn.LocalSheetID == s.index {
+			fmt.Fprintf(h, "%q=%q\n", dn.Name, dn.Content)
+		}
+	}
+	// Hash the part with each shared-string index replaced by its string.
+	enc := json.NewEncoder(h)
+	last := 0
+	for _, m := range sharedStringRef.FindAllSubmatchIndex(data, -1) {
+		h.Write(data[last:m[2]])
+		if id, err := strconv.Atoi(string(data[m[2]:m[3]])); err == nil && id < len(p.strings) {
+			enc.Encode(p.strings[id])
+		}
+		last = m[3]
+	}
+	h.Write(data[last:])
+	// Pictures are hashed by their drawing and the parts it refers to,
+	// comments by their parts.
+	_, byType, err := p.rels(s.part)
+	if err != nil {
+		return "", err
+	}
+	for _, typ := range []string{relComments, relThreadedComment} {
+		if name, ok := byType[typ]; ok {
+			part, err := p.readPart(name)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(h, "\n%q %d\n", name, len(part))
+			h.Write(part)
+		}
+	}
+	if drawing, ok := byType[relDrawing]; ok {
+		byID, _, err := p.rels(drawing)
+		if err != nil {
+			return "", err
+		}
+		ids := make([]string, 0, len(byID))
+		for id := range byID {
+			ids = append(ids, id)
+		}
+		slices.Sort(ids)
+		for _, name := range append([]string{drawing}, ids...) {
+			if target, ok := byID[name]; ok {
+				name = target
+			}
+			part, err := p.readPart(name)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(h, "\n%q %d\n", name, len(part))
+			h.Write(part)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// containsFold reports whether names holds name, compared without regard
+// to case.
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
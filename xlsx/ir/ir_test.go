@@ -0,0 +1,36 @@
+package ir
+
+import (
+	"bytes"
+	"go/build"
+	"strings"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	m := WorkbookModel{Sheets: []RenderSheet{{Name: "S", Rows: []RenderRow{{Cells: []*RenderCell{{Ref: "A1", Value: "x", Cell: struct{}{}}, nil}}}}}}
+	var buf bytes.Buffer
+	if err := Encode(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cells := got.Sheets[0].Rows[0].Cells
+	if len(cells) != 2 || cells[0].Value != "x" || cells[0].Cell != nil || cells[1] != nil {
+		t.Errorf("decoded %+v", got)
+	}
+}
+
+func TestDependencies(t *testing.T) {
+	pkg, err := build.ImportDir(".", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, imp := range pkg.Imports {
+		if strings.Contains(strings.Split(imp, "/")[0], ".") && imp != "github.com/aerissecure/convert/diag" {
+			t.Errorf("imports %s", imp)
+		}
+	}
+}
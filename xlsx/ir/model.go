@@ -0,0 +1,279 @@
+// Package ir holds the intermediate representation (IR) of XLSX workbooks
+// that the xlsx package parses into and renders from, with its JSON
+// serialization.  Like the docx IR it depends on nothing but the standard
+// library and the diag package, so consumers of serialized models need not
+// pull in unioffice.  The xlsx package aliases every type.
+package ir
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aerissecure/convert/diag"
+)
+
+// Pixel values are floats to allow fractional widths/heights if desired.
+
+// CellStyle captures the limited set of Excel styles we currently support.
+type CellStyle struct {
+	FontFamily      string  // e.g. "Calibri"
+	FontSizePt      float64 // original size in points
+	FontColor       string  // "RRGGBB"
+	BackgroundColor string  // "RRGGBB"
+	BorderColor     string  // left border colour "RRGGBB", as models before Borders had it
+	Borders         Borders // each side of the border
+	HorizontalAlign string  // left|center|right|justify
+	VerticalAlign   string  // top|middle|bottom
+	WrapText        bool
+	IndentPx        float64 // computed indent in pixels
+}
+
+func (s CellStyle) String() string {
+	return fmt.Sprintf("FontFamily: %s, FontSizePt: %f, FontColor: %s, BackgroundColor: %s, BorderColor: %s, Borders: %s, HorizontalAlign: %s, VerticalAlign: %s, WrapText: %t, IndentPx: %f", s.FontFamily, s.FontSizePt, s.FontColor, s.BackgroundColor, s.BorderColor, s.Borders, s.HorizontalAlign, s.VerticalAlign, s.WrapText, s.IndentPx)
+}
+
+// Border is one side of a cell's border.  Excel's line styles are reduced
+// to thin (also hair), medium, thick, dashed (all dashed and dash-dotted
+// lines), dotted and double.
+type Border struct {
+	Style string // thin|medium|thick|dashed|dotted|double, "" for no line
+	Color string // "RRGGBB", "" for automatic (black)
+}
+
+// Borders are the sides of a cell's border.
+type Borders struct {
+	Top, Right, Bottom, Left Border
+}
+
+// IsZero reports whether no side has a line.
+func (b Borders) IsZero() bool {
+	return b.Top.Style == "" && b.Right.Style == "" && b.Bottom.Style == "" && b.Left.Style == ""
+}
+
+func (b Borders) String() string {
+	return fmt.Sprintf("Top: %v, Right: %v, Bottom: %v, Left: %v", b.Top, b.Right, b.Bottom, b.Left)
+}
+
+// RenderRun represents a rich-text run within a cell, holding its text and styling.
+type RenderRun struct {
+	Text          string
+	FontFamily    string  // optional override
+	FontSizePt    float64 // optional override
+	FontColor     string  // "RRGGBB"
+	Bold          bool
+	Italic        bool
+	Underline     bool
+	Strike        bool
+	VerticalAlign string // "superscript"|"subscript"|"baseline"
+}
+
+func (r RenderRun) String() string {
+	return fmt.Sprintf("Text: %s, FontFamily: %s, FontSizePt: %f, FontColor: %s, Bold: %t, Italic: %t, Underline: %t, Strike: %t, VerticalAlign: %s", r.Text, r.FontFamily, r.FontSizePt, r.FontColor, r.Bold, r.Italic, r.Underline, r.Strike, r.VerticalAlign)
+}
+
+// RenderCell is the IR for a single cell (or merged master).
+type RenderCell struct {
+	Cell         any         `json:"-"` // underlying unioffice spreadsheet.Cell – nil for models that were not parsed by unioffice
+	Ref          string      // e.g. "A1"
+	Value        string      // already formatted value
+	Raw          string      // value as stored, before formatting: the number as written, the text, TRUE/FALSE or the error
+	NumberFormat string      // number format code that produced Value, "" for General
+	Runs         []RenderRun // optional rich-text runs if the cell contains multiple formatted runs
+	ColSpan      int         // 1 if not merged
+	RowSpan      int         // 1 if not merged
+	Style        CellStyle   // resolved style
+	Unsafe       string      // DDE or external-command formula (or text that would act as one), "" for most cells
+	Comments     []CellComment
+	Icon         *CellIcon // conditional formatting icon shown before the value, nil for most cells
+}
+
+// CellIcon is the icon a conditional formatting icon set gives a cell.
+type CellIcon struct {
+	Set       string // icon set, e.g. "3TrafficLights1"
+	Index     int    // icon of the set, 0 for the lowest values
+	HideValue bool   // the icon is shown instead of the value
+}
+
+func (i CellIcon) String() string {
+	return fmt.Sprintf("Set: %s, Index: %d, HideValue: %t", i.Set, i.Index, i.HideValue)
+}
+
+// iconSets lists the icons of each icon set from the lowest values up, as
+// shape and colour.
+var iconSets = map[string][]struct{ shape, color string }{
+	"3Arrows":         {{"arrow-down", red}, {"arrow-right", yellow}, {"arrow-up", green}},
+	"3ArrowsGray":     {{"arrow-down", gray}, {"arrow-right", gray}, {"arrow-up", gray}},
+	"3Flags":          {{"flag", red}, {"flag", yellow}, {"flag", green}},
+	"3TrafficLights1": {{"circle", red}, {"circle", yellow}, {"circle", green}},
+	"3TrafficLights2": {{"circle", red}, {"circle", yellow}, {"circle", green}},
+	"3Signs":          {{"diamond", red}, {"triangle", yellow}, {"circle", green}},
+	"3Symbols":        {{"cross", red}, {"exclamation", yellow}, {"check", green}},
+	"3Symbols2":       {{"cross", red}, {"exclamation", yellow}, {"check", green}},
+	"4Arrows":         {{"arrow-down", red}, {"arrow-down-right", yellow}, {"arrow-up-right", yellow}, {"arrow-up", green}},
+	"4ArrowsGray":     {{"arrow-down", gray}, {"arrow-down-right", gray}, {"arrow-up-right", gray}, {"arrow-up", gray}},
+	"4RedToBlack":     {{"circle", black}, {"circle", gray}, {"circle", pink}, {"circle", red}},
+	"4Rating":         {{"bars-1", blue}, {"bars-2", blue}, {"bars-3", blue}, {"bars-4", blue}},
+	"4TrafficLights":  {{"circle", black}, {"circle", red}, {"circle", yellow}, {"circle", green}},
+	"5Arrows":         {{"arrow-down", red}, {"arrow-down-right", yellow}, {"arrow-right", yellow}, {"arrow-up-right", yellow}, {"arrow-up", green}},
+	"5ArrowsGray":     {{"arrow-down", gray}, {"arrow-down-right", gray}, {"arrow-right", gray}, {"arrow-up-right", gray}, {"arrow-up", gray}},
+	"5Rating":         {{"bars-0", blue}, {"bars-1", blue}, {"bars-2", blue}, {"bars-3", blue}, {"bars-4", blue}},
+	"5Quarters":       {{"quarters-0", gray}, {"quarters-1", gray}, {"quarters-2", gray}, {"quarters-3", gray}, {"quarters-4", gray}},
+}
+
+// Icon colours, "RRGGBB".
+const (
+	red    = "C00000"
+	yellow = "FFC000"
+	green  = "00B050"
+	gray   = "808080"
+	black  = "262626"
+	pink   = "FF9999"
+	blue   = "4472C4"
+)
+
+// IconSetSize returns the number of icons of icon set name, 0 if the set
+// is unknown.
+func IconSetSize(name string) int {
+	return len(iconSets[name])
+}
+
+// Shape returns the shape and colour "RRGGBB" of the icon, for renderers
+// that draw it.  The shapes are arrow-up, arrow-up-right, arrow-right,
+// arrow-down-right, arrow-down, circle, flag, diamond, triangle, cross,
+// exclamation, check, bars-0 to bars-4 (the bars of a rating that are
+// filled) and quarters-0 to quarters-4 (the quarters of a circle that are
+// filled).  Both are "" for an unknown set or index.
+func (i CellIcon) Shape() (shape, color string) {
+	set := iconSets[i.Set]
+	if i.Index < 0 || i.Index >= len(set) {
+		return "", ""
+	}
+	return set[i.Index].shape, set[i.Index].color
+}
+
+// iconGlyphs are the characters standing for the shapes.
+var iconGlyphs = map[string]string{
+	"arrow-up": "↑", "arrow-up-right": "↗", "arrow-right": "→", "arrow-down-right": "↘", "arrow-down": "↓",
+	"circle": "●", "flag": "⚑", "diamond": "◆", "triangle": "▲", "cross": "✖", "exclamation": "!", "check": "✔",
+	"bars-0": "▁", "bars-1": "▂", "bars-2": "▄", "bars-3": "▆", "bars-4": "█",
+	"quarters-0": "○", "quarters-1": "◔", "quarters-2": "◑", "quarters-3": "◕", "quarters-4": "●",
+}
+
+// Glyph returns a character standing for the icon, for renderers of
+// text, or "" for an unknown set or index.
+func (i CellIcon) Glyph() string {
+	shape, _ := i.Shape()
+	return iconGlyphs[shape]
+}
+
+// CellComment is a note or a threaded comment on a cell.  The replies of a
+// thread follow the comment they answer.
+type CellComment struct {
+	Author string
+	Text   string
+	Date   time.Time // zero for notes, which are not dated
+	Reply  bool
+}
+
+func (c CellComment) String() string {
+	return fmt.Sprintf("Author: %q, Text: %q, Date: %s, Reply: %t", c.Author, c.Text, c.Date, c.Reply)
+}
+
+func (c RenderCell) String() string {
+	return fmt.Sprintf("Ref: %s, Value: %s, Runs: %d, ColSpan: %d, RowSpan: %d, Style: %s", c.Ref, c.Value, len(c.Runs), c.ColSpan, c.RowSpan, c.Style.String())
+}
+
+// RenderRow represents one logical row in a sheet.
+type RenderRow struct {
+	HeightPx float64 // resolved height in px
+	Hidden   bool
+	Cells    []*RenderCell // length == ColCount of parent sheet; may contain nil for blank cells
+}
+
+func (r RenderRow) String() string {
+	return fmt.Sprintf("HeightPx: %f, Hidden: %t, Cells: %d", r.HeightPx, r.Hidden, len(r.Cells))
+}
+
+// RenderSheet is the intermediate representation of a worksheet.
+type RenderSheet struct {
+	Name      string
+	Hidden    bool        // hidden or "very hidden" in the workbook
+	ColWidths []float64   // per column pixel widths, len == ColCount
+	ColHidden []bool      // true if column hidden
+	Rows      []RenderRow // in order
+	PageSetup PageSetup   // print layout
+	TabColor  string      // "RRGGBB" colour of the sheet's tab, if any
+	Images    []SheetImage
+}
+
+// SheetImage is a picture drawn over a worksheet, placed by the cell its
+// top left corner is anchored to.
+type SheetImage struct {
+	PartName    string // package part holding the picture, e.g. "xl/media/image1.png"
+	ContentType string // MIME type of Data, e.g. "image/png"
+	Data        []byte
+	Name        string // name of the drawing object, e.g. "Picture 1"
+	AltText     string // description, if any
+	Row, Col    int    // 0-based anchor cell
+	OffsetXPx   float64
+	OffsetYPx   float64 // from the anchor cell's top left corner
+	WidthPx     float64
+	HeightPx    float64
+}
+
+func (i SheetImage) String() string {
+	return fmt.Sprintf("PartName: %s, Name: %s, Row: %d, Col: %d, Offset: %fx%f, Size: %fx%f", i.PartName, i.Name, i.Row, i.Col, i.OffsetXPx, i.OffsetYPx, i.WidthPx, i.HeightPx)
+}
+
+func (s RenderSheet) String() string {
+	return fmt.Sprintf("Name: %s, Hidden: %t, ColWidths: %v, ColHidden: %v, Rows: %d", s.Name, s.Hidden, s.ColWidths, s.ColHidden, len(s.Rows))
+}
+
+// PageSetup is the print layout of a worksheet (pageSetup, pageMargins,
+// printOptions and the Print_Area and Print_Titles defined names).
+type PageSetup struct {
+	PageWidthPt    float64 // paper size in the page's orientation
+	PageHeightPt   float64
+	MarginTopPt    float64
+	MarginRightPt  float64
+	MarginBottomPt float64
+	MarginLeftPt   float64
+	Landscape      bool
+	Scale          float64 // print scale in percent
+	FitToPage      bool    // scale to FitToWidth x FitToHeight pages instead of Scale
+	FitToWidth     int     // pages across, 0 for no limit
+	FitToHeight    int     // pages down, 0 for no limit
+	Gridlines      bool    // print cell gridlines
+	CenterH        bool    // center the printed area horizontally
+	OverThenDown   bool    // page order; false prints down, then over
+
+	PrintArea *CellRange  // nil prints the used range
+	TitleRows *IndexRange // rows repeated at the top of every page
+	TitleCols *IndexRange // columns repeated at the left of every page
+}
+
+func (s PageSetup) String() string {
+	return fmt.Sprintf("PageWidthPt: %f, PageHeightPt: %f, Margins: %f %f %f %f, Landscape: %t, Scale: %f, FitToPage: %t (%dx%d), PrintArea: %v, TitleRows: %v, TitleCols: %v",
+		s.PageWidthPt, s.PageHeightPt, s.MarginTopPt, s.MarginRightPt, s.MarginBottomPt, s.MarginLeftPt, s.Landscape,
+		s.Scale, s.FitToPage, s.FitToWidth, s.FitToHeight, s.PrintArea, s.TitleRows, s.TitleCols)
+}
+
+// CellRange is a rectangular block of cells by zero-based row and column
+// index, inclusive.
+type CellRange struct {
+	FirstRow, FirstCol int
+	LastRow, LastCol   int
+}
+
+// IndexRange is a run of zero-based rows or columns, inclusive.
+type IndexRange struct {
+	First, Last int
+}
+
+// WorkbookModel is the top-level IR containing all sheets.
+type WorkbookModel struct {
+	Sheets []RenderSheet
+	// Warnings lists the problems the parser worked around, in the order
+	// found.
+	Warnings []diag.Warning
+}
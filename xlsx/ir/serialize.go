@@ -0,0 +1,74 @@
+package ir
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// -----------------------------------------------------------------------------
+// Model serialization
+// -----------------------------------------------------------------------------
+//
+// A WorkbookModel is encoded as a JSON envelope holding the schema version
+// and the model, so a workbook can be parsed in one process (e.g. a
+// sandboxed worker) and rendered in another.  Keys are the Go field names;
+// blank cells are null.  RenderCell.Cell, the unioffice handle, is not
+// encoded.
+//
+// A change to the model that alters the meaning of existing fields bumps
+// Version and registers a migration from the previous version in
+// workbookMigrations.  Adding fields does not.
+
+// Version is the schema version written by Encode.
+const Version = 1
+
+// ErrVersion is returned by Decode for an envelope of a schema version
+// this package cannot read.
+var ErrVersion = errors.New("xlsx: unsupported model version")
+
+// workbookMigrations[v] upgrades the encoded model of version v to v+1.
+var workbookMigrations = map[int]func(json.RawMessage) (json.RawMessage, error){}
+
+type workbookEnvelope struct {
+	Version  int             `json:"version"`
+	Workbook json.RawMessage `json:"workbook"`
+}
+
+// Encode writes m to w as versioned JSON.
+func Encode(w io.Writer, m WorkbookModel) error {
+	wb, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(workbookEnvelope{Version: Version, Workbook: wb})
+}
+
+// Decode reads a model written by Encode, migrating it from an earlier
+// schema version if needed.
+func Decode(r io.Reader) (WorkbookModel, error) {
+	var env workbookEnvelope
+	if err := json.NewDecoder(r).Decode(&env); err != nil {
+		return WorkbookModel{}, err
+	}
+	if env.Version < 1 || env.Version > Version {
+		return WorkbookModel{}, fmt.Errorf("%w %d", ErrVersion, env.Version)
+	}
+	data := env.Workbook
+	for v := env.Version; v < Version; v++ {
+		migrate, ok := workbookMigrations[v]
+		if !ok {
+			return WorkbookModel{}, fmt.Errorf("%w %d", ErrVersion, env.Version)
+		}
+		var err error
+		if data, err = migrate(data); err != nil {
+			return WorkbookModel{}, fmt.Errorf("xlsx: migrating model from version %d: %w", v, err)
+		}
+	}
+	var m WorkbookModel
+	if err := json.Unmarshal(data, &m); err != nil {
+		return WorkbookModel{}, err
+	}
+	return m, nil
+}
@@ -0,0 +1,892 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aerissecure/convert/diag"
+	"github.com/aerissecure/convert/internal/panics"
+	"github.com/aerissecure/convert/internal/safezip"
+	"github.com/aerissecure/convert/xlsx/numfmt"
+)
+
+// -----------------------------------------------------------------------------
+// Parser backends
+// -----------------------------------------------------------------------------
+
+// Backend reads an XLSX package into the IR.  Legacy XLS input is read with
+// ParseXLSWorkbookModel by every backend.
+//
+// Unioffice, which reads workbooks through unioffice's spreadsheet
+// package, is the default.  Native reads the package with archive/zip and
+// encoding/xml, for deployments that cannot ship unioffice.  Built with the
+// nounioffice tag, the package leaves out Unioffice, WriteWorkbook and the
+// unioffice style helpers, and parses with Native; it then does not link
+// unioffice at all.  Word-processing documents have no native backend:
+// package docx, and with it package convert, always link unioffice.
+//
+// The built-in backends fail with a *diag.PanicError for input that makes
+// them panic.
+type Backend interface {
+	ParseWorkbook(r io.ReaderAt, size int64) (WorkbookModel, error)
+}
+
+// Native reads the package with archive/zip and encoding/xml.  The model
+// matches that of Unioffice except that table styles are not applied,
+// RenderCell.Cell is always nil and rich inline strings have their text as
+// Value (unioffice leaves it empty).
+var Native Backend = nativeBackend{}
+
+// ParseWorkbookFile is ParseWorkbookModel for the file at path.
+func ParseWorkbookFile(path string) (WorkbookModel, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return WorkbookModel{}, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return WorkbookModel{}, err
+	}
+	return ParseWorkbookModel(f, fi.Size())
+}
+
+// ParseWorkbookModel reads an XLSX from r/size with the default backend
+// and returns the intermediate representation.  Legacy XLS workbooks are
+// detected and read with ParseXLSWorkbookModel.
+func ParseWorkbookModel(r io.ReaderAt, size int64) (WorkbookModel, error) {
+	return defaultBackend.ParseWorkbook(r, size)
+}
+
+type nativeBackend struct{ nf numberFormat }
+
+func (b nativeBackend) String() string {
+	return "Native" + b.nf.String()
+}
+
+func (b nativeBackend) ParseWorkbook(r io.ReaderAt, size int64) (m WorkbookModel, err error) {
+	defer panics.Catch(&err)
+	if IsXLS(r, size) {
+		return parseXLS(r, size, b.nf)
+	}
+	zr, err := safezip.NewReader(r, size)
+	if err != nil {
+		return WorkbookModel{}, err
+	}
+	p := newNativeParser(zr)
+	p.nf = b.nf
+	return p.parse()
+}
+
+func (b nativeBackend) withNumberFormat(set func(*numberFormat)) Backend {
+	set(&b.nf)
+	return b
+}
+
+// -----------------------------------------------------------------------------
+// Native package reader
+// -----------------------------------------------------------------------------
+
+// Relationship types, by their final path segment.
+const (
+	relOfficeDocument = "officeDocument"
+	relSharedStrings  = "sharedStrings"
+	relStyles         = "styles"
+	relTheme          = "theme"
+)
+
+// nativeParser holds the workbook-level parts while sheets are read.
+type nativeParser struct {
+	files map[string]*zip.File // by lower-case name
+
+	workbook xmlWorkbook
+	sheets   []nativeSheet     // the worksheets, set by open
+	parts    map[string]string // targets of the workbook's relationships by type
+	persons  map[string]string // display names of threaded comment authors by ID, once read
+
+	strings  []xmlRst
+	styles   xmlStyleSheet
+	numFmts  map[int]string
+	theme    []string // scheme colours in theme index order (dk1, lt1, dk2, lt2, accent1-6, hlink, folHlink)
+	dxfs     []dxfStyle
+	date1904 bool
+	nf       numberFormat
+	globals  []string // the styles and theme parts, which every sheet uses
+
+	// strs interns cell values and run text, and sharedRuns holds the runs
+	// of each shared string once read, for the cells using it to copy.
+	strs       interner
+	sharedRuns map[int][]RenderRun
+
+	warnings []diag.Warning
+}
+
+// nativeSheet is a worksheet of the workbook.
+type nativeSheet struct {
+	name   string
+	part   string
+	index  int // in xmlWorkbook.Sheets, which localSheetId refers to
+	hidden bool
+}
+
+func newNativeParser(zr *zip.Reader) *nativeParser {
+	p := &nativeParser{files: make(map[string]*zip.File, len(zr.File)), strs: make(interner), sharedRuns: make(map[int][]RenderRun)}
+	for _, f := range zr.File {
+		p.files[strings.ToLower(f.Name)] = f
+	}
+	return p
+}
+
+type xmlRelationships struct {
+	Relationship []struct {
+		ID         string `xml:"Id,attr"`
+		Type       string `xml:"Type,attr"`
+		Target     string `xml:"Target,attr"`
+		TargetMode string `xml:"TargetMode,attr"`
+	}
+}
+
+type xmlWorkbook struct {
+	WorkbookPr struct {
+		Date1904 string `xml:"date1904,attr"`
+	} `xml:"workbookPr"`
+	Sheets []struct {
+		Name  string `xml:"name,attr"`
+		State string `xml:"state,attr"`
+		RID   string `xml:"id,attr"` // r:id
+	} `xml:"sheets>sheet"`
+	DefinedNames []struct {
+		Name         string `xml:"name,attr"`
+		LocalSheetID *int   `xml:"localSheetId,attr"`
+		Content      string `xml:",chardata"`
+	} `xml:"definedNames>definedName"`
+}
+
+type xmlVal struct {
+	Val string `xml:"val,attr"`
+}
+
+// xmlColor is a colour; like ParseWorkbookModel, the reader ignores tints
+// and indexed colours.
+type xmlColor struct {
+	RGB   string `xml:"rgb,attr"`
+	Theme *int   `xml:"theme,attr"`
+}
+
+// xmlRst is a shared or inline string.
+type xmlRst struct {
+	T *string `xml:"t"`
+	R []struct {
+		RPr *struct {
+			RFont     *xmlVal   `xml:"rFont"`
+			Sz        *xmlVal   `xml:"sz"`
+			Color     *xmlColor `xml:"color"`
+			B         *xmlVal   `xml:"b"`
+			I         *xmlVal   `xml:"i"`
+			Strike    *xmlVal   `xml:"strike"`
+			U         *xmlVal   `xml:"u"`
+			VertAlign *xmlVal   `xml:"vertAlign"`
+		} `xml:"rPr"`
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+// text returns the plain text of the string.
+func (s xmlRst) text() string {
+	if s.T != nil {
+		return *s.T
+	}
+	var b strings.Builder
+	for _, r := range s.R {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+type xmlStyleSheet struct {
+	NumFmts []struct {
+		ID   int    `xml:"numFmtId,attr"`
+		Code string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+	Fonts []struct {
+		Name  *xmlVal   `xml:"name"`
+		Sz    *xmlVal   `xml:"sz"`
+		Color *xmlColor `xml:"color"`
+	} `xml:"fonts>font"`
+	Fills []struct {
+		FgColor *xmlColor `xml:"patternFill>fgColor"`
+	} `xml:"fills>fill"`
+	Borders []xmlBorder `xml:"borders>border"`
+	CellXfs []struct {
+		NumFmtID  int  `xml:"numFmtId,attr"`
+		FontID    *int `xml:"fontId,attr"`
+		FillID    *int `xml:"fillId,attr"`
+		BorderID  *int `xml:"borderId,attr"`
+		Alignment *struct {
+			Horizontal string `xml:"horizontal,attr"`
+			Vertical   string `xml:"vertical,attr"`
+			WrapText   string `xml:"wrapText,attr"`
+			Indent     *int   `xml:"indent,attr"`
+		} `xml:"alignment"`
+	} `xml:"cellXfs>xf"`
+	Dxfs []xmlDxf `xml:"dxfs>dxf"`
+}
+
+// xmlBorder is the border of a cell format or differential format.
+type xmlBorder struct {
+	Left   *xmlBorderPr `xml:"left"`
+	Right  *xmlBorderPr `xml:"right"`
+	Top    *xmlBorderPr `xml:"top"`
+	Bottom *xmlBorderPr `xml:"bottom"`
+}
+
+// xmlBorderPr is a side of a border.
+type xmlBorderPr struct {
+	Style string    `xml:"style,attr"`
+	Color *xmlColor `xml:"color"`
+}
+
+type xmlTheme struct {
+	ClrScheme struct {
+		Colors []struct {
+			SrgbClr *xmlVal `xml:"srgbClr"`
+			SysClr  *struct {
+				LastClr string `xml:"lastClr,attr"`
+			} `xml:"sysClr"`
+		} `xml:",any"`
+	} `xml:"themeElements>clrScheme"`
+}
+
+type xmlWorksheet struct {
+	PageSetUpPr struct {
+		FitToPage string `xml:"fitToPage,attr"`
+	} `xml:"sheetPr>pageSetUpPr"`
+	TabColor *xmlColor `xml:"sheetPr>tabColor"`
+	Cols     []struct {
+		Min         int     `xml:"min,attr"`
+		Max         int     `xml:"max,attr"`
+		Width       float64 `xml:"width,attr"`
+		CustomWidth string  `xml:"customWidth,attr"`
+		Hidden      string  `xml:"hidden,attr"`
+	} `xml:"cols>col"`
+	Rows []struct {
+		R            int     `xml:"r,attr"`
+		Ht           float64 `xml:"ht,attr"`
+		CustomHeight string  `xml:"customHeight,attr"`
+		Hidden       string  `xml:"hidden,attr"`
+		Cells        []struct {
+			R  string  `xml:"r,attr"`
+			S  *int    `xml:"s,attr"`
+			T  string  `xml:"t,attr"`
+			F  *string `xml:"f"`
+			V  *string `xml:"v"`
+			Is *xmlRst `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+	MergeCells []struct {
+		Ref string `xml:"ref,attr"`
+	} `xml:"mergeCells>mergeCell"`
+	ConditionalFormatting []xmlConditionalFormatting `xml:"conditionalFormatting"`
+	PrintOptions          *struct {
+		GridLines          string `xml:"gridLines,attr"`
+		HorizontalCentered string `xml:"horizontalCentered,attr"`
+	} `xml:"printOptions"`
+	PageMargins *struct {
+		Left   float64 `xml:"left,attr"`
+		Right  float64 `xml:"right,attr"`
+		Top    float64 `xml:"top,attr"`
+		Bottom float64 `xml:"bottom,attr"`
+	} `xml:"pageMargins"`
+	PageSetup *struct {
+		PaperSize   *uint32 `xml:"paperSize,attr"`
+		Scale       *int    `xml:"scale,attr"`
+		FitToWidth  *int    `xml:"fitToWidth,attr"`
+		FitToHeight *int    `xml:"fitToHeight,attr"`
+		PageOrder   string  `xml:"pageOrder,attr"`
+		Orientation string  `xml:"orientation,attr"`
+	} `xml:"pageSetup"`
+}
+
+// xmlBool reports whether an xsd:boolean attribute is true.
+func xmlBool(s string) bool {
+	return s == "1" || s == "true"
+}
+
+// PartError is returned by the Native backend for a package part, and by
+// ParseXLSWorkbookModel for a stream, that cannot be read or decoded.
+type PartError struct {
+	Part string // e.g. "xl/worksheets/sheet1.xml"
+	Err  error
+}
+
+func (e *PartError) Error() string { return "xlsx: " + e.Part + ": " + e.Err.Error() }
+
+func (e *PartError) Unwrap() error { return e.Err }
+
+// readXML decodes the part named name into v.  A missing part leaves v
+// unchanged and is not an error.
+func (p *nativeParser) readXML(name string, v any) error {
+	f, ok := p.files[strings.ToLower(name)]
+	if !ok {
+		return nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return &PartError{Part: name, Err: err}
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(rc).Decode(v); err != nil {
+		return &PartError{Part: name, Err: err}
+	}
+	return nil
+}
+
+// readPart returns the bytes of the part named name, or nil if there is no
+// such part.
+func (p *nativeParser) readPart(name string) ([]byte, error) {
+	f, ok := p.files[strings.ToLower(name)]
+	if !ok {
+		return nil, nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, &PartError{Part: name, Err: err}
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, &PartError{Part: name, Err: err}
+	}
+	return data, nil
+}
+
+// rels returns the internal targets of the relationships of part name ("" for
+// the package) by ID and by type, keeping the first of each type.
+func (p *nativeParser) rels(name string) (map[string]string, map[string]string, error) {
+	var x xmlRelationships
+	relsName := "_rels/.rels" // of the package
+	if name != "" {
+		relsName = path.Join(path.Dir(name), "_rels", path.Base(name)+".rels")
+	}
+	if err := p.readXML(relsName, &x); err != nil {
+		return nil, nil, err
+	}
+	byID := make(map[string]string)
+	byType := make(map[string]string)
+	for _, r := range x.Relationship {
+		if r.TargetMode == "External" {
+			continue
+		}
+		target := r.Target
+		if strings.HasPrefix(target, "/") {
+			target = strings.TrimPrefix(target, "/")
+		} else {
+			target = path.Join(path.Dir(name), target)
+		}
+		byID[r.ID] = target
+		typ := r.Type[strings.LastIndex(r.Type, "/")+1:]
+		if _, ok := byType[typ]; !ok {
+			byType[typ] = target
+		}
+	}
+	return byID, byType, nil
+}
+
+// parse reads the workbook.
+func (p *nativeParser) parse() (WorkbookModel, error) {
+	if err := p.open(); err != nil {
+		return WorkbookModel{}, err
+	}
+	var model WorkbookModel
+	for _, s := range p.sheets {
+		rs, err := p.readSheet(s)
+		if err != nil {
+			return WorkbookModel{}, err
+		}
+		model.Sheets = append(model.Sheets, rs)
+	}
+	model.Warnings = p.warnings
+	return model, nil
+}
+
+// open reads the workbook-level parts and lists the worksheets.
+func (p *nativeParser) open() error {
+	if err := p.listSheets(); err != nil {
+		return err
+	}
+	byType := p.parts
+	p.date1904 = xmlBool(p.workbook.WorkbookPr.Date1904)
+
+	var sst struct {
+		SI []xmlRst `xml:"si"`
+	}
+	if err := p.readXML(byType[relSharedStrings], &sst); err != nil {
+		return err
+	}
+	p.strings = sst.SI
+	p.globals = []string{byType[relStyles], byType[relTheme]}
+	if err := p.readXML(byType[relStyles], &p.styles); err != nil {
+		return err
+	}
+	p.numFmts = make(map[int]string, len(p.styles.NumFmts))
+	for _, nf := range p.styles.NumFmts {
+		p.numFmts[nf.ID] = nf.Code
+	}
+	var theme xmlTheme
+	if err := p.readXML(byType[relTheme], &theme); err != nil {
+		return err
+	}
+	for _, c := range theme.ClrScheme.Colors {
+		switch {
+		case c.SrgbClr != nil:
+			p.theme = append(p.theme, c.SrgbClr.Val)
+		case c.SysClr != nil:
+			p.theme = append(p.theme, c.SysClr.LastClr)
+		default:
+			p.theme = append(p.theme, "")
+		}
+	}
+	p.dxfs = p.readDxfs()
+	return nil
+}
+
+// listSheets reads the workbook part and its relationships and lists its
+// worksheets.
+func (p *nativeParser) listSheets() error {
+	_, root, err := p.rels("")
+	if err != nil {
+		return err
+	}
+	wbName, ok := root[relOfficeDocument]
+	if !ok {
+		return errors.New("xlsx: package has no workbook part")
+	}
+	if err := p.readXML(wbName, &p.workbook); err != nil {
+		return err
+	}
+	byID, byType, err := p.rels(wbName)
+	if err != nil {
+		return err
+	}
+	p.parts = byType
+	for idx, s := range p.workbook.Sheets {
+		part, ok := byID[s.RID]
+		if !ok || !strings.Contains(strings.ToLower(part), "worksheets/") {
+			continue // chart and dialog sheets
+		}
+		p.sheets = append(p.sheets, nativeSheet{name: s.Name, part: part, index: idx, hidden: s.State == "hidden" || s.State == "veryHidden"})
+	}
+	return nil
+}
+
+// readSheet reads worksheet s.
+func (p *nativeParser) readSheet(s nativeSheet) (RenderSheet, error) {
+	var ws xmlWorksheet
+	if err := p.readXML(s.part, &ws); err != nil {
+		return RenderSheet{}, err
+	}
+	rs := p.sheet(s.name, &ws)
+	applyConditionalFormats(&rs, p.conditionalFormats(&ws), p.dxfs, func(code diag.Code, ref, msg string) {
+		p.warnings = append(p.warnings, diag.Warning{Code: code, Location: diag.Location{Sheet: s.name, Cell: ref}, Message: msg})
+	})
+	rs.Name = s.name
+	rs.Hidden = s.hidden
+	rs.PageSetup = nativePageSetup(&ws)
+	if c := ws.TabColor; c != nil {
+		if c.RGB != "" {
+			rs.TabColor = normalizeColor(c.RGB)
+		} else if c.Theme != nil {
+			rs.TabColor = p.themeColor(*c.Theme)
+		}
+	}
+	for _, dn := range p.workbook.DefinedNames {
+		if dn.LocalSheetID != nil && *dn.LocalSheetID == s.index {
+			applyDefinedName(&rs.PageSetup, dn.Name, dn.Content)
+		}
+	}
+	if err := p.sheetObjects(s.part, &rs); err != nil {
+		return RenderSheet{}, err
+	}
+	return rs, nil
+}
+
+// sheet converts a worksheet, following ParseWorkbookModel: the grid spans
+// the cells with a non-empty value and the merged ranges, and cells
+// covered by a merge are nil.
+func (p *nativeParser) sheet(name string, ws *xmlWorksheet) RenderSheet {
+	warn := func(code diag.Code, ref, msg string) {
+		p.warnings = append(p.warnings, diag.Warning{Code: code, Location: diag.Location{Sheet: name, Cell: ref}, Message: msg})
+	}
+	type cellPos struct {
+		row, col int
+		value    cellValue
+	}
+	lastRow, lastCol := -1, -1
+	// Resolve the positions of cells and rows without an r attribute.
+	positions := make([][]cellPos, len(ws.Rows))
+	rowNums := make([]int, len(ws.Rows))
+	rowNum := 0
+	for i, row := range ws.Rows {
+		rowNum++
+		if row.R > 0 {
+			rowNum = row.R
+		}
+		rowNums[i] = rowNum
+		col := -1
+		for _, c := range row.Cells {
+			col++
+			if c.R != "" {
+				if ref, err := parseCellRef(c.R); err == nil {
+					col = ref.col
+				} else {
+					warn(diag.BadReference, c.R, "cell: "+err.Error())
+				}
+			}
+			v := p.value(c.T, c.V, c.Is, c.S)
+			v.text = p.strs.intern(v.text)
+			positions[i] = append(positions[i], cellPos{rowNum - 1, col, v})
+			if v.text != "" {
+				lastRow, lastCol = max(lastRow, rowNum-1), max(lastCol, col)
+			}
+		}
+	}
+
+	mergeSpan := make(map[[2]int][2]int) // master -> rowSpan, colSpan
+	covered := make(map[[2]int]bool)
+	for _, mc := range ws.MergeCells {
+		from, to, err := parseRangeRef(mc.Ref)
+		if err != nil {
+			warn(diag.BadReference, mc.Ref, "merged range: "+err.Error())
+			continue
+		}
+		fromRow, fromCol := from.row, from.col
+		toRow, toCol := to.row, to.col
+		lastRow, lastCol = max(lastRow, toRow), max(lastCol, toCol)
+		mergeSpan[[2]int{fromRow, fromCol}] = [2]int{toRow - fromRow + 1, toCol - fromCol + 1}
+		for r := fromRow; r <= toRow; r++ {
+			for c := fromCol; c <= toCol; c++ {
+				if r != fromRow || c != fromCol {
+					covered[[2]int{r, c}] = true
+				}
+			}
+		}
+	}
+	lastRow, lastCol = max(lastRow, 0), max(lastCol, 0)
+	maxCols := lastCol + 1
+
+	rs := RenderSheet{ColWidths: make([]float64, maxCols), ColHidden: make([]bool, maxCols)}
+	for c := range maxCols {
+		rs.ColWidths[c] = defaultColChars * pxPerChar // default approximation
+		for _, col := range ws.Cols {
+			if c+1 >= col.Min && c+1 <= col.Max {
+				if xmlBool(col.CustomWidth) {
+					rs.ColWidths[c] = col.Width * pxPerChar
+				}
+				rs.ColHidden[c] = xmlBool(col.Hidden)
+				break
+			}
+		}
+	}
+
+	rs.Rows = make([]RenderRow, lastRow+1)
+	for i, row := range ws.Rows {
+		rowIdx := rowNums[i] - 1
+		if rowIdx > lastRow {
+			continue
+		}
+		rr := &rs.Rows[rowIdx]
+		rr.Cells = make([]*RenderCell, maxCols)
+		rr.Hidden = xmlBool(row.Hidden)
+		rr.HeightPx = defaultRowPt * pxPerPt
+		if xmlBool(row.CustomHeight) {
+			rr.HeightPx = row.Ht * pxPerPt
+		}
+		for j, c := range row.Cells {
+			pos := positions[i][j]
+			if pos.col > lastCol || covered[[2]int{pos.row, pos.col}] {
+				continue
+			}
+			rc := &RenderCell{
+				Ref:     cellName(rowIdx, pos.col),
+				Value:   pos.value.text,
+				ColSpan: 1,
+				RowSpan: 1,
+			}
+			if c.S != nil {
+				rc.Style = p.style(*c.S)
+			}
+			shared := -1
+			if c.T == "s" && c.V != nil {
+				if id, err := strconv.Atoi(*c.V); err == nil && id >= 0 && id < len(p.strings) {
+					shared = id
+				}
+			}
+			switch {
+			case shared >= 0:
+				runs, ok := p.sharedRuns[shared]
+				if !ok {
+					runs = p.runs(&p.strings[shared])
+					p.sharedRuns[shared] = runs
+				}
+				// Each cell gets its own slice, as visitors edit runs in
+				// place; the text is shared.
+				rc.Runs = slices.Clone(runs)
+			case c.Is != nil:
+				rc.Runs = p.runs(c.Is)
+			}
+			pos.value.set(rc)
+			formula := ""
+			if c.F != nil {
+				formula = *c.F
+			}
+			if rc.Unsafe = unsafeCell(formula, rc.Value); rc.Unsafe != "" {
+				warn(diag.DangerousFormula, rc.Ref, "dangerous formula: "+rc.Unsafe)
+			}
+			if span, ok := mergeSpan[[2]int{pos.row, pos.col}]; ok {
+				rc.RowSpan, rc.ColSpan = span[0], span[1]
+			}
+			rr.Cells[pos.col] = rc
+		}
+	}
+	return rs
+}
+
+// value returns the value of a cell of type t, formatted with its number
+// format.
+func (p *nativeParser) value(t string, v *string, is *xmlRst, s *int) cellValue {
+	f := "General"
+	if s != nil {
+		f = p.numFmt(*s)
+	}
+	raw := ""
+	if v != nil {
+		raw = *v
+	}
+	switch t {
+	case "b":
+		if raw == "1" || raw == "true" {
+			return cellValue{text: "TRUE", raw: "TRUE"}
+		}
+		return cellValue{text: "FALSE", raw: "FALSE"}
+	case "e":
+		return cellValue{text: raw, raw: raw}
+	case "s":
+		id, err := strconv.Atoi(raw)
+		if err != nil || id < 0 || id >= len(p.strings) {
+			return cellValue{}
+		}
+		return p.text(p.strings[id].text(), f)
+	case "inlineStr":
+		if is == nil {
+			return cellValue{}
+		}
+		return p.text(is.text(), f)
+	case "str":
+		if isNumber(raw) {
+			n, _ := strconv.ParseFloat(raw, 64)
+			return p.number(raw, n, f)
+		}
+		return p.text(raw, f)
+	}
+	if raw == "" {
+		return cellValue{}
+	}
+	if !isNumber(raw) {
+		return p.text(raw, f)
+	}
+	n, _ := strconv.ParseFloat(raw, 64)
+	return p.number(raw, n, f)
+}
+
+// number formats numeric value v, stored as raw.
+func (p *nativeParser) number(raw string, v float64, f string) cellValue {
+	text, color := p.nf.number(v, f, p.date1904)
+	return cellValue{text: text, color: color, raw: raw, code: formatCode(f)}
+}
+
+// text formats text value s.
+func (p *nativeParser) text(s, f string) cellValue {
+	text, color := p.nf.text(s, f)
+	return cellValue{text: text, color: color, raw: s, code: formatCode(f)}
+}
+
+// numFmt returns the number format code of cell format xf.
+func (p *nativeParser) numFmt(xf int) string {
+	if xf < 0 || xf >= len(p.styles.CellXfs) {
+		return "General"
+	}
+	id := p.styles.CellXfs[xf].NumFmtID
+	if code, ok := p.numFmts[id]; ok {
+		return code
+	}
+	if code, ok := numfmt.Builtin(id); ok {
+		return code
+	}
+	return "General"
+}
+
+// themeColor returns the colour of theme index i, or "" if there is none.
+func (p *nativeParser) themeColor(i int) string {
+	if i < 0 || i >= len(p.theme) {
+		return ""
+	}
+	return p.theme[i]
+}
+
+// color returns the colour of c, or "" if there is none.
+func (p *nativeParser) color(c *xmlColor) string {
+	switch {
+	case c == nil:
+		return ""
+	case c.RGB != "":
+		return normalizeColor(c.RGB)
+	case c.Theme != nil:
+		return p.themeColor(*c.Theme)
+	}
+	return ""
+}
+
+// borders resolves the sides of border b.
+func (p *nativeParser) borders(b xmlBorder) Borders {
+	side := func(pr *xmlBorderPr) Border {
+		if pr == nil || borderStyle(pr.Style) == "" {
+			return Border{}
+		}
+		return Border{Style: borderStyle(pr.Style), Color: p.color(pr.Color)}
+	}
+	return Borders{Top: side(b.Top), Right: side(b.Right), Bottom: side(b.Bottom), Left: side(b.Left)}
+}
+
+// style resolves cell format xf the way ParseWorkbookModel does.
+func (p *nativeParser) style(xf int) CellStyle {
+	var st CellStyle
+	if xf < 0 || xf >= len(p.styles.CellXfs) {
+		return st
+	}
+	x := p.styles.CellXfs[xf]
+	if x.FontID != nil && *x.FontID >= 0 && *x.FontID < len(p.styles.Fonts) {
+		font := p.styles.Fonts[*x.FontID]
+		if font.Name != nil {
+			st.FontFamily = font.Name.Val
+		}
+		if font.Sz != nil {
+			st.FontSizePt, _ = strconv.ParseFloat(font.Sz.Val, 64)
+		}
+		if font.Color != nil && font.Color.RGB != "" {
+			st.FontColor = normalizeColor(font.Color.RGB)
+		}
+	}
+	if x.FillID != nil && *x.FillID >= 0 && *x.FillID < len(p.styles.Fills) {
+		if fg := p.styles.Fills[*x.FillID].FgColor; fg != nil {
+			if fg.RGB != "" {
+				st.BackgroundColor = normalizeColor(fg.RGB)
+			} else if fg.Theme != nil {
+				st.BackgroundColor = p.themeColor(*fg.Theme)
+			}
+		}
+	}
+	if x.BorderID != nil && *x.BorderID >= 0 && *x.BorderID < len(p.styles.Borders) {
+		b := p.styles.Borders[*x.BorderID]
+		if b.Left != nil && b.Left.Color != nil && b.Left.Color.RGB != "" {
+			st.BorderColor = normalizeColor(b.Left.Color.RGB)
+		}
+		st.Borders = p.borders(b)
+	}
+	if a := x.Alignment; a != nil {
+		st.HorizontalAlign = a.Horizontal
+		switch a.Vertical {
+		case "top":
+			st.VerticalAlign = "top"
+		case "center":
+			st.VerticalAlign = "middle"
+		default:
+			st.VerticalAlign = "bottom"
+		}
+		st.WrapText = xmlBool(a.WrapText)
+		if a.Indent != nil {
+			st.IndentPx = float64(*a.Indent) * indentStepPx
+		}
+	}
+	return st
+}
+
+// runs returns the rich-text runs of s, nil for plain strings.
+func (p *nativeParser) runs(s *xmlRst) []RenderRun {
+	var out []RenderRun
+	for _, r := range s.R {
+		run := RenderRun{Text: p.strs.intern(r.T)}
+		if rp := r.RPr; rp != nil {
+			if rp.RFont != nil {
+				run.FontFamily = rp.RFont.Val
+			}
+			if rp.Sz != nil {
+				run.FontSizePt, _ = strconv.ParseFloat(rp.Sz.Val, 64)
+			}
+			if c := rp.Color; c != nil {
+				if c.RGB != "" {
+					run.FontColor = normalizeColor(c.RGB)
+				} else if c.Theme != nil && *c.Theme != 1 {
+					// Light1 is the automatic font colour.
+					run.FontColor = p.themeColor(*c.Theme)
+				}
+			}
+			run.Bold = rp.B != nil
+			run.Italic = rp.I != nil
+			run.Strike = rp.Strike != nil
+			run.Underline = rp.U != nil
+			if rp.VertAlign != nil {
+				run.VerticalAlign = rp.VertAlign.Val
+			}
+		}
+		out = append(out, run)
+	}
+	return out
+}
+
+// nativePageSetup reads the print layout of a worksheet, as readPageSetup
+// does.
+func nativePageSetup(ws *xmlWorksheet) PageSetup {
+	ps := defaultPageSetup()
+	if m := ws.PageMargins; m != nil {
+		ps.MarginLeftPt, ps.MarginRightPt = m.Left*72, m.Right*72
+		ps.MarginTopPt, ps.MarginBottomPt = m.Top*72, m.Bottom*72
+	}
+	if s := ws.PageSetup; s != nil {
+		if s.PaperSize != nil {
+			if sz, ok := paperSizes[*s.PaperSize]; ok {
+				ps.PageWidthPt, ps.PageHeightPt = sz[0], sz[1]
+			}
+		}
+		if s.Scale != nil && *s.Scale >= 10 && *s.Scale <= 400 {
+			ps.Scale = float64(*s.Scale)
+		}
+		ps.FitToWidth, ps.FitToHeight = 1, 1
+		if s.FitToWidth != nil {
+			ps.FitToWidth = *s.FitToWidth
+		}
+		if s.FitToHeight != nil {
+			ps.FitToHeight = *s.FitToHeight
+		}
+		ps.OverThenDown = s.PageOrder == "overThenDown"
+		if s.Orientation == "landscape" {
+			ps.Landscape = true
+			ps.PageWidthPt, ps.PageHeightPt = ps.PageHeightPt, ps.PageWidthPt
+		}
+	}
+	ps.FitToPage = xmlBool(ws.PageSetUpPr.FitToPage)
+	if !ps.FitToPage {
+		ps.FitToWidth, ps.FitToHeight = 0, 0
+	}
+	if o := ws.PrintOptions; o != nil {
+		ps.Gridlines = xmlBool(o.GridLines)
+		ps.CenterH = xmlBool(o.HorizontalCentered)
+	}
+	return ps
+}
@@ -0,0 +1,8 @@
+//go:build nounioffice
+
+package xlsx
+
+// defaultBackend is the backend of ParseWorkbookModel; builds tagged
+// nounioffice have no other.  The tag only affects this package: packages
+// docx and convert link unioffice regardless.
+var defaultBackend = Native
@@ -0,0 +1,185 @@
+package xlsx
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/aerissecure/convert/xlsx/numfmt"
+)
+
+// -----------------------------------------------------------------------------
+// Number formats
+// -----------------------------------------------------------------------------
+//
+// The model holds the text a cell displays, so the parsers apply each
+// cell's number format code as they read it, resolving its numFmtId to a
+// built-in or custom code; the cell keeps the stored value and the code
+// beside the text.  They use the numfmt package by default, which writes
+// en-US separators and names.  WithNumberFormatter returns a backend that
+// formats with another NumberFormatter, e.g. one that writes "1.234,50"
+// for a German reader, without changes to the parsers.  OpenWorkbook
+// always formats with the default.
+//
+// Workbooks count dates from 1900 or, if workbookPr sets date1904 (the
+// default of old Mac Excel), from 1904, four years later.  The parsers
+// move 1904 serials onto the 1900 epoch before formatting calendar dates;
+// times of day and elapsed times such as [h]:mm are the same in both
+// systems and are left alone.  WithDateLayout returns a backend that shows
+// calendar dates with a Go time layout in a given location instead of
+// their format code.
+
+// NumberFormatter formats cell values with their number format code.  A
+// colour it returns, as "RRGGBB", overrides the font colour of the cell;
+// "" keeps it.  Implementations must be safe for concurrent use.
+type NumberFormatter interface {
+	// FormatNumber formats a numeric value; dates are serial numbers on
+	// the 1900 epoch, whatever the workbook's date system.
+	// Booleans and errors are not formatted.
+	FormatNumber(v float64, code, locale string) (text, color string)
+	// FormatText formats a text value, for the text section of code.
+	FormatText(s, code, locale string) (text, color string)
+}
+
+// DefaultNumberFormatter is the formatter the parsers use unless told
+// otherwise, backed by the numfmt package.  It ignores the locale.
+var DefaultNumberFormatter NumberFormatter = defaultNumberFormatter{}
+
+type defaultNumberFormatter struct{}
+
+func (defaultNumberFormatter) FormatNumber(v float64, code, _ string) (string, string) {
+	return numfmt.Number(v, code)
+}
+
+func (defaultNumberFormatter) FormatText(s, code, _ string) (string, string) {
+	return numfmt.Text(s, code)
+}
+
+// WithNumberFormatter returns a backend that parses as b does but formats
+// values with f, passing it locale, a BCP 47 tag such as "de-DE".  b must
+// be Unioffice or Native, or nil for Default; other backends are returned
+// as they are.
+func WithNumberFormatter(b Backend, f NumberFormatter, locale string) Backend {
+	return withNumberFormat(b, func(nf *numberFormat) { nf.f, nf.locale = f, locale })
+}
+
+// WithDateLayout returns a backend that parses as b does but shows values
+// whose number format is a calendar date, such as "m/d/yy" or
+// "yyyy-mm-dd hh:mm", as time.Time.Format does with layout, e.g.
+// time.RFC3339 or "2 Jan 2006".  Serials carry no zone; they are read as
+// UTC and shown in loc, or in UTC if loc is nil.  Times of day and elapsed
+// times keep their format code.  b must be Unioffice or Native, or nil for
+// Default, as for WithNumberFormatter, with which it combines.
+func WithDateLayout(b Backend, layout string, loc *time.Location) Backend {
+	return withNumberFormat(b, func(nf *numberFormat) { nf.layout, nf.loc = layout, loc })
+}
+
+// withNumberFormat returns b with its numberFormat changed by set.
+func withNumberFormat(b Backend, set func(*numberFormat)) Backend {
+	if b == nil {
+		b = defaultBackend
+	}
+	if b, ok := b.(formattingBackend); ok {
+		return b.withNumberFormat(set)
+	}
+	return b
+}
+
+// formattingBackend is a backend of this package, which formats values
+// with a numberFormat.
+type formattingBackend interface {
+	Backend
+	withNumberFormat(set func(*numberFormat)) Backend
+}
+
+// numberFormat is the formatter of a parse; the zero value formats as
+// DefaultNumberFormatter.
+type numberFormat struct {
+	f      NumberFormatter
+	locale string
+	layout string         // of WithDateLayout; "" formats dates by their code
+	loc    *time.Location // of WithDateLayout
+}
+
+// String describes nf for cache keys, naming the location, of which %v
+// would print the address.
+func (nf numberFormat) String() string {
+	var zone string
+	if nf.loc != nil {
+		zone = nf.loc.String()
+	}
+	return fmt.Sprintf("{f:%T%+v locale:%q layout:%q loc:%q}", nf.f, nf.f, nf.locale, nf.layout, zone)
+}
+
+// number formats v with code, a serial date counting from 1904 if
+// date1904 is set.
+func (nf numberFormat) number(v float64, code string, date1904 bool) (string, string) {
+	if f := numfmt.Parse(code); f.IsCalendar() {
+		if nf.layout != "" {
+			loc := nf.loc
+			if loc == nil {
+				loc = time.UTC
+			}
+			_, color := f.Number(v) // the code may still colour the date
+			return numfmt.Time(v, date1904).In(loc).Format(nf.layout), color
+		}
+		if date1904 {
+			v += numfmt.Days1904
+		}
+	}
+	if nf.f == nil {
+		return numfmt.Number(v, code)
+	}
+	return nf.f.FormatNumber(v, code, nf.locale)
+}
+
+// text formats s with code.
+func (nf numberFormat) text(s, code string) (string, string) {
+	if nf.f == nil {
+		return numfmt.Text(s, code)
+	}
+	return nf.f.FormatText(s, code, nf.locale)
+}
+
+// cellValue is the value of a cell as read and as formatted.
+type cellValue struct {
+	text  string // as displayed
+	color string // chosen by the number format, "" if none
+	raw   string // as stored
+	code  string // number format code; "" for General
+}
+
+// set gives rc the value, its format and the colour the format chose.
+// The colour goes to the runs, so set is called after they are built.
+func (v cellValue) set(rc *RenderCell) {
+	rc.Raw, rc.NumberFormat = v.raw, v.code
+	colorCell(rc, v.color)
+}
+
+// formatCode returns code as RenderCell.NumberFormat holds it.
+func formatCode(code string) string {
+	if code == "General" {
+		return ""
+	}
+	return code
+}
+
+// numberPattern matches the stored values read as numbers: integers and
+// decimals, the latter with an optional exponent.
+var numberPattern = regexp.MustCompile(`^[+-]?[0-9]+(\.[0-9]+(E[+-][0-9]+)?)?$`)
+
+// isNumber reports whether a stored value s is a number.
+func isNumber(s string) bool {
+	return numberPattern.MatchString(s)
+}
+
+// colorCell gives rc the colour its number format chose, if any.
+func colorCell(rc *RenderCell, color string) {
+	if color == "" {
+		return
+	}
+	rc.Style.FontColor = color
+	for i := range rc.Runs {
+		rc.Runs[i].FontColor = color
+	}
+}
@@ -0,0 +1,1267 @@
+// Package numfmt formats spreadsheet values with Excel number format codes,
+// the codes a cell's numFmtId resolves to: built-in ones such as "0.00%"
+// or "m/d/yy", and the custom ones a workbook defines in styles.xml.
+//
+// A code has up to four sections separated by semicolons, used by default
+// for positive numbers, negative numbers, zero and text; conditions such
+// as [>=1000] replace the sign test.  Sections may carry a colour ([Red],
+// [Color10]) and format numbers with digit placeholders (0 # ?), thousands
+// separators and scaling commas, percent signs, scientific notation
+// (0.00E+00) and fractions (# ?/?, ?/8), or dates and times (yyyy-mm-dd,
+// h:mm AM/PM, [h]:mm:ss.0).  Literal text may be quoted, escaped with a
+// backslash or, for common symbols, written as is; currency blocks such as
+// [$€-407] show their symbol.
+//
+// Dates and times are serial numbers on the 1900 epoch, in which 1 is
+// 1 January 1900 and, as in Excel, 1900 is a leap year.  Workbooks in the
+// 1904 date system count from 1 January 1904; Time converts serials of
+// either system.  Output uses the en-US separators and names.
+package numfmt
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// builtin are the number formats Excel does not store in styles.xml, by
+// numFmtId.
+var builtin = map[int]string{
+	0: "General", 1: "0", 2: "0.00", 3: "#,##0", 4: "#,##0.00",
+	5: `"$"#,##0_);("$"#,##0)`, 6: `"$"#,##0_);[Red]("$"#,##0)`,
+	7: `"$"#,##0.00_);("$"#,##0.00)`, 8: `"$"#,##0.00_);[Red]("$"#,##0.00)`,
+	9: "0%", 10: "0.00%", 11: "0.00E+00", 12: "# ?/?", 13: "# ??/??",
+	14: "m/d/yy", 15: "d-mmm-yy", 16: "d-mmm", 17: "mmm-yy",
+	18: "h:mm AM/PM", 19: "h:mm:ss AM/PM", 20: "h:mm", 21: "h:mm:ss", 22: "m/d/yy h:mm",
+	37: "#,##0 ;(#,##0)", 38: "#,##0 ;[Red](#,##0)", 39: "#,##0.00;(#,##0.00)", 40: "#,##0.00;[Red](#,##0.00)",
+	41: `_(* #,##0_);_(* \(#,##0\);_(* "-"_);_(@_)`,
+	42: `_("$"* #,##0_);_("$"* \(#,##0\);_("$"* "-"_);_(@_)`,
+	43: `_(* #,##0.00_);_(* \(#,##0.00\);_(* "-"??_);_(@_)`,
+	44: `_("$"* #,##0.00_);_("$"* \(#,##0.00\);_("$"* "-"??_);_(@_)`,
+	45: "mm:ss", 46: "[h]:mm:ss", 47: "mm:ss.0", 48: "##0.0E+0", 49: "@",
+}
+
+// Builtin returns the code of built-in number format id, reporting false
+// if there is none.
+func Builtin(id int) (string, bool) {
+	code, ok := builtin[id]
+	return code, ok
+}
+
+// cache holds the parsed formats by code.
+var cache sync.Map
+
+// Number formats v with code, returning the text and the colour, as
+// "RRGGBB", the code chose for it ("" if none).
+func Number(v float64, code string) (text, color string) {
+	return Parse(code).Number(v)
+}
+
+// Text formats s with code, as Number does.
+func Text(s, code string) (text, color string) {
+	return Parse(code).Text(s)
+}
+
+// IsDate reports whether code formats numbers as dates or times.
+func IsDate(code string) bool {
+	return Parse(code).IsDate()
+}
+
+// Format is a parsed number format code.  It is safe for concurrent use.
+type Format struct {
+	sections []section
+}
+
+// Parse parses code.  Every code is accepted: what is not understood is
+// shown literally or ignored, as Excel does when it reads a workbook.
+// Formats are cached, so parsing a code again is cheap.
+func Parse(code string) *Format {
+	if f, ok := cache.Load(code); ok {
+		return f.(*Format)
+	}
+	f := &Format{}
+	for _, s := range splitSections(code) {
+		f.sections = append(f.sections, parseSection(s))
+	}
+	cache.Store(code, f)
+	return f
+}
+
+// IsDate reports whether f formats numbers as dates or times.
+func (f *Format) IsDate() bool {
+	for _, s := range f.sections {
+		if s.kind == kindDate {
+			return true
+		}
+	}
+	return false
+}
+
+// IsCalendar reports whether f shows a calendar date: a day, month or
+// year, which depend on the date system, as times of day and elapsed times
+// do not.
+func (f *Format) IsCalendar() bool {
+	for _, s := range f.sections {
+		for _, t := range s.tokens {
+			if t.kind == tokDate && strings.ContainsAny(t.text[:1], "ydm") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsElapsed reports whether f shows an elapsed time, e.g. [h]:mm.
+func (f *Format) IsElapsed() bool {
+	for _, s := range f.sections {
+		for _, t := range s.tokens {
+			if t.kind == tokDate && t.text[0] == '[' {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Number formats v.
+func (f *Format) Number(v float64) (text, color string) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return "#NUM!", ""
+	}
+	s, neg := f.numberSection(v)
+	if s == nil {
+		return general(v), ""
+	}
+	sign := ""
+	switch {
+	case neg:
+		v = math.Abs(v)
+	case v < 0 && s.kind != kindDate:
+		// A section of its own shows the sign.
+		sign, v = "-", -v
+	}
+	switch s.kind {
+	case kindGeneral:
+		return sign + s.literal(general(v)), s.color
+	case kindDate:
+		if v < 0 {
+			return "#####", s.color
+		}
+		return s.date(v), s.color
+	case kindText:
+		// A text section used for a number shows the number in General.
+		return sign + s.text(general(v)), s.color
+	}
+	return sign + s.number(v), s.color
+}
+
+// Text formats s.  Only a text section, the fourth or the only one if it
+// holds @, changes it.
+func (f *Format) Text(s string) (text, color string) {
+	var sec *section
+	switch {
+	case len(f.sections) >= 4:
+		sec = &f.sections[3]
+	case len(f.sections) == 1 && f.sections[0].kind == kindText:
+		sec = &f.sections[0]
+	default:
+		for i := range f.sections {
+			if f.sections[i].kind == kindText {
+				sec = &f.sections[i]
+			}
+		}
+	}
+	if sec == nil {
+		return s, ""
+	}
+	return sec.text(s), sec.color
+}
+
+// numberSection picks the section for v, reporting whether it shows v
+// without its sign.  It returns nil if the code has no number section.
+func (f *Format) numberSection(v float64) (*section, bool) {
+	var secs []*section
+	for i := range f.sections {
+		if i < 3 && (f.sections[i].kind != kindText || i > 0) {
+			secs = append(secs, &f.sections[i])
+		}
+	}
+	if len(secs) == 0 {
+		return nil, false
+	}
+	if secs[0].cond != nil || len(secs) > 1 && secs[1].cond != nil {
+		for i, s := range secs {
+			if s.cond == nil || s.cond.test(v) {
+				return s, v < 0 && (i > 0 && s.cond == nil || s.cond != nil && s.cond.negative())
+			}
+		}
+		return secs[len(secs)-1], false
+	}
+	switch {
+	case v < 0 && len(secs) > 1:
+		return secs[1], true
+	case v == 0 && len(secs) > 2:
+		return secs[2], false
+	}
+	return secs[0], false
+}
+
+// -----------------------------------------------------------------------------
+// Parsing
+// -----------------------------------------------------------------------------
+
+type sectionKind int
+
+const (
+	kindNumber sectionKind = iota
+	kindGeneral
+	kindDate
+	kindText
+)
+
+type tokenKind int
+
+const (
+	tokLiteral   tokenKind = iota
+	tokDigit               // 0, # or ?
+	tokPoint               // decimal point
+	tokComma               // thousands separator or scaling comma
+	tokPercent             // %
+	tokExp                 // E+ or E-; text is the sign
+	tokSlash               // fraction bar
+	tokText                // @
+	tokGeneral             // General
+	tokDate                // date or time part, lower case: "yyyy", "m", "am/pm", "[h]", …
+	tokSubsecond           // fractional seconds; text is the zeros
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// condition is a section condition such as [>=100].
+type condition struct {
+	op    string
+	value float64
+}
+
+func (c *condition) test(v float64) bool {
+	switch c.op {
+	case "<":
+		return v < c.value
+	case "<=":
+		return v <= c.value
+	case ">":
+		return v > c.value
+	case ">=":
+		return v >= c.value
+	case "<>":
+		return v != c.value
+	}
+	return v == c.value
+}
+
+// negative reports whether the condition only holds for negative numbers,
+// whose sign the section then leaves out.
+func (c *condition) negative() bool {
+	return (c.op == "<" && c.value <= 0) || (c.op == "<=" && c.value < 0)
+}
+
+// section is one section of a format code.
+type section struct {
+	kind   sectionKind
+	tokens []token
+	color  string
+	cond   *condition
+
+	// Number sections.
+	percent   int  // % signs, each multiplying by 100
+	scale     int  // scaling commas, each dividing by 1000
+	thousands bool // digits are grouped
+
+	// Date sections.
+	hour12 bool // an AM/PM part makes hours 12-hour
+}
+
+// splitSections splits code at the semicolons outside quotes, escapes and
+// brackets.
+func splitSections(code string) []string {
+	var out []string
+	start, quoted, bracket := 0, false, false
+	for i := 0; i < len(code); i++ {
+		switch c := code[i]; {
+		case quoted:
+			quoted = c != '"'
+		case bracket:
+			bracket = c != ']'
+		case c == '"':
+			quoted = true
+		case c == '[':
+			bracket = true
+		case c == '\\' || c == '_' || c == '*':
+			if i+1 < len(code) {
+				_, n := utf8.DecodeRuneInString(code[i+1:])
+				i += n
+			}
+		case c == ';':
+			out = append(out, code[start:i])
+			start = i + 1
+		}
+	}
+	return append(out, code[start:])
+}
+
+// namedColors are the colours a section may name.
+var namedColors = map[string]string{
+	"black": "000000", "blue": "0000FF", "cyan": "00FFFF", "green": "00FF00",
+	"magenta": "FF00FF", "red": "FF0000", "white": "FFFFFF", "yellow": "FFFF00",
+}
+
+// palette holds the colours of [Color1] to [Color56], Excel's default
+// palette.
+var palette = []string{
+	"000000", "FFFFFF", "FF0000", "00FF00", "0000FF", "FFFF00", "FF00FF", "00FFFF",
+	"800000", "008000", "000080", "808000", "800080", "008080", "C0C0C0", "808080",
+	"9999FF", "993366", "FFFFCC", "CCFFFF", "660066", "FF8080", "0066CC", "CCCCFF",
+	"000080", "FF00FF", "FFFF00", "00FFFF", "800080", "800000", "008080", "0000FF",
+	"00CCFF", "CCFFFF", "CCFFCC", "FFFF99", "99CCFF", "FF99CC", "CC99FF", "FFCC99",
+	"3366FF", "33CCCC", "99CC00", "FFCC00", "FF9900", "FF6600", "666699", "969696",
+	"003366", "339966", "003300", "333300", "993300", "993366", "333399", "333333",
+}
+
+// System date and time formats, which [$-F800] and [$-F400] stand for.
+const (
+	systemLongDate = "dddd, mmmm d, yyyy"
+	systemTime     = "h:mm:ss AM/PM"
+)
+
+// parseSection tokenises one section of a code and classifies it.
+func parseSection(code string) section {
+	var s section
+	add := func(kind tokenKind, text string) {
+		if n := len(s.tokens); kind == tokLiteral && n > 0 && s.tokens[n-1].kind == tokLiteral {
+			s.tokens[n-1].text += text
+			return
+		}
+		s.tokens = append(s.tokens, token{kind, text})
+	}
+	for i := 0; i < len(code); {
+		c := code[i]
+		rest := code[i:]
+		switch {
+		case c == '"':
+			end := strings.IndexByte(code[i+1:], '"')
+			if end < 0 {
+				end = len(code) - i - 1
+			}
+			add(tokLiteral, code[i+1:i+1+end])
+			i += end + 2
+			continue
+		case c == '\\' || c == '_' || c == '*':
+			if i+1 >= len(code) {
+				i++
+				continue
+			}
+			r, n := utf8.DecodeRuneInString(code[i+1:])
+			switch c {
+			case '\\':
+				add(tokLiteral, string(r))
+			case '_':
+				add(tokLiteral, " ") // the width of r
+			}
+			// A '*' repeats r to fill the cell, which is left out.
+			i += 1 + n
+			continue
+		case c == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				end = len(rest)
+			}
+			if s.bracket(rest[1:end], add) {
+				i = len(code)
+			}
+			i += end + 1
+			continue
+		case c == '0' || c == '#' || c == '?':
+			add(tokDigit, string(c))
+		case c == '.':
+			add(tokPoint, ".")
+		case c == ',':
+			add(tokComma, ",")
+		case c == '%':
+			add(tokPercent, "%")
+		case (c == 'E' || c == 'e') && len(rest) > 1 && (rest[1] == '+' || rest[1] == '-'):
+			add(tokExp, rest[1:2])
+			i += 2
+			continue
+		case c == '/':
+			add(tokSlash, "/")
+		case c == '@':
+			add(tokText, "@")
+		case hasPrefixFold(rest, "General"):
+			add(tokGeneral, "General")
+			i += len("General")
+			continue
+		case hasPrefixFold(rest, "AM/PM"):
+			add(tokDate, "am/pm")
+			i += len("AM/PM")
+			continue
+		case hasPrefixFold(rest, "A/P"):
+			add(tokDate, rest[:1]+"/"+rest[2:3]) // keeps the case of the letters shown
+			i += len("A/P")
+			continue
+		case strings.ContainsRune("yYmMdDhHsS", rune(c)):
+			n := 1
+			for n < len(rest) && lower(rest[n]) == lower(c) {
+				n++
+			}
+			add(tokDate, strings.Repeat(string(lower(c)), n))
+			i += n
+			continue
+		default:
+			r, n := utf8.DecodeRuneInString(rest)
+			add(tokLiteral, string(r))
+			i += n
+			continue
+		}
+		i++
+	}
+	s.classify()
+	return s
+}
+
+// bracket handles the bracketed part of a section: a colour, a condition,
+// an elapsed time part or a currency and locale.  It reports whether the
+// bracket stood for a system format, which replaces the rest of the
+// section.
+func (s *section) bracket(b string, add func(tokenKind, string)) bool {
+	lb := strings.ToLower(b)
+	switch {
+	case namedColors[lb] != "":
+		s.color = namedColors[lb]
+	case strings.HasPrefix(lb, "color"):
+		if n, err := strconv.Atoi(lb[len("color"):]); err == nil && n >= 1 && n <= len(palette) {
+			s.color = palette[n-1]
+		}
+	case strings.HasPrefix(b, "$"):
+		symbol, locale, _ := strings.Cut(b[1:], "-")
+		if symbol != "" {
+			add(tokLiteral, symbol)
+		}
+		switch strings.ToUpper(locale) {
+		case "F800":
+			s.tokens = parseSection(systemLongDate).tokens
+			return true
+		case "F400":
+			s.tokens = parseSection(systemTime).tokens
+			return true
+		}
+	case b != "" && strings.ContainsRune("<>=", rune(b[0])):
+		op := strings.TrimRight(b[:min(2, len(b))], "0123456789.-+ ")
+		if v, err := strconv.ParseFloat(strings.TrimSpace(b[len(op):]), 64); err == nil {
+			s.cond = &condition{op: op, value: v}
+		}
+	case lb != "" && strings.Trim(lb, lb[:1]) == "" && strings.ContainsRune("hms", rune(lb[0])):
+		add(tokDate, "["+lb+"]")
+	}
+	return false
+}
+
+// classify decides the kind of s and resolves the tokens whose meaning
+// depends on it.
+func (s *section) classify() {
+	for _, t := range s.tokens {
+		switch t.kind {
+		case tokDate:
+			s.kind = kindDate
+		case tokGeneral:
+			if s.kind != kindDate {
+				s.kind = kindGeneral
+			}
+		case tokText:
+			if s.kind == kindNumber {
+				s.kind = kindText
+			}
+		}
+	}
+	switch s.kind {
+	case kindDate:
+		s.classifyDate()
+	case kindNumber:
+		s.classifyNumber()
+	}
+}
+
+// classifyDate turns what is not a date part into literals, finds the
+// fractional seconds and tells minutes from months.
+func (s *section) classifyDate() {
+	var out []token
+	for i := 0; i < len(s.tokens); i++ {
+		t := s.tokens[i]
+		switch t.kind {
+		case tokDate:
+			if t.text == "am/pm" || strings.Contains(t.text, "/") {
+				s.hour12 = true
+			}
+		case tokPoint:
+			// .0, .00 or .000 after seconds
+			j := i + 1
+			for j < len(s.tokens) && s.tokens[j].kind == tokDigit && s.tokens[j].text == "0" && j-i <= 3 {
+				j++
+			}
+			if j > i+1 && s.lastDate(out, "s") {
+				out = append(out, token{tokSubsecond, strings.Repeat("0", j-i-1)})
+				i = j - 1
+				continue
+			}
+			t.kind = tokLiteral
+		default:
+			t.kind = tokLiteral
+		}
+		out = append(out, t)
+	}
+	// m and mm are minutes after hours or before seconds.
+	for i, t := range out {
+		if t.kind != tokDate || (t.text != "m" && t.text != "mm") {
+			continue
+		}
+		if s.lastDate(out[:i], "h") || s.nextDate(out[i+1:], "s") {
+			out[i].text = strings.ToUpper(t.text) // minutes
+		}
+	}
+	s.tokens = out
+}
+
+// lastDate reports whether the last date part of toks is a part of letter
+// c, e.g. "h" for h, hh and [h].
+func (s *section) lastDate(toks []token, c string) bool {
+	for i := len(toks) - 1; i >= 0; i-- {
+		if toks[i].kind == tokDate {
+			return strings.Trim(toks[i].text, "[]")[:1] == c
+		}
+	}
+	return false
+}
+
+// nextDate reports whether the next date part of toks is a part of letter
+// c.
+func (s *section) nextDate(toks []token, c string) bool {
+	for _, t := range toks {
+		if t.kind == tokDate {
+			return strings.Trim(t.text, "[]")[:1] == c
+		}
+	}
+	return false
+}
+
+// classifyNumber counts the percent signs and tells thousands separators
+// from scaling commas; other commas are literal.
+func (s *section) classifyNumber() {
+	digitBefore := false
+	for i := range s.tokens {
+		t := &s.tokens[i]
+		switch t.kind {
+		case tokDigit:
+			digitBefore = true
+		case tokPercent:
+			s.percent++
+		case tokExp, tokSlash:
+			digitBefore = false
+		case tokComma:
+			next := tokLiteral
+			for _, u := range s.tokens[i+1:] {
+				if u.kind != tokComma {
+					next = u.kind
+					break
+				}
+			}
+			switch {
+			case digitBefore && next == tokDigit:
+				s.thousands = true
+			case digitBefore:
+				s.scale++
+			default:
+				t.kind = tokLiteral
+			}
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Numbers
+// -----------------------------------------------------------------------------
+
+// number formats v ≥ 0 with a number section.
+func (s *section) number(v float64) string {
+	v *= math.Pow(100, float64(s.percent))
+	v /= math.Pow(1000, float64(s.scale))
+	for _, t := range s.tokens {
+		switch t.kind {
+		case tokSlash:
+			return s.fraction(v)
+		case tokExp:
+			return s.scientific(v)
+		}
+	}
+	point := len(s.tokens)
+	for i, t := range s.tokens {
+		if t.kind == tokPoint {
+			point = i
+			break
+		}
+	}
+	whole, frac := fixed(v, countDigits(s.tokens[point:]))
+	var b strings.Builder
+	b.WriteString(s.integer(s.tokens[:point], whole))
+	b.WriteString(s.decimals(s.tokens[point:], frac))
+	return b.String()
+}
+
+// countDigits returns the number of digit placeholders in toks.
+func countDigits(toks []token) int {
+	n := 0
+	for _, t := range toks {
+		if t.kind == tokDigit {
+			n++
+		}
+	}
+	return n
+}
+
+// integer lays out the integer digits of a number, "" for zero, over the
+// placeholders of toks from the right.  The leftmost placeholder takes
+// the digits left over.
+func (s *section) integer(toks []token, digits string) string {
+	first := -1
+	for i, t := range toks {
+		if t.kind == tokDigit {
+			first = i
+			break
+		}
+	}
+	var out []string // in reverse
+	n := 0           // digits written, for grouping
+	put := func(d string) {
+		for i := len(d) - 1; i >= 0; i-- {
+			if s.thousands && n > 0 && n%3 == 0 {
+				out = append(out, ",")
+			}
+			out = append(out, d[i:i+1])
+			n++
+		}
+	}
+	if first < 0 {
+		// No placeholder, as in ".00": the digits follow the text.  A
+		// section of text alone shows no number at all.
+		if digits == "" || len(toks) == len(s.tokens) {
+			return tokensText(toks)
+		}
+		put(digits)
+		slices.Reverse(out)
+		return tokensText(toks) + strings.Join(out, "")
+	}
+	rest := digits
+	for i := len(toks) - 1; i >= 0; i-- {
+		t := toks[i]
+		if t.kind != tokDigit {
+			if i < first || t.kind != tokComma {
+				out = append(out, tokenText(t))
+			}
+			continue
+		}
+		var d string
+		if i == first {
+			d, rest = rest, ""
+		} else if rest != "" {
+			d, rest = rest[len(rest)-1:], rest[:len(rest)-1]
+		}
+		if d != "" {
+			put(d)
+			continue
+		}
+		switch t.text {
+		case "0":
+			put("0")
+		case "?":
+			out = append(out, " ")
+		}
+	}
+	slices.Reverse(out)
+	return strings.Join(out, "")
+}
+
+// decimals lays out the fractional digits of a number over the decimal
+// point and placeholders of toks.  Trailing zeros are dropped for # and
+// shown as spaces for ?.
+func (s *section) decimals(toks []token, digits string) string {
+	// Work out which trailing placeholders show nothing or a space.
+	show := make([]string, len(digits))
+	trailing := true
+	for i, j := len(toks)-1, len(digits)-1; i >= 0; i-- {
+		if toks[i].kind != tokDigit {
+			continue
+		}
+		d := digits[j : j+1]
+		if trailing && d == "0" && toks[i].text != "0" {
+			if toks[i].text == "?" {
+				d = " "
+			} else {
+				d = ""
+			}
+		} else {
+			trailing = false
+		}
+		show[j] = d
+		j--
+	}
+	var b strings.Builder
+	j := 0
+	for _, t := range toks {
+		switch t.kind {
+		case tokDigit:
+			b.WriteString(show[j])
+			j++
+		case tokComma:
+		default:
+			b.WriteString(tokenText(t))
+		}
+	}
+	return b.String()
+}
+
+// scientific formats v with a section in scientific notation.
+func (s *section) scientific(v float64) string {
+	exp := 0
+	for i, t := range s.tokens {
+		if t.kind == tokExp {
+			exp = i
+			break
+		}
+	}
+	mant, etoks := s.tokens[:exp], s.tokens[exp+1:]
+	point := len(mant)
+	for i, t := range mant {
+		if t.kind == tokPoint {
+			point = i
+			break
+		}
+	}
+	intDigits := max(countDigits(mant[:point]), 1)
+	engineering := false
+	for _, t := range mant[:point] {
+		engineering = engineering || t.text == "#"
+	}
+	e := 0
+	if v != 0 {
+		e = int(math.Floor(math.Log10(v)))
+		if engineering && intDigits > 1 {
+			e = int(math.Floor(float64(e)/float64(intDigits))) * intDigits
+		} else {
+			e -= intDigits - 1
+		}
+	}
+	fracDigits := countDigits(mant[point:])
+	whole, frac := fixed(v/math.Pow10(e), fracDigits)
+	if len(whole) > intDigits && !engineering {
+		// Rounding carried into another digit.
+		e++
+		whole, frac = fixed(v/math.Pow10(e), fracDigits)
+	}
+	var b strings.Builder
+	b.WriteString(s.integer(mant[:point], whole))
+	b.WriteString(s.decimals(mant[point:], frac))
+	b.WriteByte('E')
+	switch {
+	case e < 0:
+		b.WriteByte('-')
+	case s.tokens[exp].text == "+":
+		b.WriteByte('+')
+	}
+	ed := strconv.Itoa(abs(e))
+	if ed == "0" {
+		ed = ""
+	}
+	b.WriteString(s.integer(etoks, ed))
+	return b.String()
+}
+
+// fraction formats v with a section holding a fraction, e.g. "# ?/?" or
+// "?/8".
+func (s *section) fraction(v float64) string {
+	slash := 0
+	for i, t := range s.tokens {
+		if t.kind == tokSlash {
+			slash = i
+			break
+		}
+	}
+	// The numerator is the run of placeholders before the bar; a whole
+	// part is an earlier run of placeholders.
+	numStart := slash
+	for numStart > 0 && s.tokens[numStart-1].kind == tokDigit {
+		numStart--
+	}
+	wholeEnd := numStart
+	for wholeEnd > 0 && s.tokens[wholeEnd-1].kind != tokDigit {
+		wholeEnd--
+	}
+	hasWhole := wholeEnd > 0
+	numToks := s.tokens[numStart:slash]
+
+	// The denominator is a run of placeholders, or digits fixing it.
+	after := s.tokens[slash+1:]
+	denEnd := 0
+	for denEnd < len(after) && after[denEnd].kind == tokDigit {
+		denEnd++
+	}
+	denToks, suffix := after[:denEnd], after[denEnd:]
+	fixedDen := 0
+	if denEnd == 0 && len(suffix) > 0 && suffix[0].kind == tokLiteral {
+		lit := suffix[0].text
+		n := 0
+		for n < len(lit) && lit[n] >= '0' && lit[n] <= '9' {
+			n++
+		}
+		fixedDen, _ = strconv.Atoi(lit[:n])
+		suffix = append([]token{{tokLiteral, lit[n:]}}, suffix[1:]...)
+	}
+
+	whole, frac := 0.0, v
+	if hasWhole {
+		whole = math.Floor(v)
+		frac = v - whole
+	}
+	var num, den int
+	if fixedDen > 0 {
+		den = fixedDen
+		num = int(math.Round(frac * float64(den)))
+	} else {
+		num, den = approximate(frac, int(math.Pow10(len(denToks)))-1)
+	}
+	if hasWhole && num == den {
+		whole++
+		num = 0
+	}
+
+	var b strings.Builder
+	if hasWhole {
+		digits := ""
+		if whole > 0 {
+			digits = strconv.FormatFloat(whole, 'f', 0, 64)
+		}
+		switch {
+		case digits == "" && num != 0:
+			// Only the fraction shows.
+			b.WriteString(tokensText(s.tokens[:firstDigit(s.tokens)]))
+		default:
+			b.WriteString(s.integer(s.tokens[:wholeEnd], digits))
+			if num != 0 {
+				b.WriteString(tokensText(s.tokens[wholeEnd:numStart]))
+			}
+		}
+		if num == 0 {
+			if digits == "" {
+				b.Reset()
+				b.WriteString(s.integer(s.tokens[:wholeEnd], "0"))
+			}
+			// The fraction's place is kept blank.
+			n := len(numToks) + 1 + max(len(denToks), len(strconv.Itoa(fixedDen)))
+			if countPlaceholder(numToks, "?") > 0 {
+				b.WriteString(strings.Repeat(" ", n+len(tokensText(s.tokens[wholeEnd:numStart]))))
+			}
+			b.WriteString(tokensText(suffix))
+			return b.String()
+		}
+	} else {
+		b.WriteString(tokensText(s.tokens[:numStart]))
+	}
+	b.WriteString(s.integer(numToks, nonZero(num)))
+	b.WriteByte('/')
+	if fixedDen > 0 {
+		b.WriteString(strconv.Itoa(den))
+	} else {
+		d := strconv.Itoa(den)
+		b.WriteString(d)
+		// Denominators are aligned on the bar, padded on the right.
+		for i := len(d); i < len(denToks); i++ {
+			switch denToks[i].text {
+			case "0":
+				b.WriteByte('0')
+			case "?":
+				b.WriteByte(' ')
+			}
+		}
+	}
+	b.WriteString(tokensText(suffix))
+	return b.String()
+}
+
+// approximate returns the fraction closest to x, 0 ≤ x < 1 for mixed
+// fractions, whose denominator is at most maxDen.
+func approximate(x float64, maxDen int) (int, int) {
+	maxDen = max(maxDen, 1)
+	bestNum, bestDen, bestErr := int(math.Round(x)), 1, math.Abs(x-math.Round(x))
+	// Stern–Brocot search between the integers around x.
+	lo := math.Floor(x)
+	a, b, c, d := int(lo), 1, int(lo)+1, 1
+	for {
+		m, n := a+c, b+d
+		if n > maxDen {
+			break
+		}
+		f := float64(m) / float64(n)
+		if err := math.Abs(x - f); err < bestErr {
+			bestNum, bestDen, bestErr = m, n, err
+		}
+		if f < x {
+			a, b = m, n
+		} else if f > x {
+			c, d = m, n
+		} else {
+			break
+		}
+	}
+	return bestNum, bestDen
+}
+
+// firstDigit returns the index of the first placeholder of toks.
+func firstDigit(toks []token) int {
+	for i, t := range toks {
+		if t.kind == tokDigit {
+			return i
+		}
+	}
+	return len(toks)
+}
+
+// countPlaceholder returns the number of placeholders p in toks.
+func countPlaceholder(toks []token, p string) int {
+	n := 0
+	for _, t := range toks {
+		if t.kind == tokDigit && t.text == p {
+			n++
+		}
+	}
+	return n
+}
+
+// nonZero returns n as digits, or "" for zero.
+func nonZero(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// fixed returns the digits of v ≥ 0 rounded half away from zero to n
+// decimals: the integer digits, "" for zero, and n fractional digits.  v
+// is first rounded to the 15 significant digits Excel keeps, so that e.g.
+// 1.005 rounds up as it reads.
+func fixed(v float64, n int) (string, string) {
+	mant, exp, _ := strings.Cut(strconv.FormatFloat(v, 'e', 14, 64), "e")
+	e, _ := strconv.Atoi(exp)
+	ds := strings.Replace(mant, ".", "", 1)
+	point := e + 1 // digits of ds before the decimal point
+	if point < 0 {
+		ds = strings.Repeat("0", -point) + ds
+		point = 0
+	}
+	if len(ds) < point+n+1 {
+		ds += strings.Repeat("0", point+n+1-len(ds))
+	}
+	keep := []byte(ds[:point+n])
+	if ds[point+n] >= '5' {
+		i := len(keep) - 1
+		for ; i >= 0 && keep[i] == '9'; i-- {
+			keep[i] = '0'
+		}
+		if i < 0 {
+			keep = append([]byte{'1'}, keep...)
+			point++
+		} else {
+			keep[i]++
+		}
+	}
+	return strings.TrimLeft(string(keep[:point]), "0"), string(keep[point:])
+}
+
+// general formats v as the General format does: as many digits as fit in
+// eleven characters, switching to scientific notation for very large and
+// very small numbers.
+func general(v float64) string {
+	if v == 0 {
+		return "0"
+	}
+	a := math.Abs(v)
+	sci := func() string {
+		s := strconv.FormatFloat(v, 'E', 5, 64)
+		m, e, _ := strings.Cut(s, "E")
+		if strings.Contains(m, ".") {
+			m = strings.TrimRight(strings.TrimRight(m, "0"), ".")
+		}
+		return m + "E" + e
+	}
+	if a >= 1e11 || a < 1e-9 {
+		return sci()
+	}
+	width := 10 // characters after the sign
+	whole, _ := fixed(a, 0)
+	dec := max(width-max(len(whole), 1)-1, 0)
+	w, f := fixed(a, dec)
+	f = strings.TrimRight(f, "0")
+	if a < 1e-4 {
+		if got, _ := strconv.ParseFloat("0."+f, 64); math.Abs(got-a)/a > 1e-5 {
+			return sci()
+		}
+	}
+	s := w
+	if s == "" {
+		s = "0"
+	}
+	if f != "" {
+		s += "." + f
+	}
+	if v < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// -----------------------------------------------------------------------------
+// Dates and times
+// -----------------------------------------------------------------------------
+
+// epoch is day 0 of the 1900 date system, for serials after the fictitious
+// 29 February 1900 (serial 60).
+var epoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// epoch1904 is day 0 of the 1904 date system.
+var epoch1904 = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Days1904 is the number of days between the epochs of the 1900 and 1904
+// date systems: a 1904 serial plus Days1904 is the 1900 serial of the
+// same date.
+const Days1904 = 1462
+
+// Time returns the date and time serial v stands for, in UTC, as
+// serials carry no zone.  v counts from 1 January 1904 if date1904 is set
+// and from the 1900 epoch otherwise, whose serials before 1 March 1900
+// fall a day late, as Excel counts a 29 February 1900; serial 60, that
+// day, is taken as 1 March.  v is rounded to the millisecond.
+func Time(v float64, date1904 bool) time.Time {
+	ms := time.Duration(math.Round(v*86400e3)) * time.Millisecond
+	switch {
+	case date1904:
+		return epoch1904.Add(ms)
+	case v < 60:
+		return epoch.Add(ms + 24*time.Hour)
+	case v < 61:
+		return time.Date(1900, 3, 1, 0, 0, 0, 0, time.UTC).Add(ms - 60*24*time.Hour)
+	}
+	return epoch.Add(ms)
+}
+
+// date formats serial v ≥ 0 with a date section.
+func (s *section) date(v float64) string {
+	// Round to the precision shown.
+	prec := 0
+	for _, t := range s.tokens {
+		if t.kind == tokSubsecond {
+			prec = max(prec, len(t.text))
+		}
+	}
+	unit := math.Pow10(prec)
+	ticks := math.Round(v * 86400 * unit) // in units of the last digit shown
+	days := math.Floor(ticks / (86400 * unit))
+	rem := ticks - days*86400*unit
+	secs := int64(rem / unit)
+	sub := int64(rem) % int64(unit)
+
+	day := int(days)
+	var t time.Time
+	switch {
+	case day == 0:
+		t = time.Date(1900, 1, 0, 0, 0, 0, 0, time.UTC) // shown as 1900-01-00
+	case day < 60:
+		t = epoch.AddDate(0, 0, day+1)
+	case day == 60:
+		t = time.Date(1900, 2, 29, 0, 0, 0, 0, time.UTC) // normalised to 1 March
+	default:
+		t = epoch.AddDate(0, 0, day)
+	}
+	year, month, dom := t.Year(), int(t.Month()), t.Day()
+	switch day {
+	case 0:
+		year, month, dom = 1900, 1, 0
+	case 60:
+		year, month, dom = 1900, 2, 29
+	}
+	weekday := (day + 6) % 7 // serial 1 was a Sunday by Excel's count
+	hour, minute, second := int(secs/3600), int(secs/60%60), int(secs%60)
+
+	var b strings.Builder
+	for _, tok := range s.tokens {
+		if tok.kind == tokLiteral {
+			b.WriteString(tok.text)
+			continue
+		}
+		if tok.kind == tokSubsecond {
+			d := strconv.FormatInt(sub, 10)
+			b.WriteString("." + strings.Repeat("0", prec-len(d)) + d)
+			continue
+		}
+		switch p := tok.text; p {
+		case "y", "yy":
+			b.WriteString(pad2(year % 100))
+		case "d":
+			b.WriteString(strconv.Itoa(dom))
+		case "dd":
+			b.WriteString(pad2(dom))
+		case "ddd":
+			b.WriteString(time.Weekday(weekday).String()[:3])
+		case "m":
+			b.WriteString(strconv.Itoa(month))
+		case "mm":
+			b.WriteString(pad2(month))
+		case "mmm":
+			b.WriteString(time.Month(month).String()[:3])
+		case "mmmmm":
+			b.WriteString(time.Month(month).String()[:1])
+		case "M":
+			b.WriteString(strconv.Itoa(minute))
+		case "MM":
+			b.WriteString(pad2(minute))
+		case "h", "hh":
+			h := hour
+			if s.hour12 {
+				h = (h+11)%12 + 1
+			}
+			if p == "hh" {
+				b.WriteString(pad2(h))
+			} else {
+				b.WriteString(strconv.Itoa(h))
+			}
+		case "s":
+			b.WriteString(strconv.Itoa(second))
+		case "ss":
+			b.WriteString(pad2(second))
+		case "am/pm":
+			if hour < 12 {
+				b.WriteString("AM")
+			} else {
+				b.WriteString("PM")
+			}
+		default:
+			switch {
+			case strings.HasPrefix(p, "[h"):
+				b.WriteString(padN(int(days)*24+hour, len(p)-2))
+			case strings.HasPrefix(p, "[m"):
+				b.WriteString(padN((int(days)*24+hour)*60+minute, len(p)-2))
+			case strings.HasPrefix(p, "[s"):
+				b.WriteString(padN(int(days)*86400+int(secs), len(p)-2))
+			case strings.HasPrefix(p, "yyy"):
+				b.WriteString(strconv.Itoa(year))
+			case strings.HasPrefix(p, "dddd"):
+				b.WriteString(time.Weekday(weekday).String())
+			case strings.HasPrefix(p, "mmmm"):
+				b.WriteString(time.Month(month).String())
+			case strings.Contains(p, "/"): // a/p in the case written
+				ap := p[:1]
+				if hour >= 12 {
+					ap = p[2:3]
+				}
+				b.WriteString(ap)
+			}
+		}
+	}
+	return b.String()
+}
+
+func pad2(n int) string {
+	return padN(n, 2)
+}
+
+// padN formats n with at least width digits.
+func padN(n, width int) string {
+	s := strconv.Itoa(n)
+	if len(s) < width {
+		s = strings.Repeat("0", width-len(s)) + s
+	}
+	return s
+}
+
+// -----------------------------------------------------------------------------
+// Text and literals
+// -----------------------------------------------------------------------------
+
+// text formats s with a section, putting it in place of @.
+func (s *section) text(v string) string {
+	var b strings.Builder
+	for _, t := range s.tokens {
+		switch t.kind {
+		case tokText:
+			b.WriteString(v)
+		case tokLiteral:
+			b.WriteString(t.text)
+		}
+	}
+	return b.String()
+}
+
+// literal formats a General section, putting v in place of General.
+func (s *section) literal(v string) string {
+	var b strings.Builder
+	for _, t := range s.tokens {
+		switch t.kind {
+		case tokGeneral:
+			b.WriteString(v)
+		case tokDigit, tokPoint:
+		default:
+			b.WriteString(tokenText(t))
+		}
+	}
+	return b.String()
+}
+
+// tokenText returns the text a token other than a placeholder shows.
+func tokenText(t token) string {
+	switch t.kind {
+	case tokDigit, tokComma, tokText, tokGeneral:
+		return ""
+	case tokExp:
+		return "E" + t.text
+	}
+	return t.text
+}
+
+// tokensText returns the text toks show, without placeholders.
+func tokensText(toks []token) string {
+	var b strings.Builder
+	for _, t := range toks {
+		b.WriteString(tokenText(t))
+	}
+	return b.String()
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+func lower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
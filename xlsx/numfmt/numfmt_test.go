@@ -0,0 +1,116 @@
+package numfmt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNumber(t *testing.T) {
+	tests := []struct {
+		code  string
+		v     float64
+		want  string
+		color string
+	}{
+		{"General", 1234.5, "1234.5", ""},
+		{"General", 0.1 + 0.2, "0.3", ""},
+		{"General", 123456789012, "1.23457E+11", ""},
+		{"0", 2.5, "3", ""},
+		{"0.00", 1.005, "1.01", ""},
+		{"#,##0", 1234567, "1,234,567", ""},
+		{"#,##0.00", -1234.5, "-1,234.50", ""},
+		{"#,##0,", 1234567, "1,235", ""},
+		{"0.0,,\"M\"", 12345678, "12.3M", ""},
+		{"0%", 0.125, "13%", ""},
+		{"0.00%", 0.5, "50.00%", ""},
+		{"0.00E+00", 12345, "1.23E+04", ""},
+		{"0.00E+00", 0.00012, "1.20E-04", ""},
+		{"##0.0E+0", 12345, "12.3E+3", ""},
+		{"# ?/?", 1.5, "1 1/2", ""},
+		{"# ??/??", 3.14159, "3 14/99", ""},
+		{"?/8", 0.3, "2/8", ""},
+		{"# ?/?", 2, "2    ", ""},
+		{"0.##", 1.5, "1.5", ""},
+		{"0.0#", 2, "2.0", ""},
+		{"000-00-0000", 123456789, "123-45-6789", ""},
+		{`"$"#,##0.00_);[Red]("$"#,##0.00)`, -5, "($5.00)", "FF0000"},
+		{`"$"#,##0.00_);[Red]("$"#,##0.00)`, 5, "$5.00 ", ""},
+		{`[$€-407]#,##0.00`, 1234.5, "€1,234.50", ""},
+		{`_(* #,##0_);_(* \(#,##0\);_(* "-"_);_(@_)`, 0, " - ", ""},
+		{`[Blue][>=1000]#,##0;[Red][<0]0;0.0`, 1500, "1,500", "0000FF"},
+		{`[Blue][>=1000]#,##0;[Red][<0]0;0.0`, -3, "3", "FF0000"},
+		{`[Blue][>=1000]#,##0;[Red][<0]0;0.0`, 5, "5.0", ""},
+		{"[Color10]0", 1, "1", "008000"},
+		{"0;-0;\"zero\"", 0, "zero", ""},
+		{"yyyy-mm-dd", 45352, "2024-03-01", ""},
+		{"m/d/yy", 60, "2/29/00", ""},
+		{"d-mmm-yy", 45352.75, "1-Mar-24", ""},
+		{"dddd, mmmm d, yyyy", 45352, "Friday, March 1, 2024", ""},
+		{"h:mm AM/PM", 0.75, "6:00 PM", ""},
+		{"hh:mm:ss", 0.5 + 1.0/86400, "12:00:01", ""},
+		{"[h]:mm:ss", 1.5, "36:00:00", ""},
+		{"mm:ss.0", 1.0 / 86400 * 61.25, "01:01.3", ""},
+		{"yyyy-mm-dd", -1, "#####", ""},
+		{"[$-F800]dddd, mmmm dd, yyyy", 45352, "Friday, March 1, 2024", ""},
+	}
+	for _, tt := range tests {
+		got, color := Number(tt.v, tt.code)
+		if got != tt.want || color != tt.color {
+			t.Errorf("Number(%v, %q) = %q, %q; want %q, %q", tt.v, tt.code, got, color, tt.want, tt.color)
+		}
+	}
+}
+
+func TestText(t *testing.T) {
+	tests := []struct{ code, s, want string }{
+		{"@", "abc", "abc"},
+		{`"Name: "@`, "Ann", "Name: Ann"},
+		{`0;-0;0;"<"@">"`, "x", "<x>"},
+		{"0.00", "abc", "abc"},
+	}
+	for _, tt := range tests {
+		if got, _ := Text(tt.s, tt.code); got != tt.want {
+			t.Errorf("Text(%q, %q) = %q; want %q", tt.s, tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestIsDate(t *testing.T) {
+	for code, want := range map[string]bool{
+		"m/d/yy": true, "[h]:mm": true, "0.00": false, `"y"0`: false, "[Red]General": false, "mm:ss.0": true,
+	} {
+		if got := IsDate(code); got != want {
+			t.Errorf("IsDate(%q) = %v; want %v", code, got, want)
+		}
+	}
+	for code, want := range map[string][2]bool{
+		"d-mmm-yy": {true, false}, "h:mm": {false, false}, "[h]:mm:ss": {false, true}, "mm:ss": {false, false},
+	} {
+		if f := Parse(code); f.IsCalendar() != want[0] || f.IsElapsed() != want[1] {
+			t.Errorf("%q: IsCalendar %v, IsElapsed %v; want %v", code, f.IsCalendar(), f.IsElapsed(), want)
+		}
+	}
+	if code, ok := Builtin(14); !ok || code != "m/d/yy" {
+		t.Errorf("Builtin(14) = %q, %v", code, ok)
+	}
+}
+
+func TestTime(t *testing.T) {
+	tests := []struct {
+		v        float64
+		date1904 bool
+		want     time.Time
+	}{
+		{1, false, time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{59.5, false, time.Date(1900, 2, 28, 12, 0, 0, 0, time.UTC)},
+		{61, false, time.Date(1900, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{45352.75, false, time.Date(2024, 3, 1, 18, 0, 0, 0, time.UTC)},
+		{0, true, time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{45352.75 - Days1904, true, time.Date(2024, 3, 1, 18, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := Time(tt.v, tt.date1904); !got.Equal(tt.want) {
+			t.Errorf("Time(%v, %t) = %v; want %v", tt.v, tt.date1904, got, tt.want)
+		}
+	}
+}
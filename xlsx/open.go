@@ -0,0 +1,134 @@
+package xlsx
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/aerissecure/convert/diag"
+	"github.com/aerissecure/convert/internal/panics"
+	"github.com/aerissecure/convert/internal/safezip"
+)
+
+// -----------------------------------------------------------------------------
+// On-demand sheet parsing
+// -----------------------------------------------------------------------------
+//
+// OpenWorkbook reads only the workbook-level parts (the sheet list, shared
+// strings, styles and theme) and parses each sheet when it is first asked
+// for, so a preview of one sheet of a large workbook does not pay for the
+// others.  Sheets are read as the Native backend reads them.
+
+// ErrNoSheet is returned by Workbook.Sheet for a name the workbook has no
+// worksheet by.
+var ErrNoSheet = errors.New("xlsx: no such sheet")
+
+// Workbook is a workbook opened with OpenWorkbook.  It reads from the
+// io.ReaderAt it was opened with, which must stay valid while it is used.
+// It is safe for concurrent use.
+type Workbook struct {
+	mu       sync.Mutex
+	names    []string
+	read     func(i int) (RenderSheet, error)
+	parsed   []*RenderSheet // by index in names, nil until read
+	warnings func() []diag.Warning
+}
+
+// OpenWorkbook opens the XLSX or XLS workbook in r/size for reading sheet
+// by sheet.
+func OpenWorkbook(r io.ReaderAt, size int64) (_ *Workbook, err error) {
+	defer panics.Catch(&err)
+	if IsXLS(r, size) {
+		bk, err := openXLS(r, size)
+		if err != nil {
+			return nil, err
+		}
+		sheets := bk.worksheets()
+		w := &Workbook{
+			read:     func(i int) (RenderSheet, error) { return bk.readSheet(sheets[i]), nil },
+			warnings: func() []diag.Warning { return nil },
+		}
+		for _, sh := range sheets {
+			w.names = append(w.names, sh.name)
+		}
+		w.parsed = make([]*RenderSheet, len(sheets))
+		return w, nil
+	}
+	zr, err := safezip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	p := newNativeParser(zr)
+	if err := p.open(); err != nil {
+		return nil, err
+	}
+	w := &Workbook{
+		read:     func(i int) (RenderSheet, error) { return p.readSheet(p.sheets[i]) },
+		warnings: func() []diag.Warning { return p.warnings },
+	}
+	for _, s := range p.sheets {
+		w.names = append(w.names, s.name)
+	}
+	w.parsed = make([]*RenderSheet, len(p.sheets))
+	return w, nil
+}
+
+// SheetNames returns the names of the worksheets in workbook order,
+// without parsing them.
+func (w *Workbook) SheetNames() []string {
+	return append([]string(nil), w.names...)
+}
+
+// Sheet returns the worksheet named name, compared as Excel does, without
+// regard to case.  It is parsed on the first call; later calls return the
+// same *RenderSheet.
+func (w *Workbook) Sheet(name string) (_ *RenderSheet, err error) {
+	defer panics.Catch(&err)
+	for i, n := range w.names {
+		if strings.EqualFold(n, name) {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			return w.sheet(i)
+		}
+	}
+	return nil, ErrNoSheet
+}
+
+// Model parses the sheets not read yet and returns the whole workbook, as
+// the Native backend does.
+func (w *Workbook) Model() (_ WorkbookModel, err error) {
+	defer panics.Catch(&err)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var m WorkbookModel
+	for i := range w.names {
+		rs, err := w.sheet(i)
+		if err != nil {
+			return WorkbookModel{}, err
+		}
+		m.Sheets = append(m.Sheets, *rs)
+	}
+	m.Warnings = append([]diag.Warning(nil), w.warnings()...)
+	return m, nil
+}
+
+// Warnings returns the warnings of the sheets parsed so far.
+func (w *Workbook) Warnings() []diag.Warning {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]diag.Warning(nil), w.warnings()...)
+}
+
+// sheet returns sheet i, parsing it if needed.  w.mu is held.
+func (w *Workbook) sheet(i int) (*RenderSheet, error) {
+	if rs := w.parsed[i]; rs != nil {
+		return rs, nil
+	}
+	rs, err := w.read(i)
+	if err != nil {
+		return nil, err
+	}
+	w.parsed[i] = &rs
+	return &rs, nil
+}
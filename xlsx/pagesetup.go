@@ -0,0 +1,102 @@
+package xlsx
+
+import (
+	"strconv"
+	"strings"
+)
+
+// paperSizes maps the common ST_PaperSize codes to portrait width and
+// height in points.
+var paperSizes = map[uint32][2]float64{
+	1:  {612, 792},         // Letter
+	3:  {792, 1224},        // Tabloid
+	5:  {612, 1008},        // Legal
+	7:  {522, 756},         // Executive
+	8:  {841.89, 1190.55},  // A3
+	9:  {595.28, 841.89},   // A4
+	11: {419.53, 595.28},   // A5
+	12: {728.5, 1031.81},   // B4 (JIS)
+	13: {515.91, 728.5},    // B5 (JIS)
+	66: {1190.55, 1683.78}, // A2
+}
+
+// defaultPageSetup is Excel's layout for a sheet without page setup: US
+// Letter portrait with its "Normal" margins.
+func defaultPageSetup() PageSetup {
+	return PageSetup{
+		PageWidthPt: 612, PageHeightPt: 792,
+		MarginTopPt: 54, MarginBottomPt: 54, MarginLeftPt: 50.4, MarginRightPt: 50.4,
+		Scale: 100,
+	}
+}
+
+// applyDefinedName sets the print area or titles of ps from the sheet's
+// defined name, if it is one of those.
+func applyDefinedName(ps *PageSetup, name, content string) {
+	switch name {
+	case "_xlnm.Print_Area":
+		// Only the first area of a multi-area print range is printed.
+		first, _, _ := strings.Cut(content, ",")
+		if r, ok := parseCellRange(first); ok {
+			ps.PrintArea = &r
+		}
+	case "_xlnm.Print_Titles":
+		for _, part := range strings.Split(content, ",") {
+			rows, rng, ok := parseTitleRange(part)
+			switch {
+			case !ok:
+			case rows:
+				ps.TitleRows = &rng
+			default:
+				ps.TitleCols = &rng
+			}
+		}
+	}
+}
+
+// stripSheet removes the sheet name and absolute markers from a defined
+// name's reference, e.g. "'My Sheet'!$A$1:$C$9" becomes "A1:C9".
+func stripSheet(ref string) string {
+	if i := strings.LastIndex(ref, "!"); i >= 0 {
+		ref = ref[i+1:]
+	}
+	return strings.ReplaceAll(strings.TrimSpace(ref), "$", "")
+}
+
+// parseCellRange parses an "A1:C9" (or single cell) print area.
+func parseCellRange(ref string) (CellRange, bool) {
+	ref = stripSheet(ref)
+	if !strings.Contains(ref, ":") {
+		ref += ":" + ref
+	}
+	from, to, err := parseRangeRef(ref)
+	if err != nil {
+		return CellRange{}, false
+	}
+	return CellRange{
+		FirstRow: from.row, FirstCol: from.col,
+		LastRow: to.row, LastCol: to.col,
+	}, true
+}
+
+// parseTitleRange parses a print-titles part, "1:2" for rows or "A:B" for
+// columns, and reports which it is.
+func parseTitleRange(ref string) (rows bool, r IndexRange, ok bool) {
+	from, to, found := strings.Cut(stripSheet(ref), ":")
+	if !found || from == "" || to == "" {
+		return false, r, false
+	}
+	if from[0] >= '0' && from[0] <= '9' {
+		a, errA := strconv.Atoi(from)
+		b, errB := strconv.Atoi(to)
+		if errA != nil || errB != nil || a < 1 || b < a {
+			return false, r, false
+		}
+		return true, IndexRange{First: a - 1, Last: b - 1}, true
+	}
+	a, b := columnIndex(from), columnIndex(to)
+	if a < 0 || b < a {
+		return false, r, false
+	}
+	return false, IndexRange{First: a, Last: b}, true
+}
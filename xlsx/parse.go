@@ -1,3 +1,5 @@
+//go:build !nounioffice
+
 package xlsx
 
 import (
@@ -5,10 +7,13 @@ import (
 	"io"
 	"math"
 	"strconv"
-	"strings"
 
+	"github.com/aerissecure/convert/diag"
+	"github.com/aerissecure/convert/internal/panics"
+	"github.com/aerissecure/convert/internal/safezip"
 	"github.com/unidoc/unioffice/schema/soo/sml"
 	"github.com/unidoc/unioffice/spreadsheet"
+	"github.com/unidoc/unioffice/spreadsheet/format"
 	"github.com/unidoc/unioffice/spreadsheet/reference"
 )
 
@@ -99,8 +104,17 @@ func (s simpleTableStyle) contains(rowIdx, colIdx int) bool {
 	return rowIdx >= s.startRow && rowIdx <= s.endRow && colIdx >= s.startCol && colIdx <= s.endCol
 }
 
-// ParseWorkbookModel reads an XLSX from r/size and returns the intermediate representation.
-func ParseWorkbookModel(r io.ReaderAt, size int64) (WorkbookModel, error) {
+// parseWorkbookModel reads an XLSX from r/size with unioffice, formatting
+// values with nf.  Legacy XLS workbooks are detected and read with
+// ParseXLSWorkbookModel.
+func parseWorkbookModel(r io.ReaderAt, size int64, nf numberFormat) (WorkbookModel, error) {
+	if IsXLS(r, size) {
+		return parseXLS(r, size, nf)
+	}
+	zr, err := safezip.NewReader(r, size)
+	if err != nil {
+		return WorkbookModel{}, err
+	}
 	wb, err := spreadsheet.Read(r, size)
 	if err != nil {
 		return WorkbookModel{}, err
@@ -108,9 +122,34 @@ func ParseWorkbookModel(r io.ReaderAt, size int64) (WorkbookModel, error) {
 
 	var model WorkbookModel
 
+	// A panic, in unioffice or below, is attributed to the sheet and cell
+	// being read.
+	var sheetName string
+	var at *sml.CT_Cell
+	defer panics.Annotate(func() (string, string) {
+		if at != nil && at.RAttr != nil {
+			return sheetName, *at.RAttr
+		}
+		return sheetName, ""
+	})
+	warn := func(code diag.Code, ref, msg string) {
+		model.Warnings = append(model.Warnings, diag.Warning{Code: code, Location: diag.Location{Sheet: sheetName, Cell: ref}, Message: msg})
+	}
+
+	// Large workbooks repeat the same values many times over; the model
+	// holds one copy of each.
+	strs := make(interner)
+
+	// Pictures and comments are read from the package by the Native
+	// reader, opened for the first sheet with a drawing or a note.
+	var pkg *nativeParser
+
+	dxfs := uniofficeDxfs(wb)
+
 	// tableOffset tracks the position in wb.Tables() for each sheet
 	tableOffset := 0
-	for _, sheet := range wb.Sheets() {
+	for sheetIdx, sheet := range wb.Sheets() {
+		sheetName, at = sheet.Name(), nil
 		// Build table style infos for this sheet using correct table part mapping
 		var tblStyles []simpleTableStyle
 		if sheet.X().TableParts != nil {
@@ -121,6 +160,7 @@ func ParseWorkbookModel(r io.ReaderAt, size int64) (WorkbookModel, error) {
 				from, to, err := reference.ParseRangeReference(ref)
 				fmt.Println("from, to:", from, to)
 				if err != nil {
+					warn(diag.BadReference, ref, "table range: "+err.Error())
 					continue
 				}
 				styleInfo := tbl.X().TableStyleInfo
@@ -208,7 +248,8 @@ func ParseWorkbookModel(r io.ReaderAt, size int64) (WorkbookModel, error) {
 
 			rowHasContent := false
 			for _, cell := range row.Cells() {
-				if cell.GetFormattedValue() == "" {
+				at = cell.X()
+				if formattedValue(wb, cell, nf).text == "" {
 					continue
 				}
 
@@ -217,6 +258,11 @@ func ParseWorkbookModel(r io.ReaderAt, size int64) (WorkbookModel, error) {
 
 				colName, err := cell.Column()
 				if err != nil {
+					var ref string
+					if at.RAttr != nil {
+						ref = *at.RAttr
+					}
+					warn(diag.BadReference, ref, "cell: "+err.Error())
 					continue
 				}
 				colIdx := int(reference.ColumnToIndex(colName))
@@ -236,6 +282,7 @@ func ParseWorkbookModel(r io.ReaderAt, size int64) (WorkbookModel, error) {
 			for _, mc := range sheet.X().MergeCells.MergeCell {
 				_, to, err := reference.ParseRangeReference(mc.RefAttr)
 				if err != nil {
+					warn(diag.BadReference, mc.RefAttr, "merged range: "+err.Error())
 					continue
 				}
 				rowIdx := int(to.RowIdx - 1)
@@ -266,9 +313,9 @@ func ParseWorkbookModel(r io.ReaderAt, size int64) (WorkbookModel, error) {
 		for c := 0; c < maxCols; c++ {
 			colObj := sheet.Column(uint32(c + 1))
 			if colObj.X().CustomWidthAttr != nil && *colObj.X().CustomWidthAttr {
-				colWidths[c] = *colObj.X().WidthAttr * 8.3
+				colWidths[c] = *colObj.X().WidthAttr * pxPerChar
 			} else {
-				colWidths[c] = 8.43 * 8.3 // default approximation
+				colWidths[c] = defaultColChars * pxPerChar // default approximation
 			}
 			if colObj.X().HiddenAttr != nil {
 				colHidden[c] = *colObj.X().HiddenAttr
@@ -277,8 +324,13 @@ func ParseWorkbookModel(r io.ReaderAt, size int64) (WorkbookModel, error) {
 
 		rs := RenderSheet{
 			Name:      sheet.Name(),
+			Hidden:    wb.X().Sheets.Sheet[sheetIdx].StateAttr > sml.ST_SheetStateVisible,
 			ColWidths: colWidths,
 			ColHidden: colHidden,
+			PageSetup: readPageSetup(wb, sheet, sheetIdx),
+		}
+		if pr := sheet.X().SheetPr; pr != nil {
+			rs.TabColor, _ = resolveCTColor(pr.TabColor, wb)
 		}
 
 		// --- process merges ---
@@ -324,12 +376,13 @@ func ParseWorkbookModel(r io.ReaderAt, size int64) (WorkbookModel, error) {
 			rr.Cells = make([]*RenderCell, maxCols)
 			rr.Hidden = row.IsHidden()
 			if row.X().CustomHeightAttr != nil && *row.X().CustomHeightAttr {
-				rr.HeightPx = *row.X().HtAttr * 1.333 // pt -> px
+				rr.HeightPx = *row.X().HtAttr * pxPerPt
 			} else {
-				rr.HeightPx = 15.0 * 1.333 // Excel default 15pt
+				rr.HeightPx = defaultRowPt * pxPerPt
 			}
 
 			for _, cell := range row.Cells() {
+				at = cell.X()
 				colName, err := cell.Column()
 				if err != nil {
 					continue
@@ -372,6 +425,7 @@ func ParseWorkbookModel(r io.ReaderAt, size int64) (WorkbookModel, error) {
 					if border != nil && border.Left != nil && border.Left.Color != nil && border.Left.Color.RgbAttr != nil {
 						st.BorderColor = normalizeColor(*border.Left.Color.RgbAttr)
 					}
+					st.Borders = uniofficeBorders(border, wb)
 					if xf.Alignment != nil {
 						st.HorizontalAlign = xf.Alignment.HorizontalAttr.String()
 						switch xf.Alignment.VerticalAttr.String() {
@@ -386,7 +440,7 @@ func ParseWorkbookModel(r io.ReaderAt, size int64) (WorkbookModel, error) {
 							st.WrapText = *xf.Alignment.WrapTextAttr
 						}
 						if xf.Alignment.IndentAttr != nil {
-							st.IndentPx = float64(*xf.Alignment.IndentAttr) * 8.0
+							st.IndentPx = float64(*xf.Alignment.IndentAttr) * indentStepPx
 						}
 					}
 				}
@@ -418,10 +472,11 @@ func ParseWorkbookModel(r io.ReaderAt, size int64) (WorkbookModel, error) {
 					}
 				}
 
+				value := formattedValue(wb, cell, nf)
 				rc := &RenderCell{
 					Cell:  cell,
 					Ref:   fmt.Sprintf("%s%d", colName, rowIdx+1),
-					Value: cell.GetFormattedValue(),
+					Value: strs.intern(value.text),
 					// Runs will be populated below if rich text present
 					ColSpan: 1,
 					RowSpan: 1,
@@ -435,8 +490,7 @@ func ParseWorkbookModel(r io.ReaderAt, size int64) (WorkbookModel, error) {
 					// Prefer runs if present, else fallback on plain text T
 					if len(rt.R) > 0 {
 						for _, r := range rt.R {
-							text := r.T
-							run := RenderRun{Text: text}
+							run := RenderRun{Text: strs.intern(r.T)}
 							if rp := r.RPr; rp != nil {
 								if rp.RFont != nil {
 									run.FontFamily = rp.RFont.ValAttr
@@ -469,9 +523,17 @@ func ParseWorkbookModel(r io.ReaderAt, size int64) (WorkbookModel, error) {
 						}
 					} else if rt.T != nil {
 						// Single run of plain text; keep consistency
-						rc.Runs = []RenderRun{{Text: *rt.T}}
+						rc.Runs = []RenderRun{{Text: strs.intern(*rt.T)}}
 					}
 				}
+				value.set(rc)
+				formula := ""
+				if f := cell.X().F; f != nil {
+					formula = f.Content
+				}
+				if rc.Unsafe = unsafeCell(formula, rc.Value); rc.Unsafe != "" {
+					warn(diag.DangerousFormula, rc.Ref, "dangerous formula: "+rc.Unsafe)
+				}
 				// check if this cell is a merge master
 				if info, ok := mergeMaster[[2]int{rowIdx, colIdx}]; ok {
 					rc.RowSpan = info.rowSpan
@@ -488,6 +550,26 @@ func ParseWorkbookModel(r io.ReaderAt, size int64) (WorkbookModel, error) {
 			rs.Rows = append(rs.Rows, make([]RenderRow, lastContentRow+1-len(rs.Rows))...)
 		}
 
+		applyConditionalFormats(&rs, uniofficeConditionalFormats(sheet.X().ConditionalFormatting, wb), dxfs, warn)
+
+		if sheet.X().Drawing != nil || sheet.X().LegacyDrawing != nil {
+			if pkg == nil {
+				pkg = newNativeParser(zr)
+				if err := pkg.listSheets(); err != nil {
+					return WorkbookModel{}, err
+				}
+			}
+			for _, s := range pkg.sheets {
+				if s.index == sheetIdx {
+					if err := pkg.sheetObjects(s.part, &rs); err != nil {
+						return WorkbookModel{}, err
+					}
+					model.Warnings = append(model.Warnings, pkg.warnings...)
+					pkg.warnings = nil
+				}
+			}
+		}
+
 		model.Sheets = append(model.Sheets, rs)
 	}
 
@@ -518,12 +600,48 @@ func cellRichTextString(cell spreadsheet.Cell, w *spreadsheet.Workbook) *sml.CT_
 	return nil
 }
 
-// normalizeColor converts an 8-digit ARGB hex (as used in XLSX) to a 6-digit RGB string.
-// If the string is already 6 digits (or any other length), it is returned unchanged.
-func normalizeColor(hex string) string {
-	hex = strings.TrimPrefix(hex, "#")
-	if len(hex) == 8 {
-		return hex[2:]
+// formattedValue is cell.GetFormattedValue with the number formatting done
+// by nf, which unlike unioffice's engine knows all of Excel's format codes
+// and their colours.
+func formattedValue(wb *spreadsheet.Workbook, cell spreadsheet.Cell, nf numberFormat) cellValue {
+	code := "General"
+	if sid := cell.X().SAttr; sid != nil {
+		code = wb.StyleSheet.GetNumberFormat(wb.StyleSheet.GetCellStyle(*sid).NumberFormat()).GetFormat()
+	}
+	pr := wb.X().WorkbookPr
+	date1904 := pr != nil && pr.Date1904Attr != nil && *pr.Date1904Attr
+	number := func(raw string, v float64) cellValue {
+		text, color := nf.number(v, code, date1904)
+		return cellValue{text: text, color: color, raw: raw, code: formatCode(code)}
+	}
+	text := func(s string) cellValue {
+		text, color := nf.text(s, code)
+		return cellValue{text: text, color: color, raw: s, code: formatCode(code)}
+	}
+	switch cell.X().TAttr {
+	case sml.ST_CellTypeB, sml.ST_CellTypeE:
+		v := cell.GetFormattedValue()
+		return cellValue{text: v, raw: v}
+	case sml.ST_CellTypeN:
+		raw, _ := cell.GetRawValue()
+		v, _ := cell.GetValueAsNumber()
+		return number(raw, v)
+	case sml.ST_CellTypeS, sml.ST_CellTypeInlineStr:
+		return text(cell.GetString())
+	case sml.ST_CellTypeStr:
+		s := cell.GetString()
+		if !format.IsNumber(s) {
+			return text(s)
+		}
+		v, _ := strconv.ParseFloat(s, 64)
+		return number(s, v)
+	}
+	raw, _ := cell.GetRawValue()
+	if raw == "" {
+		return cellValue{}
+	}
+	if v, err := cell.GetValueAsNumber(); err == nil {
+		return number(raw, v)
 	}
-	return hex
+	return text(raw)
 }
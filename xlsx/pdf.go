@@ -0,0 +1,617 @@
+package xlsx
+
+import (
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aerissecure/convert/internal/pdf"
+)
+
+// -----------------------------------------------------------------------------
+// PDF output
+// -----------------------------------------------------------------------------
+//
+// RenderWorkbookPDF prints a workbook the way Excel's "Print entire
+// workbook" would, without needing Excel or LibreOffice: each sheet's print
+// area (or used range) is split into pages of the sheet's paper size and
+// margins, scaled by its print scale or fit-to-page setting, with the print
+// title rows and columns repeated on every page.  Pages are ordered down,
+// then over unless the sheet asks for over, then down.  Text uses the
+// standard PDF fonts (see pdf.FontFor), so metrics differ slightly from the
+// workbook's fonts.  Headers, footers, images and charts are not printed.
+// The watermark and banner of RenderOptions are laid over every page, the
+// watermark in light grey since the pages are not transparent.
+
+const (
+	pxToPt      = 0.75
+	cellPadPt   = 2   // horizontal text padding inside a cell
+	lineSpacing = 1.2 // line height in em
+)
+
+// XLSXToPDF converts an XLSX (or legacy XLS) reader to PDF.
+func XLSXToPDF(w io.Writer, r io.ReaderAt, size int64) error {
+	m, err := ParseWorkbookModel(r, size)
+	if err != nil {
+		return err
+	}
+	return RenderWorkbookPDF(w, m)
+}
+
+// RenderWorkbookPDF writes the workbook as a paginated PDF.
+func RenderWorkbookPDF(w io.Writer, m WorkbookModel) error {
+	return RenderWorkbookPDFWith(w, m, RenderOptions{})
+}
+
+// RenderWorkbookPDFWith is RenderWorkbookPDF with opts.Watermark and
+// opts.Banner on every page.  The other options only apply to HTML.
+func RenderWorkbookPDFWith(w io.Writer, m WorkbookModel, opts RenderOptions) error {
+	doc := pdf.New()
+	for _, s := range m.Sheets {
+		renderSheetPDF(doc, s)
+	}
+	if doc.Pages() == 0 {
+		ps := defaultPageSetup()
+		doc.AddPage(ps.PageWidthPt, ps.PageHeightPt) // a PDF needs a page
+	}
+	for i := range doc.Pages() {
+		overlayPDF(doc.Page(i), opts.Watermark, opts.Banner)
+	}
+	_, err := doc.WriteTo(w)
+	return err
+}
+
+// overlayPDF draws watermark diagonally across page and banner in a bar
+// along its top edge, either if set, styled like the HTML overlays.
+func overlayPDF(page *pdf.Page, watermark, banner string) {
+	width, height := page.Size()
+	if watermark != "" {
+		const size, angle = 36, 30
+		// Centre the text on the page, turned about its start.
+		tw := pdf.TextWidth(pdf.HelveticaBold, size, watermark)
+		sin, cos := math.Sincos(angle * math.Pi / 180)
+		x := width/2 - cos*tw/2 + sin*size/3
+		y := height/2 + sin*tw/2 + cos*size/3
+		page.RotatedText(x, y, angle, pdf.HelveticaBold, size, "DFDFDF", watermark)
+	}
+	if banner != "" {
+		const size, barH = 9, 16
+		page.FillRect(0, 0, width, barH, "B3261E")
+		tw := pdf.TextWidth(pdf.HelveticaBold, size, banner)
+		page.Text(max((width-tw)/2, cellPadPt), barH-(barH-size)/2-1, pdf.HelveticaBold, size, "FFFFFF", banner)
+	}
+}
+
+// sheetPrinter lays out one sheet.
+type sheetPrinter struct {
+	s       RenderSheet
+	ps      PageSetup
+	colW    []float64       // column widths in pt, 0 for hidden columns
+	rowH    []float64       // row heights in pt, 0 for hidden rows
+	covered map[[2]int]bool // cells hidden under a merged cell
+	scale   float64
+	page    *pdf.Page
+	cols    []int // columns on the current page, in order
+	rows    []int
+	xs, ys  []float64 // page position of cols[i] and rows[i]
+}
+
+func renderSheetPDF(doc *pdf.Document, s RenderSheet) {
+	ps := s.PageSetup
+	if ps.PageWidthPt <= 0 || ps.PageHeightPt <= 0 {
+		def := defaultPageSetup()
+		ps.PageWidthPt, ps.PageHeightPt = def.PageWidthPt, def.PageHeightPt
+		ps.MarginTopPt, ps.MarginRightPt, ps.MarginBottomPt, ps.MarginLeftPt = def.MarginTopPt, def.MarginRightPt, def.MarginBottomPt, def.MarginLeftPt
+	}
+	sp := &sheetPrinter{s: s, ps: ps, covered: make(map[[2]int]bool)}
+	sp.colW = make([]float64, len(s.ColWidths))
+	for c, w := range s.ColWidths {
+		if c >= len(s.ColHidden) || !s.ColHidden[c] {
+			sp.colW[c] = w * pxToPt
+		}
+	}
+	sp.rowH = make([]float64, len(s.Rows))
+	for r, row := range s.Rows {
+		if !row.Hidden {
+			sp.rowH[r] = row.HeightPx * pxToPt
+		}
+		for c, cell := range row.Cells {
+			if cell == nil || (cell.ColSpan <= 1 && cell.RowSpan <= 1) {
+				continue
+			}
+			for rr := r; rr < r+max(cell.RowSpan, 1); rr++ {
+				for cc := c; cc < c+max(cell.ColSpan, 1); cc++ {
+					if rr != r || cc != c {
+						sp.covered[[2]int{rr, cc}] = true
+					}
+				}
+			}
+		}
+	}
+
+	area := CellRange{LastRow: len(s.Rows) - 1, LastCol: len(s.ColWidths) - 1}
+	if pa := ps.PrintArea; pa != nil {
+		area = CellRange{FirstRow: max(pa.FirstRow, 0), FirstCol: max(pa.FirstCol, 0), LastRow: min(pa.LastRow, area.LastRow), LastCol: min(pa.LastCol, area.LastCol)}
+	}
+	if area.LastRow < area.FirstRow || area.LastCol < area.FirstCol || !sp.hasContent(area) {
+		return
+	}
+
+	titleRows := visible(ps.TitleRows, sp.rowH)
+	titleCols := visible(ps.TitleCols, sp.colW)
+	var bodyRows, bodyCols []int
+	for r := area.FirstRow; r <= area.LastRow; r++ {
+		if sp.rowH[r] > 0 && !slices.Contains(titleRows, r) {
+			bodyRows = append(bodyRows, r)
+		}
+	}
+	for c := area.FirstCol; c <= area.LastCol; c++ {
+		if sp.colW[c] > 0 && !slices.Contains(titleCols, c) {
+			bodyCols = append(bodyCols, c)
+		}
+	}
+
+	availW := ps.PageWidthPt - ps.MarginLeftPt - ps.MarginRightPt
+	availH := ps.PageHeightPt - ps.MarginTopPt - ps.MarginBottomPt
+	titleW, titleH := sum(titleCols, sp.colW), sum(titleRows, sp.rowH)
+	sp.scale = 1
+	if ps.Scale > 0 {
+		sp.scale = ps.Scale / 100
+	}
+	if ps.FitToPage {
+		sp.scale = 1 // fitting never enlarges
+		if ps.FitToWidth > 0 {
+			if total := titleW*float64(ps.FitToWidth) + sum(bodyCols, sp.colW); total > 0 {
+				sp.scale = min(sp.scale, availW*float64(ps.FitToWidth)/total)
+			}
+		}
+		if ps.FitToHeight > 0 {
+			if total := titleH*float64(ps.FitToHeight) + sum(bodyRows, sp.rowH); total > 0 {
+				sp.scale = min(sp.scale, availH*float64(ps.FitToHeight)/total)
+			}
+		}
+		sp.scale = max(sp.scale, 0.1)
+	}
+
+	colBands := paginate(bodyCols, sp.colW, availW/sp.scale-titleW)
+	rowBands := paginate(bodyRows, sp.rowH, availH/sp.scale-titleH)
+	emit := func(cb, rb []int) {
+		sp.printPage(doc, append(slices.Clone(titleCols), cb...), append(slices.Clone(titleRows), rb...))
+	}
+	if ps.OverThenDown {
+		for _, rb := range rowBands {
+			for _, cb := range colBands {
+				emit(cb, rb)
+			}
+		}
+		return
+	}
+	for _, cb := range colBands {
+		for _, rb := range rowBands {
+			emit(cb, rb)
+		}
+	}
+}
+
+// hasContent reports whether any cell in the range has a value or fill.
+func (sp *sheetPrinter) hasContent(a CellRange) bool {
+	for r := a.FirstRow; r <= a.LastRow; r++ {
+		for c := a.FirstCol; c <= a.LastCol && c < len(sp.s.Rows[r].Cells); c++ {
+			if cell := sp.s.Rows[r].Cells[c]; cell != nil && (cellText(cell) != "" || cell.Style.BackgroundColor != "") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// visible returns the non-hidden indexes of a title range.
+func visible(r *IndexRange, sizes []float64) []int {
+	var out []int
+	if r == nil {
+		return out
+	}
+	for i := max(r.First, 0); i <= r.Last && i < len(sizes); i++ {
+		if sizes[i] > 0 {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+func sum(idx []int, sizes []float64) float64 {
+	var t float64
+	for _, i := range idx {
+		t += sizes[i]
+	}
+	return t
+}
+
+// paginate splits idx into bands that fit into avail; an entry larger than
+// avail gets a band of its own.  There is always at least one band.
+func paginate(idx []int, sizes []float64, avail float64) [][]int {
+	var bands [][]int
+	var cur []int
+	used := 0.0
+	for _, i := range idx {
+		if len(cur) > 0 && used+sizes[i] > avail {
+			bands = append(bands, cur)
+			cur, used = nil, 0
+		}
+		cur = append(cur, i)
+		used += sizes[i]
+	}
+	return append(bands, cur)
+}
+
+// printPage draws the given rows and columns on a new page.
+func (sp *sheetPrinter) printPage(doc *pdf.Document, cols, rows []int) {
+	ps := sp.ps
+	sp.page = doc.AddPage(ps.PageWidthPt, ps.PageHeightPt)
+	sp.cols, sp.rows = cols, rows
+	x := ps.MarginLeftPt
+	if ps.CenterH {
+		x += (ps.PageWidthPt - ps.MarginLeftPt - ps.MarginRightPt - sum(cols, sp.colW)*sp.scale) / 2
+	}
+	sp.xs = make([]float64, len(cols)+1)
+	for i, c := range cols {
+		sp.xs[i] = x
+		x += sp.colW[c] * sp.scale
+	}
+	sp.xs[len(cols)] = x
+	y := ps.MarginTopPt
+	sp.ys = make([]float64, len(rows)+1)
+	for i, r := range rows {
+		sp.ys[i] = y
+		y += sp.rowH[r] * sp.scale
+	}
+	sp.ys[len(rows)] = y
+
+	// Fills first so borders and gridlines stay visible on top of them.
+	sp.eachCell(func(_, _ int, cell *RenderCell, x, y, w, h float64) {
+		if bg := cell.Style.BackgroundColor; bg != "" {
+			sp.page.FillRect(x, y, w, h, bg)
+		}
+	})
+	if ps.Gridlines {
+		sp.eachBox(func(x, y, w, h float64) { sp.strokeRect(x, y, w, h, "D0D0D0") })
+	}
+	sp.eachCell(func(_, _ int, cell *RenderCell, x, y, w, h float64) {
+		if b := cell.Style.Borders; !b.IsZero() {
+			sp.strokeBorders(x, y, w, h, b)
+		} else if bc := cell.Style.BorderColor; bc != "" {
+			sp.strokeRect(x, y, w, h, bc)
+		}
+	})
+	sp.eachCell(sp.drawIcon)
+	sp.eachCell(sp.drawText)
+}
+
+// iconSize returns the side of the square standing for a cell's
+// conditional formatting icon: the standard fonts have no glyphs for
+// icons, so it is drawn in the icon's colour before the text.
+func (sp *sheetPrinter) iconSize(cell *RenderCell) float64 {
+	size := cell.Style.FontSizePt
+	if size <= 0 {
+		size = defaultFontSizePt
+	}
+	return size * 0.7 * sp.scale
+}
+
+// drawIcon draws the conditional formatting icon of a cell.
+func (sp *sheetPrinter) drawIcon(_, _ int, cell *RenderCell, x, y, w, h float64) {
+	if cell.Icon == nil {
+		return
+	}
+	if _, color := cell.Icon.Shape(); color != "" {
+		s := sp.iconSize(cell)
+		sp.page.FillRect(x+cellPadPt*sp.scale, y+(h-s)/2, s, s, color)
+	}
+}
+
+// eachCell calls fn with the page box of every cell on the page.  A merged
+// cell's box spans the merged columns and rows that are on the page.
+func (sp *sheetPrinter) eachCell(fn func(ri, ci int, cell *RenderCell, x, y, w, h float64)) {
+	for ri, r := range sp.rows {
+		for ci, c := range sp.cols {
+			if c >= len(sp.s.Rows[r].Cells) || sp.s.Rows[r].Cells[c] == nil {
+				continue
+			}
+			cell := sp.s.Rows[r].Cells[c]
+			w, h := sp.span(ci, c, cell.ColSpan, sp.cols, sp.xs), sp.span(ri, r, cell.RowSpan, sp.rows, sp.ys)
+			fn(ri, ci, cell, sp.xs[ci], sp.ys[ri], w, h)
+		}
+	}
+}
+
+// eachBox calls fn with the box of every grid position not covered by a
+// merge, merged cells counting as one box.
+func (sp *sheetPrinter) eachBox(fn func(x, y, w, h float64)) {
+	for ri, r := range sp.rows {
+		for ci, c := range sp.cols {
+			if sp.covered[[2]int{r, c}] {
+				continue
+			}
+			w, h := sp.xs[ci+1]-sp.xs[ci], sp.ys[ri+1]-sp.ys[ri]
+			if c < len(sp.s.Rows[r].Cells) && sp.s.Rows[r].Cells[c] != nil {
+				cell := sp.s.Rows[r].Cells[c]
+				w, h = sp.span(ci, c, cell.ColSpan, sp.cols, sp.xs), sp.span(ri, r, cell.RowSpan, sp.rows, sp.ys)
+			}
+			fn(sp.xs[ci], sp.ys[ri], w, h)
+		}
+	}
+}
+
+// span returns the extent of a merge of n entries starting at sheet index
+// idx, found at position pos of the page's entries.
+func (sp *sheetPrinter) span(pos, idx, n int, entries []int, offsets []float64) float64 {
+	end := pos + 1
+	for end < len(entries) && entries[end] > entries[end-1] && entries[end] < idx+max(n, 1) {
+		end++
+	}
+	return offsets[end] - offsets[pos]
+}
+
+func (sp *sheetPrinter) strokeRect(x, y, w, h float64, color string) {
+	const lw = 0.5
+	sp.page.Line(x, y, x+w, y, lw, color)
+	sp.page.Line(x, y+h, x+w, y+h, lw, color)
+	sp.page.Line(x, y, x, y+h, lw, color)
+	sp.page.Line(x+w, y, x+w, y+h, lw, color)
+}
+
+// strokeBorders draws the sides of a cell's border that have a line.  A
+// thin line is as wide as a gridline, a medium and a thick one two and
+// three times as wide; a double line is two thin ones.
+func (sp *sheetPrinter) strokeBorders(x, y, w, h float64, b Borders) {
+	const lw = 0.5
+	ends := map[string][4]float64{"top": {x, y, x + w, y}, "right": {x + w, y, x + w, y + h}, "bottom": {x, y + h, x + w, y + h}, "left": {x, y, x, y + h}}
+	for _, side := range borderSides(b) {
+		if side.Style == "" {
+			continue
+		}
+		color := side.Color
+		if color == "" {
+			color = "000000"
+		}
+		e := ends[side.name]
+		switch side.Style {
+		case "dashed":
+			sp.page.DashedLine(e[0], e[1], e[2], e[3], lw, color, 3, 1.5)
+		case "dotted":
+			sp.page.DashedLine(e[0], e[1], e[2], e[3], lw, color, lw, lw)
+		case "double":
+			// The second line is drawn inside the cell.
+			dx, dy := 0.0, 0.0
+			switch side.name {
+			case "top":
+				dy = 2 * lw
+			case "right":
+				dx = -2 * lw
+			case "bottom":
+				dy = -2 * lw
+			case "left":
+				dx = 2 * lw
+			}
+			sp.page.Line(e[0], e[1], e[2], e[3], lw, color)
+			sp.page.Line(e[0]+dx, e[1]+dy, e[2]+dx, e[3]+dy, lw, color)
+		default:
+			sp.page.Line(e[0], e[1], e[2], e[3], lw*borderWidthPx(side.Style), color)
+		}
+	}
+}
+
+// textPiece is a run of text in one format.
+type textPiece struct {
+	text              string
+	font              pdf.Font
+	size              float64 // pt, already scaled
+	color             string
+	underline, strike bool
+	rise              float64 // baseline shift for super- and subscript
+}
+
+func (t textPiece) width() float64 {
+	return pdf.TextWidth(t.font, t.size, t.text)
+}
+
+// pieces returns the formatted text of a cell.
+func (sp *sheetPrinter) pieces(cell *RenderCell) []textPiece {
+	st := cell.Style
+	family, size, color := st.FontFamily, st.FontSizePt, st.FontColor
+	if size <= 0 {
+		size = defaultFontSizePt
+	}
+	if color == "" {
+		color = "000000"
+	}
+	if len(cell.Runs) == 0 {
+		return []textPiece{{text: cell.Value, font: pdf.FontFor(family, false, false), size: size * sp.scale, color: color}}
+	}
+	var out []textPiece
+	for _, r := range cell.Runs {
+		p := textPiece{text: r.Text, size: size, color: color, underline: r.Underline, strike: r.Strike}
+		f := family
+		if r.FontFamily != "" {
+			f = r.FontFamily
+		}
+		if r.FontSizePt > 0 {
+			p.size = r.FontSizePt
+		}
+		if r.FontColor != "" {
+			p.color = r.FontColor
+		}
+		switch r.VerticalAlign {
+		case "superscript":
+			p.rise = -p.size * 0.33
+			p.size *= 0.7
+		case "subscript":
+			p.rise = p.size * 0.15
+			p.size *= 0.7
+		}
+		p.font = pdf.FontFor(f, r.Bold, r.Italic)
+		p.size *= sp.scale
+		p.rise *= sp.scale
+		out = append(out, p)
+	}
+	return out
+}
+
+// lines breaks pieces at newlines and, when wrap is set, at spaces so each
+// line fits into width.
+func lines(pieces []textPiece, wrap bool, width float64) [][]textPiece {
+	out := [][]textPiece{nil}
+	used := 0.0
+	for _, p := range pieces {
+		for i, part := range strings.Split(p.text, "\n") {
+			if i > 0 {
+				out = append(out, nil)
+				used = 0
+			}
+			words := []string{part}
+			if wrap {
+				words = strings.SplitAfter(part, " ")
+			}
+			for _, word := range words {
+				q := p
+				q.text = word
+				w := q.width()
+				if wrap && used > 0 && used+pdf.TextWidth(q.font, q.size, strings.TrimRight(word, " ")) > width {
+					out = append(out, nil)
+					used = 0
+				}
+				out[len(out)-1] = append(out[len(out)-1], q)
+				used += w
+			}
+		}
+	}
+	return out
+}
+
+// drawText draws the value of a cell aligned in its box.  Unwrapped
+// left-aligned text flows into empty cells to its right, like in Excel.
+func (sp *sheetPrinter) drawText(ri, ci int, cell *RenderCell, x, y, w, h float64) {
+	if cellText(cell) == "" || cell.Icon != nil && cell.Icon.HideValue {
+		return
+	}
+	st := cell.Style
+	pad := cellPadPt * sp.scale
+	indent := st.IndentPx * pxToPt * sp.scale
+	if cell.Icon != nil {
+		indent += sp.iconSize(cell) + pad
+	}
+	ls := lines(sp.pieces(cell), st.WrapText, w-2*pad-indent)
+
+	align := st.HorizontalAlign
+	if align == "" || align == "general" {
+		align = "left"
+		if len(cell.Runs) == 0 && looksNumeric(cell.Value) {
+			align = "right"
+		}
+	}
+
+	clipW := w
+	if !st.WrapText && align == "left" {
+		need := pad + indent
+		for _, p := range ls[0] {
+			need += p.width()
+		}
+		for next := ci + max(cell.ColSpan, 1); clipW < need && next < len(sp.cols) && sp.emptyAt(sp.rows[ri], sp.cols[next]); next++ {
+			clipW = sp.xs[next+1] - x
+		}
+	}
+
+	var lineH []float64
+	total := 0.0
+	for _, l := range ls {
+		lh := defaultFontSizePt * sp.scale * lineSpacing
+		for i, p := range l {
+			if i == 0 || p.size*lineSpacing > lh {
+				lh = p.size * lineSpacing
+			}
+		}
+		lineH = append(lineH, lh)
+		total += lh
+	}
+	top := y + h - total - 1*sp.scale // bottom
+	switch st.VerticalAlign {
+	case "top":
+		top = y + 1*sp.scale
+	case "middle":
+		top = y + (h-total)/2
+	}
+
+	sp.page.Clip(x, y, clipW, h)
+	for i, l := range ls {
+		lw := 0.0
+		for _, p := range l {
+			lw += p.width()
+		}
+		if align != "left" {
+			lw -= trailingSpace(l)
+		}
+		lx := x + pad + indent
+		switch align {
+		case "center", "centerContinuous":
+			lx = x + (w-lw)/2
+		case "right":
+			lx = x + w - pad - indent - lw
+		}
+		base := top + lineH[i]/lineSpacing*0.85
+		for _, p := range l {
+			pw := p.width()
+			if p.text != "" {
+				sp.page.Text(lx, base+p.rise, p.font, p.size, p.color, p.text)
+			}
+			if p.underline {
+				sp.page.Line(lx, base+p.size*0.12, lx+pw, base+p.size*0.12, p.size*0.06, p.color)
+			}
+			if p.strike {
+				sp.page.Line(lx, base-p.size*0.3, lx+pw, base-p.size*0.3, p.size*0.06, p.color)
+			}
+			lx += pw
+		}
+		top += lineH[i]
+	}
+	sp.page.Restore()
+}
+
+// emptyAt reports whether a cell holds no text, so text may overflow
+// into it.
+func (sp *sheetPrinter) emptyAt(r, c int) bool {
+	if sp.covered[[2]int{r, c}] {
+		return false
+	}
+	row := sp.s.Rows[r]
+	return c >= len(row.Cells) || row.Cells[c] == nil || cellText(row.Cells[c]) == ""
+}
+
+func trailingSpace(l []textPiece) float64 {
+	if len(l) == 0 {
+		return 0
+	}
+	p := l[len(l)-1]
+	return p.width() - pdf.TextWidth(p.font, p.size, strings.TrimRight(p.text, " "))
+}
+
+// cellText returns the plain text of a cell.
+func cellText(cell *RenderCell) string {
+	if len(cell.Runs) == 0 {
+		return cell.Value
+	}
+	var sb strings.Builder
+	for _, r := range cell.Runs {
+		sb.WriteString(r.Text)
+	}
+	return sb.String()
+}
+
+// looksNumeric reports whether a formatted value is a number, which Excel
+// right-aligns under the General alignment.
+func looksNumeric(v string) bool {
+	v = strings.NewReplacer(",", "", "%", "", "$", "", "€", "", "£", "", "(", "-", ")", "").Replace(strings.TrimSpace(v))
+	_, err := strconv.ParseFloat(v, 64)
+	return err == nil
+}
@@ -0,0 +1,146 @@
+package xlsx
+
+// -----------------------------------------------------------------------------
+// Sanitization
+// -----------------------------------------------------------------------------
+
+// SanitizeWorkbook removes from m, in place, what a workbook shared outside
+// the organisation should not carry: hidden sheets, hidden rows and hidden
+// columns.  The remaining cells move up and left to close the gaps and
+// their Refs follow; merged cells shrink to their visible part, and the
+// print area and print titles are adjusted.  Cell comments are removed,
+// and RenderCell.Cell is cleared, since it refers back to the source
+// workbook with its formulas, comments and properties.
+//
+// Use it between ParseWorkbookModel and RenderWorkbookHTML or
+// WriteWorkbook.
+func SanitizeWorkbook(m *WorkbookModel) {
+	sheets := m.Sheets[:0]
+	for _, s := range m.Sheets {
+		if !s.Hidden {
+			sanitizeSheet(&s)
+			sheets = append(sheets, s)
+		}
+	}
+	m.Sheets = sheets
+}
+
+// sanitizeSheet removes the hidden rows and columns of s.
+func sanitizeSheet(s *RenderSheet) {
+	_, cols := sheetExtent(s)
+	colHidden := func(c int) bool { return c < len(s.ColHidden) && s.ColHidden[c] }
+
+	// rowMap and colMap give the new index of each old row and column, -1
+	// for those removed.
+	rowMap := make([]int, len(s.Rows))
+	var keptRows []int
+	for r, row := range s.Rows {
+		rowMap[r] = -1
+		if !row.Hidden {
+			rowMap[r] = len(keptRows)
+			keptRows = append(keptRows, r)
+		}
+	}
+	colMap := make([]int, cols)
+	var keptCols []int
+	for c := range cols {
+		colMap[c] = -1
+		if !colHidden(c) {
+			colMap[c] = len(keptCols)
+			keptCols = append(keptCols, c)
+		}
+	}
+
+	rows := make([]RenderRow, len(keptRows))
+	for i, r := range keptRows {
+		rows[i] = RenderRow{HeightPx: s.Rows[r].HeightPx, Cells: make([]*RenderCell, len(keptCols))}
+	}
+	for r, row := range s.Rows {
+		for c, cell := range row.Cells {
+			if cell == nil {
+				continue
+			}
+			// A merged cell moves to the first visible row and column of
+			// its area and spans the visible ones.
+			nr, rowSpan := spanMap(rowMap, r, max(cell.RowSpan, 1))
+			nc, colSpan := spanMap(colMap, c, max(cell.ColSpan, 1))
+			if rowSpan == 0 || colSpan == 0 {
+				continue
+			}
+			cell.RowSpan, cell.ColSpan = rowSpan, colSpan
+			cell.Ref = cellName(nr, nc)
+			cell.Cell, cell.Comments = nil, nil
+			rows[nr].Cells[nc] = cell
+		}
+	}
+	s.Rows = rows
+
+	widths := make([]float64, len(keptCols))
+	for i, c := range keptCols {
+		if c < len(s.ColWidths) {
+			widths[i] = s.ColWidths[c]
+		}
+	}
+	s.ColWidths = widths
+	s.ColHidden = make([]bool, len(keptCols))
+
+	// Pictures anchored in a hidden row or column are removed with it.
+	images := s.Images[:0]
+	for _, img := range s.Images {
+		r, c := mapIndex(rowMap, len(keptRows), img.Row), mapIndex(colMap, len(keptCols), img.Col)
+		if r >= 0 && c >= 0 {
+			img.Row, img.Col = r, c
+			images = append(images, img)
+		}
+	}
+	s.Images = images
+
+	ps := &s.PageSetup
+	if pa := ps.PrintArea; pa != nil {
+		fr, nr := spanMap(rowMap, pa.FirstRow, pa.LastRow-pa.FirstRow+1)
+		fc, nc := spanMap(colMap, pa.FirstCol, pa.LastCol-pa.FirstCol+1)
+		ps.PrintArea = nil
+		if nr > 0 && nc > 0 {
+			ps.PrintArea = &CellRange{FirstRow: fr, FirstCol: fc, LastRow: fr + nr - 1, LastCol: fc + nc - 1}
+		}
+	}
+	ps.TitleRows = remapIndexRange(ps.TitleRows, rowMap)
+	ps.TitleCols = remapIndexRange(ps.TitleCols, colMap)
+}
+
+// spanMap maps the n indexes from first through m, returning the new index
+// of the first kept one and the number kept.
+func spanMap(m []int, first, n int) (start, kept int) {
+	start = -1
+	for i := first; i < first+n && i < len(m); i++ {
+		if i < 0 || m[i] < 0 {
+			continue
+		}
+		if start < 0 {
+			start = m[i]
+		}
+		kept++
+	}
+	return start, kept
+}
+
+// mapIndex maps index i through m, which keeps kept indexes; indexes past
+// m move back by the number removed.  It returns -1 for a removed index.
+func mapIndex(m []int, kept, i int) int {
+	if i < len(m) {
+		return m[i]
+	}
+	return i - len(m) + kept
+}
+
+// remapIndexRange maps r through m; it returns nil when no index is kept.
+func remapIndexRange(r *IndexRange, m []int) *IndexRange {
+	if r == nil {
+		return nil
+	}
+	first, n := spanMap(m, r.First, r.Last-r.First+1)
+	if n == 0 {
+		return nil
+	}
+	return &IndexRange{First: first, Last: first + n - 1}
+}
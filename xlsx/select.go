@@ -0,0 +1,103 @@
+package xlsx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// -----------------------------------------------------------------------------
+// Sheet and range selection
+// -----------------------------------------------------------------------------
+
+// Select returns the part of m to render for a single tab or region: the
+// sheets named in sheets, in workbook order, or all of them if it is
+// empty, each cut down to the A1-style range rng, e.g. "A1:F40", if that is
+// set.  Names compare without regard to case, as in Excel; a name m has no
+// sheet by fails with ErrNoSheet.
+//
+// The result shares its cells with m, which is left unmodified, so one
+// parsed model can be selected from by several goroutines at once.  Merged
+// cells reaching past the range are copied and clipped to it.
+func Select(m WorkbookModel, sheets []string, rng string) (WorkbookModel, error) {
+	if len(sheets) == 0 && rng == "" {
+		return m, nil
+	}
+	out := m
+	if len(sheets) > 0 {
+		out.Sheets = nil
+		found := make([]bool, len(sheets))
+		for _, sheet := range m.Sheets {
+			for i, name := range sheets {
+				if strings.EqualFold(sheet.Name, name) {
+					out.Sheets = append(out.Sheets, sheet)
+					found[i] = true
+					break
+				}
+			}
+		}
+		for i, ok := range found {
+			if !ok {
+				return WorkbookModel{}, fmt.Errorf("%w: %q", ErrNoSheet, sheets[i])
+			}
+		}
+	}
+	if rng == "" {
+		return out, nil
+	}
+	ref := rng
+	if !strings.Contains(ref, ":") {
+		ref += ":" + ref // a single cell
+	}
+	from, to, err := parseRangeRef(ref)
+	if err != nil {
+		return WorkbookModel{}, fmt.Errorf("xlsx: range %q: %w", rng, err)
+	}
+	r1, r2 := min(from.row, to.row), max(from.row, to.row)
+	c1, c2 := min(from.col, to.col), max(from.col, to.col)
+	out.Sheets = append([]RenderSheet(nil), out.Sheets...)
+	for i := range out.Sheets {
+		out.Sheets[i] = cropSheet(out.Sheets[i], r1, c1, r2, c2)
+	}
+	return out, nil
+}
+
+// cropSheet returns the rows r1 to r2 and columns c1 to c2 of s, all
+// 0-based and inclusive.  Pictures anchored in the range are kept.
+func cropSheet(s RenderSheet, r1, c1, r2, c2 int) RenderSheet {
+	clip := func(n, lo, hi int) (int, int) {
+		return min(lo, n), min(hi+1, n)
+	}
+	lo, hi := clip(len(s.ColWidths), c1, c2)
+	s.ColWidths = s.ColWidths[lo:hi]
+	lo, hi = clip(len(s.ColHidden), c1, c2)
+	s.ColHidden = s.ColHidden[lo:hi]
+	lo, hi = clip(len(s.Rows), r1, r2)
+	rows := make([]RenderRow, hi-lo)
+	for i, row := range s.Rows[lo:hi] {
+		clo, chi := clip(len(row.Cells), c1, c2)
+		row.Cells = append([]*RenderCell(nil), row.Cells[clo:chi]...)
+		for j, cell := range row.Cells {
+			if cell == nil {
+				continue
+			}
+			r, c := lo+i, clo+j
+			if r+cell.RowSpan-1 > r2 || c+cell.ColSpan-1 > c2 {
+				clipped := *cell
+				clipped.RowSpan = min(cell.RowSpan, r2-r+1)
+				clipped.ColSpan = min(cell.ColSpan, c2-c+1)
+				row.Cells[j] = &clipped
+			}
+		}
+		rows[i] = row
+	}
+	s.Rows = rows
+	var images []SheetImage
+	for _, img := range s.Images {
+		if img.Row >= r1 && img.Row <= r2 && img.Col >= c1 && img.Col <= c2 {
+			img.Row, img.Col = img.Row-r1, img.Col-c1
+			images = append(images, img)
+		}
+	}
+	s.Images = images
+	return s
+}
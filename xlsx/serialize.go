@@ -0,0 +1,28 @@
+package xlsx
+
+import (
+	"io"
+
+	"github.com/aerissecure/convert/xlsx/ir"
+)
+
+// WorkbookModel serialization is implemented by package ir, so models can be
+// decoded without this package; see ir.Encode.
+
+// WorkbookModelVersion is the schema version written by EncodeWorkbookModel.
+const WorkbookModelVersion = ir.Version
+
+// ErrModelVersion is returned by DecodeWorkbookModel for an envelope of a
+// schema version this package cannot read.  It is ir.ErrVersion.
+var ErrModelVersion = ir.ErrVersion
+
+// EncodeWorkbookModel writes m to w as versioned JSON.
+func EncodeWorkbookModel(w io.Writer, m WorkbookModel) error {
+	return ir.Encode(w, m)
+}
+
+// DecodeWorkbookModel reads a model written by EncodeWorkbookModel,
+// migrating it from an earlier schema version if needed.
+func DecodeWorkbookModel(r io.Reader) (WorkbookModel, error) {
+	return ir.Decode(r)
+}
@@ -0,0 +1,55 @@
+package xlsx
+
+import (
+	"strings"
+
+	"github.com/aerissecure/convert/internal/textsafe"
+)
+
+// -----------------------------------------------------------------------------
+// Plain text
+// -----------------------------------------------------------------------------
+
+// WorkbookText returns the cell values of m, for search indexing and
+// previews: each sheet as its name followed by one line of tab-separated
+// values per row, sheets separated by a blank line.  Rows without values are
+// left out, as are blank cells after the last value of a row.  A cell's
+// conditional formatting icon precedes its value as a glyph.  The text is
+// repaired with the rules of the HTML output.
+func WorkbookText(m WorkbookModel) string {
+	var b strings.Builder
+	for i, sheet := range m.Sheets {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(sheet.Name)
+		b.WriteString("\n")
+		for _, row := range sheet.Rows {
+			last := -1
+			for j, cell := range row.Cells {
+				if cell != nil && cell.Value != "" {
+					last = j
+				}
+			}
+			for j := 0; j <= last; j++ {
+				if j > 0 {
+					b.WriteString("\t")
+				}
+				if cell := row.Cells[j]; cell != nil {
+					if cell.Icon != nil {
+						b.WriteString(cell.Icon.Glyph())
+						if cell.Icon.HideValue {
+							continue
+						}
+						b.WriteString(" ")
+					}
+					b.WriteString(cell.Value)
+				}
+			}
+			if last >= 0 {
+				b.WriteString("\n")
+			}
+		}
+	}
+	return textsafe.Clean(b.String())
+}
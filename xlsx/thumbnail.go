@@ -0,0 +1,143 @@
+package xlsx
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aerissecure/convert/internal/csssafe"
+	"github.com/aerissecure/convert/media"
+)
+
+// -----------------------------------------------------------------------------
+// Thumbnails
+// -----------------------------------------------------------------------------
+
+const (
+	defaultFontSizePt = 11
+	ptToPx            = 4.0 / 3
+	avgCharWidthEm    = 0.5 // average glyph advance of proportional fonts
+)
+
+// ThumbnailSVG renders the top-left corner of the first sheet as a standalone
+// SVG of width×height pixels, for previews such as file-browser grids.  The
+// visible area has the thumbnail's aspect ratio and spans the sheet's
+// columns up to 800px.  Cells are drawn as a grid with their fill and value;
+// text that does not fit is cut off.
+func ThumbnailSVG(m WorkbookModel, width, height int) string {
+	var b strings.Builder
+	if width <= 0 || height <= 0 {
+		width, height = 1, 1
+	}
+	var sheet RenderSheet
+	if len(m.Sheets) > 0 {
+		sheet = m.Sheets[0]
+	}
+	var used float64
+	for i, w := range sheet.ColWidths {
+		if i >= len(sheet.ColHidden) || !sheet.ColHidden[i] {
+			used += w
+		}
+	}
+	viewW := math.Max(math.Min(used, 800), 100)
+	viewH := viewW * float64(height) / float64(width)
+
+	b.WriteString(fmt.Sprintf("<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %.1f %.1f\">\n", width, height, viewW, viewH))
+	b.WriteString(fmt.Sprintf("<rect width=\"%.1f\" height=\"%.1f\" fill=\"#fff\"/>\n", viewW, viewH))
+
+	// Column offsets, skipping hidden columns.
+	xs := make([]float64, len(sheet.ColWidths)+1)
+	for i, w := range sheet.ColWidths {
+		if i < len(sheet.ColHidden) && sheet.ColHidden[i] {
+			w = 0
+		}
+		xs[i+1] = xs[i] + w
+	}
+	colSpanWidth := func(col, span int) float64 {
+		end := min(col+max(span, 1), len(sheet.ColWidths))
+		return xs[end] - xs[col]
+	}
+
+	y := 0.0
+	for _, row := range sheet.Rows {
+		if y >= viewH {
+			break
+		}
+		if row.Hidden {
+			continue
+		}
+		for col := 0; col < len(row.Cells); col++ {
+			cell := row.Cells[col]
+			if col >= len(sheet.ColWidths) || xs[col] >= viewW {
+				break
+			}
+			w := sheet.ColWidths[col]
+			if col < len(sheet.ColHidden) && sheet.ColHidden[col] {
+				continue
+			}
+			fill := "none"
+			if cell != nil {
+				w = colSpanWidth(col, cell.ColSpan)
+				if c := csssafe.Color(cell.Style.BackgroundColor); c != "" {
+					fill = "#" + c
+				}
+			}
+			b.WriteString(fmt.Sprintf("<rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\" fill=\"%s\" stroke=\"#d0d0d0\" stroke-width=\"0.5\"/>\n", xs[col], y, w, row.HeightPx, fill))
+			if cell != nil {
+				writeCellText(&b, cell, xs[col], y, w, row.HeightPx)
+				col += max(cell.ColSpan, 1) - 1
+			}
+		}
+		y += row.HeightPx
+	}
+	b.WriteString("</svg>\n")
+	return b.String()
+}
+
+// ThumbnailPNG renders ThumbnailSVG and rasterizes it with r.
+func ThumbnailPNG(m WorkbookModel, width, height int, r media.Rasterizer) ([]byte, error) {
+	return r([]byte(ThumbnailSVG(m, width, height)), width, height)
+}
+
+// writeCellText draws the value of a cell on one line, aligned like the
+// cell and cut to the characters that fit.
+func writeCellText(b *strings.Builder, cell *RenderCell, x, y, w, h float64) {
+	text := cell.Value
+	if len(cell.Runs) > 0 {
+		var sb strings.Builder
+		for _, r := range cell.Runs {
+			sb.WriteString(r.Text)
+		}
+		text = sb.String()
+	}
+	text = strings.Join(strings.Fields(text), " ")
+	if text == "" {
+		return
+	}
+	sizePt := cell.Style.FontSizePt
+	if sizePt <= 0 {
+		sizePt = defaultFontSizePt
+	}
+	size := sizePt * ptToPx
+	if fit := int((w - 4) / (size * avgCharWidthEm)); fit < utf8.RuneCountInString(text) {
+		if fit <= 0 {
+			return
+		}
+		text = string([]rune(text)[:fit])
+	}
+	color := csssafe.Color(cell.Style.FontColor)
+	if color == "" {
+		color = "000"
+	}
+	anchor, ax := "", x+2+cell.Style.IndentPx
+	switch cell.Style.HorizontalAlign {
+	case "center":
+		anchor, ax = " text-anchor=\"middle\"", x+w/2
+	case "right":
+		anchor, ax = " text-anchor=\"end\"", x+w-2
+	}
+	b.WriteString(fmt.Sprintf("<text x=\"%.1f\" y=\"%.1f\" font-family=\"sans-serif\" font-size=\"%.1f\" fill=\"#%s\"%s>%s</text>\n",
+		ax, y+h-math.Max((h-size)/2, 0)-size*0.2, size, color, anchor, html.EscapeString(text)))
+}
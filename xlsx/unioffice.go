@@ -0,0 +1,199 @@
+//go:build !nounioffice
+
+package xlsx
+
+import (
+	"io"
+
+	"github.com/aerissecure/convert/internal/panics"
+	"github.com/unidoc/unioffice/schema/soo/sml"
+	"github.com/unidoc/unioffice/spreadsheet"
+)
+
+// -----------------------------------------------------------------------------
+// Unioffice backend
+// -----------------------------------------------------------------------------
+//
+// The glue between unioffice's document model and the readers shared with
+// Native.  Builds tagged nounioffice leave this file out, with the parser
+// in parse.go, WriteWorkbook and the style helpers of xlsx.go.
+
+// Unioffice reads workbooks through unioffice's spreadsheet package; it is
+// the default backend.
+var Unioffice Backend = uniofficeBackend{}
+
+// defaultBackend is the backend of ParseWorkbookModel.
+var defaultBackend = Unioffice
+
+type uniofficeBackend struct{ nf numberFormat }
+
+func (b uniofficeBackend) String() string {
+	return "Unioffice" + b.nf.String()
+}
+
+func (b uniofficeBackend) ParseWorkbook(r io.ReaderAt, size int64) (m WorkbookModel, err error) {
+	defer panics.Catch(&err)
+	return parseWorkbookModel(r, size, b.nf)
+}
+
+func (b uniofficeBackend) withNumberFormat(set func(*numberFormat)) Backend {
+	set(&b.nf)
+	return b
+}
+
+// uniofficeBorders resolves the sides of border b of wb.
+func uniofficeBorders(b *sml.CT_Border, wb *spreadsheet.Workbook) Borders {
+	if b == nil {
+		return Borders{}
+	}
+	side := func(pr *sml.CT_BorderPr) Border {
+		if pr == nil || borderStyle(pr.StyleAttr.String()) == "" {
+			return Border{}
+		}
+		c, _ := resolveCTColor(pr.Color, wb)
+		return Border{Style: borderStyle(pr.StyleAttr.String()), Color: c}
+	}
+	return Borders{Top: side(b.Top), Right: side(b.Right), Bottom: side(b.Bottom), Left: side(b.Left)}
+}
+
+// uniofficeConditionalFormats reads the conditional formatting of a
+// worksheet parsed by unioffice.
+func uniofficeConditionalFormats(cfs []*sml.CT_ConditionalFormatting, wb *spreadsheet.Workbook) []cfRange {
+	cfvos := func(xs []*sml.CT_Cfvo) []cfvo {
+		out := make([]cfvo, len(xs))
+		for i, x := range xs {
+			out[i] = cfvo{typ: x.TypeAttr.String(), gte: x.GteAttr == nil || *x.GteAttr}
+			if x.ValAttr != nil {
+				out[i].val = *x.ValAttr
+			}
+		}
+		return out
+	}
+	var out []cfRange
+	for _, cf := range cfs {
+		var cr cfRange
+		if cf.SqrefAttr != nil {
+			cr.sqref = *cf.SqrefAttr
+		}
+		for _, x := range cf.CfRule {
+			r := cfRule{typ: x.TypeAttr.String(), formulas: x.Formula, dxf: -1, priority: int(x.PriorityAttr)}
+			if x.OperatorAttr != sml.ST_ConditionalFormattingOperatorUnset {
+				r.operator = x.OperatorAttr.String()
+			}
+			if x.DxfIdAttr != nil {
+				r.dxf = int(*x.DxfIdAttr)
+			}
+			if x.RankAttr != nil {
+				r.rank = int(*x.RankAttr)
+			}
+			r.stopIfTrue = x.StopIfTrueAttr != nil && *x.StopIfTrueAttr
+			r.percent = x.PercentAttr != nil && *x.PercentAttr
+			r.bottom = x.BottomAttr != nil && *x.BottomAttr
+			if cs := x.ColorScale; cs != nil {
+				r.cfvos = cfvos(cs.Cfvo)
+				for _, c := range cs.Color {
+					s, _ := resolveCTColor(c, wb)
+					r.colors = append(r.colors, s)
+				}
+			}
+			if is := x.IconSet; is != nil {
+				r.cfvos = cfvos(is.Cfvo)
+				r.iconSet = is.IconSetAttr.String()
+				if r.iconSet == "" {
+					r.iconSet = defaultIconSet
+				}
+				r.reverse = is.ReverseAttr != nil && *is.ReverseAttr
+				r.hideValue = is.ShowValueAttr != nil && !*is.ShowValueAttr
+			}
+			cr.rules = append(cr.rules, r)
+		}
+		out = append(out, cr)
+	}
+	return out
+}
+
+// uniofficeDxfs returns the differential formats of wb.
+func uniofficeDxfs(wb *spreadsheet.Workbook) []dxfStyle {
+	ss := wb.StyleSheet.X()
+	if ss.Dxfs == nil {
+		return nil
+	}
+	color := func(c *sml.CT_Color) string {
+		s, _ := resolveCTColor(c, wb)
+		return s
+	}
+	flag := func(ps []*sml.CT_BooleanProperty) bool {
+		return len(ps) > 0 && (ps[0].ValAttr == nil || *ps[0].ValAttr)
+	}
+	var out []dxfStyle
+	for _, x := range ss.Dxfs.Dxf {
+		var d dxfStyle
+		if f := x.Font; f != nil {
+			if len(f.Color) > 0 {
+				d.fontColor = color(f.Color[0])
+			}
+			d.bold, d.italic, d.strike = flag(f.B), flag(f.I), flag(f.Strike)
+			d.underline = len(f.U) > 0 && f.U[0].ValAttr != sml.ST_UnderlineValuesNone
+		}
+		if x.Fill != nil && x.Fill.PatternFill != nil {
+			if d.fillColor = color(x.Fill.PatternFill.BgColor); d.fillColor == "" {
+				d.fillColor = color(x.Fill.PatternFill.FgColor)
+			}
+		}
+		d.borders = uniofficeBorders(x.Border, wb)
+		out = append(out, d)
+	}
+	return out
+}
+
+// readPageSetup reads the print layout of the sheet at index idx.
+func readPageSetup(wb *spreadsheet.Workbook, sheet spreadsheet.Sheet, idx int) PageSetup {
+	ps := defaultPageSetup()
+	x := sheet.X()
+	if m := x.PageMargins; m != nil {
+		ps.MarginLeftPt, ps.MarginRightPt = m.LeftAttr*72, m.RightAttr*72
+		ps.MarginTopPt, ps.MarginBottomPt = m.TopAttr*72, m.BottomAttr*72
+	}
+	if s := x.PageSetup; s != nil {
+		if s.PaperSizeAttr != nil {
+			if sz, ok := paperSizes[*s.PaperSizeAttr]; ok {
+				ps.PageWidthPt, ps.PageHeightPt = sz[0], sz[1]
+			}
+		}
+		if s.ScaleAttr != nil && *s.ScaleAttr >= 10 && *s.ScaleAttr <= 400 {
+			ps.Scale = float64(*s.ScaleAttr)
+		}
+		ps.FitToWidth, ps.FitToHeight = 1, 1
+		if s.FitToWidthAttr != nil {
+			ps.FitToWidth = int(*s.FitToWidthAttr)
+		}
+		if s.FitToHeightAttr != nil {
+			ps.FitToHeight = int(*s.FitToHeightAttr)
+		}
+		ps.OverThenDown = s.PageOrderAttr == sml.ST_PageOrderOverThenDown
+		if s.OrientationAttr == sml.ST_OrientationLandscape {
+			ps.Landscape = true
+			ps.PageWidthPt, ps.PageHeightPt = ps.PageHeightPt, ps.PageWidthPt
+		}
+	}
+	if pr := x.SheetPr; pr != nil && pr.PageSetUpPr != nil && pr.PageSetUpPr.FitToPageAttr != nil {
+		ps.FitToPage = *pr.PageSetUpPr.FitToPageAttr
+	}
+	if !ps.FitToPage {
+		ps.FitToWidth, ps.FitToHeight = 0, 0
+	}
+	if o := x.PrintOptions; o != nil {
+		ps.Gridlines = o.GridLinesAttr != nil && *o.GridLinesAttr
+		ps.CenterH = o.HorizontalCenteredAttr != nil && *o.HorizontalCenteredAttr
+	}
+
+	if wb.X().DefinedNames == nil {
+		return ps
+	}
+	for _, dn := range wb.X().DefinedNames.DefinedName {
+		if dn.LocalSheetIdAttr != nil && int(*dn.LocalSheetIdAttr) == idx {
+			applyDefinedName(&ps, dn.NameAttr, dn.Content)
+		}
+	}
+	return ps
+}
@@ -0,0 +1,46 @@
+package xlsx
+
+// -----------------------------------------------------------------------------
+// Units
+// -----------------------------------------------------------------------------
+//
+// Workbooks measure row heights in points, column widths in characters of
+// the default font's digits and indents in levels.  The parsers convert
+// them to CSS pixels with the factors of DefaultUnits, so the model always
+// holds pixels at those factors; RenderOptions.Units rescales them on
+// output for consumers targeting another resolution or matching a
+// particular Excel rendering.
+
+// Factors of DefaultUnits, and the size of rows and columns that do not set
+// one.
+const (
+	pxPerPt         = 1.333 // 96 DPI
+	pxPerChar       = 8.3   // about the digit width of Calibri 11 at 96 DPI, with padding
+	indentStepPx    = 8.0
+	defaultRowPt    = 15.0
+	defaultColChars = 8.43
+)
+
+// Units are the factors converting workbook measurements to pixels.  Zero
+// fields mean those of DefaultUnits.
+type Units struct {
+	PxPerPt   float64 // row heights, per point
+	PxPerChar float64 // column widths, per character
+	IndentPx  float64 // cell indents, per level
+}
+
+// DefaultUnits are the factors the parsers use: 1.333 pixels per point,
+// 8.3 per character and 8 per indent level.
+var DefaultUnits = Units{PxPerPt: pxPerPt, PxPerChar: pxPerChar, IndentPx: indentStepPx}
+
+// scales returns the factors converting row heights, column widths and
+// indents of a model, in DefaultUnits, to u.
+func (u Units) scales() (height, width, indent float64) {
+	ratio := func(v, def float64) float64 {
+		if v <= 0 {
+			return 1
+		}
+		return v / def
+	}
+	return ratio(u.PxPerPt, pxPerPt), ratio(u.PxPerChar, pxPerChar), ratio(u.IndentPx, indentStepPx)
+}
@@ -0,0 +1,75 @@
+package xlsx
+
+import "errors"
+
+// -----------------------------------------------------------------------------
+// Model traversal
+// -----------------------------------------------------------------------------
+
+// SkipChildren may be returned by a Visitor callback to skip the contents of
+// the node it was called for.  Walk continues with the next sibling.
+var SkipChildren = errors.New("xlsx: skip children")
+
+// Visitor holds the callbacks Walk calls for each node.  Nodes are passed by
+// pointer and may be modified in place; blank cells (nil entries of
+// RenderRow.Cells) are not visited.  Any callback may be nil.  An error
+// other than SkipChildren stops the walk and is returned by Walk.
+type Visitor struct {
+	Sheet func(*RenderSheet) error
+	Row   func(*RenderRow) error
+	Cell  func(*RenderCell) error
+	Run   func(*RenderRun) error
+}
+
+// Walk visits the workbook's sheets, rows, cells and rich-text runs in order.
+func Walk(m *WorkbookModel, v Visitor) error {
+	for s := range m.Sheets {
+		sheet := &m.Sheets[s]
+		if skip, err := visit(v.Sheet, sheet); err != nil || skip {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		for r := range sheet.Rows {
+			row := &sheet.Rows[r]
+			if skip, err := visit(v.Row, row); err != nil || skip {
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			for _, cell := range row.Cells {
+				if cell == nil {
+					continue
+				}
+				if skip, err := visit(v.Cell, cell); err != nil || skip {
+					if err != nil {
+						return err
+					}
+					continue
+				}
+				for i := range cell.Runs {
+					if _, err := visit(v.Run, &cell.Runs[i]); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// visit calls fn on node, translating SkipChildren into skip.
+func visit[T any](fn func(*T) error, node *T) (skip bool, err error) {
+	if fn == nil {
+		return false, nil
+	}
+	switch err := fn(node); {
+	case errors.Is(err, SkipChildren):
+		return true, nil
+	case err != nil:
+		return false, err
+	}
+	return false, nil
+}
@@ -0,0 +1,256 @@
+//go:build !nounioffice
+
+package xlsx
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/unidoc/unioffice"
+	"github.com/unidoc/unioffice/color"
+	"github.com/unidoc/unioffice/measurement"
+	"github.com/unidoc/unioffice/schema/soo/ofc/sharedTypes"
+	"github.com/unidoc/unioffice/schema/soo/sml"
+	"github.com/unidoc/unioffice/spreadsheet"
+	"github.com/unidoc/unioffice/spreadsheet/reference"
+)
+
+// WriteWorkbook serializes m as an XLSX package to w, so a model that was
+// built or modified in code (e.g. redacted) can be saved rather than only
+// rendered.
+//
+// Cell values are the formatted strings of the model.  A value is written
+// as a number only when it is one in canonical form ("42", "-1.5");
+// anything else, including "1,234.00" or dates, is written as text.  The
+// raw value and number format of a cell are not written, so what is saved
+// is what Value says even if it was edited, e.g. redacted.  Rich-text
+// runs, merges, column widths, row heights, hidden sheets, rows and
+// columns, tab colours and the CellStyle properties are written; the grid
+// position of a cell is its index in the model, as produced by
+// ParseWorkbookModel.
+func WriteWorkbook(w io.Writer, m WorkbookModel) error {
+	wb := spreadsheet.New()
+	styles := make(map[CellStyle]spreadsheet.CellStyle)
+	for i, rs := range m.Sheets {
+		sheet := wb.AddSheet()
+		name := rs.Name
+		if name == "" {
+			name = fmt.Sprintf("Sheet%d", i+1)
+		}
+		sheet.SetName(name)
+		if rs.Hidden {
+			wb.X().Sheets.Sheet[i].StateAttr = sml.ST_SheetStateHidden
+		}
+		writeSheet(wb, sheet, rs, styles)
+	}
+	if len(m.Sheets) == 0 {
+		wb.AddSheet() // a workbook needs at least one sheet
+	}
+	return wb.Save(w)
+}
+
+// writeSheet fills sheet from rs.
+func writeSheet(wb *spreadsheet.Workbook, sheet spreadsheet.Sheet, rs RenderSheet, styles map[CellStyle]spreadsheet.CellStyle) {
+	if rs.TabColor != "" {
+		sheet.X().SheetPr = &sml.CT_SheetPr{TabColor: &sml.CT_Color{RgbAttr: unioffice.String("FF" + rs.TabColor)}}
+	}
+	defaultWidthPx := defaultColChars * pxPerChar
+	for c, px := range rs.ColWidths {
+		col := sheet.Column(uint32(c + 1))
+		if px > 0 && math.Abs(px-defaultWidthPx) > 0.01 {
+			col.X().WidthAttr = unioffice.Float64(px / pxPerChar)
+			col.X().CustomWidthAttr = unioffice.Bool(true)
+		}
+		if c < len(rs.ColHidden) && rs.ColHidden[c] {
+			col.SetHidden(true)
+		}
+	}
+
+	defaultHeightPx := defaultRowPt * pxPerPt
+	for r, rr := range rs.Rows {
+		row := sheet.AddNumberedRow(uint32(r + 1))
+		if rr.HeightPx > 0 && math.Abs(rr.HeightPx-defaultHeightPx) > 0.01 {
+			row.SetHeight(measurement.Distance(rr.HeightPx / pxPerPt))
+		}
+		if rr.Hidden {
+			row.SetHidden(true)
+		}
+		for c, rc := range rr.Cells {
+			if rc == nil {
+				continue
+			}
+			ref := reference.IndexToColumn(uint32(c)) + strconv.Itoa(r+1)
+			cell := row.AddNamedCell(reference.IndexToColumn(uint32(c)))
+			writeCellValue(cell, rc)
+			if rc.Style != (CellStyle{}) {
+				cs, ok := styles[rc.Style]
+				if !ok {
+					cs = addCellStyle(wb, rc.Style)
+					styles[rc.Style] = cs
+				}
+				cell.SetStyle(cs)
+			}
+			if rc.ColSpan > 1 || rc.RowSpan > 1 {
+				to := reference.IndexToColumn(uint32(c+max(rc.ColSpan, 1)-1)) + strconv.Itoa(r+max(rc.RowSpan, 1))
+				sheet.AddMergedCells(ref, to)
+			}
+		}
+	}
+}
+
+// writeCellValue sets the value of cell from rc.
+func writeCellValue(cell spreadsheet.Cell, rc *RenderCell) {
+	if len(rc.Runs) > 0 {
+		rt := cell.SetRichTextString()
+		for _, r := range rc.Runs {
+			run := rt.AddRun()
+			run.SetText(r.Text)
+			if r.FontFamily != "" {
+				run.SetFont(r.FontFamily)
+			}
+			if r.FontSizePt > 0 {
+				run.SetSize(measurement.Distance(r.FontSizePt))
+			}
+			if r.FontColor != "" {
+				run.SetColor(color.FromHex("#" + r.FontColor))
+				upperRGB(run.X().RPr.Color)
+			}
+			if r.Bold {
+				run.SetBold(true)
+			}
+			if r.Italic {
+				run.SetItalic(true)
+			}
+			if r.Underline {
+				run.SetUnderline(sml.ST_UnderlineValuesSingle)
+			}
+			if r.Strike {
+				run.X().RPr = ensureRPr(run.X().RPr)
+				run.X().RPr.Strike = sml.NewCT_BooleanProperty()
+			}
+			if va, ok := vertAligns[r.VerticalAlign]; ok {
+				run.X().RPr = ensureRPr(run.X().RPr)
+				run.X().RPr.VertAlign = sml.NewCT_VerticalAlignFontProperty()
+				run.X().RPr.VertAlign.ValAttr = va
+			}
+		}
+		return
+	}
+	if rc.Value == "" {
+		return
+	}
+	if f, err := strconv.ParseFloat(rc.Value, 64); err == nil && strconv.FormatFloat(f, 'f', -1, 64) == rc.Value {
+		cell.SetNumber(f)
+		return
+	}
+	cell.SetString(rc.Value)
+}
+
+// vertAligns maps the RenderRun.VerticalAlign values written to their
+// attribute; "baseline" is the default and left out.
+var vertAligns = map[string]sharedTypes.ST_VerticalAlignRun{
+	"superscript": sharedTypes.ST_VerticalAlignRunSuperscript,
+	"subscript":   sharedTypes.ST_VerticalAlignRunSubscript,
+}
+
+// upperRGB upper-cases the ARGB value unioffice writes in lower case, to
+// match what Excel writes and ParseWorkbookModel reports.
+func upperRGB(c *sml.CT_Color) {
+	if c != nil && c.RgbAttr != nil {
+		*c.RgbAttr = strings.ToUpper(*c.RgbAttr)
+	}
+}
+
+// ensureRPr returns rpr, allocating it if nil.
+func ensureRPr(rpr *sml.CT_RPrElt) *sml.CT_RPrElt {
+	if rpr == nil {
+		return sml.NewCT_RPrElt()
+	}
+	return rpr
+}
+
+// addCellStyle adds a cell format for s to the workbook's style sheet.
+func addCellStyle(wb *spreadsheet.Workbook, s CellStyle) spreadsheet.CellStyle {
+	ss := wb.StyleSheet
+	cs := ss.AddCellStyle()
+	if s.FontFamily != "" || s.FontSizePt > 0 || s.FontColor != "" {
+		f := ss.AddFont()
+		name, size := s.FontFamily, s.FontSizePt
+		if name == "" {
+			name = "Calibri"
+		}
+		if size <= 0 {
+			size = 11
+		}
+		f.SetName(name)
+		f.SetSize(size)
+		if s.FontColor != "" {
+			f.SetColor(color.FromHex("#" + s.FontColor))
+			upperRGB(f.X().Color[len(f.X().Color)-1])
+		}
+		cs.SetFont(f)
+	}
+	if s.BackgroundColor != "" {
+		fill := ss.Fills().AddFill()
+		pf := fill.SetPatternFill()
+		pf.SetPattern(sml.ST_PatternTypeSolid)
+		pf.SetFgColor(color.FromHex("#" + s.BackgroundColor))
+		upperRGB(pf.X().FgColor)
+		cs.SetFill(fill)
+	}
+	if !s.Borders.IsZero() {
+		b := ss.AddBorder()
+		side := func(bd Border) *sml.CT_BorderPr {
+			pr := sml.NewCT_BorderPr()
+			if pr.StyleAttr.UnmarshalXMLAttr(xml.Attr{Value: bd.Style}) != nil {
+				pr.StyleAttr = sml.ST_BorderStyleUnset
+			}
+			if bd.Color != "" {
+				pr.Color = &sml.CT_Color{RgbAttr: unioffice.String("FF" + bd.Color)}
+			}
+			return pr
+		}
+		x := b.X()
+		x.Left, x.Right, x.Top, x.Bottom = side(s.Borders.Left), side(s.Borders.Right), side(s.Borders.Top), side(s.Borders.Bottom)
+		cs.SetBorder(b)
+	} else if s.BorderColor != "" {
+		b := ss.AddBorder()
+		c := color.FromHex("#" + s.BorderColor)
+		b.SetLeft(sml.ST_BorderStyleThin, c)
+		b.SetRight(sml.ST_BorderStyleThin, c)
+		b.SetTop(sml.ST_BorderStyleThin, c)
+		b.SetBottom(sml.ST_BorderStyleThin, c)
+		for _, side := range []*sml.CT_BorderPr{b.X().Left, b.X().Right, b.X().Top, b.X().Bottom} {
+			upperRGB(side.Color)
+		}
+		cs.SetBorder(b)
+	}
+	if s.HorizontalAlign != "" {
+		var h sml.ST_HorizontalAlignment
+		if h.UnmarshalXMLAttr(xml.Attr{Value: s.HorizontalAlign}) == nil && h != sml.ST_HorizontalAlignmentUnset {
+			cs.SetHorizontalAlignment(h)
+		}
+	}
+	switch s.VerticalAlign {
+	case "top":
+		cs.SetVerticalAlignment(sml.ST_VerticalAlignmentTop)
+	case "middle":
+		cs.SetVerticalAlignment(sml.ST_VerticalAlignmentCenter)
+	}
+	if s.WrapText {
+		cs.SetWrapped(true)
+	}
+	if s.IndentPx > 0 {
+		xf := ss.X().CellXfs.Xf[cs.Index()]
+		if xf.Alignment == nil {
+			xf.Alignment = sml.NewCT_CellAlignment()
+		}
+		xf.Alignment.IndentAttr = unioffice.Uint32(uint32(math.Round(s.IndentPx / 8)))
+		xf.ApplyAlignmentAttr = unioffice.Bool(true)
+	}
+	return cs
+}
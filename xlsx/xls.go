@@ -0,0 +1,867 @@
+package xlsx
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"unicode/utf16"
+
+	"github.com/aerissecure/convert/internal/cfb"
+	"github.com/aerissecure/convert/internal/panics"
+	"github.com/aerissecure/convert/xlsx/numfmt"
+)
+
+// -----------------------------------------------------------------------------
+// Legacy XLS (BIFF8)
+// -----------------------------------------------------------------------------
+//
+// Excel 97-2003 workbooks are a "Workbook" stream of BIFF8 records inside a
+// compound file.  The globals substream holds the shared strings, fonts,
+// number formats, cell formats (XF), palette and sheet list; each worksheet
+// substream holds its cells, merges, rows and columns.  Only what the IR
+// covers is read: values formatted with their number format, merges, column
+// widths, row heights, and the font, fill, border colour and alignment of
+// each cell.  Formulas contribute their cached result.  Chart and macro
+// sheets, BIFF5 and earlier files and encrypted workbooks are not supported.
+//
+// CellStyle has no bold/italic/underline/strike, so cells whose font uses
+// them carry a single run with the cell's text, like rich-text cells do.
+
+// BIFF8 record types.
+const (
+	recFormula     = 0x0006
+	recEOF         = 0x000A
+	recDateMode    = 0x0022
+	recFilePass    = 0x002F
+	recFont        = 0x0031
+	recContinue    = 0x003C
+	recColInfo     = 0x007D
+	recBoundSheet  = 0x0085
+	recPalette     = 0x0092
+	recMulRK       = 0x00BD
+	recMulBlank    = 0x00BE
+	recXF          = 0x00E0
+	recMergedCells = 0x00E5
+	recSST         = 0x00FC
+	recLabelSST    = 0x00FD
+	recBlank       = 0x0201
+	recNumber      = 0x0203
+	recLabel       = 0x0204
+	recBoolErr     = 0x0205
+	recString      = 0x0207
+	recRow         = 0x0208
+	recRK          = 0x027E
+	recFormat      = 0x041E
+	recBOF         = 0x0809
+)
+
+// biffVersion8 is the BOF version of BIFF8 streams.
+const biffVersion8 = 0x0600
+
+// xlsErrors maps BIFF error codes to their display text.
+var xlsErrors = map[byte]string{
+	0x00: "#NULL!",
+	0x07: "#DIV/0!",
+	0x0F: "#VALUE!",
+	0x17: "#REF!",
+	0x1D: "#NAME?",
+	0x24: "#NUM!",
+	0x2A: "#N/A",
+}
+
+// xlsDefaultPalette holds the colours of palette indices 0-63 when the
+// workbook has no PALETTE record.  A PALETTE record replaces indices 8-63;
+// indices 0-7 are fixed.
+var xlsDefaultPalette = []string{
+	"000000", "FFFFFF", "FF0000", "00FF00", "0000FF", "FFFF00", "FF00FF", "00FFFF",
+	"000000", "FFFFFF", "FF0000", "00FF00", "0000FF", "FFFF00", "FF00FF", "00FFFF",
+	"800000", "008000", "000080", "808000", "800080", "008080", "C0C0C0", "808080",
+	"9999FF", "993366", "FFFFCC", "CCFFFF", "660066", "FF8080", "0066CC", "CCCCFF",
+	"000080", "FF00FF", "FFFF00", "00FFFF", "800080", "800000", "008080", "0000FF",
+	"00CCFF", "CCFFFF", "CCFFCC", "FFFF99", "99CCFF", "FF99CC", "CC99FF", "FFCC99",
+	"3366FF", "33CCCC", "99CC00", "FFCC00", "FF9900", "FF6600", "666699", "969696",
+	"003366", "339966", "003300", "333300", "993300", "993366", "333399", "333333",
+}
+
+// xlsHAlign and xlsVAlign map the XF alignment fields to CellStyle values.
+var (
+	xlsHAlign = []string{"", "left", "center", "right", "fill", "justify", "centerContinuous", "distributed"}
+	xlsVAlign = []string{"top", "middle", "bottom", "bottom", "bottom"}
+)
+
+// biffRecord is one record of a BIFF stream.
+type biffRecord struct {
+	id   uint16
+	pos  int // offset of the record header in the stream
+	data []byte
+}
+
+// xlsFont is a FONT record.
+type xlsFont struct {
+	name      string
+	sizePt    float64
+	color     int // palette index
+	bold      bool
+	italic    bool
+	underline bool
+	strike    bool
+	script    int // 1 superscript, 2 subscript
+}
+
+// xlsXF is the part of an XF record the IR uses.
+type xlsXF struct {
+	font, format           int
+	hAlign, vAlign, indent int
+	wrap                   bool
+	borderStyles           [4]int // line styles of the top, right, bottom and left; 0 is none
+	borderColors           [4]int
+	pattern                int // fill pattern; 0 is none
+	fillColor              int
+}
+
+// xlsString is a shared string with its formatting runs.
+type xlsString struct {
+	text string
+	runs [][2]int // first UTF-16 character, font index
+}
+
+// xlsSheet is a BOUNDSHEET record.
+type xlsSheet struct {
+	name   string
+	pos    int
+	hidden bool
+	start  int // index of the record after its BOF, set by worksheets
+}
+
+// xlsBook holds the workbook globals.
+type xlsBook struct {
+	records  []biffRecord
+	strings  []xlsString
+	fonts    []xlsFont
+	formats  map[int]string
+	xfs      []xlsXF
+	palette  []string
+	sheets   []xlsSheet
+	date1904 bool
+	nf       numberFormat
+	strs     interner // cell values and run text
+}
+
+// IsXLS reports whether r/size is a legacy workbook: a compound file with
+// a Workbook (BIFF8) or Book (BIFF5) stream.  Other compound files, such as
+// encrypted XLSX packages, are not.
+func IsXLS(r io.ReaderAt, size int64) bool {
+	sig := make([]byte, len(cfb.Signature))
+	if _, err := r.ReadAt(sig, 0); err != nil || !cfb.IsCFB(sig) {
+		return false
+	}
+	f, err := cfb.Open(r, size)
+	if err != nil {
+		// Damaged; reported by openXLS.
+		return true
+	}
+	_, book := f.Stat("Book")
+	_, workbook := f.Stat("Workbook")
+	return workbook || book
+}
+
+// ParseXLSWorkbookModel reads a legacy Excel 97-2003 (BIFF8) workbook from
+// r/size and returns the same intermediate representation as
+// ParseWorkbookModel.  RenderCell.Cell is nil for these cells.
+func ParseXLSWorkbookModel(r io.ReaderAt, size int64) (m WorkbookModel, err error) {
+	defer panics.Catch(&err)
+	return parseXLS(r, size, numberFormat{})
+}
+
+// parseXLS is ParseXLSWorkbookModel formatting values with nf.
+func parseXLS(r io.ReaderAt, size int64, nf numberFormat) (WorkbookModel, error) {
+	bk, err := openXLS(r, size)
+	if err != nil {
+		return WorkbookModel{}, err
+	}
+	bk.nf = nf
+	var model WorkbookModel
+	for _, sh := range bk.worksheets() {
+		model.Sheets = append(model.Sheets, bk.readSheet(sh))
+	}
+	return model, nil
+}
+
+// openXLS reads the workbook globals of the BIFF8 workbook in r/size.
+func openXLS(r io.ReaderAt, size int64) (*xlsBook, error) {
+	f, err := cfb.Open(r, size)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := f.ReadStream("Workbook")
+	if err != nil {
+		if _, ok := f.Stat("Book"); ok {
+			return nil, errors.New("xlsx: BIFF5 and earlier workbooks are not supported")
+		}
+		return nil, err
+	}
+	return readXLSGlobals(biffRecords(stream))
+}
+
+// worksheets returns the sheets of bk that are worksheets, with start set.
+func (bk *xlsBook) worksheets() []xlsSheet {
+	byPos := make(map[int]int, len(bk.records))
+	for i, rec := range bk.records {
+		byPos[rec.pos] = i
+	}
+	var out []xlsSheet
+	for _, sh := range bk.sheets {
+		i, ok := byPos[sh.pos]
+		if !ok || bk.records[i].id != recBOF || le16(bk.records[i].data, 2) != 0x0010 {
+			continue // not a worksheet
+		}
+		sh.start = i + 1
+		out = append(out, sh)
+	}
+	return out
+}
+
+// readSheet converts worksheet sh, as returned by worksheets.
+func (bk *xlsBook) readSheet(sh xlsSheet) RenderSheet {
+	rs := bk.sheet(sh.name, sh.start)
+	rs.Hidden = sh.hidden
+	return rs
+}
+
+// biffRecords splits a BIFF stream into records.  A truncated trailing
+// record is dropped.
+func biffRecords(b []byte) []biffRecord {
+	var recs []biffRecord
+	for pos := 0; pos+4 <= len(b); {
+		n := int(binary.LittleEndian.Uint16(b[pos+2:]))
+		if pos+4+n > len(b) {
+			break
+		}
+		recs = append(recs, biffRecord{
+			id:   binary.LittleEndian.Uint16(b[pos:]),
+			pos:  pos,
+			data: b[pos+4 : pos+4+n],
+		})
+		pos += 4 + n
+	}
+	return recs
+}
+
+// readXLSGlobals reads the globals substream at the start of recs.
+func readXLSGlobals(recs []biffRecord) (*xlsBook, error) {
+	if len(recs) == 0 || recs[0].id != recBOF {
+		return nil, &PartError{Part: "Workbook", Err: errors.New("stream does not start with BOF")}
+	}
+	if v := le16(recs[0].data, 0); v != biffVersion8 {
+		return nil, fmt.Errorf("xlsx: unsupported BIFF version %#x", v)
+	}
+	bk := &xlsBook{
+		records: recs,
+		formats: make(map[int]string),
+		palette: xlsDefaultPalette,
+		strs:    make(interner),
+	}
+	for i := 1; i < len(recs); i++ {
+		d := recs[i].data
+		switch recs[i].id {
+		case recEOF:
+			return bk, nil
+		case recFilePass:
+			return nil, errors.New("xlsx: encrypted workbooks are not supported")
+		case recDateMode:
+			bk.date1904 = le16(d, 0) == 1
+		case recFont:
+			grbit := le16(d, 2)
+			name := biffString(d, 14, true)
+			bk.fonts = append(bk.fonts, xlsFont{
+				name:      name,
+				sizePt:    float64(le16(d, 0)) / 20,
+				color:     le16(d, 4),
+				bold:      le16(d, 6) >= 700,
+				italic:    grbit&0x02 != 0,
+				strike:    grbit&0x08 != 0,
+				script:    le16(d, 8),
+				underline: at8(d, 10) != 0,
+			})
+		case recFormat:
+			code := biffString(d, 2, false)
+			bk.formats[le16(d, 0)] = code
+		case recXF:
+			align := at8(d, 6)
+			borders := le32(d, 10)
+			fill := le32(d, 14)
+			bk.xfs = append(bk.xfs, xlsXF{
+				font:         le16(d, 0),
+				format:       le16(d, 2),
+				hAlign:       int(align & 0x07),
+				wrap:         align&0x08 != 0,
+				vAlign:       int(align>>4) & 0x07,
+				indent:       int(at8(d, 8) & 0x0F),
+				borderStyles: [4]int{int(borders>>8) & 0x0F, int(borders>>4) & 0x0F, int(borders>>12) & 0x0F, int(borders & 0x0F)},
+				borderColors: [4]int{int(fill & 0x7F), int(borders>>23) & 0x7F, int(fill>>7) & 0x7F, int(borders>>16) & 0x7F},
+				pattern:      int(fill >> 26),
+				fillColor:    le16(d, 18) & 0x7F,
+			})
+		case recPalette:
+			n := le16(d, 0)
+			pal := append([]string(nil), xlsDefaultPalette[:8]...)
+			for j := 0; j < n && 2+4*j+3 <= len(d); j++ {
+				c := d[2+4*j:]
+				pal = append(pal, fmt.Sprintf("%02X%02X%02X", c[0], c[1], c[2]))
+			}
+			bk.palette = pal
+		case recBoundSheet:
+			name := biffString(d, 6, true)
+			// The low bits of hsState, after the stream position, are the visibility:
+			// 0 visible, 1 hidden, 2 very hidden.
+			bk.sheets = append(bk.sheets, xlsSheet{name: name, pos: int(le32(d, 0)), hidden: le16(d, 4)&0x03 != 0})
+		case recSST:
+			segs := [][]byte{d}
+			for i+1 < len(recs) && recs[i+1].id == recContinue {
+				i++
+				segs = append(segs, recs[i].data)
+			}
+			bk.strings = readSST(segs)
+		}
+	}
+	return bk, nil
+}
+
+// sheet converts the worksheet substream whose records start at recs[start].
+func (bk *xlsBook) sheet(name string, start int) RenderSheet {
+	type merge struct{ r1, r2, c1, c2 int }
+	var (
+		merges    []merge
+		rowHeight = make(map[int]float64)
+		rowHidden = make(map[int]bool)
+		colWidth  = make(map[int]float64)
+		colHidden = make(map[int]bool)
+		pending   *RenderCell // formula awaiting its STRING record
+		pendingXF int
+		depth     int
+	)
+	cells := make(map[[2]int]*RenderCell)
+	lastRow, lastCol := -1, -1
+	put := func(row, col int, rc *RenderCell) {
+		rc.Ref = cellName(row, col)
+		cells[[2]int{row, col}] = rc
+	}
+
+records:
+	for _, rec := range bk.records[start:] {
+		d := rec.data
+		row, col, xf := le16(d, 0), le16(d, 2), le16(d, 4)
+		switch rec.id {
+		case recBOF:
+			depth++ // embedded chart
+			continue
+		case recEOF:
+			if depth == 0 {
+				break records
+			}
+			depth--
+			continue
+		}
+		if depth > 0 {
+			continue
+		}
+		if rec.id != recString {
+			pending = nil
+		}
+		switch rec.id {
+		case recLabelSST:
+			if n := int(le32(d, 6)); n < len(bk.strings) {
+				put(row, col, bk.stringCell(xf, bk.strings[n]))
+			}
+		case recLabel:
+			put(row, col, bk.stringCell(xf, xlsString{text: biffString(d, 6, false)}))
+		case recNumber:
+			put(row, col, bk.numberCell(xf, math.Float64frombits(binary.LittleEndian.Uint64(pad(d, 6, 8)))))
+		case recRK:
+			put(row, col, bk.numberCell(xf, decodeRK(le32(d, 6))))
+		case recMulRK:
+			for j := 0; 4+6*j+6 <= len(d)-2; j++ {
+				put(row, col+j, bk.numberCell(le16(d, 4+6*j), decodeRK(le32(d, 4+6*j+2))))
+			}
+		case recBlank:
+			put(row, col, bk.styledCell(xf, ""))
+		case recMulBlank:
+			for j := 0; 4+2*j+2 <= len(d)-2; j++ {
+				put(row, col+j, bk.styledCell(le16(d, 4+2*j), ""))
+			}
+		case recBoolErr:
+			put(row, col, bk.styledCell(xf, boolErrText(at8(d, 6), at8(d, 7) != 0)))
+		case recFormula:
+			v := pad(d, 6, 8)
+			if v[6] != 0xFF || v[7] != 0xFF {
+				put(row, col, bk.numberCell(xf, math.Float64frombits(binary.LittleEndian.Uint64(v))))
+				break
+			}
+			rc := bk.styledCell(xf, "")
+			switch v[0] {
+			case 0:
+				pending, pendingXF = rc, xf
+			case 1:
+				rc.Value = boolErrText(v[2], false)
+			case 2:
+				rc.Value = boolErrText(v[2], true)
+			}
+			rc.Raw = rc.Value
+			put(row, col, rc)
+		case recString:
+			if pending != nil {
+				sc := bk.stringCell(pendingXF, xlsString{text: biffString(d, 0, false)})
+				pending.Value, pending.Raw, pending.NumberFormat, pending.Runs = sc.Value, sc.Raw, sc.NumberFormat, sc.Runs
+				pending = nil
+			}
+		case recMergedCells:
+			for j := 0; 2+8*j+8 <= len(d); j++ {
+				o := 2 + 8*j
+				merges = append(merges, merge{le16(d, o), le16(d, o+2), le16(d, o+4), le16(d, o+6)})
+			}
+		case recRow:
+			flags := le32(d, 12)
+			rowHidden[row] = flags&0x20 != 0
+			if flags&0x40 != 0 {
+				rowHeight[row] = float64(le16(d, 6)&0x7FFF) / 20 * pxPerPt
+			}
+		case recColInfo:
+			for c := le16(d, 0); c <= le16(d, 2) && c < 256; c++ {
+				colWidth[c] = float64(le16(d, 4)) / 256 * pxPerChar
+				colHidden[c] = le16(d, 8)&0x01 != 0
+			}
+		}
+	}
+
+	// ---- determine sheet content bounds ----
+	// Merges may extend the sheet over blank cells, but only as far as the
+	// file has cells or rows: they are clamped to that extent, so a
+	// hostile MERGEDCELLS record cannot size the grid by itself.
+	usedRow, usedCol := -1, -1
+	for k, rc := range cells {
+		usedRow, usedCol = max(usedRow, k[0]), max(usedCol, k[1])
+		if rc.Value == "" {
+			continue
+		}
+		lastRow, lastCol = max(lastRow, k[0]), max(lastCol, k[1])
+	}
+	for r := range rowHeight {
+		usedRow = max(usedRow, r)
+	}
+	for r := range rowHidden {
+		usedRow = max(usedRow, r)
+	}
+	valid := merges[:0]
+	for _, m := range merges {
+		if m.r2 < m.r1 || m.c2 < m.c1 || m.r1 > usedRow || m.c1 > usedCol {
+			continue
+		}
+		m.r2, m.c2 = min(m.r2, usedRow), min(m.c2, usedCol)
+		lastRow, lastCol = max(lastRow, m.r2), max(lastCol, m.c2)
+		valid = append(valid, m)
+	}
+	merges = valid
+	lastRow, lastCol = max(lastRow, 0), max(lastCol, 0)
+	maxCols := lastCol + 1
+
+	rs := RenderSheet{
+		Name:      name,
+		ColWidths: make([]float64, maxCols),
+		ColHidden: make([]bool, maxCols),
+		Rows:      make([]RenderRow, lastRow+1),
+		PageSetup: defaultPageSetup(),
+	}
+	for c := 0; c < maxCols; c++ {
+		rs.ColWidths[c] = defaultColChars * pxPerChar // default approximation
+		if w, ok := colWidth[c]; ok {
+			rs.ColWidths[c] = w
+		}
+		rs.ColHidden[c] = colHidden[c]
+	}
+	for r := range rs.Rows {
+		rr := &rs.Rows[r]
+		rr.Cells = make([]*RenderCell, maxCols)
+		rr.Hidden = rowHidden[r]
+		rr.HeightPx = defaultRowPt * pxPerPt
+		if h, ok := rowHeight[r]; ok {
+			rr.HeightPx = h
+		}
+	}
+
+	// --- process merges ---
+	// Merges do not overlap, so together they cover at most the grid;
+	// overlapping ones past that are ignored.
+	skip := make(map[[2]int]bool)
+	area := (lastRow + 1) * maxCols
+	for _, m := range merges {
+		if area -= (m.r2 - m.r1 + 1) * (m.c2 - m.c1 + 1); area < 0 {
+			break
+		}
+		master := [2]int{m.r1, m.c1}
+		rc := cells[master]
+		if rc == nil {
+			rc = &RenderCell{}
+			put(m.r1, m.c1, rc)
+		}
+		rc.RowSpan, rc.ColSpan = m.r2-m.r1+1, m.c2-m.c1+1
+		for r := m.r1; r <= m.r2; r++ {
+			for c := m.c1; c <= m.c2; c++ {
+				if r != m.r1 || c != m.c1 {
+					skip[[2]int{r, c}] = true
+				}
+			}
+		}
+	}
+
+	for k, rc := range cells {
+		if k[0] > lastRow || k[1] > lastCol || skip[k] {
+			continue
+		}
+		if rc.RowSpan == 0 {
+			rc.RowSpan, rc.ColSpan = 1, 1
+		}
+		rs.Rows[k[0]].Cells[k[1]] = rc
+	}
+	return rs
+}
+
+// styledCell returns a cell with the style of XF index xf and value v,
+// which is shown as it is.
+func (bk *xlsBook) styledCell(xf int, v string) *RenderCell {
+	v = bk.strs.intern(v)
+	rc := &RenderCell{Value: v, Raw: v, Style: bk.style(xf), ColSpan: 1, RowSpan: 1}
+	if f := bk.xfFont(xf); f != nil && (f.bold || f.italic || f.underline || f.strike) && v != "" {
+		rc.Runs = []RenderRun{bk.run(v, *f)}
+	}
+	return rc
+}
+
+// stringCell returns a text cell, with one run per formatting run of s.
+func (bk *xlsBook) stringCell(xf int, s xlsString) *RenderCell {
+	f := bk.numFmt(xf)
+	text, color := bk.nf.text(s.text, f)
+	rc := bk.styledCell(xf, text)
+	value := cellValue{text: text, color: color, raw: s.text, code: formatCode(f)}
+	if len(s.runs) == 0 {
+		value.set(rc)
+		return rc
+	}
+	rc.Runs = nil
+	units := utf16.Encode([]rune(s.text))
+	runs := s.runs
+	if runs[0][0] > 0 && xf < len(bk.xfs) {
+		// Characters before the first run use the cell font.
+		runs = append([][2]int{{0, bk.xfs[xf].font}}, runs...)
+	}
+	for j, r := range runs {
+		end := len(units)
+		if j+1 < len(runs) {
+			end = min(runs[j+1][0], end)
+		}
+		if r[0] >= end {
+			continue
+		}
+		var f xlsFont
+		if p := bk.font(r[1]); p != nil {
+			f = *p
+		}
+		rc.Runs = append(rc.Runs, bk.run(bk.strs.intern(string(utf16.Decode(units[r[0]:end]))), f))
+	}
+	value.set(rc)
+	return rc
+}
+
+// numberCell returns a number cell formatted with the XF's number format.
+func (bk *xlsBook) numberCell(xf int, v float64) *RenderCell {
+	f := bk.numFmt(xf)
+	raw := strconv.FormatFloat(v, 'f', -1, 64)
+	if a := math.Abs(v); a != 0 && (a < 1e-6 || a >= 1e21) {
+		raw = strconv.FormatFloat(v, 'E', -1, 64)
+	}
+	text, color := bk.nf.number(v, f, bk.date1904)
+	rc := bk.styledCell(xf, text)
+	cellValue{text: text, color: color, raw: raw, code: formatCode(f)}.set(rc)
+	return rc
+}
+
+// run converts text in font f to a RenderRun.
+func (bk *xlsBook) run(text string, f xlsFont) RenderRun {
+	r := RenderRun{
+		Text:       text,
+		FontFamily: f.name,
+		FontSizePt: f.sizePt,
+		FontColor:  bk.color(f.color),
+		Bold:       f.bold,
+		Italic:     f.italic,
+		Underline:  f.underline,
+		Strike:     f.strike,
+	}
+	switch f.script {
+	case 1:
+		r.VerticalAlign = "superscript"
+	case 2:
+		r.VerticalAlign = "subscript"
+	}
+	return r
+}
+
+// style resolves XF index xf to a CellStyle.
+func (bk *xlsBook) style(xf int) CellStyle {
+	if xf < 0 || xf >= len(bk.xfs) {
+		return CellStyle{}
+	}
+	x := bk.xfs[xf]
+	var st CellStyle
+	if f := bk.font(x.font); f != nil {
+		st.FontFamily = f.name
+		st.FontSizePt = f.sizePt
+		st.FontColor = bk.color(f.color)
+	}
+	if x.pattern != 0 {
+		st.BackgroundColor = bk.color(x.fillColor)
+	}
+	if x.borderStyles[3] != 0 {
+		st.BorderColor = bk.color(x.borderColors[3])
+	}
+	var sides [4]Border
+	for i, code := range x.borderStyles {
+		if s := xlsBorderStyle(code); s != "" {
+			sides[i] = Border{Style: s, Color: bk.color(x.borderColors[i])}
+		}
+	}
+	st.Borders = Borders{Top: sides[0], Right: sides[1], Bottom: sides[2], Left: sides[3]}
+	if x.hAlign < len(xlsHAlign) {
+		st.HorizontalAlign = xlsHAlign[x.hAlign]
+	}
+	st.VerticalAlign = "bottom"
+	if x.vAlign < len(xlsVAlign) {
+		st.VerticalAlign = xlsVAlign[x.vAlign]
+	}
+	st.WrapText = x.wrap
+	st.IndentPx = float64(x.indent) * indentStepPx
+	return st
+}
+
+// font returns the FONT record with index i.  Index 4 is never used, so
+// the records after the fourth are numbered from 5.
+func (bk *xlsBook) font(i int) *xlsFont {
+	if i >= 4 {
+		i--
+	}
+	if i < 0 || i >= len(bk.fonts) {
+		return nil
+	}
+	return &bk.fonts[i]
+}
+
+// xfFont returns the font of XF index xf.
+func (bk *xlsBook) xfFont(xf int) *xlsFont {
+	if xf < 0 || xf >= len(bk.xfs) {
+		return nil
+	}
+	return bk.font(bk.xfs[xf].font)
+}
+
+// numFmt returns the number format code of XF index xf.
+func (bk *xlsBook) numFmt(xf int) string {
+	if xf < 0 || xf >= len(bk.xfs) {
+		return "General"
+	}
+	id := bk.xfs[xf].format
+	if code, ok := bk.formats[id]; ok {
+		return code
+	}
+	if code, ok := numfmt.Builtin(id); ok {
+		return code
+	}
+	return "General"
+}
+
+// color returns the hex colour of palette index i, or "" for the automatic
+// and system colours.
+func (bk *xlsBook) color(i int) string {
+	if i < 0 || i >= len(bk.palette) {
+		return ""
+	}
+	return bk.palette[i]
+}
+
+// boolErrText returns the display text of a boolean or error value.
+func boolErrText(v byte, isErr bool) string {
+	if isErr {
+		return xlsErrors[v]
+	}
+	if v != 0 {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// decodeRK decodes the compressed RK number format.
+func decodeRK(rk uint32) float64 {
+	var v float64
+	if rk&0x02 != 0 {
+		v = float64(int32(rk) >> 2)
+	} else {
+		v = math.Float64frombits(uint64(rk&0xFFFFFFFC) << 32)
+	}
+	if rk&0x01 != 0 {
+		v /= 100
+	}
+	return v
+}
+
+// -----------------------------------------------------------------------------
+// BIFF strings
+// -----------------------------------------------------------------------------
+
+// biffString decodes the XLUnicodeString, or ShortXLUnicodeString with its
+// one-byte length, at b[off:].
+func biffString(b []byte, off int, short bool) string {
+	var cch int
+	if short {
+		cch = int(at8(b, off))
+		off++
+	} else {
+		cch = le16(b, off)
+		off += 2
+	}
+	flags := at8(b, off)
+	off++
+	var units []uint16
+	for ; cch > 0 && off < len(b); cch-- {
+		if flags&0x01 != 0 {
+			if off+2 > len(b) {
+				break
+			}
+			units = append(units, uint16(le16(b, off)))
+			off += 2
+		} else {
+			units = append(units, uint16(b[off]))
+			off++
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+// sstReader reads the shared string table, which is split across an SST
+// record and its CONTINUE records.  A string's characters may be split
+// across records; the continuation then starts with a new flags byte that
+// says whether the rest is compressed.
+type sstReader struct {
+	segs     [][]byte
+	seg, off int
+}
+
+// bytes reads n bytes, crossing record boundaries.
+func (r *sstReader) bytes(n int) []byte {
+	var out []byte
+	for n > 0 && r.seg < len(r.segs) {
+		s := r.segs[r.seg][r.off:]
+		if len(s) == 0 {
+			r.seg, r.off = r.seg+1, 0
+			continue
+		}
+		k := min(n, len(s))
+		out = append(out, s[:k]...)
+		r.off += k
+		n -= k
+	}
+	return out
+}
+
+// chars reads cch characters.
+func (r *sstReader) chars(cch int, wide bool) []uint16 {
+	units := make([]uint16, 0, cch)
+	for cch > 0 && r.seg < len(r.segs) {
+		s := r.segs[r.seg][r.off:]
+		if len(s) == 0 {
+			r.seg, r.off = r.seg+1, 0
+			if r.seg < len(r.segs) && len(r.segs[r.seg]) > 0 {
+				wide = r.segs[r.seg][0]&0x01 != 0
+				r.off = 1
+			}
+			continue
+		}
+		if wide {
+			if len(s) < 2 {
+				r.off = len(r.segs[r.seg])
+				continue
+			}
+			units = append(units, uint16(le16(s, 0)))
+			r.off += 2
+		} else {
+			units = append(units, uint16(s[0]))
+			r.off++
+		}
+		cch--
+	}
+	return units
+}
+
+// readSST decodes the shared strings in segs.
+func readSST(segs [][]byte) []xlsString {
+	r := &sstReader{segs: segs}
+	hdr := r.bytes(8)
+	n := int(le32(hdr, 4))
+	var out []xlsString
+	for i := 0; i < n && r.seg < len(r.segs); i++ {
+		h := r.bytes(3)
+		if len(h) < 3 {
+			break
+		}
+		cch, flags := le16(h, 0), h[2]
+		var nRuns, extLen int
+		if flags&0x08 != 0 {
+			nRuns = le16(r.bytes(2), 0)
+		}
+		if flags&0x04 != 0 {
+			extLen = int(le32(r.bytes(4), 0))
+		}
+		s := xlsString{text: string(utf16.Decode(r.chars(cch, flags&0x01 != 0)))}
+		runs := r.bytes(4 * nRuns)
+		for j := 0; 4*j+4 <= len(runs); j++ {
+			s.runs = append(s.runs, [2]int{le16(runs, 4*j), le16(runs, 4*j+2)})
+		}
+		r.bytes(extLen)
+		out = append(out, s)
+	}
+	return out
+}
+
+// -----------------------------------------------------------------------------
+// Little-endian helpers; reads past the end return zero
+// -----------------------------------------------------------------------------
+
+func at8(b []byte, off int) byte {
+	if off < 0 || off >= len(b) {
+		return 0
+	}
+	return b[off]
+}
+
+func le16(b []byte, off int) int {
+	if off < 0 || off+2 > len(b) {
+		return 0
+	}
+	return int(binary.LittleEndian.Uint16(b[off:]))
+}
+
+func le32(b []byte, off int) uint32 {
+	if off < 0 || off+4 > len(b) {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b[off:])
+}
+
+// pad returns the n bytes at b[off:], zero-filled past the end of b.
+func pad(b []byte, off, n int) []byte {
+	out := make([]byte, n)
+	if off < len(b) {
+		copy(out, b[off:])
+	}
+	return out
+}
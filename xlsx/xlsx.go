@@ -1,3 +1,5 @@
+//go:build !nounioffice
+
 package xlsx
 
 import (
@@ -1,10 +1,31 @@
+//go:build !nounioffice
+
 package xlsx
 
 import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
 	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"math"
 	"os"
+	"reflect"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/aerissecure/convert/diag"
+	"github.com/aerissecure/convert/fonts"
+	"github.com/aerissecure/convert/internal/cfb/cfbtest"
+	"github.com/aerissecure/convert/media"
+	"github.com/unidoc/unioffice/spreadsheet"
 )
 
 func TestXlsxToHTML(t *testing.T) {
@@ -82,3 +103,1390 @@ func SprintXML(a any) string {
 	enc.Encode(a)
 	return b.String()
 }
+
+func TestWalk(t *testing.T) {
+	m := WorkbookModel{Sheets: []RenderSheet{
+		{Name: "Secret", Rows: []RenderRow{{Cells: []*RenderCell{{Value: "x"}}}}},
+		{Name: "Data", Rows: []RenderRow{{Cells: []*RenderCell{
+			{Value: "a@example.com"},
+			nil,
+			{Value: "b", Runs: []RenderRun{{Text: "c@example.com"}}},
+		}}}},
+	}}
+	var cells int
+	err := Walk(&m, Visitor{
+		Sheet: func(s *RenderSheet) error {
+			if s.Name == "Secret" {
+				return SkipChildren
+			}
+			return nil
+		},
+		Cell: func(c *RenderCell) error {
+			cells++
+			c.Value = strings.ReplaceAll(c.Value, "@example.com", "@…")
+			return nil
+		},
+		Run: func(r *RenderRun) error {
+			r.Text = strings.ReplaceAll(r.Text, "@example.com", "@…")
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := m.Sheets[1].Rows[0]
+	if cells != 2 || row.Cells[0].Value != "a@…" || row.Cells[2].Runs[0].Text != "c@…" || m.Sheets[0].Rows[0].Cells[0].Value != "x" {
+		t.Errorf("unexpected walk result: %d cells, %v", cells, row)
+	}
+}
+
+func TestThumbnailSVG(t *testing.T) {
+	m := WorkbookModel{Sheets: []RenderSheet{{
+		Name:      "Data",
+		ColWidths: []float64{64, 64, 64},
+		ColHidden: []bool{false, true, false},
+		Rows: []RenderRow{{HeightPx: 20, Cells: []*RenderCell{
+			{Value: "Q1 & Q2", ColSpan: 1, RowSpan: 1, Style: CellStyle{BackgroundColor: "FFFF00"}},
+			{Value: "hidden", ColSpan: 1, RowSpan: 1},
+			nil,
+		}}},
+	}}}
+	svg := ThumbnailSVG(m, 160, 120)
+	if err := xml.Unmarshal([]byte(svg), new(struct{})); err != nil {
+		t.Fatalf("thumbnail is not well-formed: %v\n%s", err, svg)
+	}
+	for _, want := range []string{`width="160" height="120" viewBox="0 0 128.0 96.0"`, `fill="#FFFF00"`, ">Q1 &amp; Q2</text>"} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("thumbnail missing %s:\n%s", want, svg)
+		}
+	}
+	if strings.Contains(svg, "hidden") {
+		t.Errorf("hidden column drawn:\n%s", svg)
+	}
+}
+
+func TestParseXLS(t *testing.T) {
+	le := binary.LittleEndian
+	var stream []byte
+	rec := func(id uint16, parts ...[]byte) int {
+		pos := len(stream)
+		var data []byte
+		for _, p := range parts {
+			data = append(data, p...)
+		}
+		stream = le.AppendUint16(stream, id)
+		stream = le.AppendUint16(stream, uint16(len(data)))
+		stream = append(stream, data...)
+		return pos
+	}
+	u16 := func(v ...int) []byte {
+		var b []byte
+		for _, x := range v {
+			b = le.AppendUint16(b, uint16(x))
+		}
+		return b
+	}
+	u32 := func(v uint32) []byte { return le.AppendUint32(nil, v) }
+	f64 := func(v float64) []byte { return le.AppendUint64(nil, math.Float64bits(v)) }
+	short := func(s string) []byte { return append([]byte{byte(len(s)), 0}, s...) }
+	long := func(s string) []byte { return append(u16(len(s), 0)[:3], s...) }
+	font := func(twips, color, weight int, name string) []byte {
+		return append(u16(twips, 0, color, weight, 0, 0, 0), short(name)...)
+	}
+	xf := func(font, format, fill, pattern int) []byte {
+		b := make([]byte, 20)
+		le.PutUint16(b, uint16(font))
+		le.PutUint16(b[2:], uint16(format))
+		b[6] = 0x22 // centred, vertically centred
+		le.PutUint32(b[14:], uint32(pattern)<<26)
+		le.PutUint16(b[18:], uint16(fill))
+		return b
+	}
+
+	rec(0x0809, u16(0x0600, 0x0005, 0, 0, 0, 0, 0, 0))
+	rec(0x0031, font(200, 0x7FFF, 400, "Arial"))
+	rec(0x0031, font(240, 10, 700, "Arial"))
+	rec(0x041E, u16(164), long("0.0%"))
+	rec(0x00E0, xf(0, 0, 64, 0))
+	bordered := xf(1, 0, 13, 1)
+	// A thin red left, double blue top and thick black bottom border.
+	le.PutUint32(bordered[10:], 1|6<<8|5<<12|10<<16)
+	le.PutUint32(bordered[14:], le.Uint32(bordered[14:])|12|8<<7)
+	rec(0x00E0, bordered)
+	rec(0x00E0, xf(0, 164, 64, 0))
+	sheetRef := rec(0x0085, u32(0), []byte{0, 0}, short("Data")) + 4
+	// "Héllo" with its characters split across SST and CONTINUE, the
+	// second half in UTF-16.
+	rec(0x00FC, u32(1), u32(1), u16(5), []byte{0}, []byte("H"))
+	rec(0x003C, []byte{1}, u16('é', 'l', 'l', 'o'))
+	rec(0x000A)
+	le.PutUint32(stream[sheetRef:], uint32(len(stream)))
+	rec(0x0809, u16(0x0600, 0x0010, 0, 0, 0, 0, 0, 0))
+	rec(0x007D, u16(1, 1, 20*256, 0, 0, 0))
+	rec(0x00FD, u16(0, 0, 1), u32(0))
+	rec(0x027E, u16(0, 1, 0), u32(42<<2|0x02))
+	rec(0x0006, u16(0, 2, 0), []byte{0, 0, 0, 0, 0, 0, 0xFF, 0xFF}, make([]byte, 6))
+	rec(0x0207, long("calc"))
+	rec(0x0203, u16(1, 0, 2), f64(0.125))
+	rec(0x0205, u16(1, 1, 0), []byte{1, 0})
+	rec(0x0204, u16(2, 0, 0), long("merged"))
+	// A merge, one with its rows swapped and one far outside the cells.
+	rec(0x00E5, u16(3, 2, 2, 0, 1, 2, 1, 1, 2, 1000, 65535, 0, 255))
+	rec(0x000A)
+
+	data := cfbtest.Build("Workbook", stream)
+	if enc := cfbtest.Build("EncryptedPackage", make([]byte, 64)); IsXLS(bytes.NewReader(enc), int64(len(enc))) {
+		t.Error("encrypted package taken for a workbook")
+	}
+	m, err := ParseWorkbookModel(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Sheets) != 1 || m.Sheets[0].Name != "Data" {
+		t.Fatalf("sheets = %v", m.Sheets)
+	}
+	s := m.Sheets[0]
+	if len(s.Rows) != 3 || len(s.ColWidths) != 3 || s.ColWidths[1] != 20*8.3 {
+		t.Fatalf("sheet = %v", s)
+	}
+	cell := func(r, c int) *RenderCell {
+		if s.Rows[r].Cells[c] == nil {
+			t.Fatalf("cell %d,%d missing", r, c)
+		}
+		return s.Rows[r].Cells[c]
+	}
+	for _, tc := range []struct {
+		r, c int
+		ref  string
+		want string
+	}{
+		{0, 0, "A1", "Héllo"},
+		{0, 1, "B1", "42"},
+		{0, 2, "C1", "calc"},
+		{1, 0, "A2", "12.5%"},
+		{1, 1, "B2", "TRUE"},
+		{2, 0, "A3", "merged"},
+	} {
+		if c := cell(tc.r, tc.c); c.Ref != tc.ref || c.Value != tc.want {
+			t.Errorf("cell %s = %q %q, want %q", tc.ref, c.Ref, c.Value, tc.want)
+		}
+	}
+	a1 := cell(0, 0)
+	if a1.Style.BackgroundColor != "FFFF00" || a1.Style.FontSizePt != 12 || a1.Style.FontColor != "FF0000" || a1.Style.HorizontalAlign != "center" {
+		t.Errorf("A1 style = %v", a1.Style)
+	}
+	if len(a1.Runs) != 1 || !a1.Runs[0].Bold {
+		t.Errorf("A1 runs = %v", a1.Runs)
+	}
+	if want := (Borders{Top: Border{Style: "double", Color: "0000FF"}, Bottom: Border{Style: "thick", Color: "000000"}, Left: Border{Style: "thin", Color: "FF0000"}}); a1.Style.Borders != want || a1.Style.BorderColor != "FF0000" {
+		t.Errorf("A1 borders = %v, %q", a1.Style.Borders, a1.Style.BorderColor)
+	}
+	if a3 := cell(2, 0); a3.ColSpan != 2 || s.Rows[2].Cells[1] != nil {
+		t.Errorf("merge not applied: %v", a3)
+	}
+}
+
+func TestWriteWorkbook(t *testing.T) {
+	in := WorkbookModel{Sheets: []RenderSheet{{
+		Name:      "Data",
+		ColWidths: []float64{120, defaultColChars * pxPerChar},
+		ColHidden: []bool{false, false},
+		Rows: []RenderRow{
+			{HeightPx: 40, Cells: []*RenderCell{
+				{Value: "Title", ColSpan: 2, RowSpan: 1, Style: CellStyle{BackgroundColor: "FF0000", HorizontalAlign: "center"}},
+				nil,
+			}},
+			{HeightPx: defaultRowPt * pxPerPt, Cells: []*RenderCell{
+				{Value: "42", ColSpan: 1, RowSpan: 1},
+				{Value: "bold text", ColSpan: 1, RowSpan: 1, Runs: []RenderRun{{Text: "bold", Bold: true}, {Text: " text", VerticalAlign: "superscript"}}},
+			}},
+		},
+	}}}
+	var buf bytes.Buffer
+	if err := WriteWorkbook(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	out, err := ParseWorkbookModel(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Sheets) != 1 || out.Sheets[0].Name != "Data" || len(out.Sheets[0].Rows) != 2 {
+		t.Fatalf("sheets: %v", out.Sheets)
+	}
+	s := out.Sheets[0]
+	if c := s.Rows[0].Cells[0]; c == nil || c.Value != "Title" || c.ColSpan != 2 || c.Style.BackgroundColor != "FF0000" || c.Style.HorizontalAlign != "center" {
+		t.Errorf("merged cell: %v", c)
+	}
+	if c := s.Rows[1].Cells[0]; c == nil || c.Value != "42" {
+		t.Errorf("number cell: %v", c)
+	}
+	if c := s.Rows[1].Cells[1]; c == nil || len(c.Runs) != 2 || !c.Runs[0].Bold || c.Runs[1].VerticalAlign != "superscript" {
+		t.Errorf("rich text cell: %v", c)
+	}
+	if math.Abs(s.ColWidths[0]-120) > 0.01 || math.Abs(s.Rows[0].HeightPx-40) > 0.01 {
+		t.Errorf("width %f, height %f", s.ColWidths[0], s.Rows[0].HeightPx)
+	}
+}
+
+func TestRenderWorkbookPDF(t *testing.T) {
+	s := RenderSheet{Name: "S", ColWidths: []float64{64, 64, 64}, ColHidden: make([]bool, 3), PageSetup: defaultPageSetup()}
+	for r := 0; r < 100; r++ {
+		row := RenderRow{HeightPx: 20}
+		for c := 0; c < 3; c++ {
+			row.Cells = append(row.Cells, &RenderCell{Value: "v", ColSpan: 1, RowSpan: 1})
+		}
+		s.Rows = append(s.Rows, row)
+	}
+	pages := func(s RenderSheet) int {
+		t.Helper()
+		var buf bytes.Buffer
+		if err := RenderWorkbookPDF(&buf, WorkbookModel{Sheets: []RenderSheet{s}}); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")) {
+			t.Fatal("not a PDF")
+		}
+		return bytes.Count(buf.Bytes(), []byte("/Type /Page "))
+	}
+	// 684pt of usable height holds 45 rows of 15pt.
+	if n := pages(s); n != 3 {
+		t.Errorf("pages = %d, want 3", n)
+	}
+	s.PageSetup.TitleRows = &IndexRange{First: 0, Last: 1}
+	s.PageSetup.PrintArea = &CellRange{FirstRow: 0, FirstCol: 0, LastRow: 49, LastCol: 2}
+	if n := pages(s); n != 2 {
+		t.Errorf("pages with print area = %d, want 2", n)
+	}
+	s.PageSetup.FitToPage, s.PageSetup.FitToWidth, s.PageSetup.FitToHeight = true, 1, 1
+	if n := pages(s); n != 1 {
+		t.Errorf("pages with fit to page = %d, want 1", n)
+	}
+
+	// The watermark and banner are drawn on the page.
+	var buf bytes.Buffer
+	if err := RenderWorkbookPDFWith(&buf, WorkbookModel{Sheets: []RenderSheet{s}}, RenderOptions{Watermark: "DRAFT", Banner: "Client"}); err != nil {
+		t.Fatal(err)
+	}
+	_, stream, _ := bytes.Cut(buf.Bytes(), []byte("stream\n"))
+	zr, err := zlib.NewReader(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := io.ReadAll(zr)
+	if !bytes.Contains(content, []byte(" Tm (DRAFT) Tj")) || !bytes.Contains(content, []byte("(Client) Tj")) {
+		t.Errorf("overlays missing from page:\n%s", content)
+	}
+}
+
+func TestCompareWorkbooks(t *testing.T) {
+	sheet := func(name string, values ...string) RenderSheet {
+		s := RenderSheet{Name: name, ColWidths: []float64{64, 64}, ColHidden: []bool{false, false}}
+		for r := 0; r < len(values); r += 2 {
+			row := RenderRow{Cells: make([]*RenderCell, 2)}
+			for c := 0; c < 2; c++ {
+				if v := values[r+c]; v != "" {
+					row.Cells[c] = &RenderCell{Ref: fmt.Sprintf("%c%d", 'A'+c, r/2+1), Value: v, ColSpan: 1, RowSpan: 1}
+				}
+			}
+			s.Rows = append(s.Rows, row)
+		}
+		return s
+	}
+	old := WorkbookModel{Sheets: []RenderSheet{sheet("Data", "a", "1", "b", "2"), sheet("Old", "x", "")}}
+	cur := WorkbookModel{Sheets: []RenderSheet{sheet("Data", "a", "1", "b", "3", "c", "")}}
+	cur.Sheets[0].Rows[0].Cells[1].Style.FontColor = "FF0000"
+
+	d := CompareWorkbooks(old, cur)
+	var got []string
+	for _, ch := range d.Changes {
+		got = append(got, fmt.Sprintf("%s!%s %s %t %t", ch.Sheet, ch.Ref, ch.Kind, ch.ValueChanged, ch.StyleChanged))
+	}
+	want := []string{"Data!B1 modified false true", "Data!B2 modified true false", "Data!A3 added true false", "Old!A1 removed true false"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("changes = %q, want %q", got, want)
+	}
+	if len(d.RemovedSheets) != 1 || len(d.AddedSheets) != 0 {
+		t.Errorf("sheets added %v, removed %v", d.AddedSheets, d.RemovedSheets)
+	}
+	out := RenderWorkbookDiffHTML(d)
+	for _, s := range []string{`data-cell="B2" data-change="modified"><del>2</del>3</td>`, `data-change="added">c</td>`, `<h2 class="removed">Old</h2>`} {
+		if !strings.Contains(out, s) {
+			t.Errorf("%s missing from %s", s, out)
+		}
+	}
+}
+
+func TestSanitizeWorkbook(t *testing.T) {
+	cell := func(ref, v string, rowSpan, colSpan int) *RenderCell {
+		return &RenderCell{Ref: ref, Value: v, RowSpan: rowSpan, ColSpan: colSpan}
+	}
+	// A1:C1 is merged; column B and row 2 are hidden.
+	s := RenderSheet{
+		Name:      "Data",
+		ColWidths: []float64{10, 20, 30},
+		ColHidden: []bool{false, true, false},
+		Rows: []RenderRow{
+			{Cells: []*RenderCell{cell("A1", "title", 1, 3), nil, nil}},
+			{Hidden: true, Cells: []*RenderCell{cell("A2", "secret", 1, 1), nil, nil}},
+			{Cells: []*RenderCell{cell("A3", "a", 1, 1), cell("B3", "salary", 1, 1), cell("C3", "c", 1, 1)}},
+		},
+		PageSetup: PageSetup{TitleRows: &IndexRange{First: 1, Last: 2}},
+		Images:    []SheetImage{{Name: "on B3", Row: 2, Col: 1}, {Name: "on C3", Row: 2, Col: 2}, {Name: "on E5", Row: 4, Col: 4}},
+	}
+	s.Rows[2].Cells[0].Comments = []CellComment{{Author: "HR", Text: "confidential"}}
+	m := WorkbookModel{Sheets: []RenderSheet{{Name: "Hidden", Hidden: true}, s}}
+
+	SanitizeWorkbook(&m)
+	if len(m.Sheets) != 1 || m.Sheets[0].Name != "Data" {
+		t.Fatalf("sheets = %v", m.Sheets)
+	}
+	got := m.Sheets[0]
+	var cells []string
+	for _, row := range got.Rows {
+		for _, c := range row.Cells {
+			if c != nil {
+				cells = append(cells, fmt.Sprintf("%s=%s/%d", c.Ref, c.Value, c.ColSpan))
+			}
+		}
+	}
+	if want := []string{"A1=title/2", "A2=a/1", "B2=c/1"}; !reflect.DeepEqual(cells, want) {
+		t.Errorf("cells = %q, want %q", cells, want)
+	}
+	if !reflect.DeepEqual(got.ColWidths, []float64{10, 30}) || *got.PageSetup.TitleRows != (IndexRange{First: 1, Last: 1}) {
+		t.Errorf("widths %v, title rows %v", got.ColWidths, got.PageSetup.TitleRows)
+	}
+	if c := got.Rows[1].Cells[0]; c.Comments != nil {
+		t.Errorf("comments kept: %v", c.Comments)
+	}
+	if want := []SheetImage{{Name: "on C3", Row: 1, Col: 1}, {Name: "on E5", Row: 3, Col: 3}}; !reflect.DeepEqual(got.Images, want) {
+		t.Errorf("images = %v, want %v", got.Images, want)
+	}
+}
+
+func TestRenderWorkbookWatermark(t *testing.T) {
+	m := WorkbookModel{Sheets: []RenderSheet{{Name: "A"}, {Name: "B"}}}
+	out := RenderWorkbookHTMLWith(m, RenderOptions{Watermark: "DRAFT", Banner: "Confidential"})
+	if strings.Count(out, `class="sheet-watermark"`) != 2 || strings.Count(out, `class="sheet-banner"`) != 2 {
+		t.Errorf("overlays missing: %s", out)
+	}
+}
+
+func TestRenderWorkbookDebug(t *testing.T) {
+	defer func(old bool) { DebugHTML = old }(DebugHTML)
+	DebugHTML = false
+	m := WorkbookModel{Sheets: []RenderSheet{{
+		Name:      "A",
+		ColWidths: []float64{64},
+		ColHidden: []bool{false},
+		Rows:      []RenderRow{{Cells: []*RenderCell{{Ref: "A1", Value: "x", ColSpan: 1, RowSpan: 1}}}},
+	}}}
+	if out := RenderWorkbookHTMLWith(m, RenderOptions{}); strings.Contains(out, "data-style") {
+		t.Error("debug attributes without Debug")
+	}
+	if out := RenderWorkbookHTMLWith(m, RenderOptions{Debug: true}); !strings.Contains(out, "data-style") {
+		t.Error("debug attributes missing with Debug")
+	}
+}
+
+func TestEncodeWorkbookModel(t *testing.T) {
+	m := WorkbookModel{Sheets: []RenderSheet{{
+		Name:      "Data",
+		ColWidths: []float64{64, 64},
+		ColHidden: []bool{false, true},
+		Rows: []RenderRow{{HeightPx: 20, Cells: []*RenderCell{
+			{Ref: "A1", Value: "x", ColSpan: 1, RowSpan: 1, Runs: []RenderRun{{Text: "x", Bold: true}}},
+			nil,
+		}}},
+		PageSetup: PageSetup{PrintArea: &CellRange{LastRow: 0, LastCol: 1}},
+	}}}
+	var buf bytes.Buffer
+	if err := EncodeWorkbookModel(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeWorkbookModel(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("got %v, want %v", got, m)
+	}
+	if _, err := DecodeWorkbookModel(strings.NewReader(`{"version": 0}`)); !errors.Is(err, ErrModelVersion) {
+		t.Errorf("missing version: err = %v", err)
+	}
+}
+
+func TestNativeBackend(t *testing.T) {
+	in := WorkbookModel{Sheets: []RenderSheet{{
+		Name:      "Data",
+		TabColor:  "00B050",
+		ColWidths: []float64{120, 64, defaultColChars * pxPerChar},
+		ColHidden: []bool{false, true, false},
+		Rows: []RenderRow{
+			{HeightPx: 40, Cells: []*RenderCell{
+				{Value: "Title", ColSpan: 3, RowSpan: 1, Style: CellStyle{BackgroundColor: "FF0000", HorizontalAlign: "center", FontColor: "0000FF"}},
+				nil, nil,
+			}},
+			{HeightPx: defaultRowPt * pxPerPt, Hidden: true, Cells: []*RenderCell{
+				{Value: "42", ColSpan: 1, RowSpan: 1},
+				{Value: "-1.5", ColSpan: 1, RowSpan: 1, Style: CellStyle{WrapText: true, VerticalAlign: "top"}},
+				{Value: "bold text", ColSpan: 1, RowSpan: 1, Runs: []RenderRun{{Text: "bold", Bold: true}, {Text: " text", Italic: true}}},
+			}},
+		},
+	}, {Name: "Secret", Hidden: true, ColWidths: []float64{64}, ColHidden: []bool{false}, Rows: []RenderRow{{Cells: []*RenderCell{{Value: "x", ColSpan: 1, RowSpan: 1}}}}}}}
+	var buf bytes.Buffer
+	if err := WriteWorkbook(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	want, err := Unioffice.ParseWorkbook(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Native.ParseWorkbook(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	Walk(&want, Visitor{Cell: func(c *RenderCell) error { c.Cell = nil; return nil }})
+	// unioffice reads no text from rich inline strings.
+	want.Sheets[0].Rows[1].Cells[2].Value = "bold text"
+	want.Sheets[0].Rows[1].Cells[2].Raw = "bold text"
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("native model differs:\n got %v\nwant %v", got.Sheets, want.Sheets)
+		for i := range min(len(got.Sheets), len(want.Sheets)) {
+			for r := range min(len(got.Sheets[i].Rows), len(want.Sheets[i].Rows)) {
+				for c, cell := range want.Sheets[i].Rows[r].Cells {
+					if g := got.Sheets[i].Rows[r].Cells; c < len(g) && !reflect.DeepEqual(g[c], cell) {
+						t.Errorf("%d/%d/%d: got %v, want %v", i, r, c, g[c], cell)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestWorkbookText(t *testing.T) {
+	m := WorkbookModel{Sheets: []RenderSheet{
+		{Name: "One", Rows: []RenderRow{
+			{Cells: []*RenderCell{{Value: "a"}, nil, {Value: "c"}, {Value: ""}}},
+			{Cells: []*RenderCell{nil, nil}},
+			{Cells: []*RenderCell{nil, {Value: "b2"}}},
+		}},
+		{Name: "Two", Rows: []RenderRow{{Cells: []*RenderCell{{Value: "x"}}}}},
+	}}
+	if got, want := WorkbookText(m), "One\na\t\tc\n\tb2\n\nTwo\nx\n"; got != want {
+		t.Errorf("WorkbookText = %q, want %q", got, want)
+	}
+}
+
+func TestRenderWorkbookFonts(t *testing.T) {
+	cell := func(font string) *RenderCell {
+		return &RenderCell{Value: font, ColSpan: 1, RowSpan: 1, Style: CellStyle{FontFamily: font}}
+	}
+	m := WorkbookModel{Sheets: []RenderSheet{{Name: "S", ColWidths: []float64{64}, ColHidden: []bool{false}, Rows: []RenderRow{
+		{Cells: []*RenderCell{cell("Calibri")}}, {Cells: []*RenderCell{cell("Calibri")}}, {Cells: []*RenderCell{cell("Courier New")}},
+	}}}}
+	html := RenderWorkbookHTMLWith(m, RenderOptions{})
+	if !strings.Contains(html, "font-family:'Calibri','Carlito',sans-serif;") || !strings.Contains(html, "font-family:'Courier New','Liberation Mono','Cousine','Courier',monospace;") {
+		t.Errorf("default substitutes missing:\n%s", html)
+	}
+	if html := RenderWorkbookHTMLWith(m, RenderOptions{FontSubstitutes: fonts.Substitutes{}}); strings.Contains(html, "Carlito") {
+		t.Errorf("substitutes not disabled:\n%s", html)
+	}
+}
+
+func TestRenderWorkbookRepairsText(t *testing.T) {
+	m := WorkbookModel{Sheets: []RenderSheet{{Name: "S\x01", ColWidths: []float64{64}, ColHidden: []bool{false}, Rows: []RenderRow{
+		{Cells: []*RenderCell{{Value: "nul\x00 bad\xfe", ColSpan: 1, RowSpan: 1}}},
+	}}}}
+	html := RenderWorkbookHTMLWith(m, RenderOptions{})
+	if !strings.Contains(html, "nul bad�") || strings.ContainsAny(html, "\x00\x01") {
+		t.Errorf("text not repaired: %q", html)
+	}
+}
+
+func TestRenderWorkbookReproducible(t *testing.T) {
+	cell := func(font string, wrap bool) *RenderCell {
+		return &RenderCell{Value: font, ColSpan: 1, RowSpan: 1, Style: CellStyle{FontFamily: font, FontSizePt: float64(len(font)), WrapText: wrap}}
+	}
+	m := WorkbookModel{Sheets: []RenderSheet{{Name: "S", ColWidths: []float64{64}, ColHidden: []bool{false}, Rows: []RenderRow{
+		{Cells: []*RenderCell{cell("Arial", true)}}, {Cells: []*RenderCell{cell("Calibri", false)}},
+	}}}}
+	want := RenderWorkbookHTMLWith(m, RenderOptions{})
+	for i := 0; i < 20; i++ {
+		if html := RenderWorkbookHTMLWith(m, RenderOptions{}); html != want {
+			t.Fatalf("output differs between runs:\n%s\n%s", want, html)
+		}
+	}
+}
+
+func TestParseInternsValues(t *testing.T) {
+	var rows []RenderRow
+	for i := 0; i < 4; i++ {
+		rows = append(rows, RenderRow{HeightPx: 20, Cells: []*RenderCell{
+			{Value: "bold text", ColSpan: 1, RowSpan: 1, Runs: []RenderRun{{Text: "bold", Bold: true}, {Text: " text"}}},
+			{Value: "repeated", ColSpan: 1, RowSpan: 1},
+			{Value: "1.5", ColSpan: 1, RowSpan: 1},
+		}})
+	}
+	in := WorkbookModel{Sheets: []RenderSheet{{Name: "Data", ColWidths: []float64{64, 64, 64}, ColHidden: []bool{false, false, false}, Rows: rows}}}
+	var buf bytes.Buffer
+	if err := WriteWorkbook(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	for name, b := range map[string]Backend{"unioffice": Unioffice, "native": Native} {
+		m, err := b.ParseWorkbook(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows := m.Sheets[0].Rows
+		first, last := rows[0].Cells, rows[len(rows)-1].Cells
+		for c := range first {
+			if first[c].Value != last[c].Value || unsafe.StringData(first[c].Value) != unsafe.StringData(last[c].Value) {
+				t.Errorf("%s: column %d values %q and %q are not shared", name, c, first[c].Value, last[c].Value)
+			}
+		}
+		if r1, r2 := first[0].Runs, last[0].Runs; len(r1) != 2 || len(r2) != 2 || unsafe.StringData(r1[0].Text) != unsafe.StringData(r2[0].Text) {
+			t.Errorf("%s: run text is not shared: %v %v", name, r1, r2)
+		} else if &r1[0] == &r2[0] {
+			t.Errorf("%s: cells share a run slice", name)
+		}
+	}
+}
+
+func TestDangerousFormulas(t *testing.T) {
+	wb := spreadsheet.New()
+	s := wb.AddSheet()
+	dde := s.Cell("A1")
+	dde.SetFormulaRaw("cmd|'/c calc'!A1")
+	dde.SetCachedFormulaResult("#N/A")
+	sum := s.Cell("B1")
+	sum.SetFormulaRaw("SUM(1,2)")
+	sum.SetCachedFormulaResult("3")
+	s.Cell("C1").SetString("=HYPERLINK(\"x\")+cmd|' /C notepad'!'A1'")
+	s.Cell("D1").SetString("a | b")
+	var buf bytes.Buffer
+	if err := wb.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for name, b := range map[string]Backend{"unioffice": Unioffice, "native": Native} {
+		m, err := b.ParseWorkbook(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cells := m.Sheets[0].Rows[0].Cells
+		var got []string
+		for _, c := range cells {
+			got = append(got, c.Unsafe)
+		}
+		want := []string{"=cmd|'/c calc'!A1", "", "=HYPERLINK(\"x\")+cmd|' /C notepad'!'A1'", ""}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: unsafe = %q, want %q", name, got, want)
+		}
+		if len(m.Warnings) != 2 || m.Warnings[0].Code != diag.DangerousFormula || m.Warnings[0].Location.Cell != "A1" {
+			t.Errorf("%s: warnings = %v", name, m.Warnings)
+		}
+		out := RenderWorkbookHTMLWith(m, RenderOptions{DefangFormulas: true})
+		if !strings.Contains(out, `&#x26A0; =cmd|&#39;/c calc&#39;!A1</span>`) || strings.Contains(out, "#N/A") {
+			t.Errorf("%s: formula not defanged: %s", name, out)
+		}
+	}
+}
+
+func TestOpenWorkbook(t *testing.T) {
+	sheet := func(name, v string) RenderSheet {
+		return RenderSheet{Name: name, ColWidths: []float64{64}, ColHidden: []bool{false}, Rows: []RenderRow{{Cells: []*RenderCell{{Value: v, ColSpan: 1, RowSpan: 1}}}}}
+	}
+	var buf bytes.Buffer
+	if err := WriteWorkbook(&buf, WorkbookModel{Sheets: []RenderSheet{sheet("Summary", "total"), sheet("Detail", "row")}}); err != nil {
+		t.Fatal(err)
+	}
+	r := bytes.NewReader(buf.Bytes())
+	w, err := OpenWorkbook(r, r.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := w.SheetNames(); !reflect.DeepEqual(names, []string{"Summary", "Detail"}) {
+		t.Errorf("SheetNames() = %q", names)
+	}
+	rs, err := w.Sheet("summary")
+	if err != nil || rs.Name != "Summary" || rs.Rows[0].Cells[0].Value != "total" {
+		t.Fatalf("Sheet(summary) = %v, %v", rs, err)
+	}
+	if w.parsed[1] != nil {
+		t.Error("unrequested sheet was parsed")
+	}
+	if again, _ := w.Sheet("Summary"); again != rs {
+		t.Error("sheet parsed twice")
+	}
+	if _, err := w.Sheet("Missing"); !errors.Is(err, ErrNoSheet) {
+		t.Errorf("Sheet(Missing) error = %v", err)
+	}
+	got, err := w.Model()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Native.ParseWorkbook(r, r.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Model() = %v, want %v", got.Sheets, want.Sheets)
+	}
+}
+
+func TestCellReferences(t *testing.T) {
+	for col, name := range map[int]string{0: "A", 25: "Z", 26: "AA", 701: "ZZ", 702: "AAA", maxCols - 1: "XFD"} {
+		if got := columnName(col); got != name {
+			t.Errorf("columnName(%d) = %q, want %q", col, got, name)
+		}
+		if got := columnIndex(strings.ToLower(name)); got != col {
+			t.Errorf("columnIndex(%q) = %d, want %d", name, got, col)
+		}
+	}
+	if got := columnIndex("XFE"); got != -1 {
+		t.Errorf("columnIndex(XFE) = %d beyond Excel's columns", got)
+	}
+	from, to, err := parseRangeRef("'My Sheet'!$B$2:AA10")
+	if err != nil || from != (cellRef{1, 1}) || to != (cellRef{9, 26}) {
+		t.Errorf("parseRangeRef = %v, %v, %v", from, to, err)
+	}
+	for _, bad := range []string{"A1", "A0:B2", "1:2", "A:B", "A1:B1048577", "B2:A1?"} {
+		if _, _, err := parseRangeRef(bad); err == nil {
+			t.Errorf("parseRangeRef(%q) accepted", bad)
+		}
+	}
+	for s, want := range map[string]bool{"42": true, "-1.5": true, "1.5E+10": true, "1e5": false, ".5": false, "1,5": false, "": false} {
+		if got := isNumber(s); got != want {
+			t.Errorf("isNumber(%q) = %v", s, got)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	merged := &RenderCell{Ref: "A1", Value: "m", ColSpan: 2, RowSpan: 2}
+	m := WorkbookModel{Sheets: []RenderSheet{
+		{Name: "One", ColWidths: []float64{1, 2, 3}, ColHidden: []bool{false, false, false}, Rows: []RenderRow{
+			{Cells: []*RenderCell{merged, nil, {Ref: "C1", Value: "c", ColSpan: 1, RowSpan: 1}}},
+			{Cells: []*RenderCell{nil, nil, {Ref: "C2", Value: "d", ColSpan: 1, RowSpan: 1}}},
+		}},
+		{Name: "Two"},
+	}}
+	got, err := Select(m, []string{"one"}, "A1:B1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Sheets) != 1 || len(got.Sheets[0].Rows) != 1 || len(got.Sheets[0].Rows[0].Cells) != 2 || !reflect.DeepEqual(got.Sheets[0].ColWidths, []float64{1, 2}) {
+		t.Fatalf("Select() = %v", got.Sheets)
+	}
+	if c := got.Sheets[0].Rows[0].Cells[0]; c.ColSpan != 2 || c.RowSpan != 1 || merged.RowSpan != 2 {
+		t.Errorf("merged cell clipped to %dx%d, original now %dx%d", c.RowSpan, c.ColSpan, merged.RowSpan, merged.ColSpan)
+	}
+	if _, err := Select(m, []string{"Three"}, ""); !errors.Is(err, ErrNoSheet) {
+		t.Errorf("unknown sheet: err = %v", err)
+	}
+	if _, err := Select(m, nil, "A1:?"); err == nil {
+		t.Error("malformed range accepted")
+	}
+}
+
+func TestRenderWorkbookUnits(t *testing.T) {
+	m := WorkbookModel{Sheets: []RenderSheet{{Name: "S", ColWidths: []float64{83}, ColHidden: []bool{false}, Rows: []RenderRow{
+		{HeightPx: 20, Cells: []*RenderCell{{Value: "x", ColSpan: 1, RowSpan: 1, Style: CellStyle{IndentPx: 16}}}},
+	}}}}
+	if html := RenderWorkbookHTMLWith(m, RenderOptions{}); !strings.Contains(html, "width:83px") || !strings.Contains(html, "height:20px") || !strings.Contains(html, "padding-left:16px") {
+		t.Errorf("default units not kept:\n%s", html)
+	}
+	html := RenderWorkbookHTMLWith(m, RenderOptions{Units: Units{PxPerPt: 2 * DefaultUnits.PxPerPt, PxPerChar: 16.6, IndentPx: 4}})
+	for _, want := range []string{`<table class="table" style="width:166px;">`, `<col style="width:166px;">`, "height:40px", "padding-left:8px"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("%q missing:\n%s", want, html)
+		}
+	}
+}
+
+// localeFormatter formats numbers with a decimal comma for "de-DE" and
+// shows negative numbers in red.
+type localeFormatter struct{}
+
+func (localeFormatter) FormatNumber(v float64, code, locale string) (string, string) {
+	text, _ := DefaultNumberFormatter.FormatNumber(v, code, locale)
+	if locale == "de-DE" {
+		text = strings.ReplaceAll(text, ".", ",")
+	}
+	if v < 0 {
+		return text, "FF0000"
+	}
+	return text, ""
+}
+
+func (localeFormatter) FormatText(s, code, locale string) (string, string) {
+	return DefaultNumberFormatter.FormatText(s, code, locale)
+}
+
+func TestNumberFormatter(t *testing.T) {
+	in := WorkbookModel{Sheets: []RenderSheet{{Name: "S", ColWidths: []float64{64, 64, 64}, ColHidden: []bool{false, false, false}, Rows: []RenderRow{{Cells: []*RenderCell{
+		{Value: "1.5", ColSpan: 1, RowSpan: 1}, {Value: "-2.25", ColSpan: 1, RowSpan: 1}, {Value: "a.b", ColSpan: 1, RowSpan: 1},
+	}}}}}}
+	var buf bytes.Buffer
+	if err := WriteWorkbook(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range []Backend{Unioffice, Native} {
+		m, err := WithNumberFormatter(b, localeFormatter{}, "de-DE").ParseWorkbook(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cells := m.Sheets[0].Rows[0].Cells
+		if cells[0].Value != "1,5" || cells[1].Value != "-2,25" || cells[2].Value != "a.b" {
+			t.Errorf("%T: values %q %q %q", b, cells[0].Value, cells[1].Value, cells[2].Value)
+		}
+		if cells[0].Style.FontColor != "" || cells[1].Style.FontColor != "FF0000" {
+			t.Errorf("%T: colours %q %q", b, cells[0].Style.FontColor, cells[1].Style.FontColor)
+		}
+		if m, _ := b.ParseWorkbook(bytes.NewReader(buf.Bytes()), int64(buf.Len())); m.Sheets[0].Rows[0].Cells[0].Value != "1.5" {
+			t.Errorf("%T: default formatting changed: %q", b, m.Sheets[0].Rows[0].Cells[0].Value)
+		}
+	}
+}
+
+func TestUpdateWorkbook(t *testing.T) {
+	sheet := func(name, value string) RenderSheet {
+		return RenderSheet{Name: name, ColWidths: []float64{64}, ColHidden: []bool{false}, Rows: []RenderRow{{Cells: []*RenderCell{{Value: value, ColSpan: 1, RowSpan: 1}}}}}
+	}
+	save := func(sheets ...RenderSheet) *bytes.Reader {
+		var buf bytes.Buffer
+		if err := WriteWorkbook(&buf, WorkbookModel{Sheets: sheets}); err != nil {
+			t.Fatal(err)
+		}
+		return bytes.NewReader(buf.Bytes())
+	}
+	v1 := save(sheet("A", "alpha"), sheet("B", "beta"), sheet("C", "gamma"))
+	old, err := FingerprintWorkbook(v1, v1.Size())
+	if err != nil || len(old.Sheets) != 3 {
+		t.Fatalf("FingerprintWorkbook() = %v, %v", old, err)
+	}
+
+	// Adding a string to B renumbers the shared strings of C, which stays
+	// unchanged.
+	b := sheet("B", "beta 2")
+	b.Rows = append(b.Rows, RenderRow{Cells: []*RenderCell{{Value: "more", ColSpan: 1, RowSpan: 1}}})
+	v2 := save(sheet("A", "alpha"), b, sheet("C", "gamma"))
+	u, err := UpdateWorkbook(old, v2, v2.Size(), RenderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(u.Changed) != 1 || u.Changed[0].Name != "B" || !strings.Contains(u.Changed[0].HTML, "beta 2") {
+		t.Errorf("Changed = %v", u.Changed)
+	}
+	if !reflect.DeepEqual(u.Unchanged, []string{"A", "C"}) || u.Removed != nil {
+		t.Errorf("Unchanged = %v, Removed = %v", u.Unchanged, u.Removed)
+	}
+
+	v3 := save(sheet("A", "alpha"), b)
+	if u, err = UpdateWorkbook(u.Manifest, v3, v3.Size(), RenderOptions{}); err != nil || len(u.Changed) != 0 || !reflect.DeepEqual(u.Removed, []string{"C"}) {
+		t.Errorf("UpdateWorkbook() = %+v, %v", u, err)
+	}
+
+	// Fragments of differently styled sheets patched into one page keep
+	// their styles and ids to themselves.
+	red, blue := sheet("Red", "r"), sheet("Blue", "b")
+	red.Rows[0].Cells[0].Style.FontColor = "FF0000"
+	blue.Rows[0].Cells[0].Style.FontColor = "0000FF"
+	v4 := save(red, blue)
+	if u, err = UpdateWorkbook(Manifest{}, v4, v4.Size(), RenderOptions{}); err != nil || len(u.Changed) != 2 {
+		t.Fatalf("UpdateWorkbook() = %+v, %v", u, err)
+	}
+	if u.Changed[0].Scope == u.Changed[1].Scope || u.Changed[0].Scope != sheetScope("", "Red") {
+		t.Errorf("scopes %q and %q", u.Changed[0].Scope, u.Changed[1].Scope)
+	}
+	page := u.Changed[0].HTML + u.Changed[1].HTML
+	ids := map[string]bool{}
+	for _, m := range regexp.MustCompile(`id="([^"]+)"`).FindAllStringSubmatch(page, -1) {
+		if ids[m[1]] {
+			t.Errorf("id %q repeated", m[1])
+		}
+		ids[m[1]] = true
+	}
+	for _, f := range u.Changed {
+		style := regexp.MustCompile(`(?s)<style>(.*?)</style>`).FindStringSubmatch(f.HTML)
+		for _, rule := range strings.Split(style[1], "}") {
+			if rule = strings.TrimSpace(rule); rule != "" && !strings.HasPrefix(rule, "#"+f.Scope+" ") && !strings.HasPrefix(rule, "@") {
+				t.Errorf("%s: rule %q not scoped", f.Name, rule)
+			}
+		}
+	}
+}
+
+func TestCellRenderers(t *testing.T) {
+	m := WorkbookModel{Sheets: []RenderSheet{{Name: "S", ColWidths: []float64{64, 64}, ColHidden: []bool{false, false}, Rows: []RenderRow{{Cells: []*RenderCell{
+		{Ref: "A1", Value: "CVE-2024-3094", ColSpan: 1, RowSpan: 1}, {Ref: "B1", Value: "x < y", ColSpan: 1, RowSpan: 1},
+	}}}}}}
+	html := RenderWorkbookHTMLWith(m, RenderOptions{CellRenderers: []CellRenderer{
+		{Match: regexp.MustCompile(`^CVE-\d{4}-\d+$`), Render: func(c *RenderCell, _ func() string) string {
+			return `<a href="https://nvd.nist.gov/vuln/detail/` + c.Value + `">` + c.Value + "</a>"
+		}},
+		{Render: func(_ *RenderCell, builtin func() string) string { return "<b>" + builtin() + "</b>" }},
+	}})
+	for _, want := range []string{`<a href="https://nvd.nist.gov/vuln/detail/CVE-2024-3094">CVE-2024-3094</a></td>`, "<b>x &lt; y</b></td>"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("%q missing:\n%s", want, html)
+		}
+	}
+}
+
+func TestRenderWorkbookHTMLTo(t *testing.T) {
+	var rows []RenderRow
+	for i := range 5000 {
+		rows = append(rows, RenderRow{Cells: []*RenderCell{{Ref: fmt.Sprintf("A%d", i+1), Value: fmt.Sprintf("row %d\x00 of many", i), ColSpan: 1, RowSpan: 1}}})
+	}
+	m := WorkbookModel{Sheets: []RenderSheet{{Name: "S", ColWidths: []float64{64}, ColHidden: []bool{false}, Rows: rows}}}
+	opts := RenderOptions{NormalizeText: strings.ToUpper}
+	var buf bytes.Buffer
+	if err := RenderWorkbookHTMLTo(&buf, m, opts); err != nil {
+		t.Fatal(err)
+	}
+	if want := RenderWorkbookHTMLWith(m, opts); buf.String() != want {
+		t.Errorf("streamed HTML differs: %d bytes, want %d", buf.Len(), len(want))
+	}
+	if strings.Contains(buf.String(), "\x00") {
+		t.Error("control character not removed")
+	}
+	if err := RenderWorkbookHTMLTo(failingWriter{}, m, opts); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("err = %v, want %v", err, os.ErrClosed)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, os.ErrClosed }
+
+func TestRenderSheetIndex(t *testing.T) {
+	m := WorkbookModel{Sheets: []RenderSheet{
+		{Name: "Summary", TabColor: "FF0000", ColWidths: []float64{64, 64}, ColHidden: []bool{false, false}, Rows: []RenderRow{{}, {}, {}}},
+		{Name: "Raw <data>", Hidden: true, ColWidths: []float64{64}, ColHidden: []bool{false}, Rows: []RenderRow{{}}},
+	}}
+	html := RenderWorkbookHTMLWith(m, RenderOptions{SheetIndex: true})
+	for _, want := range []string{
+		`<nav class="sheet-index">`, `style="background-color:#FF0000;"`, `<a href="#sheet-1">Summary</a>`, "3 rows × 2 columns",
+		`<a href="#sheet-2">Raw &lt;data&gt;</a>`, "(hidden)", `id="sheet-2"`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("%q missing:\n%s", want, html)
+		}
+	}
+	if html := RenderWorkbookHTMLWith(m, RenderOptions{SheetIndex: true, SkipHiddenSheets: true}); strings.Contains(html, "sheet-index\"") {
+		t.Errorf("index written for one sheet:\n%s", html)
+	}
+	if html := RenderWorkbookHTMLWith(m, RenderOptions{SheetIndex: true, Scope: "book"}); !strings.Contains(html, `<a href="#book-sheet-1">`) || !strings.Contains(html, `id="book-sheet-1"`) {
+		t.Errorf("index links not scoped:\n%s", html)
+	}
+}
+
+func TestSheetImages(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteWorkbook(&buf, WorkbookModel{Sheets: []RenderSheet{{Name: "S", ColWidths: []float64{64, 80}, ColHidden: []bool{false, false},
+		Rows: []RenderRow{{Cells: []*RenderCell{{Value: "x", ColSpan: 1, RowSpan: 1}, nil}}}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Add a drawing with a picture at B2, 4px in, and one spanning A1:B3.
+	png := []byte("\x89PNG\r\n\x1a\n")
+	const rel = `<?xml version="1.0"?><Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/%s" Target="%s"/></Relationships>`
+	const pic = `<xdr:pic><xdr:nvPicPr><xdr:cNvPr id="%d" name="Picture %[1]d" descr="%s"/><xdr:cNvPicPr/></xdr:nvPicPr><xdr:blipFill><a:blip r:embed="rId1"/></xdr:blipFill><xdr:spPr>%s</xdr:spPr></xdr:pic>`
+	parts := map[string]string{
+		"xl/worksheets/_rels/sheet1.xml.rels": fmt.Sprintf(rel, "drawing", "../drawings/drawing1.xml"),
+		"xl/drawings/_rels/drawing1.xml.rels": fmt.Sprintf(rel, "image", "../media/image1.png"),
+		"xl/media/image1.png":                 string(png),
+		"xl/drawings/drawing1.xml": `<?xml version="1.0"?><xdr:wsDr xmlns:xdr="http://schemas.openxmlformats.org/drawingml/2006/spreadsheetDrawing" xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<xdr:oneCellAnchor><xdr:from><xdr:col>1</xdr:col><xdr:colOff>38100</xdr:colOff><xdr:row>1</xdr:row><xdr:rowOff>0</xdr:rowOff></xdr:from><xdr:ext cx="952500" cy="476250"/>` +
+			fmt.Sprintf(pic, 2, "Logo", "") + `<xdr:clientData/></xdr:oneCellAnchor>` +
+			`<xdr:twoCellAnchor><xdr:from><xdr:col>0</xdr:col><xdr:colOff>0</xdr:colOff><xdr:row>0</xdr:row><xdr:rowOff>0</xdr:rowOff></xdr:from><xdr:to><xdr:col>1</xdr:col><xdr:colOff>0</xdr:colOff><xdr:row>2</xdr:row><xdr:rowOff>0</xdr:rowOff></xdr:to>` +
+			fmt.Sprintf(pic, 3, "", "") + `<xdr:clientData/></xdr:twoCellAnchor></xdr:wsDr>`,
+	}
+	out := patchPackage(t, buf.Bytes(), parts, func(name string, data []byte) []byte {
+		switch name {
+		case "xl/worksheets/sheet1.xml":
+			return bytes.Replace(data, []byte("</ma:worksheet>"), []byte(`<ma:drawing r:id="rId1"/></ma:worksheet>`), 1)
+		case "[Content_Types].xml":
+			return bytes.Replace(data, []byte("</Types>"), []byte(`<Override ContentType="application/vnd.openxmlformats-officedocument.drawing+xml" PartName="/xl/drawings/drawing1.xml"/></Types>`), 1)
+		}
+		return data
+	})
+
+	want := []SheetImage{
+		{PartName: "xl/media/image1.png", ContentType: "image/png", Data: png, Name: "Picture 2", AltText: "Logo", Row: 1, Col: 1, OffsetXPx: 4, WidthPx: 100, HeightPx: 50},
+		{PartName: "xl/media/image1.png", ContentType: "image/png", Data: png, Name: "Picture 3", WidthPx: 64, HeightPx: 2 * defaultRowPt * pxPerPt},
+	}
+	var m WorkbookModel
+	for _, b := range []Backend{Unioffice, Native} {
+		if m, err = b.ParseWorkbook(bytes.NewReader(out.Bytes()), int64(out.Len())); err != nil {
+			t.Fatal(err)
+		}
+		if got := m.Sheets[0].Images; !reflect.DeepEqual(got, want) {
+			t.Errorf("%T: Images = %v, want %v", b, got, want)
+		}
+	}
+
+	html := RenderWorkbookHTMLWith(m, RenderOptions{})
+	for _, want := range []string{`<div class="sheet-grid" style="position:relative;width:max-content;">`,
+		`alt="Logo" style="position:absolute;left:68px;top:20px;width:100px;height:50px;"`, `src="data:image/png;base64,`} {
+		if !strings.Contains(html, want) {
+			t.Errorf("%q missing:\n%s", want, html)
+		}
+	}
+	if html := RenderWorkbookHTMLWith(m, RenderOptions{RedactImages: true}); strings.Contains(html, "<img") || !strings.Contains(html, "data-redacted") {
+		t.Errorf("pictures not redacted:\n%s", html)
+	}
+	failing := RenderOptions{ImageHandler: func(media.Image) (string, error) { return "", os.ErrPermission }}
+	if err := RenderWorkbookHTMLTo(io.Discard, m, failing); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("handler error = %v", err)
+	}
+	if _, err := UpdateWorkbook(Manifest{}, bytes.NewReader(out.Bytes()), int64(out.Len()), failing); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("UpdateWorkbook: handler error = %v", err)
+	}
+	rewrite := RenderOptions{URLRewriter: func(u string) (string, bool) { return "/proxy?" + u[:10], true }}
+	if html := RenderWorkbookHTMLWith(m, rewrite); !strings.Contains(html, `src="/proxy?data:image"`) {
+		t.Errorf("src not rewritten:\n%s", html)
+	}
+	rewrite.URLRewriter = func(string) (string, bool) { return "", false }
+	if html := RenderWorkbookHTMLWith(m, rewrite); strings.Contains(html, "<img") || !strings.Contains(html, "[Logo]") {
+		t.Errorf("dropped src still shown:\n%s", html)
+	}
+	if sel, err := Select(m, nil, "B2:C3"); err != nil || len(sel.Sheets[0].Images) != 1 || sel.Sheets[0].Images[0].Row != 0 || sel.Sheets[0].Images[0].Col != 0 {
+		t.Errorf("Select() = %v, %v", sel.Sheets[0].Images, err)
+	}
+}
+
+// patchPackage returns the package pkg with its parts passed through edit
+// and then replaced by or added from parts.
+func patchPackage(t *testing.T, pkg []byte, parts map[string]string, edit func(name string, data []byte) []byte) *bytes.Buffer {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(pkg), int64(len(pkg)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	zw := zip.NewWriter(&out)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		data = edit(f.Name, data)
+		if s, ok := parts[f.Name]; ok {
+			data = []byte(s)
+		}
+		w, _ := zw.Create(f.Name)
+		w.Write(data)
+	}
+	for name, s := range parts {
+		if _, err := zr.Open(name); err != nil {
+			w, _ := zw.Create(name)
+			w.Write([]byte(s))
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &out
+}
+
+func TestCellComments(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteWorkbook(&buf, WorkbookModel{Sheets: []RenderSheet{{Name: "S", ColWidths: []float64{64, 64}, ColHidden: []bool{false, false},
+		Rows: []RenderRow{{Cells: []*RenderCell{{Ref: "A1", Value: "merged", ColSpan: 2, RowSpan: 1}, nil}}}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// B1 (covered by the merge) has a thread of two, mirrored by a note;
+	// A3, beyond the grid, has a note.
+	const rels = `<?xml version="1.0"?><Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">%s</Relationships>`
+	const rel = `<Relationship Id="%s" Type="http://schemas.%s/relationships/%s" Target="%s"/>`
+	parts := map[string]string{
+		"xl/worksheets/_rels/sheet1.xml.rels": fmt.Sprintf(rels, fmt.Sprintf(rel, "rId1", "openxmlformats.org/officeDocument/2006", "comments", "../comments1.xml")+
+			fmt.Sprintf(rel, "rId2", "microsoft.com/office/2017/10", "threadedComment", "../threadedComments/threadedComment1.xml")+
+			fmt.Sprintf(rel, "rId3", "openxmlformats.org/officeDocument/2006", "vmlDrawing", "../drawings/vmlDrawing1.vml")),
+		"xl/comments1.xml": `<?xml version="1.0"?><comments xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><authors><author>tc={1}</author><author>Ann</author></authors><commentList>` +
+			`<comment ref="B1" authorId="0"><text><t>[Threaded comment] Check this</t></text></comment>` +
+			`<comment ref="A3" authorId="1"><text><r><rPr><b/></rPr><t>Ann:` + "\n" + `</t></r><r><t>Source: Q3 &amp; Q4</t></r></text></comment></commentList></comments>`,
+		"xl/threadedComments/threadedComment1.xml": `<?xml version="1.0"?><ThreadedComments xmlns="http://schemas.microsoft.com/office/spreadsheetml/2018/threadedcomments">` +
+			`<threadedComment ref="B1" dT="2024-05-01T10:20:30.00" personId="{P1}" id="{C1}"><text>Check this</text></threadedComment>` +
+			`<threadedComment ref="B1" dT="2024-05-02T08:00:00.00" personId="{P2}" id="{C2}" parentId="{C1}"><text>Done</text></threadedComment></ThreadedComments>`,
+		"xl/persons/person.xml":       `<?xml version="1.0"?><personList xmlns="http://schemas.microsoft.com/office/spreadsheetml/2018/threadedcomments"><person displayName="Bob" id="{P1}"/><person displayName="Cy" id="{P2}"/></personList>`,
+		"xl/drawings/vmlDrawing1.vml": `<xml></xml>`,
+	}
+	out := patchPackage(t, buf.Bytes(), parts, func(name string, data []byte) []byte {
+		switch name {
+		case "xl/worksheets/sheet1.xml":
+			return bytes.Replace(data, []byte("</ma:worksheet>"), []byte(`<ma:legacyDrawing r:id="rId3"/></ma:worksheet>`), 1)
+		case "xl/_rels/workbook.xml.rels":
+			return bytes.Replace(data, []byte("</Relationships>"), []byte(fmt.Sprintf(rel, "rId99", "microsoft.com/office/2017/10", "person", "persons/person.xml")+"</Relationships>"), 1)
+		}
+		return data
+	})
+
+	thread := []CellComment{
+		{Author: "Bob", Text: "Check this", Date: time.Date(2024, 5, 1, 10, 20, 30, 0, time.UTC)},
+		{Author: "Cy", Text: "Done", Date: time.Date(2024, 5, 2, 8, 0, 0, 0, time.UTC), Reply: true},
+	}
+	note := []CellComment{{Author: "Ann", Text: "Source: Q3 & Q4"}}
+	var m WorkbookModel
+	for _, b := range []Backend{Unioffice, Native} {
+		if m, err = b.ParseWorkbook(bytes.NewReader(out.Bytes()), int64(out.Len())); err != nil {
+			t.Fatal(err)
+		}
+		s := m.Sheets[0]
+		if len(s.Rows) != 3 || len(s.Rows[2].Cells) != 2 {
+			t.Fatalf("%T: grid not grown: %v", b, s.Rows)
+		}
+		if got := s.Rows[0].Cells[0].Comments; !reflect.DeepEqual(got, thread) {
+			t.Errorf("%T: A1 comments = %v, want %v", b, got, thread)
+		}
+		if c := s.Rows[2].Cells[0]; c == nil || c.Ref != "A3" || !reflect.DeepEqual(c.Comments, note) {
+			t.Errorf("%T: A3 = %v", b, c)
+		}
+	}
+
+	html := RenderWorkbookHTMLWith(m, RenderOptions{})
+	for _, want := range []string{`class="cellstyle1 has-comment" title="Bob: Check this` + "\n" + `  Cy: Done"`, `title="Ann: Source: Q3 &amp; Q4"`, `td.has-comment {`} {
+		if !strings.Contains(html, want) {
+			t.Errorf("%q missing:\n%s", want, html)
+		}
+	}
+}
+
+func BenchmarkRenderWorkbookHTML(b *testing.B) {
+	styles := []CellStyle{{}, {FontFamily: "Calibri", FontSizePt: 11}, {FontFamily: "Arial", HorizontalAlign: "right", FontColor: "FF0000", WrapText: true}}
+	sheet := RenderSheet{Name: "Data"}
+	for c := 0; c < 20; c++ {
+		sheet.ColWidths, sheet.ColHidden = append(sheet.ColWidths, 64), append(sheet.ColHidden, false)
+	}
+	for r := 0; r < 10000; r++ {
+		row := RenderRow{HeightPx: 20}
+		for c := 0; c < 20; c++ {
+			row.Cells = append(row.Cells, &RenderCell{Ref: fmt.Sprintf("%c%d", 'A'+c, r+1), Value: fmt.Sprintf("value %d & <%d>", r, c), ColSpan: 1, RowSpan: 1, Style: styles[(r+c)%len(styles)]})
+		}
+		sheet.Rows = append(sheet.Rows, row)
+	}
+	m := WorkbookModel{Sheets: []RenderSheet{sheet}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		RenderWorkbookHTMLWith(m, RenderOptions{})
+	}
+}
+
+// formatWorkbook returns a workbook of one column of cells, given as c
+// elements, whose style i+2 has number format formats[i] and style 1 the
+// built-in #,##0.00.
+func formatWorkbook(t *testing.T, formats, cells []string, date1904 bool) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := WriteWorkbook(&buf, WorkbookModel{Sheets: []RenderSheet{{Name: "S", ColWidths: []float64{64}, ColHidden: []bool{false}, Rows: []RenderRow{{Cells: []*RenderCell{{Value: "x", ColSpan: 1, RowSpan: 1}}}}}}}); err != nil {
+		t.Fatal(err)
+	}
+	const ns = `xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"`
+	var numFmts, xfs strings.Builder
+	xfs.WriteString(`<xf numFmtId="0"/><xf numFmtId="4"/>`)
+	for i, f := range formats {
+		fmt.Fprintf(&numFmts, `<numFmt numFmtId="%d" formatCode="%s"/>`, 164+i, html.EscapeString(f))
+		fmt.Fprintf(&xfs, `<xf numFmtId="%d" applyNumberFormat="1"/>`, 164+i)
+	}
+	styles := fmt.Sprintf(`<?xml version="1.0"?><styleSheet %s><numFmts count="%d">%s</numFmts>`+
+		`<fonts count="1"><font/></fonts><fills count="1"><fill/></fills><borders count="1"><border/></borders>`+
+		`<cellXfs count="%d">%s</cellXfs></styleSheet>`, ns, len(formats), numFmts.String(), len(formats)+2, xfs.String())
+	var rows strings.Builder
+	for i, c := range cells {
+		fmt.Fprintf(&rows, `<row r="%d">%s</row>`, i+1, c)
+	}
+	sheet := fmt.Sprintf(`<?xml version="1.0"?><worksheet %s><sheetData>%s</sheetData></worksheet>`, ns, rows.String())
+	return patchPackage(t, buf.Bytes(), map[string]string{"xl/styles.xml": styles, "xl/worksheets/sheet1.xml": sheet}, func(name string, data []byte) []byte {
+		if name == "xl/workbook.xml" && date1904 {
+			return bytes.Replace(data, []byte("<ma:sheets>"), []byte(`<ma:workbookPr date1904="1"/><ma:sheets>`), 1)
+		}
+		return data
+	})
+}
+
+func TestNumberFormats(t *testing.T) {
+	formats := []string{
+		`[$€-407]#,##0.00`, `#,##0.00_);[Red]\(#,##0.00\)`, `0.0%`, `0.00E+00`, `# ?/?`, `yyyy-mm-dd`, `"Code "@`, `#,##0,"K"`,
+	}
+	out := formatWorkbook(t, formats, []string{
+		`<c r="A1" s="1"><v>1234567.891</v></c>`,
+		`<c r="A2" s="2"><v>1234.5</v></c>`,
+		`<c r="A3" s="3"><v>-1234.5</v></c>`,
+		`<c r="A4" s="4"><v>0.1234</v></c>`,
+		`<c r="A5" s="5"><v>12345.678</v></c>`,
+		`<c r="A6" s="6"><v>2.75</v></c>`,
+		`<c r="A7" s="7"><v>45352</v></c>`,
+		`<c r="A8" s="8" t="inlineStr"><is><t>X1</t></is></c>`,
+		`<c r="A9" s="9"><v>25400</v></c>`,
+		`<c r="A10" t="b"><v>1</v></c>`,
+		`<c r="A11"><v>0.1</v></c>`,
+	}, false)
+
+	want := []struct{ value, raw, code, color string }{
+		{"1,234,567.89", "1234567.891", "#,##0.00", ""},
+		{"€1,234.50", "1234.5", formats[0], ""},
+		{"(1,234.50)", "-1234.5", formats[1], "FF0000"},
+		{"12.3%", "0.1234", formats[2], ""},
+		{"1.23E+04", "12345.678", formats[3], ""},
+		{"2 3/4", "2.75", formats[4], ""},
+		{"2024-03-01", "45352", formats[5], ""},
+		{"Code X1", "X1", formats[6], ""},
+		{"25K", "25400", formats[7], ""},
+		{"TRUE", "TRUE", "", ""},
+		{"0.1", "0.1", "", ""},
+	}
+	for _, b := range []Backend{Unioffice, Native} {
+		m, err := b.ParseWorkbook(bytes.NewReader(out.Bytes()), int64(out.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows := m.Sheets[0].Rows
+		if len(rows) != len(want) {
+			t.Fatalf("%T: %d rows, want %d", b, len(rows), len(want))
+		}
+		for i, w := range want {
+			c := rows[i].Cells[0]
+			if c.Value != w.value || c.Raw != w.raw || c.NumberFormat != w.code || c.Style.FontColor != w.color {
+				t.Errorf("%T: row %d = %q, %q, %q, %q; want %q, %q, %q, %q", b, i+1, c.Value, c.Raw, c.NumberFormat, c.Style.FontColor, w.value, w.raw, w.code, w.color)
+			}
+		}
+	}
+}
+
+func TestConditionalFormatting(t *testing.T) {
+	out := formatWorkbook(t, nil, []string{
+		`<c r="A1"><v>1</v></c><c r="B1" t="inlineStr"><is><t>x</t></is></c>`,
+		`<c r="A2"><v>5</v></c><c r="B2" t="inlineStr"><is><t>y</t></is></c>`,
+		`<c r="A3"><v>10</v></c><c r="B3" t="inlineStr"><is><t>x</t></is></c>`,
+		`<c r="A4"><v>5</v></c>`,
+		`<c r="A5"><v>20</v></c><c r="B5" t="inlineStr"><is><t>z</t></is></c>`,
+	}, false)
+	dxfs := `<dxfs count="3">` +
+		`<dxf><font><color rgb="FF9C0006"/></font><fill><patternFill><bgColor rgb="FFFFC7CE"/></patternFill></fill></dxf>` +
+		`<dxf><font><b/></font><fill><patternFill><bgColor rgb="FF00FF00"/></patternFill></fill></dxf>` +
+		`<dxf><font><i/></font></dxf></dxfs>`
+	rules := `<conditionalFormatting sqref="A1:A5">` +
+		`<cfRule type="cellIs" dxfId="0" priority="1" operator="greaterThan"><formula>8</formula></cfRule>` +
+		`<cfRule type="top10" dxfId="2" priority="3" rank="1"/>` +
+		`<cfRule type="duplicateValues" dxfId="1" priority="4"/></conditionalFormatting>` +
+		`<conditionalFormatting sqref="B1:B5">` +
+		`<cfRule type="expression" dxfId="1" priority="2"><formula>$A1=5</formula></cfRule>` +
+		`<cfRule type="cellIs" dxfId="2" priority="5" operator="equal"><formula>"X"</formula></cfRule></conditionalFormatting>` +
+		`<conditionalFormatting sqref="A1:!"><cfRule type="expression" dxfId="0" priority="6"><formula>TRUE</formula></cfRule></conditionalFormatting>`
+	out = patchPackage(t, out.Bytes(), nil, func(name string, data []byte) []byte {
+		switch name {
+		case "xl/styles.xml":
+			return bytes.Replace(data, []byte("</styleSheet>"), []byte(dxfs+"</styleSheet>"), 1)
+		case "xl/worksheets/sheet1.xml":
+			return bytes.Replace(data, []byte("</sheetData>"), []byte("</sheetData>"+rules), 1)
+		}
+		return data
+	})
+
+	for _, b := range []Backend{Unioffice, Native} {
+		m, err := b.ParseWorkbook(bytes.NewReader(out.Bytes()), int64(out.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cell := func(ref string) *RenderCell {
+			r, c := int(ref[1]-'1'), int(ref[0]-'A')
+			if cells := m.Sheets[0].Rows[r].Cells; c < len(cells) && cells[c] != nil {
+				return cells[c]
+			}
+			return &RenderCell{}
+		}
+		italic := func(rc *RenderCell) bool { return len(rc.Runs) > 0 && rc.Runs[0].Italic }
+		bold := func(rc *RenderCell) bool { return len(rc.Runs) > 0 && rc.Runs[0].Bold }
+		for _, tt := range []struct {
+			ref, fill, font string
+			bold, italic    bool
+		}{
+			{"A1", "", "", false, false},
+			{"A2", "00FF00", "", true, false},
+			{"A3", "FFC7CE", "9C0006", false, false},
+			{"A4", "00FF00", "", true, false},
+			{"A5", "FFC7CE", "9C0006", false, true},
+			{"B1", "", "", false, true},
+			{"B2", "00FF00", "", true, false},
+			{"B3", "", "", false, true},
+			{"B4", "00FF00", "", false, false},
+			{"B5", "", "", false, false},
+		} {
+			rc := cell(tt.ref)
+			if rc.Style.BackgroundColor != tt.fill || rc.Style.FontColor != tt.font || bold(rc) != tt.bold || italic(rc) != tt.italic {
+				t.Errorf("%v: %s: fill %q, font %q, bold %t, italic %t; want %q, %q, %t, %t",
+					b, tt.ref, rc.Style.BackgroundColor, rc.Style.FontColor, bold(rc), italic(rc), tt.fill, tt.font, tt.bold, tt.italic)
+			}
+		}
+		if rc := cell("B4"); rc.Ref != "B4" || rc.Value != "" {
+			t.Errorf("%v: B4 = %+v", b, rc)
+		}
+		if len(m.Warnings) != 1 || m.Warnings[0].Code != diag.BadReference {
+			t.Errorf("%v: warnings = %v", b, m.Warnings)
+		}
+	}
+}
+
+func TestColorScalesAndIconSets(t *testing.T) {
+	var cells []string
+	for i, v := range [][2]string{{"0", "1"}, {"25", "2"}, {"50", "3"}, {"75", "4"}, {"100", "10"}} {
+		cells = append(cells, fmt.Sprintf(`<c r="A%d"><v>%s</v></c><c r="B%d"><v>%s</v></c>`, i+1, v[0], i+1, v[1]))
+	}
+	out := formatWorkbook(t, nil, cells, false)
+	rules := `<conditionalFormatting sqref="A1:A5">` +
+		`<cfRule type="colorScale" priority="1"><colorScale><cfvo type="min"/><cfvo type="max"/>` +
+		`<color rgb="FFFFFFFF"/><color rgb="FF000000"/></colorScale></cfRule>` +
+		`<cfRule type="iconSet" priority="2"><iconSet iconSet="3Arrows"><cfvo type="percent" val="0"/><cfvo type="percent" val="33"/><cfvo type="percent" val="67"/></iconSet></cfRule>` +
+		`</conditionalFormatting><conditionalFormatting sqref="B1:B5">` +
+		`<cfRule type="colorScale" priority="3"><colorScale><cfvo type="min"/><cfvo type="percentile" val="50"/><cfvo type="max"/>` +
+		`<color rgb="FFFF0000"/><color rgb="FFFFFF00"/><color rgb="FF00FF00"/></colorScale></cfRule>` +
+		`<cfRule type="iconSet" priority="4"><iconSet showValue="0" reverse="1"><cfvo type="percent" val="0"/><cfvo type="num" val="3"/><cfvo type="num" val="5" gte="0"/></iconSet></cfRule>` +
+		`</conditionalFormatting>`
+	out = patchPackage(t, out.Bytes(), nil, func(name string, data []byte) []byte {
+		if name == "xl/worksheets/sheet1.xml" {
+			return bytes.Replace(data, []byte("</sheetData>"), []byte("</sheetData>"+rules), 1)
+		}
+		return data
+	})
+
+	want := []struct {
+		fillA, fillB string
+		iconA, iconB int
+	}{
+		{"FFFFFF", "FF0000", 0, 2},
+		{"BFBFBF", "FF8000", 0, 2},
+		{"808080", "FFFF00", 1, 1},
+		{"404040", "DBFF00", 2, 1},
+		{"000000", "00FF00", 2, 0},
+	}
+	for _, b := range []Backend{Unioffice, Native} {
+		m, err := b.ParseWorkbook(bytes.NewReader(out.Bytes()), int64(out.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, w := range want {
+			a, c := m.Sheets[0].Rows[i].Cells[0], m.Sheets[0].Rows[i].Cells[1]
+			if a.Style.BackgroundColor != w.fillA || c.Style.BackgroundColor != w.fillB {
+				t.Errorf("%v: row %d: fills %q, %q; want %q, %q", b, i+1, a.Style.BackgroundColor, c.Style.BackgroundColor, w.fillA, w.fillB)
+			}
+			wantA := CellIcon{Set: "3Arrows", Index: w.iconA}
+			wantB := CellIcon{Set: "3TrafficLights1", Index: w.iconB, HideValue: true}
+			if a.Icon == nil || *a.Icon != wantA || c.Icon == nil || *c.Icon != wantB {
+				t.Errorf("%v: row %d: icons %v, %v; want %v, %v", b, i+1, a.Icon, c.Icon, wantA, wantB)
+			}
+		}
+
+		if got, want := strings.Split(WorkbookText(m), "\n")[1], "↓ 0\t●"; got != want {
+			t.Errorf("%v: text %q, want %q", b, got, want)
+		}
+		var buf bytes.Buffer
+		if err := RenderWorkbookHTMLTo(&buf, m, RenderOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		page := buf.String()
+		if n := strings.Count(page, `<svg class="xlsx-icon"`); n != 10 {
+			t.Errorf("%v: %d icons in HTML, want 10", b, n)
+		}
+		if !strings.Contains(page, `aria-label="↑"><path d="M8 1 15 8H10.5V15H5.5V8H1Z" fill="#00B050" transform="rotate(0 8 8)"/></svg>100<`) {
+			t.Errorf("%v: HTML lacks the up arrow of A5", b)
+		}
+		if strings.Contains(page, `</svg>10<`) {
+			t.Errorf("%v: HTML shows the hidden value of B5", b)
+		}
+	}
+}
+
+func TestBorders(t *testing.T) {
+	out := formatWorkbook(t, nil, []string{`<c r="A1" s="1"><v>1</v></c>`}, false)
+	border := `<border><left style="hair"><color rgb="FFFF0000"/></left><right style="mediumDashDot"/>` +
+		`<top style="double"><color rgb="FF0000FF"/></top><bottom style="thick"><color auto="1"/></bottom></border>`
+	out = patchPackage(t, out.Bytes(), nil, func(name string, data []byte) []byte {
+		if name == "xl/styles.xml" {
+			data = bytes.Replace(data, []byte(`<borders count="1"><border/></borders>`), []byte(`<borders count="2"><border/>`+border+`</borders>`), 1)
+			return bytes.Replace(data, []byte(`<xf numFmtId="4"/>`), []byte(`<xf numFmtId="4" borderId="1"/>`), 1)
+		}
+		return data
+	})
+	want := Borders{Top: Border{Style: "double", Color: "0000FF"}, Right: Border{Style: "dashed"}, Bottom: Border{Style: "thick"}, Left: Border{Style: "thin", Color: "FF0000"}}
+
+	for _, b := range []Backend{Unioffice, Native} {
+		m, err := b.ParseWorkbook(bytes.NewReader(out.Bytes()), int64(out.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		st := m.Sheets[0].Rows[0].Cells[0].Style
+		if st.Borders != want || st.BorderColor != "FF0000" {
+			t.Errorf("%v: borders %v, colour %q", b, st.Borders, st.BorderColor)
+		}
+
+		page := RenderWorkbookHTML(m)
+		for _, css := range []string{
+			"border-top-style:double;border-top-width:3px;border-top-color:#0000FF;",
+			"border-right-style:dashed;border-right-width:1px;border-right-color:#000000;",
+			"border-bottom-style:solid;border-bottom-width:3px;border-bottom-color:#000000;",
+			"border-left-style:solid;border-left-width:1px;border-left-color:#FF0000;",
+		} {
+			if !strings.Contains(page, css) {
+				t.Errorf("%v: HTML lacks %s", b, css)
+			}
+		}
+
+		var buf bytes.Buffer
+		if err := WriteWorkbook(&buf, m); err != nil {
+			t.Fatal(err)
+		}
+		back, err := b.ParseWorkbook(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := back.Sheets[0].Rows[0].Cells[0].Style.Borders; got != want {
+			t.Errorf("%v: written borders %v", b, got)
+		}
+	}
+}
+
+func TestDateSystems(t *testing.T) {
+	formats := []string{`yyyy-mm-dd`, `[h]:mm`, `h:mm AM/PM`, `[Red]d mmm yyyy`}
+	// 1 March 2024, 18:00 is 45352.75 in the 1900 system and 43890.75 in
+	// the 1904 one.
+	serial := map[bool]string{false: "45352.75", true: "43890.75"}
+	backends := []struct {
+		b    Backend
+		date string // the value of both date cells
+	}{
+		{Unioffice, ""},
+		{Native, ""},
+		{WithDateLayout(Native, time.RFC3339, time.FixedZone("JST", 9*3600)), "2024-03-02T03:00:00+09:00"},
+		{WithDateLayout(nil, "2006-01-02 15:04", nil), "2024-03-01 18:00"},
+	}
+	for _, date1904 := range []bool{false, true} {
+		out := formatWorkbook(t, formats, []string{
+			`<c r="A1" s="2"><v>` + serial[date1904] + `</v></c>`,
+			`<c r="A2" s="3"><v>1.5</v></c>`,
+			`<c r="A3" s="4"><v>0.75</v></c>`,
+			`<c r="A4" s="5"><v>` + serial[date1904] + `</v></c>`,
+		}, date1904)
+		for _, tt := range backends {
+			m, err := tt.b.ParseWorkbook(bytes.NewReader(out.Bytes()), int64(out.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []string{"2024-03-01", "36:00", "6:00 PM", "1 Mar 2024"}
+			if tt.date != "" {
+				want[0], want[3] = tt.date, tt.date
+			}
+			for i, w := range want {
+				if c := m.Sheets[0].Rows[i].Cells[0]; c.Value != w {
+					t.Errorf("%v, date1904 %t: row %d = %q, want %q", tt.b, date1904, i+1, c.Value, w)
+				}
+			}
+			if c := m.Sheets[0].Rows[3].Cells[0]; c.Style.FontColor != "FF0000" || c.Raw != serial[date1904] {
+				t.Errorf("%v, date1904 %t: colour %q, raw %q", tt.b, date1904, c.Style.FontColor, c.Raw)
+			}
+		}
+	}
+}